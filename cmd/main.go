@@ -20,15 +20,19 @@ import (
 	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/SiberianMonster/memoryprint/internal/authhandlers"
 	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
 	"github.com/SiberianMonster/memoryprint/internal/initstorage"
 	"github.com/SiberianMonster/memoryprint/internal/imagehandlers"
 	"github.com/SiberianMonster/memoryprint/internal/userhandlers"
 	"github.com/SiberianMonster/memoryprint/internal/projecthandlers"
 	"github.com/SiberianMonster/memoryprint/internal/orderhandlers"
 	"github.com/SiberianMonster/memoryprint/internal/middleware"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
 	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/transactions"
 	"github.com/gorilla/mux"
 	// "github.com/rs/cors"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -38,11 +42,12 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 )
 
 var err error
-var host, connStr, accrualStr, adminEmail, yandexKey, timewebToken, balaToken, imageHost, bankDomain, bankuserName, bankPassword, deliveryDomain, deliveryClientID, deliverySecret, encryptionString *string
+var host, connStr, accrualStr, adminEmail, yandexKey, timewebToken, balaToken, imageHost, bankDomain, bankuserName, bankPassword, bankCallbackSecret, deliveryDomain, deliveryClientID, deliverySecret, deliveryTariffs, deliveryWebhookSecret, deliveryWebhookHost, deliveryReconcileInterval, encryptionString, fakeGatewayURL, fakeCarrierURL, paymentExpiryWindow, receiptVAT *string
 var db *pgxpool.Pool
 
 func init() {
@@ -64,10 +69,19 @@ func init() {
 	bankDomain = config.GetEnv("BANK_DOMAIN", flag.String("bank", section.Key("bankdomain").String(), "BANK_DOMAIN"))
 	bankuserName = config.GetEnv("BANK_USERNAME", flag.String("bankusername", section.Key("bankusername").String(), "BANK_USERNAME"))
 	bankPassword = config.GetEnv("BANK_PASSWORD", flag.String("bankpassword", section.Key("bankpassword").String(), "BANK_PASSWORD"))
+	bankCallbackSecret = config.GetEnv("BANK_CALLBACK_SECRET", flag.String("bankcallbacksecret", section.Key("bankcallbacksecret").String(), "BANK_CALLBACK_SECRET"))
 	deliveryDomain = config.GetEnv("DELIVERY_DOMAIN", flag.String("deliveryDomain", section.Key("deliverydomain").String(), "DELIVERY_DOMAIN"))
 	deliveryClientID = config.GetEnv("DELIVERY_CLIENTID", flag.String("deliveryClientID", section.Key("deliveryclientid").String(), "DELIVERY_CLIENTID"))
 	deliverySecret = config.GetEnv("DELIVERY_SECRET", flag.String("deliverySecret", section.Key("deliverysecret").String(), "DELIVERY_SECRET"))
+	deliveryTariffs = config.GetEnv("DELIVERY_TARIFFS", flag.String("deliveryTariffs", section.Key("deliverytariffs").String(), "DELIVERY_TARIFFS"))
+	deliveryWebhookSecret = config.GetEnv("DELIVERY_WEBHOOK_SECRET", flag.String("deliveryWebhookSecret", section.Key("deliverywebhooksecret").String(), "DELIVERY_WEBHOOK_SECRET"))
+	deliveryWebhookHost = config.GetEnv("DELIVERY_WEBHOOK_HOST", flag.String("deliveryWebhookHost", section.Key("deliverywebhookhost").String(), "DELIVERY_WEBHOOK_HOST"))
+	deliveryReconcileInterval = config.GetEnv("DELIVERY_RECONCILE_INTERVAL", flag.String("deliveryReconcileInterval", section.Key("deliveryreconcileinterval").String(), "DELIVERY_RECONCILE_INTERVAL"))
 	encryptionString = config.GetEnv("ENCRYPTION_STRING", flag.String("encryptionString", section.Key("encryptionstring").String(), "ENCRYPTION_STRING"))
+	fakeGatewayURL = config.GetEnv("FAKE_GATEWAY_URL", flag.String("fakeGatewayURL", section.Key("fakegatewayurl").String(), "FAKE_GATEWAY_URL"))
+	fakeCarrierURL = config.GetEnv("FAKE_CARRIER_URL", flag.String("fakeCarrierURL", section.Key("fakecarrierurl").String(), "FAKE_CARRIER_URL"))
+	paymentExpiryWindow = config.GetEnv("PAYMENT_EXPIRY_WINDOW", flag.String("paymentExpiryWindow", section.Key("paymentexpirywindow").String(), "PAYMENT_EXPIRY_WINDOW"))
+	receiptVAT = config.GetEnv("RECEIPT_VAT", flag.String("receiptVAT", section.Key("receiptvat").String(), "RECEIPT_VAT"))
 
 }
 
@@ -99,7 +113,24 @@ func main() {
 		log.Fatalf("Database credentials were not passed")
 	}
 
-	config.DB, _ = initstorage.SetUpDBConnection(ctx, connStr)
+	// migrate up|down [steps]|status manages the schema and exits without starting the server
+	if flag.Arg(0) == "migrate" {
+		db := initstorage.ConnectDB(ctx, connStr)
+		out, err := initstorage.RunMigrateCommand(ctx, db, flag.Args()[1:])
+		db.Close()
+		fmt.Println(out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var ok bool
+	config.DB, ok = initstorage.SetUpDBConnection(ctx, connStr)
+	if !ok {
+		log.Fatalf("Database schema could not be migrated")
+	}
 	defer config.DB.Close()
 
 	config.AdminEmail = *adminEmail
@@ -110,15 +141,78 @@ func main() {
 	config.BankDomain = *bankDomain
 	config.BankUsername = *bankuserName
 	config.BankPassword = *bankPassword
+	config.BankCallbackSecret = *bankCallbackSecret
 	config.DeliveryDomain = *deliveryDomain
 	config.DeliveryClientID = *deliveryClientID
 	config.DeliverySecret = *deliverySecret
+	config.DeliveryWebhookSecret = *deliveryWebhookSecret
 	config.EncryptionString = *encryptionString
+	if *receiptVAT != "" {
+		config.ReceiptVAT = *receiptVAT
+	}
+	if *paymentExpiryWindow != "" {
+		window, err := time.ParseDuration(*paymentExpiryWindow)
+		if err != nil {
+			log.Fatalf("Invalid payment expiry window %s. Err: %s", *paymentExpiryWindow, err)
+		}
+		config.PaymentExpiryWindow = window
+	}
+	if *deliveryReconcileInterval != "" {
+		interval, err := time.ParseDuration(*deliveryReconcileInterval)
+		if err != nil {
+			log.Fatalf("Invalid delivery reconcile interval %s. Err: %s", *deliveryReconcileInterval, err)
+		}
+		config.DeliveryReconcileInterval = interval
+	}
 
-	go orderhandlers.SentOrdersToPrint(ctx, config.DB)
-	//go userhandlers.SentGiftCertificateMail(ctx, config.DB)
-	go delivery.RoutineUpdateDeliveryStatus(ctx, config.DB)
-	// go update transaction status
+	stores := handlersfunc.NewPgStores(config.DB)
+	// payments go through the local fake acquirer when its public url is configured
+	var payments transactions.PaymentGateway = transactions.NewBankGateway(config.BankDomain, config.BankUsername, config.BankPassword)
+	var fakeGateway *transactions.FakeGateway
+	if *fakeGatewayURL != "" {
+		// the fake acquirer approves payments no money was paid for, it never runs where the bank is configured
+		if config.BankUsername != "" || config.BankPassword != "" {
+			log.Fatalf("Fake payment gateway can not be enabled with bank credentials configured")
+		}
+		fakeGateway = transactions.NewFakeGateway(*fakeGatewayURL)
+		payments = fakeGateway
+	}
+	authHandler := authhandlers.New(stores)
+	imageHandler := imagehandlers.New(stores)
+	// shipments go through the local fake CDEK api when its public url is configured
+	cdek := delivery.NewCDEK("https://"+config.DeliveryDomain, config.DeliveryClientID, config.DeliverySecret)
+	var fakeCarrier *delivery.FakeCDEK
+	if *fakeCarrierURL != "" {
+		fakeCarrier = delivery.NewFakeCDEK(config.DeliveryClientID, config.DeliverySecret)
+		fakeCarrier.AutoAccept = true
+		cdek.BaseURL = strings.TrimSuffix(*fakeCarrierURL, "/") + delivery.FakeCarrierPath
+		if *deliveryWebhookHost == "" {
+			*deliveryWebhookHost = *fakeCarrierURL
+		}
+	}
+	if *deliveryTariffs != "" {
+		cdek.Tariffs, err = delivery.ParseTariffs(*deliveryTariffs)
+		if err != nil {
+			log.Fatalf("Invalid delivery tariffs %s. Err: %s", *deliveryTariffs, err)
+		}
+	}
+	var carrier delivery.Carrier = cdek
+	userHandler := userhandlers.New(stores, payments)
+	projectHandler := projecthandlers.New(stores)
+	orderHandler := orderhandlers.New(stores, payments, carrier, objectsstorage.NewTimewebBucket(config.TimewebToken))
+	auth := middleware.NewAuth(stores.Users)
+
+	go orderHandler.SentOrdersToPrint(ctx)
+	go userHandler.SentGiftCertificateMail(ctx)
+	go userHandler.ReconcileCertificatePayments(ctx)
+	// the status events come to DeliveryWebhook, polling only catches the lost ones
+	if config.DeliveryWebhookSecret != "" && *deliveryWebhookHost != "" {
+		go delivery.RoutineSubscribeWebhook(ctx, carrier, delivery.WebhookURL(*deliveryWebhookHost, config.DeliveryWebhookSecret))
+	}
+	go orderHandler.ReconcileDeliveries(ctx)
+	go delivery.RoutineRefreshDeliveryPoints(ctx, carrier, stores.Delivery)
+	go orderHandler.ReconcilePayments(ctx)
+	go orderHandler.ConfirmShipments(ctx)
 
 
 	router := mux.NewRouter()
@@ -134,115 +228,158 @@ func main() {
 	adminRouter := router.MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
 		return true
 	}).Subrouter()
+
+	// the admins and the printing agents
+	staffRouter := router.MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
+		return true
+	}).Subrouter()
 	
-	noAuthRouter.HandleFunc("/api/v1/auth/signup", userhandlers.Register).Methods("POST","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/auth/login", userhandlers.Login).Methods("POST","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/load-templates", projecthandlers.LoadTemplates).Methods("GET","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/load-template/{id}", projecthandlers.LoadTemplate).Methods("GET","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/load-prices", projecthandlers.LoadPrices).Methods("GET","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/load-colors", projecthandlers.LoadColours).Methods("GET","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/load-promocodes", userhandlers.LoadPromocodes).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/auth/signup", userHandler.Register).Methods("POST","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/auth/login", userHandler.Login).Methods("POST","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/load-templates", projectHandler.LoadTemplates).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/load-template/{id}", projectHandler.LoadTemplate).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/load-prices", projectHandler.LoadPrices).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/load-colors", projectHandler.LoadColours).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/load-promocodes", userHandler.LoadPromocodes).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/delivery/points", orderHandler.LoadDeliveryPoints).Methods("GET","OPTIONS")
 	
-	noAuthRouter.HandleFunc("/api/v1/greet", authhandlers.Greet).Methods("GET","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/auth/restore", authhandlers.GenerateTempPass).Methods("POST","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/change-user-status/{id}", userhandlers.MakeUserAdmin).Methods("GET","OPTIONS")
-	//noAuthRouter.HandleFunc("/api/v1/verify/password-reset", userhandlers.VerifyPasswordReset)
-	noAuthRouter.HandleFunc("/api/v1/create-certificate", userhandlers.CreateCertificate).Methods("POST","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/cancel-subscription/{code}", userhandlers.CancelSubscription).Methods("POST","OPTIONS")
-	noAuthRouter.HandleFunc("/api/v1/renew-subscription/{code}", userhandlers.RenewSubscription).Methods("POST","OPTIONS")
-	//noAuthRouter.HandleFunc("/api/v1/renew-fixtures", userhandlers.RenewFixtures).Methods("POST","OPTIONS")
-
-
-	authRouter.Use(middleware.MiddlewareValidateAccessToken)
-	adminRouter.Use(middleware.MiddlewareValidateAccessToken)
-	// authRouter.Use(middleware.MiddlewareValidateRefreshToken)
-	// adminRouter.Use(middleware.MiddlewareValidateRefreshToken)
-	adminRouter.Use(middleware.AdminHandler)
+	noAuthRouter.HandleFunc("/api/v1/greet", authHandler.Greet).Methods("GET","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/auth/restore", authHandler.GenerateTempPass).Methods("POST","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/change-user-status/{id}", userHandler.MakeUserAdmin).Methods("GET","OPTIONS")
+	//noAuthRouter.HandleFunc("/api/v1/verify/password-reset", userHandler.VerifyPasswordReset)
+	noAuthRouter.HandleFunc("/api/v1/create-certificate", userHandler.CreateCertificate).Methods("POST","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/payments/callback", orderHandler.PaymentCallback).Methods("GET","POST")
+	noAuthRouter.HandleFunc(delivery.WebhookPath+"{token}", orderHandler.DeliveryWebhook).Methods("POST")
+	noAuthRouter.HandleFunc("/api/v1/cancel-subscription/{code}", userHandler.CancelSubscription).Methods("POST","OPTIONS")
+	noAuthRouter.HandleFunc("/api/v1/renew-subscription/{code}", userHandler.RenewSubscription).Methods("POST","OPTIONS")
+	if fakeGateway != nil {
+		noAuthRouter.PathPrefix(transactions.FakeGatewayPath).Handler(fakeGateway).Methods("GET","POST")
+	}
+	if fakeCarrier != nil {
+		noAuthRouter.PathPrefix(delivery.FakeCarrierPath + "/").Handler(http.StripPrefix(delivery.FakeCarrierPath, fakeCarrier))
+	}
+	//noAuthRouter.HandleFunc("/api/v1/renew-fixtures", userHandler.RenewFixtures).Methods("POST","OPTIONS")
+
+
+	authRouter.Use(auth.MiddlewareValidateAccessToken)
+	adminRouter.Use(auth.MiddlewareValidateAccessToken)
+	// authRouter.Use(auth.MiddlewareValidateRefreshToken)
+	// adminRouter.Use(auth.MiddlewareValidateRefreshToken)
+	adminRouter.Use(auth.AdminHandler)
+	staffRouter.Use(auth.MiddlewareValidateAccessToken)
+	staffRouter.Use(auth.StaffHandler)
 	
 
 
-	adminRouter.HandleFunc("/api/v1/admin/create-template", projecthandlers.CreateTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/save-template-pages/{id}", projecthandlers.SavePage).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-template", projectHandler.CreateTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/save-template-pages/{id}", projectHandler.SavePage).Methods("POST","OPTIONS")
 	// do I need to retrun page_id here?
-	adminRouter.HandleFunc("/api/v1/admin/add-template-pages/{id}", projecthandlers.AddTemplatePages).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-template-pages/{id}", projecthandlers.DeleteTemplatePages).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/reorder-template-pages/{id}", projecthandlers.ReorderTemplatePages).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/publish-template/{id}", projecthandlers.PublishTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/unpublish-template/{id}", projecthandlers.UnpublishTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/duplicate-template/{id}", projecthandlers.DuplicateTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/update-template/{id}", projecthandlers.UpdateTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/update-template-spine/{id}", projecthandlers.UpdateTemplateSpine).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-template/{id}", projecthandlers.DeleteTemplate).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/create-promocode", userhandlers.CreatePromocode).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/load-projects", projecthandlers.AdminLoadProjects).Methods("GET","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/load-templates", projecthandlers.AdminLoadTemplates).Methods("GET","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/load-template/{id}", projecthandlers.AdminLoadTemplate).Methods("GET","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/load-orders", orderhandlers.LoadAdminOrders).Methods("GET","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delivery-status/{id}", orderhandlers.LoadDelivery).Methods("GET","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/change-order-status/{id}", orderhandlers.UpdateOrderStatus).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/upload-order-commentary/{id}", orderhandlers.UpdateOrderCommentary).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/upload-order-video/{id}", orderhandlers.UploadOrderVideo).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/download-order-video/{id}", orderhandlers.DownloadOrderVideo).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/admin/load-order/{id}", orderhandlers.AdminLoadOrder).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/add-template-pages/{id}", projectHandler.AddTemplatePages).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-template-pages/{id}", projectHandler.DeleteTemplatePages).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/reorder-template-pages/{id}", projectHandler.ReorderTemplatePages).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/publish-template/{id}", projectHandler.PublishTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/unpublish-template/{id}", projectHandler.UnpublishTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/duplicate-template/{id}", projectHandler.DuplicateTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/update-template/{id}", projectHandler.UpdateTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/update-template-spine/{id}", projectHandler.UpdateTemplateSpine).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-template/{id}", projectHandler.DeleteTemplate).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-promocode", userHandler.CreatePromocode).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-projects", projectHandler.AdminLoadProjects).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-templates", projectHandler.AdminLoadTemplates).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-template/{id}", projectHandler.AdminLoadTemplate).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-orders", orderHandler.LoadAdminOrders).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delivery-status/{id}", orderHandler.LoadDelivery).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/change-order-status/{id}", orderHandler.UpdateOrderStatus).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/refund-order/{id}", orderHandler.RefundOrder).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-refunds/{id}", orderHandler.LoadRefunds).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-order-status-history/{id}", orderHandler.LoadOrderStatusHistory).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-order-timeline/{id}", orderHandler.AdminLoadOrderTimeline).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-capture-failures", orderHandler.LoadCaptureFailures).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-held-payments", orderHandler.LoadHeldPayments).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-delivery-failures", orderHandler.LoadDeliveryFailures).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/register-delivery/{id}", orderHandler.RegisterDelivery).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-warehouses", orderHandler.LoadWarehouses).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-warehouse", orderHandler.CreateWarehouse).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/update-warehouse/{id}", orderHandler.UpdateWarehouse).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-warehouse/{id}", orderHandler.DeleteWarehouse).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/assign-order-warehouse/{id}", orderHandler.AssignOrderWarehouse).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-complaints", orderHandler.LoadComplaints).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/resolve-complaint/{id}", orderHandler.ResolveComplaint).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/close-complaint/{id}", orderHandler.CloseComplaint).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-receipts/{id}", orderHandler.LoadReceipts).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/resend-receipt/{id}", orderHandler.ResendReceipt).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/upload-order-commentary/{id}", orderHandler.UpdateOrderCommentary).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/upload-order-video/{id}", orderHandler.UploadOrderVideo).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/download-order-video/{id}", orderHandler.DownloadOrderVideo).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/admin/load-order/{id}", orderHandler.AdminLoadOrder).Methods("GET","OPTIONS")
+	staffRouter.HandleFunc("/api/v1/admin/print-shipping-documents/{id}", orderHandler.PrintShippingDocuments).Methods("POST","OPTIONS")
+	staffRouter.HandleFunc("/api/v1/admin/print-shipping-batch", orderHandler.PrintShippingBatch).Methods("POST","OPTIONS")
 
 	
-	adminRouter.HandleFunc("/api/v1/admin/create-background", projecthandlers.AdminCreateBackground).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/create-decoration", projecthandlers.AdminCreateDecoration).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/create-layout", projecthandlers.AdminCreateLayout).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-background/{id}", projecthandlers.AdminDeleteBackground).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-decoration/{id}", projecthandlers.AdminDeleteDecoration).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-layout/{id}", projecthandlers.AdminDeleteLayout).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/update-background/{id}", projecthandlers.AdminUpdateBackground).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/update-decoration/{id}", projecthandlers.AdminUpdateDecoration).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/create-prices", projecthandlers.AdminCreatePrices).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-prices", projecthandlers.AdminDeletePrices).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/add-leather-cover", projecthandlers.AdminCreateCover).Methods("POST","OPTIONS")
-	adminRouter.HandleFunc("/api/v1/admin/delete-leather-cover/{id}", projecthandlers.AdminDeleteCover).Methods("POST","OPTIONS")
-
-	authRouter.HandleFunc("/api/v1/auth/get-user", userhandlers.CheckUserCategory).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/image/save", imagehandlers.LoadImage).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/get-user-info", userhandlers.GetUserInfo).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/update-username", userhandlers.UpdateUsername).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/update-password", userhandlers.UpdateUserInfo).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-photos", projecthandlers.UserLoadPhotos).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/upload-photo", projecthandlers.NewPhoto).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/delete-photo/{id}", projecthandlers.DeletePhoto).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/create-decoration", projecthandlers.CreateDecor).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/create-background", projecthandlers.CreateBackground).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/delete-decoration/{id}", projecthandlers.DeleteDecor).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/delete-background/{id}", projecthandlers.DeleteBackground).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/create-project", projecthandlers.CreateBlankProject).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/create-pdf-link/{id}", imagehandlers.CreatePDFVisualization).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/save-project-pages/{id}", projecthandlers.SavePage).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-projects", projecthandlers.LoadProjects).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-project/{id}", projecthandlers.LoadProject).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/add-pages/{id}", projecthandlers.AddProjectPages).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/delete-pages/{id}", projecthandlers.DeletePages).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/reorder-pages/{id}", projecthandlers.ReorderPages).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-backgrounds", projecthandlers.LoadBackground).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-decorations", projecthandlers.LoadDecoration).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-layouts", projecthandlers.LoadLayouts).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-orders", orderhandlers.LoadOrders).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/change-favourite-background/{id}", projecthandlers.FavourBackground).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/change-favourite-decoration/{id}", projecthandlers.FavourDecoration).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/change-favourite-layout/{id}", projecthandlers.FavourLayout).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/check-promocode", userhandlers.CheckPromocode).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/duplicate-project/{id}", projecthandlers.DuplicateProject).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/share-pdf-link/{id}", projecthandlers.ShareLink).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/delete-project/{id}", projecthandlers.DeleteProject).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/publish-project", orderhandlers.CreateOrder).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/unpublish-project/{id}", projecthandlers.UnpublishProject).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-cart", orderhandlers.LoadCart).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/change-project-cover/{id}", projecthandlers.UpdateCover).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/change-project-surface/{id}", projecthandlers.UpdateSurface).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/update-project-spine/{id}", projecthandlers.UpdateProjectSpine).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/use-promocode", userhandlers.UsePromocode).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/check-certificate/{code}", userhandlers.UseCertificate).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/order-payment", orderhandlers.OrderPayment).Methods("POST","OPTIONS")
-	authRouter.HandleFunc("/api/v1/load-order/{id}", orderhandlers.LoadOrder).Methods("GET","OPTIONS")
-	authRouter.HandleFunc("/api/v1/calculate-delivery", orderhandlers.CalculateDelivery).Methods("POST","OPTIONS")
-
-	authRouter.HandleFunc("/api/v1/cancel-order/{id}", orderhandlers.CancelPayment).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-background", projectHandler.AdminCreateBackground).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-decoration", projectHandler.AdminCreateDecoration).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-layout", projectHandler.AdminCreateLayout).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-background/{id}", projectHandler.AdminDeleteBackground).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-decoration/{id}", projectHandler.AdminDeleteDecoration).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-layout/{id}", projectHandler.AdminDeleteLayout).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/update-background/{id}", projectHandler.AdminUpdateBackground).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/update-decoration/{id}", projectHandler.AdminUpdateDecoration).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/create-price-list", projectHandler.AdminCreatePriceList).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-price-list/{id}", projectHandler.AdminDeletePriceList).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/load-price-lists", projectHandler.AdminLoadPriceLists).Methods("GET","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/add-leather-cover", projectHandler.AdminCreateCover).Methods("POST","OPTIONS")
+	adminRouter.HandleFunc("/api/v1/admin/delete-leather-cover/{id}", projectHandler.AdminDeleteCover).Methods("POST","OPTIONS")
+
+	authRouter.HandleFunc("/api/v1/auth/get-user", userHandler.CheckUserCategory).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/image/save", imageHandler.LoadImage).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/get-user-info", userHandler.GetUserInfo).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/update-username", userHandler.UpdateUsername).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/update-password", userHandler.UpdateUserInfo).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-photos", projectHandler.UserLoadPhotos).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/upload-photo", projectHandler.NewPhoto).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-photo/{id}", projectHandler.DeletePhoto).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/create-decoration", projectHandler.CreateDecor).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/create-background", projectHandler.CreateBackground).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-decoration/{id}", projectHandler.DeleteDecor).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-background/{id}", projectHandler.DeleteBackground).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/create-project", projectHandler.CreateBlankProject).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/create-pdf-link/{id}", imageHandler.CreatePDFVisualization).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/save-project-pages/{id}", projectHandler.SavePage).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-projects", projectHandler.LoadProjects).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-project/{id}", projectHandler.LoadProject).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/add-pages/{id}", projectHandler.AddProjectPages).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-pages/{id}", projectHandler.DeletePages).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/reorder-pages/{id}", projectHandler.ReorderPages).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-backgrounds", projectHandler.LoadBackground).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-decorations", projectHandler.LoadDecoration).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-layouts", projectHandler.LoadLayouts).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-orders", orderHandler.LoadOrders).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/change-favourite-background/{id}", projectHandler.FavourBackground).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/change-favourite-decoration/{id}", projectHandler.FavourDecoration).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/change-favourite-layout/{id}", projectHandler.FavourLayout).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/check-promocode", userHandler.CheckPromocode).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/duplicate-project/{id}", projectHandler.DuplicateProject).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/share-pdf-link/{id}", projectHandler.ShareLink).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-project/{id}", projectHandler.DeleteProject).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/publish-project", orderHandler.CreateOrder).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/unpublish-project/{id}", projectHandler.UnpublishProject).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-cart", orderHandler.LoadCart).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/add-cart-item", orderHandler.AddCartItem).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/update-cart-item/{id}", orderHandler.UpdateCartItem).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/delete-cart-item/{id}", orderHandler.DeleteCartItem).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/change-project-cover/{id}", projectHandler.UpdateCover).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/change-project-surface/{id}", projectHandler.UpdateSurface).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/update-project-spine/{id}", projectHandler.UpdateProjectSpine).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/use-promocode", userHandler.UsePromocode).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/check-certificate/{code}", userHandler.UseCertificate).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/order-payment", orderHandler.OrderPayment).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-order/{id}", orderHandler.LoadOrder).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-order-timeline/{id}", orderHandler.LoadOrderTimeline).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/create-complaint/{id}", orderHandler.CreateComplaint).Methods("POST","OPTIONS")
+	authRouter.HandleFunc("/api/v1/load-complaints/{id}", orderHandler.LoadOrderComplaints).Methods("GET","OPTIONS")
+	authRouter.HandleFunc("/api/v1/calculate-delivery", orderHandler.CalculateDelivery).Methods("POST","OPTIONS")
+
+	authRouter.HandleFunc("/api/v1/cancel-order/{id}", orderHandler.CancelPayment).Methods("POST","OPTIONS")
 
 	srv := &http.Server{
 		Handler: router,
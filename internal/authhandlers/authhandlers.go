@@ -14,9 +14,19 @@ import (
 	"net/http"
 )
 
+// Handler serves the authentication endpoints on top of the storages.
+type Handler struct {
+	handlersfunc.Stores
+}
+
+// New returns a Handler using the given storages.
+func New(stores handlersfunc.Stores) *Handler {
+	return &Handler{Stores: stores}
+}
+
 
 // Greet request greet request
-func Greet(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) Greet(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]string)
@@ -33,7 +43,7 @@ func Greet(rw http.ResponseWriter, r *http.Request) {
 }
 
 // GenerateTempPass generate a new default pass to access account.
-func GenerateTempPass(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) GenerateTempPass(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]int)
@@ -63,18 +73,18 @@ func GenerateTempPass(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	if !userstorage.CheckUser(ctx, config.DB, user.Email) {
+	if !h.Users.CheckUser(ctx, user.Email) {
 		handlersfunc.HandleUnregisteredUserError(rw)
 		return
 	}
 	log.Println(user)
-	dbUser.ID, err = userstorage.GetUserID(ctx, config.DB, user.Email) 
+	dbUser.ID, err = h.Users.GetUserID(ctx, user.Email) 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 	log.Println(dbUser)
-	dbUser, err = userstorage.GetUserData(ctx, config.DB, dbUser.ID)
+	dbUser, err = h.Users.GetUserData(ctx, dbUser.ID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -110,7 +120,7 @@ func GenerateTempPass(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Println(dbUser)
-	err = userstorage.UpdateUser(ctx, config.DB, dbUser.Password, dbUser.ID)
+	err = h.Users.UpdateUser(ctx, dbUser.Password, dbUser.ID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -48,10 +48,19 @@ var ImageHost string
 var BankDomain string
 var BankUsername string
 var BankPassword string
+var BankCallbackSecret string
 var DeliveryDomain string
 var DeliveryClientID string
 var DeliverySecret string
+// DeliveryWebhookSecret is the token in the url the carrier posts the delivery status events to.
+var DeliveryWebhookSecret string
 var EncryptionString string
+// ReceiptVAT is the VAT tag put on every fiscal receipt item: none, vat0, vat10 or vat20.
+var ReceiptVAT = "none"
+// PaymentExpiryWindow is how long an order may stay unpaid before the reconciliation worker cancels it.
+var PaymentExpiryWindow = time.Hour * 2
+// DeliveryReconcileInterval is how often the orders in delivery are polled in case their status events were lost.
+var DeliveryReconcileInterval = time.Hour * 6
 
 func GetEnv(key string, fallback *string) *string {
 	if value, ok := os.LookupEnv(key); ok {
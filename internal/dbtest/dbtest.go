@@ -0,0 +1,46 @@
+// Package dbtest connects tests to the postgres database from DATABASE_URL.
+package dbtest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Connect returns a pool whose search path is a fresh empty schema, dropped when the test ends, so tests of
+// several packages can share one database. The test is skipped when DATABASE_URL is not set.
+func Connect(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	connStr := os.Getenv("DATABASE_URL")
+	if connStr == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	admin, err := pgxpool.New(ctx, connStr)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when connecting to the database", err)
+	}
+	t.Cleanup(admin.Close)
+	if _, err = admin.Exec(ctx, "CREATE SCHEMA "+schema+";"); err != nil {
+		t.Fatalf("an error '%s' was not expected when creating the test schema", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(ctx, "DROP SCHEMA "+schema+" CASCADE;")
+	})
+	config, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when parsing DATABASE_URL", err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+	db, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when connecting to the database", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
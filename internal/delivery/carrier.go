@@ -0,0 +1,101 @@
+package delivery
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+// Delivery methods the customer chooses from at checkout.
+const (
+	MethodDoor        = "DOOR"
+	MethodPickupPoint = "PVZ"
+	MethodPostamat    = "POSTAMAT"
+)
+
+// States of a shipment registered with the carrier.
+const (
+	ShipmentPending  = "PENDING"
+	ShipmentAccepted = "ACCEPTED"
+	ShipmentRejected = "REJECTED"
+)
+
+// Print forms of the registered shipments.
+const (
+	// FormWaybill is the waybill handed over to the courier with the parcels
+	FormWaybill = "WAYBILL"
+	// FormBarcode is the barcode label stuck on every parcel
+	FormBarcode = "BARCODE"
+)
+
+// Carrier is the delivery service the photobooks are shipped with.
+type Carrier interface {
+	// Quote returns the price and the transit time of the shipment.
+	Quote(ctx context.Context, shipment Shipment) (Quote, error)
+	// CreateShipment registers the shipment and returns its id at the carrier.
+	// The carrier may validate it later, see Track.
+	CreateShipment(ctx context.Context, shipment Shipment) (string, error)
+	// Track returns the state of the shipment registered under shipmentID and its delivery statuses.
+	Track(ctx context.Context, shipmentID string) (Tracking, error)
+	// Cancel withdraws the shipment registered under shipmentID.
+	Cancel(ctx context.Context, shipmentID string) error
+	// PrintForm returns the PDF print form of the shipments registered under shipmentIDs, one after another.
+	PrintForm(ctx context.Context, form string, shipmentIDs []string) ([]byte, error)
+	// DeliveryPoints lists the pickup points and postamats the shipments can be sent to.
+	DeliveryPoints(ctx context.Context) ([]models.DeliveryPoint, error)
+	// Subscribe registers url to receive the delivery statuses of the shipments as they change.
+	Subscribe(ctx context.Context, url string) error
+	// Webhooks lists the urls registered to receive the delivery statuses.
+	Webhooks(ctx context.Context) ([]string, error)
+}
+
+// Shipment is what is sent, where from and to whom.
+type Shipment struct {
+	Number        string
+	Method        string
+	From          models.Location
+	To            models.Location
+	DeliveryPoint string
+	Recipient     models.Contacts
+	Parcels       []Parcel
+}
+
+// Parcel is one box of the shipment, weight in grams and sizes in centimetres.
+type Parcel struct {
+	Weight int
+	Length int
+	Width  int
+	Height int
+	Items  []ParcelItem
+}
+
+// ParcelItem is a photobook in the parcel.
+type ParcelItem struct {
+	Name    string
+	WareKey string
+	Weight  int
+}
+
+// Quote is the price of the shipment and the days it takes the carrier to deliver it.
+type Quote struct {
+	Amount    money.Money
+	PeriodMin int64
+	PeriodMax int64
+}
+
+// Tracking is the state of a registered shipment.
+type Tracking struct {
+	State string
+	// Error is why the carrier rejected the shipment
+	Error          string
+	TrackingNumber string
+	// Statuses are the delivery statuses, the latest first
+	Statuses []models.DeliveryStatusEvent
+}
+
+// BookShipment returns the shipment of the photobooks packed by PackBooks.
+func BookShipment(method string, from models.Location, to models.Location, deliveryPoint string, books []models.ShippedBook, packageBox bool) Shipment {
+
+	return Shipment{Method: method, From: from, To: to, DeliveryPoint: deliveryPoint, Parcels: PackBooks(books, packageBox)}
+}
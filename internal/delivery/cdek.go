@@ -0,0 +1,600 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// DefaultCDEKTariffs are the CDEK tariffs of the delivery methods: door to door, and door to a pickup point or a postamat.
+var DefaultCDEKTariffs = map[string]int{MethodDoor: 139, MethodPickupPoint: 138, MethodPostamat: 138}
+
+// printPollInterval is how often PrintForm asks CDEK whether the print form is ready.
+var printPollInterval = time.Second
+
+var errUnknownMethod = errors.New("unknown delivery method")
+var errPrintNotReady = errors.New("print form not ready")
+
+type FullPackage struct {
+	Number int     `json:"number" validate:"required"`
+	Weight float64 `json:"weight" validate:"required"`
+	Length float64 `json:"length" validate:"required"`
+	Width  float64 `json:"width" validate:"required"`
+	Height float64 `json:"height" validate:"required"`
+	Cost   float64 `json:"cost" validate:"required"`
+	Amount float64 `json:"amount" validate:"required"`
+	Items  []Item  `json:"items" validate:"required"`
+}
+
+type Item struct {
+	Name    string                `json:"name" validate:"required"`
+	WareKey string                `json:"ware_key" validate:"required"`
+	Payment DeliveryRecipientCost `json:"payment" validate:"required"`
+	Cost    float64               `json:"cost" validate:"required"`
+	Weight  int                   `json:"weight" validate:"required"`
+	Amount  int                   `json:"amount" validate:"required"`
+}
+
+type DeliveryRecipientCost struct {
+	Value int `json:"value" validate:"required"`
+}
+
+type DeliveryRecipient struct {
+	Name   string  `json:"name" validate:"required"`
+	Email  string  `json:"email" validate:"required"`
+	Phones []Phone `json:"phones" validate:"required"`
+}
+
+type Phone struct {
+	Number string `json:"number" validate:"required"`
+}
+
+type ResponseAuthorization struct {
+	AccessToken string `json:"access_token" validate:"required"`
+	TokenType   string `json:"token_type" validate:"required"`
+	ExpiresIn   uint   `json:"expires_in" validate:"required"`
+	Scope       string `json:"scope" validate:"required"`
+	JTI         string `json:"jti" validate:"required"`
+}
+
+type RequestDelivery struct {
+	Number                string                `json:"number,omitempty"`
+	TariffCode            int64                 `json:"tariff_code" validate:"required"`
+	DeliveryRecipientCost DeliveryRecipientCost `json:"delivery_recipient_cost" validate:"required"`
+	Recipient             DeliveryRecipient     `json:"recipient" validate:"required"`
+	FromLocation          models.Location       `json:"from_location" validate:"required"`
+	ToLocation            *models.Location      `json:"to_location,omitempty"`
+	DeliveryPoint         string                `json:"delivery_point,omitempty"`
+	Packages              []FullPackage         `json:"packages" validate:"required"`
+}
+
+type ResponseDelivery struct {
+	Entity   Entity            `json:"entity" validate:"required"`
+	Requests []DeliveryRequest `json:"requests" validate:"required"`
+}
+
+type Entity struct {
+	UUID string `json:"uuid" validate:"required"`
+}
+
+type DeliveryRequest struct {
+	RequestUUID string          `json:"request_uuid" validate:"required"`
+	Type        string          `json:"type" validate:"required"`
+	State       string          `json:"state" validate:"required"`
+	DateTime    string          `json:"date_time" validate:"required"`
+	Errors      []DeliveryError `json:"errors" validate:"required"`
+	Warnings    []DeliveryError `json:"warnings" validate:"required"`
+}
+
+type DeliveryError struct {
+	Code    string `json:"code" validate:"required"`
+	Message string `json:"message" validate:"required"`
+}
+
+type DeliveryStatus struct {
+	Code     string `json:"code" validate:"required"`
+	Name     string `json:"name" validate:"required"`
+	City     string `json:"city" validate:"required"`
+	DateTime string `json:"date_time" validate:"required"`
+}
+
+// cdekTimeLayout is the format of the date_time of the CDEK statuses, e.g. 2020-08-10T21:32:12+0700.
+const cdekTimeLayout = "2006-01-02T15:04:05-0700"
+
+type DeliveryStatusCheck struct {
+	Entity   DeliveryEntity    `json:"entity" validate:"required"`
+	Requests []DeliveryRequest `json:"requests" validate:"required"`
+}
+
+type DeliveryEntity struct {
+	UUID                     string           `json:"uuid" validate:"required"`
+	Type                     int              `json:"type" validate:"required"`
+	IsReturn                 bool             `json:"is_return" validate:"required"`
+	IsReverse                bool             `json:"is_reverse" validate:"required"`
+	CDEKNumber               string           `json:"cdek_number" validate:"required"`
+	Number                   string           `json:"number" validate:"required"`
+	DeliveryMode             string           `json:"delivery_mode" validate:"required"`
+	TariffCode               int              `json:"tariff_code" validate:"required"`
+	Comment                  string           `json:"comment" validate:"required"`
+	DeliveryRecipientCost    interface{}      `json:"delivery_recipient_cost" validate:"required"`
+	DeliveryRecipientCostAdv interface{}      `json:"delivery_recipient_cost_adv" validate:"required"`
+	Sender                   interface{}      `json:"sender" validate:"required"`
+	Seller                   interface{}      `json:"seller" validate:"required"`
+	Recipient                interface{}      `json:"recipient" validate:"required"`
+	FromLocation             interface{}      `json:"from_location" validate:"required"`
+	ToLocation               interface{}      `json:"to_location" validate:"required"`
+	Services                 interface{}      `json:"services" validate:"required"`
+	Packages                 interface{}      `json:"packages" validate:"required"`
+	DeliveryProblem          []string         `json:"delivery_problem" validate:"required"`
+	Statuses                 []DeliveryStatus `json:"statuses" validate:"required"`
+	DeliveryDetail           interface{}      `json:"delivery_detail" validate:"required"`
+}
+
+type RequestPrint struct {
+	Orders    []PrintOrder `json:"orders" validate:"required"`
+	CopyCount int          `json:"copy_count,omitempty"`
+	Format    string       `json:"format,omitempty"`
+}
+
+type PrintOrder struct {
+	OrderUUID string `json:"order_uuid" validate:"required"`
+}
+
+type ResponsePrint struct {
+	Entity   PrintEntity       `json:"entity" validate:"required"`
+	Requests []DeliveryRequest `json:"requests" validate:"required"`
+}
+
+type PrintEntity struct {
+	UUID     string           `json:"uuid" validate:"required"`
+	URL      string           `json:"url"`
+	Statuses []DeliveryStatus `json:"statuses"`
+}
+
+type ResponseDeliveryPoint struct {
+	Code     string                `json:"code"`
+	Name     string                `json:"name"`
+	Type     string                `json:"type"`
+	WorkTime string                `json:"work_time"`
+	Location DeliveryPointLocation `json:"location"`
+}
+
+type DeliveryPointLocation struct {
+	City       string  `json:"city"`
+	PostalCode string  `json:"postal_code"`
+	Address    string  `json:"address"`
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+}
+
+// CDEK implements Carrier on top of the CDEK api v2. The access token is kept until shortly before it expires.
+type CDEK struct {
+	BaseURL  string
+	ClientID string
+	Secret   string
+	// Tariffs are the tariff codes of the delivery methods
+	Tariffs map[string]int
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewCDEK returns a Carrier talking to the CDEK api at baseURL, e.g. https://api.cdek.ru, with the DefaultCDEKTariffs.
+func NewCDEK(baseURL string, clientID string, secret string) *CDEK {
+	return &CDEK{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		ClientID: clientID,
+		Secret:   secret,
+		Tariffs:  DefaultCDEKTariffs,
+	}
+}
+
+// ParseTariffs reads tariff codes of the delivery methods written as DOOR:139,PVZ:138,POSTAMAT:368.
+func ParseTariffs(s string) (map[string]int, error) {
+
+	tariffs := make(map[string]int)
+	for k, v := range DefaultCDEKTariffs {
+		tariffs[k] = v
+	}
+	for _, pair := range strings.Split(s, ",") {
+		method, code, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid tariff %q", pair)
+		}
+		tariff, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tariff %q", pair)
+		}
+		tariffs[method] = tariff
+	}
+	return tariffs, nil
+}
+
+func (c *CDEK) tariff(method string) (int, error) {
+	tariff, ok := c.Tariffs[method]
+	if !ok {
+		return 0, errUnknownMethod
+	}
+	return tariff, nil
+}
+
+// accessToken returns the cached access token, asking CDEK for a new one when it is about to expire.
+func (c *CDEK) accessToken(ctx context.Context) (string, error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token != "" && time.Now().Before(c.expiresAt) {
+		return c.token, nil
+	}
+
+	queryValues := url.Values{}
+	queryValues.Add("grant_type", "client_credentials")
+	queryValues.Add("client_id", c.ClientID)
+	queryValues.Add("client_secret", c.Secret)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/v2/oauth/token?"+queryValues.Encode(), nil)
+	if err != nil {
+		return "", errors.New("failed request to authorize")
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return "", errors.New("failed request to authorize")
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed request to authorize, status %d", response.StatusCode)
+	}
+	var authResponse ResponseAuthorization
+	if err = json.NewDecoder(response.Body).Decode(&authResponse); err != nil || authResponse.AccessToken == "" {
+		return "", errors.New("failed decoding response to authorize")
+	}
+
+	c.token = authResponse.AccessToken
+	// renew a minute early so that a token does not expire on its way to CDEK
+	c.expiresAt = time.Now().Add(time.Duration(authResponse.ExpiresIn)*time.Second - time.Minute)
+	return c.token, nil
+}
+
+// forgetToken drops the cached token once CDEK no longer accepts it.
+func (c *CDEK) forgetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+	}
+}
+
+// do sends body as json to the api path and decodes the answer into target, returning the response status.
+// A request refused for the token is sent once more with a new one.
+func (c *CDEK) do(ctx context.Context, method string, path string, body interface{}, target interface{}) (int, error) {
+
+	var bodyBytes []byte
+	if body != nil {
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return 0, errors.New("failed encoding request to delivery")
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := c.accessToken(ctx)
+		if err != nil {
+			return 0, err
+		}
+		request, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return 0, errors.New("failed request to delivery")
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", "Bearer "+token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return 0, errors.New("failed request to delivery")
+		}
+		if response.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			response.Body.Close()
+			c.forgetToken(token)
+			continue
+		}
+		defer response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			return response.StatusCode, fmt.Errorf("failed response from delivery, status %d", response.StatusCode)
+		}
+		if target == nil {
+			return response.StatusCode, nil
+		}
+		if bytesTarget, ok := target.(*[]byte); ok {
+			*bytesTarget, err = io.ReadAll(response.Body)
+		} else {
+			err = json.NewDecoder(response.Body).Decode(target)
+		}
+		if err != nil && err != io.EOF {
+			return response.StatusCode, errors.New("failed reading response from delivery")
+		}
+		return response.StatusCode, nil
+	}
+}
+
+func (c *CDEK) Quote(ctx context.Context, shipment Shipment) (Quote, error) {
+
+	var quote Quote
+	tariff, err := c.tariff(shipment.Method)
+	if err != nil {
+		return quote, err
+	}
+	// the parcels are packed into our own cartons, see PackBooks, no packaging service is ordered
+	rApiCost := models.RequestDeliveryCost{TariffCode: tariff, FromLocation: shipment.From, ToLocation: shipment.To, Services: []models.Service{}}
+	for _, parcel := range shipment.Parcels {
+		rApiCost.Packages = append(rApiCost.Packages, models.Package{Weight: parcel.Weight, Length: parcel.Length, Width: parcel.Width, Height: parcel.Height})
+	}
+
+	var ApiPaymentObj models.ApiResponseDeliveryCost
+	status, err := c.do(ctx, http.MethodPost, "/v2/calculator/tariff", rApiCost, &ApiPaymentObj)
+	if err != nil {
+		return quote, err
+	}
+	if status != http.StatusOK {
+		return quote, fmt.Errorf("failed response from delivery, status %d", status)
+	}
+	quote.Amount = ApiPaymentObj.TotalSum
+	quote.PeriodMin = ApiPaymentObj.PeriodMin
+	quote.PeriodMax = ApiPaymentObj.PeriodMax
+	return quote, nil
+}
+
+func (c *CDEK) CreateShipment(ctx context.Context, shipment Shipment) (string, error) {
+
+	tariff, err := c.tariff(shipment.Method)
+	if err != nil {
+		return "", err
+	}
+	delivery := RequestDelivery{Number: shipment.Number, TariffCode: int64(tariff), FromLocation: shipment.From}
+	if shipment.Method == MethodDoor {
+		to := shipment.To
+		delivery.ToLocation = &to
+	} else {
+		delivery.DeliveryPoint = shipment.DeliveryPoint
+	}
+	// the delivery is prepaid with the order, nothing is collected from the recipient
+	delivery.DeliveryRecipientCost = DeliveryRecipientCost{Value: 0}
+
+	contacts := shipment.Recipient
+	delivery.Recipient = DeliveryRecipient{
+		Name:   strings.TrimSpace(contacts.FirstName + " " + contacts.LastName),
+		Email:  contacts.Email,
+		Phones: []Phone{{Number: contacts.Phone}},
+	}
+	for num, parcel := range shipment.Parcels {
+		p := FullPackage{Number: num + 1, Weight: float64(parcel.Weight), Length: float64(parcel.Length), Width: float64(parcel.Width), Height: float64(parcel.Height)}
+		for _, item := range parcel.Items {
+			p.Items = append(p.Items, Item{Name: item.Name, WareKey: item.WareKey, Weight: item.Weight, Amount: 1})
+		}
+		delivery.Packages = append(delivery.Packages, p)
+	}
+
+	var respDelivery ResponseDelivery
+	status, err := c.do(ctx, http.MethodPost, "/v2/orders", delivery, &respDelivery)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK && status != http.StatusAccepted || respDelivery.Entity.UUID == "" {
+		return "", requestError(respDelivery.Requests, "error placing delivery")
+	}
+	return respDelivery.Entity.UUID, nil
+}
+
+func (c *CDEK) Track(ctx context.Context, shipmentID string) (Tracking, error) {
+
+	tracking := Tracking{State: ShipmentPending}
+	var dStatusObj DeliveryStatusCheck
+	status, err := c.do(ctx, http.MethodGet, "/v2/orders/"+url.PathEscape(shipmentID), nil, &dStatusObj)
+	if err != nil {
+		return tracking, err
+	}
+	if status != http.StatusOK {
+		return tracking, fmt.Errorf("failed request to get delivery data, status %d", status)
+	}
+
+	dEntity := dStatusObj.Entity
+	tracking.TrackingNumber = dEntity.CDEKNumber
+	for _, r := range dStatusObj.Requests {
+		if r.Type != "CREATE" {
+			continue
+		}
+		switch r.State {
+		case "INVALID":
+			tracking.State = ShipmentRejected
+			tracking.Error = requestError([]DeliveryRequest{r}, "shipment rejected by the delivery service").Error()
+		case "SUCCESSFUL":
+			// the tracking number is assigned shortly after the shipment is accepted
+			if tracking.TrackingNumber != "" {
+				tracking.State = ShipmentAccepted
+			}
+		}
+	}
+	// CDEK forgets the requests after a while, the tracking number is enough then
+	if tracking.State == ShipmentPending && tracking.TrackingNumber != "" && len(dStatusObj.Requests) == 0 {
+		tracking.State = ShipmentAccepted
+	}
+
+	for _, s := range dEntity.Statuses {
+		happenedAt, err := time.Parse(cdekTimeLayout, s.DateTime)
+		if err != nil {
+			continue
+		}
+		tracking.Statuses = append(tracking.Statuses, models.DeliveryStatusEvent{Code: s.Code, Name: s.Name, City: s.City, HappenedAt: happenedAt.Unix()})
+	}
+	return tracking, nil
+}
+
+func (c *CDEK) Cancel(ctx context.Context, shipmentID string) error {
+
+	var respDelivery ResponseDelivery
+	status, err := c.do(ctx, http.MethodDelete, "/v2/orders/"+url.PathEscape(shipmentID), nil, &respDelivery)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusAccepted {
+		return requestError(respDelivery.Requests, "error cancelling delivery")
+	}
+	return nil
+}
+
+// Subscribe registers webhookURL for the ORDER_STATUS events, CDEK replaces an earlier subscription of the account.
+func (c *CDEK) Subscribe(ctx context.Context, webhookURL string) error {
+
+	var respDelivery ResponseDelivery
+	status, err := c.do(ctx, http.MethodPost, "/v2/webhooks", RequestWebhook{URL: webhookURL, Type: WebhookOrderStatus}, &respDelivery)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusAccepted {
+		return requestError(respDelivery.Requests, "error subscribing to delivery statuses")
+	}
+	return nil
+}
+
+// Webhooks lists the urls subscribed to the ORDER_STATUS events of the account.
+func (c *CDEK) Webhooks(ctx context.Context) ([]string, error) {
+
+	var cdekWebhooks []ResponseWebhook
+	status, err := c.do(ctx, http.MethodGet, "/v2/webhooks", nil, &cdekWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed request to get webhooks, status %d", status)
+	}
+	var urls []string
+	for _, webhook := range cdekWebhooks {
+		if webhook.Type == WebhookOrderStatus {
+			urls = append(urls, webhook.URL)
+		}
+	}
+	return urls, nil
+}
+
+// printForms are the CDEK print endpoints of the forms and their requests, the waybill goes in two copies,
+// one for the courier and one for the warehouse.
+var printForms = map[string]struct {
+	Path    string
+	Request RequestPrint
+}{
+	FormWaybill: {Path: "/v2/print/orders", Request: RequestPrint{CopyCount: 2}},
+	FormBarcode: {Path: "/v2/print/barcodes", Request: RequestPrint{CopyCount: 1, Format: "A6"}},
+}
+
+// PrintForm asks CDEK for the print form of the shipments and waits for the PDF to be made.
+// CDEK prints up to 100 shipments at once.
+func (c *CDEK) PrintForm(ctx context.Context, form string, shipmentIDs []string) ([]byte, error) {
+
+	printForm, ok := printForms[form]
+	if !ok {
+		return nil, fmt.Errorf("unknown print form %s", form)
+	}
+	request := printForm.Request
+	for _, shipmentID := range shipmentIDs {
+		request.Orders = append(request.Orders, PrintOrder{OrderUUID: shipmentID})
+	}
+	var respPrint ResponsePrint
+	status, err := c.do(ctx, http.MethodPost, printForm.Path, request, &respPrint)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK && status != http.StatusAccepted || respPrint.Entity.UUID == "" {
+		return nil, requestError(respPrint.Requests, "error printing form")
+	}
+	printPath := printForm.Path + "/" + url.PathEscape(respPrint.Entity.UUID)
+
+	ticker := time.NewTicker(printPollInterval)
+	defer ticker.Stop()
+	for {
+		var printObj ResponsePrint
+		status, err = c.do(ctx, http.MethodGet, printPath, nil, &printObj)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("failed request to get print form, status %d", status)
+		}
+		state := ""
+		if len(printObj.Entity.Statuses) > 0 {
+			state = printObj.Entity.Statuses[len(printObj.Entity.Statuses)-1].Code
+		}
+		switch state {
+		case "READY":
+			var pdf []byte
+			status, err = c.do(ctx, http.MethodGet, printPath+".pdf", nil, &pdf)
+			if err != nil {
+				return nil, err
+			}
+			if status != http.StatusOK {
+				return nil, fmt.Errorf("failed request to download print form, status %d", status)
+			}
+			return pdf, nil
+		case "INVALID", "REMOVED":
+			return nil, requestError(printObj.Requests, "error printing form")
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errPrintNotReady
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliveryPoints lists the CDEK pickup points and postamats in Russia.
+func (c *CDEK) DeliveryPoints(ctx context.Context) ([]models.DeliveryPoint, error) {
+
+	var cdekPoints []ResponseDeliveryPoint
+	status, err := c.do(ctx, http.MethodGet, "/v2/deliverypoints?country_code=RU&type=ALL", nil, &cdekPoints)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed request to get delivery points, status %d", status)
+	}
+	points := make([]models.DeliveryPoint, 0, len(cdekPoints))
+	for _, p := range cdekPoints {
+		points = append(points, models.DeliveryPoint{
+			Code:       p.Code,
+			Name:       p.Name,
+			Type:       p.Type,
+			City:       p.Location.City,
+			PostalCode: p.Location.PostalCode,
+			Address:    p.Location.Address,
+			Latitude:   p.Location.Latitude,
+			Longitude:  p.Location.Longitude,
+			WorkTime:   p.WorkTime,
+		})
+	}
+	return points, nil
+}
+
+// requestError joins the messages CDEK gave for rejecting the requests, falling back to message.
+func requestError(requests []DeliveryRequest, message string) error {
+
+	var messages []string
+	for _, r := range requests {
+		for _, e := range r.Errors {
+			messages = append(messages, e.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return errors.New(message)
+	}
+	return errors.New(strings.Join(messages, "; "))
+}
@@ -0,0 +1,113 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+func TestCDEK(t *testing.T) {
+
+	fake := NewFakeCDEK("client", "secret")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	carrier := NewCDEK(server.URL, "client", "secret")
+	ctx := context.Background()
+
+	books := []models.ShippedBook{{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", CountPages: 20}, {Size: "VERTICAL", Variant: "PREMIUM", Cover: "LEATHERETTE", CountPages: 30}}
+	shipment := BookShipment(MethodPickupPoint, models.Location{PostalCode: "129323", City: "Москва", Address: "проезд Серебрякова, 7", Code: 44}, models.Location{PostalCode: "630099", Address: "Новосибирск"}, "NSK27", books, false)
+	shipment.Recipient = models.Contacts{FirstName: "Name", LastName: "Surname", Phone: "+79990000000"}
+	quote, err := carrier.Quote(ctx, shipment)
+	if err != nil || quote.Amount != fake.Price || quote.PeriodMax < quote.PeriodMin {
+		t.Fatalf("expected the quote of the fake api, got %v, %v", quote, err)
+	}
+
+	rejected, err := carrier.CreateShipment(ctx, shipment)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a shipment", err)
+	}
+	fake.Reject(rejected, "delivery point NSK27 is closed")
+	tracking, err := carrier.Track(ctx, rejected)
+	if err != nil || tracking.State != ShipmentRejected || tracking.Error != "delivery point NSK27 is closed" {
+		t.Fatalf("expected the rejection message, got %v, %v", tracking, err)
+	}
+	if fake.TokensIssued() != 1 {
+		t.Errorf("expected the access token to be reused, %d were issued", fake.TokensIssued())
+	}
+
+	// a revoked token is renewed without failing the request
+	fake.ExpireTokens()
+	uuid, err := carrier.CreateShipment(ctx, shipment)
+	if err != nil || fake.TokensIssued() != 2 {
+		t.Fatalf("expected the shipment to be created with a new token, got %v, %d tokens", err, fake.TokensIssued())
+	}
+	if request, _, _ := fake.Shipment(uuid); request.DeliveryPoint != "NSK27" || request.ToLocation != nil || len(request.Packages[0].Items) != 2 {
+		t.Errorf("expected both photobooks sent to the pickup point, got %v", request)
+	}
+	if tracking, _ = carrier.Track(ctx, uuid); tracking.State != ShipmentPending {
+		t.Errorf("expected the shipment to wait for validation, got %s", tracking.State)
+	}
+	fake.Accept(uuid)
+	fake.AddStatus(uuid, "DELIVERED", "Вручен", "Новосибирск")
+	tracking, _ = carrier.Track(ctx, uuid)
+	if tracking.State != ShipmentAccepted || tracking.TrackingNumber == "" || len(tracking.Statuses) != 2 || tracking.Statuses[0].Code != "DELIVERED" {
+		t.Errorf("expected the accepted shipment with its statuses, latest first, got %v", tracking)
+	}
+
+	label, err := carrier.PrintForm(ctx, FormBarcode, []string{uuid})
+	if err != nil || !bytes.HasPrefix(label, []byte("%PDF")) {
+		t.Errorf("expected a PDF label, got %q, %v", label, err)
+	}
+	if err = carrier.Cancel(ctx, uuid); err == nil {
+		t.Errorf("expected a delivered shipment not to be cancelled")
+	}
+	if _, err = carrier.Quote(ctx, Shipment{Method: "PIGEON"}); err == nil {
+		t.Errorf("expected a delivery method without a tariff to be refused")
+	}
+}
+
+func TestSubscribeWebhook(t *testing.T) {
+
+	fake := NewFakeCDEK("client", "secret")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	carrier := NewCDEK(server.URL, "client", "secret")
+	ctx := context.Background()
+
+	tests := []struct {
+		name          string
+		url           string
+		subscriptions int
+	}{
+		{"new url", "https://memoryprint.ru/api/v1/delivery/webhook/hook", 1},
+		{"url subscribed already", "https://memoryprint.ru/api/v1/delivery/webhook/hook", 1},
+		{"url changed", "https://memoryprint.ru/api/v1/delivery/webhook/other", 2},
+	}
+	for _, tt := range tests {
+		if err := SubscribeWebhook(ctx, carrier, tt.url); err != nil {
+			t.Fatalf("%s: an error '%s' was not expected when subscribing", tt.name, err)
+		}
+		if fake.Subscriptions() != tt.subscriptions || len(fake.Webhooks()) != 1 || fake.Webhooks()[0] != tt.url {
+			t.Errorf("%s: expected %d subscriptions of %s, got %d of %v", tt.name, tt.subscriptions, tt.url, fake.Subscriptions(), fake.Webhooks())
+		}
+	}
+
+	// the routine gives up retrying once the application stops
+	server.Close()
+	stopped, stop := context.WithCancel(ctx)
+	stop()
+	done := make(chan struct{})
+	go func() {
+		RoutineSubscribeWebhook(stopped, carrier, tests[0].url)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("expected the routine to return once its context is done")
+	}
+}
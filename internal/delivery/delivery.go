@@ -2,18 +2,14 @@ package delivery
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"github.com/SiberianMonster/memoryprint/internal/models"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"log"
-	"net/http"
-	"net/url"
 	"time"
 	"strconv"
 	"errors"
-	"bytes"
 )
 
 // LoadActiveDeliveries function performs the operation of retrieving orders in IN_DELIVERY status from pgx database with a query.
@@ -41,477 +37,213 @@ func LoadActiveDeliveries(ctx context.Context, storeDB *pgxpool.Pool) ([]uint, e
 
 }
 
-type FullPackage struct {
-	
-	Number int `json:"number" validate:"required"`
-	Weight float64 `json:"weight" validate:"required"`
-	Length float64 `json:"length" validate:"required"`
-	Width float64 `json:"width" validate:"required"`
-	Height float64 `json:"height" validate:"required"`
-	Cost float64 `json:"cost" validate:"required"`
-	Amount float64 `json:"amount" validate:"required"`
-	Items []Item `json:"items" validate:"required"`
-}
-
-type Item struct {
-	
-	Name string `json:"name" validate:"required"`
-	WareKey string `json:"ware_key" validate:"required"`
-	Payment uint `json:"payment" validate:"required"`
-
-}
-
-type DeliveryRecipientCost struct {
-	
-	Value int `json:"value" validate:"required"`
-
-}
-
-type DeliveryRecipient struct {
-	
-	Name string `json:"name" validate:"required"`
-	Email string `json:"email" validate:"required"`
-	Phones []Phone `json:"phones" validate:"required"`
-
-}
-
-type Phone struct {
-	
-	Number string `json:"number" validate:"required"`
-
-}
-
-
-
-type ResponseAuthorization struct {
-
-	AccessToken string `json:"access_token" validate:"required"`
-	TokenType string `json:"token_type" validate:"required"`
-	ExpiresIn uint `json:"expires_in" validate:"required"`
-	Scope string `json:"scope" validate:"required"`
-	JTI string `json:"jti" validate:"required"`
-}
-
-type RequestAuthorization struct {
-
-	GrantType string `json:"grant_type" validate:"required"`
-	ClientID string `json:"client_id" validate:"required"`
-	ClientSecret string `json:"client_secret" validate:"required"`
-
-}
-
-type RequestDelivery struct {
-
-	TariffCode int64 `json:"tariff_code" validate:"required"`
-	DeliveryRecipientCost DeliveryRecipientCost `json:"delivery_recipient_cost" validate:"required"`
-	Recipient DeliveryRecipient `json:"recipient" validate:"required"`
-	FromLocation models.Location `json:"from_location" validate:"required"`
-	ToLocation models.Location `json:"to_location",omitempty`
-	DeliveryPoint string `json:"delivery_point",omitempty`
-	Packages []FullPackage `json:"packages" validate:"required"`
+// shipmentOf returns the shipment of the order as it was quoted at checkout.
+func shipmentOf(orderID uint, deliveryObj models.ResponseApiDeliveryInfo) Shipment {
 
+	to := models.Location{PostalCode: deliveryObj.PostalCode, Address: deliveryObj.Address}
+	shipment := BookShipment(deliveryObj.Method, WarehouseLocation(deliveryObj.Origin), to, deliveryObj.Code, deliveryObj.Books, deliveryObj.PackageBox)
+	shipment.Number = strconv.Itoa(int(orderID))
+	shipment.Recipient = deliveryObj.ContactData
+	return shipment
 }
 
-type ResponseDelivery struct {
+// ErrShipmentRegistered is returned when the shipment of the order is already registered with the carrier and has not failed.
+var ErrShipmentRegistered = errors.New("shipment is already registered with the carrier")
 
-	Entity Entity `json:"entity" validate:"required"`
-	Requests []DeliveryRequest `json:"requests" validate:"required"`
+// OrderDelivery registers the shipment of the order with the carrier and stores its id at the carrier.
+// The carrier validates the shipment asynchronously, see ConfirmDelivery. A failure is kept on the delivery for the admins.
+// A shipment is only registered again when the carrier has not got it or has refused it.
+func OrderDelivery(carrier Carrier, store DeliveryStore, orderID uint) (error) {
 
-}
-
-type Entity struct {
-
-	UUID string `json:"uuid" validate:"required"`
-
-}
-
-type DeliveryRequest struct {
-
-	RequestUUID string `json:"request_uuid" validate:"required"`
-	Type string `json:"type" validate:"required"`
-	State string `json:"state" validate:"required"`
-	DateTime string `json:"date_time" validate:"required"`
-	Errors []string `json:"errors" validate:"required"`
-	Warnings []string `json:"warnings" validate:"required"`
-
-}
-
-type DeliveryStatus struct {
-
-	Code string `json:"code" validate:"required"`
-	Name string `json:"name" validate:"required"`
-	City string `json:"city" validate:"required"`
-	DateTime string `json:"date_time" validate:"required"`
-
-} 
-
-type DeliveryStatusCheck struct {
-
-	Entity DeliveryEntity `json:"entity" validate:"required"`
-	Requests interface{} `json:"requests" validate:"required"`
-
-}
-
-type DeliveryEntity struct {
-
-	UUID string `json:"uuid" validate:"required"`
-	Type int `json:"type" validate:"required"`
-	IsReturn bool `json:"is_return" validate:"required"`
-	IsReverse bool `json:"is_reverse" validate:"required"`
-	CDEKNumber string `json:"cdek_number" validate:"required"`
-	Number string `json:"number" validate:"required"`
-	DeliveryMode string `json:"delivery_mode" validate:"required"`
-	TariffCode int `json:"tariff_code" validate:"required"`
-	Comment string `json:"comment" validate:"required"`
-	DeliveryRecipientCost interface{} `json:"delivery_recipient_cost" validate:"required"`
-	DeliveryRecipientCostAdv interface{} `json:"delivery_recipient_cost_adv" validate:"required"`
-	Sender interface{} `json:"sender" validate:"required"`
-	Seller interface{} `json:"seller" validate:"required"`
-	Recipient interface{} `json:"recipient" validate:"required"`
-	FromLocation interface{} `json:"from_location" validate:"required"`
-	ToLocation interface{} `json:"to_location" validate:"required"`
-	Services interface{} `json:"services" validate:"required"`
-	Packages interface{} `json:"packages" validate:"required"`
-	DeliveryProblem []string `json:"delivery_problem" validate:"required"`
-	Statuses []DeliveryStatus `json:"statuses" validate:"required"`
-	DeliveryDetail interface{} `json:"delivery_detail" validate:"required"`
-
-}
-
-func AuthorizeDelivery() (string, error) {
-	var authResponse ResponseAuthorization
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
-	
-	authorizationURL := &url.URL{
-        Scheme: "https",
-        Host:   config.DeliveryDomain,
-        Path:   "/v2/oauth/token",
-    }
-	queryValues := url.Values{}
-    queryValues.Add("grant_type", "client_credentials")
-    queryValues.Add("client_id", config.DeliveryClientID)
-	queryValues.Add("client_secret", config.DeliverySecret)
-    authorizationURL.RawQuery = queryValues.Encode()
-
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, authorizationURL.String(), nil)
+
+	_, deliveryUUID, _, _, err := store.FindDeliveryUUID(ctx, orderID)
 	if err != nil {
-		log.Printf("Error in authorization")
-		return "", errors.New("failed request to authorize")
+		log.Printf("Failed to obtain delivery uuid for the order %s", strconv.Itoa(int(orderID)) )
+		return err
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	client := http.DefaultClient
-	response, err := client.Do(request)
-
+	if deliveryUUID != "" {
+		failed, err := store.DeliveryFailed(ctx, orderID)
+		if err != nil {
+			log.Printf("Failed to obtain delivery registration error for the order %s", strconv.Itoa(int(orderID)) )
+			return err
+		}
+		if !failed {
+			return ErrShipmentRegistered
+		}
+	}
+	deliveryObj, err := store.LoadApiDelivery(ctx, orderID)
 	if err != nil {
-		log.Printf("Error in authorization")
-		return "", errors.New("failed request to authorize")
+		log.Printf("Failed to obtain delivery data for the order %s", strconv.Itoa(int(orderID)) )
+		return errors.New("Failed to obtain delivery data for the order")
 	}
-
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Error in authorization 500")
-		return "", errors.New("failed request to authorize")
+	if deliveryObj.Origin.WarehouseID == 0 {
+		// orders placed before their origin was recorded are shipped from the warehouse chosen now
+		to := models.Location{PostalCode: deliveryObj.PostalCode, Address: deliveryObj.Address}
+		deliveryObj.Origin, err = ChooseOrigin(ctx, store, deliveryObj.Method, to, deliveryObj.Code)
+		if err != nil {
+			log.Printf("Failed to choose the warehouse for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+			return err
+		}
+		err = store.AssignWarehouse(ctx, orderID, deliveryObj.Origin.WarehouseID)
+		if err != nil {
+			log.Printf("Failed to assign the warehouse for the order %s", strconv.Itoa(int(orderID)))
+			return err
+		}
 	}
-
-	if response.StatusCode == http.StatusOK {
-		err := json.NewDecoder(response.Body).Decode(&authResponse)
-		defer response.Body.Close()
-		if err != nil  {
-			log.Printf("Unable to decode dauthorization")
-			return "", errors.New("failed decoding response to authorize")
+	uuid, err := carrier.CreateShipment(ctx, shipmentOf(orderID, deliveryObj))
+	if err != nil {
+		log.Printf("Error in placing delivery for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		updateErr := store.UpdateDeliveryError(ctx, orderID, err.Error())
+		if updateErr != nil {
+			log.Printf("Failed to record delivery error for the order %s", strconv.Itoa(int(orderID)))
 		}
-		
-		return authResponse.AccessToken, nil
-
+		return err
+	}
+	err = store.AddDeliveryID(ctx, orderID, uuid)
+	if err != nil {
+		log.Printf("Failed to update delivery api id for the order %s", strconv.Itoa(int(orderID)) )
+		return errors.New("Failed to update delivery api id")
 	}
-	return "", errors.New("failed request to authorize")
+	return nil
 }
 
-func CalculateDelivery(OrderObj models.RequestDeliveryCost) (models.ApiResponseDeliveryCost, error) {
-	var delivery models.ApiResponseDeliveryCost
+// ConfirmDelivery checks whether the carrier has accepted the shipment registered by OrderDelivery and stores its tracking number.
+// It reports true once the shipment is accepted. A rejected shipment is kept on the delivery for the admins to fix and register again.
+func ConfirmDelivery(carrier Carrier, store DeliveryStore, orderID uint) (bool, error) {
+
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
 
-	accessToken, _ := AuthorizeDelivery()
-
-	
-	calculateURL := "https://api.edu.cdek.ru/v2/calculator/tariff"
-	bodyBytes, _ := json.Marshal(OrderObj)
-	body := bytes.NewBuffer(bodyBytes)
-	log.Println(body)
-
-    
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, calculateURL, body)
-	if err != nil {
-		log.Printf("Error in calculating delivery cost")
-		return delivery, errors.New("failed request to delivery")
+	deliveryID, deliveryUUID, _, trackingNumber, err := store.FindDeliveryUUID(ctx, orderID)
+	if err != nil || deliveryUUID == "" {
+		log.Printf("Failed to obtain delivery uuid for the order %s", strconv.Itoa(int(orderID)) )
+		return false, errors.New("Failed to obtain delivery uuid for the order")
+	}
+	if trackingNumber != "" {
+		return true, nil
 	}
-	fullToken := "Bearer " + accessToken
-	request.Header.Set("Content-Type", "application/json")
-	request.Header.Set("Authorization", fullToken)
-
-	client := http.DefaultClient
-	response, err := client.Do(request)
 
+	tracking, err := carrier.Track(ctx, deliveryUUID)
 	if err != nil {
-		log.Printf("Error in calculating delivery cost")
-		return delivery, errors.New("failed request to delivery")
+		log.Printf("Error in getting delivery data for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return false, err
 	}
-	log.Println(response.StatusCode)
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Internal server error happened when calculating delivery cost")
-		return delivery, errors.New("failed response from delivery")
-	}
-
-	if response.StatusCode == http.StatusOK {
-		err := json.NewDecoder(response.Body).Decode(&delivery)
-		defer response.Body.Close()
-		log.Println(delivery)
-		if err != nil  {
-			log.Printf("Unable to decode delivery response")
-			return delivery, errors.New("failed reading response from delivery")
+	switch tracking.State {
+	case ShipmentRejected:
+		err = store.UpdateDeliveryError(ctx, orderID, tracking.Error)
+		if err != nil {
+			log.Printf("Failed to record delivery error for the order %s", strconv.Itoa(int(orderID)))
 		}
-		
-		return delivery, nil
-
+		return false, errors.New(tracking.Error)
+	case ShipmentAccepted:
+		err = store.UpdateTrackingNumber(ctx, deliveryID, tracking.TrackingNumber)
+		if err != nil {
+			log.Printf("Failed to update delivery tracking number for the order %s", strconv.Itoa(int(orderID)) )
+			return false, errors.New("Failed to update delivery tracking number")
+		}
+		return true, nil
 	}
-	return delivery, errors.New("failed response from delivery")
+	return false, nil
 }
 
+// CheckDeliveryStatus polls the carrier for the delivery statuses of the order and returns the latest one, empty when there is none yet.
+func CheckDeliveryStatus(carrier Carrier, store DeliveryStore, orderID uint) (string, error) {
 
-func OrderDelivery(orderID uint) (error) {
-	var delivery RequestDelivery
-	var contacts models.Contacts
-	var dRecipient DeliveryRecipient
-	var dCost DeliveryRecipientCost
-	var phone Phone
-	var toLoc models.Location
-	var fromLoc models.Location
-	var packages []FullPackage
-	var respDelivery ResponseDelivery
-	var respEntity Entity
-
-
-	accessToken, _ := AuthorizeDelivery()
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
 
-	deliveryObj, err := LoadApiDelivery(ctx, config.DB, orderID)
+	deliveryID, deliveryUUID, status, trackingNumber, err := store.FindDeliveryUUID(ctx, orderID) 
 	if err != nil {
-		log.Printf("Failed to obtain delivery data for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("Failed to obtain delivery data for the order")
+		log.Printf("Failed to obtain delivery uuid for the order %s", strconv.Itoa(int(orderID)) )
+		return "", errors.New("Failed to obtain delivery uuid for the order")
 	}
 
-	if deliveryObj.Method == "door_to_door" {
-		delivery.TariffCode = 139
-		toLoc.PostalCode = deliveryObj.PostalCode
-		toLoc.Address = deliveryObj.Address
-		delivery.ToLocation = toLoc
-	} else if deliveryObj.Method == "door_to_office" {
-		delivery.TariffCode = 138
-		delivery.DeliveryPoint = deliveryObj.Code
-	}
-
-	for num := 1; num <= int(deliveryObj.Projects); num++ {
-		
-        var p FullPackage
-		var i Item
-		p.Number = num
-		p.Weight = 0.2 
-		p.Height = 0.2 
-		p.Width = 0.2
-		p.Length = 0.2 
-		i.Name = "photobook"
-		i.WareKey = "1"
-		i.Payment = 0
-		p.Items = append(p.Items, i)
-		p.Cost = 10000
-		p.Amount = 1
-		packages = append(packages, p)
-		num = num + 1
-
-	}
-
-	fromLoc.PostalCode = "123456"
-	fromLoc.Address = "123456"
-	delivery.FromLocation = fromLoc
-
-	dCost.Value = int(deliveryObj.Amount)
-	delivery.DeliveryRecipientCost = dCost
-
-	contacts = deliveryObj.ContactData
-	dRecipient.Name = contacts.FirstName + " " + contacts.LastName
-	dRecipient.Email = contacts.Email
-	phone.Number = contacts.Phone
-	dRecipient.Phones = append(dRecipient.Phones, phone)
-	delivery.Recipient = dRecipient
-	delivery.Packages = packages
-
-	
-	orderURL := "https://api.edu.cdek.ru/v2/orders"
-	bodyBytes, _ := json.Marshal(orderURL)
-	body := bytes.NewBuffer(bodyBytes)
-	log.Println(body)
-
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, orderURL, body)
+	tracking, err := carrier.Track(ctx, deliveryUUID)
 	if err != nil {
-		log.Printf("Error in placing delivery for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed request to order delivery")
+		log.Printf("Error in getting delivery data for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return "", errors.New("failed request to get delivery data")
 	}
-	fullToken := "Bearer " + accessToken
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	request.Header.Set("Authorization", fullToken)
-
-	client := http.DefaultClient
-	response, err := client.Do(request)
-
-	if err != nil {
-		log.Printf("Error in placing delivery for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed request to order delivery")
+	if len(tracking.Statuses) == 0 {
+		return "", nil
 	}
-
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Error in placing delivery for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed response 500 to order delivery")
+	// the whole list is kept for the order timeline
+	err = store.AddDeliveryStatuses(ctx, deliveryID, tracking.Statuses)
+	if err != nil {
+		log.Printf("Failed to store delivery statuses for the order %s", strconv.Itoa(int(orderID)) )
+		return "", errors.New("Failed to store delivery statuses")
 	}
-
-	if response.StatusCode == http.StatusOK {
-		err := json.NewDecoder(response.Body).Decode(&respDelivery)
-		defer response.Body.Close()
+	if trackingNumber == "" && tracking.TrackingNumber != "" {
+		err = store.UpdateTrackingNumber(ctx, deliveryID, tracking.TrackingNumber) 
 		if err != nil  {
-			log.Printf("Error in decoding placed delivery for the order %s", strconv.Itoa(int(orderID)) )
-			return errors.New("failed decoding placed delivery")
+				log.Printf("Failed to update delivery tracking number for the order %s", strconv.Itoa(int(orderID)) )
+				return "", errors.New("Failed to update delivery tracking number")
 		}
-		respEntity = respDelivery.Entity
-		if respEntity.UUID == ""  {
-			log.Printf("API error in creating delivery for the order %s", strconv.Itoa(int(orderID)) )
-			return errors.New("error placing delivery")
-		} else {
-			err = AddDeliveryID(ctx, config.DB, orderID, respEntity.UUID) 
-			if err != nil  {
-				log.Printf("Failed to update delivery api id for the order %s", strconv.Itoa(int(orderID)) )
-				return errors.New("Failed to update delivery api id")
-			}
+	}
+	dStatus := tracking.Statuses[0].Code
+	if dStatus != status {
+		err = store.UpdateDeliveryStatus(ctx, deliveryID, dStatus) 
+		if err != nil  {
+			log.Printf("Failed to update delivery status for the order %s", strconv.Itoa(int(orderID)) )
+			return "", errors.New("Failed to update delivery status")
 		}
-		
-		return nil
-
 	}
-	return errors.New("failed request to order delivery")
+	return dStatus, nil
 }
 
-func CheckDeliveryStatus(orderID uint) (error) {
-	var dStatusObj DeliveryStatusCheck
-	var dStatus string
-	var dtrackingNumber string
-	var dEntity DeliveryEntity
-	accessToken, _ := AuthorizeDelivery()
-	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
-	// не забываем освободить ресурс
-	defer cancel()
+// RecordStatusEvent stores the delivery status the carrier posted for a shipment and returns the order of the shipment
+// with its latest delivery status. Repeated and late events are stored once and do not override a newer status.
+// The order is zero for the shipments of no order.
+func RecordStatusEvent(ctx context.Context, store DeliveryStore, event WebhookEvent) (uint, string, error) {
 
-	deliveryID, deliveryUUID, status, trackingNumber, err := FindDeliveryUUID(ctx, config.DB, orderID) 
+	orderID, err := store.FindShipmentOrder(ctx, event.UUID)
 	if err != nil {
-		log.Printf("Failed to obtain delivery uuid for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("Failed to obtain delivery uuid for the order")
+		return 0, "", err
 	}
-
-	
-	statusURL := "https://api.edu.cdek.ru/v2/orders/" + deliveryUUID
-
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL, nil)
+	if orderID == 0 {
+		log.Printf("Delivery status event for the unknown shipment %s", event.UUID)
+		return 0, "", nil
+	}
+	statusEvent, err := StatusEvent(event)
 	if err != nil {
-		log.Printf("Error in getting delivery data for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed request to get delivery data")
+		log.Printf("Error happened when reading delivery status event for the order %d. Err: %s", orderID, err)
+		return orderID, "", err
 	}
-	fullToken := "Bearer " + accessToken
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	request.Header.Set("Authorization", fullToken)
-
-	client := http.DefaultClient
-	response, err := client.Do(request)
 
+	deliveryID, _, status, trackingNumber, err := store.FindDeliveryUUID(ctx, orderID)
 	if err != nil {
-		log.Printf("Error in getting delivery data for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed request to get delivery data")
+		log.Printf("Failed to obtain delivery for the order %d", orderID)
+		return orderID, "", err
 	}
-
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Error 500 in getting delivery data for the order %s", strconv.Itoa(int(orderID)) )
-		return errors.New("failed request to get delivery data 500")
+	err = store.AddDeliveryStatuses(ctx, deliveryID, []models.DeliveryStatusEvent{statusEvent})
+	if err != nil {
+		log.Printf("Failed to store delivery status for the order %d", orderID)
+		return orderID, "", err
 	}
-
-	if response.StatusCode == http.StatusOK {
-		err := json.NewDecoder(response.Body).Decode(&dStatusObj)
-		defer response.Body.Close()
-		if err != nil  {
-			log.Printf("Error in decoding status delivery for the order %s", strconv.Itoa(int(orderID)) )
-			return errors.New("failed decoding status delivery")
-		}
-		dEntity = dStatusObj.Entity
-		dtrackingNumber = dEntity.CDEKNumber
-		lastStatus := dEntity.Statuses[0]
-		dStatus = lastStatus.Code
-		if trackingNumber == "" {
-			err = UpdateTrackingNumber(ctx, config.DB, deliveryID, dtrackingNumber) 
-			if err != nil  {
-					log.Printf("Failed to update delivery tracking number for the order %s", strconv.Itoa(int(orderID)) )
-					return errors.New("Failed to update delivery tracking number")
-			}
-		}
-		if dStatus != status {
-			err = UpdateDeliveryStatus(ctx, config.DB, deliveryID, dStatus) 
-			if err != nil  {
-				log.Printf("Failed to update delivery status for the order %s", strconv.Itoa(int(orderID)) )
-				return errors.New("Failed to update delivery status")
-			}
-		
+	if trackingNumber == "" && event.Attributes.CDEKNumber != "" {
+		err = store.UpdateTrackingNumber(ctx, deliveryID, event.Attributes.CDEKNumber)
+		if err != nil {
+			log.Printf("Failed to update delivery tracking number for the order %d", orderID)
+			return orderID, "", err
 		}
-
-		
-		return nil
-
 	}
-	return errors.New("Failed to update delivery status")
-}
-
-func RoutineUpdateDeliveryStatus(ctx context.Context, storeDB *pgxpool.Pool) {
-
-	ticker := time.NewTicker(config.UpdateInterval)
-	var err error
-	var orderList []uint
-
-	jobCh := make(chan uint)
-	for i := 0; i < config.WorkersCount; i++ {
-		go func() {
-			for job := range jobCh {
-	
-				err = CheckDeliveryStatus(job)
-				if err != nil {
-					log.Printf("Error happened when updating pending deliveries. Err: %s", err)
-					continue
-				}
-			}
-		}()
+	latest, err := store.LatestDeliveryStatus(ctx, deliveryID)
+	if err != nil {
+		log.Printf("Failed to obtain latest delivery status for the order %d", orderID)
+		return orderID, "", err
 	}
-
-	for range ticker.C {
-
-		orderList, err = LoadActiveDeliveries(ctx, storeDB)
+	if latest.Code != status {
+		err = store.UpdateDeliveryStatus(ctx, deliveryID, latest.Code)
 		if err != nil {
-			log.Printf("Error happened when retrieving pending deliveries. Err: %s", err)
-			continue
+			log.Printf("Failed to update delivery status for the order %d", orderID)
+			return orderID, "", err
 		}
-
-		for _, order := range orderList {
-			jobCh <- order
-
-		}
-
 	}
+	return orderID, latest.Code, nil
 }
 
 // LoadApiDelivery function performs the operation of retrieving delivery info from pgx database with a query.
@@ -521,27 +253,69 @@ func LoadApiDelivery(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (
 	var contactData models.Contacts
 	var deliveryID uint
 
-	err := storeDB.QueryRow(ctx, "SELECT delivery_id, firstname, lastname, email, phone FROM orders WHERE orders_id = ($1);", orderID).Scan(&deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone)
+	err := storeDB.QueryRow(ctx, "SELECT delivery_id, firstname, lastname, email, phone, COALESCE(package_box, false) FROM orders WHERE orders_id = ($1);", orderID).Scan(&deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone, &orderObj.PackageBox)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when retrieving delivery id info from pgx table. Err: %s", err)
 				return orderObj, err
 	}
 	orderObj.ContactData = contactData
-	err = storeDB.QueryRow(ctx, "SELECT method, address, code, postal_code, deliverystatus, amount, deliveryid, trackingnumber FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&orderObj.Method, &orderObj.Address, &orderObj.Code, &orderObj.PostalCode, &orderObj.DeliveryStatus, &orderObj.Amount, &orderObj.DeliveryID, &orderObj.TrackingNumber)
+	var warehouseID *uint
+	err = storeDB.QueryRow(ctx, "SELECT method, COALESCE(address, ''), COALESCE(code, ''), COALESCE(postal_code, ''), COALESCE(deliverystatus, ''), amount, COALESCE(deliveryid, ''), COALESCE(trackingnumber, ''), warehouses_id FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&orderObj.Method, &orderObj.Address, &orderObj.Code, &orderObj.PostalCode, &orderObj.DeliveryStatus, &orderObj.Amount, &orderObj.DeliveryID, &orderObj.TrackingNumber, &warehouseID)
 	if err != nil && err != pgx.ErrNoRows{
 		log.Printf("Error happened when retrieving delivery info from pgx table. Err: %s", err)
 		return orderObj, err
 	}
-	err = storeDB.QueryRow(ctx, "SELECT COUNT(projects_id) FROM orders_has_projects WHERE orders_id = ($1);", orderID).Scan(&orderObj.Projects)
+	if warehouseID != nil {
+		w := &orderObj.Origin
+		err = storeDB.QueryRow(ctx, "SELECT warehouses_id, name, COALESCE(partner, ''), postal_code, city, address, city_code, COALESCE(work_time, ''), COALESCE(latitude, 0), COALESCE(longitude, 0), is_active, COALESCE(phone, '') FROM warehouses WHERE warehouses_id = ($1);", *warehouseID).Scan(&w.WarehouseID, &w.Name, &w.Partner, &w.PostalCode, &w.City, &w.Address, &w.CityCode, &w.WorkTime, &w.Latitude, &w.Longitude, &w.IsActive, &w.Phone)
+		if err != nil {
+			log.Printf("Error happened when retrieving delivery warehouse from pgx table. Err: %s", err)
+			return orderObj, err
+		}
+	}
+	err = storeDB.QueryRow(ctx, "SELECT COALESCE(SUM(quantity), 0) FROM orders_has_projects WHERE orders_id = ($1);", orderID).Scan(&orderObj.Projects)
 	if err != nil && err != pgx.ErrNoRows{
 				log.Printf("Error happened when counting projects for order in pgx table. Err: %s", err)
 				return orderObj, err
 	}
+	orderObj.Books, err = loadShippedBooks(ctx, storeDB, "SELECT p.size, p.variant, p.cover, COALESCE(p.count_pages, 0) FROM projects p JOIN orders_has_projects o ON o.projects_id = p.projects_id CROSS JOIN generate_series(1, o.quantity) WHERE o.orders_id = ($1) ORDER BY p.projects_id;", orderID)
+	if err != nil {
+		return orderObj, err
+	}
 
 	return orderObj, nil
 
 }
 
+// LoadProjectBooks function performs the operation of retrieving what the packaging of the projects depends on from pgx database with a query.
+// A project listed several times is shipped in as many copies.
+func LoadProjectBooks(ctx context.Context, storeDB *pgxpool.Pool, projectIDs []uint) ([]models.ShippedBook, error) {
+
+	return loadShippedBooks(ctx, storeDB, "SELECT p.size, p.variant, p.cover, COALESCE(p.count_pages, 0) FROM unnest($1::int[]) AS q(projects_id) JOIN projects p ON p.projects_id = q.projects_id ORDER BY p.projects_id;", projectIDs)
+}
+
+// loadShippedBooks scans the size, variant, cover and page count of the projects the statement selects.
+func loadShippedBooks(ctx context.Context, storeDB *pgxpool.Pool, statement string, args ...interface{}) ([]models.ShippedBook, error) {
+
+	books := []models.ShippedBook{}
+	rows, err := storeDB.Query(ctx, statement, args...)
+	if err != nil {
+		log.Printf("Error happened when retrieving project packaging info from pgx table. Err: %s", err)
+		return books, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var book models.ShippedBook
+		if err = rows.Scan(&book.Size, &book.Variant, &book.Cover, &book.CountPages); err != nil {
+			log.Printf("Error happened when scanning project packaging info. Err: %s", err)
+			return books, err
+		}
+		books = append(books, book)
+	}
+	return books, nil
+}
+
 
 // AddDeliveryID function performs the operation of adding delivery uuid from pgx database with a query.
 func AddDeliveryID(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, uuid string) (error) {
@@ -553,9 +327,10 @@ func AddDeliveryID(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, uui
 				log.Printf("Error happened when retrieving delivery id info from pgx table. Err: %s", err)
 				return err
 	}
-	_, err = storeDB.Exec(ctx, "UPDATE delivery SET deliveryid = ($1), status = ($2) WHERE delivery_id = ($3);",
-			"IN PROGRESS",
+	// the tracking of the shipment registered before is not carried over to the new one
+	_, err = storeDB.Exec(ctx, "UPDATE delivery SET deliveryid = ($1), status = ($2), registration_error = NULL, trackingnumber = NULL, deliverystatus = NULL WHERE delivery_id = ($3);",
 			uuid,
+			"IN PROGRESS",
 			deliveryID,
 	)
 	if err != nil {
@@ -581,7 +356,7 @@ func FindDeliveryUUID(ctx context.Context, storeDB *pgxpool.Pool, orderID uint)
 				log.Printf("Error happened when retrieving delivery id info from pgx table. Err: %s", err)
 				return deliveryID, uuid, status, trackingNumber, err
 	}
-	err = storeDB.QueryRow(ctx, "SELECT deliveryid, deliverystatus, trackingnumber FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&uuid, &status, &trackingNumber)
+	err = storeDB.QueryRow(ctx, "SELECT COALESCE(deliveryid, ''), COALESCE(deliverystatus, ''), COALESCE(trackingnumber, '') FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&uuid, &status, &trackingNumber)
 	if err != nil {
 		log.Printf("Error happened when retrieving delivery uuid from pgx table. Err: %s", err)
 		return deliveryID, uuid, status, trackingNumber, err
@@ -609,6 +384,107 @@ func UpdateTrackingNumber(ctx context.Context, storeDB *pgxpool.Pool, deliveryID
 
 }
 
+// LoadPendingShipments function performs the operation of retrieving the orders ready for delivery with a shipment registered
+// and not rejected from pgx database with a query.
+func LoadPendingShipments(ctx context.Context, storeDB *pgxpool.Pool) ([]uint, error) {
+
+	var orders []uint
+
+	rows, err := storeDB.Query(ctx, "SELECT o.orders_id FROM orders o JOIN delivery d ON d.delivery_id = o.delivery_id WHERE o.status = ($1) AND d.deliveryid IS NOT NULL AND d.registration_error IS NULL ORDER BY o.orders_id;", "READY_FOR_DELIVERY")
+	if err != nil {
+		log.Printf("Error happened when retrieving pending shipments from pgx table. Err: %s", err)
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var order uint
+		if err = rows.Scan(&order); err != nil {
+			log.Printf("Error happened when scanning pending shipments. Err: %s", err)
+			return orders, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, nil
+
+}
+
+// UpdateDeliveryError function performs the operation of recording why the shipment of the order could not be registered in pgx database with a query.
+func UpdateDeliveryError(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, registrationError string) (error) {
+
+	_, err := storeDB.Exec(ctx, "UPDATE delivery SET registration_error = ($1) WHERE delivery_id = (SELECT delivery_id FROM orders WHERE orders_id = ($2));",
+		registrationError,
+		orderID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating delivery registration error into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// LoadDeliveryFailures function performs the operation of retrieving the orders ready for delivery whose shipment could not be registered from pgx database with a query.
+func LoadDeliveryFailures(ctx context.Context, storeDB *pgxpool.Pool) (models.ResponseDeliveryFailures, error) {
+
+	failures := models.ResponseDeliveryFailures{Orders: []models.DeliveryFailure{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT o.orders_id, d.delivery_id, d.registration_error, o.last_updated_at FROM orders o JOIN delivery d ON d.delivery_id = o.delivery_id WHERE o.status = ($1) AND d.registration_error IS NOT NULL ORDER BY o.orders_id;", "READY_FOR_DELIVERY")
+	if err != nil {
+		log.Printf("Error happened when retrieving delivery failures from pgx table. Err: %s", err)
+		return failures, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var failure models.DeliveryFailure
+		var updateTimeStorage time.Time
+		if err = rows.Scan(&failure.OrdersID, &failure.DeliveryID, &failure.RegistrationError, &updateTimeStorage); err != nil {
+			log.Printf("Error happened when scanning delivery failures. Err: %s", err)
+			return failures, err
+		}
+		failure.LastEditedAt = updateTimeStorage.Unix()
+		failures.Orders = append(failures.Orders, failure)
+	}
+	return failures, nil
+
+}
+
+// DeliveryFailed function performs the operation of checking whether the shipment of the order could not be registered from pgx database with a query.
+func DeliveryFailed(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (bool, error) {
+
+	var failed bool
+
+	err := storeDB.QueryRow(ctx, "SELECT d.registration_error IS NOT NULL FROM orders o JOIN delivery d ON d.delivery_id = o.delivery_id WHERE o.orders_id = ($1);", orderID).Scan(&failed)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving delivery registration error from pgx table. Err: %s", err)
+		return false, err
+	}
+	return failed, nil
+
+}
+
+// AddDeliveryStatuses function performs the operation of storing the statuses reported for the delivery in pgx database with a query.
+// Statuses stored by an earlier check are skipped.
+func AddDeliveryStatuses(ctx context.Context, storeDB *pgxpool.Pool, deliveryID uint, statuses []models.DeliveryStatusEvent) (error) {
+
+	for _, status := range statuses {
+		_, err := storeDB.Exec(ctx, "INSERT INTO delivery_statuses (delivery_id, code, name, city, happened_at) VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING;",
+			deliveryID,
+			status.Code,
+			status.Name,
+			status.City,
+			time.Unix(status.HappenedAt, 0),
+		)
+		if err != nil {
+			log.Printf("Error happened when inserting delivery status into pgx table. Err: %s", err)
+			return err
+		}
+	}
+	return nil
+
+}
+
 // UpdateDeliveryStatus function performs the operation of updating delivery status from pgx database with a query.
 func UpdateDeliveryStatus(ctx context.Context, storeDB *pgxpool.Pool, deliveryID uint, dstatus string) (error) {
 
@@ -621,18 +497,48 @@ func UpdateDeliveryStatus(ctx context.Context, storeDB *pgxpool.Pool, deliveryID
 		log.Printf("Error happened when updating delivery status into pgx table. Err: %s", err)
 		return err
 	}
+	// the order itself is completed by the status hooks, see orderhandlers
 	if dstatus == "DELIVERED" {
 		_, err = storeDB.Exec(ctx, "UPDATE delivery SET status = ($1) WHERE delivery_id = ($2);",
 			"COMPLETED",
 			deliveryID,
 		)
-		_, err = storeDB.Exec(ctx, "UPDATE orders SET status = ($1) WHERE delivery_id = ($2);",
-			"COMPLETED",
-			deliveryID,
-		)
+		if err != nil {
+			log.Printf("Error happened when completing delivery into pgx table. Err: %s", err)
+			return err
+		}
 	}
 
 
 	return nil
 
-}
\ No newline at end of file
+}
+
+// FindShipmentOrder function performs the operation of retrieving the order of a shipment registered with the carrier from pgx database with a query.
+// The order is zero when no order has the shipment.
+func FindShipmentOrder(ctx context.Context, storeDB *pgxpool.Pool, uuid string) (uint, error) {
+
+	var orderID uint
+	err := storeDB.QueryRow(ctx, "SELECT o.orders_id FROM orders o JOIN delivery d ON d.delivery_id = o.delivery_id WHERE d.deliveryid = ($1);", uuid).Scan(&orderID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving shipment order from pgx table. Err: %s", err)
+		return orderID, err
+	}
+	return orderID, nil
+
+}
+
+// LatestDeliveryStatus function performs the operation of retrieving the latest stored delivery status from pgx database with a query.
+func LatestDeliveryStatus(ctx context.Context, storeDB *pgxpool.Pool, deliveryID uint) (models.DeliveryStatusEvent, error) {
+
+	var status models.DeliveryStatusEvent
+	var happenedAt time.Time
+	err := storeDB.QueryRow(ctx, "SELECT code, COALESCE(name, ''), COALESCE(city, ''), happened_at FROM delivery_statuses WHERE delivery_id = ($1) ORDER BY happened_at DESC, delivery_statuses_id DESC LIMIT 1;", deliveryID).Scan(&status.Code, &status.Name, &status.City, &happenedAt)
+	if err != nil {
+		log.Printf("Error happened when retrieving latest delivery status from pgx table. Err: %s", err)
+		return status, err
+	}
+	status.HappenedAt = happenedAt.Unix()
+	return status, nil
+
+}
@@ -0,0 +1,176 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PrintTimeout is how long the carrier is waited for to make the print forms.
+var PrintTimeout = time.Minute
+
+// MaxPrintShipments is how many shipments CDEK puts into one print form.
+const MaxPrintShipments = 100
+
+// ErrNoShipment is returned when the shipment of the order is not registered with the carrier yet.
+var ErrNoShipment = errors.New("shipment is not registered with the carrier")
+
+// shippingForms are the print forms made for every shipment.
+var shippingForms = []string{FormWaybill, FormBarcode}
+
+// printForm makes the print form of the shipments and uploads it to the object storage as name.
+func printForm(ctx context.Context, carrier Carrier, files objectsstorage.FileStorage, form string, shipmentIDs []string, name string) (models.ShippingDocument, error) {
+
+	document := models.ShippingDocument{Form: form, Link: name}
+	pdf, err := carrier.PrintForm(ctx, form, shipmentIDs)
+	if err != nil {
+		log.Printf("Error happened when printing %s of the shipments %s. Err: %s", form, strings.Join(shipmentIDs, ", "), err)
+		return document, err
+	}
+	err = files.Upload(ctx, name, pdf)
+	if err != nil {
+		log.Printf("Error happened when uploading %s. Err: %s", name, err)
+		return document, err
+	}
+	document.CreatedAt = time.Now().Unix()
+	return document, nil
+}
+
+// PrintShippingDocuments makes the waybill and the barcode labels of the shipment of the order, keeps them in the object storage
+// and stores their links, replacing the ones printed before.
+func PrintShippingDocuments(ctx context.Context, carrier Carrier, files objectsstorage.FileStorage, store DeliveryStore, orderID uint) ([]models.ShippingDocument, error) {
+
+	var documents []models.ShippingDocument
+	_, deliveryUUID, _, trackingNumber, err := store.FindDeliveryUUID(ctx, orderID)
+	if err != nil {
+		log.Printf("Failed to obtain delivery uuid for the order %d", orderID)
+		return documents, err
+	}
+	// the forms are printed once the carrier has accepted the shipment and numbered it
+	if deliveryUUID == "" || trackingNumber == "" {
+		return documents, ErrNoShipment
+	}
+	for _, form := range shippingForms {
+		name := fmt.Sprintf("%s_%d_%d.pdf", strings.ToLower(form), orderID, time.Now().Unix())
+		document, err := printForm(ctx, carrier, files, form, []string{deliveryUUID}, name)
+		if err != nil {
+			return documents, err
+		}
+		err = store.SaveShippingDocument(ctx, orderID, document)
+		if err != nil {
+			log.Printf("Failed to store %s of the order %d", form, orderID)
+			return documents, err
+		}
+		documents = append(documents, document)
+	}
+	return documents, nil
+}
+
+// PrintShippingBatch makes the waybills and the barcode labels of all the shipments to be handed over to the carrier,
+// see LoadShipmentsToHandOver, MaxPrintShipments to a file. The batch forms are not stored with the orders.
+func PrintShippingBatch(ctx context.Context, carrier Carrier, files objectsstorage.FileStorage, store DeliveryStore) (models.ResponseShippingBatch, error) {
+
+	batch := models.ResponseShippingBatch{Orders: []uint{}, Documents: []models.ShippingDocument{}}
+	orderList, err := store.LoadShipmentsToHandOver(ctx)
+	if err != nil {
+		return batch, err
+	}
+	var shipmentIDs []string
+	for _, orderID := range orderList {
+		_, deliveryUUID, _, _, err := store.FindDeliveryUUID(ctx, orderID)
+		if err != nil {
+			log.Printf("Failed to obtain delivery uuid for the order %d", orderID)
+			return batch, err
+		}
+		batch.Orders = append(batch.Orders, orderID)
+		shipmentIDs = append(shipmentIDs, deliveryUUID)
+	}
+
+	t := time.Now()
+	for part := 0; part*MaxPrintShipments < len(shipmentIDs); part++ {
+		end := (part + 1) * MaxPrintShipments
+		if end > len(shipmentIDs) {
+			end = len(shipmentIDs)
+		}
+		for _, form := range shippingForms {
+			name := fmt.Sprintf("%s_batch_%s_%d_%d.pdf", strings.ToLower(form), t.Format("20060102"), part+1, t.Unix())
+			document, err := printForm(ctx, carrier, files, form, shipmentIDs[part*MaxPrintShipments:end], name)
+			if err != nil {
+				return batch, err
+			}
+			batch.Documents = append(batch.Documents, document)
+		}
+	}
+	return batch, nil
+}
+
+// SaveShippingDocument function performs the operation of storing the print form of the order shipment in pgx database with a query.
+func SaveShippingDocument(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, document models.ShippingDocument) error {
+
+	_, err := storeDB.Exec(ctx, "INSERT INTO shipping_documents (delivery_id, form, link, created_at) SELECT delivery_id, ($2), ($3), ($4) FROM orders WHERE orders_id = ($1) ON CONFLICT (delivery_id, form) DO UPDATE SET link = EXCLUDED.link, created_at = EXCLUDED.created_at;",
+		orderID, document.Form, document.Link, time.Unix(document.CreatedAt, 0))
+	if err != nil {
+		log.Printf("Error happened when inserting shipping document into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// LoadShippingDocuments function performs the operation of retrieving the print forms of the order shipment from pgx database with a query.
+func LoadShippingDocuments(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) ([]models.ShippingDocument, error) {
+
+	var documents []models.ShippingDocument
+	rows, err := storeDB.Query(ctx, "SELECT s.form, s.link, s.created_at FROM shipping_documents s JOIN orders o ON o.delivery_id = s.delivery_id WHERE o.orders_id = ($1) ORDER BY s.form;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving shipping documents from pgx table. Err: %s", err)
+		return documents, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var document models.ShippingDocument
+		var createdAt time.Time
+		if err = rows.Scan(&document.Form, &document.Link, &createdAt); err != nil {
+			log.Printf("Error happened when scanning shipping documents. Err: %s", err)
+			return documents, err
+		}
+		document.CreatedAt = createdAt.Unix()
+		documents = append(documents, document)
+	}
+	return documents, nil
+
+}
+
+// LoadShipmentsToHandOver function performs the operation of retrieving the orders whose shipments the carrier has accepted
+// but not picked up yet from pgx database with a query.
+func LoadShipmentsToHandOver(ctx context.Context, storeDB *pgxpool.Pool) ([]uint, error) {
+
+	var orders []uint
+	rows, err := storeDB.Query(ctx, "SELECT o.orders_id FROM orders o JOIN delivery d ON d.delivery_id = o.delivery_id WHERE o.status = ANY($1) AND COALESCE(d.deliveryid, '') <> '' AND COALESCE(d.trackingnumber, '') <> '' AND COALESCE(d.deliverystatus, '') = ANY($2) ORDER BY o.orders_id;",
+		[]string{"READY_FOR_DELIVERY", "IN_DELIVERY"}, []string{"", "CREATED", "ACCEPTED"})
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving shipments to hand over from pgx table. Err: %s", err)
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID uint
+		if err = rows.Scan(&orderID); err != nil {
+			log.Printf("Error happened when scanning shipments to hand over. Err: %s", err)
+			return orders, err
+		}
+		orders = append(orders, orderID)
+	}
+	return orders, nil
+
+}
@@ -0,0 +1,424 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+// FakeCarrierPath is the path the fake CDEK api is served under next to the application.
+const FakeCarrierPath = "/fakecdek"
+
+var errUnknownShipment = errors.New("unknown shipment")
+
+type fakeShipment struct {
+	request    RequestDelivery
+	state      string
+	errMessage string
+	cdekNumber string
+	cancelled  bool
+	statuses   []DeliveryStatus
+}
+
+// FakeCDEK is a local stand-in for the CDEK api v2 serving the token, tariff, order, delivery point, webhook and print endpoints
+// used by CDEK. Registered shipments wait for Accept or Reject unless AutoAccept is set, their new statuses are posted
+// to the subscribed webhook.
+type FakeCDEK struct {
+	ClientID string
+	Secret   string
+	// Price is the quote of every shipment
+	Price      money.Money
+	AutoAccept bool
+	// Points are the delivery points listed by the api
+	Points []ResponseDeliveryPoint
+
+	mu        sync.Mutex
+	next      uint
+	tokens    map[string]bool
+	issued    int
+	shipments map[string]*fakeShipment
+	forms     map[string]string
+	webhooks  []string
+	// subscriptions counts the webhooks registered
+	subscriptions int
+}
+
+// NewFakeCDEK returns a fake CDEK api accepting the given credentials and quoting 350 roubles.
+func NewFakeCDEK(clientID string, secret string) *FakeCDEK {
+	return &FakeCDEK{
+		ClientID: clientID,
+		Secret:   secret,
+		Price:    money.FromRoubles(350),
+		Points: []ResponseDeliveryPoint{
+			{Code: "MSK1", Name: "На Тверской", Type: MethodPickupPoint, WorkTime: "Пн-Вс 10:00-21:00", Location: DeliveryPointLocation{City: "Москва", PostalCode: "125009", Address: "ул. Тверская, 7", Latitude: 55.7580, Longitude: 37.6117}},
+			{Code: "MSK2", Name: "Постамат на Арбате", Type: MethodPostamat, WorkTime: "Круглосуточно", Location: DeliveryPointLocation{City: "Москва", PostalCode: "119002", Address: "ул. Арбат, 24", Latitude: 55.7502, Longitude: 37.5925}},
+			{Code: "NSK27", Name: "На Красном", Type: MethodPickupPoint, WorkTime: "Пн-Сб 10:00-20:00", Location: DeliveryPointLocation{City: "Новосибирск", PostalCode: "630099", Address: "Красный проспект, 1", Latitude: 55.0301, Longitude: 82.9204}},
+		},
+		tokens:    make(map[string]bool),
+		shipments: make(map[string]*fakeShipment),
+		forms:     make(map[string]string),
+	}
+}
+
+func (f *FakeCDEK) id(prefix string) string {
+	f.next++
+	return fmt.Sprintf("%s-%d-%d", prefix, time.Now().Unix(), f.next)
+}
+
+// TokensIssued returns how many access tokens were handed out.
+func (f *FakeCDEK) TokensIssued() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued
+}
+
+// ExpireTokens revokes the access tokens handed out so far.
+func (f *FakeCDEK) ExpireTokens() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = make(map[string]bool)
+}
+
+// Shipment returns the request the shipment was registered with and whether it was cancelled.
+func (f *FakeCDEK) Shipment(uuid string) (RequestDelivery, bool, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		return RequestDelivery{}, false, false
+	}
+	return s.request, s.cancelled, true
+}
+
+// Accept validates the shipment and assigns its tracking number, as CDEK does shortly after registration.
+func (f *FakeCDEK) Accept(uuid string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		return errUnknownShipment
+	}
+	f.accept(uuid, s)
+	return nil
+}
+
+func (f *FakeCDEK) accept(uuid string, s *fakeShipment) {
+	s.state = "SUCCESSFUL"
+	s.cdekNumber = fmt.Sprintf("10%08d", f.next)
+	s.statuses = []DeliveryStatus{{Code: "CREATED", Name: "Создан", City: s.request.FromLocation.City, DateTime: time.Now().Format(cdekTimeLayout)}}
+	f.notify(uuid, s, s.statuses[0])
+}
+
+// Reject invalidates the shipment with message.
+func (f *FakeCDEK) Reject(uuid string, message string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		return errUnknownShipment
+	}
+	s.state = "INVALID"
+	s.errMessage = message
+	return nil
+}
+
+// AddStatus reports a new delivery status of the shipment, e.g. DELIVERED.
+func (f *FakeCDEK) AddStatus(uuid string, code string, name string, city string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		return errUnknownShipment
+	}
+	status := DeliveryStatus{Code: code, Name: name, City: city, DateTime: time.Now().Format(cdekTimeLayout)}
+	s.statuses = append([]DeliveryStatus{status}, s.statuses...)
+	f.notify(uuid, s, status)
+	return nil
+}
+
+// Webhooks returns the urls subscribed to the status events.
+func (f *FakeCDEK) Webhooks() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.webhooks...)
+}
+
+// Subscriptions returns how many times a url was subscribed to the status events.
+func (f *FakeCDEK) Subscriptions() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subscriptions
+}
+
+// notify posts the new status of the shipment to the subscribed urls in the background, as CDEK does.
+// It is called with f.mu held.
+func (f *FakeCDEK) notify(uuid string, s *fakeShipment, status DeliveryStatus) {
+
+	event := WebhookEvent{Type: WebhookOrderStatus, DateTime: time.Now().Format(cdekTimeLayout), UUID: uuid, Attributes: WebhookAttributes{
+		CDEKNumber:     s.cdekNumber,
+		Number:         s.request.Number,
+		Code:           status.Code,
+		StatusDateTime: status.DateTime,
+		CityName:       status.City,
+	}}
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	for _, webhookURL := range f.webhooks {
+		go func(webhookURL string) {
+			response, err := http.Post(webhookURL, "application/json", bytes.NewReader(body))
+			if err == nil {
+				response.Body.Close()
+			}
+		}(webhookURL)
+	}
+}
+
+func writeFakeJSON(rw http.ResponseWriter, status int, body interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(body)
+}
+
+func fakeRequestError(requestType string, message string) []DeliveryRequest {
+	return []DeliveryRequest{{Type: requestType, State: "INVALID", Errors: []DeliveryError{{Code: "v2_bad_request", Message: message}}}}
+}
+
+// SetPoints replaces the delivery points listed by the api.
+func (f *FakeCDEK) SetPoints(points []ResponseDeliveryPoint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.Points = points
+}
+
+// ServeHTTP serves the CDEK api paths, with FakeCarrierPath stripped.
+func (f *FakeCDEK) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	if r.URL.Path == "/v2/oauth/token" {
+		f.serveToken(rw, r)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	f.mu.Lock()
+	authorized := f.tokens[token]
+	f.mu.Unlock()
+	if !authorized {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v2/calculator/tariff" && r.Method == http.MethodPost:
+		f.serveTariff(rw, r)
+	case r.URL.Path == "/v2/orders" && r.Method == http.MethodPost:
+		f.serveCreate(rw, r)
+	case strings.HasPrefix(r.URL.Path, "/v2/orders/") && r.Method == http.MethodGet:
+		f.serveOrder(rw, strings.TrimPrefix(r.URL.Path, "/v2/orders/"))
+	case strings.HasPrefix(r.URL.Path, "/v2/orders/") && r.Method == http.MethodDelete:
+		f.serveCancel(rw, strings.TrimPrefix(r.URL.Path, "/v2/orders/"))
+	case r.URL.Path == "/v2/deliverypoints" && r.Method == http.MethodGet:
+		f.mu.Lock()
+		points := f.Points
+		f.mu.Unlock()
+		writeFakeJSON(rw, http.StatusOK, points)
+	case r.URL.Path == "/v2/webhooks" && r.Method == http.MethodPost:
+		f.serveWebhook(rw, r)
+	case r.URL.Path == "/v2/webhooks" && r.Method == http.MethodGet:
+		f.serveWebhooks(rw)
+	case (r.URL.Path == "/v2/print/orders" || r.URL.Path == "/v2/print/barcodes") && r.Method == http.MethodPost:
+		f.servePrint(rw, r)
+	case (strings.HasPrefix(r.URL.Path, "/v2/print/orders/") || strings.HasPrefix(r.URL.Path, "/v2/print/barcodes/")) && r.Method == http.MethodGet:
+		f.serveForm(rw, r.URL.Path)
+	default:
+		http.NotFound(rw, r)
+	}
+}
+
+func (f *FakeCDEK) serveToken(rw http.ResponseWriter, r *http.Request) {
+
+	if r.FormValue("grant_type") != "client_credentials" || r.FormValue("client_id") != f.ClientID || r.FormValue("client_secret") != f.Secret {
+		rw.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	f.mu.Lock()
+	token := f.id("token")
+	f.tokens[token] = true
+	f.issued++
+	f.mu.Unlock()
+	writeFakeJSON(rw, http.StatusOK, ResponseAuthorization{AccessToken: token, TokenType: "bearer", ExpiresIn: 3600, Scope: "order:all"})
+}
+
+func (f *FakeCDEK) serveTariff(rw http.ResponseWriter, r *http.Request) {
+
+	var rApiCost models.RequestDeliveryCost
+	if err := json.NewDecoder(r.Body).Decode(&rApiCost); err != nil || rApiCost.TariffCode == 0 || len(rApiCost.Packages) == 0 {
+		writeFakeJSON(rw, http.StatusBadRequest, map[string]interface{}{"errors": []DeliveryError{{Code: "v2_bad_request", Message: "invalid tariff request"}}})
+		return
+	}
+	var weight int
+	for _, p := range rApiCost.Packages {
+		weight += p.Weight
+	}
+	writeFakeJSON(rw, http.StatusOK, models.ApiResponseDeliveryCost{
+		PeriodMin:   2,
+		PeriodMax:   4,
+		DeliverySum: f.Price,
+		TotalSum:    f.Price,
+		WeightCalc:  float64(weight),
+		Currency:    "RUB",
+	})
+}
+
+func (f *FakeCDEK) serveCreate(rw http.ResponseWriter, r *http.Request) {
+
+	var delivery RequestDelivery
+	if err := json.NewDecoder(r.Body).Decode(&delivery); err != nil {
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "invalid json")})
+		return
+	}
+	switch {
+	case delivery.TariffCode == 0:
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "tariff_code is empty")})
+		return
+	case len(delivery.Packages) == 0:
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "packages are empty")})
+		return
+	case delivery.ToLocation == nil && delivery.DeliveryPoint == "":
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "to_location or delivery_point is required")})
+		return
+	case len(delivery.Recipient.Phones) == 0 || delivery.Recipient.Phones[0].Number == "":
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "recipient phone is empty")})
+		return
+	}
+
+	f.mu.Lock()
+	uuid := f.id("cdek")
+	s := &fakeShipment{request: delivery, state: "ACCEPTED"}
+	if f.AutoAccept {
+		f.accept(uuid, s)
+	}
+	f.shipments[uuid] = s
+	f.mu.Unlock()
+	writeFakeJSON(rw, http.StatusAccepted, ResponseDelivery{
+		Entity:   Entity{UUID: uuid},
+		Requests: []DeliveryRequest{{Type: "CREATE", State: "ACCEPTED", DateTime: time.Now().Format(cdekTimeLayout)}},
+	})
+}
+
+func (f *FakeCDEK) serveOrder(rw http.ResponseWriter, uuid string) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		writeFakeJSON(rw, http.StatusNotFound, DeliveryStatusCheck{Requests: fakeRequestError("GET", "order not found")})
+		return
+	}
+	createRequest := DeliveryRequest{Type: "CREATE", State: s.state}
+	if s.state == "INVALID" {
+		createRequest.Errors = []DeliveryError{{Code: "v2_entity_invalid", Message: s.errMessage}}
+	}
+	writeFakeJSON(rw, http.StatusOK, DeliveryStatusCheck{
+		Entity:   DeliveryEntity{UUID: uuid, CDEKNumber: s.cdekNumber, Number: s.request.Number, TariffCode: int(s.request.TariffCode), Statuses: s.statuses},
+		Requests: []DeliveryRequest{createRequest},
+	})
+}
+
+func (f *FakeCDEK) serveCancel(rw http.ResponseWriter, uuid string) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.shipments[uuid]
+	if !ok {
+		writeFakeJSON(rw, http.StatusNotFound, ResponseDelivery{Requests: fakeRequestError("DELETE", "order not found")})
+		return
+	}
+	if len(s.statuses) > 1 {
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("DELETE", "order is already on its way")})
+		return
+	}
+	s.cancelled = true
+	writeFakeJSON(rw, http.StatusAccepted, ResponseDelivery{Entity: Entity{UUID: uuid}, Requests: []DeliveryRequest{{Type: "DELETE", State: "ACCEPTED"}}})
+}
+
+func (f *FakeCDEK) serveWebhook(rw http.ResponseWriter, r *http.Request) {
+
+	var requestWebhook RequestWebhook
+	if err := json.NewDecoder(r.Body).Decode(&requestWebhook); err != nil || requestWebhook.URL == "" || requestWebhook.Type != WebhookOrderStatus {
+		writeFakeJSON(rw, http.StatusBadRequest, ResponseDelivery{Requests: fakeRequestError("CREATE", "invalid webhook")})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// a subscription replaces the earlier one of the same type
+	f.webhooks = []string{requestWebhook.URL}
+	f.subscriptions++
+	writeFakeJSON(rw, http.StatusOK, ResponseDelivery{Entity: Entity{UUID: f.id("webhook")}})
+}
+
+func (f *FakeCDEK) serveWebhooks(rw http.ResponseWriter) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	webhooks := []ResponseWebhook{}
+	for i, webhookURL := range f.webhooks {
+		webhooks = append(webhooks, ResponseWebhook{UUID: fmt.Sprintf("webhook-%d", i+1), URL: webhookURL, Type: WebhookOrderStatus})
+	}
+	writeFakeJSON(rw, http.StatusOK, webhooks)
+}
+
+func (f *FakeCDEK) servePrint(rw http.ResponseWriter, r *http.Request) {
+
+	var requestPrint RequestPrint
+	if err := json.NewDecoder(r.Body).Decode(&requestPrint); err != nil || len(requestPrint.Orders) == 0 {
+		writeFakeJSON(rw, http.StatusBadRequest, ResponsePrint{Requests: fakeRequestError("CREATE", "orders are empty")})
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var cdekNumbers []string
+	for _, order := range requestPrint.Orders {
+		s, ok := f.shipments[order.OrderUUID]
+		if !ok || s.cdekNumber == "" {
+			writeFakeJSON(rw, http.StatusBadRequest, ResponsePrint{Requests: fakeRequestError("CREATE", "order is not registered yet")})
+			return
+		}
+		cdekNumbers = append(cdekNumbers, s.cdekNumber)
+	}
+	uuid := f.id("print")
+	f.forms[r.URL.Path+"/"+uuid] = strings.Join(cdekNumbers, ", ")
+	writeFakeJSON(rw, http.StatusAccepted, ResponsePrint{Entity: PrintEntity{UUID: uuid}})
+}
+
+// serveForm answers the state of the print form at path, ready right away, or its PDF listing the CDEK numbers of the shipments.
+func (f *FakeCDEK) serveForm(rw http.ResponseWriter, path string) {
+
+	pdf := strings.HasSuffix(path, ".pdf")
+	path = strings.TrimSuffix(path, ".pdf")
+	f.mu.Lock()
+	cdekNumbers, ok := f.forms[path]
+	f.mu.Unlock()
+	if !ok {
+		rw.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !pdf {
+		writeFakeJSON(rw, http.StatusOK, ResponsePrint{Entity: PrintEntity{
+			UUID:     path[strings.LastIndex(path, "/")+1:],
+			URL:      FakeCarrierPath + path + ".pdf",
+			Statuses: []DeliveryStatus{{Code: "ACCEPTED"}, {Code: "READY"}},
+		}})
+		return
+	}
+	rw.Header().Set("Content-Type", "application/pdf")
+	fmt.Fprintf(rw, "%%PDF-1.4\n%% fake CDEK print form %s\n%%%%EOF\n", cdekNumbers)
+}
@@ -0,0 +1,170 @@
+package delivery
+
+import (
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// Limits of one parcel, the weight of its books in grams and its height in centimetres.
+// The books that do not fit are packed into another one.
+const (
+	MaxParcelWeight = 10000
+	MaxParcelHeight = 40
+)
+
+// bookFormat is the trimmed size of the photobook pages in centimetres.
+type bookFormat struct {
+	Width  float64
+	Height float64
+}
+
+var bookFormats = map[string]bookFormat{
+	"SMALL_SQUARE": {Width: 20, Height: 20},
+	"SQUARE":       {Width: 30, Height: 30},
+	"VERTICAL":     {Width: 21, Height: 30},
+	"HORIZONTAL":   {Width: 30, Height: 21},
+}
+
+// paperStock is the paper of a book variant, the density in g/m² and the thickness in millimetres of one sheet.
+type paperStock struct {
+	Density   float64
+	Thickness float64
+}
+
+var paperStocks = map[string]paperStock{
+	"STANDARD": {Density: 250, Thickness: 0.25},
+	// the premium sheets are glued onto cardboard to lie flat
+	"PREMIUM": {Density: 800, Thickness: 1.2},
+}
+
+// coverStock is the board the cover is made of, the density in g/m² and the thickness in millimetres of one board.
+var coverStocks = map[string]paperStock{
+	"HARD":        {Density: 1300, Thickness: 2.5},
+	"LEATHERETTE": {Density: 1900, Thickness: 3.5},
+}
+
+// Packaging around the books: the cover overhang over the pages, the gift box and the shipping carton in centimetres,
+// the box and carton cardboard in g/m².
+const (
+	coverOverhang  = 1.0
+	giftBoxMargin  = 2.0
+	giftBoxDensity = 1200.0
+	cartonMargin   = 4.0
+	cartonDensity  = 600.0
+)
+
+// packedBook is a photobook ready to be put into a parcel, weight in grams and sizes in centimetres.
+type packedBook struct {
+	Weight float64
+	Length float64
+	Width  float64
+	Height float64
+}
+
+// packBook returns the weight and the sizes of the book, in its gift box when packageBox is set.
+// Unknown sizes, variants and covers are taken as the biggest ones not to underquote the shipment.
+func packBook(book models.ShippedBook, packageBox bool) packedBook {
+
+	format, ok := bookFormats[book.Size]
+	if !ok {
+		format = bookFormats["SQUARE"]
+	}
+	paper, ok := paperStocks[book.Variant]
+	if !ok {
+		paper = paperStocks["PREMIUM"]
+	}
+	cover, ok := coverStocks[book.Cover]
+	if !ok {
+		cover = coverStocks["LEATHERETTE"]
+	}
+	sheets := math.Ceil(float64(book.CountPages) / 2)
+
+	pagesArea := format.Width * format.Height / 10000
+	packed := packedBook{
+		Length: format.Width + coverOverhang,
+		Width:  format.Height + coverOverhang,
+		Height: (sheets*paper.Thickness + 2*cover.Thickness) / 10,
+	}
+	coverArea := (2*packed.Length + packed.Height) * packed.Width / 10000
+	packed.Weight = sheets*pagesArea*paper.Density + coverArea*cover.Density
+
+	if packageBox {
+		packed.Length += giftBoxMargin
+		packed.Width += giftBoxMargin
+		packed.Height += giftBoxMargin
+		packed.Weight += boxArea(packed.Length, packed.Width, packed.Height) * giftBoxDensity
+	}
+	return packed
+}
+
+// boxArea returns the cardboard in m² of a box of the sizes in centimetres.
+func boxArea(length float64, width float64, height float64) float64 {
+	return 2 * (length*width + length*height + width*height) / 10000
+}
+
+// PackBooks stacks the books into shipping cartons, the biggest at the bottom, starting a new carton
+// when the next book would make the parcel heavier than MaxParcelWeight or higher than MaxParcelHeight.
+func PackBooks(books []models.ShippedBook, packageBox bool) []Parcel {
+
+	packed := make([]packedBook, len(books))
+	for i, book := range books {
+		packed[i] = packBook(book, packageBox)
+	}
+	order := make([]int, len(books))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return packed[order[i]].Length*packed[order[i]].Width > packed[order[j]].Length*packed[order[j]].Width
+	})
+
+	var parcels []Parcel
+	var stack []int
+	var weight, height float64
+	closeCarton := func() {
+		if len(stack) == 0 {
+			return
+		}
+		parcels = append(parcels, carton(stack, packed, weight, height))
+		stack, weight, height = nil, 0, 0
+	}
+	for _, i := range order {
+		book := packed[i]
+		if weight+book.Weight > MaxParcelWeight || height+book.Height+cartonMargin > MaxParcelHeight {
+			closeCarton()
+		}
+		stack = append(stack, i)
+		weight += book.Weight
+		height += book.Height
+	}
+	closeCarton()
+	return parcels
+}
+
+// carton returns the parcel of the stacked books, the ware keys numbering the books as they were passed.
+func carton(stack []int, packed []packedBook, weight float64, height float64) Parcel {
+
+	var length, width float64
+	for _, i := range stack {
+		length = math.Max(length, packed[i].Length)
+		width = math.Max(width, packed[i].Width)
+	}
+	length += cartonMargin
+	width += cartonMargin
+	height += cartonMargin
+	weight += boxArea(length, width, height) * cartonDensity
+
+	parcel := Parcel{
+		Weight: int(math.Ceil(weight)),
+		Length: int(math.Ceil(length)),
+		Width:  int(math.Ceil(width)),
+		Height: int(math.Ceil(height)),
+	}
+	for _, i := range stack {
+		parcel.Items = append(parcel.Items, ParcelItem{Name: "photobook", WareKey: strconv.Itoa(i + 1), Weight: int(math.Ceil(packed[i].Weight))})
+	}
+	return parcel
+}
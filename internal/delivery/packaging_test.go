@@ -0,0 +1,46 @@
+package delivery
+
+import (
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+func TestPackBooks(t *testing.T) {
+
+	small := models.ShippedBook{Size: "SMALL_SQUARE", Variant: "STANDARD", Cover: "HARD", CountPages: 20}
+	leather := models.ShippedBook{Size: "SQUARE", Variant: "PREMIUM", Cover: "LEATHERETTE", CountPages: 60}
+
+	parcels := PackBooks([]models.ShippedBook{small}, false)
+	if len(parcels) != 1 || parcels[0].Weight < 300 || parcels[0].Length < 21 {
+		t.Fatalf("expected one parcel with the small book, got %v", parcels)
+	}
+	heavy := PackBooks([]models.ShippedBook{leather}, false)
+	if heavy[0].Weight <= 2*parcels[0].Weight {
+		t.Fatalf("expected the premium leatherette book to weigh far more than the small one, got %d and %d", heavy[0].Weight, parcels[0].Weight)
+	}
+	boxed := PackBooks([]models.ShippedBook{leather}, true)
+	if boxed[0].Weight <= heavy[0].Weight || boxed[0].Height <= heavy[0].Height {
+		t.Fatalf("expected the gift box to add to the parcel, got %v and %v", boxed[0], heavy[0])
+	}
+
+	books := []models.ShippedBook{small, leather, leather, leather, leather, leather}
+	parcels = PackBooks(books, true)
+	items := 0
+	for _, parcel := range parcels {
+		weight := 0
+		for _, item := range parcel.Items {
+			weight += item.Weight
+		}
+		if weight > MaxParcelWeight+len(parcel.Items) || parcel.Height > MaxParcelHeight {
+			t.Fatalf("expected the parcel to stay within the limits, got %v", parcel)
+		}
+		items += len(parcel.Items)
+	}
+	if len(parcels) < 2 || items != len(books) {
+		t.Fatalf("expected the books to be split into several parcels, got %v", parcels)
+	}
+	if parcels[len(parcels)-1].Items[len(parcels[len(parcels)-1].Items)-1].WareKey != "1" {
+		t.Fatalf("expected the smallest book on top of the last parcel, got %v", parcels)
+	}
+}
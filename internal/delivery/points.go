@@ -0,0 +1,208 @@
+package delivery
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PointsRefreshInterval is how often the local copy of the delivery points is refreshed from the carrier.
+var PointsRefreshInterval = time.Hour * 24
+
+// DefaultPointsLimit is how many delivery points a search returns when no limit is asked for.
+const DefaultPointsLimit = 50
+
+// earthRadius is the mean radius of the Earth in kilometres.
+const earthRadius = 6371.0
+
+// Distance returns the great-circle distance between two coordinates in kilometres.
+func Distance(lat1 float64, lon1 float64, lat2 float64, lon2 float64) float64 {
+
+	toRadians := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLon := toRadians(lon2 - lon1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// NearestPoints orders the points by their distance from the coordinates, filling it in, and keeps the first limit of them.
+func NearestPoints(points []models.DeliveryPoint, latitude float64, longitude float64, limit int) []models.DeliveryPoint {
+
+	for i := range points {
+		distance := Distance(latitude, longitude, points[i].Latitude, points[i].Longitude)
+		points[i].Distance = &distance
+	}
+	sort.SliceStable(points, func(i, j int) bool { return *points[i].Distance < *points[j].Distance })
+	if len(points) > limit {
+		points = points[:limit]
+	}
+	return points
+}
+
+// MatchesPointQuery reports whether the point is in the city, postal code and of the type searched for.
+func MatchesPointQuery(point models.DeliveryPoint, query models.DeliveryPointQuery) bool {
+
+	if query.City != "" && !strings.EqualFold(point.City, query.City) {
+		return false
+	}
+	if query.PostalCode != "" && point.PostalCode != query.PostalCode {
+		return false
+	}
+	return query.Type == "" || point.Type == query.Type
+}
+
+// RefreshDeliveryPoints replaces the local copy of the delivery points with the list of the carrier.
+func RefreshDeliveryPoints(ctx context.Context, carrier Carrier, store DeliveryStore) error {
+
+	points, err := carrier.DeliveryPoints(ctx)
+	if err != nil {
+		log.Printf("Error happened when retrieving delivery points from the carrier. Err: %s", err)
+		return err
+	}
+	// an empty answer is rather a carrier failure than all the points closing at once
+	if len(points) == 0 {
+		log.Printf("The carrier listed no delivery points, the stored ones are kept")
+		return nil
+	}
+	return store.ReplaceDeliveryPoints(ctx, points)
+}
+
+// CheckPoint reports whether the shipments can be sent to the delivery point of the type. The stored copy of the points
+// is filled from the carrier first when it is empty, as before the first refresh, so that no order is refused meanwhile.
+func CheckPoint(ctx context.Context, carrier Carrier, store DeliveryStore, code string, pointType string) (bool, error) {
+
+	exists, err := store.CheckDeliveryPoint(ctx, code, pointType)
+	if err != nil || exists {
+		return exists, err
+	}
+	stored, err := store.LoadDeliveryPoints(ctx, models.DeliveryPointQuery{Limit: 1})
+	if err != nil || len(stored) > 0 {
+		return false, err
+	}
+	err = RefreshDeliveryPoints(ctx, carrier, store)
+	if err != nil {
+		return false, err
+	}
+	return store.CheckDeliveryPoint(ctx, code, pointType)
+}
+
+func RoutineRefreshDeliveryPoints(ctx context.Context, carrier Carrier, store DeliveryStore) {
+
+	ticker := time.NewTicker(PointsRefreshInterval)
+	for {
+		refreshCtx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout*10)
+		err := RefreshDeliveryPoints(refreshCtx, carrier, store)
+		cancel()
+		if err != nil {
+			log.Printf("Error happened when refreshing delivery points. Err: %s", err)
+		}
+		<-ticker.C
+	}
+}
+
+// ReplaceDeliveryPoints function performs the operation of replacing the stored delivery points in pgx database with a query.
+func ReplaceDeliveryPoints(ctx context.Context, storeDB *pgxpool.Pool, points []models.DeliveryPoint) error {
+
+	t := time.Now()
+	tx, err := storeDB.Begin(ctx)
+	if err != nil {
+		log.Printf("Error happened when starting delivery points transaction. Err: %s", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	batch := &pgx.Batch{}
+	for _, p := range points {
+		batch.Queue("INSERT INTO delivery_points (code, name, type, city, postal_code, address, latitude, longitude, work_time, refreshed_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) ON CONFLICT (code) DO UPDATE SET name = EXCLUDED.name, type = EXCLUDED.type, city = EXCLUDED.city, postal_code = EXCLUDED.postal_code, address = EXCLUDED.address, latitude = EXCLUDED.latitude, longitude = EXCLUDED.longitude, work_time = EXCLUDED.work_time, refreshed_at = EXCLUDED.refreshed_at;",
+			p.Code, p.Name, p.Type, p.City, p.PostalCode, p.Address, p.Latitude, p.Longitude, p.WorkTime, t)
+	}
+	err = tx.SendBatch(ctx, batch).Close()
+	if err != nil {
+		log.Printf("Error happened when inserting delivery points into pgx table. Err: %s", err)
+		return err
+	}
+	// the points the carrier no longer lists are closed
+	_, err = tx.Exec(ctx, "DELETE FROM delivery_points WHERE refreshed_at < ($1);", t)
+	if err != nil {
+		log.Printf("Error happened when deleting closed delivery points from pgx table. Err: %s", err)
+		return err
+	}
+	return tx.Commit(ctx)
+
+}
+
+// LoadDeliveryPoints function performs the operation of searching the stored delivery points from pgx database with a query.
+// With coordinates the points are ordered by their distance, nearest first.
+func LoadDeliveryPoints(ctx context.Context, storeDB *pgxpool.Pool, query models.DeliveryPointQuery) ([]models.DeliveryPoint, error) {
+
+	points := []models.DeliveryPoint{}
+	limit := int(query.Limit)
+	if limit == 0 {
+		limit = DefaultPointsLimit
+	}
+	statement := "SELECT code, COALESCE(name, ''), type, COALESCE(city, ''), COALESCE(postal_code, ''), COALESCE(address, ''), COALESCE(latitude, 0), COALESCE(longitude, 0), COALESCE(work_time, '') FROM delivery_points WHERE (($1) = '' OR lower(city) = lower($1)) AND (($2) = '' OR postal_code = ($2)) AND (($3) = '' OR type = ($3))"
+	args := []interface{}{query.City, query.PostalCode, query.Type}
+	if query.Latitude != nil && query.Longitude != nil {
+		// an equirectangular estimate is enough to pick the candidates, NearestPoints measures them exactly
+		statement += " ORDER BY (latitude - ($4))^2 + ((longitude - ($5)) * cos(radians($4)))^2 LIMIT ($6);"
+		args = append(args, *query.Latitude, *query.Longitude, limit)
+	} else {
+		statement += " ORDER BY code LIMIT ($4);"
+		args = append(args, limit)
+	}
+
+	rows, err := storeDB.Query(ctx, statement, args...)
+	if err != nil {
+		log.Printf("Error happened when retrieving delivery points from pgx table. Err: %s", err)
+		return points, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.DeliveryPoint
+		if err = rows.Scan(&p.Code, &p.Name, &p.Type, &p.City, &p.PostalCode, &p.Address, &p.Latitude, &p.Longitude, &p.WorkTime); err != nil {
+			log.Printf("Error happened when scanning delivery points. Err: %s", err)
+			return points, err
+		}
+		points = append(points, p)
+	}
+	if query.Latitude != nil && query.Longitude != nil {
+		points = NearestPoints(points, *query.Latitude, *query.Longitude, limit)
+	}
+	return points, nil
+
+}
+
+// CheckDeliveryPoint function performs the operation of checking that a delivery point of the type is stored in pgx database with a query.
+func CheckDeliveryPoint(ctx context.Context, storeDB *pgxpool.Pool, code string, pointType string) (bool, error) {
+
+	var exists bool
+	err := storeDB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM delivery_points WHERE code = ($1) AND type = ($2));", code, pointType).Scan(&exists)
+	if err != nil {
+		log.Printf("Error happened when checking delivery point in pgx table. Err: %s", err)
+		return false, err
+	}
+	return exists, nil
+
+}
+
+// LoadDeliveryPoint function performs the operation of retrieving a stored delivery point from pgx database with a query.
+func LoadDeliveryPoint(ctx context.Context, storeDB *pgxpool.Pool, code string) (models.DeliveryPoint, error) {
+
+	var p models.DeliveryPoint
+	err := storeDB.QueryRow(ctx, "SELECT code, COALESCE(name, ''), type, COALESCE(city, ''), COALESCE(postal_code, ''), COALESCE(address, ''), COALESCE(latitude, 0), COALESCE(longitude, 0), COALESCE(work_time, '') FROM delivery_points WHERE code = ($1);", code).Scan(&p.Code, &p.Name, &p.Type, &p.City, &p.PostalCode, &p.Address, &p.Latitude, &p.Longitude, &p.WorkTime)
+	if err != nil {
+		log.Printf("Error happened when retrieving delivery point from pgx table. Err: %s", err)
+		return p, err
+	}
+	return p, nil
+
+}
@@ -0,0 +1,51 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// ErrNoWarehousePhone is returned when the warehouse the books come back to has no phone for the courier.
+var ErrNoWarehousePhone = errors.New("warehouse has no phone")
+
+// returnShipment returns the shipment bringing the books of the order from the customer back to the warehouse
+// they were shipped from. The courier picks them up at from.
+func returnShipment(number string, deliveryObj models.ResponseApiDeliveryInfo, from models.Location) Shipment {
+
+	shipment := BookShipment(MethodDoor, from, WarehouseLocation(deliveryObj.Origin), "", deliveryObj.Books, deliveryObj.PackageBox)
+	shipment.Number = number
+	shipment.Recipient = models.Contacts{FirstName: deliveryObj.Origin.Name, Email: "support@memoryprint.ru", Phone: deliveryObj.Origin.Phone}
+	return shipment
+}
+
+// OrderReturn registers the shipment of the books of the order back to the warehouse after the complaint
+// and returns its id at the carrier. The books are picked up at the delivery address of the order unless from is given.
+func OrderReturn(ctx context.Context, carrier Carrier, store DeliveryStore, orderID uint, complaintID uint, from *models.Location) (string, error) {
+
+	deliveryObj, err := store.LoadApiDelivery(ctx, orderID)
+	if err != nil {
+		log.Printf("Failed to obtain delivery data for the order %d", orderID)
+		return "", err
+	}
+	if deliveryObj.Origin.WarehouseID == 0 {
+		return "", ErrNoWarehouse
+	}
+	if deliveryObj.Origin.Phone == "" {
+		log.Printf("The warehouse %d has no phone to return the order %d to", deliveryObj.Origin.WarehouseID, orderID)
+		return "", ErrNoWarehousePhone
+	}
+	pickup := models.Location{PostalCode: deliveryObj.PostalCode, Address: deliveryObj.Address}
+	if from != nil {
+		pickup = *from
+	}
+	uuid, err := carrier.CreateShipment(ctx, returnShipment(fmt.Sprintf("%d-R%d", orderID, complaintID), deliveryObj, pickup))
+	if err != nil {
+		log.Printf("Error in placing return shipment for the order %d. Err: %s", orderID, err)
+		return "", err
+	}
+	return uuid, nil
+}
@@ -0,0 +1,157 @@
+package delivery
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DeliveryStore is the storage of order deliveries used by the delivery routines.
+type DeliveryStore interface {
+	LoadActiveDeliveries(ctx context.Context) ([]uint, error)
+	LoadApiDelivery(ctx context.Context, orderID uint) (models.ResponseApiDeliveryInfo, error)
+	AddDeliveryID(ctx context.Context, orderID uint, uuid string) error
+	FindDeliveryUUID(ctx context.Context, orderID uint) (uint, string, string, string, error)
+	UpdateTrackingNumber(ctx context.Context, deliveryID uint, dtrackingNumber string) error
+	UpdateDeliveryStatus(ctx context.Context, deliveryID uint, dstatus string) error
+	AddDeliveryStatuses(ctx context.Context, deliveryID uint, statuses []models.DeliveryStatusEvent) error
+	LoadPendingShipments(ctx context.Context) ([]uint, error)
+	UpdateDeliveryError(ctx context.Context, orderID uint, registrationError string) error
+	LoadDeliveryFailures(ctx context.Context) (models.ResponseDeliveryFailures, error)
+	DeliveryFailed(ctx context.Context, orderID uint) (bool, error)
+	ReplaceDeliveryPoints(ctx context.Context, points []models.DeliveryPoint) error
+	LoadDeliveryPoints(ctx context.Context, query models.DeliveryPointQuery) ([]models.DeliveryPoint, error)
+	CheckDeliveryPoint(ctx context.Context, code string, pointType string) (bool, error)
+	LoadProjectBooks(ctx context.Context, projectIDs []uint) ([]models.ShippedBook, error)
+	LoadDeliveryPoint(ctx context.Context, code string) (models.DeliveryPoint, error)
+	CreateWarehouse(ctx context.Context, warehouse models.Warehouse) (uint, error)
+	UpdateWarehouse(ctx context.Context, warehouseID uint, warehouse models.Warehouse) error
+	DeleteWarehouse(ctx context.Context, warehouseID uint) error
+	CheckWarehouse(ctx context.Context, warehouseID uint) bool
+	LoadWarehouses(ctx context.Context) ([]models.Warehouse, error)
+	AssignWarehouse(ctx context.Context, orderID uint, warehouseID uint) error
+	FindShipmentOrder(ctx context.Context, uuid string) (uint, error)
+	LatestDeliveryStatus(ctx context.Context, deliveryID uint) (models.DeliveryStatusEvent, error)
+	SaveShippingDocument(ctx context.Context, orderID uint, document models.ShippingDocument) error
+	LoadShippingDocuments(ctx context.Context, orderID uint) ([]models.ShippingDocument, error)
+	LoadShipmentsToHandOver(ctx context.Context) ([]uint, error)
+}
+
+// PgDeliveryStore implements DeliveryStore on top of the postgres connection pool.
+type PgDeliveryStore struct {
+	DB *pgxpool.Pool
+}
+
+// NewPgDeliveryStore returns a DeliveryStore backed by the given pool.
+func NewPgDeliveryStore(storeDB *pgxpool.Pool) *PgDeliveryStore {
+	return &PgDeliveryStore{DB: storeDB}
+}
+
+func (s *PgDeliveryStore) LoadActiveDeliveries(ctx context.Context) ([]uint, error) {
+	return LoadActiveDeliveries(ctx, s.DB)
+}
+
+func (s *PgDeliveryStore) LoadApiDelivery(ctx context.Context, orderID uint) (models.ResponseApiDeliveryInfo, error) {
+	return LoadApiDelivery(ctx, s.DB, orderID)
+}
+
+func (s *PgDeliveryStore) AddDeliveryID(ctx context.Context, orderID uint, uuid string) error {
+	return AddDeliveryID(ctx, s.DB, orderID, uuid)
+}
+
+func (s *PgDeliveryStore) FindDeliveryUUID(ctx context.Context, orderID uint) (uint, string, string, string, error) {
+	return FindDeliveryUUID(ctx, s.DB, orderID)
+}
+
+func (s *PgDeliveryStore) UpdateTrackingNumber(ctx context.Context, deliveryID uint, dtrackingNumber string) error {
+	return UpdateTrackingNumber(ctx, s.DB, deliveryID, dtrackingNumber)
+}
+
+func (s *PgDeliveryStore) UpdateDeliveryStatus(ctx context.Context, deliveryID uint, dstatus string) error {
+	return UpdateDeliveryStatus(ctx, s.DB, deliveryID, dstatus)
+}
+
+func (s *PgDeliveryStore) AddDeliveryStatuses(ctx context.Context, deliveryID uint, statuses []models.DeliveryStatusEvent) error {
+	return AddDeliveryStatuses(ctx, s.DB, deliveryID, statuses)
+}
+
+func (s *PgDeliveryStore) LoadPendingShipments(ctx context.Context) ([]uint, error) {
+	return LoadPendingShipments(ctx, s.DB)
+}
+
+func (s *PgDeliveryStore) UpdateDeliveryError(ctx context.Context, orderID uint, registrationError string) error {
+	return UpdateDeliveryError(ctx, s.DB, orderID, registrationError)
+}
+
+func (s *PgDeliveryStore) LoadDeliveryFailures(ctx context.Context) (models.ResponseDeliveryFailures, error) {
+	return LoadDeliveryFailures(ctx, s.DB)
+}
+
+func (s *PgDeliveryStore) DeliveryFailed(ctx context.Context, orderID uint) (bool, error) {
+	return DeliveryFailed(ctx, s.DB, orderID)
+}
+
+func (s *PgDeliveryStore) ReplaceDeliveryPoints(ctx context.Context, points []models.DeliveryPoint) error {
+	return ReplaceDeliveryPoints(ctx, s.DB, points)
+}
+
+func (s *PgDeliveryStore) LoadDeliveryPoints(ctx context.Context, query models.DeliveryPointQuery) ([]models.DeliveryPoint, error) {
+	return LoadDeliveryPoints(ctx, s.DB, query)
+}
+
+func (s *PgDeliveryStore) CheckDeliveryPoint(ctx context.Context, code string, pointType string) (bool, error) {
+	return CheckDeliveryPoint(ctx, s.DB, code, pointType)
+}
+
+func (s *PgDeliveryStore) LoadProjectBooks(ctx context.Context, projectIDs []uint) ([]models.ShippedBook, error) {
+	return LoadProjectBooks(ctx, s.DB, projectIDs)
+}
+
+func (s *PgDeliveryStore) LoadDeliveryPoint(ctx context.Context, code string) (models.DeliveryPoint, error) {
+	return LoadDeliveryPoint(ctx, s.DB, code)
+}
+
+func (s *PgDeliveryStore) CreateWarehouse(ctx context.Context, warehouse models.Warehouse) (uint, error) {
+	return CreateWarehouse(ctx, s.DB, warehouse)
+}
+
+func (s *PgDeliveryStore) UpdateWarehouse(ctx context.Context, warehouseID uint, warehouse models.Warehouse) error {
+	return UpdateWarehouse(ctx, s.DB, warehouseID, warehouse)
+}
+
+func (s *PgDeliveryStore) DeleteWarehouse(ctx context.Context, warehouseID uint) error {
+	return DeleteWarehouse(ctx, s.DB, warehouseID)
+}
+
+func (s *PgDeliveryStore) CheckWarehouse(ctx context.Context, warehouseID uint) bool {
+	return CheckWarehouse(ctx, s.DB, warehouseID)
+}
+
+func (s *PgDeliveryStore) LoadWarehouses(ctx context.Context) ([]models.Warehouse, error) {
+	return LoadWarehouses(ctx, s.DB)
+}
+
+func (s *PgDeliveryStore) AssignWarehouse(ctx context.Context, orderID uint, warehouseID uint) error {
+	return AssignWarehouse(ctx, s.DB, orderID, warehouseID)
+}
+
+func (s *PgDeliveryStore) FindShipmentOrder(ctx context.Context, uuid string) (uint, error) {
+	return FindShipmentOrder(ctx, s.DB, uuid)
+}
+
+func (s *PgDeliveryStore) LatestDeliveryStatus(ctx context.Context, deliveryID uint) (models.DeliveryStatusEvent, error) {
+	return LatestDeliveryStatus(ctx, s.DB, deliveryID)
+}
+
+func (s *PgDeliveryStore) SaveShippingDocument(ctx context.Context, orderID uint, document models.ShippingDocument) error {
+	return SaveShippingDocument(ctx, s.DB, orderID, document)
+}
+
+func (s *PgDeliveryStore) LoadShippingDocuments(ctx context.Context, orderID uint) ([]models.ShippingDocument, error) {
+	return LoadShippingDocuments(ctx, s.DB, orderID)
+}
+
+func (s *PgDeliveryStore) LoadShipmentsToHandOver(ctx context.Context) ([]uint, error) {
+	return LoadShipmentsToHandOver(ctx, s.DB)
+}
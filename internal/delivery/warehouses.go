@@ -0,0 +1,165 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNoWarehouse is returned when there is no active warehouse to ship the order from.
+var ErrNoWarehouse = errors.New("no active warehouse")
+
+// WarehouseLocation returns the address of the warehouse as the carrier expects it.
+func WarehouseLocation(warehouse models.Warehouse) models.Location {
+	return models.Location{PostalCode: warehouse.PostalCode, City: warehouse.City, Address: warehouse.Address, Code: warehouse.CityCode}
+}
+
+// ChooseWarehouse returns the warehouse nearest to the delivery point when its coordinates are known,
+// otherwise one in the city of the customer, otherwise the first of the warehouses, which must not be empty.
+func ChooseWarehouse(warehouses []models.Warehouse, to models.Location, point *models.DeliveryPoint) models.Warehouse {
+
+	if point != nil && (point.Latitude != 0 || point.Longitude != 0) {
+		nearest := -1
+		var nearestDistance float64
+		for i, w := range warehouses {
+			if w.Latitude == 0 && w.Longitude == 0 {
+				continue
+			}
+			distance := Distance(point.Latitude, point.Longitude, w.Latitude, w.Longitude)
+			if nearest < 0 || distance < nearestDistance {
+				nearest, nearestDistance = i, distance
+			}
+		}
+		if nearest >= 0 {
+			return warehouses[nearest]
+		}
+	}
+	address := strings.ToLower(to.Address)
+	for _, w := range warehouses {
+		if strings.EqualFold(to.City, w.City) || strings.Contains(address, strings.ToLower(w.City)) {
+			return w
+		}
+	}
+	return warehouses[0]
+}
+
+// ChooseOrigin returns the active warehouse the shipment to the customer is sent from, see ChooseWarehouse.
+func ChooseOrigin(ctx context.Context, store DeliveryStore, method string, to models.Location, deliveryPoint string) (models.Warehouse, error) {
+
+	var origin models.Warehouse
+	warehouses, err := store.LoadWarehouses(ctx)
+	if err != nil {
+		return origin, err
+	}
+	active := warehouses[:0]
+	for _, w := range warehouses {
+		if w.IsActive {
+			active = append(active, w)
+		}
+	}
+	if len(active) == 0 {
+		log.Printf("There is no active warehouse to ship from")
+		return origin, ErrNoWarehouse
+	}
+	if method != MethodDoor && deliveryPoint != "" {
+		point, err := store.LoadDeliveryPoint(ctx, deliveryPoint)
+		if err == nil {
+			return ChooseWarehouse(active, to, &point), nil
+		}
+	}
+	return ChooseWarehouse(active, to, nil), nil
+}
+
+// CreateWarehouse function performs the operation of creating a warehouse in pgx database with a query.
+func CreateWarehouse(ctx context.Context, storeDB *pgxpool.Pool, warehouse models.Warehouse) (uint, error) {
+
+	var warehouseID uint
+	t := time.Now()
+	err := storeDB.QueryRow(ctx, "INSERT INTO warehouses (name, partner, postal_code, city, address, city_code, work_time, latitude, longitude, is_active, created_at, last_edited_at, phone) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING warehouses_id;",
+		warehouse.Name, warehouse.Partner, warehouse.PostalCode, warehouse.City, warehouse.Address, warehouse.CityCode, warehouse.WorkTime, warehouse.Latitude, warehouse.Longitude, true, t, t, warehouse.Phone).Scan(&warehouseID)
+	if err != nil {
+		log.Printf("Error happened when inserting a new warehouse into pgx table. Err: %s", err)
+		return warehouseID, err
+	}
+	return warehouseID, nil
+
+}
+
+// UpdateWarehouse function performs the operation of updating a warehouse in pgx database with a query.
+func UpdateWarehouse(ctx context.Context, storeDB *pgxpool.Pool, warehouseID uint, warehouse models.Warehouse) error {
+
+	_, err := storeDB.Exec(ctx, "UPDATE warehouses SET name = ($1), partner = ($2), postal_code = ($3), city = ($4), address = ($5), city_code = ($6), work_time = ($7), latitude = ($8), longitude = ($9), is_active = ($10), last_edited_at = ($11), phone = ($12) WHERE warehouses_id = ($13);",
+		warehouse.Name, warehouse.Partner, warehouse.PostalCode, warehouse.City, warehouse.Address, warehouse.CityCode, warehouse.WorkTime, warehouse.Latitude, warehouse.Longitude, warehouse.IsActive, time.Now(), warehouse.Phone, warehouseID)
+	if err != nil {
+		log.Printf("Error happened when updating warehouse in pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// DeleteWarehouse function performs the operation of deactivating a warehouse in pgx database with a query.
+// The warehouse is kept for the orders shipped from it.
+func DeleteWarehouse(ctx context.Context, storeDB *pgxpool.Pool, warehouseID uint) error {
+
+	_, err := storeDB.Exec(ctx, "UPDATE warehouses SET is_active = ($1), last_edited_at = ($2) WHERE warehouses_id = ($3);", false, time.Now(), warehouseID)
+	if err != nil {
+		log.Printf("Error happened when deactivating warehouse in pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// CheckWarehouse function performs the operation of checking that an active warehouse exists in pgx database with a query.
+func CheckWarehouse(ctx context.Context, storeDB *pgxpool.Pool, warehouseID uint) bool {
+
+	var exists bool
+	err := storeDB.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM warehouses WHERE warehouses_id = ($1) AND is_active);", warehouseID).Scan(&exists)
+	if err != nil {
+		log.Printf("Error happened when checking warehouse in pgx table. Err: %s", err)
+		return false
+	}
+	return exists
+
+}
+
+// LoadWarehouses function performs the operation of retrieving all the warehouses from pgx database with a query.
+func LoadWarehouses(ctx context.Context, storeDB *pgxpool.Pool) ([]models.Warehouse, error) {
+
+	warehouses := []models.Warehouse{}
+	rows, err := storeDB.Query(ctx, "SELECT warehouses_id, name, COALESCE(partner, ''), postal_code, city, address, city_code, COALESCE(work_time, ''), COALESCE(latitude, 0), COALESCE(longitude, 0), is_active, COALESCE(phone, '') FROM warehouses ORDER BY warehouses_id;")
+	if err != nil {
+		log.Printf("Error happened when retrieving warehouses from pgx table. Err: %s", err)
+		return warehouses, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w models.Warehouse
+		if err = rows.Scan(&w.WarehouseID, &w.Name, &w.Partner, &w.PostalCode, &w.City, &w.Address, &w.CityCode, &w.WorkTime, &w.Latitude, &w.Longitude, &w.IsActive, &w.Phone); err != nil {
+			log.Printf("Error happened when scanning warehouses. Err: %s", err)
+			return warehouses, err
+		}
+		warehouses = append(warehouses, w)
+	}
+	return warehouses, nil
+
+}
+
+// AssignWarehouse function performs the operation of assigning the warehouse the order is shipped from in pgx database with a query.
+func AssignWarehouse(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, warehouseID uint) error {
+
+	_, err := storeDB.Exec(ctx, "UPDATE delivery SET warehouses_id = ($1) WHERE delivery_id = (SELECT delivery_id FROM orders WHERE orders_id = ($2));", warehouseID, orderID)
+	if err != nil {
+		log.Printf("Error happened when assigning order warehouse in pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
@@ -0,0 +1,138 @@
+package delivery
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// WebhookPath is the path the carrier posts the status events to, followed by the webhook secret.
+const WebhookPath = "/api/v1/delivery/webhook/"
+
+// WebhookOrderStatus is the type of the CDEK events about the delivery statuses of the shipments.
+const WebhookOrderStatus = "ORDER_STATUS"
+
+// RequestWebhook subscribes the url to the CDEK events of the type.
+type RequestWebhook struct {
+	URL  string `json:"url" validate:"required"`
+	Type string `json:"type" validate:"required"`
+}
+
+// ResponseWebhook is a subscription of the account to the CDEK events.
+type ResponseWebhook struct {
+	UUID string `json:"uuid"`
+	URL  string `json:"url"`
+	Type string `json:"type"`
+}
+
+// WebhookEvent is the body CDEK posts to the subscribed url, UUID is the shipment the event is about.
+type WebhookEvent struct {
+	Type       string            `json:"type"`
+	DateTime   string            `json:"date_time"`
+	UUID       string            `json:"uuid"`
+	Attributes WebhookAttributes `json:"attributes"`
+}
+
+type WebhookAttributes struct {
+	IsReturn       bool   `json:"is_return"`
+	CDEKNumber     string `json:"cdek_number"`
+	Number         string `json:"number"`
+	Code           string `json:"code"`
+	StatusCode     string `json:"status_code"`
+	StatusDateTime string `json:"status_date_time"`
+	CityName       string `json:"city_name"`
+	CityCode       string `json:"city_code"`
+}
+
+// statusNames are the names of the CDEK delivery statuses, the events carry only the codes.
+var statusNames = map[string]string{
+	"CREATED":                              "Создан",
+	"ACCEPTED":                             "Принят",
+	"RECEIVED_AT_SHIPMENT_WAREHOUSE":       "Принят на склад отправителя",
+	"READY_TO_SHIP_AT_SENDING_OFFICE":      "Выдан на отправку в г. отправителе",
+	"SENT_TO_TRANSIT_CITY":                 "Отправлен в г. транзит",
+	"ACCEPTED_IN_TRANSIT_CITY":             "Встречен в г. транзите",
+	"SENT_TO_RECIPIENT_CITY":               "Отправлен в г. получатель",
+	"ACCEPTED_IN_RECIPIENT_CITY":           "Встречен в г. получателе",
+	"ACCEPTED_AT_RECIPIENT_CITY_WAREHOUSE": "Принят на склад доставки",
+	"ACCEPTED_AT_PICK_UP_POINT":            "Принят на склад до востребования",
+	"TAKEN_BY_COURIER":                     "Выдан на доставку",
+	"DELIVERED":                            "Вручен",
+	"NOT_DELIVERED":                        "Не вручен",
+}
+
+// VerifyWebhookToken reports whether the token the event was posted with is the webhook secret.
+// Without a secret configured no event is trusted.
+func VerifyWebhookToken(token string, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// WebhookURL returns the url the carrier posts the events to for the application served at baseURL.
+func WebhookURL(baseURL string, secret string) string {
+	return strings.TrimSuffix(baseURL, "/") + WebhookPath + secret
+}
+
+// StatusEvent returns the delivery status reported by the event.
+func StatusEvent(event WebhookEvent) (models.DeliveryStatusEvent, error) {
+
+	var status models.DeliveryStatusEvent
+	if event.Attributes.Code == "" {
+		return status, errors.New("event without status code")
+	}
+	happenedAt, err := time.Parse(cdekTimeLayout, event.Attributes.StatusDateTime)
+	if err != nil {
+		return status, err
+	}
+	name, ok := statusNames[event.Attributes.Code]
+	if !ok {
+		name = event.Attributes.Code
+	}
+	status = models.DeliveryStatusEvent{Code: event.Attributes.Code, Name: name, City: event.Attributes.CityName, HappenedAt: happenedAt.Unix()}
+	return status, nil
+}
+
+// SubscribeWebhook subscribes the url to the delivery status events unless the carrier already posts them to it.
+func SubscribeWebhook(ctx context.Context, carrier Carrier, url string) error {
+
+	webhooks, err := carrier.Webhooks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, webhookURL := range webhooks {
+		if webhookURL == url {
+			return nil
+		}
+	}
+	return carrier.Subscribe(ctx, url)
+}
+
+// RoutineSubscribeWebhook subscribes the url to the delivery status events, retrying every config.SleepTime
+// until the carrier, which may be served by this very application, accepts it or ctx is done.
+func RoutineSubscribeWebhook(ctx context.Context, carrier Carrier, url string) {
+
+	ticker := time.NewTicker(config.SleepTime)
+	defer ticker.Stop()
+	for {
+		subscribeCtx, cancel := context.WithTimeout(ctx, config.ContextDBTimeout)
+		err := SubscribeWebhook(subscribeCtx, carrier, url)
+		cancel()
+		if err == nil {
+			return
+		}
+		log.Printf("Error happened when subscribing to delivery status events. Err: %s", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/models"
 )
 
 const letterBytes = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
@@ -42,6 +43,7 @@ const (
 	MailOrderInDelivery int = 4
 	MailViewerInvitation int = 5
 	MailGiftCertificate int = 6
+	MailReceipt int = 7
 )
 
 // MailData represents the data to be sent to the template of the mail.
@@ -55,6 +57,7 @@ type MailData struct {
 	Ordernum uint
 	Trackingnum string
 	SubscriptionLink string
+	Receipt models.Receipt
 }
 
 // Mail represents a email request
@@ -126,6 +129,9 @@ func CreateMail(mailReq *Mail, ms *SGMailService) error {
 	} else if mailReq.mtype == MailGiftCertificate {
 		err = mailReq.ParseTemplate("gift_certificate.html", mailReq.data)
 	
+	} else if mailReq.mtype == MailReceipt {
+		err = mailReq.ParseTemplate("receipt_mail.html", mailReq.data)
+	
 	}
 
 	if err != nil{
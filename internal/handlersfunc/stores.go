@@ -0,0 +1,30 @@
+package handlersfunc
+
+import (
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
+	"github.com/SiberianMonster/memoryprint/internal/userstorage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Stores groups the storages the handlers depend on.
+type Stores struct {
+	Users    userstorage.UserStore
+	Projects projectstorage.ProjectStore
+	Orders   orderstorage.OrderStore
+	Objects  objectsstorage.ObjectStore
+	Delivery delivery.DeliveryStore
+}
+
+// NewPgStores returns the postgres implementations of all storages sharing one connection pool.
+func NewPgStores(storeDB *pgxpool.Pool) Stores {
+	return Stores{
+		Users:    userstorage.NewPgUserStore(storeDB),
+		Projects: projectstorage.NewPgProjectStore(storeDB),
+		Orders:   orderstorage.NewPgOrderStore(storeDB),
+		Objects:  objectsstorage.NewPgObjectStore(storeDB),
+		Delivery: delivery.NewPgDeliveryStore(storeDB),
+	}
+}
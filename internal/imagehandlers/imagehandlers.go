@@ -31,10 +31,18 @@ import (
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"github.com/SiberianMonster/memoryprint/internal/models"
 	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
-	"github.com/SiberianMonster/memoryprint/internal/userstorage"
-	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
 	_ "github.com/lib/pq"
 )
+
+// Handler serves the image endpoints on top of the storages.
+type Handler struct {
+	handlersfunc.Stores
+}
+
+// New returns a Handler using the given storages.
+func New(stores handlersfunc.Stores) *Handler {
+	return &Handler{Stores: stores}
+}
 const BINARY = "/usr/bin/inkscape"
 var imageContentTypes = map[string]string{
     "png":  "image/png",
@@ -337,7 +345,7 @@ func removeBackground(imgByte []byte, filename string, balaToken string) ([]byte
 	return imgByte, nil
 }
 
-func LoadImage(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadImage(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]ImageRespBody)
 	var imageObj models.UploadImage
@@ -437,7 +445,7 @@ func LoadImage(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func CreatePDFVisualization(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreatePDFVisualization(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]ImageRespBody)
 	var rBody ImageRespBody
@@ -451,7 +459,7 @@ func CreatePDFVisualization(rw http.ResponseWriter, r *http.Request) {
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Create project visualization %d for user %d",projectID, userID)
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
@@ -459,7 +467,7 @@ func CreatePDFVisualization(rw http.ResponseWriter, r *http.Request) {
 	}
 	
 	var leatherID *uint
-	pages, err := projectstorage.RetrieveProjectPages(ctx, config.DB, projectID, false, leatherID)
+	pages, err := h.Projects.RetrieveProjectPages(ctx, projectID, false, leatherID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
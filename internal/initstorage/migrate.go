@@ -0,0 +1,318 @@
+package initstorage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockID is the key of the postgres advisory lock held while migrations run,
+// so that replicas starting at the same time apply them one after another.
+const migrationLockID = int64(20240601)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration is a numbered pair of up and down sql scripts from the migrations directory.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState describes a known migration and whether it is applied to the database.
+type MigrationState struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the embedded migration files named NNNN_name.up.sql / NNNN_name.down.sql.
+func LoadMigrations() ([]Migration, error) {
+
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		parts := strings.SplitN(base, "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration file %s is not named NNNN_name.%s.sql", fileName, direction)
+		}
+		version, err := strconv.ParseUint(parts[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("migration file %s has an invalid version: %w", fileName, err)
+		}
+		content, err := migrationFiles.ReadFile(path.Join("migrations", fileName))
+		if err != nil {
+			return nil, err
+		}
+		m, ok := byVersion[uint(version)]
+		if !ok {
+			m = &Migration{Version: uint(version), Name: parts[1]}
+			byVersion[uint(version)] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("migration %d has different names: %s and %s", version, m.Name, parts[1])
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d has no up script", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withMigrationLock runs fn on a single connection holding the migration advisory lock.
+func withMigrationLock(ctx context.Context, db *pgxpool.Pool, fn func(conn *pgxpool.Conn) error) error {
+
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		log.Printf("Error happened when acquiring connection for migrations. Err: %s", err)
+		return err
+	}
+	defer conn.Release()
+
+	_, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1);", migrationLockID)
+	if err != nil {
+		log.Printf("Error happened when taking migration lock. Err: %s", err)
+		return err
+	}
+	defer func() {
+		_, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1);", migrationLockID)
+		if err != nil {
+			log.Printf("Error happened when releasing migration lock. Err: %s", err)
+		}
+	}()
+
+	_, err = conn.Exec(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version int PRIMARY KEY, name varchar NOT NULL, applied_at timestamp NOT NULL)")
+	if err != nil {
+		log.Printf("Error happened when creating schema_migrations table. Err: %s", err)
+		return err
+	}
+
+	return fn(conn)
+}
+
+// rowsQuerier is what the applied migrations are read with, the pool or the locked connection.
+type rowsQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, conn rowsQuerier) (map[uint]time.Time, error) {
+
+	applied := make(map[uint]time.Time)
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations;")
+	if err != nil {
+		log.Printf("Error happened when retrieving applied migrations. Err: %s", err)
+		return applied, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version uint
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			log.Printf("Error happened when scanning applied migrations. Err: %s", err)
+			return applied, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// MigrateUp applies every pending migration in version order and returns how many were applied.
+func MigrateUp(ctx context.Context, db *pgxpool.Pool) (int, error) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		log.Printf("Error happened when loading migrations. Err: %s", err)
+		return 0, err
+	}
+	var count int
+	err = withMigrationLock(ctx, db, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			log.Printf("Applying migration %04d_%s", m.Version, m.Name)
+			tx, err := conn.Begin(ctx)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ctx, m.Up); err != nil {
+				tx.Rollback(ctx)
+				log.Printf("Error happened when applying migration %04d_%s. Err: %s", m.Version, m.Name, err)
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3);", m.Version, m.Name, time.Now()); err != nil {
+				tx.Rollback(ctx)
+				return err
+			}
+			if err = tx.Commit(ctx); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrateDown rolls back the given number of most recently applied migrations.
+func MigrateDown(ctx context.Context, db *pgxpool.Pool, steps int) (int, error) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		log.Printf("Error happened when loading migrations. Err: %s", err)
+		return 0, err
+	}
+	var count int
+	err = withMigrationLock(ctx, db, func(conn *pgxpool.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && count < steps; i-- {
+			m := migrations[i]
+			if _, ok := applied[m.Version]; !ok {
+				continue
+			}
+			if m.Down == "" {
+				return fmt.Errorf("migration %04d_%s has no down script", m.Version, m.Name)
+			}
+			log.Printf("Rolling back migration %04d_%s", m.Version, m.Name)
+			tx, err := conn.Begin(ctx)
+			if err != nil {
+				return err
+			}
+			if _, err = tx.Exec(ctx, m.Down); err != nil {
+				tx.Rollback(ctx)
+				log.Printf("Error happened when rolling back migration %04d_%s. Err: %s", m.Version, m.Name, err)
+				return fmt.Errorf("migration %04d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = ($1);", m.Version); err != nil {
+				tx.Rollback(ctx)
+				return err
+			}
+			if err = tx.Commit(ctx); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// MigrationStatus lists all known migrations with the time each one was applied, if it was.
+func MigrationStatus(ctx context.Context, db *pgxpool.Pool) ([]MigrationState, error) {
+
+	var states []MigrationState
+	migrations, err := LoadMigrations()
+	if err != nil {
+		log.Printf("Error happened when loading migrations. Err: %s", err)
+		return states, err
+	}
+	// the status is read without the migration lock, so it does not wait for a migration being applied
+	var exists bool
+	err = db.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL;").Scan(&exists)
+	if err != nil {
+		log.Printf("Error happened when checking schema_migrations table. Err: %s", err)
+		return states, err
+	}
+	applied := make(map[uint]time.Time)
+	if exists {
+		applied, err = appliedVersions(ctx, db)
+		if err != nil {
+			return states, err
+		}
+	}
+	for _, m := range migrations {
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := applied[m.Version]; ok {
+			state.AppliedAt = &appliedAt
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// ErrUnknownMigrateCommand is returned by RunMigrateCommand for anything but up, down and status.
+var ErrUnknownMigrateCommand = errors.New("unknown migrate command, expected up, down [steps] or status")
+
+// RunMigrateCommand executes the "migrate up|down [steps]|status" command line and returns printable output.
+func RunMigrateCommand(ctx context.Context, db *pgxpool.Pool, args []string) (string, error) {
+
+	if len(args) == 0 {
+		return "", ErrUnknownMigrateCommand
+	}
+	switch args[0] {
+	case "up":
+		count, err := MigrateUp(ctx, db)
+		return fmt.Sprintf("applied %d migration(s)", count), err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			parsed, err := strconv.Atoi(args[1])
+			if err != nil || parsed < 1 {
+				return "", fmt.Errorf("invalid number of steps %q", args[1])
+			}
+			steps = parsed
+		}
+		count, err := MigrateDown(ctx, db, steps)
+		return fmt.Sprintf("rolled back %d migration(s)", count), err
+	case "status":
+		states, err := MigrationStatus(ctx, db)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(&sb, "%04d_%s\t%s\n", state.Version, state.Name, applied)
+		}
+		return sb.String(), nil
+	}
+	return "", ErrUnknownMigrateCommand
+}
@@ -0,0 +1,68 @@
+package initstorage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/dbtest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when loading migrations", err)
+	}
+	for i, m := range migrations {
+		if m.Version != uint(i+1) {
+			t.Errorf("expected migration %d to have version %d, got %d", i, i+1, m.Version)
+		}
+		if m.Up == "" || m.Down == "" {
+			t.Errorf("expected migration %04d_%s to have both scripts", m.Version, m.Name)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+
+	db := dbtest.Connect(t)
+	ctx := context.Background()
+	migrations, _ := LoadMigrations()
+
+	states, err := MigrationStatus(ctx, db)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when reading the status of an empty database", err)
+	}
+	for _, s := range states {
+		if s.AppliedAt != nil {
+			t.Fatalf("expected no migration to be applied to an empty database, got %04d_%s", s.Version, s.Name)
+		}
+	}
+
+	count, err := MigrateUp(ctx, db)
+	if err != nil || count != len(migrations) {
+		t.Fatalf("expected all %d migrations to be applied, got %d, %v", len(migrations), count, err)
+	}
+	if count, err = MigrateUp(ctx, db); err != nil || count != 0 {
+		t.Fatalf("expected nothing to be applied twice, got %d, %v", count, err)
+	}
+	states, _ = MigrationStatus(ctx, db)
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %04d_%s to be applied", s.Version, s.Name)
+		}
+	}
+
+	// every down script has to undo its up script, so the schema can be rolled back and built again
+	if count, err = MigrateDown(ctx, db, len(migrations)); err != nil || count != len(migrations) {
+		t.Fatalf("expected all %d migrations to be rolled back, got %d, %v", len(migrations), count, err)
+	}
+	var tables int
+	db.QueryRow(ctx, "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations';").Scan(&tables)
+	if tables != 0 {
+		t.Errorf("expected the rollback to drop all tables, %d left", tables)
+	}
+	if count, err = MigrateUp(ctx, db); err != nil || count != len(migrations) {
+		t.Fatalf("expected all %d migrations to be applied again, got %d, %v", len(migrations), count, err)
+	}
+}
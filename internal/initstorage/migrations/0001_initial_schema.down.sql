@@ -0,0 +1,26 @@
+DROP TABLE IF EXISTS delivery;
+DROP TABLE IF EXISTS orders_has_transactions;
+DROP TABLE IF EXISTS giftcertificates_has_transactions;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS orders_has_projects;
+DROP TABLE IF EXISTS orders;
+DROP TABLE IF EXISTS giftcertificates;
+DROP TABLE IF EXISTS promooffers;
+DROP TABLE IF EXISTS leather;
+DROP TABLE IF EXISTS prices;
+DROP TABLE IF EXISTS users_has_layouts;
+DROP TABLE IF EXISTS users_has_backgrounds;
+DROP TABLE IF EXISTS users_has_decoration;
+DROP TABLE IF EXISTS page_has_photos;
+DROP TABLE IF EXISTS project_has_pages;
+DROP TABLE IF EXISTS users_edit_projects;
+DROP TABLE IF EXISTS pages;
+DROP TABLE IF EXISTS albums;
+DROP TABLE IF EXISTS templates;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS decorations;
+DROP TABLE IF EXISTS layouts;
+DROP TABLE IF EXISTS backgrounds;
+DROP TABLE IF EXISTS photos;
+DROP TABLE IF EXISTS verifications;
+DROP TABLE IF EXISTS users;
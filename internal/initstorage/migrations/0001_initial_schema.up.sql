@@ -0,0 +1,60 @@
+-- Baseline schema. Uses IF NOT EXISTS so databases created before the
+-- migration runner existed are adopted without changes.
+
+CREATE TABLE IF NOT EXISTS users (users_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, username varchar NOT NULL, password varchar NOT NULL, email varchar NOT NULL, tokenhash varchar, category varchar NOT NULL, isverified varchar NOT NULL, subscription boolean NOT NULL, status varchar NOT NULL, last_edited_at timestamp NOT NULL, created_at timestamp NOT NULL);
+
+CREATE TABLE IF NOT EXISTS verifications (verifications_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, email varchar NOT NULL, code  varchar NOT NULL, expires_at timestamp NOT NULL, type int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS photos (photos_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, link varchar NOT NULL, small_image varchar, uploaded_at timestamp NOT NULL, users_id int REFERENCES users(users_id));
+
+CREATE TABLE IF NOT EXISTS backgrounds (backgrounds_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, link varchar NOT NULL, small_image varchar, category varchar);
+
+CREATE TABLE IF NOT EXISTS layouts (layouts_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, count_images int NOT NULL, link varchar NOT NULL, small_image varchar, size varchar NOT NULL, data text NOT NULL);
+
+CREATE TABLE IF NOT EXISTS decorations (decorations_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, small_image varchar, link varchar NOT NULL, type varchar, category varchar);
+
+CREATE TABLE IF NOT EXISTS projects (projects_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name varchar, category varchar, size varchar NOT NULL, variant varchar NOT NULL, cover varchar NOT NULL, paper varchar NOT NULL, preview_image_link varchar, count_pages int, status varchar NOT NULL, last_edited_at timestamp NOT NULL, last_editor int, created_at timestamp NOT NULL, preview_link varchar, print_link varchar, creating_spine_link varchar, preview_spine_link varchar, leather_id int, users_id int REFERENCES users(users_id));
+
+CREATE TABLE IF NOT EXISTS templates (templates_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name varchar, status varchar NOT NULL, category varchar, size varchar, creating_spine_link varchar, preview_spine_link varchar, last_edited_at timestamp NOT NULL, last_editor int, created_at timestamp NOT NULL);
+
+CREATE TABLE IF NOT EXISTS albums (albums_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name varchar, last_edited_at timestamp NOT NULL, created_at timestamp NOT NULL, users_id int REFERENCES users(users_id));
+
+CREATE TABLE IF NOT EXISTS pages (pages_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, is_template boolean NOT NULL, last_edited_at timestamp NOT NULL, data text, sort int, preview_link varchar, creating_image_link varchar, type varchar, projects_id int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users_edit_projects (users_id int, email varchar, projects_id int NOT NULL, category varchar NOT NULL);
+
+CREATE TABLE IF NOT EXISTS project_has_pages (projects_id int NOT NULL, pages_id int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS page_has_photos (pages_id int NOT NULL, photos_id int NOT NULL, ptop double precision, pleft double precision, style varchar, last_edited_at timestamp NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users_has_decoration (users_id int NOT NULL, decorations_id int NOT NULL, is_favourite boolean NOT NULL, is_personal boolean NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users_has_backgrounds (users_id int NOT NULL, backgrounds_id int NOT NULL, is_favourite boolean NOT NULL, is_personal boolean NOT NULL);
+
+CREATE TABLE IF NOT EXISTS users_has_layouts (users_id int NOT NULL, layouts_id int NOT NULL, is_favourite boolean NOT NULL);
+
+CREATE TABLE IF NOT EXISTS prices (prices_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, cover varchar NOT NULL, variant varchar NOT NULL, surface varchar NOT NULL, size varchar NOT NULL, baseprice double precision NOT NULL, extrapage double precision NOT NULL);
+
+CREATE TABLE IF NOT EXISTS leather (leather_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, colourlink varchar NOT NULL, hexcode varchar NOT NULL, description varchar);
+
+CREATE TABLE IF NOT EXISTS promooffers (promooffers_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, code varchar NOT NULL UNIQUE, discount double precision NOT NULL, category varchar NOT NULL, is_onetime boolean, is_used boolean, expires_at int NOT NULL, used_at timestamp, is_personal boolean, users_id int);
+
+CREATE TABLE IF NOT EXISTS giftcertificates (giftcertificates_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, code varchar NOT NULL UNIQUE, initialdeposit float NOT NULL, status varchar NOT NULL, currentdeposit float NOT NULL, created_at timestamp NOT NULL, used_at timestamp, receipientemail varchar NOT NULL, reciepientname varchar NOT NULL, buyerfirstname varchar NOT NULL, buyerlastname varchar NOT NULL, buyeremail varchar NOT NULL, buyerphone varchar NOT NULL, mail_at int NOT NULL, mail_sent boolean);
+
+CREATE TABLE IF NOT EXISTS orders (orders_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, status varchar NOT NULL, created_at timestamp NOT NULL, last_updated_at timestamp NOT NULL, firstname varchar, lastname varchar, email varchar, phone varchar, commentary varchar, baseprice double precision, finalprice double precision, videolink varchar, package_box bool, promooffers_id int, giftcertificates_id int, giftcertificates_deposit float, delivery_id int, users_id int);
+
+CREATE TABLE IF NOT EXISTS orders_has_projects (orders_id int NOT NULL, projects_id int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS transactions (transactions_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, status varchar NOT NULL, created_at timestamp NOT NULL, paymentmethod varchar NOT NULL, amount double precision NOT NULL, bankorderid varchar NOT NULL, bankstatus varchar);
+
+CREATE TABLE IF NOT EXISTS giftcertificates_has_transactions (giftcertificates_id int NOT NULL, transactions_id int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS orders_has_transactions (orders_id int NOT NULL, transactions_id int NOT NULL);
+
+CREATE TABLE IF NOT EXISTS delivery (delivery_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, status varchar NOT NULL, created_at timestamp NOT NULL, expected_delivery_from timestamp, expected_delivery_to timestamp, method varchar NOT NULL, address varchar, postal_code varchar, code varchar, amount double precision NOT NULL, deliveryid varchar, trackingnumber varchar, deliverystatus varchar);
+
+-- columns that used to be added by hand on older deployments
+ALTER TABLE photos ADD COLUMN IF NOT EXISTS small_image varchar;
+ALTER TABLE promooffers ADD COLUMN IF NOT EXISTS category varchar;
+ALTER TABLE promooffers ADD COLUMN IF NOT EXISTS users_id int;
+ALTER TABLE promooffers ADD COLUMN IF NOT EXISTS expires_at int;
@@ -0,0 +1,5 @@
+-- Refunds issued for paid orders, one row per refund of the original transaction.
+
+CREATE TABLE refunds (refunds_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, orders_id int NOT NULL, transactions_id int NOT NULL, amount double precision NOT NULL, reason varchar, status varchar NOT NULL, created_at timestamp NOT NULL, completed_at timestamp);
+
+CREATE INDEX refunds_orders_id_idx ON refunds (orders_id);
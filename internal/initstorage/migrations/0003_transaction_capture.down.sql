@@ -0,0 +1,2 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS capture_error;
+ALTER TABLE transactions DROP COLUMN IF EXISTS captured_at;
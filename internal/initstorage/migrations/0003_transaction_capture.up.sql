@@ -0,0 +1,4 @@
+-- Outcome of capturing the pre-authorized amount when the order goes to print.
+
+ALTER TABLE transactions ADD COLUMN captured_at timestamp;
+ALTER TABLE transactions ADD COLUMN capture_error varchar;
@@ -0,0 +1,5 @@
+-- Fiscal receipts (54-FZ) sent to the acquirer with every payment and refund, kept for admins to re-send.
+
+CREATE TABLE receipts (receipts_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, transactions_id int NOT NULL, refunds_id int, type varchar NOT NULL, email varchar, amount double precision NOT NULL, content jsonb NOT NULL, created_at timestamp NOT NULL, sent_at timestamp);
+
+CREATE INDEX receipts_transactions_id_idx ON receipts (transactions_id);
@@ -0,0 +1,7 @@
+ALTER TABLE receipts ALTER COLUMN amount TYPE double precision;
+ALTER TABLE refunds ALTER COLUMN amount TYPE double precision;
+ALTER TABLE delivery ALTER COLUMN amount TYPE double precision;
+ALTER TABLE transactions ALTER COLUMN amount TYPE double precision;
+ALTER TABLE orders ALTER COLUMN baseprice TYPE double precision, ALTER COLUMN finalprice TYPE double precision, ALTER COLUMN giftcertificates_deposit TYPE float;
+ALTER TABLE giftcertificates ALTER COLUMN initialdeposit TYPE float, ALTER COLUMN currentdeposit TYPE float;
+ALTER TABLE prices ALTER COLUMN baseprice TYPE double precision, ALTER COLUMN extrapage TYPE double precision;
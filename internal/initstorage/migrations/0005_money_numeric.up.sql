@@ -0,0 +1,9 @@
+-- Money is stored in roubles with exact kopecks instead of floating point.
+
+ALTER TABLE prices ALTER COLUMN baseprice TYPE numeric(12,2) USING round(baseprice::numeric, 2), ALTER COLUMN extrapage TYPE numeric(12,2) USING round(extrapage::numeric, 2);
+ALTER TABLE giftcertificates ALTER COLUMN initialdeposit TYPE numeric(12,2) USING round(initialdeposit::numeric, 2), ALTER COLUMN currentdeposit TYPE numeric(12,2) USING round(currentdeposit::numeric, 2);
+ALTER TABLE orders ALTER COLUMN baseprice TYPE numeric(12,2) USING round(baseprice::numeric, 2), ALTER COLUMN finalprice TYPE numeric(12,2) USING round(finalprice::numeric, 2), ALTER COLUMN giftcertificates_deposit TYPE numeric(12,2) USING round(giftcertificates_deposit::numeric, 2);
+ALTER TABLE transactions ALTER COLUMN amount TYPE numeric(12,2) USING round(amount::numeric, 2);
+ALTER TABLE delivery ALTER COLUMN amount TYPE numeric(12,2) USING round(amount::numeric, 2);
+ALTER TABLE refunds ALTER COLUMN amount TYPE numeric(12,2) USING round(amount::numeric, 2);
+ALTER TABLE receipts ALTER COLUMN amount TYPE numeric(12,2) USING round(amount::numeric, 2);
@@ -0,0 +1,5 @@
+-- Every order status change with who made it and why; orders.status holds the latest one.
+
+CREATE TABLE order_status_history (order_status_history_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, orders_id int NOT NULL, from_status varchar, to_status varchar NOT NULL, actor varchar NOT NULL, users_id int, reason text, created_at timestamp NOT NULL);
+
+CREATE INDEX order_status_history_orders_id_idx ON order_status_history (orders_id);
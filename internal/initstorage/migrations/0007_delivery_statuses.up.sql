@@ -0,0 +1,5 @@
+-- Every status CDEK reports for a shipment, delivery.deliverystatus keeps only the latest code.
+
+CREATE TABLE delivery_statuses (delivery_statuses_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, delivery_id int NOT NULL, code varchar NOT NULL, name varchar, city varchar, happened_at timestamp NOT NULL);
+
+CREATE UNIQUE INDEX delivery_statuses_event_idx ON delivery_statuses (delivery_id, code, happened_at);
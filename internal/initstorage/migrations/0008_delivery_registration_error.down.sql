@@ -0,0 +1 @@
+ALTER TABLE delivery DROP COLUMN IF EXISTS registration_error;
@@ -0,0 +1,3 @@
+-- Why CDEK rejected the shipment of the order, cleared once the shipment is registered again.
+
+ALTER TABLE delivery ADD COLUMN registration_error varchar;
@@ -0,0 +1,6 @@
+-- Local copy of the carrier pickup points and postamats, refreshed by the delivery points routine.
+
+CREATE TABLE delivery_points (code varchar PRIMARY KEY, name varchar, type varchar NOT NULL, city varchar, postal_code varchar, address varchar, latitude double precision, longitude double precision, work_time varchar, refreshed_at timestamp NOT NULL);
+
+CREATE INDEX delivery_points_city_idx ON delivery_points (lower(city));
+CREATE INDEX delivery_points_postal_code_idx ON delivery_points (postal_code);
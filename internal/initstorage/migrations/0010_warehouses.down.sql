@@ -0,0 +1,2 @@
+ALTER TABLE delivery DROP COLUMN IF EXISTS warehouses_id;
+DROP TABLE IF EXISTS warehouses;
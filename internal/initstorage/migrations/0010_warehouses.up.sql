@@ -0,0 +1,9 @@
+-- Warehouses of the print partners the orders are shipped from, each delivery is assigned one as its origin.
+
+CREATE TABLE warehouses (warehouses_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name varchar NOT NULL, partner varchar, postal_code varchar NOT NULL, city varchar NOT NULL, address varchar NOT NULL, city_code int NOT NULL, work_time varchar, latitude double precision, longitude double precision, is_active bool NOT NULL DEFAULT true, created_at timestamp NOT NULL, last_edited_at timestamp NOT NULL);
+
+INSERT INTO warehouses (name, partner, postal_code, city, address, city_code, work_time, latitude, longitude, created_at, last_edited_at) VALUES ('Москва', 'memoryprint', '129323', 'Москва', 'проезд Серебрякова, 7', 44, 'Пн-Пт 10:00-19:00', 55.8547, 37.6535, now(), now());
+
+ALTER TABLE delivery ADD COLUMN warehouses_id int REFERENCES warehouses(warehouses_id);
+
+UPDATE delivery SET warehouses_id = (SELECT min(warehouses_id) FROM warehouses);
@@ -0,0 +1,5 @@
+-- Print forms of the shipments, the waybills and the barcode labels, kept in the object storage under their links.
+
+CREATE TABLE shipping_documents (shipping_documents_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, delivery_id int NOT NULL REFERENCES delivery(delivery_id), form varchar NOT NULL, link varchar NOT NULL, created_at timestamp NOT NULL);
+
+CREATE UNIQUE INDEX shipping_documents_form_idx ON shipping_documents (delivery_id, form);
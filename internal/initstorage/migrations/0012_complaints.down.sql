@@ -0,0 +1,3 @@
+ALTER TABLE warehouses DROP COLUMN IF EXISTS phone;
+ALTER TABLE orders DROP COLUMN IF EXISTS original_orders_id;
+DROP TABLE IF EXISTS complaints;
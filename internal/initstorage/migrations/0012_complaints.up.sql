@@ -0,0 +1,9 @@
+-- Complaints of the customers about delivered orders, resolved with a free reprint, a refund or a return shipment to the warehouse.
+
+CREATE TABLE complaints (complaints_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, orders_id int NOT NULL REFERENCES orders(orders_id), users_id int NOT NULL, reason varchar NOT NULL, description varchar NOT NULL, photos varchar[], status varchar NOT NULL, resolution_comment varchar, reprint_orders_id int REFERENCES orders(orders_id), refunds_id int REFERENCES refunds(refunds_id), return_deliveryid varchar, created_at timestamp NOT NULL, resolved_at timestamp);
+
+CREATE INDEX complaints_orders_idx ON complaints (orders_id);
+
+ALTER TABLE orders ADD COLUMN original_orders_id int REFERENCES orders(orders_id);
+
+ALTER TABLE warehouses ADD COLUMN phone varchar;
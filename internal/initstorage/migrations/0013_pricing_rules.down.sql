@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS volume_discounts;
+ALTER TABLE prices DROP COLUMN IF EXISTS included_pages, DROP COLUMN IF EXISTS page_step, DROP COLUMN IF EXISTS min_pages, DROP COLUMN IF EXISTS max_pages, DROP COLUMN IF EXISTS leather_surcharge, DROP COLUMN IF EXISTS package_box_fee;
@@ -0,0 +1,6 @@
+-- Pricing rules of the catalog: pages included in the base price, the step extra pages are sold in, the page limits,
+-- the surcharge for a leather colour and the package box fee, and the volume discounts of the orders with several books.
+
+ALTER TABLE prices ADD COLUMN included_pages int NOT NULL DEFAULT 23, ADD COLUMN page_step int NOT NULL DEFAULT 1, ADD COLUMN min_pages int NOT NULL DEFAULT 0, ADD COLUMN max_pages int NOT NULL DEFAULT 0, ADD COLUMN leather_surcharge numeric(12,2) NOT NULL DEFAULT 0, ADD COLUMN package_box_fee numeric(12,2) NOT NULL DEFAULT 0;
+
+CREATE TABLE volume_discounts (volume_discounts_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, min_books int NOT NULL UNIQUE, discount double precision NOT NULL);
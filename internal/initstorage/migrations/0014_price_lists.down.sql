@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS order_items_immutable ON order_items;
+DROP FUNCTION IF EXISTS order_items_immutable();
+DROP TABLE IF EXISTS order_items;
+ALTER TABLE orders DROP COLUMN IF EXISTS price_lists_id;
+DELETE FROM volume_discounts WHERE price_lists_id <> (SELECT price_lists_id FROM price_lists WHERE effective_from <= now() ORDER BY effective_from DESC, price_lists_id DESC LIMIT 1);
+ALTER TABLE volume_discounts DROP CONSTRAINT IF EXISTS volume_discounts_price_lists_min_books_key, ADD CONSTRAINT volume_discounts_min_books_key UNIQUE (min_books);
+ALTER TABLE volume_discounts DROP COLUMN IF EXISTS price_lists_id;
+DELETE FROM prices WHERE price_lists_id <> (SELECT price_lists_id FROM price_lists WHERE effective_from <= now() ORDER BY effective_from DESC, price_lists_id DESC LIMIT 1);
+ALTER TABLE prices DROP COLUMN IF EXISTS price_lists_id;
+DROP TABLE IF EXISTS price_lists;
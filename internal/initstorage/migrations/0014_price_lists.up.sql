@@ -0,0 +1,30 @@
+-- Versioned price lists in effect from their effective_from, the prices and the volume discounts belong to a list.
+-- The prices set before are kept as the initial list. The orders keep the line items they were priced with at the checkout.
+
+CREATE TABLE price_lists (price_lists_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, name varchar NOT NULL, effective_from timestamp NOT NULL, created_at timestamp NOT NULL);
+
+INSERT INTO price_lists (name, effective_from, created_at) VALUES ('Initial', '1970-01-01', now());
+
+ALTER TABLE prices ADD COLUMN price_lists_id int REFERENCES price_lists(price_lists_id) ON DELETE CASCADE;
+UPDATE prices SET price_lists_id = (SELECT min(price_lists_id) FROM price_lists);
+ALTER TABLE prices ALTER COLUMN price_lists_id SET NOT NULL;
+CREATE INDEX prices_price_lists_idx ON prices (price_lists_id);
+
+ALTER TABLE volume_discounts ADD COLUMN price_lists_id int REFERENCES price_lists(price_lists_id) ON DELETE CASCADE;
+UPDATE volume_discounts SET price_lists_id = (SELECT min(price_lists_id) FROM price_lists);
+ALTER TABLE volume_discounts ALTER COLUMN price_lists_id SET NOT NULL;
+ALTER TABLE volume_discounts DROP CONSTRAINT volume_discounts_min_books_key, ADD CONSTRAINT volume_discounts_price_lists_min_books_key UNIQUE (price_lists_id, min_books);
+
+ALTER TABLE orders ADD COLUMN price_lists_id int REFERENCES price_lists(price_lists_id);
+
+CREATE TABLE order_items (order_items_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, orders_id int NOT NULL REFERENCES orders(orders_id), code varchar NOT NULL, projects_id int, size varchar, variant varchar, cover varchar, surface varchar, count_pages int, quantity int NOT NULL, unit_price numeric(12,2) NOT NULL, amount numeric(12,2) NOT NULL, discount numeric(12,2) NOT NULL DEFAULT 0);
+
+CREATE INDEX order_items_orders_idx ON order_items (orders_id);
+
+CREATE FUNCTION order_items_immutable() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'order items are not changed after the checkout';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER order_items_immutable BEFORE UPDATE ON order_items FOR EACH ROW EXECUTE FUNCTION order_items_immutable();
@@ -0,0 +1,5 @@
+INSERT INTO orders (status, created_at, last_updated_at, users_id) SELECT 'AWAITING_PAYMENT', created_at, last_updated_at, users_id FROM carts;
+INSERT INTO orders_has_projects (orders_id, projects_id) SELECT o.orders_id, ci.projects_id FROM cart_items ci JOIN carts c ON c.carts_id = ci.carts_id JOIN orders o ON o.users_id = c.users_id AND o.status = 'AWAITING_PAYMENT';
+ALTER TABLE orders_has_projects DROP COLUMN IF EXISTS quantity;
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS carts;
@@ -0,0 +1,16 @@
+-- Carts of the customers with the copies of every project, the orders keep the copies of the projects they were placed with.
+-- The projects of the orders awaiting payment, which served as the carts before, are moved to the carts.
+
+CREATE TABLE carts (carts_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, users_id int NOT NULL UNIQUE REFERENCES users(users_id) ON DELETE CASCADE, created_at timestamp NOT NULL, last_updated_at timestamp NOT NULL);
+
+CREATE TABLE cart_items (cart_items_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, carts_id int NOT NULL REFERENCES carts(carts_id) ON DELETE CASCADE, projects_id int NOT NULL REFERENCES projects(projects_id) ON DELETE CASCADE, quantity int NOT NULL CHECK (quantity > 0), created_at timestamp NOT NULL, UNIQUE (carts_id, projects_id));
+
+CREATE INDEX cart_items_projects_idx ON cart_items (projects_id);
+
+ALTER TABLE orders_has_projects ADD COLUMN quantity int NOT NULL DEFAULT 1 CHECK (quantity > 0);
+
+INSERT INTO carts (users_id, created_at, last_updated_at) SELECT users_id, min(created_at), max(last_updated_at) FROM orders WHERE status = 'AWAITING_PAYMENT' AND users_id IS NOT NULL GROUP BY users_id;
+INSERT INTO cart_items (carts_id, projects_id, quantity, created_at) SELECT DISTINCT ON (c.carts_id, op.projects_id) c.carts_id, op.projects_id, 1, o.created_at FROM orders o JOIN orders_has_projects op ON op.orders_id = o.orders_id JOIN carts c ON c.users_id = o.users_id JOIN projects p ON p.projects_id = op.projects_id WHERE o.status = 'AWAITING_PAYMENT' ORDER BY c.carts_id, op.projects_id, o.created_at;
+DELETE FROM orders_has_projects WHERE orders_id IN (SELECT orders_id FROM orders WHERE status = 'AWAITING_PAYMENT');
+DELETE FROM order_status_history WHERE orders_id IN (SELECT orders_id FROM orders WHERE status = 'AWAITING_PAYMENT');
+DELETE FROM orders WHERE status = 'AWAITING_PAYMENT';
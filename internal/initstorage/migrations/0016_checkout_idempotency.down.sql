@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS payment_link;
+DROP INDEX IF EXISTS orders_idempotency_key_idx;
+ALTER TABLE orders DROP COLUMN IF EXISTS idempotency_key;
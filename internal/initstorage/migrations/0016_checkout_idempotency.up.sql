@@ -0,0 +1,7 @@
+-- Idempotency keys of the checkouts, a repeated checkout returns the order and the payment link of the first one.
+
+ALTER TABLE orders ADD COLUMN idempotency_key varchar;
+
+CREATE UNIQUE INDEX orders_idempotency_key_idx ON orders (users_id, idempotency_key) WHERE idempotency_key IS NOT NULL;
+
+ALTER TABLE transactions ADD COLUMN payment_link varchar;
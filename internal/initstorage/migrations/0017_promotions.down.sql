@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS promotion_redemptions;
+ALTER TABLE promooffers DROP COLUMN IF EXISTS discount_type, DROP COLUMN IF EXISTS amount, DROP COLUMN IF EXISTS min_order_value, DROP COLUMN IF EXISTS max_redemptions, DROP COLUMN IF EXISTS per_user_limit, DROP COLUMN IF EXISTS starts_at, DROP COLUMN IF EXISTS sizes, DROP COLUMN IF EXISTS variants, DROP COLUMN IF EXISTS covers, DROP COLUMN IF EXISTS excludes_certificate;
@@ -0,0 +1,14 @@
+-- Promotion rules of the promocodes: percent, fixed amount and free shipping discounts, the minimum order value, the limits
+-- of the redemptions in total and per customer, the start date, the books the code applies to and whether it stacks with
+-- a gift certificate. Every redemption of a code is recorded, the one-time codes become codes of a single redemption.
+
+ALTER TABLE promooffers ADD COLUMN discount_type varchar NOT NULL DEFAULT 'PERCENT' CHECK (discount_type IN ('PERCENT', 'FIXED', 'FREE_SHIPPING')), ADD COLUMN amount numeric(12,2) NOT NULL DEFAULT 0, ADD COLUMN min_order_value numeric(12,2) NOT NULL DEFAULT 0, ADD COLUMN max_redemptions int NOT NULL DEFAULT 0, ADD COLUMN per_user_limit int NOT NULL DEFAULT 0, ADD COLUMN starts_at int NOT NULL DEFAULT 0, ADD COLUMN sizes varchar[] NOT NULL DEFAULT '{}', ADD COLUMN variants varchar[] NOT NULL DEFAULT '{}', ADD COLUMN covers varchar[] NOT NULL DEFAULT '{}', ADD COLUMN excludes_certificate boolean NOT NULL DEFAULT false;
+
+UPDATE promooffers SET max_redemptions = 1 WHERE COALESCE(is_onetime, false);
+
+CREATE TABLE promotion_redemptions (promotion_redemptions_id int GENERATED ALWAYS AS IDENTITY PRIMARY KEY, promooffers_id int NOT NULL REFERENCES promooffers(promooffers_id) ON DELETE CASCADE, users_id int, orders_id int UNIQUE REFERENCES orders(orders_id), status varchar NOT NULL CHECK (status IN ('RESERVED', 'REDEEMED', 'RELEASED')), discount numeric(12,2) NOT NULL DEFAULT 0, created_at timestamp NOT NULL, redeemed_at timestamp, released_at timestamp);
+
+CREATE INDEX promotion_redemptions_promooffers_idx ON promotion_redemptions (promooffers_id, status);
+
+INSERT INTO promotion_redemptions (promooffers_id, users_id, orders_id, status, discount, created_at, redeemed_at, released_at) SELECT o.promooffers_id, o.users_id, o.orders_id, CASE WHEN o.status = 'PAYMENT_IN_PROGRESS' THEN 'RESERVED' WHEN o.status IN ('CANCELLED', 'REFUNDED', 'AWAITING_PAYMENT') THEN 'RELEASED' ELSE 'REDEEMED' END, GREATEST(COALESCE(o.baseprice, 0) + COALESCE(d.amount, 0) - COALESCE(o.finalprice, 0) - COALESCE(o.giftcertificates_deposit, 0), 0), o.created_at, CASE WHEN o.status NOT IN ('PAYMENT_IN_PROGRESS', 'CANCELLED', 'REFUNDED', 'AWAITING_PAYMENT') THEN o.last_updated_at END, CASE WHEN o.status IN ('CANCELLED', 'REFUNDED', 'AWAITING_PAYMENT') THEN o.last_updated_at END FROM orders o JOIN promooffers p ON p.promooffers_id = o.promooffers_id LEFT JOIN delivery d ON d.delivery_id = o.delivery_id;
+INSERT INTO promotion_redemptions (promooffers_id, users_id, status, created_at, redeemed_at) SELECT p.promooffers_id, NULLIF(p.users_id, 0), 'REDEEMED', COALESCE(p.used_at, now()), COALESCE(p.used_at, now()) FROM promooffers p WHERE COALESCE(p.is_used, false) AND NOT EXISTS (SELECT 1 FROM promotion_redemptions r WHERE r.promooffers_id = p.promooffers_id AND r.status = 'REDEEMED');
@@ -0,0 +1,3 @@
+-- Outcome of reversing the amount the bank holds for an order which no longer takes it, e.g. paid after it expired.
+
+ALTER TABLE transactions ADD COLUMN reverse_error varchar;
@@ -0,0 +1,402 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+)
+
+// DeliveryStore is the in-memory implementation of delivery.DeliveryStore.
+type DeliveryStore struct {
+	db *DB
+}
+
+var _ delivery.DeliveryStore = (*DeliveryStore)(nil)
+
+// NewDeliveryStore returns a DeliveryStore backed by db.
+func NewDeliveryStore(db *DB) *DeliveryStore {
+	return &DeliveryStore{db: db}
+}
+
+// orderDelivery returns the delivery row of the order.
+func (db *DB) orderDelivery(orderID uint) (*deliveryRow, error) {
+	o, ok := db.orders[orderID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	d, ok := db.deliveries[o.DeliveryID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return d, nil
+}
+
+func (s *DeliveryStore) LoadActiveDeliveries(ctx context.Context) ([]uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orders []uint
+	for _, id := range sortedIDs(s.db.orders) {
+		if s.db.orders[id].Status == "IN_DELIVERY" {
+			orders = append(orders, id)
+		}
+	}
+	return orders, nil
+}
+
+func (s *DeliveryStore) LoadApiDelivery(ctx context.Context, orderID uint) (models.ResponseApiDeliveryInfo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orderObj models.ResponseApiDeliveryInfo
+	if o, ok := s.db.orders[orderID]; ok {
+		orderObj.ContactData = o.Contacts
+	}
+	if d, err := s.db.orderDelivery(orderID); err == nil {
+		orderObj.Method = d.Method
+		orderObj.Address = d.Address
+		orderObj.Code = d.Code
+		orderObj.PostalCode = d.PostalCode
+		orderObj.DeliveryStatus = d.DeliveryStatus
+		orderObj.Amount = d.Amount
+		orderObj.DeliveryID = d.DeliveryID
+		orderObj.TrackingNumber = d.TrackingNumber
+		if w, ok := s.db.warehouses[d.WarehouseID]; ok {
+			orderObj.Origin = *w
+		}
+	}
+	copyIDs := s.db.orderCopyIDs(orderID)
+	orderObj.Projects = uint(len(copyIDs))
+	if o, ok := s.db.orders[orderID]; ok {
+		orderObj.PackageBox = o.PackageBox
+	}
+	orderObj.Books = s.db.shippedBooks(copyIDs)
+	return orderObj, nil
+}
+
+func (s *DeliveryStore) AddDeliveryID(ctx context.Context, orderID uint, uuid string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return err
+	}
+	d.DeliveryID = uuid
+	d.Status = "IN PROGRESS"
+	d.RegistrationError = ""
+	d.TrackingNumber = ""
+	d.DeliveryStatus = ""
+	return nil
+}
+
+func (s *DeliveryStore) FindDeliveryUUID(ctx context.Context, orderID uint) (uint, string, string, string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return 0, "", "", "", err
+	}
+	return d.ID, d.DeliveryID, d.DeliveryStatus, d.TrackingNumber, nil
+}
+
+func (s *DeliveryStore) UpdateTrackingNumber(ctx context.Context, deliveryID uint, dtrackingNumber string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if d, ok := s.db.deliveries[deliveryID]; ok {
+		d.TrackingNumber = dtrackingNumber
+	}
+	return nil
+}
+
+func (s *DeliveryStore) UpdateDeliveryStatus(ctx context.Context, deliveryID uint, dstatus string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, ok := s.db.deliveries[deliveryID]
+	if !ok {
+		return nil
+	}
+	d.DeliveryStatus = dstatus
+	if dstatus == "DELIVERED" {
+		d.Status = "COMPLETED"
+	}
+	return nil
+}
+
+func (s *DeliveryStore) AddDeliveryStatuses(ctx context.Context, deliveryID uint, statuses []models.DeliveryStatusEvent) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, ok := s.db.deliveries[deliveryID]
+	if !ok {
+		return nil
+	}
+	for _, status := range statuses {
+		stored := false
+		for _, known := range d.Statuses {
+			stored = stored || (known.Code == status.Code && known.HappenedAt == status.HappenedAt)
+		}
+		if !stored {
+			d.Statuses = append(d.Statuses, status)
+		}
+	}
+	return nil
+}
+
+func (s *DeliveryStore) LoadPendingShipments(ctx context.Context) ([]uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orders []uint
+	for _, id := range sortedIDs(s.db.orders) {
+		if s.db.orders[id].Status != orderstatus.ReadyForDelivery {
+			continue
+		}
+		if d, err := s.db.orderDelivery(id); err == nil && d.DeliveryID != "" && d.RegistrationError == "" {
+			orders = append(orders, id)
+		}
+	}
+	return orders, nil
+}
+
+func (s *DeliveryStore) UpdateDeliveryError(ctx context.Context, orderID uint, registrationError string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return err
+	}
+	d.RegistrationError = registrationError
+	return nil
+}
+
+func (s *DeliveryStore) LoadDeliveryFailures(ctx context.Context) (models.ResponseDeliveryFailures, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	failures := models.ResponseDeliveryFailures{Orders: []models.DeliveryFailure{}}
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		if o.Status != orderstatus.ReadyForDelivery {
+			continue
+		}
+		if d, err := s.db.orderDelivery(id); err == nil && d.RegistrationError != "" {
+			failures.Orders = append(failures.Orders, models.DeliveryFailure{OrdersID: id, DeliveryID: d.ID, RegistrationError: d.RegistrationError, LastEditedAt: o.LastEditedAt.Unix()})
+		}
+	}
+	return failures, nil
+}
+
+func (s *DeliveryStore) DeliveryFailed(ctx context.Context, orderID uint) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return false, nil
+	}
+	return d.RegistrationError != "", nil
+}
+
+func (s *DeliveryStore) ReplaceDeliveryPoints(ctx context.Context, points []models.DeliveryPoint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.pickupPoints = make(map[string]models.DeliveryPoint)
+	for _, p := range points {
+		s.db.pickupPoints[p.Code] = p
+	}
+	return nil
+}
+
+func (s *DeliveryStore) LoadDeliveryPoints(ctx context.Context, query models.DeliveryPointQuery) ([]models.DeliveryPoint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	limit := int(query.Limit)
+	if limit == 0 {
+		limit = delivery.DefaultPointsLimit
+	}
+	codes := make([]string, 0, len(s.db.pickupPoints))
+	for code := range s.db.pickupPoints {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	points := []models.DeliveryPoint{}
+	for _, code := range codes {
+		if p := s.db.pickupPoints[code]; delivery.MatchesPointQuery(p, query) {
+			points = append(points, p)
+		}
+	}
+	if query.Latitude != nil && query.Longitude != nil {
+		return delivery.NearestPoints(points, *query.Latitude, *query.Longitude, limit), nil
+	}
+	if len(points) > limit {
+		points = points[:limit]
+	}
+	return points, nil
+}
+
+func (s *DeliveryStore) CheckDeliveryPoint(ctx context.Context, code string, pointType string) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	p, ok := s.db.pickupPoints[code]
+	return ok && p.Type == pointType, nil
+}
+
+func (s *DeliveryStore) LoadProjectBooks(ctx context.Context, projectIDs []uint) ([]models.ShippedBook, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.shippedBooks(projectIDs), nil
+}
+
+// shippedBooks returns what the packaging of the stored projects depends on, ordered by project id.
+func (db *DB) shippedBooks(projectIDs []uint) []models.ShippedBook {
+	ids := append([]uint(nil), projectIDs...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	books := []models.ShippedBook{}
+	for _, pID := range ids {
+		if p, ok := db.projects[pID]; ok {
+			books = append(books, models.ShippedBook{Size: p.Size, Variant: p.Variant, Cover: p.Cover, CountPages: p.CountPages})
+		}
+	}
+	return books
+}
+
+func (s *DeliveryStore) LoadDeliveryPoint(ctx context.Context, code string) (models.DeliveryPoint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	p, ok := s.db.pickupPoints[code]
+	if !ok {
+		return p, ErrNotFound
+	}
+	return p, nil
+}
+
+func (s *DeliveryStore) CreateWarehouse(ctx context.Context, warehouse models.Warehouse) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	warehouse.WarehouseID = s.db.id("warehouses")
+	warehouse.IsActive = true
+	s.db.warehouses[warehouse.WarehouseID] = &warehouse
+	return warehouse.WarehouseID, nil
+}
+
+func (s *DeliveryStore) UpdateWarehouse(ctx context.Context, warehouseID uint, warehouse models.Warehouse) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.warehouses[warehouseID]; !ok {
+		return nil
+	}
+	warehouse.WarehouseID = warehouseID
+	s.db.warehouses[warehouseID] = &warehouse
+	return nil
+}
+
+func (s *DeliveryStore) DeleteWarehouse(ctx context.Context, warehouseID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if w, ok := s.db.warehouses[warehouseID]; ok {
+		w.IsActive = false
+	}
+	return nil
+}
+
+func (s *DeliveryStore) CheckWarehouse(ctx context.Context, warehouseID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	w, ok := s.db.warehouses[warehouseID]
+	return ok && w.IsActive
+}
+
+func (s *DeliveryStore) LoadWarehouses(ctx context.Context) ([]models.Warehouse, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	warehouses := []models.Warehouse{}
+	for _, id := range sortedIDs(s.db.warehouses) {
+		warehouses = append(warehouses, *s.db.warehouses[id])
+	}
+	return warehouses, nil
+}
+
+func (s *DeliveryStore) AssignWarehouse(ctx context.Context, orderID uint, warehouseID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return err
+	}
+	d.WarehouseID = warehouseID
+	return nil
+}
+
+func (s *DeliveryStore) FindShipmentOrder(ctx context.Context, uuid string) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		if d, ok := s.db.deliveries[o.DeliveryID]; ok && uuid != "" && d.DeliveryID == uuid {
+			return id, nil
+		}
+	}
+	return 0, nil
+}
+
+func (s *DeliveryStore) LatestDeliveryStatus(ctx context.Context, deliveryID uint) (models.DeliveryStatusEvent, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var latest models.DeliveryStatusEvent
+	d, ok := s.db.deliveries[deliveryID]
+	if !ok || len(d.Statuses) == 0 {
+		return latest, ErrNotFound
+	}
+	for i, status := range d.Statuses {
+		if i == 0 || status.HappenedAt >= latest.HappenedAt {
+			latest = status
+		}
+	}
+	return latest, nil
+}
+
+func (s *DeliveryStore) SaveShippingDocument(ctx context.Context, orderID uint, document models.ShippingDocument) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return err
+	}
+	if d.Documents == nil {
+		d.Documents = make(map[string]models.ShippingDocument)
+	}
+	d.Documents[document.Form] = document
+	return nil
+}
+
+func (s *DeliveryStore) LoadShippingDocuments(ctx context.Context, orderID uint) ([]models.ShippingDocument, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var documents []models.ShippingDocument
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		// the orders not yet paid have no delivery
+		return documents, nil
+	}
+	for _, document := range d.Documents {
+		documents = append(documents, document)
+	}
+	sort.Slice(documents, func(i, j int) bool { return documents[i].Form < documents[j].Form })
+	return documents, nil
+}
+
+func (s *DeliveryStore) LoadShipmentsToHandOver(ctx context.Context) ([]uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orders []uint
+	for _, id := range sortedIDs(s.db.orders) {
+		if status := s.db.orders[id].Status; status != orderstatus.ReadyForDelivery && status != orderstatus.InDelivery {
+			continue
+		}
+		d, err := s.db.orderDelivery(id)
+		if err != nil || d.DeliveryID == "" || d.TrackingNumber == "" {
+			continue
+		}
+		if d.DeliveryStatus == "" || d.DeliveryStatus == "CREATED" || d.DeliveryStatus == "ACCEPTED" {
+			orders = append(orders, id)
+		}
+	}
+	return orders, nil
+}
@@ -0,0 +1,332 @@
+// Memstore package contains in-memory implementations of the storage interfaces,
+// used to run the handlers without a postgres database.
+//
+// Available at https://github.com/SiberianMonster/memoryprint/tree/development/internal/memstore
+package memstore
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/promotions"
+)
+
+// ErrNotFound is returned where the postgres implementation would fail to scan a missing row.
+var ErrNotFound = errors.New("memstore: no rows in result set")
+
+type userRow struct {
+	ID           uint
+	Name         string
+	Password     string
+	Email        string
+	TokenHash    string
+	Category     string
+	Status       string
+	Subscription bool
+	LastEditedAt time.Time
+	CreatedAt    time.Time
+}
+
+type projectRow struct {
+	ID                uint
+	Name              string
+	Status            string
+	Category          string
+	Size              string
+	Variant           string
+	Cover             string
+	Surface           string
+	CountPages        int
+	LeatherID         *uint
+	CreatingSpineLink *string
+	PreviewSpineLink  *string
+	LastEditedAt      time.Time
+	CreatedAt         time.Time
+}
+
+type pageRow struct {
+	ID                uint
+	ProjectID         uint
+	IsTemplate        bool
+	Type              string
+	Sort              uint
+	CreatingImageLink *string
+	PreviewImageLink  *string
+	Data              json.RawMessage
+	LastEditedAt      time.Time
+}
+
+type editorRow struct {
+	ProjectID uint
+	Email     string
+	Category  string
+}
+
+type objectRow struct {
+	ID          uint
+	Link        string
+	SmallImage  *string
+	Type        *string
+	Category    *string
+	CountImages uint
+	Size        string
+	Data        json.RawMessage
+	IsPersonal  bool
+	CreatedAt   time.Time
+}
+
+type userObject struct {
+	UserID      uint
+	ObjectID    uint
+	IsFavourite bool
+	IsPersonal  bool
+}
+
+type promoRow struct {
+	promotions.Promotion
+	IsOnetime bool
+}
+
+type redemptionRow struct {
+	ID          uint
+	PromotionID uint
+	UserID      uint
+	OrderID     uint
+	Status      string
+	Discount    money.Money
+	CreatedAt   time.Time
+}
+
+type certificateRow struct {
+	models.GiftCertificate
+	InitialDeposit money.Money
+	Status         string
+	MailSent       bool
+	CreatedAt      time.Time
+}
+
+type orderRow struct {
+	ID                 uint
+	UserID             uint
+	Status             string
+	CreatedAt          time.Time
+	LastEditedAt       time.Time
+	Contacts           models.Contacts
+	Commentary         *string
+	VideoLink          *string
+	BasePrice          *money.Money
+	FinalPrice         *money.Money
+	PackageBox         bool
+	PromooffersID      uint
+	GiftcertificatesID uint
+	CertificateDeposit *money.Money
+	DeliveryID         uint
+	TransactionID      uint
+	OriginalOrderID    uint
+	PriceListID        uint
+	IdempotencyKey     string
+}
+
+// cartRow is the cart of a user with the projects in the order they were added.
+type cartRow struct {
+	ID    uint
+	Items []models.CartItem
+}
+
+type transactionRow struct {
+	ID           uint
+	Status       string
+	Type         string
+	Amount       money.Money
+	BankOrderID  string
+	BankStatus   string
+	CaptureError string
+	ReverseError string
+	CapturedAt   time.Time
+	PaymentLink  string
+	CreatedAt    time.Time
+}
+
+type refundRow struct {
+	ID            uint
+	OrderID       uint
+	TransactionID uint
+	Amount        money.Money
+	Reason        string
+	Status        string
+	CreatedAt     time.Time
+}
+
+type receiptRow struct {
+	ID            uint
+	TransactionID uint
+	RefundID      uint
+	OrderID       uint
+	Type          string
+	Amount        money.Money
+	Receipt       models.Receipt
+	CreatedAt     time.Time
+	SentAt        time.Time
+}
+
+type deliveryRow struct {
+	ID             uint
+	Status         string
+	Method         string
+	Address        string
+	PostalCode     string
+	Code           string
+	Amount         money.Money
+	DeliveryID     string
+	TrackingNumber string
+	DeliveryStatus string
+	ExpectedFrom   time.Time
+	ExpectedTo     time.Time
+	Statuses       []models.DeliveryStatusEvent
+	WarehouseID    uint
+	// Documents are the print forms of the shipment by form
+	Documents map[string]models.ShippingDocument
+	// RegistrationError is why the shipment could not be registered with the carrier, empty when it was not rejected
+	RegistrationError string
+}
+
+// DB is the shared in-memory state behind all memstore implementations.
+type DB struct {
+	mu sync.Mutex
+
+	nextID map[string]uint
+
+	users         map[uint]*userRow
+	projects      map[uint]*projectRow
+	templates     map[uint]*projectRow
+	pages         map[uint]*pageRow
+	pagePhotos    map[uint][]uint
+	editors       []editorRow
+	photos        map[uint]*objectRow
+	photoOwners   map[uint]uint
+	decorations   map[uint]*objectRow
+	backgrounds   map[uint]*objectRow
+	layouts       map[uint]*objectRow
+	userDecor     map[uint][]*userObject
+	userBack      map[uint][]*userObject
+	userLayouts   map[uint][]*userObject
+	priceLists    map[uint]*models.PriceList
+	orderItems    map[uint][]models.OrderItem
+	leather       map[uint]*models.Colour
+	promooffers   map[uint]*promoRow
+	redemptions   map[uint]*redemptionRow
+	certificates  map[uint]*certificateRow
+	orders        map[uint]*orderRow
+	orderProjects map[uint][]uint
+	orderCopies   map[uint]map[uint]int
+	carts         map[uint]*cartRow
+	transactions  map[uint]*transactionRow
+	deliveries    map[uint]*deliveryRow
+	pickupPoints  map[string]models.DeliveryPoint
+	warehouses    map[uint]*models.Warehouse
+	refunds       map[uint]*refundRow
+	receipts      map[uint]*receiptRow
+	statusHistory map[uint]*models.OrderStatusChange
+	complaints    map[uint]*models.Complaint
+}
+
+// New returns an empty in-memory database.
+func New() *DB {
+
+	return &DB{
+		nextID:        make(map[string]uint),
+		users:         make(map[uint]*userRow),
+		projects:      make(map[uint]*projectRow),
+		templates:     make(map[uint]*projectRow),
+		pages:         make(map[uint]*pageRow),
+		pagePhotos:    make(map[uint][]uint),
+		photos:        make(map[uint]*objectRow),
+		photoOwners:   make(map[uint]uint),
+		decorations:   make(map[uint]*objectRow),
+		backgrounds:   make(map[uint]*objectRow),
+		layouts:       make(map[uint]*objectRow),
+		userDecor:     make(map[uint][]*userObject),
+		userBack:      make(map[uint][]*userObject),
+		userLayouts:   make(map[uint][]*userObject),
+		leather:       make(map[uint]*models.Colour),
+		promooffers:   make(map[uint]*promoRow),
+		redemptions:   make(map[uint]*redemptionRow),
+		certificates:  make(map[uint]*certificateRow),
+		orders:        make(map[uint]*orderRow),
+		orderProjects: make(map[uint][]uint),
+		orderCopies:   make(map[uint]map[uint]int),
+		carts:         make(map[uint]*cartRow),
+		transactions:  make(map[uint]*transactionRow),
+		deliveries:    make(map[uint]*deliveryRow),
+		pickupPoints:  make(map[string]models.DeliveryPoint),
+		warehouses:    make(map[uint]*models.Warehouse),
+		refunds:       make(map[uint]*refundRow),
+		receipts:      make(map[uint]*receiptRow),
+		statusHistory: make(map[uint]*models.OrderStatusChange),
+		complaints:    make(map[uint]*models.Complaint),
+		priceLists:    make(map[uint]*models.PriceList),
+		orderItems:    make(map[uint][]models.OrderItem),
+	}
+}
+
+// NewStores returns in-memory implementations of all storages sharing one empty database.
+func NewStores() handlersfunc.Stores {
+	db := New()
+	return handlersfunc.Stores{
+		Users:    NewUserStore(db),
+		Projects: NewProjectStore(db),
+		Orders:   NewOrderStore(db),
+		Objects:  NewObjectStore(db),
+		Delivery: NewDeliveryStore(db),
+	}
+}
+
+// id returns the next serial value of the given table.
+func (db *DB) id(table string) uint {
+	db.nextID[table]++
+	return db.nextID[table]
+}
+
+// sortedIDs returns the keys of a table in insertion order.
+func sortedIDs[T any](table map[uint]T) []uint {
+	ids := make([]uint, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// paginate applies OFFSET and LIMIT to a slice.
+func paginate[T any](rows []T, offset uint, limit uint) []T {
+	if offset >= uint(len(rows)) {
+		return rows[:0]
+	}
+	rows = rows[offset:]
+	if limit < uint(len(rows)) {
+		rows = rows[:limit]
+	}
+	return rows
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	return &c
+}
+
+func copyFloat(f float64) *float64 {
+	return &f
+}
+
+func copyMoney(m money.Money) *money.Money {
+	return &m
+}
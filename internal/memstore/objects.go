@@ -0,0 +1,550 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+)
+
+// ObjectStore is the in-memory implementation of objectsstorage.ObjectStore.
+type ObjectStore struct {
+	db *DB
+}
+
+var _ objectsstorage.ObjectStore = (*ObjectStore)(nil)
+
+// NewObjectStore returns an ObjectStore backed by db.
+func NewObjectStore(db *DB) *ObjectStore {
+	return &ObjectStore{db: db}
+}
+
+// relation returns the users_has_* row of the user for the object, if there is one.
+func relation(table map[uint][]*userObject, userID uint, objectID uint) *userObject {
+	for _, rel := range table[userID] {
+		if rel.ObjectID == objectID {
+			return rel
+		}
+	}
+	return nil
+}
+
+// userRelations returns the rows of the user matching keep, newest object first.
+func userRelations(table map[uint][]*userObject, userID uint, keep func(*userObject) bool) []*userObject {
+	var rels []*userObject
+	for _, rel := range table[userID] {
+		if keep(rel) {
+			rels = append(rels, rel)
+		}
+	}
+	sort.Slice(rels, func(i, j int) bool { return rels[i].ObjectID > rels[j].ObjectID })
+	return rels
+}
+
+func isFavourite(rel *userObject) bool { return rel.IsFavourite }
+
+func isPersonal(rel *userObject) bool { return rel.IsPersonal }
+
+// newestFirst returns the objects matching keep in descending id order.
+func newestFirst(table map[uint]*objectRow, keep func(*objectRow) bool) []*objectRow {
+	var rows []*objectRow
+	ids := sortedIDs(table)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if keep(table[ids[i]]) {
+			rows = append(rows, table[ids[i]])
+		}
+	}
+	return rows
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func removeRelations(table map[uint][]*userObject, objectID uint) {
+	for userID, rels := range table {
+		kept := rels[:0]
+		for _, rel := range rels {
+			if rel.ObjectID != objectID {
+				kept = append(kept, rel)
+			}
+		}
+		table[userID] = kept
+	}
+}
+
+// favour sets the favourite flag of the user for the object, creating the relation if needed.
+func favour(table map[uint][]*userObject, userID uint, objectID uint, isFavourite bool) {
+	if rel := relation(table, userID, objectID); rel != nil {
+		rel.IsFavourite = isFavourite
+		return
+	}
+	table[userID] = append(table[userID], &userObject{UserID: userID, ObjectID: objectID, IsFavourite: isFavourite})
+}
+
+func (s *ObjectStore) CheckUserOwnsPhoto(ctx context.Context, userID uint, photoID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	owner, ok := s.db.photoOwners[photoID]
+	return ok && owner == userID
+}
+
+func (s *ObjectStore) AddPhoto(ctx context.Context, photoLink string, smallImage string, userID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	photo := &objectRow{ID: s.db.id("photos"), Link: photoLink, SmallImage: &smallImage, CreatedAt: time.Now()}
+	s.db.photos[photo.ID] = photo
+	s.db.photoOwners[photo.ID] = userID
+	return photo.ID, nil
+}
+
+func (s *ObjectStore) AddDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	decor := &objectRow{
+		ID:         s.db.id("decorations"),
+		Link:       newDecor.Link,
+		SmallImage: copyString(newDecor.SmallImage),
+		Type:       copyString(&newDecor.Type),
+		Category:   copyString(&newDecor.Category),
+	}
+	s.db.decorations[decor.ID] = decor
+	s.db.userDecor[userID] = append(s.db.userDecor[userID], &userObject{UserID: userID, ObjectID: decor.ID, IsFavourite: newDecor.IsFavourite, IsPersonal: true})
+	return decor.ID, nil
+}
+
+func (s *ObjectStore) AdminDeleteDecoration(ctx context.Context, dID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.decorations, dID)
+	removeRelations(s.db.userDecor, dID)
+	return nil
+}
+
+func (s *ObjectStore) DeleteDecoration(ctx context.Context, userID uint, decorID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	rel := relation(s.db.userDecor, userID, decorID)
+	if rel == nil {
+		return ErrNotFound
+	}
+	if !rel.IsPersonal {
+		return nil
+	}
+	delete(s.db.decorations, decorID)
+	removeRelations(s.db.userDecor, decorID)
+	return nil
+}
+
+func (s *ObjectStore) AddBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	background := &objectRow{
+		ID:         s.db.id("backgrounds"),
+		Link:       newDecor.Link,
+		SmallImage: copyString(newDecor.SmallImage),
+		Type:       copyString(&newDecor.Type),
+	}
+	s.db.backgrounds[background.ID] = background
+	s.db.userBack[userID] = append(s.db.userBack[userID], &userObject{UserID: userID, ObjectID: background.ID, IsFavourite: newDecor.IsFavourite, IsPersonal: true})
+	return background.ID, nil
+}
+
+func (s *ObjectStore) AdminDeleteBackground(ctx context.Context, bID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.backgrounds, bID)
+	removeRelations(s.db.userBack, bID)
+	return nil
+}
+
+func (s *ObjectStore) DeleteBackground(ctx context.Context, userID uint, bID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	rel := relation(s.db.userBack, userID, bID)
+	if rel == nil {
+		return ErrNotFound
+	}
+	if !rel.IsPersonal {
+		return nil
+	}
+	delete(s.db.backgrounds, bID)
+	removeRelations(s.db.userBack, bID)
+	return nil
+}
+
+func (s *ObjectStore) DeletePhoto(ctx context.Context, photoID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.photos, photoID)
+	delete(s.db.photoOwners, photoID)
+	return photoID, nil
+}
+
+func (s *ObjectStore) RetrieveUserPhotos(ctx context.Context, userID uint, sorting string, offset uint, limit uint) (models.ResponsePhotos, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	responsePhoto := models.ResponsePhotos{Photos: []models.Photo{}}
+	rows := newestFirst(s.db.photos, func(p *objectRow) bool { return s.db.photoOwners[p.ID] == userID })
+	if sorting == "ASC" {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	for _, p := range paginate(rows, offset, limit) {
+		responsePhoto.Photos = append(responsePhoto.Photos, models.Photo{
+			PhotoID:    p.ID,
+			Link:       p.Link,
+			SmallImage: copyString(p.SmallImage),
+			UploadedAt: p.CreatedAt.Unix(),
+		})
+	}
+	responsePhoto.CountAll = len(rows)
+	return responsePhoto, nil
+}
+
+func (db *DB) backgroundModel(b *objectRow, rel *userObject) models.Background {
+	background := models.Background{
+		BackgroundID: b.ID,
+		Link:         b.Link,
+		SmallImage:   copyString(b.SmallImage),
+		Type:         copyString(b.Type),
+	}
+	if rel != nil {
+		background.IsFavourite = rel.IsFavourite
+		background.IsPersonal = rel.IsPersonal
+	}
+	return background
+}
+
+func (s *ObjectStore) LoadBackgrounds(ctx context.Context, userID uint, offset uint, limit uint, btype string, isfavourite bool, ispersonal bool) (models.ResponseBackground, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	responseBackground := models.ResponseBackground{Backgrounds: []models.Background{}}
+	matchType := func(b *objectRow) bool {
+		return btype == "" || deref(b.Type) == btype
+	}
+	fromRelations := func(rels []*userObject) {
+		for _, rel := range paginate(rels, offset, limit) {
+			if b, ok := s.db.backgrounds[rel.ObjectID]; ok && matchType(b) {
+				responseBackground.Backgrounds = append(responseBackground.Backgrounds, s.db.backgroundModel(b, rel))
+			}
+		}
+	}
+	favourites := userRelations(s.db.userBack, userID, isFavourite)
+	personal := userRelations(s.db.userBack, userID, isPersonal)
+	if isfavourite {
+		fromRelations(favourites)
+	}
+	if ispersonal {
+		fromRelations(personal)
+	}
+	general := newestFirst(s.db.backgrounds, func(b *objectRow) bool {
+		return deref(b.Type) != "" && matchType(b)
+	})
+	if !isfavourite && !ispersonal {
+		for _, b := range paginate(general, offset, limit) {
+			responseBackground.Backgrounds = append(responseBackground.Backgrounds, s.db.backgroundModel(b, relation(s.db.userBack, userID, b.ID)))
+		}
+	}
+
+	for _, rel := range favourites {
+		if b, ok := s.db.backgrounds[rel.ObjectID]; ok && matchType(b) {
+			responseBackground.CountFavourite++
+		}
+	}
+	responseBackground.CountPersonal = len(personal)
+	switch {
+	case isfavourite:
+		responseBackground.CountAll = responseBackground.CountFavourite
+	case ispersonal:
+		responseBackground.CountAll = responseBackground.CountPersonal
+	default:
+		responseBackground.CountAll = len(general)
+	}
+	return responseBackground, nil
+}
+
+func (s *ObjectStore) AddAdminBackground(ctx context.Context, newB models.Background) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	background := &objectRow{
+		ID:         s.db.id("backgrounds"),
+		Link:       newB.Link,
+		SmallImage: copyString(newB.SmallImage),
+		Type:       copyString(newB.Type),
+	}
+	s.db.backgrounds[background.ID] = background
+	return background.ID, nil
+}
+
+func (s *ObjectStore) UpdateBackground(ctx context.Context, bID uint, newB models.Background) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if b, ok := s.db.backgrounds[bID]; ok {
+		b.Link = newB.Link
+		b.SmallImage = copyString(newB.SmallImage)
+		b.Type = copyString(newB.Type)
+	}
+	return nil
+}
+
+func (s *ObjectStore) UpdateDecoration(ctx context.Context, dID uint, newD models.Decoration) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if d, ok := s.db.decorations[dID]; ok {
+		d.Link = newD.Link
+		d.SmallImage = copyString(newD.SmallImage)
+		d.Type = copyString(newD.Type)
+		d.Category = copyString(newD.Category)
+	}
+	return nil
+}
+
+func (s *ObjectStore) FavourBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	favour(s.db.userBack, userID, newDecor.ObjectID, newDecor.IsFavourite)
+	return nil
+}
+
+func (db *DB) decorationModel(d *objectRow, rel *userObject) models.Decoration {
+	decoration := models.Decoration{
+		DecorationID: d.ID,
+		Link:         d.Link,
+		SmallImage:   copyString(d.SmallImage),
+		Type:         copyString(d.Type),
+		Category:     copyString(d.Category),
+	}
+	if rel != nil {
+		decoration.IsFavourite = rel.IsFavourite
+		decoration.IsPersonal = rel.IsPersonal
+	}
+	return decoration
+}
+
+func (s *ObjectStore) LoadDecorations(ctx context.Context, userID uint, offset uint, limit uint, dtype string, dcategory string, isfavourite bool, ispersonal bool) (models.ResponseDecoration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	responseDecoration := models.ResponseDecoration{Decorations: []models.Decoration{}}
+	match := func(d *objectRow) bool {
+		return (dtype == "" || deref(d.Type) == dtype) && (dcategory == "" || deref(d.Category) == dcategory)
+	}
+	// personal uploads are only listed when no type or category filter is set
+	matchRelation := func(d *objectRow, rel *userObject) bool {
+		if dtype == "" && dcategory == "" {
+			return true
+		}
+		return !rel.IsPersonal && match(d)
+	}
+	favourites := userRelations(s.db.userDecor, userID, isFavourite)
+	personal := userRelations(s.db.userDecor, userID, isPersonal)
+	general := newestFirst(s.db.decorations, func(d *objectRow) bool {
+		return deref(d.Category) != "" && match(d)
+	})
+	var listed []*userObject
+	switch {
+	case isfavourite:
+		listed = favourites
+	case ispersonal:
+		listed = personal
+	default:
+		for _, d := range paginate(general, offset, limit) {
+			responseDecoration.Decorations = append(responseDecoration.Decorations, s.db.decorationModel(d, relation(s.db.userDecor, userID, d.ID)))
+		}
+	}
+	for _, rel := range paginate(listed, offset, limit) {
+		if d, ok := s.db.decorations[rel.ObjectID]; ok && matchRelation(d, rel) {
+			responseDecoration.Decorations = append(responseDecoration.Decorations, s.db.decorationModel(d, rel))
+		}
+	}
+
+	count := func(rels []*userObject) int {
+		counter := 0
+		for _, rel := range rels {
+			if d, ok := s.db.decorations[rel.ObjectID]; ok && match(d) {
+				counter++
+			}
+		}
+		return counter
+	}
+	responseDecoration.CountFavourite = count(favourites)
+	responseDecoration.CountPersonal = count(personal)
+	switch {
+	case isfavourite:
+		responseDecoration.CountAll = responseDecoration.CountFavourite
+	case ispersonal:
+		responseDecoration.CountAll = responseDecoration.CountPersonal
+	default:
+		responseDecoration.CountAll = len(general)
+	}
+	return responseDecoration, nil
+}
+
+func (s *ObjectStore) AddAdminDecoration(ctx context.Context, newD models.Decoration) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	decor := &objectRow{
+		ID:         s.db.id("decorations"),
+		Link:       newD.Link,
+		SmallImage: copyString(newD.SmallImage),
+		Type:       copyString(newD.Type),
+		Category:   copyString(newD.Category),
+	}
+	s.db.decorations[decor.ID] = decor
+	return decor.ID, nil
+}
+
+func (s *ObjectStore) FavourDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	favour(s.db.userDecor, userID, newDecor.ObjectID, newDecor.IsFavourite)
+	return nil
+}
+
+func (s *ObjectStore) LoadLayouts(ctx context.Context, userID uint, offset uint, limit uint, size string, countimages uint, isfavourite bool) (models.ResponseLayout, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	responseLayout := models.ResponseLayout{Layouts: []models.Layout{}}
+	match := func(l *objectRow) bool {
+		return (size == "" || l.Size == size) && (countimages == 0 || l.CountImages == countimages)
+	}
+	layoutModel := func(l *objectRow, rel *userObject) models.Layout {
+		layout := models.Layout{LayoutID: l.ID, Link: l.Link, Size: l.Size, CountImages: l.CountImages, Data: l.Data}
+		if rel != nil {
+			layout.IsFavourite = rel.IsFavourite
+		}
+		return layout
+	}
+	favourites := userRelations(s.db.userLayouts, userID, isFavourite)
+	general := newestFirst(s.db.layouts, match)
+	if isfavourite {
+		for _, rel := range paginate(favourites, offset, limit) {
+			if l, ok := s.db.layouts[rel.ObjectID]; ok && match(l) {
+				responseLayout.Layouts = append(responseLayout.Layouts, layoutModel(l, rel))
+			}
+		}
+	} else {
+		for _, l := range paginate(general, offset, limit) {
+			responseLayout.Layouts = append(responseLayout.Layouts, layoutModel(l, relation(s.db.userLayouts, userID, l.ID)))
+		}
+	}
+	for _, rel := range favourites {
+		if l, ok := s.db.layouts[rel.ObjectID]; ok && match(l) {
+			responseLayout.CountFavourite++
+		}
+	}
+	if isfavourite {
+		responseLayout.CountAll = responseLayout.CountFavourite
+	} else {
+		responseLayout.CountAll = len(general)
+	}
+	return responseLayout, nil
+}
+
+func (s *ObjectStore) AddAdminLayout(ctx context.Context, newL models.Layout) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	layout := &objectRow{
+		ID:          s.db.id("layouts"),
+		Link:        newL.Link,
+		CountImages: newL.CountImages,
+		Data:        newL.Data,
+		Size:        newL.Size,
+	}
+	s.db.layouts[layout.ID] = layout
+	return layout.ID, nil
+}
+
+func (s *ObjectStore) AdminDeleteLayout(ctx context.Context, lID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.layouts, lID)
+	removeRelations(s.db.userLayouts, lID)
+	return nil
+}
+
+func (s *ObjectStore) FavourLayout(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	favour(s.db.userLayouts, userID, newDecor.ObjectID, newDecor.IsFavourite)
+	return nil
+}
+
+func (s *ObjectStore) CreatePriceList(ctx context.Context, priceList models.PriceList) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := time.Now()
+	priceList.PriceListID = s.db.id("price_lists")
+	priceList.CreatedAt = t.Unix()
+	if priceList.EffectiveFrom < t.Unix() {
+		priceList.EffectiveFrom = t.Unix()
+	}
+	priceList.Prices = append([]models.Price{}, priceList.Prices...)
+	priceList.VolumeDiscounts = append([]models.VolumeDiscount{}, priceList.VolumeDiscounts...)
+	s.db.priceLists[priceList.PriceListID] = &priceList
+	return priceList.PriceListID, nil
+}
+
+func (s *ObjectStore) DeletePriceList(ctx context.Context, priceListID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	priceList, ok := s.db.priceLists[priceListID]
+	if !ok || priceList.EffectiveFrom <= time.Now().Unix() {
+		return pricing.ErrPriceListInEffect
+	}
+	delete(s.db.priceLists, priceListID)
+	return nil
+}
+
+func (s *ObjectStore) RetrievePriceLists(ctx context.Context) (models.ResponsePriceLists, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	listset := models.ResponsePriceLists{PriceLists: []models.PriceList{}}
+	for _, id := range sortedIDs(s.db.priceLists) {
+		listset.PriceLists = append(listset.PriceLists, *s.db.priceLists[id])
+	}
+	sort.SliceStable(listset.PriceLists, func(i, j int) bool {
+		return listset.PriceLists[i].EffectiveFrom < listset.PriceLists[j].EffectiveFrom
+	})
+	return listset, nil
+}
+
+func (s *ObjectStore) RetrievePrices(ctx context.Context) (models.ResponsePrice, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	catalog := s.db.catalog(time.Now())
+	return models.ResponsePrice{Prices: append([]models.Price{}, catalog.Rules...), VolumeDiscounts: append([]models.VolumeDiscount{}, catalog.VolumeDiscounts...)}, nil
+}
+
+func (s *ObjectStore) AddCover(ctx context.Context, newC models.Colour) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	cover := newC
+	cover.ID = s.db.id("leather")
+	s.db.leather[cover.ID] = &cover
+	return nil
+}
+
+func (s *ObjectStore) AdminDeleteCover(ctx context.Context, cID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	delete(s.db.leather, cID)
+	return nil
+}
+
+func (s *ObjectStore) RetrieveCovers(ctx context.Context) ([]models.Colour, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	covers := []models.Colour{}
+	for _, id := range sortedIDs(s.db.leather) {
+		covers = append(covers, *s.db.leather[id])
+	}
+	return covers, nil
+}
@@ -0,0 +1,1476 @@
+package memstore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/SiberianMonster/memoryprint/internal/promotions"
+)
+
+// OrderStore is the in-memory implementation of orderstorage.OrderStore.
+type OrderStore struct {
+	db *DB
+	// PrintedOrders collects the orders OrdersToPrint would have mailed about.
+	PrintedOrders []models.PaidOrderObj
+}
+
+var _ orderstorage.OrderStore = (*OrderStore)(nil)
+
+// NewOrderStore returns a OrderStore backed by db.
+func NewOrderStore(db *DB) *OrderStore {
+	return &OrderStore{db: db}
+}
+
+var activeOrderStatuses = map[string]bool{
+	"AWAITING_PAYMENT":    true,
+	"PAYMENT_IN_PROGRESS": true,
+	"PAID":                true,
+	"IN_PRINT":            true,
+	"READY_FOR_DELIVERY":  true,
+	"IN_DELIVERY":         true,
+}
+
+// catalog mirrors pricing.LoadCatalog.
+func (db *DB) catalog(at time.Time) pricing.Catalog {
+	var priceLists []models.PriceList
+	for _, id := range sortedIDs(db.priceLists) {
+		priceLists = append(priceLists, *db.priceLists[id])
+	}
+	priceList, ok := pricing.InEffect(priceLists, at.Unix())
+	if !ok {
+		return pricing.Catalog{}
+	}
+	return pricing.NewCatalog(priceList)
+}
+
+// book mirrors pricing.LoadBook.
+func (db *DB) book(projectID uint) (pricing.Book, error) {
+	p, ok := db.projects[projectID]
+	if !ok {
+		return pricing.Book{}, ErrNotFound
+	}
+	book := pricing.Book{ProjectID: projectID, Size: p.Size, Variant: p.Variant, Cover: p.Cover, Surface: p.Surface, CountPages: p.CountPages}
+	if p.LeatherID != nil {
+		book.LeatherID = *p.LeatherID
+	}
+	return book, nil
+}
+
+// price mirrors orderstorage.CalculateBasePrice.
+func (db *DB) price(projectID uint, quantity int, at time.Time) models.PriceBreakdown {
+	book, err := db.book(projectID)
+	if err != nil {
+		return models.PriceBreakdown{Lines: []models.PriceLine{}}
+	}
+	book.Quantity = quantity
+	breakdown, _ := db.catalog(at).Quote(book)
+	return breakdown
+}
+
+// saveOrderItems mirrors the order_items the checkout stores with orderstorage.SaveOrderItems.
+func (db *DB) saveOrderItems(orderID uint, breakdown models.PriceBreakdown) {
+	for _, line := range breakdown.Lines {
+		item := models.OrderItem{Code: line.Code, ProjectID: line.ProjectID, Quantity: line.Quantity, UnitPrice: line.UnitPrice, Amount: line.Amount, Discount: line.Discount}
+		if p, ok := db.projects[line.ProjectID]; ok {
+			item.Size = p.Size
+			item.Variant = p.Variant
+			item.Cover = p.Cover
+			item.Surface = p.Surface
+			item.CountPages = p.CountPages
+		}
+		db.orderItems[orderID] = append(db.orderItems[orderID], item)
+	}
+}
+
+// quoteCart mirrors pricing.QuoteCart.
+func (db *DB) quoteCart(cart []models.CartItem, packageBox bool) (models.PriceBreakdown, error) {
+	books := make([]pricing.Book, 0, len(cart))
+	for _, item := range cart {
+		book, err := db.book(item.ProjectID)
+		if err != nil {
+			return models.PriceBreakdown{}, err
+		}
+		book.Quantity = item.Quantity
+		books = append(books, book)
+	}
+	return db.catalog(time.Now()).QuoteOrder(books, packageBox)
+}
+
+// cart returns the cart of the user, created when create is set, as the carts upsert of orderstorage does.
+func (db *DB) cart(userID uint, create bool) *cartRow {
+	c, ok := db.carts[userID]
+	if !ok && create {
+		c = &cartRow{ID: db.id("carts")}
+		db.carts[userID] = c
+	}
+	return c
+}
+
+// cartIndex returns the index of the project in the cart, -1 when it is not there.
+func (c *cartRow) cartIndex(projectID uint) int {
+	if c == nil {
+		return -1
+	}
+	for i, item := range c.Items {
+		if item.ProjectID == projectID {
+			return i
+		}
+	}
+	return -1
+}
+
+// addToCart mirrors orderstorage.AddCartItem.
+func (db *DB) addToCart(userID uint, item models.CartItem) uint {
+	if p, ok := db.projects[item.ProjectID]; ok {
+		p.Status = "PUBLISHED"
+	}
+	c := db.cart(userID, true)
+	if i := c.cartIndex(item.ProjectID); i >= 0 {
+		c.Items[i].Quantity += item.Quantity
+	} else {
+		c.Items = append(c.Items, item)
+	}
+	return c.ID
+}
+
+// removeFromCart deletes the project from the cart of the user and reports whether it was there.
+func (db *DB) removeFromCart(userID uint, projectID uint) bool {
+	c := db.cart(userID, false)
+	i := c.cartIndex(projectID)
+	if i < 0 {
+		return false
+	}
+	c.Items = append(c.Items[:i], c.Items[i+1:]...)
+	return true
+}
+
+// restoreCart mirrors orderstorage.restoreCart.
+func (db *DB) restoreCart(userID uint, orderID uint) {
+	c := db.cart(userID, true)
+	for _, pID := range db.orderProjects[orderID] {
+		if c.cartIndex(pID) < 0 {
+			c.Items = append(c.Items, models.CartItem{ProjectID: pID, Quantity: db.copies(orderID, pID)})
+		}
+	}
+}
+
+// copies returns the copies of the project in the order, as orders_has_projects.quantity.
+func (db *DB) copies(orderID uint, projectID uint) int {
+	if quantity, ok := db.orderCopies[orderID][projectID]; ok {
+		return quantity
+	}
+	return 1
+}
+
+// orderCopyIDs returns the projects of the order, every project listed once per copy.
+func (db *DB) orderCopyIDs(orderID uint) []uint {
+	var ids []uint
+	for _, pID := range db.orderProjects[orderID] {
+		for i := 0; i < db.copies(orderID, pID); i++ {
+			ids = append(ids, pID)
+		}
+	}
+	return ids
+}
+
+// addOrderProject mirrors the orders_has_projects insert.
+func (db *DB) addOrderProject(orderID uint, projectID uint, quantity int) {
+	db.orderProjects[orderID] = append(db.orderProjects[orderID], projectID)
+	if db.orderCopies[orderID] == nil {
+		db.orderCopies[orderID] = make(map[uint]int)
+	}
+	db.orderCopies[orderID][projectID] = quantity
+}
+
+// changeStatus moves the order to change.ToStatus and records the change, as orderstorage.UpdateOrderStatus does.
+func (db *DB) changeStatus(o *orderRow, change models.OrderStatusChange) {
+	o.Status = change.ToStatus
+	o.LastEditedAt = time.Now()
+	db.addStatusHistory(o.ID, change)
+}
+
+// addStatusHistory mirrors the order_status_history insert of orderstorage.
+func (db *DB) addStatusHistory(orderID uint, change models.OrderStatusChange) {
+	change.HistoryID = db.id("order_status_history")
+	change.OrdersID = orderID
+	change.CreatedAt = time.Now().Unix()
+	db.statusHistory[change.HistoryID] = &change
+}
+
+// paidCart returns the projects of an order as shown in the order lists.
+func (db *DB) paidCart(orderID uint) []models.PaidCartObj {
+	projects := []models.PaidCartObj{}
+	for _, pID := range db.orderProjects[orderID] {
+		var photobook models.PaidCartObj
+		if p, ok := db.projects[pID]; ok {
+			photobook.Name = p.Name
+			photobook.Size = p.Size
+			photobook.Variant = p.Variant
+			photobook.Surface = p.Surface
+			photobook.Cover = p.Cover
+			photobook.CountPages = p.CountPages
+			photobook.Quantity = db.copies(orderID, pID)
+			if items := db.orderItems[orderID]; len(items) > 0 {
+				photobook.BasePrice = orderstorage.ItemsBookPrice(items, pID)
+			} else if o, ok := db.orders[orderID]; ok {
+				photobook.BasePrice = db.price(pID, photobook.Quantity, o.CreatedAt).Total
+			}
+		}
+		photobook.FrontPage = db.frontPage(pID, false)
+		photobook.ProjectID = pID
+		projects = append(projects, photobook)
+	}
+	return projects
+}
+
+// promocodeDiscount returns the promocode fields shared by the order lists.
+func (db *DB) promocodeDiscount(o *orderRow, deliveryAmount money.Money) (*string, *float64, *money.Money) {
+	p, ok := db.promooffers[o.PromooffersID]
+	if !ok || p.Category == "" {
+		return nil, nil, nil
+	}
+	var certValue, finalValue, baseValue money.Money
+	if o.CertificateDeposit != nil {
+		certValue = *o.CertificateDeposit
+	}
+	if o.FinalPrice != nil {
+		finalValue = *o.FinalPrice
+	}
+	if o.BasePrice != nil {
+		baseValue = *o.BasePrice
+	}
+	category := p.Category
+	return &category, copyFloat(p.Discount), copyMoney(-(finalValue - baseValue - certValue + deliveryAmount))
+}
+
+func certificateDeposit(o *orderRow) *money.Money {
+	if o.CertificateDeposit != nil && *o.CertificateDeposit != 0 {
+		return copyMoney(*o.CertificateDeposit)
+	}
+	return nil
+}
+
+// lastTransaction returns the newest transaction of the order.
+func (db *DB) lastTransaction(orderID uint) (*transactionRow, error) {
+	o, ok := db.orders[orderID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	t, ok := db.transactions[o.TransactionID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+// transactionByBankID returns the transaction registered under the bank order id.
+func (db *DB) transactionByBankID(bankOrderID string) *transactionRow {
+	for _, id := range sortedIDs(db.transactions) {
+		if t := db.transactions[id]; bankOrderID != "" && t.BankOrderID == bankOrderID {
+			return t
+		}
+	}
+	return nil
+}
+
+func (s *OrderStore) CheckProjectPublished(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	p, ok := s.db.projects[projectID]
+	return ok && p.Status == "PUBLISHED"
+}
+
+func (s *OrderStore) CheckCountProjects(ctx context.Context, userID uint, countPassed uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return countPassed <= s.db.cartCopies(userID)
+}
+
+func (s *OrderStore) CheckProject(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.projects[projectID]
+	return ok
+}
+
+func (s *OrderStore) CheckOrder(ctx context.Context, orderID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.orders[orderID]
+	return ok
+}
+
+func (s *OrderStore) LoadCart(ctx context.Context, userID uint) (models.ResponseCart, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var responseCart models.ResponseCart
+	responseCart.Projects = []models.CartObj{}
+	c := s.db.cart(userID, false)
+	if c == nil {
+		return responseCart, nil
+	}
+	for _, item := range c.Items {
+		pID := item.ProjectID
+		p, ok := s.db.projects[pID]
+		if !ok {
+			continue
+		}
+		photobook := models.CartObj{
+			ProjectID:  pID,
+			Name:       p.Name,
+			Size:       p.Size,
+			Variant:    p.Variant,
+			Surface:    p.Surface,
+			Cover:      p.Cover,
+			CountPages: p.CountPages,
+			Quantity:   item.Quantity,
+		}
+		photobook.Breakdown = s.db.price(pID, item.Quantity, time.Now())
+		photobook.BasePrice = photobook.Breakdown.Total
+		book, _ := s.db.book(pID)
+		book.Quantity = item.Quantity
+		photobook.UpdatedPagesPrice, photobook.UpdatedCoverPrice, _ = s.db.catalog(time.Now()).Alternatives(book)
+		photobook.FrontPage = s.db.frontPage(pID, false)
+		for _, page := range s.db.projectPages(pID, false) {
+			if page.Type == "front" {
+				photobook.CoverBool = true
+			}
+		}
+		if p.Cover == "LEATHERETTE" {
+			var leatherID uint
+			if p.LeatherID != nil {
+				leatherID = *p.LeatherID
+			}
+			photobook.LeatherID = &leatherID
+		}
+		if p.Category != "" {
+			category := p.Category
+			photobook.Category = &category
+		}
+		responseCart.Projects = append(responseCart.Projects, photobook)
+	}
+	return responseCart, nil
+}
+
+func (s *OrderStore) CreateOrder(ctx context.Context, userID uint, order models.NewOrder) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.addToCart(userID, models.CartItem{ProjectID: order.ProjectID, Quantity: 1}), nil
+}
+
+func (s *OrderStore) AddCartItem(ctx context.Context, userID uint, item models.CartItem) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.addToCart(userID, item), nil
+}
+
+func (s *OrderStore) UpdateCartItem(ctx context.Context, userID uint, item models.CartItem) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c := s.db.cart(userID, false)
+	i := c.cartIndex(item.ProjectID)
+	if i < 0 {
+		return orderstorage.ErrNotInCart
+	}
+	c.Items[i].Quantity = item.Quantity
+	return nil
+}
+
+func (s *OrderStore) DeleteCartItem(ctx context.Context, userID uint, projectID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if !s.db.removeFromCart(userID, projectID) {
+		return orderstorage.ErrNotInCart
+	}
+	if p, ok := s.db.projects[projectID]; ok {
+		p.Status = "EDITED"
+	}
+	return nil
+}
+
+// OrderPayment mirrors orderstorage.OrderPayment, the checks come before any change so a refused checkout leaves nothing behind.
+func (s *OrderStore) OrderPayment(ctx context.Context, orderObj models.RequestOrderPayment, userID uint, deliveryPrice money.Money, warehouseID uint) (money.Money, uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := time.Now()
+	var depositPrice money.Money
+
+	breakdown, err := s.db.quoteCart(orderObj.Cart, orderObj.PackageBox)
+	if err != nil {
+		return depositPrice, 0, err
+	}
+	if orderObj.IdempotencyKey != "" {
+		if o := s.db.checkout(userID, orderObj.IdempotencyKey); o != nil {
+			return depositPrice, o.ID, orderstorage.ErrCheckoutRepeated
+		}
+	}
+	c := s.db.cart(userID, false)
+	for _, item := range orderObj.Cart {
+		if c.cartIndex(item.ProjectID) < 0 {
+			return depositPrice, 0, orderstorage.ErrNotInCart
+		}
+	}
+	var promooffersID uint
+	applied := promotions.Result{Breakdown: breakdown}
+	if orderObj.Promocode != "" {
+		p := s.db.promoByCode(orderObj.Promocode)
+		if p == nil {
+			return depositPrice, 0, promotions.ErrUnknownCode
+		}
+		err = promotions.Check(p.Promotion, s.db.usage(p.ID, userID), userID, t)
+		if errors.Is(err, promotions.ErrRedeemed) || errors.Is(err, promotions.ErrUserLimit) {
+			return depositPrice, 0, orderstorage.ErrPromocodeUnavailable
+		}
+		if err != nil {
+			return depositPrice, 0, err
+		}
+		applied, err = promotions.Apply(p.Promotion, promotions.Order{Books: s.db.promotionBooks(orderObj.Cart), Breakdown: breakdown, DeliveryPrice: deliveryPrice, Certificate: orderObj.Giftcertificate != ""})
+		if err != nil {
+			return depositPrice, 0, err
+		}
+		promooffersID = p.ID
+	}
+	deliveryPrice -= applied.DeliveryDiscount
+	var certificate *certificateRow
+	if orderObj.Giftcertificate != "" {
+		for _, id := range sortedIDs(s.db.certificates) {
+			if s.db.certificates[id].Code == orderObj.Giftcertificate {
+				certificate = s.db.certificates[id]
+			}
+		}
+		if certificate == nil || certificate.Status != "PAID" || certificate.Deposit == 0 {
+			return depositPrice, 0, orderstorage.ErrCertificateUnavailable
+		}
+	}
+
+	var usedDeposit money.Money
+	var giftcertificatesID uint
+	priceWithDelivery := breakdown.Total - applied.Discount + deliveryPrice
+	if certificate != nil {
+		depositPrice = money.Max(money.FromRoubles(1), priceWithDelivery-certificate.Deposit)
+		usedDeposit = priceWithDelivery - depositPrice
+		giftcertificatesID = certificate.ID
+		certificate.Status = "RESERVED"
+	} else {
+		depositPrice = priceWithDelivery
+	}
+
+	deliveryObj := orderObj.DeliveryData
+	d := &deliveryRow{
+		ID:          s.db.id("delivery"),
+		Status:      "DRAFT",
+		Method:      deliveryObj.Method,
+		Address:     deliveryObj.Address,
+		PostalCode:  deliveryObj.PostalCode,
+		Code:        deliveryObj.Code,
+		Amount:      deliveryPrice,
+		WarehouseID: warehouseID,
+	}
+	s.db.deliveries[d.ID] = d
+
+	o := &orderRow{
+		ID:                 s.db.id("orders"),
+		UserID:             userID,
+		Status:             "PAYMENT_IN_PROGRESS",
+		CreatedAt:          t,
+		LastEditedAt:       t,
+		Contacts:           orderObj.ContactData,
+		BasePrice:          copyMoney(breakdown.Total),
+		FinalPrice:         copyMoney(depositPrice),
+		PackageBox:         orderObj.PackageBox,
+		PromooffersID:      promooffersID,
+		GiftcertificatesID: giftcertificatesID,
+		CertificateDeposit: copyMoney(usedDeposit),
+		DeliveryID:         d.ID,
+		PriceListID:        breakdown.PriceListID,
+		IdempotencyKey:     orderObj.IdempotencyKey,
+	}
+	s.db.orders[o.ID] = o
+	s.db.addStatusHistory(o.ID, models.OrderStatusChange{FromStatus: orderstatus.AwaitingPayment, ToStatus: orderstatus.PaymentInProgress, Actor: orderstatus.ActorCustomer, UsersID: userID})
+
+	for _, item := range orderObj.Cart {
+		s.db.removeFromCart(userID, item.ProjectID)
+		s.db.addOrderProject(o.ID, item.ProjectID, item.Quantity)
+	}
+	if promooffersID != 0 {
+		r := &redemptionRow{ID: s.db.id("promotion_redemptions"), PromotionID: promooffersID, UserID: userID, OrderID: o.ID, Status: promotions.RedemptionReserved, Discount: applied.Discount + applied.DeliveryDiscount, CreatedAt: t}
+		s.db.redemptions[r.ID] = r
+	}
+	s.db.saveOrderItems(o.ID, applied.Breakdown)
+	return depositPrice, o.ID, nil
+}
+
+// checkout returns the order placed by the checkout of the user with the idempotency key.
+func (db *DB) checkout(userID uint, idempotencyKey string) *orderRow {
+	for _, id := range sortedIDs(db.orders) {
+		if o := db.orders[id]; o.UserID == userID && o.IdempotencyKey == idempotencyKey {
+			return o
+		}
+	}
+	return nil
+}
+
+// setRedemption moves the redemption of the order to the status, see promotions.Redeem and promotions.Release.
+func (db *DB) setRedemption(orderID uint, status string) {
+	for _, r := range db.redemptions {
+		if r.OrderID != orderID || r.Status == promotions.RedemptionReleased {
+			continue
+		}
+		if status == promotions.RedemptionRedeemed && r.Status != promotions.RedemptionReserved {
+			continue
+		}
+		r.Status = status
+	}
+}
+
+func (s *OrderStore) FindCheckout(ctx context.Context, userID uint, idempotencyKey string) (uint, string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o := s.db.checkout(userID, idempotencyKey)
+	if o == nil {
+		return 0, "", nil
+	}
+	if t, ok := s.db.transactions[o.TransactionID]; ok {
+		return o.ID, t.PaymentLink, nil
+	}
+	return o.ID, "", nil
+}
+
+func (s *OrderStore) CancelPayment(ctx context.Context, orderID uint, userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return ErrNotFound
+	}
+	if !orderstatus.CanTransition(o.Status, orderstatus.Cancelled) {
+		return orderstatus.ErrIllegalTransition
+	}
+	paid := o.Status == orderstatus.Paid
+	s.db.changeStatus(o, models.OrderStatusChange{FromStatus: o.Status, ToStatus: orderstatus.Cancelled, Actor: orderstatus.ActorCustomer, UsersID: userID, Reason: "payment cancelled"})
+	o.IdempotencyKey = ""
+	s.db.restoreCart(userID, orderID)
+	if t, ok := s.db.transactions[o.TransactionID]; ok {
+		t.Status = "REFUNDED"
+	}
+	if d, ok := s.db.deliveries[o.DeliveryID]; ok {
+		d.Status = "CANCELLED"
+	}
+	s.db.setRedemption(orderID, promotions.RedemptionReleased)
+	c, ok := s.db.certificates[o.GiftcertificatesID]
+	if ok && !paid && c.Status == "RESERVED" {
+		c.Status = "PAID"
+	}
+	if ok && paid && o.CertificateDeposit != nil && *o.CertificateDeposit != 0 {
+		c.Deposit += *o.CertificateDeposit
+	}
+	return nil
+}
+
+func (s *OrderStore) RetrieveOrders(ctx context.Context, userID uint, isActive bool, offset uint, limit uint) (models.ResponseOrders, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var rows []*orderRow
+	ids := sortedIDs(s.db.orders)
+	for i := len(ids) - 1; i >= 0; i-- {
+		o := s.db.orders[ids[i]]
+		if o.UserID == userID && activeOrderStatuses[o.Status] == isActive {
+			rows = append(rows, o)
+		}
+	}
+	orderset := models.ResponseOrders{Orders: []models.ResponseOrder{}, CountAll: len(rows)}
+	for _, o := range paginate(rows, offset, limit) {
+		orderObj := models.ResponseOrder{
+			OrderID:            o.ID,
+			Status:             o.Status,
+			CreatedAt:          o.CreatedAt.Unix(),
+			BasePrice:          o.BasePrice,
+			FinalPrice:         o.FinalPrice,
+			CertificateDeposit: certificateDeposit(o),
+		}
+		var deliveryAmount money.Money
+		if d, ok := s.db.deliveries[o.DeliveryID]; ok && o.Status == "IN_DELIVERY" {
+			orderObj.TrackingNumber = d.TrackingNumber
+			deliveryAmount = d.Amount
+		}
+		orderObj.PromocodeCategory, orderObj.PromocodeDiscountPercent, orderObj.PromocodeDiscount = s.db.promocodeDiscount(o, deliveryAmount)
+		orderObj.DeliveryPrice = copyMoney(deliveryAmount)
+		orderObj.Projects = s.db.paidCart(o.ID)
+		orderset.Orders = append(orderset.Orders, orderObj)
+	}
+	return orderset, nil
+}
+
+func (s *OrderStore) RetrieveSingleOrder(ctx context.Context, orderID uint) (models.ResponseOrder, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orderObj models.ResponseOrder
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return orderObj, ErrNotFound
+	}
+	orderObj.OrderID = o.ID
+	orderObj.Status = o.Status
+	orderObj.CreatedAt = o.CreatedAt.Unix()
+	orderObj.BasePrice = o.BasePrice
+	orderObj.FinalPrice = o.FinalPrice
+	orderObj.CertificateDeposit = certificateDeposit(o)
+	var deliveryAmount money.Money
+	if d, ok := s.db.deliveries[o.DeliveryID]; ok {
+		deliveryAmount = d.Amount
+	}
+	orderObj.DeliveryPrice = copyMoney(deliveryAmount)
+	orderObj.Items = append([]models.OrderItem(nil), s.db.orderItems[o.ID]...)
+	orderObj.Projects = s.db.paidCart(o.ID)
+	return orderObj, nil
+}
+
+func (s *OrderStore) RetrieveAdminOrders(ctx context.Context, userID uint, orderID uint, isActive bool, createdAfter uint, createdBefore uint, email string, status string, offset uint, limit uint) (models.ResponseAdminOrders, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	orderset := models.ResponseAdminOrders{Orders: []models.ResponseAdminOrder{}}
+	if email != "" {
+		u := s.db.userByEmail(email)
+		if u == nil {
+			return orderset, nil
+		}
+		userID = u.ID
+	}
+	var rows []*orderRow
+	ids := sortedIDs(s.db.orders)
+	for i := len(ids) - 1; i >= 0; i-- {
+		o := s.db.orders[ids[i]]
+		switch {
+		case activeOrderStatuses[o.Status] != isActive,
+			createdAfter != 0 && o.CreatedAt.Before(time.Unix(int64(createdAfter), 0)),
+			createdBefore != 0 && o.CreatedAt.After(time.Unix(int64(createdBefore), 0)),
+			orderID != 0 && o.ID != orderID,
+			userID != 0 && o.UserID != userID,
+			status != "" && o.Status != status:
+			continue
+		}
+		rows = append(rows, o)
+	}
+	orderset.CountAll = len(rows)
+	for _, o := range paginate(rows, offset, limit) {
+		orderObj := models.ResponseAdminOrder{
+			OrderID:            o.ID,
+			UserID:             o.UserID,
+			Status:             o.Status,
+			Commentary:         copyString(o.Commentary),
+			CreatedAt:          o.CreatedAt.Unix(),
+			BasePrice:          o.BasePrice,
+			FinalPrice:         o.FinalPrice,
+			VideoLink:          copyString(o.VideoLink),
+			CertificateDeposit: certificateDeposit(o),
+		}
+		if u, ok := s.db.users[o.UserID]; ok {
+			orderObj.Email = u.Email
+		}
+		var deliveryAmount money.Money
+		if d, ok := s.db.deliveries[o.DeliveryID]; ok {
+			trackingNumber := d.TrackingNumber
+			orderObj.TrackingNumber = &trackingNumber
+			if o.Status == "IN_DELIVERY" {
+				deliveryAmount = d.Amount
+			}
+		}
+		orderObj.DeliveryPrice = copyMoney(deliveryAmount)
+		orderObj.PromocodeCategory, orderObj.PromocodeDiscountPercent, orderObj.PromocodeDiscount = s.db.promocodeDiscount(o, deliveryAmount)
+		orderObj.Projects = s.db.paidCart(o.ID)
+		orderset.Orders = append(orderset.Orders, orderObj)
+	}
+	return orderset, nil
+}
+
+// orderInfo mirrors orderstorage.LoadOrder and orderstorage.AdminLoadOrder.
+func (db *DB) orderInfo(orderID uint) models.ResponseOrderInfo {
+	var orderObj models.ResponseOrderInfo
+	o, ok := db.orders[orderID]
+	if !ok {
+		return orderObj
+	}
+	orderObj.Status = o.Status
+	orderObj.UserID = o.UserID
+	orderObj.ContactData = o.Contacts
+	orderObj.GiftcertificateDeposit = o.CertificateDeposit
+	orderObj.TransactionID = o.TransactionID
+	if o.OriginalOrderID != 0 {
+		originalID := o.OriginalOrderID
+		orderObj.OriginalOrderID = &originalID
+	}
+	if d, ok := db.deliveries[o.DeliveryID]; ok {
+		orderObj.DeliveryData = models.Delivery{Method: d.Method, Address: d.Address, Code: d.Code, PostalCode: d.PostalCode, Amount: d.Amount}
+	}
+	if p, ok := db.promooffers[o.PromooffersID]; ok {
+		code := p.Code
+		orderObj.Promocode = &code
+		orderObj.PromocodeDiscountPercent = copyFloat(p.Discount)
+	}
+	for _, pID := range db.orderProjects[orderID] {
+		previewObj := models.PreviewObject{ProjectID: pID, Quantity: db.copies(orderID, pID)}
+		if p, ok := db.projects[pID]; ok {
+			previewObj.Name = p.Name
+		}
+		orderObj.Projects = append(orderObj.Projects, previewObj)
+	}
+	return orderObj
+}
+
+func (s *OrderStore) LoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.orderInfo(orderID), nil
+}
+
+func (s *OrderStore) AdminLoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	orderObj := s.db.orderInfo(orderID)
+	orderObj.Status = ""
+	orderObj.Promocode = nil
+	return orderObj, nil
+}
+
+func (s *OrderStore) LoadDelivery(ctx context.Context, orderID uint) (models.ResponseDeliveryInfo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orderObj models.ResponseDeliveryInfo
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return orderObj, ErrNotFound
+	}
+	orderObj.UserID = o.UserID
+	orderObj.ContactData = o.Contacts
+	d, ok := s.db.deliveries[o.DeliveryID]
+	if !ok {
+		return orderObj, ErrNotFound
+	}
+	address := d.Address
+	orderObj.DeliveryData = models.ResponseDelivery{Method: d.Method, Address: &address}
+	deliveryStatus, deliveryID := d.DeliveryStatus, d.DeliveryID
+	orderObj.DeliveryStatus = &deliveryStatus
+	orderObj.DeliveryID = &deliveryID
+	if d.WarehouseID != 0 {
+		warehouseID := d.WarehouseID
+		orderObj.WarehouseID = &warehouseID
+	}
+	if d.TrackingNumber != "" {
+		trackingNumber := d.TrackingNumber
+		orderObj.TrackingNumber = &trackingNumber
+	}
+	if !d.ExpectedFrom.IsZero() {
+		orderObj.ExpectedDeliveryFrom = d.ExpectedFrom.Unix()
+	}
+	if !d.ExpectedTo.IsZero() {
+		orderObj.ExpectedDeliveryTo = d.ExpectedTo.Unix()
+	}
+	return orderObj, nil
+}
+
+func (s *OrderStore) LoadOrderStatus(ctx context.Context, orderID uint) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return o.Status, nil
+}
+
+func (s *OrderStore) UpdateOrderStatus(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o, ok := s.db.orders[orderID]
+	if !ok || o.Status != change.FromStatus {
+		return orderstatus.ErrStatusChanged
+	}
+	s.db.changeStatus(o, change)
+	return nil
+}
+
+func (s *OrderStore) LoadOrderTimeline(ctx context.Context, orderID uint) ([]models.TimelineEvent, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var events []models.TimelineEvent
+	for _, id := range sortedIDs(s.db.statusHistory) {
+		if change := s.db.statusHistory[id]; change.OrdersID == orderID {
+			events = append(events, models.TimelineEvent{Category: orderstatus.StatusCategory(change.ToStatus), Code: change.ToStatus, HappenedAt: change.CreatedAt})
+		}
+	}
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return events, nil
+	}
+	if t, ok := s.db.transactions[o.TransactionID]; ok {
+		events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.PaymentRegistered, Amount: copyMoney(t.Amount), HappenedAt: t.CreatedAt.Unix()})
+		if !t.CapturedAt.IsZero() {
+			events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.PaymentCaptured, Amount: copyMoney(t.Amount), HappenedAt: t.CapturedAt.Unix()})
+		}
+	}
+	for _, id := range sortedIDs(s.db.refunds) {
+		if r := s.db.refunds[id]; r.OrderID == orderID && r.Status == "SUCCESSFUL" {
+			events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.RefundCompleted, Amount: copyMoney(r.Amount), HappenedAt: r.CreatedAt.Unix()})
+		}
+	}
+	if d, ok := s.db.deliveries[o.DeliveryID]; ok {
+		for _, status := range d.Statuses {
+			events = append(events, models.TimelineEvent{Category: orderstatus.CategoryDelivery, Code: status.Code, Description: status.Name, City: status.City, HappenedAt: status.HappenedAt})
+		}
+	}
+	if o.OriginalOrderID != 0 {
+		events = append(events, models.TimelineEvent{Category: orderstatus.CategoryComplaint, Code: orderstatus.ReprintCreated, LinkedOrderID: o.OriginalOrderID, HappenedAt: o.CreatedAt.Unix()})
+	}
+	for _, id := range sortedIDs(s.db.complaints) {
+		if c := s.db.complaints[id]; c.OrdersID == orderID {
+			events = append(events, orderstatus.ComplaintEvents(*c)...)
+		}
+	}
+	return events, nil
+}
+
+func (s *OrderStore) LoadOrderStatusHistory(ctx context.Context, orderID uint) (models.ResponseOrderStatusHistory, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	historyset := models.ResponseOrderStatusHistory{History: []models.OrderStatusChange{}}
+	for _, id := range sortedIDs(s.db.statusHistory) {
+		if change := s.db.statusHistory[id]; change.OrdersID == orderID {
+			historyset.History = append(historyset.History, *change)
+		}
+	}
+	return historyset, nil
+}
+
+func (s *OrderStore) UpdateOrderCommentary(ctx context.Context, orderID uint, commentaryObj models.RequestUpdateOrderCommentary) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if o, ok := s.db.orders[orderID]; ok {
+		commentary := commentaryObj.Commentary
+		o.Commentary = &commentary
+	}
+	return nil
+}
+
+func (s *OrderStore) UploadOrderVideo(ctx context.Context, orderID uint, videoObj models.OrderVideo) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if o, ok := s.db.orders[orderID]; ok {
+		videoLink := videoObj.VideoLink
+		o.VideoLink = &videoLink
+	}
+	return nil
+}
+
+func (s *OrderStore) DownloadOrderVideo(ctx context.Context, orderID uint) (models.OrderVideo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var videoObj models.OrderVideo
+	o, ok := s.db.orders[orderID]
+	if !ok || o.VideoLink == nil {
+		return videoObj, ErrNotFound
+	}
+	videoObj.VideoLink = *o.VideoLink
+	return videoObj, nil
+}
+
+func (s *OrderStore) UpdateTransaction(ctx context.Context, orderID uint, transaction models.ResponseTransaction, finalPrice money.Money, goodType string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := &transactionRow{
+		ID:          s.db.id("transactions"),
+		Status:      "INPROGRESS",
+		Type:        goodType,
+		Amount:      finalPrice,
+		BankOrderID: transaction.OrderID,
+		PaymentLink: transaction.FormURL,
+		CreatedAt:   time.Now(),
+	}
+	s.db.transactions[t.ID] = t
+	if goodType == "PHOTOBOOK" {
+		if o, ok := s.db.orders[orderID]; ok {
+			o.TransactionID = t.ID
+		}
+	} else if goodType == "CERTIFICATE" {
+		if c, ok := s.db.certificates[orderID]; ok {
+			c.TransactionID = transaction.OrderID
+		}
+	}
+	return nil
+}
+
+func (s *OrderStore) UpdateSuccessfulTransaction(ctx context.Context, orderID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, err := s.db.lastTransaction(orderID)
+	if err != nil {
+		return err
+	}
+	if t.Status == "SUCCESSFUL" {
+		return nil
+	}
+	o := s.db.orders[orderID]
+	if o.Status != orderstatus.PaymentInProgress {
+		t.Status = "UNSUCCESSFUL"
+		return orderstorage.ErrPaymentHeld
+	}
+	t.Status = "SUCCESSFUL"
+	s.db.changeStatus(o, models.OrderStatusChange{FromStatus: orderstatus.PaymentInProgress, ToStatus: orderstatus.Paid, Actor: orderstatus.ActorSystem, Reason: "payment received"})
+	s.db.setRedemption(orderID, promotions.RedemptionRedeemed)
+	if c, ok := s.db.certificates[o.GiftcertificatesID]; ok && o.CertificateDeposit != nil && *o.CertificateDeposit != 0 {
+		c.Deposit -= *o.CertificateDeposit
+		c.Status = "PAID"
+	}
+	return nil
+}
+
+func (s *OrderStore) UpdateUnSuccessfulTransaction(ctx context.Context, orderID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, err := s.db.lastTransaction(orderID)
+	if err != nil {
+		return err
+	}
+	t.Status = "UNSUCCESSFUL"
+	return nil
+}
+
+func (s *OrderStore) GetBankTransactionID(ctx context.Context, orderID uint) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if _, ok := s.db.orders[orderID]; !ok {
+		return "", ErrNotFound
+	}
+	t, err := s.db.lastTransaction(orderID)
+	if err != nil || t.BankOrderID == "" {
+		return "", orderstorage.ErrNoBankOrder
+	}
+	return t.BankOrderID, nil
+}
+
+func (s *OrderStore) LoadBankTransaction(ctx context.Context, bankOrderID string) (models.BankTransactionObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := s.db.transactionByBankID(bankOrderID)
+	if t == nil {
+		return models.BankTransactionObj{}, ErrNotFound
+	}
+	transaction := models.BankTransactionObj{TransactionsID: t.ID, Status: t.Status}
+	for _, oID := range sortedIDs(s.db.orders) {
+		if s.db.orders[oID].TransactionID == t.ID {
+			transaction.OrdersID = oID
+		}
+	}
+	for _, cID := range sortedIDs(s.db.certificates) {
+		if s.db.certificates[cID].TransactionID == bankOrderID {
+			transaction.GiftcertificatesID = cID
+		}
+	}
+	return transaction, nil
+}
+
+func (s *OrderStore) LoadPaidOrders(ctx context.Context) ([]models.PaidOrderObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orders []models.PaidOrderObj
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		if o.Status != "PAID" {
+			continue
+		}
+		orders = append(orders, models.PaidOrderObj{
+			OrdersID:     o.ID,
+			LastEditedAt: o.LastEditedAt,
+			Username:     o.Contacts.FirstName,
+			Email:        o.Contacts.Email,
+		})
+	}
+	return orders, nil
+}
+
+// OrdersToPrint mirrors orderstorage.OrdersToPrint, recording the order in PrintedOrders
+// instead of mailing the customer.
+func (s *OrderStore) OrdersToPrint(ctx context.Context, order models.PaidOrderObj) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if time.Since(order.LastEditedAt).Hours() < 0.5 {
+		return nil
+	}
+	o, ok := s.db.orders[order.OrdersID]
+	if !ok || o.Status != orderstatus.Paid {
+		return orderstatus.ErrStatusChanged
+	}
+	s.PrintedOrders = append(s.PrintedOrders, order)
+	s.db.changeStatus(o, models.OrderStatusChange{FromStatus: orderstatus.Paid, ToStatus: orderstatus.InPrint, Actor: orderstatus.ActorSystem})
+	return nil
+}
+
+func (s *OrderStore) LoadPendingPayments(ctx context.Context) ([]models.PendingPaymentObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var orders []models.PendingPaymentObj
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		if o.Status != "PAYMENT_IN_PROGRESS" {
+			continue
+		}
+		orders = append(orders, models.PendingPaymentObj{OrdersID: o.ID, LastEditedAt: o.LastEditedAt})
+	}
+	return orders, nil
+}
+
+func (s *OrderStore) ExpireOrderPayment(ctx context.Context, orderID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o, ok := s.db.orders[orderID]
+	if !ok || o.Status != "PAYMENT_IN_PROGRESS" {
+		return nil
+	}
+	s.db.changeStatus(o, models.OrderStatusChange{FromStatus: orderstatus.PaymentInProgress, ToStatus: orderstatus.Cancelled, Actor: orderstatus.ActorSystem, Reason: "payment expired"})
+	if tr, ok := s.db.transactions[o.TransactionID]; ok && tr.Status == "INPROGRESS" {
+		tr.Status = "UNSUCCESSFUL"
+	}
+	if d, ok := s.db.deliveries[o.DeliveryID]; ok {
+		d.Status = "CANCELLED"
+	}
+	if c, ok := s.db.certificates[o.GiftcertificatesID]; ok && c.Status == "RESERVED" {
+		c.Status = "PAID"
+	}
+	s.db.setRedemption(orderID, promotions.RedemptionReleased)
+	s.db.restoreCart(o.UserID, orderID)
+	return nil
+}
+
+// refundedAmount sums the refunds of the transaction that are not failed, or only the successful ones.
+func (db *DB) refundedAmount(transactionID uint, onlySuccessful bool) money.Money {
+	var refunded money.Money
+	for _, r := range db.refunds {
+		if r.TransactionID != transactionID || r.Status == "FAILED" || (onlySuccessful && r.Status != "SUCCESSFUL") {
+			continue
+		}
+		refunded += r.Amount
+	}
+	return refunded
+}
+
+func (s *OrderStore) LoadRefundableTransaction(ctx context.Context, orderID uint) (models.RefundableTransactionObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, err := s.db.lastTransaction(orderID)
+	if err != nil || t.Status != "SUCCESSFUL" {
+		return models.RefundableTransactionObj{}, ErrNotFound
+	}
+	return models.RefundableTransactionObj{
+		TransactionsID: t.ID,
+		BankOrderID:    t.BankOrderID,
+		Amount:         t.Amount,
+		RefundedAmount: s.db.refundedAmount(t.ID, false),
+	}, nil
+}
+
+func (s *OrderStore) CreateRefund(ctx context.Context, orderID uint, transactionID uint, refundObj models.RequestRefund) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, ok := s.db.transactions[transactionID]
+	if !ok || t.Status != "SUCCESSFUL" {
+		return 0, ErrNotFound
+	}
+	if s.db.refundedAmount(t.ID, false)+refundObj.Amount > t.Amount {
+		return 0, orderstorage.ErrRefundExceedsPayment
+	}
+	r := &refundRow{
+		ID:            s.db.id("refunds"),
+		OrderID:       orderID,
+		TransactionID: transactionID,
+		Amount:        refundObj.Amount,
+		Reason:        refundObj.Reason,
+		Status:        "PENDING",
+		CreatedAt:     time.Now(),
+	}
+	s.db.refunds[r.ID] = r
+	return r.ID, nil
+}
+
+func (s *OrderStore) CompleteRefund(ctx context.Context, refundID uint, succeeded bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	r, ok := s.db.refunds[refundID]
+	if !ok || r.Status != "PENDING" {
+		return nil
+	}
+	if !succeeded {
+		r.Status = "FAILED"
+		return nil
+	}
+	r.Status = "SUCCESSFUL"
+	t, ok := s.db.transactions[r.TransactionID]
+	if !ok || s.db.refundedAmount(t.ID, true) < t.Amount {
+		return nil
+	}
+	t.Status = "REFUNDED"
+	o, ok := s.db.orders[r.OrderID]
+	if !ok {
+		return nil
+	}
+	toStatus := orderstatus.Refunded
+	if !orderstatus.CanTransition(o.Status, toStatus) {
+		toStatus = orderstatus.Cancelled
+	}
+	if !orderstatus.CanTransition(o.Status, toStatus) {
+		return orderstatus.ErrIllegalTransition
+	}
+	s.db.changeStatus(o, models.OrderStatusChange{FromStatus: o.Status, ToStatus: toStatus, Actor: orderstatus.ActorAdmin, Reason: r.Reason})
+	s.db.setRedemption(o.ID, promotions.RedemptionReleased)
+	if c, ok := s.db.certificates[o.GiftcertificatesID]; ok && o.CertificateDeposit != nil {
+		c.Deposit += *o.CertificateDeposit
+	}
+	return nil
+}
+
+func (s *OrderStore) LoadRefunds(ctx context.Context, orderID uint) (models.ResponseRefunds, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	refundset := models.ResponseRefunds{Refunds: []models.Refund{}}
+	for _, id := range sortedIDs(s.db.refunds) {
+		r := s.db.refunds[id]
+		if r.OrderID != orderID {
+			continue
+		}
+		refundset.Refunds = append(refundset.Refunds, models.Refund{
+			RefundsID:      r.ID,
+			OrdersID:       r.OrderID,
+			TransactionsID: r.TransactionID,
+			Amount:         r.Amount,
+			Reason:         r.Reason,
+			Status:         r.Status,
+			CreatedAt:      r.CreatedAt.Unix(),
+		})
+	}
+	return refundset, nil
+}
+
+func (s *OrderStore) LoadPaidTransaction(ctx context.Context, orderID uint) (models.PaidTransactionObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, err := s.db.lastTransaction(orderID)
+	if err != nil || t.Status != "SUCCESSFUL" {
+		return models.PaidTransactionObj{}, orderstorage.ErrNoPaidTransaction
+	}
+	return models.PaidTransactionObj{
+		TransactionsID: t.ID,
+		BankOrderID:    t.BankOrderID,
+		Amount:         t.Amount,
+		BankStatus:     t.BankStatus,
+	}, nil
+}
+
+func (s *OrderStore) UpdateCapturedTransaction(ctx context.Context, transactionID uint, captureError string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, ok := s.db.transactions[transactionID]
+	if !ok {
+		return nil
+	}
+	if captureError == "" {
+		t.BankStatus = "CAPTURED"
+		t.CapturedAt = time.Now()
+		t.CaptureError = ""
+		return nil
+	}
+	t.BankStatus = "CAPTURE_FAILED"
+	t.CaptureError = captureError
+	return nil
+}
+
+func (s *OrderStore) LoadCaptureFailures(ctx context.Context) (models.ResponseCaptureFailures, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	failures := models.ResponseCaptureFailures{Orders: []models.CaptureFailure{}}
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		t, ok := s.db.transactions[o.TransactionID]
+		if o.Status != "PAID" || !ok || t.Status != "SUCCESSFUL" || t.BankStatus != "CAPTURE_FAILED" {
+			continue
+		}
+		failures.Orders = append(failures.Orders, models.CaptureFailure{
+			OrdersID:       o.ID,
+			TransactionsID: t.ID,
+			Amount:         t.Amount,
+			CaptureError:   t.CaptureError,
+			LastEditedAt:   o.LastEditedAt.Unix(),
+		})
+	}
+	return failures, nil
+}
+
+func (s *OrderStore) HoldTransaction(ctx context.Context, transactionID uint) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, ok := s.db.transactions[transactionID]
+	if !ok || t.BankStatus == "REVERSED" {
+		return false, nil
+	}
+	t.BankStatus = "HELD"
+	return true, nil
+}
+
+func (s *OrderStore) UpdateReversedTransaction(ctx context.Context, transactionID uint, reverseError string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, ok := s.db.transactions[transactionID]
+	if !ok {
+		return nil
+	}
+	if reverseError == "" {
+		t.BankStatus = "REVERSED"
+	}
+	t.ReverseError = reverseError
+	return nil
+}
+
+func (s *OrderStore) LoadHeldPayments(ctx context.Context) (models.ResponseHeldPayments, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	payments := models.ResponseHeldPayments{Payments: []models.HeldPayment{}}
+	for _, id := range sortedIDs(s.db.orders) {
+		o := s.db.orders[id]
+		t, ok := s.db.transactions[o.TransactionID]
+		if !ok || t.BankStatus != "HELD" {
+			continue
+		}
+		payments.Payments = append(payments.Payments, models.HeldPayment{
+			OrdersID:       o.ID,
+			TransactionsID: t.ID,
+			BankOrderID:    t.BankOrderID,
+			Amount:         t.Amount,
+			OrderStatus:    o.Status,
+			ReverseError:   t.ReverseError,
+			CreatedAt:      t.CreatedAt.Unix(),
+		})
+	}
+	return payments, nil
+}
+
+func (s *OrderStore) CreateReceipt(ctx context.Context, bankOrderID string, refundID uint, receipt models.Receipt) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := s.db.transactionByBankID(bankOrderID)
+	if t == nil {
+		return ErrNotFound
+	}
+	r := &receiptRow{
+		ID:            s.db.id("receipts"),
+		TransactionID: t.ID,
+		RefundID:      refundID,
+		Type:          "PAYMENT",
+		Receipt:       receipt,
+		CreatedAt:     time.Now(),
+	}
+	for _, item := range receipt.Items {
+		r.Amount += item.Amount
+	}
+	if refund, ok := s.db.refunds[refundID]; ok {
+		r.Type = "REFUND"
+		r.OrderID = refund.OrderID
+	} else {
+		for _, id := range sortedIDs(s.db.orders) {
+			if s.db.orders[id].TransactionID == t.ID {
+				r.OrderID = id
+			}
+		}
+	}
+	s.db.receipts[r.ID] = r
+	return nil
+}
+
+func (s *OrderStore) LoadPaymentReceipt(ctx context.Context, bankOrderID string) (models.Receipt, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := s.db.transactionByBankID(bankOrderID)
+	if t == nil {
+		return models.Receipt{}, ErrNotFound
+	}
+	ids := sortedIDs(s.db.receipts)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if r := s.db.receipts[ids[i]]; r.TransactionID == t.ID && r.Type == "PAYMENT" {
+			return r.Receipt, nil
+		}
+	}
+	return models.Receipt{}, ErrNotFound
+}
+
+func (s *OrderStore) LoadReceipts(ctx context.Context, orderID uint) (models.ResponseReceipts, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	receiptset := models.ResponseReceipts{Receipts: []models.StoredReceipt{}}
+	for _, id := range sortedIDs(s.db.receipts) {
+		if r := s.db.receipts[id]; r.OrderID == orderID {
+			receiptset.Receipts = append(receiptset.Receipts, storedReceipt(r))
+		}
+	}
+	return receiptset, nil
+}
+
+func (s *OrderStore) LoadReceipt(ctx context.Context, receiptID uint) (models.StoredReceipt, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	r, ok := s.db.receipts[receiptID]
+	if !ok {
+		return models.StoredReceipt{}, ErrNotFound
+	}
+	return storedReceipt(r), nil
+}
+
+func (s *OrderStore) MarkReceiptSent(ctx context.Context, receiptID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if r, ok := s.db.receipts[receiptID]; ok {
+		r.SentAt = time.Now()
+	}
+	return nil
+}
+
+func storedReceipt(r *receiptRow) models.StoredReceipt {
+	receipt := models.StoredReceipt{
+		ReceiptsID:     r.ID,
+		TransactionsID: r.TransactionID,
+		RefundsID:      r.RefundID,
+		Type:           r.Type,
+		Amount:         r.Amount,
+		CreatedAt:      r.CreatedAt.Unix(),
+		Receipt:        r.Receipt,
+	}
+	if !r.SentAt.IsZero() {
+		sentAt := r.SentAt.Unix()
+		receipt.SentAt = &sentAt
+	}
+	return receipt
+}
+
+func (s *OrderStore) CreateComplaint(ctx context.Context, orderID uint, userID uint, complaintObj models.RequestComplaint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c := &models.Complaint{
+		ComplaintsID: s.db.id("complaints"),
+		OrdersID:     orderID,
+		UsersID:      userID,
+		Reason:       complaintObj.Reason,
+		Description:  complaintObj.Description,
+		Photos:       append([]string{}, complaintObj.Photos...),
+		Status:       orderstatus.ComplaintOpen,
+		CreatedAt:    time.Now().Unix(),
+	}
+	s.db.complaints[c.ComplaintsID] = c
+	return c.ComplaintsID, nil
+}
+
+func (s *OrderStore) LoadComplaint(ctx context.Context, complaintID uint) (models.Complaint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.complaints[complaintID]
+	if !ok {
+		return models.Complaint{}, ErrNotFound
+	}
+	return *c, nil
+}
+
+func (s *OrderStore) LoadComplaints(ctx context.Context, orderID uint, status string) (models.ResponseComplaints, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	complaintset := models.ResponseComplaints{Complaints: []models.Complaint{}}
+	for _, id := range sortedIDs(s.db.complaints) {
+		c := s.db.complaints[id]
+		if (orderID == 0 || c.OrdersID == orderID) && (status == "" || c.Status == status) {
+			complaintset.Complaints = append(complaintset.Complaints, *c)
+		}
+	}
+	return complaintset, nil
+}
+
+// UpdateComplaintStatus mirrors orderstorage.UpdateComplaintStatus.
+func (s *OrderStore) UpdateComplaintStatus(ctx context.Context, complaintID uint, fromStatus string, toStatus string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.complaints[complaintID]
+	if !ok || c.Status != fromStatus {
+		return orderstatus.ErrStatusChanged
+	}
+	c.Status = toStatus
+	return nil
+}
+
+// ResolveComplaint mirrors orderstorage.ResolveComplaint.
+func (s *OrderStore) ResolveComplaint(ctx context.Context, complaint models.Complaint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.complaints[complaint.ComplaintsID]
+	if !ok || c.Status != orderstatus.ComplaintResolving {
+		return orderstatus.ErrStatusChanged
+	}
+	resolvedAt := time.Now().Unix()
+	c.Status = complaint.Status
+	c.Comment = complaint.Comment
+	c.ReprintOrderID = complaint.ReprintOrderID
+	c.RefundsID = complaint.RefundsID
+	c.ReturnDeliveryID = complaint.ReturnDeliveryID
+	c.ResolvedAt = &resolvedAt
+	return nil
+}
+
+// CreateReprintOrder mirrors orderstorage.CreateReprintOrder.
+func (s *OrderStore) CreateReprintOrder(ctx context.Context, orderID uint, change models.OrderStatusChange) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	o, ok := s.db.orders[orderID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	d, err := s.db.orderDelivery(orderID)
+	if err != nil {
+		return 0, err
+	}
+	t := time.Now()
+	reprintDelivery := &deliveryRow{
+		ID:          s.db.id("delivery"),
+		Status:      "DRAFT",
+		Method:      d.Method,
+		Address:     d.Address,
+		PostalCode:  d.PostalCode,
+		Code:        d.Code,
+		WarehouseID: d.WarehouseID,
+	}
+	s.db.deliveries[reprintDelivery.ID] = reprintDelivery
+	reprint := &orderRow{
+		ID:              s.db.id("orders"),
+		UserID:          o.UserID,
+		Status:          change.ToStatus,
+		CreatedAt:       t,
+		LastEditedAt:    t,
+		Contacts:        o.Contacts,
+		BasePrice:       copyMoney(0),
+		FinalPrice:      copyMoney(0),
+		PackageBox:      o.PackageBox,
+		DeliveryID:      reprintDelivery.ID,
+		OriginalOrderID: orderID,
+	}
+	s.db.orders[reprint.ID] = reprint
+	for _, pID := range s.db.orderProjects[orderID] {
+		s.db.addOrderProject(reprint.ID, pID, s.db.copies(orderID, pID))
+	}
+	for _, item := range s.db.orderItems[orderID] {
+		item.UnitPrice, item.Amount, item.Discount = 0, 0, 0
+		s.db.orderItems[reprint.ID] = append(s.db.orderItems[reprint.ID], item)
+	}
+	if len(s.db.orderItems[reprint.ID]) == 0 {
+		for _, pID := range s.db.orderProjects[orderID] {
+			s.db.saveOrderItems(reprint.ID, models.PriceBreakdown{Lines: []models.PriceLine{{Code: pricing.LineBase, ProjectID: pID, Quantity: s.db.copies(orderID, pID)}}})
+		}
+	}
+	s.db.addStatusHistory(reprint.ID, change)
+	return reprint.ID, nil
+}
@@ -0,0 +1,703 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
+)
+
+// ProjectStore is the in-memory implementation of projectstorage.ProjectStore.
+type ProjectStore struct {
+	db *DB
+}
+
+var _ projectstorage.ProjectStore = (*ProjectStore)(nil)
+
+// NewProjectStore returns a ProjectStore backed by db.
+func NewProjectStore(db *DB) *ProjectStore {
+	return &ProjectStore{db: db}
+}
+
+// projectPages returns the pages of a project or template ordered by sort.
+func (db *DB) projectPages(projectID uint, isTemplate bool) []*pageRow {
+	var pages []*pageRow
+	for _, id := range sortedIDs(db.pages) {
+		p := db.pages[id]
+		if p.ProjectID == projectID && p.IsTemplate == isTemplate {
+			pages = append(pages, p)
+		}
+	}
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Sort < pages[j].Sort })
+	return pages
+}
+
+func (db *DB) addPage(projectID uint, isTemplate bool, sort uint, ptype string, t time.Time) *pageRow {
+	page := &pageRow{
+		ID:           db.id("pages"),
+		ProjectID:    projectID,
+		IsTemplate:   isTemplate,
+		Type:         ptype,
+		Sort:         sort,
+		LastEditedAt: t,
+	}
+	db.pages[page.ID] = page
+	return page
+}
+
+// addBlankPages creates the front cover, 21 pages and the back cover of a new book.
+func (db *DB) addBlankPages(projectID uint, isTemplate bool, t time.Time) {
+	for num := uint(0); num <= 22; num++ {
+		ptype := "page"
+		if num == 0 {
+			ptype = "front"
+		} else if num == 22 {
+			ptype = "back"
+		}
+		db.addPage(projectID, isTemplate, num, ptype, t)
+	}
+}
+
+// copyPages clones the pages of one book into another, including the used photos.
+func (db *DB) copyPages(fromID uint, fromTemplate bool, toID uint, toTemplate bool, withImages bool, t time.Time) {
+	for _, page := range db.projectPages(fromID, fromTemplate) {
+		newPage := db.addPage(toID, toTemplate, page.Sort, page.Type, t)
+		newPage.Data = page.Data
+		if withImages || page.Type == "page" {
+			newPage.CreatingImageLink = copyString(page.CreatingImageLink)
+		}
+		if !fromTemplate || toTemplate {
+			db.pagePhotos[newPage.ID] = append([]uint{}, db.pagePhotos[page.ID]...)
+		}
+	}
+}
+
+func (db *DB) leatherLink(leatherID uint) *string {
+	if c, ok := db.leather[leatherID]; ok {
+		return copyString(&c.LeatherImage)
+	}
+	return nil
+}
+
+func (db *DB) pageModel(page *pageRow, leatherID *uint) models.Page {
+	p := models.Page{
+		PageID:            page.ID,
+		Type:              page.Type,
+		Sort:              page.Sort,
+		CreatingImageLink: copyString(page.CreatingImageLink),
+		PreviewImageLink:  copyString(page.PreviewImageLink),
+		Data:              page.Data,
+		UsedPhotoIDs:      append([]uint{}, db.pagePhotos[page.ID]...),
+	}
+	if leatherID != nil && *leatherID != 0 && page.Type != "page" {
+		p.CreatingImageLink = db.leatherLink(*leatherID)
+		p.PreviewImageLink = p.CreatingImageLink
+	}
+	return p
+}
+
+func (db *DB) pageModels(projectID uint, isTemplate bool, leatherID *uint) []models.Page {
+	var pages []models.Page
+	for _, page := range db.projectPages(projectID, isTemplate) {
+		pages = append(pages, db.pageModel(page, leatherID))
+	}
+	return pages
+}
+
+func (db *DB) templatePages(templateID uint) []models.TemplatePage {
+	var pages []models.TemplatePage
+	for _, page := range db.projectPages(templateID, true) {
+		p := db.pageModel(page, nil)
+		pages = append(pages, models.TemplatePage{
+			PageID:            p.PageID,
+			Type:              p.Type,
+			Sort:              p.Sort,
+			CreatingImageLink: p.CreatingImageLink,
+			PreviewImageLink:  p.PreviewImageLink,
+			UsedPhotoIDs:      p.UsedPhotoIDs,
+		})
+	}
+	return pages
+}
+
+func (db *DB) frontPage(projectID uint, isTemplate bool) models.FrontPage {
+	var page models.FrontPage
+	for _, p := range db.projectPages(projectID, isTemplate) {
+		if p.Type == "front" {
+			page.CreatingImageLink = copyString(p.CreatingImageLink)
+		}
+	}
+	if !isTemplate {
+		if p, ok := db.projects[projectID]; ok && p.Cover == "LEATHERETTE" {
+			var leatherID uint
+			if p.LeatherID != nil {
+				leatherID = *p.LeatherID
+			}
+			page.CreatingImageLink = db.leatherLink(leatherID)
+		}
+	}
+	return page
+}
+
+func (db *DB) pageCount(projectID uint, isTemplate bool) uint {
+	return uint(len(db.projectPages(projectID, isTemplate)))
+}
+
+func (db *DB) addEditor(projectID uint, userID uint, category string) {
+	if u, ok := db.users[userID]; ok {
+		db.editors = append(db.editors, editorRow{ProjectID: projectID, Email: u.Email, Category: category})
+	}
+}
+
+func (db *DB) deletePage(pageID uint, projectID uint, isTemplate bool) error {
+	page, ok := db.pages[pageID]
+	if !ok || page.ProjectID != projectID {
+		return ErrNotFound
+	}
+	delete(db.pages, pageID)
+	delete(db.pagePhotos, pageID)
+	for _, p := range db.projectPages(projectID, isTemplate) {
+		if p.Sort > page.Sort {
+			p.Sort--
+		}
+	}
+	if p, ok := db.projects[projectID]; ok && !isTemplate {
+		p.CountPages--
+	}
+	return nil
+}
+
+// filterTemplates returns templates matching the non-empty filters, newest first.
+func (db *DB) filterTemplates(tstatus string, tcategory string, tsize string) []*projectRow {
+	var templates []*projectRow
+	ids := sortedIDs(db.templates)
+	for i := len(ids) - 1; i >= 0; i-- {
+		t := db.templates[ids[i]]
+		if (tstatus == "" || t.Status == tstatus) && (tcategory == "" || t.Category == tcategory) && (tsize == "" || t.Size == tsize) {
+			templates = append(templates, t)
+		}
+	}
+	return templates
+}
+
+func (db *DB) templateModels(rows []*projectRow) []models.Template {
+	templates := []models.Template{}
+	for _, t := range rows {
+		templates = append(templates, models.Template{
+			TemplateID: t.ID,
+			Name:       t.Name,
+			Size:       t.Size,
+			Status:     t.Status,
+			FrontPage:  db.frontPage(t.ID, true),
+		})
+	}
+	return templates
+}
+
+func (db *DB) promocodeTemplates(tcategory string) models.ResponseTemplates {
+	rows := paginate(db.filterTemplates("PUBLISHED", tcategory, ""), 0, 3)
+	return models.ResponseTemplates{Templates: db.templateModels(rows), CountAll: 3}
+}
+
+func (s *ProjectStore) CheckPage(ctx context.Context, pageID uint, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	page, ok := s.db.pages[pageID]
+	return ok && page.ProjectID == projectID
+}
+
+func (s *ProjectStore) CheckCoverPage(ctx context.Context, pageID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	page, ok := s.db.pages[pageID]
+	return ok && (page.Type == "front" || page.Type == "back")
+}
+
+func (s *ProjectStore) CheckHardCover(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, page := range s.db.projectPages(projectID, false) {
+		if page.Type == "front" {
+			return page.CreatingImageLink != nil
+		}
+	}
+	return false
+}
+
+func (s *ProjectStore) CheckProjectPublished(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	p, ok := s.db.projects[projectID]
+	return ok && p.Status == "PUBLISHED"
+}
+
+func (s *ProjectStore) CheckLeatherID(ctx context.Context, leatherID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.leather[leatherID]
+	return ok
+}
+
+func (s *ProjectStore) CheckProjectNotCompleted(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, c := range s.db.carts {
+		for _, item := range c.Items {
+			if item.ProjectID == projectID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *ProjectStore) CheckTemplate(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	_, ok := s.db.templates[projectID]
+	return ok
+}
+
+func (s *ProjectStore) CheckTemplatePublished(ctx context.Context, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t, ok := s.db.templates[projectID]
+	return ok && t.Status == "PUBLISHED"
+}
+
+func (s *ProjectStore) CheckAllPagesPassed(ctx context.Context, slicePassed uint, projectID uint, isTemplate bool) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return slicePassed+2 == s.db.pageCount(projectID, isTemplate)
+}
+
+func (s *ProjectStore) CheckPagesRange(ctx context.Context, sort uint, projectID uint, isTemplate bool) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	countPage := s.db.pageCount(projectID, isTemplate)
+	return sort != 0 && sort+1 < countPage
+}
+
+func (s *ProjectStore) CreateProject(ctx context.Context, userID uint, projectObj models.NewBlankProjectObj) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := time.Now()
+	leatherID := projectObj.LeatherID
+	p := &projectRow{
+		ID:           s.db.id("projects"),
+		Name:         projectObj.Name,
+		Status:       "EDITED",
+		Size:         projectObj.Size,
+		Variant:      projectObj.Variant,
+		Cover:        projectObj.Cover,
+		Surface:      projectObj.Surface,
+		CountPages:   projectObj.CountPages,
+		LeatherID:    &leatherID,
+		LastEditedAt: t,
+		CreatedAt:    t,
+	}
+	if projectObj.TemplateID != 0 {
+		if tmpl, ok := s.db.templates[projectObj.TemplateID]; ok {
+			p.Category = tmpl.Category
+			p.CreatingSpineLink = copyString(tmpl.CreatingSpineLink)
+			p.PreviewSpineLink = copyString(tmpl.PreviewSpineLink)
+		}
+	}
+	s.db.projects[p.ID] = p
+	s.db.addEditor(p.ID, userID, models.OwnerCategory)
+	if projectObj.TemplateID != 0 {
+		s.db.copyPages(projectObj.TemplateID, true, p.ID, false, projectObj.Cover != "LEATHERETTE", t)
+	} else {
+		s.db.addBlankPages(p.ID, false, t)
+	}
+	return p.ID, nil
+}
+
+func (s *ProjectStore) DuplicateProject(ctx context.Context, projectID uint, userID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	orig, ok := s.db.projects[projectID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	t := time.Now()
+	p := *orig
+	p.ID = s.db.id("projects")
+	p.Name = "Копия_" + orig.Name
+	p.Status = "EDITED"
+	p.Category = ""
+	p.LeatherID = nil
+	p.LastEditedAt = t
+	p.CreatedAt = t
+	s.db.projects[p.ID] = &p
+	s.db.addEditor(p.ID, userID, models.OwnerCategory)
+	s.db.copyPages(projectID, false, p.ID, false, true, t)
+	return p.ID, nil
+}
+
+func (s *ProjectStore) CreateTemplate(ctx context.Context, name string, size string, category string) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	t := time.Now()
+	tmpl := &projectRow{
+		ID:           s.db.id("templates"),
+		Name:         name,
+		Status:       "EDITED",
+		Size:         size,
+		Category:     category,
+		LastEditedAt: t,
+		CreatedAt:    t,
+	}
+	s.db.templates[tmpl.ID] = tmpl
+	s.db.addBlankPages(tmpl.ID, true, t)
+	return tmpl.ID, nil
+}
+
+func (s *ProjectStore) DuplicateTemplate(ctx context.Context, templateID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	orig, ok := s.db.templates[templateID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	t := time.Now()
+	tmpl := *orig
+	tmpl.ID = s.db.id("templates")
+	tmpl.Name = "Копия_" + orig.Name
+	tmpl.Status = "EDITED"
+	tmpl.LastEditedAt = t
+	tmpl.CreatedAt = t
+	s.db.templates[tmpl.ID] = &tmpl
+	s.db.copyPages(templateID, true, tmpl.ID, true, true, t)
+	return tmpl.ID, nil
+}
+
+func (s *ProjectStore) UpdateTemplate(ctx context.Context, templateID uint, name string, category string) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if tmpl, ok := s.db.templates[templateID]; ok {
+		tmpl.Name = name
+		tmpl.Category = category
+	}
+	return templateID, nil
+}
+
+func (s *ProjectStore) setTemplateStatus(templateID uint, status string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if tmpl, ok := s.db.templates[templateID]; ok {
+		tmpl.Status = status
+	}
+	return nil
+}
+
+func (s *ProjectStore) PublishTemplate(ctx context.Context, templateID uint) error {
+	return s.setTemplateStatus(templateID, "PUBLISHED")
+}
+
+func (s *ProjectStore) UnpublishTemplate(ctx context.Context, templateID uint) error {
+	return s.setTemplateStatus(templateID, "EDITED")
+}
+
+func (s *ProjectStore) UnpublishProject(ctx context.Context, projectID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.projects[projectID]; ok {
+		p.Status = "EDITED"
+	}
+	return nil
+}
+
+func (s *ProjectStore) DeleteTemplate(ctx context.Context, tID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, page := range s.db.projectPages(tID, true) {
+		if err := s.db.deletePage(page.ID, tID, true); err != nil {
+			return err
+		}
+	}
+	delete(s.db.templates, tID)
+	return nil
+}
+
+func (s *ProjectStore) RetrieveUserProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	projectset := models.ResponseProjects{Projects: []models.ResponseProject{}}
+	u, ok := s.db.users[userID]
+	if !ok {
+		return projectset, ErrNotFound
+	}
+	var owned []uint
+	for _, e := range s.db.editors {
+		if e.Email == u.Email && e.Category == models.OwnerCategory {
+			owned = append(owned, e.ProjectID)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i] > owned[j] })
+	for _, pID := range owned {
+		if p, ok := s.db.projects[pID]; ok && p.Status != "PRINTED" {
+			projectset.CountAll++
+		}
+	}
+	for _, pID := range paginate(owned, offset, limit) {
+		p, ok := s.db.projects[pID]
+		if !ok || (p.Status != "EDITED" && p.Status != "PUBLISHED") {
+			continue
+		}
+		name := p.Name
+		projectset.Projects = append(projectset.Projects, models.ResponseProject{
+			ProjectID: pID,
+			Name:      &name,
+			Status:    p.Status,
+			Size:      p.Size,
+			Cover:     p.Cover,
+			Pages:     s.db.pageModels(pID, false, p.LeatherID),
+		})
+	}
+	return projectset, nil
+}
+
+func (s *ProjectStore) RetrieveAdminProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	projectset := models.ResponseProjects{Projects: []models.ResponseProject{}}
+	var published []uint
+	ids := sortedIDs(s.db.projects)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if s.db.projects[ids[i]].Status == "PUBLISHED" {
+			published = append(published, ids[i])
+		}
+	}
+	projectset.CountAll = len(published)
+	for _, pID := range paginate(published, offset, limit) {
+		name := s.db.projects[pID].Name
+		projectset.Projects = append(projectset.Projects, models.ResponseProject{ProjectID: pID, Name: &name})
+	}
+	return projectset, nil
+}
+
+func (s *ProjectStore) UpdateNewUserProjects(ctx context.Context, email string, userID uint) error {
+	// users_edit_projects rows are matched by email here, so there is no user id to backfill.
+	return nil
+}
+
+func (s *ProjectStore) LoadProject(ctx context.Context, pID uint) (models.ResponseProjectObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var projectObj models.ResponseProjectObj
+	p, ok := s.db.projects[pID]
+	if !ok {
+		return projectObj, nil
+	}
+	projectObj.Name = p.Name
+	projectObj.Size = p.Size
+	projectObj.Variant = p.Variant
+	projectObj.Cover = p.Cover
+	projectObj.CreatingSpineLink = copyString(p.CreatingSpineLink)
+	projectObj.PreviewSpineLink = copyString(p.PreviewSpineLink)
+	projectObj.LastEditedAt = p.LastEditedAt.Unix()
+	projectObj.CreatedAt = p.CreatedAt.Unix()
+	return projectObj, nil
+}
+
+func (s *ProjectStore) DeleteProject(ctx context.Context, pID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, page := range s.db.projectPages(pID, false) {
+		delete(s.db.pages, page.ID)
+		delete(s.db.pagePhotos, page.ID)
+	}
+	editors := s.db.editors[:0]
+	for _, e := range s.db.editors {
+		if e.ProjectID != pID {
+			editors = append(editors, e)
+		}
+	}
+	s.db.editors = editors
+	delete(s.db.projects, pID)
+	return nil
+}
+
+func (s *ProjectStore) loadTemplate(pID uint, publishedOnly bool) (models.SavedTemplateObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var projectObj models.SavedTemplateObj
+	tmpl, ok := s.db.templates[pID]
+	if !ok || (publishedOnly && tmpl.Status != "PUBLISHED") {
+		return projectObj, ErrNotFound
+	}
+	projectObj.Name = tmpl.Name
+	projectObj.Size = tmpl.Size
+	projectObj.CreatingSpineLink = copyString(tmpl.CreatingSpineLink)
+	projectObj.PreviewSpineLink = copyString(tmpl.PreviewSpineLink)
+	projectObj.LastEditedAt = tmpl.LastEditedAt.Unix()
+	projectObj.CreatedAt = tmpl.CreatedAt.Unix()
+	projectObj.Pages = s.db.templatePages(pID)
+	return projectObj, nil
+}
+
+func (s *ProjectStore) LoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error) {
+	return s.loadTemplate(pID, true)
+}
+
+func (s *ProjectStore) AdminLoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error) {
+	return s.loadTemplate(pID, false)
+}
+
+func (s *ProjectStore) RetrieveProjectPages(ctx context.Context, projectID uint, isTemplate bool, leatherID *uint) ([]models.Page, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.pageModels(projectID, isTemplate, leatherID), nil
+}
+
+func (s *ProjectStore) RetrieveFrontPage(ctx context.Context, projectID uint, isTemplate bool) (models.FrontPage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.frontPage(projectID, isTemplate), nil
+}
+
+func (s *ProjectStore) SavePage(ctx context.Context, page models.SavePage) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.pages[page.PageID]; ok {
+		p.PreviewImageLink = copyString(page.PreviewImageLink)
+		p.CreatingImageLink = copyString(page.CreatingImageLink)
+		p.Data = append([]byte{}, page.Data...)
+		p.LastEditedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *ProjectStore) AddProjectPage(ctx context.Context, projectID uint, sort uint, isTemplate bool) (models.OrderPage, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	for _, p := range s.db.projectPages(projectID, isTemplate) {
+		if p.Sort >= sort {
+			p.Sort++
+		}
+	}
+	page := s.db.addPage(projectID, isTemplate, sort, "page", time.Now())
+	if p, ok := s.db.projects[projectID]; ok && !isTemplate {
+		p.CountPages++
+	}
+	return models.OrderPage{PageID: page.ID, Sort: sort}, nil
+}
+
+func (s *ProjectStore) DuplicatePage(ctx context.Context, duplicateID uint, pageID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	from, ok := s.db.pages[duplicateID]
+	to, ok2 := s.db.pages[pageID]
+	if !ok || !ok2 {
+		return nil
+	}
+	to.PreviewImageLink = copyString(from.PreviewImageLink)
+	to.CreatingImageLink = copyString(from.CreatingImageLink)
+	to.Data = from.Data
+	s.db.pagePhotos[pageID] = append(s.db.pagePhotos[pageID], s.db.pagePhotos[duplicateID]...)
+	return nil
+}
+
+func (s *ProjectStore) DeletePage(ctx context.Context, pageID uint, projectID uint, isTemplate bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.deletePage(pageID, projectID, isTemplate)
+}
+
+func (s *ProjectStore) ReorderPage(ctx context.Context, pageID uint, projectID uint, sort uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.pages[pageID]; ok {
+		p.Sort = sort
+	}
+	return nil
+}
+
+func (s *ProjectStore) RetrieveTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	templateset := models.ResponseTemplates{Templates: []models.Template{}}
+	if tstatus != "PUBLISHED" && tstatus != "EDITED" {
+		return templateset, nil
+	}
+	rows := s.db.filterTemplates(tstatus, tcategory, tsize)
+	templateset.Templates = s.db.templateModels(paginate(rows, offset, limit))
+	templateset.CountAll = len(rows)
+	return templateset, nil
+}
+
+func (s *ProjectStore) RetrieveAdminTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if tstatus != "PUBLISHED" && tstatus != "EDITED" {
+		tstatus = ""
+	}
+	rows := s.db.filterTemplates(tstatus, tcategory, tsize)
+	return models.ResponseTemplates{
+		Templates: s.db.templateModels(paginate(rows, offset, limit)),
+		CountAll:  len(rows),
+	}, nil
+}
+
+func (s *ProjectStore) SavePagePhotos(ctx context.Context, pageID uint, photoIDS []uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.pagePhotos[pageID] = append([]uint{}, photoIDS...)
+	return nil
+}
+
+func (s *ProjectStore) AddViewer(ctx context.Context, projectID uint, email string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.editors = append(s.db.editors, editorRow{ProjectID: projectID, Email: email, Category: models.ViewerCategory})
+	return nil
+}
+
+func (s *ProjectStore) UpdateCover(ctx context.Context, pID uint, newC models.UpdateCover) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.projects[pID]; ok {
+		leatherID := newC.LeatherID
+		p.Cover = newC.Cover
+		p.LeatherID = &leatherID
+	}
+	return nil
+}
+
+func (s *ProjectStore) UpdateSurface(ctx context.Context, pID uint, newS models.UpdateSurface) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.projects[pID]; ok {
+		p.Surface = newS.Surface
+	}
+	return nil
+}
+
+func (s *ProjectStore) SaveSpine(ctx context.Context, newS models.SavedSpine, pID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if p, ok := s.db.projects[pID]; ok {
+		p.CreatingSpineLink = copyString(newS.CreatingSpineLink)
+		p.PreviewSpineLink = copyString(newS.PreviewSpineLink)
+	}
+	return nil
+}
+
+func (s *ProjectStore) SaveTemplateSpine(ctx context.Context, newS models.SavedSpine, pID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if tmpl, ok := s.db.templates[pID]; ok {
+		tmpl.CreatingSpineLink = copyString(newS.CreatingSpineLink)
+		tmpl.PreviewSpineLink = copyString(newS.PreviewSpineLink)
+	}
+	return nil
+}
+
+func (s *ProjectStore) LoadPromocodeTemplates(ctx context.Context, tcategory string) (models.ResponseTemplates, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.promocodeTemplates(tcategory), nil
+}
@@ -0,0 +1,499 @@
+package memstore
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/emailutils"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/promotions"
+	"github.com/SiberianMonster/memoryprint/internal/userstorage"
+)
+
+// UserStore is the in-memory implementation of userstorage.UserStore.
+type UserStore struct {
+	db *DB
+	// SentCertificates collects the certificates MailCertificate would have mailed.
+	SentCertificates []models.GiftCertificate
+}
+
+var _ userstorage.UserStore = (*UserStore)(nil)
+
+// NewUserStore returns a UserStore backed by db.
+func NewUserStore(db *DB) *UserStore {
+	return &UserStore{db: db}
+}
+
+func (db *DB) userByEmail(email string) *userRow {
+	for _, id := range sortedIDs(db.users) {
+		if db.users[id].Email == email {
+			return db.users[id]
+		}
+	}
+	return nil
+}
+
+// cartCopies returns the number of the copies of the projects in the cart of the user.
+func (db *DB) cartCopies(userID uint) uint {
+	var copies uint
+	if c, ok := db.carts[userID]; ok {
+		for _, item := range c.Items {
+			copies += uint(item.Quantity)
+		}
+	}
+	return copies
+}
+
+func (s *UserStore) CheckUser(ctx context.Context, email string) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.userByEmail(email) != nil
+}
+
+func (s *UserStore) CheckUserHasProject(ctx context.Context, userID uint, projectID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	u, ok := s.db.users[userID]
+	if !ok {
+		return false
+	}
+	if u.Category == models.AdminCategory {
+		return true
+	}
+	for _, e := range s.db.editors {
+		if e.ProjectID == projectID && e.Email == u.Email {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *UserStore) CheckUserHasOrder(ctx context.Context, userID uint, orderID uint) bool {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[userID]; ok && u.Category == models.AdminCategory {
+		return true
+	}
+	o, ok := s.db.orders[orderID]
+	return ok && o.UserID == userID
+}
+
+func (s *UserStore) GetUserData(ctx context.Context, userID uint) (models.UserInfo, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var dbUser models.UserInfo
+	u, ok := s.db.users[userID]
+	if !ok {
+		return dbUser, ErrNotFound
+	}
+	dbUser.ID = u.ID
+	dbUser.Name = u.Name
+	dbUser.Email = u.Email
+	dbUser.TokenHash = u.TokenHash
+	dbUser.CartObjects = s.db.cartCopies(userID)
+	return dbUser, nil
+}
+
+func (s *UserStore) GetUserID(ctx context.Context, userEmail string) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	u := s.db.userByEmail(userEmail)
+	if u == nil {
+		return 0, ErrNotFound
+	}
+	return u.ID, nil
+}
+
+func (s *UserStore) CreateUser(ctx context.Context, u models.SignUpUser) (uint, error) {
+	tokenHash := emailutils.GenerateRandomString(15)
+	pwdHash, err := userstorage.Hash(fmt.Sprintf("%s:password", u.Password), tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if s.db.userByEmail(u.Email) != nil {
+		return 0, fmt.Errorf("memstore: user %s already exists", u.Email)
+	}
+	t := time.Now()
+	row := &userRow{
+		ID:           s.db.id("users"),
+		Name:         u.Name,
+		Password:     pwdHash,
+		Email:        u.Email,
+		TokenHash:    tokenHash,
+		Category:     models.CustomerCategory,
+		Status:       models.UnverifiedStatus,
+		Subscription: true,
+		LastEditedAt: t,
+		CreatedAt:    t,
+	}
+	s.db.users[row.ID] = row
+	return row.ID, nil
+}
+
+func (s *UserStore) UpdateUser(ctx context.Context, password string, userID uint) error {
+	tokenHash := emailutils.GenerateRandomString(15)
+	pwdHash, err := userstorage.Hash(fmt.Sprintf("%s:password", password), tokenHash)
+	if err != nil {
+		return err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[userID]; ok {
+		u.Password = pwdHash
+		u.TokenHash = tokenHash
+		u.LastEditedAt = time.Now()
+	}
+	return nil
+}
+
+func userCredentials(u *userRow) models.User {
+	return models.User{ID: u.ID, Name: u.Name, Email: u.Email, Password: u.Password, TokenHash: u.TokenHash}
+}
+
+func (s *UserStore) CheckCredentials(ctx context.Context, u models.User) (models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	row := s.db.userByEmail(u.Email)
+	if row == nil {
+		return models.User{}, ErrNotFound
+	}
+	return userCredentials(row), nil
+}
+
+func (s *UserStore) CheckCredentialsByID(ctx context.Context, userID uint) (models.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	row, ok := s.db.users[userID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return userCredentials(row), nil
+}
+
+func (s *UserStore) CheckUserCategory(ctx context.Context, userID uint) (string, string, string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	u, ok := s.db.users[userID]
+	if !ok {
+		return "", "", "", ErrNotFound
+	}
+	return u.Category, u.Name, u.Email, nil
+}
+
+func (s *UserStore) MakeUserAdmin(ctx context.Context, userID uint) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[userID]; ok {
+		u.Category = models.AdminCategory
+	}
+}
+
+func (s *UserStore) UpdateUsername(ctx context.Context, userName string, userID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u, ok := s.db.users[userID]; ok {
+		u.Name = userName
+	}
+	return nil
+}
+
+func (s *UserStore) CreateCertificate(ctx context.Context, c *models.GiftCertificate) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	row := &certificateRow{
+		GiftCertificate: *c,
+		InitialDeposit:  c.Deposit,
+		Status:          "CREATED",
+		CreatedAt:       time.Now(),
+	}
+	row.ID = s.db.id("giftcertificates")
+	row.Code = userstorage.GenerateRandomString(12)
+	s.db.certificates[row.ID] = row
+	return row.ID, nil
+}
+
+func (s *UserStore) CreatePromooffer(ctx context.Context, p *models.NewPromooffer) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	row := &promoRow{
+		Promotion: promotions.Promotion{
+			ID:                  s.db.id("promooffers"),
+			Code:                p.Code,
+			Type:                p.DiscountType,
+			Discount:            p.Discount,
+			Amount:              p.Amount,
+			Category:            p.Category,
+			MinOrderValue:       p.MinOrderValue,
+			MaxRedemptions:      p.MaxRedemptions,
+			PerUserLimit:        p.PerUserLimit,
+			StartsAt:            p.StartsAt,
+			ExpiresAt:           p.ExpiresAt,
+			UsersID:             uint(p.UsersID),
+			Sizes:               p.Sizes,
+			Variants:            p.Variants,
+			Covers:              p.Covers,
+			ExcludesCertificate: p.ExcludesCertificate,
+		},
+		IsOnetime: p.IsOnetime,
+	}
+	if row.Type == "" {
+		row.Type = promotions.TypePercent
+	}
+	if p.IsOnetime {
+		row.MaxRedemptions = 1
+	}
+	s.db.promooffers[row.ID] = row
+	return nil
+}
+
+func (db *DB) promoByCode(code string) *promoRow {
+	for _, id := range sortedIDs(db.promooffers) {
+		if db.promooffers[id].Code == code {
+			return db.promooffers[id]
+		}
+	}
+	return nil
+}
+
+// usage counts the redemptions of the promotion which are reserved or redeemed, in total and by the user.
+func (db *DB) usage(promotionID uint, userID uint) promotions.Usage {
+	var usage promotions.Usage
+	for _, r := range db.redemptions {
+		if r.PromotionID != promotionID || r.Status == promotions.RedemptionReleased {
+			continue
+		}
+		usage.Redemptions++
+		if r.UserID == userID {
+			usage.UserRedemptions++
+		}
+	}
+	return usage
+}
+
+// promotionBooks returns what the targeting of the promotions depends on for the projects of the cart.
+func (db *DB) promotionBooks(cart []models.CartItem) []promotions.Book {
+	books := make([]promotions.Book, 0, len(cart))
+	for _, item := range cart {
+		book := promotions.Book{ProjectID: item.ProjectID}
+		if p, ok := db.projects[item.ProjectID]; ok {
+			book.Category, book.Size, book.Variant, book.Cover = p.Category, p.Size, p.Variant, p.Cover
+		}
+		books = append(books, book)
+	}
+	return books
+}
+
+func (s *UserStore) CheckPromocode(ctx context.Context, code string, usersID uint) (models.CheckPromocode, string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var promooffer models.CheckPromocode
+	p := s.db.promoByCode(code)
+	if p == nil {
+		return promooffer, "INVALID", nil
+	}
+	status := promotions.Status(promotions.Check(p.Promotion, s.db.usage(p.ID, usersID), usersID, time.Now()))
+	if status == "VALID" {
+		promooffer.Promocode = promotions.Describe(p.Promotion)
+	}
+	return promooffer, status, nil
+}
+
+func (s *UserStore) UsePromocode(ctx context.Context, requestP models.RequestPromooffer) (models.ResponsePromocodeUse, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.usePromocode(requestP)
+}
+
+// usePromocode mirrors userstorage.UsePromocode.
+func (db *DB) usePromocode(requestP models.RequestPromooffer) (models.ResponsePromocodeUse, error) {
+	var responseP models.ResponsePromocodeUse
+	breakdown, err := db.quoteCart(requestP.Cart, requestP.PackageBox)
+	if err != nil {
+		return responseP, err
+	}
+	responseP.BasePrice = breakdown.Total
+	responseP.DiscountedPrice = breakdown.Total
+	responseP.Breakdown = breakdown
+	if requestP.Code == "" {
+		return responseP, nil
+	}
+	p := db.promoByCode(requestP.Code)
+	if p == nil {
+		return responseP, promotions.ErrUnknownCode
+	}
+	result, err := promotions.Apply(p.Promotion, promotions.Order{Books: db.promotionBooks(requestP.Cart), Breakdown: breakdown, Certificate: requestP.Giftcertificate != ""})
+	if err != nil {
+		return responseP, err
+	}
+	responseP.PromocodeID = p.ID
+	responseP.DiscountType = p.Type
+	responseP.Discount = p.Discount
+	responseP.Amount = p.Amount
+	responseP.FreeShipping = p.Type == promotions.TypeFreeShipping
+	responseP.Category = p.Category
+	responseP.DiscountedPrice = breakdown.Total - result.Discount
+	responseP.Breakdown = result.Breakdown
+	return responseP, nil
+}
+
+func (s *UserStore) UseCertificate(ctx context.Context, code string, userID uint) (money.Money, string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.useCertificate(code, userID)
+}
+
+// useCertificate mirrors userstorage.UseCertificate.
+func (db *DB) useCertificate(code string, userID uint) (money.Money, string, error) {
+	u, ok := db.users[userID]
+	if !ok {
+		return 0, "INVALID", ErrNotFound
+	}
+	for _, id := range sortedIDs(db.certificates) {
+		c := db.certificates[id]
+		if c.Code != code {
+			continue
+		}
+		switch {
+		case c.Recipientemail != u.Email:
+			return 0, "INVALID", nil
+		case c.Deposit == 0 || c.Status == "RESERVED":
+			return 0, "DEPLETED", nil
+		case c.Status == "PAID":
+			return c.Deposit, "ACTIVE", nil
+		}
+		return 0, "INVALID", nil
+	}
+	return 0, "INVALID", nil
+}
+
+func (s *UserStore) LoadPromocodes(ctx context.Context) ([]models.Promooffer, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	promocodes := []models.Promooffer{}
+	now := time.Now()
+	for _, id := range sortedIDs(s.db.promooffers) {
+		p := s.db.promooffers[id]
+		if p.UsersID != 0 || p.StartsAt > now.Unix() || !now.Before(time.Unix(p.ExpiresAt, 0)) {
+			continue
+		}
+		promocodes = append(promocodes, models.Promooffer{
+			Code:         p.Code,
+			DiscountType: p.Type,
+			Discount:     p.Discount,
+			Amount:       p.Amount,
+			Category:     p.Category,
+			ExpiresAt:    p.ExpiresAt,
+			Templates:    s.db.promocodeTemplates(p.Category).Templates,
+		})
+	}
+	return promocodes, nil
+}
+
+func (s *UserStore) LoadUnSentCertificate(ctx context.Context) ([]models.GiftCertificate, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var certificates []models.GiftCertificate
+	for _, id := range sortedIDs(s.db.certificates) {
+		if c := s.db.certificates[id]; !c.MailSent && (c.Status == "PAID" || c.Status == "RESERVED") {
+			certificates = append(certificates, c.GiftCertificate)
+		}
+	}
+	return certificates, nil
+}
+
+func (s *UserStore) MailCertificate(ctx context.Context, certificate models.GiftCertificate) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if time.Now().Before(time.Unix(certificate.MailAt, 0)) {
+		return nil
+	}
+	if c, ok := s.db.certificates[certificate.ID]; ok {
+		c.MailSent = true
+	}
+	s.SentCertificates = append(s.SentCertificates, certificate)
+	return nil
+}
+
+func (s *UserStore) GetCertificateBankTransactionID(ctx context.Context, cID uint) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.certificates[cID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	if c.TransactionID == "" {
+		return "", userstorage.ErrNoBankOrder
+	}
+	return c.TransactionID, nil
+}
+
+func (s *UserStore) PurchaseCertificate(ctx context.Context, cID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.certificates[cID]
+	if !ok || c.Status != "CREATED" {
+		return nil
+	}
+	c.Status = "PAID"
+	if t := s.db.transactionByBankID(c.TransactionID); t != nil {
+		t.Status = "SUCCESSFUL"
+	}
+	return nil
+}
+
+func (s *UserStore) CancelCertificatePayment(ctx context.Context, cID uint) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	c, ok := s.db.certificates[cID]
+	if !ok || c.Status != "CREATED" {
+		return nil
+	}
+	c.Status = "CANCELLED"
+	if t := s.db.transactionByBankID(c.TransactionID); t != nil && t.Status == "INPROGRESS" {
+		t.Status = "UNSUCCESSFUL"
+	}
+	return nil
+}
+
+func (s *UserStore) LoadPendingCertificates(ctx context.Context) ([]models.PendingCertificateObj, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	var certificates []models.PendingCertificateObj
+	for _, id := range sortedIDs(s.db.certificates) {
+		if c := s.db.certificates[id]; c.Status == "CREATED" {
+			certificates = append(certificates, models.PendingCertificateObj{GiftcertificatesID: id, CreatedAt: c.CreatedAt})
+		}
+	}
+	return certificates, nil
+}
+
+func (s *UserStore) setSubscription(code string, iv string, subscription bool) error {
+	email, err := userstorage.GetAESDecrypted(code, iv)
+	if err != nil {
+		return err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	if u := s.db.userByEmail(email); u != nil {
+		u.Subscription = subscription
+	}
+	return nil
+}
+
+func (s *UserStore) CancelSubscription(ctx context.Context, code string, iv string) error {
+	return s.setSubscription(code, iv, false)
+}
+
+func (s *UserStore) RenewSubscription(ctx context.Context, code string, iv string) error {
+	return s.setSubscription(code, iv, true)
+}
+
+func (s *UserStore) GetCart(ctx context.Context, userID uint) (uint, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	return s.db.cartCopies(userID), nil
+}
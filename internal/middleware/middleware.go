@@ -14,6 +14,16 @@ import (
 	"net/http"
 )
 
+// Auth holds the user storage the authentication middlewares look users up in.
+type Auth struct {
+	Users userstorage.UserStore
+}
+
+// NewAuth returns the authentication middlewares backed by the given user storage.
+func NewAuth(users userstorage.UserStore) *Auth {
+	return &Auth{Users: users}
+}
+
 func extractToken(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	authHeaderContent := strings.Split(authHeader, " ")
@@ -29,7 +39,7 @@ func MiddlewareCORSHeaders(next http.Handler) http.Handler {
 			w.Header().Set("Access-Control-Allow-Origin", origin)
 		}		
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Idempotency-Key")
 		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		log.Printf("Setting headers:")
@@ -49,7 +59,7 @@ func MiddlewareCORSHeaders(next http.Handler) http.Handler {
 
 // MiddlewareValidateAccessToken validates whether the request contains a bearer token
 // it also decodes and authenticates the given token
-func MiddlewareValidateAccessToken(h http.Handler) http.Handler {
+func (a *Auth) MiddlewareValidateAccessToken(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
@@ -69,7 +79,7 @@ func MiddlewareValidateAccessToken(h http.Handler) http.Handler {
 			handlersfunc.HandleJWTError(w)
 			return
 		}
-		userID, err := userstorage.GetUserID(context.Background(), config.DB, userEmail)
+		userID, err := a.Users.GetUserID(context.Background(), userEmail)
 		if err != nil {
 			log.Printf("Error happened when getting user ID by email. Err: %s", err)
 			handlersfunc.HandleDatabaseServerError(w)
@@ -85,7 +95,7 @@ func MiddlewareValidateAccessToken(h http.Handler) http.Handler {
 
 // MiddlewareValidateRefreshToken validates whether the request contains a bearer token
 // it also decodes and authenticates the given token
-func MiddlewareValidateRefreshToken(h http.Handler) http.Handler {
+func (a *Auth) MiddlewareValidateRefreshToken(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Set("Content-Type", "application/json")
@@ -105,14 +115,14 @@ func MiddlewareValidateRefreshToken(h http.Handler) http.Handler {
 			return
 		}
 
-		userID, err := userstorage.GetUserID(context.Background(), config.DB, userEmail)
+		userID, err := a.Users.GetUserID(context.Background(), userEmail)
 		if err != nil {
 			log.Printf("Error happened when getting user ID by email. Err: %s", err)
 			handlersfunc.HandleDatabaseServerError(w)
 			return
 		}
 
-		user, err := userstorage.GetUserData(context.Background(), config.DB, userID)
+		user, err := a.Users.GetUserData(context.Background(), userID)
 		if err != nil {
 			handlersfunc.HandleWrongCredentialsError(w)
 			return
@@ -136,11 +146,11 @@ func MiddlewareValidateRefreshToken(h http.Handler) http.Handler {
 
 
 
-func AdminHandler(h http.Handler) http.Handler {
+func (a *Auth) AdminHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		userID := handlersfunc.UserIDContextReader(r)
-		userCategory, _, _, err := userstorage.CheckUserCategory(r.Context(), config.DB, userID)
+		userCategory, _, _, err := a.Users.CheckUserCategory(r.Context(), userID)
 		resp := make(map[string]string)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
@@ -174,3 +184,36 @@ func AdminHandler(h http.Handler) http.Handler {
     })
 }
 
+// StaffHandler lets through the admins and the printing agents, e.g. to the shipping documents.
+func (a *Auth) StaffHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		userID := handlersfunc.UserIDContextReader(r)
+		userCategory, _, _, err := a.Users.CheckUserCategory(r.Context(), userID)
+		resp := make(map[string]string)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			log.Print("Failed to check user category")
+			jsonResp, err := json.Marshal(resp)
+			if err != nil {
+				log.Printf("Error happened in JSON marshal. Err: %s", err)
+				return
+			}
+			w.Write(jsonResp)
+			return
+		}
+
+		if userCategory == models.AdminCategory || userCategory == models.PrintAgentUserCategory {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		resp["status"] = "user unauthorized"
+		jsonResp, err := json.Marshal(resp)
+		if err != nil {
+			log.Printf("Error happened in JSON marshal. Err: %s", err)
+			return
+		}
+		w.Write(jsonResp)
+	})
+}
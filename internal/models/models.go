@@ -3,6 +3,8 @@ package models
 import (
 	"encoding/json"
 	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/money"
 )
 
 const (
@@ -58,12 +60,71 @@ type Price struct {
 	Variant string `json:"variant"`
 	Surface string `json:"surface"`
 	Size string `json:"size"`
-	BasePrice float64 `json:"base_price"`
-	ExtraPage float64 `json:"extra_page"`
+	BasePrice money.Money `json:"base_price"`
+	ExtraPage money.Money `json:"extra_page"`
+	IncludedPages int `json:"included_pages"`
+	PageStep int `json:"page_step"`
+	MinPages int `json:"min_pages"`
+	MaxPages int `json:"max_pages"`
+	LeatherSurcharge money.Money `json:"leather_surcharge"`
+	PackageBoxFee money.Money `json:"package_box_fee"`
+}
+
+// VolumeDiscount is the share taken off the books of an order of at least MinBooks books.
+type VolumeDiscount struct {
+	MinBooks int `json:"min_books" validate:"min=2"`
+	Discount float64 `json:"discount" validate:"gt=0,lt=1"`
 }
 
 type ResponsePrice struct {
 	Prices []Price `json:"prices"`
+	VolumeDiscounts []VolumeDiscount `json:"volume_discounts"`
+}
+
+// PriceLine is a line of the price breakdown, the lines of a book carry its project id.
+// Discount is the share of the promocode taken off the line.
+type PriceLine struct {
+	Code string `json:"code"`
+	ProjectID uint `json:"project_id,omitempty"`
+	Quantity int `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	Amount money.Money `json:"amount"`
+	Discount money.Money `json:"discount,omitempty"`
+}
+
+type PriceBreakdown struct {
+	PriceListID uint `json:"price_list_id"`
+	Lines []PriceLine `json:"lines"`
+	Total money.Money `json:"total"`
+}
+
+// PriceList is a version of the price catalog in effect from EffectiveFrom until the next list takes over.
+type PriceList struct {
+	PriceListID uint `json:"price_list_id"`
+	Name string `json:"name" validate:"required"`
+	EffectiveFrom int64 `json:"effective_from"`
+	CreatedAt int64 `json:"created_at"`
+	Prices []Price `json:"prices" validate:"required,min=1"`
+	VolumeDiscounts []VolumeDiscount `json:"volume_discounts" validate:"dive"`
+}
+
+type ResponsePriceLists struct {
+	PriceLists []PriceList `json:"price_lists"`
+}
+
+// OrderItem is a line of the price of the order as it was at the checkout, with the options of the book it is for.
+type OrderItem struct {
+	Code string `json:"code"`
+	ProjectID uint `json:"project_id,omitempty"`
+	Size string `json:"size,omitempty"`
+	Variant string `json:"variant,omitempty"`
+	Cover string `json:"cover,omitempty"`
+	Surface string `json:"surface,omitempty"`
+	CountPages int `json:"count_pages,omitempty"`
+	Quantity int `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	Amount money.Money `json:"amount"`
+	Discount money.Money `json:"discount"`
 }
 
 type Colour struct {
@@ -81,13 +142,14 @@ type Delivery struct {
 	Code string `json:"code",required_unless=Method DOOR,omitempty`
 	PostalCode string `json:"postal_code" validate:"required"`
 	Address string `json:"address" validate:"required"`
-	Amount float64 `json:"amount"`
+	Amount money.Money `json:"amount"`
 }
 
 type GiftCertificate struct {
 	ID uint `json:"id"`
 	Code string `json:"code"`
-	Deposit      float64    `json:"deposit" validate:"required,min=1000.00,max=50000.00"`
+	// the deposit bounds are in kopecks: from 1000 to 50000 roubles
+	Deposit      money.Money    `json:"deposit" validate:"required,min=100000,max=5000000"`
 	Recipientemail string `json:"recipient_email" validate:"required,email"`
 	Recipientname string `json:"recipient_name" validate:"required"`
 	Buyerfirstname string `json:"buyer_first_name" validate:"required"`
@@ -98,18 +160,33 @@ type GiftCertificate struct {
 	TransactionID string `json:"transaction_id"`
 }
 
+// NewPromooffer is a promocode with the rules of its promotion. Discount is the rate of a PERCENT promocode,
+// Amount the sum of a FIXED one, a FREE_SHIPPING promocode makes the delivery free. A one-time promocode
+// is redeemed once, zero limits are not checked, empty sizes, variants and covers target every book.
 type NewPromooffer struct {
 	Code string `json:"code"`
-	Discount      float64    `json:"discount"`
+	DiscountType string `json:"discount_type" validate:"omitempty,oneof=PERCENT FIXED FREE_SHIPPING"`
+	Discount      float64    `json:"discount" validate:"gte=0,lte=1"`
+	Amount money.Money `json:"amount" validate:"gte=0"`
 	Category string `json:"category"`
+	MinOrderValue money.Money `json:"min_order_value" validate:"gte=0"`
+	MaxRedemptions int `json:"max_redemptions" validate:"gte=0"`
+	PerUserLimit int `json:"per_user_limit" validate:"gte=0"`
+	StartsAt int64 `json:"starts_at"`
 	ExpiresAt int64 `json:"expires_at"`
 	IsOnetime bool `json:"is_onetime"`
 	UsersID int64 `json:"users_id"`
+	Sizes []string `json:"sizes"`
+	Variants []string `json:"variants"`
+	Covers []string `json:"covers"`
+	ExcludesCertificate bool `json:"excludes_certificate"`
 }
 
 type Promooffer struct {
 	Code string `json:"code"`
+	DiscountType string `json:"discount_type"`
 	Discount      float64    `json:"discount"`
+	Amount money.Money `json:"amount"`
 	Category string `json:"category"`
 	ExpiresAt int64 `json:"expires_at"`
 	Templates []Template `json:"templates"`
@@ -127,8 +204,10 @@ type CheckPromooffer struct {
 
 
 type RequestPromooffer struct {
-	Projects    []uint     `json:"projects" validate:"required"`
+	Cart    []CartItem     `json:"cart" validate:"required,unique=ProjectID,dive"`
 	Code string `json:"code" validate:"required"`
+	PackageBox bool `json:"package_box"`
+	Giftcertificate string `json:"giftcertificate"`
   }
 
 type PromocodeCheck struct {
@@ -142,29 +221,38 @@ type CheckPromocode struct {
 
 type ResponsePromocode struct {
 
+	DiscountType string `json:"discount_type"`
 	Discount    float64 `json:"discount"`
+	Amount money.Money `json:"amount"`
 	Category string `json:"category"`
+	MinOrderValue money.Money `json:"min_order_value"`
+	StartsAt int64 `json:"starts_at"`
 	ExpiresAt int64 `json:"expires_at"`
 	
 }
 
+// ResponsePromocodeUse is the cart with the promocode applied, FreeShipping is set when the promocode makes the delivery free.
 type ResponsePromocodeUse struct {
 
 	PromocodeID uint `json:"promocode_id"`
+	DiscountType string `json:"discount_type"`
 	Discount    float64 `json:"discount"`
+	Amount money.Money `json:"amount"`
+	FreeShipping bool `json:"free_shipping"`
 	Category    string `json:"category"`
-	BasePrice float64 `json:"base_price"`
-	DiscountedPrice float64 `json:"discounted_price"`
+	BasePrice money.Money `json:"base_price"`
+	DiscountedPrice money.Money `json:"discounted_price"`
+	Breakdown PriceBreakdown `json:"breakdown"`
 }
 
 type RequestCertificate struct {
-	DiscountedPrice    float64     `json:"discounted_price" validate:"required"`
+	DiscountedPrice    money.Money     `json:"discounted_price" validate:"required"`
 	Code string `json:"code" validate:"required"`
   }
 
 type ResponseCertificate struct {
 
-	Deposit float64 `json:"deposit"`
+	Deposit money.Money `json:"deposit"`
 }
 
 type TransactionLink struct {
@@ -405,9 +493,11 @@ type CartObj struct {
 	Category *string `json:"category"`
 	FrontPage FrontPage `json:"front_page"`
 	CountPages int `json:"count_pages"`
-	BasePrice float64 `json:"base_price"`
-	UpdatedPagesPrice float64 `json:"updated_pages_price"`
-	UpdatedCoverPrice float64 `json:"updated_cover_price"`
+	BasePrice money.Money `json:"base_price"`
+	UpdatedPagesPrice money.Money `json:"updated_pages_price"`
+	UpdatedCoverPrice money.Money `json:"updated_cover_price"`
+	Quantity int `json:"quantity"`
+	Breakdown PriceBreakdown `json:"breakdown"`
 	CoverBool bool `json:"cover_bool"`
 	LeatherID *uint `json:"leather_id"`
   }
@@ -421,7 +511,8 @@ type PaidCartObj struct {
 	Surface string `json:"surface" validate:"required,oneof=GLOSS MATTE"`
 	FrontPage FrontPage `json:"front_page"`
 	CountPages int `json:"count_pages"`
-	BasePrice float64 `json:"base_price"`
+	Quantity int `json:"quantity"`
+	BasePrice money.Money `json:"base_price"`
   }
 
 type ResponseCart struct {
@@ -429,14 +520,26 @@ type ResponseCart struct {
 
 }
 
+// CartItem is a project in the cart with the number of its copies to order.
+type CartItem struct {
+	ProjectID    uint     `json:"project_id" validate:"required,min=1"`
+	Quantity int `json:"quantity" validate:"required,min=1,max=99"`
+  }
+
+type RequestCartQuantity struct {
+	Quantity int `json:"quantity" validate:"required,min=1,max=99"`
+  }
+
 type RequestOrderPayment struct {
 
-	Projects    []uint     `json:"projects" validate:"required,min=1,dive,min=1"`
+	Cart    []CartItem     `json:"cart" validate:"required,min=1,unique=ProjectID,dive"`
 	ContactData Contacts `json:"contact_data" validate:"required"`
 	DeliveryData Delivery `json:"delivery_data" validate:"required"`
 	PackageBox bool `json:"package_box" validate:"required"`
 	Giftcertificate string `json:"giftcertificate"`
 	Promocode string `json:"promocode"`
+	// IdempotencyKey comes in the Idempotency-Key header, the retries of the checkout send the same key
+	IdempotencyKey string `json:"-" validate:"max=255"`
   }
 
 type ResponseOrderInfo struct {
@@ -445,11 +548,14 @@ type ResponseOrderInfo struct {
 	Status string `json:"status" validate:"required"`
 	ContactData Contacts `json:"contact_data" validate:"required"`
 	DeliveryData Delivery `json:"delivery_data" validate:"required"`
-	GiftcertificateDeposit *float64 `json:"giftcertificate_deposit"`
+	GiftcertificateDeposit *money.Money `json:"giftcertificate_deposit"`
 	PromocodeDiscountPercent *float64 `json:"promocode_discount_percent", validate:"omitempty"`
 	Promocode *string `json:"promocode", validate:"omitempty"`
 	TransactionID uint `json:"transaction_id"`
 	Projects    []PreviewObject     `json:"projects" validate:"required"`
+	ShippingDocuments []ShippingDocument `json:"shipping_documents,omitempty"`
+	// OriginalOrderID is the order a reprint is made for
+	OriginalOrderID *uint `json:"original_order_id,omitempty"`
   }
 
 
@@ -463,6 +569,7 @@ type ResponseDeliveryInfo struct {
 	DeliveryID *string `json:"delivery_id" validate:"required"`
 	DeliveryData ResponseDelivery `json:"delivery_data"`
 	ContactData Contacts `json:"contact_data" validate:"required"`
+	WarehouseID *uint `json:"warehouse_id"`
 	ExpectedDeliveryFrom int64 `json:"expected_delivery_from" validate:"required"`
 	ExpectedDeliveryTo int64 `json:"expected_delivery_to" validate:"required"`
   }
@@ -485,12 +592,25 @@ type ResponseApiDeliveryInfo struct {
 	Code string `json:"code" validate:"required"`
 	ContactData Contacts `json:"contact_data" validate:"required"`
 	Method string `json:"method" validate:"required"`
-	Amount uint `json:"amount" validate:"required"`
+	Amount money.Money `json:"amount" validate:"required"`
+	Books []ShippedBook `json:"books"`
+	PackageBox bool `json:"package_box"`
+	// Origin is the warehouse the order is shipped from, zero when none is assigned
+	Origin Warehouse `json:"origin"`
+  }
+
+// ShippedBook is what the packaging of a photobook depends on.
+type ShippedBook struct {
+	Size string `json:"size"`
+	Variant string `json:"variant"`
+	Cover string `json:"cover"`
+	CountPages int `json:"count_pages"`
   }
 
 type PreviewObject struct {
 	ProjectID    uint     `json:"project_id" validate:"required"`
 	Name string `json:"name"`
+	Quantity int `json:"quantity"`
 }
 
 type Contacts struct {
@@ -744,14 +864,15 @@ type ResponseOrder struct {
 	Projects    []PaidCartObj     `json:"projects" validate:"required"`
 	Status string `json:"status" validate:"required"`
 	CreatedAt int64 `json:"created_at"`
-	BasePrice *float64 `json:"base_price"`
-	FinalPrice *float64 `json:"final_price"`
-	DeliveryPrice *float64 `json:"delivery_price"`
+	BasePrice *money.Money `json:"base_price"`
+	FinalPrice *money.Money `json:"final_price"`
+	DeliveryPrice *money.Money `json:"delivery_price"`
 	TrackingNumber string `json:"tracking_number"`
 	PromocodeDiscountPercent *float64 `json:"promocode_discount_percent", validate:"omitempty"`
 	PromocodeCategory *string `json:"promocode_category", validate:"omitempty"`
-	PromocodeDiscount *float64 `json:"promocode_discount"`
-	CertificateDeposit *float64 `json:"certificate_deposit"`
+	PromocodeDiscount *money.Money `json:"promocode_discount"`
+	CertificateDeposit *money.Money `json:"certificate_deposit"`
+	Items []OrderItem `json:"items,omitempty"`
   }
 
 
@@ -771,15 +892,15 @@ type ResponseAdminOrder struct {
 	Email string `json:"email" validate:"required"`
 	Commentary *string `json:"commentary" validate:"required"`
 	CreatedAt int64 `json:"created_at"`
-	BasePrice *float64 `json:"base_price"`
-	FinalPrice *float64 `json:"final_price"`
-	DeliveryPrice *float64 `json:"delivery_price"`
+	BasePrice *money.Money `json:"base_price"`
+	FinalPrice *money.Money `json:"final_price"`
+	DeliveryPrice *money.Money `json:"delivery_price"`
 	TrackingNumber *string `json:"tracking_number"`
 	VideoLink *string `json:"video_link"`
 	PromocodeDiscountPercent *float64 `json:"promocode_discount_percent", validate:"omitempty"`
 	PromocodeCategory *string `json:"promocode_category", validate:"omitempty"`
-	PromocodeDiscount *float64 `json:"promocode_discount"`
-	CertificateDeposit *float64 `json:"certificate_deposit"`
+	PromocodeDiscount *money.Money `json:"promocode_discount"`
+	CertificateDeposit *money.Money `json:"certificate_deposit"`
   }
 
 type ResponseAdminOrders struct {
@@ -791,9 +912,49 @@ type ResponseAdminOrders struct {
 
 type RequestUpdateOrderStatus struct {
 
-	Status string `json:"status" validate:"required,oneof=AWAITING_PAYMENT PAYMENT_IN_PROGRESS PAID IN_PRINT READY_FOR_DELIVERY IN_DELIVERY COMPLETED CANCELLED"`
+	Status string `json:"status" validate:"required,oneof=AWAITING_PAYMENT PAYMENT_IN_PROGRESS PAID IN_PRINT READY_FOR_DELIVERY IN_DELIVERY COMPLETED CANCELLED REFUNDED"`
+	Reason string `json:"reason" validate:"max=500"`
   }
 
+type OrderStatusChange struct {
+	HistoryID uint `json:"history_id"`
+	OrdersID uint `json:"orders_id"`
+	FromStatus string `json:"from_status"`
+	ToStatus string `json:"to_status"`
+	Actor string `json:"actor"`
+	UsersID uint `json:"users_id,omitempty"`
+	Reason string `json:"reason"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type ResponseOrderStatusHistory struct {
+	History []OrderStatusChange `json:"history"`
+}
+
+type DeliveryStatusEvent struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	City string `json:"city"`
+	HappenedAt int64 `json:"happened_at"`
+}
+
+type TimelineEvent struct {
+	Category string `json:"category"`
+	Code string `json:"code"`
+	Description string `json:"description"`
+	City string `json:"city,omitempty"`
+	Amount *money.Money `json:"amount,omitempty"`
+	// LinkedOrderID is the reprint made after a complaint, or the original order of a reprint
+	LinkedOrderID uint `json:"linked_order_id,omitempty"`
+	HappenedAt int64 `json:"happened_at"`
+}
+
+type ResponseOrderTimeline struct {
+	OrdersID uint `json:"orders_id"`
+	Status string `json:"status"`
+	Events []TimelineEvent `json:"events"`
+}
+
 type RequestUpdateOrderCommentary struct {
 
 	Commentary string `json:"commentary" validate:"required"`
@@ -836,6 +997,8 @@ type UserRequestDeliveryCost struct {
 	Code string `json:"code" binding:"required_unless=Method DOOR`
 	City string `json:"city"`
 	CountProjects int `json:"count_projects" validate:"required"`
+	Projects []uint `json:"projects" validate:"omitempty,dive,min=1"`
+	PackageBox bool `json:"package_box"`
 } 
 
 type RequestDeliveryCost struct {
@@ -851,8 +1014,100 @@ type Location struct {
 	PostalCode string `json:"postal_code" validate:"required"`
 	City string `json:"city"`
 	Address string `json:"address" validate:"required"`
-	Code string `json:"code"`
+	// Code is the CDEK code of the city
+	Code int `json:"code,omitempty"`
+
+}
+
+// Warehouse is a warehouse of a print partner the orders are shipped from.
+type Warehouse struct {
+	WarehouseID uint `json:"warehouse_id"`
+	Name string `json:"name" validate:"required"`
+	Partner string `json:"partner"`
+	PostalCode string `json:"postal_code" validate:"required"`
+	City string `json:"city" validate:"required"`
+	Address string `json:"address" validate:"required"`
+	CityCode int `json:"city_code" validate:"required,min=1"`
+	WorkTime string `json:"work_time"`
+	// Phone is called by the carrier couriers, it is required for the return shipments
+	Phone string `json:"phone"`
+	Latitude float64 `json:"latitude" validate:"min=-90,max=90"`
+	Longitude float64 `json:"longitude" validate:"min=-180,max=180"`
+	IsActive bool `json:"is_active"`
+}
+
+type ResponseWarehouses struct {
+	Warehouses []Warehouse `json:"warehouses"`
+}
+
+type RequestOrderWarehouse struct {
+	WarehouseID uint `json:"warehouse_id" validate:"required,min=1"`
+}
+
+// ShippingDocument is a print form of the shipments, a waybill or the barcode labels, kept in the object storage
+// and served from the image host under its link.
+type ShippingDocument struct {
+	Form string `json:"form"`
+	Link string `json:"link"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type ResponseShippingDocuments struct {
+	Documents []ShippingDocument `json:"documents"`
+}
+
+// ResponseShippingBatch is the print forms of all the shipments handed over to the carrier today.
+type ResponseShippingBatch struct {
+	Orders []uint `json:"orders"`
+	Documents []ShippingDocument `json:"documents"`
+}
+
+type RequestComplaint struct {
+	Reason string `json:"reason" validate:"required,oneof=DAMAGED MISPRINT WRONG_BOOK LOST OTHER"`
+	Description string `json:"description" validate:"required"`
+	// Photos are the links of the photos of the book uploaded by the customer
+	Photos []string `json:"photos" validate:"max=10,dive,required"`
+}
+
+// RequestResolveComplaint is the decision of the admins on a complaint. A refund of zero amount returns
+// everything not refunded yet, ReturnFrom defaults to the delivery address of the order.
+type RequestResolveComplaint struct {
+	Resolution string `json:"resolution" validate:"required,oneof=REPRINT REFUND REJECT"`
+	Amount money.Money `json:"amount" validate:"gte=0"`
+	ReturnRequired bool `json:"return_required"`
+	ReturnFrom *Location `json:"return_from" validate:"omitempty"`
+	Comment string `json:"comment" validate:"required"`
+}
+
+// RequestCloseComplaint closes a complaint left resolving after a partial resolution with what was already given out for it.
+type RequestCloseComplaint struct {
+	Resolution string `json:"resolution" validate:"required,oneof=REPRINT REFUND REJECT"`
+	ReprintOrderID *uint `json:"reprint_order_id"`
+	RefundsID *uint `json:"refunds_id"`
+	ReturnDeliveryID string `json:"return_delivery_id"`
+	Comment string `json:"comment" validate:"required"`
+}
+
+// Complaint is a claim of the customer about a delivered order and how it was resolved.
+type Complaint struct {
+	ComplaintsID uint `json:"complaints_id"`
+	OrdersID uint `json:"orders_id"`
+	UsersID uint `json:"users_id"`
+	Reason string `json:"reason"`
+	Description string `json:"description"`
+	Photos []string `json:"photos"`
+	Status string `json:"status"`
+	Comment string `json:"comment,omitempty"`
+	ReprintOrderID *uint `json:"reprint_order_id,omitempty"`
+	RefundsID *uint `json:"refunds_id,omitempty"`
+	// ReturnDeliveryID is the carrier id of the shipment bringing the book back to the warehouse
+	ReturnDeliveryID string `json:"return_delivery_id,omitempty"`
+	CreatedAt int64 `json:"created_at"`
+	ResolvedAt *int64 `json:"resolved_at,omitempty"`
+}
 
+type ResponseComplaints struct {
+	Complaints []Complaint `json:"complaints"`
 }
 
 type Service struct {
@@ -872,16 +1127,16 @@ type Package struct {
 type ApiResponseDeliveryCost struct {
 	PeriodMin int64 `json:"period_min" validate:"required"`
 	PeriodMax int64 `json:"period_max" validate:"required"`
-	DeliverySum float64 `json:"delivery_sum" validate:"required"`
+	DeliverySum money.Money `json:"delivery_sum" validate:"required"`
 	WeightCalc float64 `json:"weight_calc" validate:"required"`
 	Currency string `json:"currency" validate:"required"`
-	TotalSum float64 `json:"total_sum" validate:"required"`
+	TotalSum money.Money `json:"total_sum" validate:"required"`
 	Services []Service `json:"services" validate:"required"`
 }
 
 type ResponseDeliveryCost struct {
 
-	Amount float64 `json:"amount" validate:"required"`
+	Amount money.Money `json:"amount" validate:"required"`
 	ExpectedDeliveryFrom string `json:"expected_delivery_from" validate:"required"`
 	ExpectedDeliveryTo string `json:"expected_delivery_to" validate:"required"`
 }
@@ -895,6 +1150,152 @@ type PaidOrderObj struct {
 	Email string`json:"email"`
 }
 
+type PendingPaymentObj struct {
+	OrdersID uint `json:"orders_id"`
+	LastEditedAt time.Time`json:"last_edited_at"`
+}
+
+type BankTransactionObj struct {
+	TransactionsID uint `json:"transactions_id"`
+	OrdersID uint `json:"orders_id"`
+	GiftcertificatesID uint `json:"giftcertificates_id"`
+	Status string `json:"status"`
+}
+
+type PendingCertificateObj struct {
+	GiftcertificatesID uint `json:"giftcertificates_id"`
+	CreatedAt time.Time`json:"created_at"`
+}
+
+type RequestRefund struct {
+	Amount money.Money `json:"amount" validate:"required,gt=0"`
+	Reason string `json:"reason" validate:"required"`
+}
+
+type RefundableTransactionObj struct {
+	TransactionsID uint `json:"transactions_id"`
+	BankOrderID string `json:"bank_order_id"`
+	Amount money.Money `json:"amount"`
+	RefundedAmount money.Money `json:"refunded_amount"`
+}
+
+type Refund struct {
+	RefundsID uint `json:"refunds_id"`
+	OrdersID uint `json:"orders_id"`
+	TransactionsID uint `json:"transactions_id"`
+	Amount money.Money `json:"amount"`
+	Reason string `json:"reason"`
+	Status string `json:"status"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type ResponseRefunds struct {
+	Refunds []Refund `json:"refunds"`
+}
+
+type PaidTransactionObj struct {
+	TransactionsID uint `json:"transactions_id"`
+	BankOrderID string `json:"bank_order_id"`
+	Amount money.Money `json:"amount"`
+	BankStatus string `json:"bank_status"`
+}
+
+type CaptureFailure struct {
+	OrdersID uint `json:"orders_id"`
+	TransactionsID uint `json:"transactions_id"`
+	Amount money.Money `json:"amount"`
+	CaptureError string `json:"capture_error"`
+	LastEditedAt int64 `json:"last_edited_at"`
+}
+
+type ResponseCaptureFailures struct {
+	Orders []CaptureFailure `json:"orders"`
+}
+
+type HeldPayment struct {
+	OrdersID uint `json:"orders_id"`
+	TransactionsID uint `json:"transactions_id"`
+	BankOrderID string `json:"bank_order_id"`
+	Amount money.Money `json:"amount"`
+	OrderStatus string `json:"order_status"`
+	ReverseError string `json:"reverse_error"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+type ResponseHeldPayments struct {
+	Payments []HeldPayment `json:"payments"`
+}
+
+type DeliveryFailure struct {
+	OrdersID uint `json:"orders_id"`
+	DeliveryID uint `json:"delivery_id"`
+	RegistrationError string `json:"registration_error"`
+	LastEditedAt int64 `json:"last_edited_at"`
+}
+
+type ResponseDeliveryFailures struct {
+	Orders []DeliveryFailure `json:"orders"`
+}
+
+type DeliveryPoint struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	City string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Address string `json:"address"`
+	Latitude float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	WorkTime string `json:"work_time"`
+	// Distance is how far the point is from the searched coordinates, in kilometres
+	Distance *float64 `json:"distance,omitempty"`
+}
+
+type DeliveryPointQuery struct {
+	City string `json:"city"`
+	PostalCode string `json:"postal_code"`
+	Type string `json:"type" validate:"omitempty,oneof=PVZ POSTAMAT"`
+	Latitude *float64 `json:"latitude" validate:"required_with=Longitude,omitempty,min=-90,max=90"`
+	Longitude *float64 `json:"longitude" validate:"required_with=Latitude,omitempty,min=-180,max=180"`
+	Limit uint `json:"limit" validate:"max=500"`
+}
+
+type ResponseDeliveryPoints struct {
+	Points []DeliveryPoint `json:"points"`
+}
+
+type Receipt struct {
+	Email string `json:"email"`
+	Phone string `json:"phone"`
+	Items []ReceiptItem `json:"items"`
+}
+
+type ReceiptItem struct {
+	PositionID uint `json:"position_id"`
+	Name string `json:"name"`
+	Quantity uint `json:"quantity"`
+	Price money.Money `json:"price"`
+	Amount money.Money `json:"amount"`
+	VAT string `json:"vat" validate:"oneof=none vat0 vat10 vat20"`
+	PaymentMethod string `json:"payment_method" validate:"oneof=full_prepayment prepayment advance full_payment"`
+	PaymentObject string `json:"payment_object" validate:"oneof=commodity service payment"`
+}
+
+type StoredReceipt struct {
+	ReceiptsID uint `json:"receipts_id"`
+	TransactionsID uint `json:"transactions_id"`
+	RefundsID uint `json:"refunds_id"`
+	Type string `json:"type"`
+	Amount money.Money `json:"amount"`
+	CreatedAt int64 `json:"created_at"`
+	SentAt *int64 `json:"sent_at"`
+	Receipt Receipt `json:"receipt"`
+}
+
+type ResponseReceipts struct {
+	Receipts []StoredReceipt `json:"receipts"`
+}
+
 type LimitOffset struct {
 
 	Limit *uint `json:"limit" validate:"required"`
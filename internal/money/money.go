@@ -0,0 +1,186 @@
+// Money package contains the amount type used for prices, discounts, deposits and payments.
+//
+// Amounts are held in kopecks, so sums and differences are exact. Rounding happens only where
+// a fraction of a kopeck can appear: parsing a float, applying a discount rate or splitting an amount,
+// and it is always to the nearest kopeck with halves rounded away from zero.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount of roubles held in kopecks.
+type Money int64
+
+// Zero is the empty amount.
+const Zero Money = 0
+
+var errInvalidAmount = errors.New("invalid money amount")
+
+// FromKopecks returns the amount of kopecks.
+func FromKopecks(kopecks int64) Money {
+	return Money(kopecks)
+}
+
+// FromRoubles returns the amount of whole roubles.
+func FromRoubles(roubles int64) Money {
+	return Money(roubles * 100)
+}
+
+// FromFloat returns the amount of roubles rounded to the nearest kopeck.
+func FromFloat(roubles float64) Money {
+	return Money(math.Round(roubles * 100))
+}
+
+// Parse reads a decimal amount of roubles such as "1500", "1500.5" or "-12.34" without going through a float.
+// Digits past the kopecks are rounded.
+func Parse(s string) (Money, error) {
+
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return Zero, errInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	roubles, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Zero, errInvalidAmount
+	}
+	var kopecks int64
+	for i, digit := range fraction {
+		if digit < '0' || digit > '9' {
+			return Zero, errInvalidAmount
+		}
+		switch {
+		case i < 2:
+			kopecks = kopecks*10 + int64(digit-'0')
+		case i == 2 && digit >= '5':
+			kopecks++
+		}
+	}
+	if len(fraction) == 1 {
+		kopecks *= 10
+	}
+	amount := Money(roubles*100 + kopecks)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// Kopecks returns the amount in kopecks, as the acquirer expects it.
+func (m Money) Kopecks() int64 {
+	return int64(m)
+}
+
+// Float returns the amount in roubles. Use it only for display and for apis taking floats.
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Rate returns the amount multiplied by rate, rounded to the nearest kopeck, e.g. the discount of a promocode.
+func (m Money) Rate(rate float64) Money {
+	return Money(math.Round(float64(m) * rate))
+}
+
+// Split returns the share of the amount that part makes of whole, rounded to the nearest kopeck.
+func (m Money) Split(part Money, whole Money) Money {
+	if whole == 0 {
+		return Zero
+	}
+	return Money(math.Round(float64(m) * float64(part) / float64(whole)))
+}
+
+// Mul returns the amount multiplied by n.
+func (m Money) Mul(n int) Money {
+	return m * Money(n)
+}
+
+// Max returns the larger of the amounts.
+func Max(a Money, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// String formats the amount in roubles with two decimals.
+func (m Money) String() string {
+	sign := ""
+	kopecks := int64(m)
+	if kopecks < 0 {
+		sign = "-"
+		kopecks = -kopecks
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, kopecks/100, kopecks%100)
+}
+
+// MarshalJSON writes the amount as a number of roubles, keeping the api format of the former float prices.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a number or a string of roubles.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return errInvalidAmount
+		}
+		*m = FromFloat(f)
+		return nil
+	}
+	amount, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
+
+// Scan reads a numeric column, or a double precision one not migrated yet.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Zero
+	case string:
+		amount, err := Parse(v)
+		if err != nil {
+			return err
+		}
+		*m = amount
+	case []byte:
+		amount, err := Parse(string(v))
+		if err != nil {
+			return err
+		}
+		*m = amount
+	case float64:
+		*m = FromFloat(v)
+	case float32:
+		*m = FromFloat(float64(v))
+	case int64:
+		*m = FromRoubles(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money", src)
+	}
+	return nil
+}
+
+// Value writes the amount into a numeric column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,35 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMoney(t *testing.T) {
+
+	for input, expected := range map[string]Money{"1500": 150000, "1500.5": 150050, "0.105": 11, "-12.34": -1234, "19.999": 2000} {
+		amount, err := Parse(input)
+		if err != nil || amount != expected {
+			t.Errorf("expected %s to parse into %d kopecks, got %d, %v", input, expected, amount, err)
+		}
+	}
+
+	// 0.1 + 0.2 roubles in floats is 0.30000000000000004
+	if FromFloat(0.1)+FromFloat(0.2) != FromKopecks(30) {
+		t.Errorf("expected kopecks to add up exactly")
+	}
+	if discounted := FromKopecks(99999) - FromKopecks(99999).Rate(0.15); discounted != FromKopecks(84999) {
+		t.Errorf("expected the discount to be rounded to the nearest kopeck, got %s", discounted)
+	}
+
+	var price struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 1234.56}`), &price); err != nil || price.Amount != FromKopecks(123456) {
+		t.Fatalf("expected a json number to be read exactly, got %s, %v", price.Amount, err)
+	}
+	data, _ := json.Marshal(price)
+	if string(data) != `{"amount":1234.56}` {
+		t.Errorf("expected the amount to be written as a number of roubles, got %s", data)
+	}
+}
@@ -0,0 +1,94 @@
+package objectsstorage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"sync"
+)
+
+// TimewebUploadURL is the upload endpoint of the bucket the photos and the generated PDFs are stored in,
+// they are served from config.ImageHost under their names.
+const TimewebUploadURL = "https://api.timeweb.cloud/api/v1/storages/buckets/225285/object-manager/upload?;path=photo/"
+
+// FileStorage is the object storage the generated files are kept in.
+type FileStorage interface {
+	// Upload stores the content under name, replacing the file stored under it before.
+	Upload(ctx context.Context, name string, content []byte) error
+}
+
+// TimewebBucket implements FileStorage on top of the Timeweb cloud storage api.
+type TimewebBucket struct {
+	UploadURL string
+	Token     string
+	Client    *http.Client
+}
+
+// NewTimewebBucket returns a FileStorage uploading to the bucket of the images with the given api token.
+func NewTimewebBucket(token string) *TimewebBucket {
+	return &TimewebBucket{UploadURL: TimewebUploadURL, Token: token, Client: &http.Client{}}
+}
+
+func (b *TimewebBucket) Upload(ctx context.Context, name string, content []byte) error {
+
+	form := new(bytes.Buffer)
+	writer := multipart.NewWriter(form)
+	fw, err := writer.CreateFormFile(name, name)
+	if err != nil {
+		log.Printf("Failed to create form file %s", err)
+		return err
+	}
+	if _, err = fw.Write(content); err != nil {
+		log.Printf("Failed to copy file content %s", err)
+		return err
+	}
+	writer.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.UploadURL, form)
+	if err != nil {
+		log.Printf("Failed to create a request to bucket %s", err)
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.Token)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		log.Printf("Failed to make a request to bucket %s", err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		log.Printf("Failed to upload %s to bucket, status %d", name, resp.StatusCode)
+		return errors.New("error uploading file to bucket")
+	}
+	return nil
+}
+
+// MemoryFiles implements FileStorage in memory, for the tests and the local runs without the bucket.
+type MemoryFiles struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+// NewMemoryFiles returns an empty MemoryFiles.
+func NewMemoryFiles() *MemoryFiles {
+	return &MemoryFiles{files: make(map[string][]byte)}
+}
+
+func (m *MemoryFiles) Upload(ctx context.Context, name string, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = append([]byte(nil), content...)
+	return nil
+}
+
+// File returns the content stored under name.
+func (m *MemoryFiles) File(name string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	content, ok := m.files[name]
+	return content, ok
+}
@@ -1216,71 +1216,6 @@ func FavourLayout(ctx context.Context, storeDB *pgxpool.Pool, newDecor models.Pe
 }
 
 
-// AddPrices function performs the operation of adding prices to the db.
-func AddPrices(ctx context.Context, storeDB *pgxpool.Pool, newP []models.Price) (error) {
-
-	for _, price := range newP {
-        _, err = storeDB.Exec(ctx, "INSERT INTO prices (cover, variant, surface, size, baseprice, extrapage) VALUES ($1, $2, $3, $4, $5, $6);",
-		price.Cover,
-		price.Variant,
-		price.Surface,
-		price.Size,
-		price.BasePrice,
-		price.ExtraPage,
-		)
-		if err != nil {
-			log.Printf("Error happened when inserting prices into pgx table. Err: %s", err)
-			return err
-		}
-	}
-
-	return nil
-
-}
-
-// DeletePrices function performs the operation of deleting prices from the db.
-func DeletePrices(ctx context.Context, storeDB *pgxpool.Pool) (error) {
-
-	_, err = storeDB.Exec(ctx, "DELETE * FROM prices;")
-	if err != nil {
-			log.Printf("Error happened when deleting prices from pgx table. Err: %s", err)
-			return err
-	}
-	
-
-	return nil
-
-}
-
-// RetrievePrices function performs the operation of retrieving prices from pgx database with a query.
-func RetrievePrices(ctx context.Context, storeDB *pgxpool.Pool) ([]models.Price, error) {
-
-	prices := []models.Price{}
-
-	rows, err := storeDB.Query(ctx, "SELECT cover, variant, size, surface, baseprice, extrapage FROM prices;")
-	if err != nil {
-			log.Printf("Error happened when retrieving prices from pgx table. Err: %s", err)
-			return prices, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-
-			var priceObj models.Price
-			if err = rows.Scan(&priceObj.Cover, &priceObj.Variant, &priceObj.Size, &priceObj.Surface, &priceObj.BasePrice, &priceObj.ExtraPage); err != nil {
-				log.Printf("Error happened when scanning prices. Err: %s", err)
-				return prices, err
-			}
-
-			prices = append(prices, priceObj)
-			
-	}
-
-	return prices, nil
-
-}
-
-
 // AddCover function performs the operation of adding cover to the db.
 func AddCover(ctx context.Context, storeDB *pgxpool.Pool, newC models.Colour) (error) {
 
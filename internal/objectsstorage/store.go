@@ -0,0 +1,169 @@
+package objectsstorage
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ObjectStore is the storage of photos, decorations, backgrounds, layouts, prices and covers used by the handlers.
+type ObjectStore interface {
+	CheckUserOwnsPhoto(ctx context.Context, userID uint, photoID uint) bool
+	AddPhoto(ctx context.Context, photoLink string, smallImage string, userID uint) (uint, error)
+	AddDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error)
+	AdminDeleteDecoration(ctx context.Context, dID uint) error
+	DeleteDecoration(ctx context.Context, userID uint, decorID uint) error
+	AddBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error)
+	AdminDeleteBackground(ctx context.Context, bID uint) error
+	DeleteBackground(ctx context.Context, userID uint, bID uint) error
+	DeletePhoto(ctx context.Context, photoID uint) (uint, error)
+	RetrieveUserPhotos(ctx context.Context, userID uint, sorting string, offset uint, limit uint) (models.ResponsePhotos, error)
+	LoadBackgrounds(ctx context.Context, userID uint, offset uint, limit uint, btype string, isfavourite bool, ispersonal bool) (models.ResponseBackground, error)
+	AddAdminBackground(ctx context.Context, newB models.Background) (uint, error)
+	UpdateBackground(ctx context.Context, bID uint, newB models.Background) error
+	UpdateDecoration(ctx context.Context, dID uint, newD models.Decoration) error
+	FavourBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error
+	LoadDecorations(ctx context.Context, userID uint, offset uint, limit uint, dtype string, dcategory string, isfavourite bool, ispersonal bool) (models.ResponseDecoration, error)
+	AddAdminDecoration(ctx context.Context, newD models.Decoration) (uint, error)
+	FavourDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error
+	LoadLayouts(ctx context.Context, userID uint, offset uint, limit uint, size string, countimages uint, isfavourite bool) (models.ResponseLayout, error)
+	AddAdminLayout(ctx context.Context, newL models.Layout) (uint, error)
+	AdminDeleteLayout(ctx context.Context, lID uint) error
+	FavourLayout(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error
+	CreatePriceList(ctx context.Context, priceList models.PriceList) (uint, error)
+	DeletePriceList(ctx context.Context, priceListID uint) error
+	RetrievePriceLists(ctx context.Context) (models.ResponsePriceLists, error)
+	// RetrievePrices returns the prices and the volume discounts of the price list in effect now.
+	RetrievePrices(ctx context.Context) (models.ResponsePrice, error)
+	AddCover(ctx context.Context, newC models.Colour) error
+	AdminDeleteCover(ctx context.Context, cID uint) error
+	RetrieveCovers(ctx context.Context) ([]models.Colour, error)
+}
+
+// PgObjectStore implements ObjectStore on top of the postgres connection pool.
+type PgObjectStore struct {
+	DB *pgxpool.Pool
+}
+
+// NewPgObjectStore returns a ObjectStore backed by the given pool.
+func NewPgObjectStore(storeDB *pgxpool.Pool) *PgObjectStore {
+	return &PgObjectStore{DB: storeDB}
+}
+
+func (s *PgObjectStore) CheckUserOwnsPhoto(ctx context.Context, userID uint, photoID uint) bool {
+	return CheckUserOwnsPhoto(ctx, s.DB, userID, photoID)
+}
+
+func (s *PgObjectStore) AddPhoto(ctx context.Context, photoLink string, smallImage string, userID uint) (uint, error) {
+	return AddPhoto(ctx, s.DB, photoLink, smallImage, userID)
+}
+
+func (s *PgObjectStore) AddDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error) {
+	return AddDecoration(ctx, s.DB, newDecor, userID)
+}
+
+func (s *PgObjectStore) AdminDeleteDecoration(ctx context.Context, dID uint) error {
+	return AdminDeleteDecoration(ctx, s.DB, dID)
+}
+
+func (s *PgObjectStore) DeleteDecoration(ctx context.Context, userID uint, decorID uint) error {
+	return DeleteDecoration(ctx, s.DB, userID, decorID)
+}
+
+func (s *PgObjectStore) AddBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) (uint, error) {
+	return AddBackground(ctx, s.DB, newDecor, userID)
+}
+
+func (s *PgObjectStore) AdminDeleteBackground(ctx context.Context, bID uint) error {
+	return AdminDeleteBackground(ctx, s.DB, bID)
+}
+
+func (s *PgObjectStore) DeleteBackground(ctx context.Context, userID uint, bID uint) error {
+	return DeleteBackground(ctx, s.DB, userID, bID)
+}
+
+func (s *PgObjectStore) DeletePhoto(ctx context.Context, photoID uint) (uint, error) {
+	return DeletePhoto(ctx, s.DB, photoID)
+}
+
+func (s *PgObjectStore) RetrieveUserPhotos(ctx context.Context, userID uint, sorting string, offset uint, limit uint) (models.ResponsePhotos, error) {
+	return RetrieveUserPhotos(ctx, s.DB, userID, sorting, offset, limit)
+}
+
+func (s *PgObjectStore) LoadBackgrounds(ctx context.Context, userID uint, offset uint, limit uint, btype string, isfavourite bool, ispersonal bool) (models.ResponseBackground, error) {
+	return LoadBackgrounds(ctx, s.DB, userID, offset, limit, btype, isfavourite, ispersonal)
+}
+
+func (s *PgObjectStore) AddAdminBackground(ctx context.Context, newB models.Background) (uint, error) {
+	return AddAdminBackground(ctx, s.DB, newB)
+}
+
+func (s *PgObjectStore) UpdateBackground(ctx context.Context, bID uint, newB models.Background) error {
+	return UpdateBackground(ctx, s.DB, bID, newB)
+}
+
+func (s *PgObjectStore) UpdateDecoration(ctx context.Context, dID uint, newD models.Decoration) error {
+	return UpdateDecoration(ctx, s.DB, dID, newD)
+}
+
+func (s *PgObjectStore) FavourBackground(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	return FavourBackground(ctx, s.DB, newDecor, userID)
+}
+
+func (s *PgObjectStore) LoadDecorations(ctx context.Context, userID uint, offset uint, limit uint, dtype string, dcategory string, isfavourite bool, ispersonal bool) (models.ResponseDecoration, error) {
+	return LoadDecorations(ctx, s.DB, userID, offset, limit, dtype, dcategory, isfavourite, ispersonal)
+}
+
+func (s *PgObjectStore) AddAdminDecoration(ctx context.Context, newD models.Decoration) (uint, error) {
+	return AddAdminDecoration(ctx, s.DB, newD)
+}
+
+func (s *PgObjectStore) FavourDecoration(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	return FavourDecoration(ctx, s.DB, newDecor, userID)
+}
+
+func (s *PgObjectStore) LoadLayouts(ctx context.Context, userID uint, offset uint, limit uint, size string, countimages uint, isfavourite bool) (models.ResponseLayout, error) {
+	return LoadLayouts(ctx, s.DB, userID, offset, limit, size, countimages, isfavourite)
+}
+
+func (s *PgObjectStore) AddAdminLayout(ctx context.Context, newL models.Layout) (uint, error) {
+	return AddAdminLayout(ctx, s.DB, newL)
+}
+
+func (s *PgObjectStore) AdminDeleteLayout(ctx context.Context, lID uint) error {
+	return AdminDeleteLayout(ctx, s.DB, lID)
+}
+
+func (s *PgObjectStore) FavourLayout(ctx context.Context, newDecor models.PersonalisedObject, userID uint) error {
+	return FavourLayout(ctx, s.DB, newDecor, userID)
+}
+
+func (s *PgObjectStore) CreatePriceList(ctx context.Context, priceList models.PriceList) (uint, error) {
+	return pricing.CreatePriceList(ctx, s.DB, priceList)
+}
+
+func (s *PgObjectStore) DeletePriceList(ctx context.Context, priceListID uint) error {
+	return pricing.DeletePriceList(ctx, s.DB, priceListID)
+}
+
+func (s *PgObjectStore) RetrievePriceLists(ctx context.Context) (models.ResponsePriceLists, error) {
+	return pricing.LoadPriceLists(ctx, s.DB)
+}
+
+func (s *PgObjectStore) RetrievePrices(ctx context.Context) (models.ResponsePrice, error) {
+	return pricing.LoadPrices(ctx, s.DB)
+}
+
+func (s *PgObjectStore) AddCover(ctx context.Context, newC models.Colour) error {
+	return AddCover(ctx, s.DB, newC)
+}
+
+func (s *PgObjectStore) AdminDeleteCover(ctx context.Context, cID uint) error {
+	return AdminDeleteCover(ctx, s.DB, cID)
+}
+
+func (s *PgObjectStore) RetrieveCovers(ctx context.Context) ([]models.Colour, error) {
+	return RetrieveCovers(ctx, s.DB)
+}
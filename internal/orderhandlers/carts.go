@@ -0,0 +1,183 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// AddCartItem puts copies of the project of the user in the cart, on top of the copies in the cart already.
+// A project which is not in the cart is published, as with CreateOrder.
+func (h *Handler) AddCartItem(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseCart)
+	var ItemObj models.CartItem
+
+	err := json.NewDecoder(r.Body).Decode(&ItemObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(ItemObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+	if !h.Orders.CheckProject(ctx, ItemObj.ProjectID) {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if !h.Users.CheckUserHasProject(ctx, userID, ItemObj.ProjectID) {
+		rw.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if _, err = h.Orders.AddCartItem(ctx, userID, ItemObj); err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	h.writeCart(ctx, rw, resp, userID)
+}
+
+// UpdateCartItem sets the number of copies of the project in the cart.
+func (h *Handler) UpdateCartItem(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseCart)
+	var QuantityObj models.RequestCartQuantity
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	projectID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&QuantityObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(QuantityObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+	err = h.Orders.UpdateCartItem(ctx, userID, models.CartItem{ProjectID: projectID, Quantity: QuantityObj.Quantity})
+	if errors.Is(err, orderstorage.ErrNotInCart) {
+		handlersfunc.HandleNotInCartError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	h.writeCart(ctx, rw, resp, userID)
+}
+
+// DeleteCartItem takes the project out of the cart and unpublishes it.
+func (h *Handler) DeleteCartItem(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseCart)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	projectID := uint(aByteToInt)
+	defer r.Body.Close()
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+	err := h.Orders.DeleteCartItem(ctx, userID, projectID)
+	if errors.Is(err, orderstorage.ErrNotInCart) {
+		handlersfunc.HandleNotInCartError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	h.writeCart(ctx, rw, resp, userID)
+}
+
+// writeCart responds with the cart of the user repriced after a change.
+func (h *Handler) writeCart(ctx context.Context, rw http.ResponseWriter, resp map[string]models.ResponseCart, userID uint) {
+
+	cart, err := h.Orders.LoadCart(ctx, userID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = cart
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// checkCart reports whether every item of the checkout is in the cart of the user with the same number of copies,
+// so the customer pays for what the cart showed. notInCart is set when a project is not in the cart at all.
+func checkCart(cart models.ResponseCart, items []models.CartItem) (ok bool, notInCart bool) {
+
+	quantities := make(map[uint]int, len(cart.Projects))
+	for _, p := range cart.Projects {
+		quantities[p.ProjectID] = p.Quantity
+	}
+	for _, item := range items {
+		quantity, inCart := quantities[item.ProjectID]
+		if !inCart {
+			return false, true
+		}
+		if quantity != item.Quantity {
+			return false, false
+		}
+	}
+	return true, false
+}
+
+// cartCopies returns the projects of the items, every project listed once per copy, as the shipment packs them.
+func cartCopies(items []models.CartItem) []uint {
+
+	var projects []uint
+	for _, item := range items {
+		for i := 0; i < item.Quantity; i++ {
+			projects = append(projects, item.ProjectID)
+		}
+	}
+	return projects
+}
+
+// writeCheckoutLink responds to the repeated checkout with the payment link of the order placed by the first one.
+// The link is missing while the first checkout is still registering the payment, the customer is asked to retry.
+func writeCheckoutLink(rw http.ResponseWriter, link string) {
+
+	if link == "" {
+		handlersfunc.HandleCheckoutInProgressError(rw)
+		return
+	}
+	resp := make(map[string]models.TransactionLink)
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = models.TransactionLink{PaymentLink: link}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
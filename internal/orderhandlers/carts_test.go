@@ -0,0 +1,73 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+func TestCheckCart(t *testing.T) {
+
+	cart := models.ResponseCart{Projects: []models.CartObj{{ProjectID: 1, Quantity: 2}, {ProjectID: 2, Quantity: 1}}}
+	tests := []struct {
+		name      string
+		items     []models.CartItem
+		ok        bool
+		notInCart bool
+	}{
+		{"whole cart", []models.CartItem{{ProjectID: 1, Quantity: 2}, {ProjectID: 2, Quantity: 1}}, true, false},
+		{"part of the cart", []models.CartItem{{ProjectID: 2, Quantity: 1}}, true, false},
+		{"fewer copies than in the cart", []models.CartItem{{ProjectID: 1, Quantity: 1}}, false, false},
+		{"project out of the cart", []models.CartItem{{ProjectID: 3, Quantity: 1}}, false, true},
+	}
+	for _, tt := range tests {
+		if ok, notInCart := checkCart(cart, tt.items); ok != tt.ok || notInCart != tt.notInCart {
+			t.Errorf("%s: expected %t, %t, got %t, %t", tt.name, tt.ok, tt.notInCart, ok, notInCart)
+		}
+	}
+}
+
+func TestCartQuantities(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	projectID := h.project(t, h.userID, standardBook)
+	id := strconv.Itoa(int(projectID))
+
+	serve(h.AddCartItem, request(http.MethodPost, "/api/v1/add-cart-item", `{"project_id": `+id+`, "quantity": 2}`, h.userID, id))
+	resp := serve(h.UpdateCartItem, request(http.MethodPost, "/api/v1/update-cart-item/"+id, `{"quantity": 3}`, h.userID, id))
+	var cart models.ResponseCart
+	json.Unmarshal(resp["response"], &cart)
+	if len(cart.Projects) != 1 || cart.Projects[0].Quantity != 3 || cart.Projects[0].BasePrice != money.FromRoubles(3*2500) {
+		t.Fatalf("expected the cart to price the three copies, got %s", resp["response"])
+	}
+	if !h.Orders.CheckCountProjects(ctx, h.userID, 3) {
+		t.Errorf("expected the copies to be counted in the cart")
+	}
+
+	orderBody := `{"cart": [{"project_id": ` + id + `, "quantity": 2}], "contact_data": {"first_name": "Name", "last_name": "Surname", "email": "user@example.com", "phone": "+79990000000"}, "delivery_data": {"method": "DOOR", "postal_code": "630099", "address": "Новосибирск, Красный проспект, 1"}, "package_box": true}`
+	resp = serve(h.OrderPayment, request(http.MethodPost, "/api/v1/order-payment", orderBody, h.userID, ""))
+	if code := errorCode(resp); code != 441 {
+		t.Fatalf("expected the checkout of fewer copies than the cart shows to be refused, got %s", resp["error"])
+	}
+
+	finalPrice, orderID, err := h.Orders.OrderPayment(ctx, models.RequestOrderPayment{Cart: []models.CartItem{{ProjectID: projectID, Quantity: 3}}}, h.userID, money.Zero, 0)
+	if err != nil || finalPrice != money.FromRoubles(3*2500) {
+		t.Fatalf("expected the order of the three copies to cost 7500, got %s, %v", finalPrice, err)
+	}
+	if cart, _ = h.Orders.LoadCart(ctx, h.userID); len(cart.Projects) != 0 {
+		t.Errorf("expected the ordered project to leave the cart, got %v", cart.Projects)
+	}
+	order, _ := h.Orders.RetrieveSingleOrder(ctx, orderID)
+	if len(order.Projects) != 1 || order.Projects[0].Quantity != 3 {
+		t.Errorf("expected the order to keep the number of copies, got %+v", order.Projects)
+	}
+	if resp = serve(h.DeleteCartItem, request(http.MethodPost, "/api/v1/delete-cart-item/"+id, "", h.userID, id)); resp["error"] == nil {
+		t.Errorf("expected the project out of the cart not to be deleted from it")
+	}
+}
@@ -0,0 +1,367 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/transactions"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// CreateComplaint opens a complaint of the customer about a delivered order, with the photos of the book uploaded beforehand.
+// An order has one open complaint at a time.
+func (h *Handler) CreateComplaint(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	var ComplaintObj models.RequestComplaint
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&ComplaintObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(ComplaintObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+	if !h.Orders.CheckOrder(ctx, orderID) {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if !h.Users.CheckUserHasOrder(ctx, userID, orderID) {
+		handlersfunc.HandlePermissionError(rw)
+		return
+	}
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	openComplaints, err := h.Orders.LoadComplaints(ctx, orderID, orderstatus.ComplaintOpen)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	resolvingComplaints, err := h.Orders.LoadComplaints(ctx, orderID, orderstatus.ComplaintResolving)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if !orderstatus.CanComplain(status) || len(openComplaints.Complaints)+len(resolvingComplaints.Complaints) > 0 {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+
+	complaintID, err := h.Orders.CreateComplaint(ctx, orderID, userID, ComplaintObj)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = complaintID
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadOrderComplaints lists the complaints of the customer about the order and how they were resolved.
+func (h *Handler) LoadOrderComplaints(rw http.ResponseWriter, r *http.Request) {
+
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+
+	if !h.Orders.CheckOrder(ctx, orderID) {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if !h.Users.CheckUserHasOrder(ctx, userID, orderID) {
+		handlersfunc.HandlePermissionError(rw)
+		return
+	}
+	h.writeComplaints(ctx, rw, orderID, "")
+}
+
+// LoadComplaints lists the complaints for the support team, filtered by the order_id and the status query parameters.
+func (h *Handler) LoadComplaints(rw http.ResponseWriter, r *http.Request) {
+
+	defer r.Body.Close()
+	orderID, _ := strconv.Atoi(r.URL.Query().Get("order_id"))
+	status := strings.ToUpper(r.URL.Query().Get("status"))
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	h.writeComplaints(ctx, rw, uint(orderID), status)
+}
+
+func (h *Handler) writeComplaints(ctx context.Context, rw http.ResponseWriter, orderID uint, status string) {
+
+	resp := make(map[string]models.ResponseComplaints)
+	complaints, err := h.Orders.LoadComplaints(ctx, orderID, status)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = complaints
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// ResolveComplaint closes an open complaint. A reprint copies the order at no charge straight into print,
+// a refund returns the given amount or everything not refunded yet, and either may ask the carrier to bring the book
+// back to the warehouse first. The complaint is linked to the reprint, the refund and the return shipment.
+func (h *Handler) ResolveComplaint(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.Complaint)
+	var ResolutionObj models.RequestResolveComplaint
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	complaintID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&ResolutionObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(ResolutionObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+	complaint, err := h.Orders.LoadComplaint(ctx, complaintID)
+	if err != nil {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if complaint.Status != orderstatus.ComplaintOpen {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+	// the complaint is claimed before anything is given out, so admins resolving it at once do not both act on it
+	err = h.Orders.UpdateComplaintStatus(ctx, complaintID, orderstatus.ComplaintOpen, orderstatus.ComplaintResolving)
+	if errors.Is(err, orderstatus.ErrStatusChanged) {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	// a complaint nothing was given out for is open again for the admins to retry, otherwise it is left resolving
+	var resolved, givenOut bool
+	defer func() {
+		if resolved {
+			return
+		}
+		if givenOut {
+			log.Printf("Complaint %d is left resolving after a partial resolution", complaintID)
+			return
+		}
+		if err := h.Orders.UpdateComplaintStatus(ctx, complaintID, orderstatus.ComplaintResolving, orderstatus.ComplaintOpen); err != nil {
+			log.Printf("Error happened when reopening complaint %d. Err: %s", complaintID, err)
+		}
+	}()
+	orderID := complaint.OrdersID
+	complaint.Status = orderstatus.ComplaintStatus(ResolutionObj.Resolution)
+	complaint.Comment = ResolutionObj.Comment
+
+	// the return is registered first, nothing is given out if the carrier refuses it
+	if ResolutionObj.ReturnRequired && ResolutionObj.Resolution != orderstatus.ResolutionReject {
+		complaint.ReturnDeliveryID, err = delivery.OrderReturn(ctx, h.Carrier, h.Delivery, orderID, complaintID, ResolutionObj.ReturnFrom)
+		if err != nil {
+			handlersfunc.HandleFailedDeliveryError(rw)
+			return
+		}
+		givenOut = true
+	}
+
+	switch ResolutionObj.Resolution {
+	case orderstatus.ResolutionReprint:
+		reprintID, err := h.Orders.CreateReprintOrder(ctx, orderID, models.OrderStatusChange{
+			ToStatus: orderstatus.InPrint,
+			Actor:    orderstatus.ActorAdmin,
+			UsersID:  userID,
+			Reason:   fmt.Sprintf("reprint of the order %d after the complaint %d", orderID, complaintID),
+		})
+		if err != nil {
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		givenOut = true
+		complaint.ReprintOrderID = &reprintID
+	case orderstatus.ResolutionRefund:
+		amount := ResolutionObj.Amount
+		if amount == 0 {
+			transaction, err := h.Orders.LoadRefundableTransaction(ctx, orderID)
+			if err != nil || transaction.Amount <= transaction.RefundedAmount {
+				handlersfunc.HandleRefundExceedsPaymentError(rw)
+				return
+			}
+			amount = transaction.Amount - transaction.RefundedAmount
+		}
+		refund, err := transactions.RefundTransaction(h.Payments, h.Orders, orderID, models.RequestRefund{Amount: amount, Reason: ResolutionObj.Comment})
+		if errors.Is(err, transactions.ErrNothingToRefund) || errors.Is(err, transactions.ErrRefundExceedsPayment) {
+			handlersfunc.HandleRefundExceedsPaymentError(rw)
+			return
+		}
+		// a refund declined by the bank is recorded as failed and may be issued again
+		if err != nil {
+			log.Printf("Failed to refund order %d on the complaint %d", orderID, complaintID)
+			handlersfunc.HandleFailedRefundError(rw)
+			return
+		}
+		givenOut = true
+		complaint.RefundsID = &refund.RefundsID
+	}
+
+	err = h.Orders.ResolveComplaint(ctx, complaint)
+	if errors.Is(err, orderstatus.ErrStatusChanged) {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	resolved = true
+	complaint, err = h.Orders.LoadComplaint(ctx, complaintID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = complaint
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// CloseComplaint closes a complaint left resolving after a partial resolution. Nothing is given out again, the admins
+// state the resolution and link the reprint, the refund and the return shipment already made for the complaint.
+func (h *Handler) CloseComplaint(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.Complaint)
+	var CloseObj models.RequestCloseComplaint
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	complaintID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&CloseObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(CloseObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	complaint, err := h.Orders.LoadComplaint(ctx, complaintID)
+	if err != nil {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if complaint.Status != orderstatus.ComplaintResolving {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+	// only the reprint and the refund of the order complained about are linked
+	if CloseObj.ReprintOrderID != nil {
+		reprint, err := h.Orders.LoadOrder(ctx, *CloseObj.ReprintOrderID)
+		if err != nil || reprint.OriginalOrderID == nil || *reprint.OriginalOrderID != complaint.OrdersID {
+			handlersfunc.HandleComplaintNotAllowedError(rw)
+			return
+		}
+	}
+	if CloseObj.RefundsID != nil {
+		refunds, err := h.Orders.LoadRefunds(ctx, complaint.OrdersID)
+		if err != nil {
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		var found bool
+		for _, refund := range refunds.Refunds {
+			found = found || refund.RefundsID == *CloseObj.RefundsID
+		}
+		if !found {
+			handlersfunc.HandleComplaintNotAllowedError(rw)
+			return
+		}
+	}
+	complaint.Status = orderstatus.ComplaintStatus(CloseObj.Resolution)
+	complaint.Comment = CloseObj.Comment
+	complaint.ReprintOrderID = CloseObj.ReprintOrderID
+	complaint.RefundsID = CloseObj.RefundsID
+	complaint.ReturnDeliveryID = CloseObj.ReturnDeliveryID
+
+	err = h.Orders.ResolveComplaint(ctx, complaint)
+	if errors.Is(err, orderstatus.ErrStatusChanged) {
+		handlersfunc.HandleComplaintNotAllowedError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	complaint, err = h.Orders.LoadComplaint(ctx, complaintID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = complaint
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
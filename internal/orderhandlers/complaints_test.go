@@ -0,0 +1,173 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+)
+
+// completedOrder places a standard photobook shipped from a warehouse and returns the order in the given statuses.
+func (h *testHandler) completedOrder(t *testing.T, statuses ...string) (uint, uint) {
+	ctx := context.Background()
+	warehouseID, _ := h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Москва", PostalCode: "129323", City: "Москва", Address: "проезд Серебрякова, 7", CityCode: 44, Phone: "+74950000000"})
+	projectID := h.project(t, h.userID, standardBook)
+	_, orderID := h.checkout(t, h.userID, doorOrder(projectID), warehouseID)
+	h.advance(t, orderID, statuses...)
+	return orderID, projectID
+}
+
+// complain opens the complaint of the customer about the order.
+func (h *testHandler) complain(orderID uint) map[string]json.RawMessage {
+	id := strconv.Itoa(int(orderID))
+	body := `{"reason": "DAMAGED", "description": "the cover is torn", "photos": ["https://example.com/photo.jpg"]}`
+	return serve(h.CreateComplaint, request(http.MethodPost, "/api/v1/create-complaint/"+id, body, h.userID, id))
+}
+
+// resolve has the admin resolve the complaint.
+func (h *testHandler) resolve(complaintID string, body string) map[string]json.RawMessage {
+	return serve(h.ResolveComplaint, request(http.MethodPost, "/api/v1/admin/resolve-complaint/"+complaintID, body, 42, complaintID))
+}
+
+func TestCreateComplaint(t *testing.T) {
+
+	h := newTestHandler(t)
+	orderID, _ := h.completedOrder(t, "PAID", "IN_PRINT", "READY_FOR_DELIVERY", "IN_DELIVERY")
+
+	tests := []struct {
+		name   string
+		before []string
+		opened bool
+	}{
+		{"order not delivered yet", nil, false},
+		{"completed order", []string{"COMPLETED"}, true},
+		{"second complaint while one is open", nil, false},
+	}
+	for _, tt := range tests {
+		h.advance(t, orderID, tt.before...)
+		if resp := h.complain(orderID); (resp["error"] == nil) != tt.opened {
+			t.Errorf("%s: expected the complaint opened %t, got %v", tt.name, tt.opened, resp)
+		}
+	}
+}
+
+func TestResolveComplaintReprint(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID, projectID := h.completedOrder(t, "PAID", "IN_PRINT", "READY_FOR_DELIVERY", "IN_DELIVERY", "COMPLETED")
+	resp := h.complain(orderID)
+	if resp["error"] != nil {
+		t.Fatalf("expected the complaint to be opened, got %s", resp["error"])
+	}
+	complaintID := string(resp["response"])
+	claimedID, _ := strconv.Atoi(complaintID)
+	reprint := `{"resolution": "REPRINT", "return_required": true, "comment": "printed again"}`
+
+	// a complaint claimed by another admin is not resolved twice
+	h.Orders.UpdateComplaintStatus(ctx, uint(claimedID), "OPEN", "RESOLVING")
+	if resp := h.resolve(complaintID, reprint); resp["error"] == nil {
+		t.Fatalf("expected a complaint being resolved not to be resolved again, got %v", resp)
+	}
+	h.Orders.UpdateComplaintStatus(ctx, uint(claimedID), "RESOLVING", "OPEN")
+
+	resp = h.resolve(complaintID, reprint)
+	if resp["error"] != nil {
+		t.Fatalf("expected the complaint to be resolved, got %s", resp["error"])
+	}
+	var complaint models.Complaint
+	json.Unmarshal(resp["response"], &complaint)
+	if complaint.Status != "REPRINTED" || complaint.ReprintOrderID == nil || complaint.ReturnDeliveryID == "" {
+		t.Fatalf("expected the complaint to be linked to the reprint and the return shipment, got %+v", complaint)
+	}
+	reprintID := *complaint.ReprintOrderID
+	if status, _ := h.Orders.LoadOrderStatus(ctx, reprintID); status != "IN_PRINT" {
+		t.Errorf("expected the reprint to go straight to print, got %s", status)
+	}
+	order, _ := h.Orders.LoadOrder(ctx, reprintID)
+	if order.OriginalOrderID == nil || *order.OriginalOrderID != orderID || len(order.Projects) != 1 || order.Projects[0].ProjectID != projectID || order.DeliveryData.Amount != 0 {
+		t.Errorf("expected the reprint to copy the projects of the original order at no charge, got %+v", order)
+	}
+	if listed, _ := h.Orders.RetrieveSingleOrder(ctx, reprintID); len(listed.Items) == 0 || listed.Projects[0].BasePrice != 0 {
+		t.Errorf("expected the books of the reprint to be listed at no charge, got %+v", listed)
+	}
+	events, _ := h.Orders.LoadOrderTimeline(ctx, orderID)
+	var linked bool
+	for _, event := range events {
+		linked = linked || event.Code == "COMPLAINT_REPRINTED" && event.LinkedOrderID == reprintID
+	}
+	if !linked {
+		t.Errorf("expected the timeline of the original order to link the reprint, got %v", events)
+	}
+	if resp := h.resolve(complaintID, reprint); resp["error"] == nil {
+		t.Errorf("expected a resolved complaint not to be resolved again, got %v", resp)
+	}
+}
+
+// unresolvedStore is an order storage which can not store the resolution of a complaint.
+type unresolvedStore struct {
+	orderstorage.OrderStore
+}
+
+func (s unresolvedStore) ResolveComplaint(ctx context.Context, complaint models.Complaint) error {
+	return errors.New("connection refused")
+}
+
+func TestCloseComplaint(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID, _ := h.completedOrder(t)
+	h.pay(t, orderID)
+	h.sendOrderToPrint(ctx, models.PaidOrderObj{OrdersID: orderID, LastEditedAt: time.Now().Add(-time.Hour)})
+	h.advance(t, orderID, "READY_FOR_DELIVERY", "IN_DELIVERY", "COMPLETED")
+	complaintID := string(h.complain(orderID)["response"])
+	claimedID, _ := strconv.Atoi(complaintID)
+
+	// the refund is given out, but its resolution is not stored
+	orders := h.Orders
+	h.Orders = unresolvedStore{orders}
+	if resp := h.resolve(complaintID, `{"resolution": "REFUND", "comment": "refunded"}`); resp["response"] != nil {
+		t.Fatalf("expected the resolution not to be stored, got %v", resp)
+	}
+	h.Orders = orders
+	if complaint, _ := h.Orders.LoadComplaint(ctx, uint(claimedID)); complaint.Status != "RESOLVING" {
+		t.Fatalf("expected the complaint refunded to be left resolving, got %s", complaint.Status)
+	}
+	refunds, _ := h.Orders.LoadRefunds(ctx, orderID)
+	if len(refunds.Refunds) != 1 {
+		t.Fatalf("expected the refund to be given out once, got %v", refunds.Refunds)
+	}
+	refundID := refunds.Refunds[0].RefundsID
+
+	tests := []struct {
+		name      string
+		refundsID uint
+		closed    bool
+	}{
+		{"refund of another order", refundID + 100, false},
+		{"refund given out", refundID, true},
+		{"complaint closed already", refundID, false},
+	}
+	for _, tt := range tests {
+		body := fmt.Sprintf(`{"resolution": "REFUND", "refunds_id": %d, "comment": "refunded"}`, tt.refundsID)
+		resp := serve(h.CloseComplaint, request(http.MethodPost, "/api/v1/admin/close-complaint/"+complaintID, body, 42, complaintID))
+		if (resp["error"] == nil) != tt.closed {
+			t.Errorf("%s: expected the complaint closed %t, got %v", tt.name, tt.closed, resp)
+		}
+	}
+	complaint, _ := h.Orders.LoadComplaint(ctx, uint(claimedID))
+	if complaint.Status != "REFUNDED" || complaint.RefundsID == nil || *complaint.RefundsID != refundID {
+		t.Errorf("expected the complaint to be closed with the refund given out, got %+v", complaint)
+	}
+	if refunds, _ := h.Orders.LoadRefunds(ctx, orderID); len(refunds.Refunds) != 1 {
+		t.Errorf("expected nothing to be refunded again, got %v", refunds.Refunds)
+	}
+}
@@ -0,0 +1,76 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/gorilla/mux"
+)
+
+// PrintShippingDocuments gets the waybill and the barcode labels of the order shipment from the carrier and keeps them
+// in the object storage, they are listed in AdminLoadOrder. Printing again replaces them.
+func (h *Handler) PrintShippingDocuments(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseShippingDocuments)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+	defer r.Body.Close()
+	// the carrier takes a while to make the forms
+	ctx, cancel := context.WithTimeout(r.Context(), delivery.PrintTimeout)
+	defer cancel()
+
+	if !h.Orders.CheckOrder(ctx, orderID) {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	documents, err := delivery.PrintShippingDocuments(ctx, h.Carrier, h.Files, h.Delivery, orderID)
+	if errors.Is(err, delivery.ErrNoShipment) {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleFailedPrintFormError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = models.ResponseShippingDocuments{Documents: documents}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// PrintShippingBatch gets the waybills and the barcode labels of all the shipments waiting to be handed over to the carrier
+// in as few files as the carrier allows, for the packing team to print at once.
+func (h *Handler) PrintShippingBatch(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseShippingBatch)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), delivery.PrintTimeout)
+	defer cancel()
+
+	batch, err := delivery.PrintShippingBatch(ctx, h.Carrier, h.Files, h.Delivery)
+	if err != nil {
+		handlersfunc.HandleFailedPrintFormError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = batch
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
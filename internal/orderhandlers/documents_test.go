@@ -0,0 +1,97 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// acceptedShipment registers the shipment of the order ready for delivery with the carrier, which accepts it,
+// and returns the tracking number.
+func (h *testHandler) acceptedShipment(t *testing.T, orderID uint) string {
+	ctx := context.Background()
+	order := doorOrder(0)
+	uuid, err := h.Carrier.CreateShipment(ctx, delivery.Shipment{Method: "DOOR", Recipient: order.ContactData, To: models.Location{PostalCode: "630099", Address: "Красный проспект, 1"}, Parcels: delivery.PackBooks([]models.ShippedBook{{Size: "SQUARE", CountPages: 20}}, false)})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when registering the shipment", err)
+	}
+	h.cdek.Accept(uuid)
+	tracking, _ := h.Carrier.Track(ctx, uuid)
+	h.Delivery.AddDeliveryID(ctx, orderID, uuid)
+	deliveryID, _, _, _, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	h.Delivery.UpdateTrackingNumber(ctx, deliveryID, tracking.TrackingNumber)
+	return tracking.TrackingNumber
+}
+
+func TestPrintShippingDocuments(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID := h.placeOrder(t, h.userID)
+	h.advance(t, orderID, "PAID", "IN_PRINT", "READY_FOR_DELIVERY")
+	id := strconv.Itoa(int(orderID))
+	printDocuments := func() map[string]json.RawMessage {
+		return serve(h.PrintShippingDocuments, request(http.MethodPost, "/api/v1/admin/print-shipping-documents/"+id, "", 0, id))
+	}
+
+	if resp := printDocuments(); resp["error"] == nil {
+		t.Fatalf("expected the documents not to be printed before the shipment is registered, got %v", resp)
+	}
+	trackingNumber := h.acceptedShipment(t, orderID)
+	if resp := printDocuments(); resp["error"] != nil {
+		t.Fatalf("expected the documents of the accepted shipment to be printed, got %v", resp)
+	}
+	documents, _ := h.Delivery.LoadShippingDocuments(ctx, orderID)
+	if len(documents) != 2 || documents[0].Form != delivery.FormBarcode || documents[1].Form != delivery.FormWaybill {
+		t.Fatalf("expected the labels and the waybill to be stored, got %v", documents)
+	}
+	for _, document := range documents {
+		if pdf, ok := h.files.File(document.Link); !ok || !strings.Contains(string(pdf), trackingNumber) {
+			t.Errorf("expected %s to be uploaded with the shipment, got %q", document.Link, pdf)
+		}
+	}
+
+	resp := serve(h.AdminLoadOrder, request(http.MethodGet, "/api/v1/admin/load-order/"+id, "", 0, id))
+	var order models.ResponseOrderInfo
+	json.Unmarshal(resp["response"], &order)
+	if len(order.ShippingDocuments) != 2 {
+		t.Errorf("expected the admin order view to list the documents, got %v", order.ShippingDocuments)
+	}
+}
+
+func TestPrintShippingBatch(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID := h.placeOrder(t, h.userID)
+	h.advance(t, orderID, "PAID", "IN_PRINT", "READY_FOR_DELIVERY")
+	h.acceptedShipment(t, orderID)
+	deliveryID, _, _, _, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+
+	tests := []struct {
+		name      string
+		status    string
+		orders    int
+		documents int
+	}{
+		{"shipment waiting for the courier", "", 1, 2},
+		{"shipment handed over", "RECEIVED_AT_SHIPMENT_WAREHOUSE", 0, 0},
+	}
+	for _, tt := range tests {
+		if tt.status != "" {
+			h.Delivery.UpdateDeliveryStatus(ctx, deliveryID, tt.status)
+		}
+		resp := serve(h.PrintShippingBatch, request(http.MethodPost, "/api/v1/admin/print-shipping-batch", "", 0, ""))
+		var batch models.ResponseShippingBatch
+		json.Unmarshal(resp["response"], &batch)
+		if len(batch.Orders) != tt.orders || len(batch.Documents) != tt.documents || tt.orders == 1 && batch.Orders[0] != orderID {
+			t.Errorf("%s: expected %d orders with %d documents in the batch, got %v", tt.name, tt.orders, tt.documents, batch)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package orderhandlers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/emailutils"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/transactions"
+)
+
+// Errors of the status hooks, told apart by UpdateOrderStatus to answer with the matching error code.
+var (
+	errCaptureHook = errors.New("failed to capture order payment")
+	errReleaseHook = errors.New("failed to release order payment")
+	errMailHook    = errors.New("failed to mail order status")
+)
+
+// lifecycle returns the order state machine with the hooks run on the status changes.
+func (h *Handler) lifecycle() *orderstatus.Machine {
+
+	machine := orderstatus.NewMachine(h.Orders)
+	machine.Before(orderstatus.InPrint, h.capturePayment)
+	machine.Before(orderstatus.Cancelled, h.releasePayment)
+	machine.After(orderstatus.ReadyForDelivery, h.registerDelivery)
+	machine.After(orderstatus.InDelivery, h.mailOrderInDelivery)
+	return machine
+}
+
+// capturePayment charges the held amount before the book goes to print.
+func (h *Handler) capturePayment(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+
+	err := transactions.CaptureTransaction(h.Payments, h.Orders, orderID)
+	if err != nil {
+		return errCaptureHook
+	}
+	return nil
+}
+
+// releasePayment returns the amount held for a paid order being cancelled. The payment of an order still awaiting
+// it is closed, so that the customer can not pay for the cancelled order.
+func (h *Handler) releasePayment(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+
+	if change.FromStatus != orderstatus.Paid && change.FromStatus != orderstatus.PaymentInProgress {
+		return nil
+	}
+	err := transactions.CancelTransaction(h.Payments, h.Orders, orderID)
+	if err != nil {
+		return errReleaseHook
+	}
+	return nil
+}
+
+// registerDelivery places the shipment of the order with the delivery service. The order moves on to
+// IN_DELIVERY once the carrier accepts the shipment, see ConfirmShipments. A failure does not hold the status change back,
+// the order is listed in LoadDeliveryFailures for the admins to register it again. The shipment of an order sent back
+// from IN_DELIVERY is kept as it is.
+func (h *Handler) registerDelivery(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+
+	err := delivery.OrderDelivery(h.Carrier, h.Delivery, orderID)
+	if err != nil && !errors.Is(err, delivery.ErrShipmentRegistered) {
+		log.Printf("Failed to register delivery for the order %d. Err: %s", orderID, err)
+	}
+	return nil
+}
+
+// mailOrderInDelivery sends the customer the tracking number of the shipment.
+func (h *Handler) mailOrderInDelivery(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+
+	deliveryObj, err := h.Orders.LoadDelivery(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	retrievedOrder, err := h.Orders.LoadOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	contactData := retrievedOrder.ContactData
+	var trackingNumber string
+	if deliveryObj.TrackingNumber != nil {
+		trackingNumber = *deliveryObj.TrackingNumber
+	}
+
+	from := "support@memoryprint.ru"
+	to := []string{contactData.Email}
+	subject := "Ваш заказ передан в службу доставки!"
+	mailType := emailutils.MailOrderInDelivery
+	mailData := &emailutils.MailData{
+		Username:    contactData.FirstName,
+		Ordernum:    orderID,
+		Trackingnum: trackingNumber,
+	}
+
+	ms := &emailutils.SGMailService{YandexApiKey: config.YandexApiKey}
+	mailReq := emailutils.NewMail(from, to, subject, mailType, mailData)
+	err = emailutils.SendMail(mailReq, ms)
+	if err != nil {
+		log.Printf("Failed to send delivery mail for the order %d. Err: %s", orderID, err)
+		return errMailHook
+	}
+	return nil
+}
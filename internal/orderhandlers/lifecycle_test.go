@@ -0,0 +1,80 @@
+package orderhandlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+func TestCapturePayment(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		approve bool
+		status  string
+		failed  bool
+	}{
+		{"payment held by the bank", true, "IN_PRINT", false},
+		// the order is marked paid without the bank holding the money
+		{"payment unknown to the bank", false, "PAID", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			ctx := context.Background()
+			orderID := h.placeOrder(t, h.userID)
+			bankOrderID := h.registerPayment(t, orderID)
+			if tt.approve {
+				h.gateway.Approve(bankOrderID)
+			}
+			h.Orders.UpdateSuccessfulTransaction(ctx, orderID)
+
+			h.sendOrderToPrint(ctx, models.PaidOrderObj{OrdersID: orderID, LastEditedAt: time.Now().Add(-time.Hour)})
+			if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != tt.status {
+				t.Errorf("expected the order to be %s, got %s", tt.status, status)
+			}
+			failures, _ := h.Orders.LoadCaptureFailures(ctx)
+			if listed := len(failures.Orders) == 1 && failures.Orders[0].OrdersID == orderID; listed != tt.failed {
+				t.Errorf("expected the failed capture listed for admins %t, got %v", tt.failed, failures.Orders)
+			}
+		})
+	}
+}
+
+func TestRegisterDeliveryHook(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Москва", PostalCode: "129323", City: "Москва", Address: "проезд Серебрякова, 7", CityCode: 44})
+	h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Новосибирск", PostalCode: "630005", City: "Новосибирск", Address: "ул. Фрунзе, 5", CityCode: 270})
+	// the origin is left unassigned, as for the orders placed before the warehouses
+	_, orderID := h.checkout(t, h.userID, doorOrder(h.project(t, h.userID, models.NewBlankProjectObj{Size: "SQUARE", Variant: "PREMIUM", Cover: "LEATHERETTE", Surface: "MATTE", CountPages: 40})), 0)
+	h.advance(t, orderID, "PAID", "IN_PRINT")
+
+	if err := h.lifecycle().Transition(ctx, orderID, models.OrderStatusChange{ToStatus: "READY_FOR_DELIVERY"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when finishing the print", err)
+	}
+	_, uuid, _, _, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	shipment, _, ok := h.cdek.Shipment(uuid)
+	if !ok || shipment.ToLocation == nil || shipment.ToLocation.PostalCode != "630099" || shipment.DeliveryRecipientCost.Value != 0 {
+		t.Fatalf("expected the prepaid shipment to be registered with the carrier, got %v", shipment)
+	}
+	if shipment.FromLocation.City != "Новосибирск" || shipment.FromLocation.Code != 270 {
+		t.Errorf("expected the shipment to leave from the warehouse in the city of the customer, got %v", shipment.FromLocation)
+	}
+	if len(shipment.Packages) != 1 || shipment.Packages[0].Weight < 1500 {
+		t.Errorf("expected the premium leatherette book to be packed by its weight, got %v", shipment.Packages)
+	}
+
+	// the order sent back from delivery keeps the shipment the carrier has accepted
+	h.cdek.Accept(uuid)
+	h.confirmShipment(ctx, orderID)
+	if err := h.lifecycle().Transition(ctx, orderID, models.OrderStatusChange{ToStatus: "READY_FOR_DELIVERY"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when sending the order back from delivery", err)
+	}
+	if _, again, _, trackingNumber, _ := h.Delivery.FindDeliveryUUID(ctx, orderID); again != uuid || trackingNumber == "" {
+		t.Errorf("expected the accepted shipment %s to be kept, got %s tracked as %q", uuid, again, trackingNumber)
+	}
+}
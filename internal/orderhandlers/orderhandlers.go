@@ -6,6 +6,7 @@ package orderhandlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
@@ -18,16 +19,32 @@ import (
 	"github.com/SiberianMonster/memoryprint/internal/delivery"
 	"github.com/SiberianMonster/memoryprint/internal/emailutils"
 	"github.com/SiberianMonster/memoryprint/internal/models"
-	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
-	"github.com/SiberianMonster/memoryprint/internal/userstorage"
+	"github.com/SiberianMonster/memoryprint/internal/money"
 	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
 	"github.com/SiberianMonster/memoryprint/internal/transactions"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Handler serves the order endpoints on top of the storages.
+type Handler struct {
+	handlersfunc.Stores
+	Payments transactions.PaymentGateway
+	Carrier  delivery.Carrier
+	// Files keeps the shipping documents
+	Files objectsstorage.FileStorage
+}
+
+// New returns a Handler using the given storages, payment gateway, carrier and file storage.
+func New(stores handlersfunc.Stores, payments transactions.PaymentGateway, carrier delivery.Carrier, files objectsstorage.FileStorage) *Handler {
+	return &Handler{Stores: stores, Payments: payments, Carrier: carrier, Files: files}
+}
+
 var err error
 var resp map[string]string
 
@@ -65,7 +82,7 @@ func AddWorkdays(date time.Time, days int) time.Time {
  }
 
 
-func LoadCart(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadCart(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCart)
 	var CartObjs models.ResponseCart 
@@ -77,7 +94,7 @@ func LoadCart(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Loading cart for user %d", userID)
-	CartObjs, err = orderstorage.LoadCart(ctx, config.DB, userID)
+	CartObjs, err = h.Orders.LoadCart(ctx, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -94,7 +111,7 @@ func LoadCart(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func CreateOrder(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateOrder(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var OrderObj models.NewOrder
@@ -121,27 +138,25 @@ func CreateOrder(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Create order for user %d", userID)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, OrderObj.ProjectID)
+	checkExists := h.Orders.CheckProject(ctx, OrderObj.ProjectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, OrderObj.ProjectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, OrderObj.ProjectID)
 
 	if userCheck == false {
 		rw.WriteHeader(http.StatusForbidden)
 		return
 	}
 
-	checkActive := orderstorage.CheckProjectPublished(ctx, config.DB, OrderObj.ProjectID)
+	checkActive := h.Orders.CheckProjectPublished(ctx, OrderObj.ProjectID)
 	if checkActive {
 			handlersfunc.HandleProjectPublished(rw)
 			return
 	}
-	_, err = orderstorage.CreateOrder(ctx, config.DB, userID, OrderObj)
-	// set project status to published, add links
-	// create order awaiting payment
-	//calculate base price
+	_, err = h.Orders.CreateOrder(ctx, userID, OrderObj)
+	// set project status to published, add a copy to the cart
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -161,7 +176,7 @@ func CreateOrder(rw http.ResponseWriter, r *http.Request) {
 
 
 
-func GeneratePersonalPromooffer(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) GeneratePersonalPromooffer(rw http.ResponseWriter, r *http.Request) {
 
 
 	// after registration
@@ -170,14 +185,14 @@ func GeneratePersonalPromooffer(rw http.ResponseWriter, r *http.Request) {
 
 
 
-func OrderPayment(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) OrderPayment(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.TransactionLink)
 	var OrderObj models.RequestOrderPayment
 	var transaction models.TransactionLink
 	var oID uint
 	var link string
-	var priceforlink float64
+	var priceforlink money.Money
 	
 	err := json.NewDecoder(r.Body).Decode(&OrderObj)
 	if err != nil {
@@ -186,6 +201,7 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	defer r.Body.Close()
+	OrderObj.IdempotencyKey = r.Header.Get("Idempotency-Key")
 	// Create a new validator instance
     validate := validator.New()
 	validate.RegisterValidation("phone", PhoneValidator)
@@ -224,16 +240,51 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Payment for order for user %d", userID)
-	for _, projectID := range OrderObj.Projects {
-		userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	if OrderObj.IdempotencyKey != "" {
+		// a retry of the checkout gets the payment link of the order placed by the first attempt
+		oID, link, err = h.Orders.FindCheckout(ctx, userID, OrderObj.IdempotencyKey)
+		if err != nil {
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		if oID != 0 {
+			writeCheckoutLink(rw, link)
+			return
+		}
+	}
+	if deliveryObj.Method != delivery.MethodDoor {
+		pointExists, err := delivery.CheckPoint(ctx, h.Carrier, h.Delivery, deliveryObj.Code, deliveryObj.Method)
+		if err != nil {
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		if !pointExists {
+			handlersfunc.HandleMissingDeliveryPointError(rw)
+			return
+		}
+	}
+	for _, item := range OrderObj.Cart {
+		userCheck := h.Users.CheckUserHasProject(ctx, userID, item.ProjectID)
 
 		if userCheck == false {
 			rw.WriteHeader(http.StatusForbidden)
 			return
 		}
 	}
+	cart, err := h.Orders.LoadCart(ctx, userID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if ok, notInCart := checkCart(cart, OrderObj.Cart); notInCart {
+		handlersfunc.HandleNotInCartError(rw)
+		return
+	} else if !ok {
+		handlersfunc.HandleCartChangedError(rw)
+		return
+	}
 	if OrderObj.Giftcertificate != "" {
-		_, status, _ := userstorage.UseCertificate(ctx, config.DB, OrderObj.Giftcertificate, userID)
+		_, status, _ := h.Users.UseCertificate(ctx, OrderObj.Giftcertificate, userID)
 		if status == "INVALID" {
 			handlersfunc.HandleWrongGiftCodeError(rw)
 			return
@@ -246,7 +297,7 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 	}
 	if OrderObj.Promocode != "" {
 		var status string
-		_, status, err = userstorage.CheckPromocode(ctx, config.DB, OrderObj.Promocode, userID)
+		_, status, err = h.Users.CheckPromocode(ctx, OrderObj.Promocode, userID)
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
 			return
@@ -261,6 +312,11 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 	
+		if status == "NOT STARTED" {
+			handlersfunc.HandlePromocodeNotStartedError(rw)
+			return
+		}
+	
 		if status == "EXPIRED" {
 			handlersfunc.HandleExpiredError(rw)
 			return
@@ -272,16 +328,73 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	books, err := h.Delivery.LoadProjectBooks(ctx, cartCopies(OrderObj.Cart))
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	to := models.Location{PostalCode: deliveryObj.PostalCode, Address: deliveryObj.Address}
+	origin, err := delivery.ChooseOrigin(ctx, h.Delivery, deliveryObj.Method, to, deliveryObj.Code)
+	if err != nil {
+		handlersfunc.HandleMissingWarehouseError(rw)
+		return
+	}
+	quote, err := h.Carrier.Quote(ctx, delivery.BookShipment(deliveryObj.Method, delivery.WarehouseLocation(origin), to, deliveryObj.Code, books, OrderObj.PackageBox))
+	if err != nil {
+		log.Printf("Error happened when calculating delivery. Err: %s", err)
+		handlersfunc.HandleFailedPaymentURL(rw)
+		return
+	}
+
 	log.Println(OrderObj)
-	priceforlink, oID, err = orderstorage.OrderPayment(ctx, config.DB, OrderObj, userID)
+	priceforlink, oID, err = h.Orders.OrderPayment(ctx, OrderObj, userID, quote.Amount, origin.WarehouseID)
 
+	if errors.Is(err, orderstorage.ErrCheckoutRepeated) {
+		_, link, err = h.Orders.FindCheckout(ctx, userID, OrderObj.IdempotencyKey)
+		if err != nil {
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		writeCheckoutLink(rw, link)
+		return
+	}
+	if errors.Is(err, orderstorage.ErrNotInCart) {
+		handlersfunc.HandleNotInCartError(rw)
+		return
+	}
+	if errors.Is(err, orderstorage.ErrPromocodeUnavailable) {
+		handlersfunc.HandleAlreadyUsedError(rw)
+		return
+	}
+	if errors.Is(err, orderstorage.ErrCertificateUnavailable) {
+		handlersfunc.HandleAlreadyUsedGiftcertificateError(rw)
+		return
+	}
+	if errors.Is(err, pricing.ErrPageCount) {
+		handlersfunc.HandlePageCountError(rw)
+		return
+	}
+	if handlersfunc.HandlePromotionError(rw, err) {
+		return
+	}
 	if err != nil {
 		handlersfunc.HandleFailedPaymentURL(rw)
 		return
 	}
 
-	link, err = transactions.CreateTransaction(oID, priceforlink, "PHOTOBOOK") 
+	paidOrder, err := h.Orders.RetrieveSingleOrder(ctx, oID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	receipt := transactions.BuildOrderReceipt(paidOrder, OrderObj.ContactData)
+	link, err = transactions.CreateTransaction(h.Payments, h.Orders, oID, priceforlink, "PHOTOBOOK", receipt)
 	if err != nil {
+		// the order without a payment is cancelled, which returns the cart, the gift certificate and the promocode
+		// and frees the idempotency key, so the retry of the checkout registers the payment again
+		if err = h.Orders.CancelPayment(ctx, oID, userID); err != nil {
+			log.Printf("Failed to cancel the order %d of the unregistered payment. Err: %s", oID, err)
+		}
 		handlersfunc.HandleFailedPaymentURL(rw)
 		return
 	}
@@ -298,7 +411,7 @@ func OrderPayment(rw http.ResponseWriter, r *http.Request) {
 	
 }
 
-func CancelPayment(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CancelPayment(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
@@ -308,28 +421,38 @@ func CancelPayment(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Cancel order for user %d", userID)
-	userCheck := userstorage.CheckUserHasOrder(ctx, config.DB, userID, orderID)
+	userCheck := h.Users.CheckUserHasOrder(ctx, userID, orderID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
 
-	err := transactions.CancelTransaction(orderID)
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if !orderstatus.CanTransition(status, orderstatus.Cancelled) {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+
+	err = transactions.CancelTransaction(h.Payments, h.Orders, orderID)
 	if err != nil {
 		log.Printf("Failed to cancel transaction for order %d", orderID)
 		handlersfunc.HandleFailedCancellationError(rw)
 		return
 	}
 	
-	err = orderstorage.CancelPayment(ctx, config.DB, orderID, userID)
+	err = h.Orders.CancelPayment(ctx, orderID, userID)
 	
 	if err != nil {
 		log.Printf("Failed to update cancelled transaction in db for order %d", orderID)
@@ -359,7 +482,7 @@ func CancelPayment(rw http.ResponseWriter, r *http.Request) {
 // wait until status 2, set order to "PAID"
 // set transaction values
 
-func LoadOrders(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadOrders(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseOrders)
 	var respOrders models.ResponseOrders
@@ -400,7 +523,7 @@ func LoadOrders(rw http.ResponseWriter, r *http.Request) {
 	log.Printf("Load orders of the user %d", userID)
 	log.Println(isactive)
 
-	respOrders, err := orderstorage.RetrieveOrders(ctx, config.DB, userID, isactive, offset, limit)
+	respOrders, err := h.Orders.RetrieveOrders(ctx, userID, isactive, offset, limit)
 	
 	if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -425,7 +548,7 @@ func LoadOrders(rw http.ResponseWriter, r *http.Request) {
 	
 
 
-func LoadAdminOrders(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadAdminOrders(rw http.ResponseWriter, r *http.Request) {
 
 
 	// input active / notactive email orderID, userID, created_at after, created_at before, status
@@ -478,7 +601,7 @@ func LoadAdminOrders(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Load orders of the admin")
-	respOrders, err := orderstorage.RetrieveAdminOrders(ctx, config.DB, uint(userID), uint(orderID), isactive, uint(createdAfter), uint(createdBefore), email, status, offset, limit)
+	respOrders, err := h.Orders.RetrieveAdminOrders(ctx, uint(userID), uint(orderID), isactive, uint(createdAfter), uint(createdBefore), email, status, offset, limit)
 	
 	if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -502,7 +625,7 @@ func LoadAdminOrders(rw http.ResponseWriter, r *http.Request) {
 	
 }
 
-func LoadOrder(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadOrder(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseOrderInfo)
 	var retrievedOrder models.ResponseOrderInfo
@@ -513,13 +636,13 @@ func LoadOrder(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	userID := handlersfunc.UserIDContextReader(r)
 
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 	
-	userCheck := userstorage.CheckUserHasOrder(ctx, config.DB, userID, orderID)
+	userCheck := h.Users.CheckUserHasOrder(ctx, userID, orderID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
@@ -527,7 +650,7 @@ func LoadOrder(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	
-	retrievedOrder, err = orderstorage.LoadOrder(ctx, config.DB, orderID)
+	retrievedOrder, err = h.Orders.LoadOrder(ctx, orderID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -544,7 +667,7 @@ func LoadOrder(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminLoadOrder(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminLoadOrder(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseOrderInfo)
 	var retrievedOrder models.ResponseOrderInfo
@@ -554,7 +677,13 @@ func AdminLoadOrder(rw http.ResponseWriter, r *http.Request) {
 	orderID := uint(aByteToInt)
 	defer r.Body.Close()
 	
-	retrievedOrder, err = orderstorage.AdminLoadOrder(ctx, config.DB, orderID)
+	retrievedOrder, err = h.Orders.AdminLoadOrder(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	// the waybill and the labels are downloaded next to the print files
+	retrievedOrder.ShippingDocuments, err = h.Delivery.LoadShippingDocuments(ctx, orderID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -571,7 +700,72 @@ func AdminLoadOrder(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadDelivery(rw http.ResponseWriter, r *http.Request) {
+// LoadOrderTimeline shows the customer everything that happened to the order, from the payment
+// through print to the delivery statuses reported by CDEK, in chronological order.
+func (h *Handler) LoadOrderTimeline(rw http.ResponseWriter, r *http.Request) {
+
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	userID := handlersfunc.UserIDContextReader(r)
+
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	userCheck := h.Users.CheckUserHasOrder(ctx, userID, orderID)
+	if userCheck == false {
+		handlersfunc.HandlePermissionError(rw)
+		return
+	}
+	h.writeOrderTimeline(ctx, rw, orderID)
+}
+
+// AdminLoadOrderTimeline shows the timeline of any order to the support team.
+func (h *Handler) AdminLoadOrderTimeline(rw http.ResponseWriter, r *http.Request) {
+
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	h.writeOrderTimeline(ctx, rw, orderID)
+}
+
+func (h *Handler) writeOrderTimeline(ctx context.Context, rw http.ResponseWriter, orderID uint) {
+
+	resp := make(map[string]models.ResponseOrderTimeline)
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	events, err := h.Orders.LoadOrderTimeline(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = models.ResponseOrderTimeline{OrdersID: orderID, Status: status, Events: orderstatus.Timeline(events)}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+func (h *Handler) LoadDelivery(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseDeliveryInfo)
 	var retrievedOrder models.ResponseDeliveryInfo
@@ -580,14 +774,14 @@ func LoadDelivery(rw http.ResponseWriter, r *http.Request) {
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
 	orderID := uint(aByteToInt)
 	defer r.Body.Close()
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 	
 	
-	retrievedOrder, err = orderstorage.LoadDelivery(ctx, config.DB, orderID)
+	retrievedOrder, err = h.Orders.LoadDelivery(ctx, orderID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -604,7 +798,7 @@ func LoadDelivery(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateOrderStatus(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateOrderStatus(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var StatusObj models.RequestUpdateOrderStatus
@@ -630,58 +824,32 @@ func UpdateOrderStatus(rw http.ResponseWriter, r *http.Request) {
    
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
-	
-	err = orderstorage.UpdateOrderStatus(ctx, config.DB, orderID, StatusObj)
-
-	if err != nil {
+	userID := handlersfunc.UserIDContextReader(r)
+	change := models.OrderStatusChange{ToStatus: StatusObj.Status, Actor: orderstatus.ActorAdmin, UsersID: userID, Reason: StatusObj.Reason}
+	err = h.lifecycle().Transition(ctx, orderID, change)
+	switch {
+	case errors.Is(err, orderstatus.ErrIllegalTransition), errors.Is(err, orderstatus.ErrStatusChanged):
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	case errors.Is(err, errCaptureHook):
+		handlersfunc.HandleFailedCaptureError(rw)
+		return
+	case errors.Is(err, errReleaseHook):
+		handlersfunc.HandleFailedCancellationError(rw)
+		return
+	case errors.Is(err, errMailHook):
+		handlersfunc.HandleMailSendError(rw)
+		return
+	case err != nil:
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 
-	if StatusObj.Status == "IN_DELIVERY" {
-		//orderObj, err := orderstorage.RetrieveSingleOrder(ctx , storeDB, order.OrdersID) 
-		var deliveryObj models.ResponseDeliveryInfo
-		var contactData models.Contacts
-		var retrievedOrder models.ResponseOrderInfo
-		deliveryObj, err := orderstorage.LoadDelivery(ctx , config.DB, orderID)
-		if err != nil {
-			handlersfunc.HandleDatabaseServerError(rw)
-			return
-		}
-		retrievedOrder, err = orderstorage.LoadOrder(ctx, config.DB, orderID)
-		if err != nil {
-			handlersfunc.HandleDatabaseServerError(rw)
-			return
-		}
-		log.Println(retrievedOrder)
-		contactData = retrievedOrder.ContactData
-
-		// Send paid order email
-		from := "support@memoryprint.ru"
-		to := []string{contactData.Email}
-		subject := "Ваш заказ передан в службу доставки!"
-		mailType := emailutils.MailOrderInDelivery
-		mailData := &emailutils.MailData{
-			Username: contactData.FirstName,
-			Ordernum: orderID,
-			Trackingnum: *deliveryObj.TrackingNumber,
-			//Order: orderObj,
-		}
-
-		ms := &emailutils.SGMailService{config.YandexApiKey}
-		mailReq := emailutils.NewMail(from, to, subject, mailType, mailData)
-		err = emailutils.SendMail(mailReq, ms)
-		if err != nil {
-			handlersfunc.HandleMailSendError(rw)
-			return
-		}
-	}
-
 	rw.WriteHeader(http.StatusOK)
 	resp["response"] = 1
 	jsonResp, err := json.Marshal(resp)
@@ -692,7 +860,7 @@ func UpdateOrderStatus(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateOrderCommentary(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateOrderCommentary(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var CommentaryObj models.RequestUpdateOrderCommentary
@@ -719,13 +887,13 @@ func UpdateOrderCommentary(rw http.ResponseWriter, r *http.Request) {
    
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 	
-	err = orderstorage.UpdateOrderCommentary(ctx, config.DB, orderID, CommentaryObj)
+	err = h.Orders.UpdateOrderCommentary(ctx, orderID, CommentaryObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -743,7 +911,7 @@ func UpdateOrderCommentary(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func UploadOrderVideo(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UploadOrderVideo(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var VideoObj models.OrderVideo
@@ -769,13 +937,13 @@ func UploadOrderVideo(rw http.ResponseWriter, r *http.Request) {
    
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := orderstorage.CheckOrder(ctx, config.DB, orderID)
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 	
-	err = orderstorage.UploadOrderVideo(ctx, config.DB, orderID, VideoObj)
+	err = h.Orders.UploadOrderVideo(ctx, orderID, VideoObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -792,7 +960,7 @@ func UploadOrderVideo(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DownloadOrderVideo(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DownloadOrderVideo(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.OrderVideo)
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
@@ -803,7 +971,7 @@ func DownloadOrderVideo(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	
-	VideoObj, err := orderstorage.DownloadOrderVideo(ctx, config.DB, orderID)
+	VideoObj, err := h.Orders.DownloadOrderVideo(ctx, orderID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -821,17 +989,62 @@ func DownloadOrderVideo(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func CalculateDelivery(rw http.ResponseWriter, r *http.Request) {
+// LoadDeliveryPoints searches the pickup points and postamats by city, postal code and type,
+// or the nearest ones to the latitude and longitude.
+func (h *Handler) LoadDeliveryPoints(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseDeliveryPoints)
+	var query models.DeliveryPointQuery
+
+	defer r.Body.Close()
+	params := r.URL.Query()
+	query.City = params.Get("city")
+	query.PostalCode = params.Get("postal_code")
+	query.Type = strings.ToUpper(params.Get("type"))
+	if params.Get("latitude") != "" || params.Get("longitude") != "" {
+		latitude, latErr := strconv.ParseFloat(params.Get("latitude"), 64)
+		longitude, lonErr := strconv.ParseFloat(params.Get("longitude"), 64)
+		if latErr != nil || lonErr != nil {
+			handlersfunc.HandleDecodeError(rw, errors.New("invalid coordinates"))
+			return
+		}
+		query.Latitude = &latitude
+		query.Longitude = &longitude
+	}
+	rLimit, _ := strconv.Atoi(params.Get("limit"))
+	query.Limit = uint(rLimit)
+
+	validate := validator.New()
+	err := validate.Struct(query)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	points, err := h.Delivery.LoadDeliveryPoints(ctx, query)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = models.ResponseDeliveryPoints{Points: points}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+func (h *Handler) CalculateDelivery(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseDeliveryCost)
 	var PaymentObj models.ResponseDeliveryCost
-	var ApiPaymentObj models.ApiResponseDeliveryCost
 	var rCost models.UserRequestDeliveryCost
-	var rApiCost models.RequestDeliveryCost
-	var fromLoc models.Location
 	var toLoc models.Location
-	var p models.Package
-	var s models.Service
 	
 	err := json.NewDecoder(r.Body).Decode(&rCost)
 	if err != nil {
@@ -871,53 +1084,49 @@ func CalculateDelivery(rw http.ResponseWriter, r *http.Request) {
 	userID := handlersfunc.UserIDContextReader(r)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	countCheck := orderstorage.CheckCountProjects(ctx, config.DB, userID, uint(rCost.CountProjects))
+	countCheck := h.Orders.CheckCountProjects(ctx, userID, uint(rCost.CountProjects))
 	if countCheck == false {
 		handlersfunc.HandleCountProjectError(rw)
 		return
 	}
+	cart, err := h.Orders.LoadCart(ctx, userID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	projects, ok := quotedProjects(cart, rCost.Projects, rCost.CountProjects)
+	if !ok {
+		handlersfunc.HandleCountProjectError(rw)
+		return
+	}
+	books, err := h.Delivery.LoadProjectBooks(ctx, projects)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
 
 
 	defer r.Body.Close()
-	if rCost.Method == "DOOR" {
-		rApiCost.TariffCode = 139
-	} else if rCost.Method == "POSTAMAT" {
-		rApiCost.TariffCode = 138
-	} else if rCost.Method == "PVZ" {
-		rApiCost.TariffCode = 138
-	}
-
 	toLoc.Address = rCost.Address
 	toLoc.PostalCode = rCost.PostalCode
 	toLoc.City = rCost.City
-	rApiCost.ToLocation = toLoc
 
-	p.Weight = (300 * rCost.CountProjects)
-	p.Height = 3 * rCost.CountProjects
-	p.Width = 30 
-	p.Length = 30 
-	s.Code = "CARTON_BOX_500GR"
-	s.Parameter = strconv.Itoa(rCost.CountProjects)
-	rApiCost.Packages = append(rApiCost.Packages, p)
-	rApiCost.Services = append(rApiCost.Services, s)
-	fromLoc.PostalCode = "141016"
-	fromLoc.City = "Мытищи"
-	fromLoc.Address = "Тенистый бульвар, 11"
-	rApiCost.FromLocation = fromLoc
-
-	ApiPaymentObj, err = delivery.CalculateDelivery(rApiCost)
+	origin, err := delivery.ChooseOrigin(ctx, h.Delivery, rCost.Method, toLoc, rCost.Code)
+	if err != nil {
+		handlersfunc.HandleMissingWarehouseError(rw)
+		return
+	}
+	quote, err := h.Carrier.Quote(ctx, delivery.BookShipment(rCost.Method, delivery.WarehouseLocation(origin), toLoc, rCost.Code, books, rCost.PackageBox))
 	
 	if err != nil {
 		handlersfunc.HandleDeliveryCalculationError(rw)
 		return
 	}
-	PaymentObj.Amount = ApiPaymentObj.TotalSum
-	log.Println(ApiPaymentObj.PeriodMin)
-	log.Println(ApiPaymentObj.PeriodMax)
-	daysFrom := 4 + ApiPaymentObj.PeriodMin
+	PaymentObj.Amount = quote.Amount
+	daysFrom := 4 + quote.PeriodMin
 	dateFrom := AddWorkdays(time.Now(), int(daysFrom))
 	PaymentObj.ExpectedDeliveryFrom = dateFrom.Format("02-01-2006")
-	daysTo := 4 + ApiPaymentObj.PeriodMax
+	daysTo := 4 + quote.PeriodMax
 	dateTo := AddWorkdays(time.Now(), int(daysTo))
 	PaymentObj.ExpectedDeliveryTo = dateTo.Format("02-01-2006")
 	rw.WriteHeader(http.StatusOK)
@@ -931,37 +1140,565 @@ func CalculateDelivery(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func SentOrdersToPrint(ctx context.Context, storeDB *pgxpool.Pool) {
+// quotedProjects returns the copies of the cart projects the delivery is quoted for, every project listed once per copy:
+// the copies of the requested projects, which must all be in the cart, or the first count copies of the cart when none are requested.
+func quotedProjects(cart models.ResponseCart, requested []uint, count int) ([]uint, bool) {
 
-	ticker := time.NewTicker(config.UpdateInterval)
-	var err error
-	var orderList []models.PaidOrderObj
-
-	jobCh := make(chan models.PaidOrderObj)
-	for i := 0; i < config.WorkersCount; i++ {
-		go func() {
-			for job := range jobCh {
-	
-				err = orderstorage.OrdersToPrint(ctx, storeDB, job)
-				if err != nil {
-					log.Printf("Error happened when updating pending orders. Err: %s", err)
-					continue
-				}
-			}
-		}()
+	inCart := make(map[uint]int, len(cart.Projects))
+	var items []models.CartItem
+	for _, p := range cart.Projects {
+		inCart[p.ProjectID] = p.Quantity
+		items = append(items, models.CartItem{ProjectID: p.ProjectID, Quantity: p.Quantity})
+	}
+	if len(requested) == 0 {
+		projects := cartCopies(items)
+		if len(projects) > count {
+			projects = projects[:count]
+		}
+		return projects, true
+	}
+	items = items[:0]
+	for _, pID := range requested {
+		quantity, ok := inCart[pID]
+		if !ok {
+			return nil, false
+		}
+		items = append(items, models.CartItem{ProjectID: pID, Quantity: quantity})
 	}
+	return cartCopies(items), true
+}
 
-	for range ticker.C {
+// RefundOrder returns part or all of the order payment to the customer.
+func (h *Handler) RefundOrder(rw http.ResponseWriter, r *http.Request) {
 
-		orderList, err = orderstorage.LoadPaidOrders(ctx, storeDB)
-		if err != nil {
-			log.Printf("Error happened when retrieving pending orders. Err: %s", err)
-			continue
-		}
+	resp := make(map[string]models.Refund)
+	var RefundObj models.RequestRefund
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
 
-		for _, order := range orderList {
-			jobCh <- order
+	err := json.NewDecoder(r.Body).Decode(&RefundObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(RefundObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingOrderError(rw)
+		return
+	}
+	// only an order whose payment has been captured can be refunded
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving order status. Err: %s", err)
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if !orderstatus.CanTransition(status, orderstatus.Refunded) {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+
+	refund, err := transactions.RefundTransaction(h.Payments, h.Orders, orderID, RefundObj)
+	if errors.Is(err, transactions.ErrNothingToRefund) || errors.Is(err, transactions.ErrRefundExceedsPayment) {
+		handlersfunc.HandleRefundExceedsPaymentError(rw)
+		return
+	}
+	if errors.Is(err, transactions.ErrNotCaptured) {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to refund order %d", orderID)
+		handlersfunc.HandleFailedRefundError(rw)
+		return
+	}
 
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = refund
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadRefunds lists the refunds issued for the order.
+func (h *Handler) LoadRefunds(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseRefunds)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+
+	refunds, err := h.Orders.LoadRefunds(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = refunds
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadOrderStatusHistory lists the status changes of the order with who made them and why.
+func (h *Handler) LoadOrderStatusHistory(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseOrderStatusHistory)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+
+	history, err := h.Orders.LoadOrderStatusHistory(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = history
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+func (h *Handler) LoadReceipts(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseReceipts)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+
+	receipts, err := h.Orders.LoadReceipts(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = receipts
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// ResendReceipt mails the stored fiscal receipt to the customer once more.
+func (h *Handler) ResendReceipt(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	receiptID := uint(aByteToInt)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	storedReceipt, err := h.Orders.LoadReceipt(ctx, receiptID)
+	if err != nil || storedReceipt.Receipt.Email == "" {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+
+	from := "support@memoryprint.ru"
+	to := []string{storedReceipt.Receipt.Email}
+	subject := "Кассовый чек MemoryPrint"
+	mailType := emailutils.MailReceipt
+	mailData := &emailutils.MailData{
+		Receipt: storedReceipt.Receipt,
+	}
+
+	ms := &emailutils.SGMailService{config.YandexApiKey}
+	mailReq := emailutils.NewMail(from, to, subject, mailType, mailData)
+	err = emailutils.SendMail(mailReq, ms)
+	if err != nil {
+		handlersfunc.HandleMailSendError(rw)
+		return
+	}
+	err = h.Orders.MarkReceiptSent(ctx, receiptID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = 1
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// PaymentCallback receives the server-to-server notification of the acquirer about a payment.
+func (h *Handler) PaymentCallback(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]string)
+	defer r.Body.Close()
+
+	err := r.ParseForm()
+	if err != nil {
+		log.Printf("Error happened when parsing payment callback. Err: %s", err)
+		handlersfunc.HandleWrongBytesInput(rw)
+		return
+	}
+	if !transactions.VerifyCallback(r.Form, config.BankCallbackSecret) {
+		log.Printf("Payment callback with invalid checksum for the bank order %s", r.Form.Get("mdOrder"))
+		handlersfunc.HandlePermissionError(rw)
+		return
+	}
+
+	status, err := transactions.ProcessCallback(h.Payments, h.Orders, h.Users, r.Form.Get("mdOrder"), r.Form.Get("operation"), r.Form.Get("status") == "1")
+	if err != nil {
+		log.Printf("Failed to process payment callback for the bank order %s", r.Form.Get("mdOrder"))
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = status
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// sendOrderToPrint captures the payment held for the order before moving it to IN_PRINT.
+// An order whose payment can not be captured stays PAID and is listed in LoadCaptureFailures.
+func (h *Handler) sendOrderToPrint(ctx context.Context, order models.PaidOrderObj) error {
+
+	if time.Since(order.LastEditedAt).Hours() < 0.5 {
+		return nil
+	}
+	err := transactions.CaptureTransaction(h.Payments, h.Orders, order.OrdersID)
+	if err != nil {
+		log.Printf("Order %d is not sent to print, its payment could not be captured", order.OrdersID)
+		return err
+	}
+	return h.Orders.OrdersToPrint(ctx, order)
+}
+
+// LoadCaptureFailures lists the paid orders held back from print because their payment could not be captured.
+func (h *Handler) LoadCaptureFailures(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseCaptureFailures)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	failures, err := h.Orders.LoadCaptureFailures(ctx)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = failures
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadHeldPayments lists the payments the bank holds for orders which do not take them, e.g. paid after the order expired,
+// until the bank has reversed them.
+func (h *Handler) LoadHeldPayments(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseHeldPayments)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	payments, err := h.Orders.LoadHeldPayments(ctx)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = payments
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadDeliveryFailures lists the orders ready for delivery whose shipment could not be registered with the carrier.
+func (h *Handler) LoadDeliveryFailures(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseDeliveryFailures)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	failures, err := h.Delivery.LoadDeliveryFailures(ctx)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = failures
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// RegisterDelivery registers the shipment of an order ready for delivery with the carrier again, e.g. after the admins fixed the address.
+func (h *Handler) RegisterDelivery(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]string)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	checkExists := h.Orders.CheckOrder(ctx, orderID)
+	if !checkExists {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if status != orderstatus.ReadyForDelivery {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+	err = delivery.OrderDelivery(h.Carrier, h.Delivery, orderID)
+	if errors.Is(err, delivery.ErrShipmentRegistered) {
+		handlersfunc.HandleDeliveryRegisteredError(rw)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to register delivery for the order %d. Err: %s", orderID, err)
+		handlersfunc.HandleFailedDeliveryError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = "1"
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// confirmShipment moves the order to IN_DELIVERY once the carrier has accepted its shipment and assigned the tracking number.
+func (h *Handler) confirmShipment(ctx context.Context, orderID uint) error {
+
+	confirmed, err := delivery.ConfirmDelivery(h.Carrier, h.Delivery, orderID)
+	if err != nil || !confirmed {
+		return err
+	}
+	change := models.OrderStatusChange{ToStatus: orderstatus.InDelivery, Actor: orderstatus.ActorSystem, Reason: "shipment registered with the carrier"}
+	return h.lifecycle().Transition(ctx, orderID, change)
+}
+
+func (h *Handler) ConfirmShipments(ctx context.Context) {
+
+	ticker := time.NewTicker(config.UpdateInterval)
+	var err error
+	var orderList []uint
+
+	jobCh := make(chan uint)
+	for i := 0; i < config.WorkersCount; i++ {
+		go func() {
+			for job := range jobCh {
+
+				err := h.confirmShipment(ctx, job)
+				if err != nil {
+					log.Printf("Error happened when confirming shipment for the order %d. Err: %s", job, err)
+					continue
+				}
+			}
+		}()
+	}
+
+	for range ticker.C {
+
+		orderList, err = h.Delivery.LoadPendingShipments(ctx)
+		if err != nil {
+			log.Printf("Error happened when retrieving pending shipments. Err: %s", err)
+			continue
+		}
+
+		for _, order := range orderList {
+			jobCh <- order
+		}
+
+	}
+}
+
+func (h *Handler) SentOrdersToPrint(ctx context.Context) {
+
+	ticker := time.NewTicker(config.UpdateInterval)
+	var err error
+	var orderList []models.PaidOrderObj
+
+	jobCh := make(chan models.PaidOrderObj)
+	for i := 0; i < config.WorkersCount; i++ {
+		go func() {
+			for job := range jobCh {
+	
+				err := h.sendOrderToPrint(ctx, job)
+				if err != nil {
+					log.Printf("Error happened when updating pending orders. Err: %s", err)
+					continue
+				}
+			}
+		}()
+	}
+
+	for range ticker.C {
+
+		orderList, err = h.Orders.LoadPaidOrders(ctx)
+		if err != nil {
+			log.Printf("Error happened when retrieving pending orders. Err: %s", err)
+			continue
+		}
+
+		for _, order := range orderList {
+			jobCh <- order
+
+		}
+
+	}
+}
+
+// reconcilePayment asks the acquirer about the payment of the order and cancels the order
+// once it has stayed unpaid for longer than config.PaymentExpiryWindow. The order is only cancelled
+// when the acquirer has answered that the payment is pending or declined, or when no payment was registered,
+// and after the acquirer has closed the payment so that it can not be made for the cancelled order.
+func (h *Handler) reconcilePayment(ctx context.Context, order models.PendingPaymentObj) error {
+
+	status, err := transactions.FindTransactionStatus(h.Payments, h.Orders, order.OrdersID)
+	if status == "SUCCESSFUL" {
+		return nil
+	}
+	if err != nil && status != "UNSUCCESSFUL" && !errors.Is(err, orderstorage.ErrNoBankOrder) {
+		log.Printf("Error happened when checking payment status for the order %d. Err: %s", order.OrdersID, err)
+		return err
+	}
+	if time.Since(order.LastEditedAt) < config.PaymentExpiryWindow {
+		return nil
+	}
+	err = transactions.CancelTransaction(h.Payments, h.Orders, order.OrdersID)
+	if err != nil {
+		log.Printf("Error happened when closing the payment of the unpaid order %d. Err: %s", order.OrdersID, err)
+		return err
+	}
+	return h.Orders.ExpireOrderPayment(ctx, order.OrdersID)
+}
+
+// releaseHeldPayments reverses again the payments the bank still holds for orders which do not take them.
+func (h *Handler) releaseHeldPayments(ctx context.Context) {
+
+	held, err := h.Orders.LoadHeldPayments(ctx)
+	if err != nil {
+		log.Printf("Error happened when retrieving held payments. Err: %s", err)
+		return
+	}
+	for _, payment := range held.Payments {
+		err = transactions.ReleaseHeldPayment(h.Payments, h.Orders, payment.BankOrderID)
+		if err != nil {
+			log.Printf("Error happened when reversing held payment of the order %d. Err: %s", payment.OrdersID, err)
+		}
+	}
+}
+
+func (h *Handler) ReconcilePayments(ctx context.Context) {
+
+	ticker := time.NewTicker(config.UpdateInterval)
+	var err error
+	var orderList []models.PendingPaymentObj
+
+	jobCh := make(chan models.PendingPaymentObj)
+	for i := 0; i < config.WorkersCount; i++ {
+		go func() {
+			for job := range jobCh {
+
+				err := h.reconcilePayment(ctx, job)
+				if err != nil {
+					log.Printf("Error happened when expiring unpaid order. Err: %s", err)
+					continue
+				}
+			}
+		}()
+	}
+
+	for range ticker.C {
+
+		h.releaseHeldPayments(ctx)
+
+		orderList, err = h.Orders.LoadPendingPayments(ctx)
+		if err != nil {
+			log.Printf("Error happened when retrieving pending payments. Err: %s", err)
+			continue
+		}
+
+		for _, order := range orderList {
+			jobCh <- order
 		}
 
 	}
@@ -0,0 +1,705 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/memstore"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/transactions"
+	"github.com/gorilla/mux"
+)
+
+// testHandler serves the orders of a signed up customer from the in-memory storages, with the fake acquirer
+// and the fake CDEK api behind it and the prices of the photobooks the tests order in the catalog.
+type testHandler struct {
+	*Handler
+	gateway *transactions.FakeGateway
+	cdek    *delivery.FakeCDEK
+	files   *objectsstorage.MemoryFiles
+	userID  uint
+}
+
+func newTestHandler(t *testing.T) *testHandler {
+	stores := memstore.NewStores()
+	gateway := transactions.NewFakeGateway("http://localhost:8080")
+	cdek := delivery.NewFakeCDEK("client", "secret")
+	server := httptest.NewServer(cdek)
+	t.Cleanup(server.Close)
+	files := objectsstorage.NewMemoryFiles()
+	h := &testHandler{Handler: New(stores, gateway, delivery.NewCDEK(server.URL, "client", "secret"), files), gateway: gateway, cdek: cdek, files: files}
+
+	ctx := context.Background()
+	userID, err := stores.Users.CreateUser(ctx, models.SignUpUser{Name: "Name", Password: "MyPass123", Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a user", err)
+	}
+	h.userID = userID
+	var prices []models.Price
+	for _, variant := range []string{"STANDARD", "PREMIUM"} {
+		for _, cover := range []string{"HARD", "LEATHERETTE"} {
+			prices = append(prices, models.Price{Size: "SQUARE", Variant: variant, Cover: cover, Surface: "MATTE", BasePrice: money.FromRoubles(2500), ExtraPage: money.FromRoubles(60), IncludedPages: 20, PageStep: 2})
+		}
+	}
+	if _, err = stores.Objects.CreatePriceList(ctx, models.PriceList{Name: "Test", Prices: prices}); err != nil {
+		t.Fatalf("an error '%s' was not expected when adding prices", err)
+	}
+	return h
+}
+
+// standardBook is a photobook with the pages included in its base price.
+var standardBook = models.NewBlankProjectObj{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", CountPages: 20}
+
+// doorOrder is the checkout of one copy of the project delivered to the door in Novosibirsk.
+func doorOrder(projectID uint) models.RequestOrderPayment {
+	return models.RequestOrderPayment{
+		Cart:         []models.CartItem{{ProjectID: projectID, Quantity: 1}},
+		ContactData:  models.Contacts{FirstName: "Name", LastName: "Surname", Email: "user@example.com", Phone: "+79990000000"},
+		DeliveryData: models.Delivery{Method: "DOOR", PostalCode: "630099", Address: "Новосибирск, Красный проспект, 1"},
+	}
+}
+
+// project creates the photobook of the user.
+func (h *testHandler) project(t *testing.T, userID uint, book models.NewBlankProjectObj) uint {
+	projectID, err := h.Projects.CreateProject(context.Background(), userID, book)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a project", err)
+	}
+	return projectID
+}
+
+// checkout puts the projects of the order into the cart of the user and places the order from the warehouse,
+// which leaves it in PAYMENT_IN_PROGRESS. The delivery to the door costs 350.00.
+func (h *testHandler) checkout(t *testing.T, userID uint, orderObj models.RequestOrderPayment, warehouseID uint) (money.Money, uint) {
+	ctx := context.Background()
+	for _, item := range orderObj.Cart {
+		if _, err := h.Orders.AddCartItem(ctx, userID, item); err != nil {
+			t.Fatalf("an error '%s' was not expected when adding to the cart", err)
+		}
+	}
+	deliveryPrice := money.Zero
+	if orderObj.DeliveryData.Method == delivery.MethodDoor {
+		deliveryPrice = money.FromRoubles(350)
+	}
+	finalPrice, orderID, err := h.Orders.OrderPayment(ctx, orderObj, userID, deliveryPrice, warehouseID)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when paying for the order", err)
+	}
+	return finalPrice, orderID
+}
+
+// placeOrder checks out a standard photobook of the user delivered to the door.
+func (h *testHandler) placeOrder(t *testing.T, userID uint) uint {
+	_, orderID := h.checkout(t, userID, doorOrder(h.project(t, userID, standardBook)), 0)
+	return orderID
+}
+
+// registerPayment registers the payment of the order with the fake acquirer and returns its bank order id.
+func (h *testHandler) registerPayment(t *testing.T, orderID uint) string {
+	ctx := context.Background()
+	order, _ := h.Orders.RetrieveSingleOrder(ctx, orderID)
+	if _, err := transactions.CreateTransaction(h.gateway, h.Orders, orderID, *order.FinalPrice, "PHOTOBOOK", models.Receipt{}); err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a transaction", err)
+	}
+	bankOrderID, _ := h.Orders.GetBankTransactionID(ctx, orderID)
+	return bankOrderID
+}
+
+// pay has the fake acquirer approve the payment of the order and records it, which leaves the order PAID.
+func (h *testHandler) pay(t *testing.T, orderID uint) {
+	h.gateway.Approve(h.registerPayment(t, orderID))
+	if err := h.Orders.UpdateSuccessfulTransaction(context.Background(), orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when confirming the payment", err)
+	}
+}
+
+// advance moves the order through the statuses, skipping the hooks of the lifecycle.
+func (h *testHandler) advance(t *testing.T, orderID uint, statuses ...string) {
+	ctx := context.Background()
+	for _, status := range statuses {
+		from, _ := h.Orders.LoadOrderStatus(ctx, orderID)
+		if err := h.Orders.UpdateOrderStatus(ctx, orderID, models.OrderStatusChange{FromStatus: from, ToStatus: status}); err != nil {
+			t.Fatalf("an error '%s' was not expected when moving the order to %s", err, status)
+		}
+	}
+}
+
+// request builds the request of the user, none for a zero userID, to the route with the id variable.
+func request(method string, path string, body string, userID uint, id string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if userID != 0 {
+		r = r.WithContext(context.WithValue(r.Context(), config.UserIDKey, userID))
+	}
+	if id != "" {
+		r = mux.SetURLVars(r, map[string]string{"id": id})
+	}
+	return r
+}
+
+// serve has the handler answer the request and decodes the response.
+func serve(handler http.HandlerFunc, r *http.Request) map[string]json.RawMessage {
+	rw := httptest.NewRecorder()
+	handler(rw, r)
+	var resp map[string]json.RawMessage
+	json.Unmarshal(rw.Body.Bytes(), &resp)
+	return resp
+}
+
+// errorCode returns the code of the error in the response, zero when the request succeeded.
+func errorCode(resp map[string]json.RawMessage) uint {
+	var errorB handlersfunc.ErrorBody
+	json.Unmarshal(resp["error"], &errorB)
+	return errorB.ErrorCode
+}
+
+func TestReconcilePayment(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		age         time.Duration
+		unreachable bool
+		wantErr     bool
+		status      string
+	}{
+		{"fresh unpaid order is kept", 0, false, false, "PAYMENT_IN_PROGRESS"},
+		// an acquirer which does not answer about the payment does not get the order cancelled
+		{"order of an unknown payment is kept", config.PaymentExpiryWindow, true, true, "PAYMENT_IN_PROGRESS"},
+		{"stale unpaid order expires", config.PaymentExpiryWindow, false, false, "CANCELLED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			ctx := context.Background()
+			orderID := h.placeOrder(t, h.userID)
+			bankOrderID := h.registerPayment(t, orderID)
+			reconciler := h.Handler
+			if tt.unreachable {
+				reconciler = New(h.Stores, transactions.NewFakeGateway("http://localhost:8080"), h.Carrier, h.Files)
+			}
+
+			err := reconciler.reconcilePayment(ctx, models.PendingPaymentObj{OrdersID: orderID, LastEditedAt: time.Now().Add(-tt.age)})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected an error %t, got %v", tt.wantErr, err)
+			}
+			if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != tt.status {
+				t.Fatalf("expected the order to be %s, got %s", tt.status, status)
+			}
+			if tt.status == "CANCELLED" && !h.Orders.CheckCountProjects(ctx, h.userID, 1) {
+				t.Errorf("expected the project of the expired order back in the cart")
+			}
+			// the customer can not pay for the expired order any more
+			if payment, _ := h.gateway.Status(ctx, bankOrderID); (payment.ActionCode == transactions.ActionCodeDeclined) != (tt.status == "CANCELLED") {
+				t.Errorf("expected the payment declined %t, got the action code %d", tt.status == "CANCELLED", payment.ActionCode)
+			}
+		})
+	}
+}
+
+func TestCancelPaymentReleasesCertificate(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	cID, _ := h.Users.CreateCertificate(ctx, &models.GiftCertificate{Deposit: money.FromRoubles(3000), Recipientemail: "user@example.com", Recipientname: "Name"})
+	h.Users.PurchaseCertificate(ctx, cID)
+	certificates, _ := h.Users.LoadUnSentCertificate(ctx)
+	code := certificates[0].Code
+
+	orderObj := doorOrder(h.project(t, h.userID, standardBook))
+	orderObj.Giftcertificate = code
+	_, orderID := h.checkout(t, h.userID, orderObj, 0)
+	if err := h.Orders.CancelPayment(ctx, orderID, h.userID); err != nil {
+		t.Fatalf("an error '%s' was not expected when cancelling the payment", err)
+	}
+	// the deposit was never deducted, the certificate is only released
+	deposit, status, _ := h.Users.UseCertificate(ctx, code, h.userID)
+	if status != "ACTIVE" || deposit != money.FromRoubles(3000) {
+		t.Errorf("expected the gift certificate to be usable with its whole deposit, got %s %s", status, deposit)
+	}
+}
+
+func TestPaymentCallback(t *testing.T) {
+
+	secret := config.BankCallbackSecret
+	config.BankCallbackSecret = "callbacksecret"
+	t.Cleanup(func() { config.BankCallbackSecret = secret })
+
+	tests := []struct {
+		name    string
+		forged  bool
+		repeats int
+		code    int
+		status  string
+	}{
+		{"forged callback", true, 1, http.StatusForbidden, "PAYMENT_IN_PROGRESS"},
+		{"signed callback", false, 1, http.StatusOK, "PAID"},
+		{"repeated signed callback", false, 2, http.StatusOK, "PAID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			ctx := context.Background()
+			orderID := h.placeOrder(t, h.userID)
+			params := url.Values{}
+			params.Set("mdOrder", h.registerPayment(t, orderID))
+			params.Set("orderNumber", "PHOTOBOOK"+strconv.Itoa(int(orderID)))
+			params.Set("operation", transactions.CallbackOperationApproved)
+			params.Set("status", "1")
+			params.Set("checksum", transactions.CallbackChecksum(params, config.BankCallbackSecret))
+			if tt.forged {
+				params.Set("checksum", "forged")
+			}
+			for i := 0; i < tt.repeats; i++ {
+				rw := httptest.NewRecorder()
+				h.PaymentCallback(rw, httptest.NewRequest(http.MethodGet, "/api/v1/payments/callback?"+params.Encode(), nil))
+				if rw.Code != tt.code {
+					t.Fatalf("expected the callback to be answered with %d, got %d", tt.code, rw.Code)
+				}
+			}
+			if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != tt.status {
+				t.Errorf("expected order status %s, got %s", tt.status, status)
+			}
+		})
+	}
+}
+
+// reverseFailingGateway is an acquirer which does not reverse payments.
+type reverseFailingGateway struct {
+	*transactions.FakeGateway
+}
+
+func (g reverseFailingGateway) Reverse(ctx context.Context, bankOrderID string) error {
+	return errors.New("acquirer is not available")
+}
+
+func TestPaymentOfExpiredOrder(t *testing.T) {
+
+	secret := config.BankCallbackSecret
+	config.BankCallbackSecret = "callbacksecret"
+	t.Cleanup(func() { config.BankCallbackSecret = secret })
+
+	expire := func(h *testHandler, orderID uint) { h.Orders.ExpireOrderPayment(context.Background(), orderID) }
+	tests := []struct {
+		name       string
+		giveUp     func(h *testHandler, orderID uint)
+		unreversed bool
+	}{
+		{"held payment reversed", expire, false},
+		{"held payment reversed by the reconciliation", expire, true},
+		{"payment of an order cancelled meanwhile", func(h *testHandler, orderID uint) {
+			h.Orders.UpdateOrderStatus(context.Background(), orderID, models.OrderStatusChange{FromStatus: "PAYMENT_IN_PROGRESS", ToStatus: "CANCELLED", Actor: "ADMIN"})
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t)
+			ctx := context.Background()
+			orderID := h.placeOrder(t, h.userID)
+			bankOrderID := h.registerPayment(t, orderID)
+			tt.giveUp(h, orderID)
+			// the customer pays on the form left open after the order was given up
+			h.gateway.Approve(bankOrderID)
+			if tt.unreversed {
+				h.Payments = reverseFailingGateway{h.gateway}
+			}
+			params := url.Values{}
+			params.Set("mdOrder", bankOrderID)
+			params.Set("operation", transactions.CallbackOperationApproved)
+			params.Set("status", "1")
+			params.Set("checksum", transactions.CallbackChecksum(params, config.BankCallbackSecret))
+			h.PaymentCallback(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/payments/callback?"+params.Encode(), nil))
+
+			if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != "CANCELLED" {
+				t.Fatalf("expected the order to stay cancelled, got %s", status)
+			}
+			var held models.ResponseHeldPayments
+			json.Unmarshal(serve(h.LoadHeldPayments, request(http.MethodGet, "/api/v1/admin/load-held-payments", "", 0, ""))["response"], &held)
+			if tt.unreversed != (len(held.Payments) == 1) || tt.unreversed && (held.Payments[0].OrdersID != orderID || held.Payments[0].ReverseError == "") {
+				t.Fatalf("expected the payment listed as held %t, got %v", tt.unreversed, held.Payments)
+			}
+			if tt.unreversed {
+				h.Payments = h.gateway
+				h.releaseHeldPayments(ctx)
+			}
+			if held, _ := h.Orders.LoadHeldPayments(ctx); !h.gateway.Reversed(bankOrderID) || len(held.Payments) != 0 {
+				t.Errorf("expected the held payment to be reversed, got %v", held.Payments)
+			}
+		})
+	}
+}
+
+func TestUpdateOrderStatus(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID := h.placeOrder(t, h.userID)
+	h.pay(t, orderID)
+	id := strconv.Itoa(int(orderID))
+
+	tests := []struct {
+		status  string
+		allowed bool
+	}{
+		{"AWAITING_PAYMENT", false},
+		{"IN_PRINT", true},
+	}
+	for _, tt := range tests {
+		body := `{"status": "` + tt.status + `", "reason": "checked by support"}`
+		resp := serve(h.UpdateOrderStatus, request(http.MethodPost, "/api/v1/admin/change-order-status/"+id, body, 42, id))
+		if (resp["error"] == nil) != tt.allowed {
+			t.Fatalf("expected the change to %s allowed %t, got %v", tt.status, tt.allowed, resp)
+		}
+	}
+	if transaction, _ := h.Orders.LoadPaidTransaction(ctx, orderID); transaction.BankStatus != "CAPTURED" {
+		t.Errorf("expected the payment to be captured before print, got %s", transaction.BankStatus)
+	}
+	history, _ := h.Orders.LoadOrderStatusHistory(ctx, orderID)
+	last := history.History[len(history.History)-1]
+	if len(history.History) != 3 || last.FromStatus != "PAID" || last.ToStatus != "IN_PRINT" || last.Actor != "ADMIN" || last.UsersID != 42 || last.Reason != "checked by support" {
+		t.Errorf("expected the status changes to be recorded with the admin and the reason, got %v", history.History)
+	}
+}
+
+func TestRefundOrder(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID := h.placeOrder(t, h.userID)
+	h.pay(t, orderID)
+
+	tests := []struct {
+		name    string
+		orderID uint
+		before  func()
+		code    uint
+	}{
+		{"missing order", orderID + 100, nil, 446},
+		{"payment held before the capture", orderID, nil, 432},
+		{"captured payment", orderID, func() {
+			h.sendOrderToPrint(ctx, models.PaidOrderObj{OrdersID: orderID, LastEditedAt: time.Now().Add(-time.Hour)})
+		}, 0},
+	}
+	for _, tt := range tests {
+		if tt.before != nil {
+			tt.before()
+		}
+		id := strconv.Itoa(int(tt.orderID))
+		resp := serve(h.RefundOrder, request(http.MethodPost, "/api/v1/admin/refund-order/"+id, `{"amount": 500, "reason": "damaged cover"}`, 0, id))
+		if code := errorCode(resp); code != tt.code {
+			t.Errorf("%s: expected error code %d, got %s", tt.name, tt.code, resp["error"])
+		}
+	}
+}
+
+// registeredShipment moves a standard photobook delivered to the door to READY_FOR_DELIVERY, which registers its shipment
+// with the carrier, and returns the order with the shipment id.
+func (h *testHandler) registeredShipment(t *testing.T) (uint, string) {
+	ctx := context.Background()
+	h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Новосибирск", PostalCode: "630005", City: "Новосибирск", Address: "ул. Фрунзе, 5", CityCode: 270})
+	orderID := h.placeOrder(t, h.userID)
+	h.advance(t, orderID, "PAID", "IN_PRINT")
+	if err := h.lifecycle().Transition(ctx, orderID, models.OrderStatusChange{ToStatus: "READY_FOR_DELIVERY"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when finishing the print", err)
+	}
+	_, uuid, _, _, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	return orderID, uuid
+}
+
+func TestRegisterDelivery(t *testing.T) {
+
+	h := newTestHandler(t)
+	orderID, uuid := h.registeredShipment(t)
+	id := strconv.Itoa(int(orderID))
+	// the registered shipment is not registered again
+	resp := serve(h.RegisterDelivery, request(http.MethodPost, "/api/v1/admin/register-delivery/"+id, "", 0, id))
+	if code := errorCode(resp); code != 447 {
+		t.Fatalf("expected the second registration of the shipment to be refused, got %s", resp["error"])
+	}
+	if _, again, _, _, _ := h.Delivery.FindDeliveryUUID(context.Background(), orderID); again != uuid {
+		t.Errorf("expected the shipment to be kept, got %s", again)
+	}
+
+	// the failed shipment is registered again without the tracking of the previous one
+	ctx := context.Background()
+	deliveryID, _, _, _, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	h.Delivery.UpdateTrackingNumber(ctx, deliveryID, "1106207236")
+	h.Delivery.UpdateDeliveryStatus(ctx, deliveryID, "INVALID")
+	h.Delivery.UpdateDeliveryError(ctx, orderID, "recipient phone is invalid")
+	resp = serve(h.RegisterDelivery, request(http.MethodPost, "/api/v1/admin/register-delivery/"+id, "", 0, id))
+	if resp["error"] != nil {
+		t.Fatalf("expected the failed shipment to be registered again, got %s", resp["error"])
+	}
+	_, again, status, trackingNumber, _ := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	if again == uuid || status != "" || trackingNumber != "" {
+		t.Errorf("expected a new shipment without tracking, got %s in status %q tracked as %q", again, status, trackingNumber)
+	}
+	if failed, _ := h.Delivery.DeliveryFailed(ctx, orderID); failed {
+		t.Errorf("expected the registration error to be cleared")
+	}
+}
+
+func TestConfirmShipment(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID, uuid := h.registeredShipment(t)
+
+	h.confirmShipment(ctx, orderID)
+	if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != "READY_FOR_DELIVERY" {
+		t.Fatalf("expected the order to wait for the carrier to accept the shipment, got %s", status)
+	}
+	h.cdek.Accept(uuid)
+	// the tracking mail can not be sent here, the status change does not depend on it
+	h.confirmShipment(ctx, orderID)
+	if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != "IN_DELIVERY" {
+		t.Errorf("expected the accepted shipment to move the order to IN_DELIVERY, got %s", status)
+	}
+	if _, _, _, trackingNumber, _ := h.Delivery.FindDeliveryUUID(ctx, orderID); trackingNumber == "" {
+		t.Errorf("expected the tracking number of the accepted shipment to be stored")
+	}
+}
+
+func TestLoadDeliveryPoints(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	// a point is not refused before the first refresh, the points are loaded from the carrier
+	if exists, err := delivery.CheckPoint(ctx, h.Carrier, h.Delivery, "NSK27", "PVZ"); !exists || err != nil {
+		t.Fatalf("expected the pickup point to be found at the carrier, got %t, %v", exists, err)
+	}
+	if err := delivery.RefreshDeliveryPoints(ctx, h.Carrier, h.Delivery); err != nil {
+		t.Fatalf("an error '%s' was not expected when refreshing delivery points", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		codes []string
+	}{
+		// next to the Pushkin monument
+		{"nearest points", "latitude=55.7652&longitude=37.6059&limit=2", []string{"MSK1", "MSK2"}},
+		{"postamats of the city", "city=москва&type=postamat", []string{"MSK2"}},
+	}
+	for _, tt := range tests {
+		resp := serve(h.LoadDeliveryPoints, request(http.MethodGet, "/api/v1/delivery/points?"+tt.query, "", 0, ""))
+		var points models.ResponseDeliveryPoints
+		json.Unmarshal(resp["response"], &points)
+		var codes []string
+		for _, point := range points.Points {
+			codes = append(codes, point.Code)
+		}
+		if strings.Join(codes, ",") != strings.Join(tt.codes, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.codes, codes)
+		}
+		if tt.name == "nearest points" && (points.Points[0].Distance == nil || *points.Points[0].Distance > 1.5) {
+			t.Errorf("expected Tverskaya within 1.5 km, got %v", points.Points[0].Distance)
+		}
+	}
+	pvz, _ := delivery.CheckPoint(ctx, h.Carrier, h.Delivery, "NSK27", "PVZ")
+	postamat, _ := delivery.CheckPoint(ctx, h.Carrier, h.Delivery, "NSK27", "POSTAMAT")
+	if !pvz || postamat {
+		t.Errorf("expected the pickup point code to be valid for PVZ delivery only")
+	}
+}
+
+func TestOrderKeepsPricesOfCheckout(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	book := standardBook
+	book.CountPages = 23
+	// 23 pages are 3 over the 20 included, sold as 4 in steps of 2
+	finalPrice, orderID := h.checkout(t, h.userID, models.RequestOrderPayment{Cart: []models.CartItem{{ProjectID: h.project(t, h.userID, book), Quantity: 1}}}, 0)
+	if finalPrice != money.FromRoubles(2500+4*60) {
+		t.Fatalf("expected the order to cost 2740, got %s", finalPrice)
+	}
+
+	scheduledID, _ := h.Objects.CreatePriceList(ctx, models.PriceList{Name: "Next year", EffectiveFrom: time.Now().AddDate(1, 0, 0).Unix(), Prices: []models.Price{{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", BasePrice: money.FromRoubles(9000)}}})
+	raisedID, _ := h.Objects.CreatePriceList(ctx, models.PriceList{Name: "Raised", Prices: []models.Price{{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", BasePrice: money.FromRoubles(3000), ExtraPage: money.FromRoubles(80), IncludedPages: 20, PageStep: 2}}})
+	prices, _ := h.Objects.RetrievePrices(ctx)
+	if len(prices.Prices) != 1 || prices.Prices[0].BasePrice != money.FromRoubles(3000) {
+		t.Fatalf("expected the raised prices to be in effect and the scheduled ones not yet, got %+v", prices)
+	}
+
+	order, err := h.Orders.RetrieveSingleOrder(ctx, orderID)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when loading the order", err)
+	}
+	if order.Projects[0].BasePrice != money.FromRoubles(2740) {
+		t.Errorf("expected the order to keep the price of the checkout, got %s", order.Projects[0].BasePrice)
+	}
+	if len(order.Items) != 2 || order.Items[1].Code != "EXTRA_PAGES" || order.Items[1].Quantity != 4 || order.Items[1].CountPages != 23 || order.Items[1].UnitPrice != money.FromRoubles(60) {
+		t.Errorf("expected the base and the extra pages items with the options of the book, got %+v", order.Items)
+	}
+
+	if err = h.Objects.DeletePriceList(ctx, raisedID); err == nil {
+		t.Errorf("expected the price list in effect to be kept")
+	}
+	if err = h.Objects.DeletePriceList(ctx, scheduledID); err != nil {
+		t.Errorf("an error '%s' was not expected when deleting the scheduled price list", err)
+	}
+}
+
+func TestCheckoutIdempotencyKey(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Новосибирск", PostalCode: "630005", City: "Новосибирск", Address: "ул. Фрунзе, 5", CityCode: 270})
+	projectID := h.project(t, h.userID, standardBook)
+	h.Orders.AddCartItem(ctx, h.userID, models.CartItem{ProjectID: projectID, Quantity: 1})
+
+	orderBody := `{"cart": [{"project_id": ` + strconv.Itoa(int(projectID)) + `, "quantity": 1}], "contact_data": {"first_name": "Name", "last_name": "Surname", "email": "user@example.com", "phone": "+79990000000"}, "delivery_data": {"method": "DOOR", "postal_code": "630099", "address": "Новосибирск, Красный проспект, 1"}, "package_box": true}`
+	checkout := func() map[string]json.RawMessage {
+		r := request(http.MethodPost, "/api/v1/order-payment", orderBody, h.userID, "")
+		r.Header.Set("Idempotency-Key", "checkout-1")
+		return serve(h.OrderPayment, r)
+	}
+
+	first := checkout()
+	var link models.TransactionLink
+	if err := json.Unmarshal(first["response"], &link); err != nil || link.PaymentLink == "" {
+		t.Fatalf("expected the checkout to return the payment link, got %v", first)
+	}
+	// the project has left the cart, the retry is answered by the order of the first checkout
+	repeated := checkout()
+	if string(repeated["response"]) != string(first["response"]) {
+		t.Fatalf("expected the retry to get the same payment link, got %v", repeated)
+	}
+	orders, _ := h.Orders.RetrieveOrders(ctx, h.userID, true, 0, 10)
+	if len(orders.Orders) != 1 {
+		t.Errorf("expected a single order for the repeated checkout, got %d", len(orders.Orders))
+	}
+
+	tests := []struct {
+		key     string
+		orderID uint
+		err     error
+	}{
+		{"checkout-1", orders.Orders[0].OrderID, orderstorage.ErrCheckoutRepeated},
+		{"checkout-2", 0, orderstorage.ErrNotInCart},
+	}
+	for _, tt := range tests {
+		orderObj := models.RequestOrderPayment{Cart: []models.CartItem{{ProjectID: projectID, Quantity: 1}}, IdempotencyKey: tt.key}
+		if _, orderID, err := h.Orders.OrderPayment(ctx, orderObj, h.userID, money.Zero, 0); !errors.Is(err, tt.err) || orderID != tt.orderID {
+			t.Errorf("%s: expected the store to refuse the checkout with %d, %v, got %d, %v", tt.key, tt.orderID, tt.err, orderID, err)
+		}
+		if orderID, _, _ := h.Orders.FindCheckout(ctx, h.userID, tt.key); orderID != tt.orderID {
+			t.Errorf("%s: expected the checkout to be found as %d, got %d", tt.key, tt.orderID, orderID)
+		}
+	}
+}
+
+// failingGateway is an acquirer which does not register payments.
+type failingGateway struct {
+	*transactions.FakeGateway
+}
+
+func (g failingGateway) Register(ctx context.Context, orderNumber string, amount money.Money, returnURL string, receipt models.Receipt) (models.ResponseTransaction, error) {
+	return models.ResponseTransaction{}, errors.New("acquirer is not available")
+}
+
+func TestCheckoutRetriedAfterFailedRegistration(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	h.Delivery.CreateWarehouse(ctx, models.Warehouse{Name: "Новосибирск", PostalCode: "630005", City: "Новосибирск", Address: "ул. Фрунзе, 5", CityCode: 270})
+	projectID := h.project(t, h.userID, standardBook)
+	h.Orders.AddCartItem(ctx, h.userID, models.CartItem{ProjectID: projectID, Quantity: 1})
+	orderBody := `{"cart": [{"project_id": ` + strconv.Itoa(int(projectID)) + `, "quantity": 1}], "contact_data": {"first_name": "Name", "last_name": "Surname", "email": "user@example.com", "phone": "+79990000000"}, "delivery_data": {"method": "DOOR", "postal_code": "630099", "address": "Новосибирск, Красный проспект, 1"}, "package_box": true}`
+	checkout := func() map[string]json.RawMessage {
+		r := request(http.MethodPost, "/api/v1/order-payment", orderBody, h.userID, "")
+		r.Header.Set("Idempotency-Key", "checkout-1")
+		return serve(h.OrderPayment, r)
+	}
+
+	h.Payments = failingGateway{h.gateway}
+	if resp := checkout(); errorCode(resp) != 406 {
+		t.Fatalf("expected the checkout to fail without the payment link, got %v", resp)
+	}
+	orders, _ := h.Orders.RetrieveOrders(ctx, h.userID, false, 0, 10)
+	if len(orders.Orders) != 1 || orders.Orders[0].Status != "CANCELLED" {
+		t.Fatalf("expected the order without a payment to be cancelled, got %v", orders.Orders)
+	}
+	if orderID, _, _ := h.Orders.FindCheckout(ctx, h.userID, "checkout-1"); orderID != 0 {
+		t.Errorf("expected the cancelled order to give up the idempotency key, got %d", orderID)
+	}
+
+	h.Payments = h.gateway
+	var link models.TransactionLink
+	if resp := checkout(); json.Unmarshal(resp["response"], &link) != nil || link.PaymentLink == "" {
+		t.Fatalf("expected the retry to register the payment, got %v", resp)
+	}
+}
+
+func TestPromocodeRedemptions(t *testing.T) {
+
+	h := newTestHandler(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).Unix()
+	h.Users.CreatePromooffer(ctx, &models.NewPromooffer{Code: "ONCE", DiscountType: "FIXED", Amount: money.FromRoubles(500), ExpiresAt: expiresAt, IsOnetime: true})
+	h.Users.CreatePromooffer(ctx, &models.NewPromooffer{Code: "FREESHIP", DiscountType: "FREE_SHIPPING", ExpiresAt: expiresAt, PerUserLimit: 1})
+	var lastOrderID uint
+	checkout := func(userID uint, code string) (money.Money, error) {
+		item := models.CartItem{ProjectID: h.project(t, userID, standardBook), Quantity: 1}
+		h.Orders.AddCartItem(ctx, userID, item)
+		finalPrice, orderID, err := h.Orders.OrderPayment(ctx, models.RequestOrderPayment{Cart: []models.CartItem{item}, Promocode: code}, userID, money.FromRoubles(300), 0)
+		if err == nil {
+			lastOrderID = orderID
+		}
+		return finalPrice, err
+	}
+
+	tests := []struct {
+		name   string
+		userID uint
+		code   string
+		price  money.Money
+		err    error
+		after  func()
+	}{
+		// the redemption is reserved for the unpaid order, no other order may take the one-time code
+		{"one-time code", 1, "ONCE", money.FromRoubles(2500 - 500 + 300), nil, nil},
+		{"reserved one-time code", 2, "ONCE", 0, orderstorage.ErrPromocodeUnavailable, func() {
+			if _, status, _ := h.Users.CheckPromocode(ctx, "ONCE", 2); status != "ALREADY USED" {
+				t.Errorf("expected the reserved one-time code to be used, got %s", status)
+			}
+			// the expired order releases its redemption
+			h.Orders.ExpireOrderPayment(ctx, lastOrderID)
+		}},
+		{"released one-time code", 2, "ONCE", money.FromRoubles(2500 - 500 + 300), nil, func() {
+			h.Orders.UpdateSuccessfulTransaction(ctx, lastOrderID)
+			if _, status, _ := h.Users.CheckPromocode(ctx, "ONCE", 1); status != "ALREADY USED" {
+				t.Errorf("expected the redeemed one-time code to be used, got %s", status)
+			}
+		}},
+		{"free shipping", 3, "FREESHIP", money.FromRoubles(2500), nil, func() {
+			if order, _ := h.Orders.LoadOrder(ctx, lastOrderID); order.DeliveryData.Amount != money.Zero {
+				t.Errorf("expected the delivery of the order to be free, got %s", order.DeliveryData.Amount)
+			}
+		}},
+		{"customer limit of the code", 3, "FREESHIP", 0, orderstorage.ErrPromocodeUnavailable, nil},
+		{"code of another customer", 4, "FREESHIP", money.FromRoubles(2500), nil, nil},
+	}
+	for _, tt := range tests {
+		finalPrice, err := checkout(tt.userID, tt.code)
+		if !errors.Is(err, tt.err) || err == nil && finalPrice != tt.price {
+			t.Fatalf("%s: expected %s, %v, got %s, %v", tt.name, tt.price, tt.err, finalPrice, err)
+		}
+		if tt.after != nil {
+			tt.after()
+		}
+	}
+}
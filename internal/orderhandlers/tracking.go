@@ -0,0 +1,144 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/gorilla/mux"
+)
+
+// deliveryOrderStatuses maps the delivery statuses of the carrier to the order statuses they move the order to,
+// the other delivery statuses leave the order as it is.
+var deliveryOrderStatuses = map[string]string{
+	"DELIVERED": orderstatus.Completed,
+}
+
+// applyDeliveryStatus moves the order to the status matching the delivery status of its shipment.
+// An order still waiting for the carrier to accept the shipment is moved to IN_DELIVERY first.
+func (h *Handler) applyDeliveryStatus(ctx context.Context, orderID uint, code string) error {
+
+	status, err := h.Orders.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if status == orderstatus.ReadyForDelivery && code != "" {
+		err = h.confirmShipment(ctx, orderID)
+		if err != nil {
+			return err
+		}
+		status, err = h.Orders.LoadOrderStatus(ctx, orderID)
+		if err != nil {
+			return err
+		}
+	}
+	toStatus, ok := deliveryOrderStatuses[code]
+	if !ok || status == toStatus || !orderstatus.CanTransition(status, toStatus) {
+		return nil
+	}
+	change := models.OrderStatusChange{ToStatus: toStatus, Actor: orderstatus.ActorSystem, Reason: "delivery status " + code}
+	return h.lifecycle().Transition(ctx, orderID, change)
+}
+
+// DeliveryWebhook receives the delivery status events the carrier posts for the shipments, see delivery.WebhookURL.
+// The events may come more than once and out of order, only the latest delivery status moves the order.
+func (h *Handler) DeliveryWebhook(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]string)
+	var event delivery.WebhookEvent
+	defer r.Body.Close()
+
+	if !delivery.VerifyWebhookToken(mux.Vars(r)["token"], config.DeliveryWebhookSecret) {
+		log.Printf("Delivery webhook with invalid token")
+		handlersfunc.HandlePermissionError(rw)
+		return
+	}
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	if event.Type == delivery.WebhookOrderStatus {
+		orderID, code, err := delivery.RecordStatusEvent(ctx, h.Delivery, event)
+		if err != nil {
+			// the carrier posts the event again on errors
+			handlersfunc.HandleDatabaseServerError(rw)
+			return
+		}
+		if orderID != 0 {
+			err = h.applyDeliveryStatus(ctx, orderID, code)
+			if err != nil {
+				log.Printf("Error happened when applying delivery status for the order %d. Err: %s", orderID, err)
+				handlersfunc.HandleDatabaseServerError(rw)
+				return
+			}
+		}
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = "1"
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// reconcileDelivery polls the carrier for the shipment of the order in case its status events were lost.
+func (h *Handler) reconcileDelivery(ctx context.Context, orderID uint) error {
+
+	code, err := delivery.CheckDeliveryStatus(h.Carrier, h.Delivery, orderID)
+	if err != nil {
+		return err
+	}
+	return h.applyDeliveryStatus(ctx, orderID, code)
+}
+
+// ReconcileDeliveries is the fallback of DeliveryWebhook, it polls the orders in delivery every config.DeliveryReconcileInterval.
+func (h *Handler) ReconcileDeliveries(ctx context.Context) {
+
+	ticker := time.NewTicker(config.DeliveryReconcileInterval)
+	var err error
+	var orderList []uint
+
+	jobCh := make(chan uint)
+	for i := 0; i < config.WorkersCount; i++ {
+		go func() {
+			for job := range jobCh {
+
+				jobCtx, cancel := context.WithTimeout(ctx, config.ContextDBTimeout)
+				err := h.reconcileDelivery(jobCtx, job)
+				cancel()
+				if err != nil {
+					log.Printf("Error happened when reconciling delivery for the order %d. Err: %s", job, err)
+					continue
+				}
+			}
+		}()
+	}
+
+	for range ticker.C {
+
+		orderList, err = h.Delivery.LoadActiveDeliveries(ctx)
+		if err != nil {
+			log.Printf("Error happened when retrieving orders in delivery. Err: %s", err)
+			continue
+		}
+
+		for _, order := range orderList {
+			jobCh <- order
+		}
+
+	}
+}
@@ -0,0 +1,57 @@
+package orderhandlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/delivery"
+	"github.com/gorilla/mux"
+)
+
+func TestDeliveryWebhook(t *testing.T) {
+
+	secret := config.DeliveryWebhookSecret
+	config.DeliveryWebhookSecret = "hook"
+	t.Cleanup(func() { config.DeliveryWebhookSecret = secret })
+	h := newTestHandler(t)
+	ctx := context.Background()
+	orderID := h.placeOrder(t, h.userID)
+	h.advance(t, orderID, "PAID", "IN_PRINT", "READY_FOR_DELIVERY", "IN_DELIVERY")
+	h.Delivery.AddDeliveryID(ctx, orderID, "shipment-uuid")
+
+	tests := []struct {
+		name   string
+		token  string
+		code   int
+		status string
+	}{
+		{"wrong token", "wrong", http.StatusForbidden, "IN_DELIVERY"},
+		{"delivered", "hook", http.StatusOK, "COMPLETED"},
+		{"repeated event", "hook", http.StatusOK, "COMPLETED"},
+	}
+	for _, tt := range tests {
+		body := `{"type":"ORDER_STATUS","uuid":"shipment-uuid","attributes":{"cdek_number":"1106207236","code":"DELIVERED","status_date_time":"2026-10-18T12:00:00+0300","city_name":"Новосибирск"}}`
+		r := httptest.NewRequest(http.MethodPost, delivery.WebhookPath+tt.token, strings.NewReader(body))
+		r = mux.SetURLVars(r, map[string]string{"token": tt.token})
+		rw := httptest.NewRecorder()
+		h.DeliveryWebhook(rw, r)
+		if rw.Code != tt.code {
+			t.Fatalf("%s: expected the event to be answered with %d, got %d", tt.name, tt.code, rw.Code)
+		}
+		if status, _ := h.Orders.LoadOrderStatus(ctx, orderID); status != tt.status {
+			t.Fatalf("%s: expected the order to be %s, got %s", tt.name, tt.status, status)
+		}
+	}
+	if _, _, dstatus, trackingNumber, _ := h.Delivery.FindDeliveryUUID(ctx, orderID); dstatus != "DELIVERED" || trackingNumber != "1106207236" {
+		t.Errorf("expected the delivery status and the tracking number of the event to be stored, got %s %s", dstatus, trackingNumber)
+	}
+	history, _ := h.Orders.LoadOrderStatusHistory(ctx, orderID)
+	last := history.History[len(history.History)-1]
+	if last.ToStatus != "COMPLETED" || last.Actor != "SYSTEM" || history.History[len(history.History)-2].ToStatus != "IN_DELIVERY" {
+		t.Errorf("expected the repeated event to complete the order once, got %v", history.History)
+	}
+}
@@ -0,0 +1,221 @@
+package orderhandlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+)
+
+// LoadWarehouses lists the warehouses the orders are shipped from, the deactivated ones included.
+func (h *Handler) LoadWarehouses(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponseWarehouses)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	warehouses, err := h.Delivery.LoadWarehouses(ctx)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = models.ResponseWarehouses{Warehouses: warehouses}
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// CreateWarehouse adds a warehouse of a print partner, orders are shipped from it right away.
+func (h *Handler) CreateWarehouse(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	var WarehouseObj models.Warehouse
+
+	err := json.NewDecoder(r.Body).Decode(&WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	warehouseID, err := h.Delivery.CreateWarehouse(ctx, WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = warehouseID
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// UpdateWarehouse replaces the details of the warehouse, is_active brings a deactivated warehouse back.
+func (h *Handler) UpdateWarehouse(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	var WarehouseObj models.Warehouse
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	warehouseID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	if !h.warehouseExists(ctx, warehouseID) {
+		handlersfunc.HandleMissingWarehouseError(rw)
+		return
+	}
+	err = h.Delivery.UpdateWarehouse(ctx, warehouseID, WarehouseObj)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = 1
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// DeleteWarehouse deactivates the warehouse, new orders are no longer shipped from it.
+func (h *Handler) DeleteWarehouse(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	warehouseID := uint(aByteToInt)
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	if !h.Delivery.CheckWarehouse(ctx, warehouseID) {
+		handlersfunc.HandleMissingWarehouseError(rw)
+		return
+	}
+	err := h.Delivery.DeleteWarehouse(ctx, warehouseID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = 1
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// AssignOrderWarehouse changes the warehouse the order is shipped from, e.g. when another print partner prints it.
+// The shipment must not be registered with the carrier yet.
+func (h *Handler) AssignOrderWarehouse(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]uint)
+	var AssignObj models.RequestOrderWarehouse
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	orderID := uint(aByteToInt)
+
+	err := json.NewDecoder(r.Body).Decode(&AssignObj)
+	if err != nil {
+		handlersfunc.HandleDecodeError(rw, err)
+		return
+	}
+	defer r.Body.Close()
+	validate := validator.New()
+	err = validate.Struct(AssignObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+	if !h.Orders.CheckOrder(ctx, orderID) {
+		handlersfunc.HandleMissingProjectError(rw)
+		return
+	}
+	if !h.Delivery.CheckWarehouse(ctx, AssignObj.WarehouseID) {
+		handlersfunc.HandleMissingWarehouseError(rw)
+		return
+	}
+	_, uuid, _, _, err := h.Delivery.FindDeliveryUUID(ctx, orderID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+	if uuid != "" {
+		handlersfunc.HandleIllegalStatusTransitionError(rw)
+		return
+	}
+	err = h.Delivery.AssignWarehouse(ctx, orderID, AssignObj.WarehouseID)
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = 1
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// warehouseExists reports whether the warehouse is stored, active or not.
+func (h *Handler) warehouseExists(ctx context.Context, warehouseID uint) bool {
+
+	warehouses, err := h.Delivery.LoadWarehouses(ctx)
+	if err != nil {
+		return false
+	}
+	for _, w := range warehouses {
+		if w.WarehouseID == warehouseID {
+			return true
+		}
+	}
+	return false
+}
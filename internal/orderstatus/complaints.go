@@ -0,0 +1,35 @@
+package orderstatus
+
+// Complaint statuses. A complaint is open until the admins resolve it, and resolving while its resolution is carried out.
+const (
+	ComplaintOpen      = "OPEN"
+	ComplaintResolving = "RESOLVING"
+	ComplaintReprinted = "REPRINTED"
+	ComplaintRefunded  = "REFUNDED"
+	ComplaintRejected  = "REJECTED"
+)
+
+// Resolutions of a complaint.
+const (
+	ResolutionReprint = "REPRINT"
+	ResolutionRefund  = "REFUND"
+	ResolutionReject  = "REJECT"
+)
+
+// complaintStatuses are the statuses the complaints are closed with by each resolution.
+var complaintStatuses = map[string]string{
+	ResolutionReprint: ComplaintReprinted,
+	ResolutionRefund:  ComplaintRefunded,
+	ResolutionReject:  ComplaintRejected,
+}
+
+// ComplaintStatus returns the status of a complaint closed with the resolution.
+func ComplaintStatus(resolution string) string {
+	return complaintStatuses[resolution]
+}
+
+// CanComplain reports whether the customer may open a complaint about an order in the status:
+// only the delivered books can be complained about.
+func CanComplain(status string) bool {
+	return status == Completed
+}
@@ -0,0 +1,136 @@
+// Orderstatus package contains the order lifecycle: the statuses an order goes through,
+// the transitions allowed between them and the hooks run on each transition.
+//
+// Available at https://github.com/SiberianMonster/memoryprint/tree/development/internal/orderstatus
+package orderstatus
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// Order statuses.
+const (
+	AwaitingPayment   = "AWAITING_PAYMENT"
+	PaymentInProgress = "PAYMENT_IN_PROGRESS"
+	Paid              = "PAID"
+	InPrint           = "IN_PRINT"
+	ReadyForDelivery  = "READY_FOR_DELIVERY"
+	InDelivery        = "IN_DELIVERY"
+	Completed         = "COMPLETED"
+	Cancelled         = "CANCELLED"
+	Refunded          = "REFUNDED"
+)
+
+// Actors recorded in the status history.
+const (
+	ActorAdmin    = "ADMIN"
+	ActorCustomer = "CUSTOMER"
+	ActorSystem   = "SYSTEM"
+)
+
+// transitions lists the statuses an order may move to from each status.
+// An order can be cancelled until its payment is captured, after that only refunded.
+var transitions = map[string][]string{
+	AwaitingPayment:   {PaymentInProgress},
+	PaymentInProgress: {Paid, Cancelled},
+	Paid:              {InPrint, Cancelled},
+	InPrint:           {ReadyForDelivery, Refunded},
+	ReadyForDelivery:  {InDelivery, Refunded},
+	InDelivery:        {Completed, ReadyForDelivery, Refunded},
+	Completed:         {Refunded},
+	Cancelled:         {},
+	Refunded:          {},
+}
+
+// ErrIllegalTransition is returned when the order can not move from its status to the requested one.
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// ErrStatusChanged is returned when the order has left the status the transition started from meanwhile.
+var ErrStatusChanged = errors.New("order status changed meanwhile")
+
+// CanTransition reports whether an order may move from one status to the other.
+func CanTransition(from string, to string) bool {
+
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Store is the part of the order storage the machine works on.
+type Store interface {
+	LoadOrderStatus(ctx context.Context, orderID uint) (string, error)
+	UpdateOrderStatus(ctx context.Context, orderID uint, change models.OrderStatusChange) error
+}
+
+// Hook runs when an order enters a status.
+type Hook func(ctx context.Context, orderID uint, change models.OrderStatusChange) error
+
+// Machine moves orders along the allowed transitions, recording every change in the status history.
+// Before hooks run ahead of the change and abort it on error, e.g. the payment capture before print.
+// After hooks run once the change is stored, e.g. the customer mails.
+type Machine struct {
+	store  Store
+	before map[string][]Hook
+	after  map[string][]Hook
+}
+
+// NewMachine returns a Machine without hooks working on store.
+func NewMachine(store Store) *Machine {
+	return &Machine{store: store, before: make(map[string][]Hook), after: make(map[string][]Hook)}
+}
+
+// Before registers a hook run before an order enters status.
+func (m *Machine) Before(status string, hook Hook) {
+	m.before[status] = append(m.before[status], hook)
+}
+
+// After registers a hook run after an order has entered status.
+func (m *Machine) After(status string, hook Hook) {
+	m.after[status] = append(m.after[status], hook)
+}
+
+// Transition moves the order to change.ToStatus. All after hooks run even if one fails,
+// the first error is returned with the change already stored.
+func (m *Machine) Transition(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+
+	from, err := m.store.LoadOrderStatus(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if !CanTransition(from, change.ToStatus) {
+		log.Printf("Order %d can not move from %s to %s", orderID, from, change.ToStatus)
+		return ErrIllegalTransition
+	}
+	change.OrdersID = orderID
+	change.FromStatus = from
+
+	for _, hook := range m.before[change.ToStatus] {
+		err = hook(ctx, orderID, change)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.store.UpdateOrderStatus(ctx, orderID, change)
+	if err != nil {
+		return err
+	}
+
+	var hookErr error
+	for _, hook := range m.after[change.ToStatus] {
+		err = hook(ctx, orderID, change)
+		if err != nil {
+			log.Printf("Error happened when running %s hook for the order %d. Err: %s", change.ToStatus, orderID, err)
+			if hookErr == nil {
+				hookErr = err
+			}
+		}
+	}
+	return hookErr
+}
@@ -0,0 +1,37 @@
+package orderstatus
+
+import (
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+func TestTimeline(t *testing.T) {
+
+	// the storage gathers the events source by source
+	events := []models.TimelineEvent{
+		{Category: CategoryStatus, Code: PaymentInProgress, HappenedAt: 100},
+		{Category: StatusCategory(InPrint), Code: InPrint, HappenedAt: 300},
+		{Category: CategoryPayment, Code: PaymentRegistered, HappenedAt: 100},
+		{Category: CategoryPayment, Code: PaymentCaptured, HappenedAt: 290},
+		{Category: CategoryDelivery, Code: "DELIVERED", Description: "Вручен", City: "Новосибирск", HappenedAt: 900},
+		{Category: CategoryDelivery, Code: "ACCEPTED", Description: "Принят", City: "Москва", HappenedAt: 500},
+	}
+	timeline := Timeline(events)
+
+	codes := []string{PaymentInProgress, PaymentRegistered, PaymentCaptured, InPrint, "ACCEPTED", "DELIVERED"}
+	for i, code := range codes {
+		if timeline[i].Code != code {
+			t.Fatalf("expected %s at position %d, got %v", code, i, timeline)
+		}
+	}
+	if timeline[3].Category != CategoryProduction || timeline[3].Description != descriptions[InPrint] {
+		t.Errorf("expected print to be a described production milestone, got %v", timeline[3])
+	}
+	if timeline[5].Description != "Вручен" {
+		t.Errorf("expected the CDEK description to be kept, got %s", timeline[5].Description)
+	}
+	if CanTransition(Completed, AwaitingPayment) || !CanTransition(Paid, InPrint) {
+		t.Errorf("expected only the lifecycle transitions to be allowed")
+	}
+}
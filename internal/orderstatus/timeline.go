@@ -0,0 +1,110 @@
+package orderstatus
+
+import (
+	"sort"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+// Categories of the order timeline events.
+const (
+	CategoryStatus     = "STATUS"
+	CategoryPayment    = "PAYMENT"
+	CategoryProduction = "PRODUCTION"
+	CategoryDelivery   = "DELIVERY"
+	CategoryComplaint  = "COMPLAINT"
+)
+
+// Codes of the payment events of the order timeline.
+const (
+	PaymentRegistered = "PAYMENT_REGISTERED"
+	PaymentCaptured   = "PAYMENT_CAPTURED"
+	RefundCompleted   = "REFUND_COMPLETED"
+)
+
+// Codes of the complaint events of the order timeline.
+const (
+	ComplaintOpened   = "COMPLAINT_OPENED"
+	ComplaintReprint  = "COMPLAINT_REPRINTED"
+	ComplaintRefund   = "COMPLAINT_REFUNDED"
+	ComplaintDeclined = "COMPLAINT_REJECTED"
+	ReturnRequested   = "RETURN_REQUESTED"
+	ReprintCreated    = "REPRINT_CREATED"
+)
+
+// complaintCodes are the timeline codes of the complaints closed with each status.
+var complaintCodes = map[string]string{
+	ComplaintReprinted: ComplaintReprint,
+	ComplaintRefunded:  ComplaintRefund,
+	ComplaintRejected:  ComplaintDeclined,
+}
+
+// ComplaintResolved returns the timeline code of a complaint closed with the status.
+func ComplaintResolved(status string) string {
+	return complaintCodes[status]
+}
+
+// descriptions are shown to the customer for the events the service itself produces,
+// the delivery events come with the description of CDEK.
+var descriptions = map[string]string{
+	PaymentInProgress: "Заказ оформлен",
+	Paid:              "Заказ оплачен",
+	InPrint:           "Фотокнига передана в печать",
+	ReadyForDelivery:  "Фотокнига напечатана и упакована",
+	InDelivery:        "Заказ передан в службу доставки",
+	Completed:         "Заказ получен",
+	Cancelled:         "Заказ отменён",
+	Refunded:          "Деньги за заказ возвращены",
+	PaymentRegistered: "Создан платёж",
+	PaymentCaptured:   "Оплата списана с карты",
+	RefundCompleted:   "Выполнен возврат средств",
+	ComplaintOpened:   "Открыта претензия по заказу",
+	ComplaintReprint:  "По претензии заказана повторная печать",
+	ComplaintRefund:   "По претензии возвращены деньги",
+	ComplaintDeclined: "Претензия отклонена",
+	ReturnRequested:   "Оформлен возврат фотокниги",
+	ReprintCreated:    "Повторная печать по претензии к заказу",
+}
+
+// StatusCategory returns the timeline category of entering status: printing and packing are production milestones.
+func StatusCategory(status string) string {
+
+	if status == InPrint || status == ReadyForDelivery {
+		return CategoryProduction
+	}
+	return CategoryStatus
+}
+
+// ComplaintEvents returns the timeline events of the complaint: its opening, its resolution linked to the reprint
+// and the return shipment of the book.
+func ComplaintEvents(complaint models.Complaint) []models.TimelineEvent {
+
+	events := []models.TimelineEvent{{Category: CategoryComplaint, Code: ComplaintOpened, HappenedAt: complaint.CreatedAt}}
+	if complaint.ResolvedAt == nil {
+		return events
+	}
+	resolved := models.TimelineEvent{Category: CategoryComplaint, Code: ComplaintResolved(complaint.Status), HappenedAt: *complaint.ResolvedAt}
+	if complaint.ReprintOrderID != nil {
+		resolved.LinkedOrderID = *complaint.ReprintOrderID
+	}
+	events = append(events, resolved)
+	if complaint.ReturnDeliveryID != "" {
+		events = append(events, models.TimelineEvent{Category: CategoryComplaint, Code: ReturnRequested, HappenedAt: *complaint.ResolvedAt})
+	}
+	return events
+}
+
+// Timeline orders the events of an order chronologically and describes the ones produced by the service.
+// Events of the same second keep the order they were gathered in.
+func Timeline(events []models.TimelineEvent) []models.TimelineEvent {
+
+	timeline := make([]models.TimelineEvent, 0, len(events))
+	for _, event := range events {
+		if event.Description == "" {
+			event.Description = descriptions[event.Code]
+		}
+		timeline = append(timeline, event)
+	}
+	sort.SliceStable(timeline, func(i, j int) bool { return timeline[i].HappenedAt < timeline[j].HappenedAt })
+	return timeline
+}
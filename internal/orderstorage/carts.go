@@ -0,0 +1,124 @@
+package orderstorage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotInCart is returned when the project to change or to order is not in the cart of the user.
+var ErrNotInCart = errors.New("project is not in the cart")
+
+// AddCartItem function performs the operation of publishing the project and adding its copies to the cart of the user
+// in pgx database with queries. The copies are added to the ones in the cart already. It returns the id of the cart.
+func AddCartItem(ctx context.Context, storeDB *pgxpool.Pool, userID uint, item models.CartItem) (uint, error) {
+
+	var cartID uint
+	t := time.Now()
+	_, err := storeDB.Exec(ctx, "UPDATE projects SET status = ($1) WHERE projects_id = ($2);",
+		"PUBLISHED",
+		item.ProjectID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating project to published into pgx table. Err: %s", err)
+		return cartID, err
+	}
+	err = storeDB.QueryRow(ctx, "INSERT INTO carts (users_id, created_at, last_updated_at) VALUES ($1, $2, $2) ON CONFLICT (users_id) DO UPDATE SET last_updated_at = EXCLUDED.last_updated_at RETURNING carts_id;",
+		userID,
+		t,
+	).Scan(&cartID)
+	if err != nil {
+		log.Printf("Error happened when creating cart entry into pgx table. Err: %s", err)
+		return cartID, err
+	}
+	_, err = storeDB.Exec(ctx, "INSERT INTO cart_items (carts_id, projects_id, quantity, created_at) VALUES ($1, $2, $3, $4) ON CONFLICT (carts_id, projects_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity;",
+		cartID,
+		item.ProjectID,
+		item.Quantity,
+		t,
+	)
+	if err != nil {
+		log.Printf("Error happened when adding project to cart into pgx table. Err: %s", err)
+		return cartID, err
+	}
+	return cartID, nil
+
+}
+
+// UpdateCartItem function performs the operation of setting the number of copies of the project in the cart of the user
+// in pgx database with a query. It returns ErrNotInCart when the project is not in the cart.
+func UpdateCartItem(ctx context.Context, storeDB *pgxpool.Pool, userID uint, item models.CartItem) error {
+
+	tag, err := storeDB.Exec(ctx, "UPDATE cart_items SET quantity = ($1) WHERE projects_id = ($2) AND carts_id = (SELECT carts_id FROM carts WHERE users_id = ($3));",
+		item.Quantity,
+		item.ProjectID,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating cart item into pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotInCart
+	}
+	return nil
+
+}
+
+// DeleteCartItem function performs the operation of removing the project from the cart of the user and unpublishing it
+// in pgx database with queries. It returns ErrNotInCart when the project is not in the cart.
+func DeleteCartItem(ctx context.Context, storeDB *pgxpool.Pool, userID uint, projectID uint) error {
+
+	tag, err := storeDB.Exec(ctx, "DELETE FROM cart_items WHERE projects_id = ($1) AND carts_id = (SELECT carts_id FROM carts WHERE users_id = ($2));",
+		projectID,
+		userID,
+	)
+	if err != nil {
+		log.Printf("Error happened when deleting cart item from pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotInCart
+	}
+	_, err = storeDB.Exec(ctx, "UPDATE projects SET status = ($1) WHERE projects_id = ($2);",
+		"EDITED",
+		projectID,
+	)
+	if err != nil {
+		log.Printf("Error happened when unpublishing project into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// restoreCart function performs the operation of putting the projects of the order which was not paid for back to the cart
+// of the user in pgx database with queries. The projects the customer has put in the cart again are left as they are.
+func restoreCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint, orderID uint) error {
+
+	var cartID uint
+	t := time.Now()
+	err := storeDB.QueryRow(ctx, "INSERT INTO carts (users_id, created_at, last_updated_at) VALUES ($1, $2, $2) ON CONFLICT (users_id) DO UPDATE SET last_updated_at = EXCLUDED.last_updated_at RETURNING carts_id;",
+		userID,
+		t,
+	).Scan(&cartID)
+	if err != nil {
+		log.Printf("Error happened when creating cart entry into pgx table. Err: %s", err)
+		return err
+	}
+	_, err = storeDB.Exec(ctx, "INSERT INTO cart_items (carts_id, projects_id, quantity, created_at) SELECT ($1), projects_id, quantity, ($3) FROM orders_has_projects WHERE orders_id = ($2) ON CONFLICT (carts_id, projects_id) DO NOTHING;",
+		cartID,
+		orderID,
+		t,
+	)
+	if err != nil {
+		log.Printf("Error happened when rolling back projects to cart into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
@@ -0,0 +1,41 @@
+package orderstorage
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrCheckoutRepeated is returned with the order placed by the earlier checkout of the same idempotency key.
+var ErrCheckoutRepeated = errors.New("checkout is repeated")
+
+// ErrCertificateUnavailable is returned when the gift certificate has been spent or reserved by another order meanwhile.
+var ErrCertificateUnavailable = errors.New("gift certificate is not available")
+
+// ErrPromocodeUnavailable is returned when the promocode has been redeemed by other orders meanwhile as many times as its promotion allows.
+var ErrPromocodeUnavailable = errors.New("promocode is not available")
+
+// FindCheckout function performs the operation of retrieving the order placed by the checkout of the user with the idempotency key,
+// and the payment link registered for it, from pgx database with a query. The order id is zero when there is no such checkout,
+// the link is empty when the payment has not been registered.
+func FindCheckout(ctx context.Context, storeDB *pgxpool.Pool, userID uint, idempotencyKey string) (uint, string, error) {
+
+	var orderID uint
+	var paymentLink string
+	err := storeDB.QueryRow(ctx, "SELECT o.orders_id, COALESCE((SELECT t.payment_link FROM orders_has_transactions ot JOIN transactions t ON t.transactions_id = ot.transactions_id WHERE ot.orders_id = o.orders_id ORDER BY t.transactions_id DESC LIMIT 1), '') FROM orders o WHERE o.users_id = ($1) AND o.idempotency_key = ($2);",
+		userID,
+		idempotencyKey,
+	).Scan(&orderID, &paymentLink)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, paymentLink, nil
+	}
+	if err != nil {
+		log.Printf("Error happened when retrieving checkout from pgx table. Err: %s", err)
+		return orderID, paymentLink, err
+	}
+	return orderID, paymentLink, nil
+
+}
@@ -0,0 +1,239 @@
+package orderstorage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const complaintColumns = "complaints_id, orders_id, users_id, reason, description, COALESCE(photos, '{}'), status, COALESCE(resolution_comment, ''), reprint_orders_id, refunds_id, COALESCE(return_deliveryid, ''), created_at, resolved_at"
+
+// scanComplaint reads a row of complaintColumns.
+func scanComplaint(row pgx.Row) (models.Complaint, error) {
+
+	var complaint models.Complaint
+	var createdAtStorage time.Time
+	var resolvedAtStorage *time.Time
+	err := row.Scan(&complaint.ComplaintsID, &complaint.OrdersID, &complaint.UsersID, &complaint.Reason, &complaint.Description, &complaint.Photos, &complaint.Status, &complaint.Comment, &complaint.ReprintOrderID, &complaint.RefundsID, &complaint.ReturnDeliveryID, &createdAtStorage, &resolvedAtStorage)
+	if err != nil {
+		return complaint, err
+	}
+	complaint.CreatedAt = createdAtStorage.Unix()
+	if resolvedAtStorage != nil {
+		resolvedAt := resolvedAtStorage.Unix()
+		complaint.ResolvedAt = &resolvedAt
+	}
+	return complaint, nil
+}
+
+// CreateComplaint function performs the operation of opening a complaint of the customer about the order in pgx database with a query.
+func CreateComplaint(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, userID uint, complaintObj models.RequestComplaint) (uint, error) {
+
+	var complaintID uint
+	photos := complaintObj.Photos
+	if photos == nil {
+		photos = []string{}
+	}
+	err := storeDB.QueryRow(ctx, "INSERT INTO complaints (orders_id, users_id, reason, description, photos, status, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING complaints_id;",
+		orderID,
+		userID,
+		complaintObj.Reason,
+		complaintObj.Description,
+		photos,
+		orderstatus.ComplaintOpen,
+		time.Now(),
+	).Scan(&complaintID)
+	if err != nil {
+		log.Printf("Error happened when creating complaint entry into pgx table. Err: %s", err)
+		return complaintID, err
+	}
+	return complaintID, nil
+
+}
+
+// LoadComplaint function performs the operation of retrieving a complaint from pgx database with a query.
+func LoadComplaint(ctx context.Context, storeDB *pgxpool.Pool, complaintID uint) (models.Complaint, error) {
+
+	complaint, err := scanComplaint(storeDB.QueryRow(ctx, "SELECT "+complaintColumns+" FROM complaints WHERE complaints_id = ($1);", complaintID))
+	if err != nil {
+		log.Printf("Error happened when retrieving complaint from pgx table. Err: %s", err)
+		return complaint, err
+	}
+	return complaint, nil
+
+}
+
+// LoadComplaints function performs the operation of retrieving the complaints from pgx database with a query.
+// A zero orderID lists the complaints about all the orders, an empty status the complaints in any status.
+func LoadComplaints(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, status string) (models.ResponseComplaints, error) {
+
+	complaintset := models.ResponseComplaints{Complaints: []models.Complaint{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT "+complaintColumns+" FROM complaints WHERE (($1) = 0 OR orders_id = ($1)) AND (($2) = '' OR status = ($2)) ORDER BY complaints_id;", orderID, status)
+	if err != nil {
+		log.Printf("Error happened when retrieving complaints from pgx table. Err: %s", err)
+		return complaintset, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		complaint, err := scanComplaint(rows)
+		if err != nil {
+			log.Printf("Error happened when scanning complaints. Err: %s", err)
+			return complaintset, err
+		}
+		complaintset.Complaints = append(complaintset.Complaints, complaint)
+	}
+	return complaintset, nil
+
+}
+
+// UpdateComplaintStatus function performs the operation of moving the complaint from one status to the other in pgx database with a query.
+// It returns orderstatus.ErrStatusChanged when the complaint has left the status meanwhile, so only one admin claims an open complaint.
+func UpdateComplaintStatus(ctx context.Context, storeDB *pgxpool.Pool, complaintID uint, fromStatus string, toStatus string) error {
+
+	tag, err := storeDB.Exec(ctx, "UPDATE complaints SET status = ($1) WHERE complaints_id = ($2) AND status = ($3);",
+		toStatus,
+		complaintID,
+		fromStatus,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating complaint status into pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orderstatus.ErrStatusChanged
+	}
+	return nil
+
+}
+
+// ResolveComplaint function performs the operation of closing a complaint being resolved with its status, comment, reprint, refund
+// and return shipment in pgx database with a query. It returns orderstatus.ErrStatusChanged when the complaint is not being resolved.
+func ResolveComplaint(ctx context.Context, storeDB *pgxpool.Pool, complaint models.Complaint) error {
+
+	tag, err := storeDB.Exec(ctx, "UPDATE complaints SET status = ($1), resolution_comment = ($2), reprint_orders_id = ($3), refunds_id = ($4), return_deliveryid = NULLIF($5, ''), resolved_at = ($6) WHERE complaints_id = ($7) AND status = ($8);",
+		complaint.Status,
+		complaint.Comment,
+		complaint.ReprintOrderID,
+		complaint.RefundsID,
+		complaint.ReturnDeliveryID,
+		time.Now(),
+		complaint.ComplaintsID,
+		orderstatus.ComplaintResolving,
+	)
+	if err != nil {
+		log.Printf("Error happened when resolving complaint into pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return orderstatus.ErrStatusChanged
+	}
+	return nil
+
+}
+
+// CreateReprintOrder function performs the operation of copying the order into a new one sent straight to print at no charge
+// in pgx database with queries. The reprint is delivered to the same address from the same warehouse, the projects are shared
+// with the original order and its line items are copied at zero amount. change is recorded as the first status change of the reprint.
+func CreateReprintOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, change models.OrderStatusChange) (uint, error) {
+
+	var reprintID uint
+	t := time.Now()
+	tx, err := storeDB.Begin(ctx)
+	if err != nil {
+		log.Printf("Error happened when starting reprint transaction. Err: %s", err)
+		return reprintID, err
+	}
+	defer tx.Rollback(ctx)
+
+	var deliveryID uint
+	err = tx.QueryRow(ctx, "INSERT INTO delivery (status, created_at, method, address, amount, postal_code, code, warehouses_id) SELECT ($2), ($3), d.method, d.address, 0, d.postal_code, d.code, d.warehouses_id FROM delivery d JOIN orders o ON o.delivery_id = d.delivery_id WHERE o.orders_id = ($1) RETURNING delivery_id;",
+		orderID,
+		"DRAFT",
+		t,
+	).Scan(&deliveryID)
+	if err != nil {
+		log.Printf("Error happened when copying delivery entry into pgx table. Err: %s", err)
+		return reprintID, err
+	}
+	err = tx.QueryRow(ctx, "INSERT INTO orders (status, created_at, last_updated_at, users_id, firstname, lastname, email, phone, baseprice, finalprice, package_box, delivery_id, original_orders_id) SELECT ($2), ($3), ($3), users_id, firstname, lastname, email, phone, 0, 0, package_box, ($4), orders_id FROM orders WHERE orders_id = ($1) RETURNING orders_id;",
+		orderID,
+		change.ToStatus,
+		t,
+		deliveryID,
+	).Scan(&reprintID)
+	if err != nil {
+		log.Printf("Error happened when copying order entry into pgx table. Err: %s", err)
+		return reprintID, err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id, quantity) SELECT ($2), projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1);", orderID, reprintID)
+	if err != nil {
+		log.Printf("Error happened when copying orders_has_projects into pgx table. Err: %s", err)
+		return reprintID, err
+	}
+	// the books are listed at no charge, the orders placed before the line items were stored get a line per book
+	tag, err := tx.Exec(ctx, "INSERT INTO order_items (orders_id, code, projects_id, size, variant, cover, surface, count_pages, quantity, unit_price, amount, discount) SELECT ($2), code, projects_id, size, variant, cover, surface, count_pages, quantity, 0, 0, 0 FROM order_items WHERE orders_id = ($1) ORDER BY order_items_id;", orderID, reprintID)
+	if err == nil && tag.RowsAffected() == 0 {
+		_, err = tx.Exec(ctx, "INSERT INTO order_items (orders_id, code, projects_id, size, variant, cover, surface, count_pages, quantity, unit_price, amount, discount) SELECT ($2), ($3), p.projects_id, p.size, p.variant, p.cover, p.paper, p.count_pages, op.quantity, 0, 0, 0 FROM orders_has_projects op JOIN projects p ON p.projects_id = op.projects_id WHERE op.orders_id = ($1);", orderID, reprintID, pricing.LineBase)
+	}
+	if err != nil {
+		log.Printf("Error happened when copying order items into pgx table. Err: %s", err)
+		return reprintID, err
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO order_status_history (orders_id, from_status, to_status, actor, users_id, reason, created_at) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, 0), $6, $7);",
+		reprintID,
+		change.FromStatus,
+		change.ToStatus,
+		change.Actor,
+		change.UsersID,
+		change.Reason,
+		t,
+	)
+	if err != nil {
+		log.Printf("Error happened when inserting order status history into pgx table. Err: %s", err)
+		return reprintID, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Printf("Error happened when committing reprint transaction. Err: %s", err)
+		return reprintID, err
+	}
+	return reprintID, nil
+
+}
+
+// loadComplaintEvents function performs the operation of gathering the complaint events of the order, and the link to the original
+// order of a reprint, from pgx database with queries.
+func loadComplaintEvents(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) ([]models.TimelineEvent, error) {
+
+	var events []models.TimelineEvent
+
+	var originalID *uint
+	var createdAtStorage time.Time
+	err := storeDB.QueryRow(ctx, "SELECT original_orders_id, created_at FROM orders WHERE orders_id = ($1);", orderID).Scan(&originalID, &createdAtStorage)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving original order from pgx table. Err: %s", err)
+		return events, err
+	}
+	if originalID != nil {
+		events = append(events, models.TimelineEvent{Category: orderstatus.CategoryComplaint, Code: orderstatus.ReprintCreated, LinkedOrderID: *originalID, HappenedAt: createdAtStorage.Unix()})
+	}
+
+	complaintset, err := LoadComplaints(ctx, storeDB, orderID, "")
+	if err != nil {
+		return events, err
+	}
+	for _, complaint := range complaintset.Complaints {
+		events = append(events, orderstatus.ComplaintEvents(complaint)...)
+	}
+	return events, nil
+
+}
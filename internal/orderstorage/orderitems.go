@@ -0,0 +1,84 @@
+package orderstorage
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SaveOrderItems function performs the operation of storing the lines of the price of the order at the checkout, with the options
+// of the books they are for, in the checkout transaction with queries. The items are not changed afterwards.
+func SaveOrderItems(ctx context.Context, tx pgx.Tx, orderID uint, breakdown models.PriceBreakdown) error {
+
+	for _, line := range breakdown.Lines {
+		_, err := tx.Exec(ctx, "INSERT INTO order_items (orders_id, code, projects_id, size, variant, cover, surface, count_pages, quantity, unit_price, amount, discount) SELECT ($1), ($2), NULLIF($3, 0), p.size, p.variant, p.cover, p.paper, p.count_pages, ($4), ($5), ($6), ($7) FROM (SELECT 1) AS line LEFT JOIN projects p ON p.projects_id = ($3);",
+			orderID,
+			line.Code,
+			line.ProjectID,
+			line.Quantity,
+			line.UnitPrice,
+			line.Amount,
+			line.Discount,
+		)
+		if err != nil {
+			log.Printf("Error happened when inserting order items into pgx table. Err: %s", err)
+			return err
+		}
+	}
+	return nil
+
+}
+
+// LoadOrderItems function performs the operation of retrieving the lines of the price of the order at the checkout from pgx database with a query.
+func LoadOrderItems(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) ([]models.OrderItem, error) {
+
+	var items []models.OrderItem
+	rows, err := storeDB.Query(ctx, "SELECT code, COALESCE(projects_id, 0), COALESCE(size, ''), COALESCE(variant, ''), COALESCE(cover, ''), COALESCE(surface, ''), COALESCE(count_pages, 0), quantity, unit_price, amount, discount FROM order_items WHERE orders_id = ($1) ORDER BY order_items_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving order items from pgx table. Err: %s", err)
+		return items, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.OrderItem
+		if err = rows.Scan(&item.Code, &item.ProjectID, &item.Size, &item.Variant, &item.Cover, &item.Surface, &item.CountPages, &item.Quantity, &item.UnitPrice, &item.Amount, &item.Discount); err != nil {
+			log.Printf("Error happened when scanning order items. Err: %s", err)
+			return items, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+
+}
+
+// orderBookPrice returns the price of the book in the order by the line items stored at the checkout. The orders placed
+// before the line items were stored are priced by the price list in effect when they were created.
+func orderBookPrice(ctx context.Context, storeDB *pgxpool.Pool, items []models.OrderItem, book pricing.Book, createdAt time.Time) (money.Money, error) {
+
+	if len(items) > 0 {
+		return ItemsBookPrice(items, book.ProjectID), nil
+	}
+	breakdown, err := CalculateBasePrice(ctx, storeDB, book, createdAt)
+	return breakdown.Total, err
+
+}
+
+// ItemsBookPrice returns the price of the book of the project in the order items, without the package box and the discounts.
+func ItemsBookPrice(items []models.OrderItem, projectID uint) money.Money {
+
+	var price money.Money
+	for _, item := range items {
+		if item.ProjectID == projectID && pricing.IsBookLine(item.Code) {
+			price += item.Amount
+		}
+	}
+	return price
+
+}
@@ -6,16 +6,18 @@ package orderstorage
 import (
 	"context"
 	"errors"
-	"github.com/SiberianMonster/memoryprint/internal/delivery"
 	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
 	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
+	"github.com/SiberianMonster/memoryprint/internal/promotions"
 	"github.com/SiberianMonster/memoryprint/internal/userstorage"
 	"github.com/SiberianMonster/memoryprint/internal/emailutils"
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"log"
 	"time"
 	"strconv"
-	"math"
 	"fmt"
 
 	"github.com/jackc/pgx/v5"
@@ -40,15 +42,9 @@ func CheckProjectPublished(ctx context.Context, storeDB *pgxpool.Pool, projectID
 func CheckCountProjects(ctx context.Context, storeDB *pgxpool.Pool, userID uint, countPassed uint) bool {
 	var correctCount bool
 	var countReal uint
-	var orderID uint
-	err = storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) AND status = ($2);", userID, "AWAITING_PAYMENT").Scan(&orderID)
-	if err != nil {
-			log.Printf("Error happened when retrieving order id data from db. Err: %s", err)
-			return false
-	}
-	err := storeDB.QueryRow(ctx, "SELECT COUNT(projects_id) FROM orders_has_projects WHERE orders_id = ($1);", orderID).Scan(&countReal)
+	err := storeDB.QueryRow(ctx, "SELECT COALESCE(SUM(ci.quantity), 0) FROM cart_items ci JOIN carts c ON c.carts_id = ci.carts_id WHERE c.users_id = ($1);", userID).Scan(&countReal)
 	if err != nil {
-		log.Printf("Error happened when counting projects in the order. Err: %s", err)
+		log.Printf("Error happened when counting copies in the cart. Err: %s", err)
 		return false
 	}
 	if countPassed <= countReal {
@@ -82,123 +78,34 @@ func CheckOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) bool {
 }
 
 
-func CalculateBasePrice(ctx context.Context, storeDB *pgxpool.Pool, size string, variant string, cover string, surface string, countPages uint) (float64, error) {
-
-	var totalBaseprice float64
-	var basePrice float64
-	var extraPriceperpage float64
-
-	err := storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND cover = ($3) AND surface = ($4);", size, variant, cover, surface).Scan(&basePrice, &extraPriceperpage)
-	
-	if err != nil {
-		log.Printf("Error happened when retrieving base price from pgx table. Err: %s", err)
-		return totalBaseprice, err
-	}
-	
-	log.Println(extraPriceperpage)
-	log.Println(basePrice)
-	extraPrice := extraPriceperpage*float64((countPages-23))
-	totalBaseprice = basePrice + extraPrice
-
-
-	return totalBaseprice, nil
-	
-}
-
-func FindPrice(ctx context.Context, storeDB *pgxpool.Pool, size string, variant string, cover string) (float64, float64, error) {
-
-	var basePrice float64
-	var extraPriceperpage float64
-
-	err := storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND cover = ($3);", size, variant, cover).Scan(&basePrice, &extraPriceperpage)
-	
-	if err != nil {
-		log.Printf("Error happened when retrieving base price from pgx table. Err: %s", err)
-		return basePrice, extraPriceperpage, err
-	}
-	
-	return basePrice, extraPriceperpage, nil
-	
-}
+// CalculateBasePrice returns the price of the book by the price list in effect at the time, see pricing.Catalog.Quote.
+// A book the catalog cannot price or whose page count it does not allow is not an error here, the checkout refuses it.
+func CalculateBasePrice(ctx context.Context, storeDB *pgxpool.Pool, book pricing.Book, at time.Time) (models.PriceBreakdown, error) {
 
-func CalculateAlternativePrice(ctx context.Context, storeDB *pgxpool.Pool, size string, variant string, cover string, surface string, countPages uint) (float64, float64, error) {
-
-	var totalPageprice float64
-	var totalCoverprice float64
-	var altPagePrice float64
-	var altCoverPrice float64
-	var extraPriceperpage float64
-	var err error
-	log.Println(variant)
-	log.Println(surface)
-	log.Println(cover)
-	if surface == "GLOSS" {
-		err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND surface = ($3) AND cover = ($4);", size, variant, "MATTE", cover).Scan(&altPagePrice, &extraPriceperpage)
-	} else if surface == "MATTE" {
-		err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND surface = ($3) AND cover = ($4);", size, variant, "GLOSS", cover).Scan(&altPagePrice, &extraPriceperpage)
-	}
+	catalog, err := pricing.LoadCatalog(ctx, storeDB, at)
 	if err != nil {
-		log.Printf("Error happened when retrieving alternative price from pgx table. Err: %s", err)
-		return 0.0, 0.0, err
-	}
-	log.Println(altPagePrice)
-	log.Println(extraPriceperpage)
-	extraPrice := extraPriceperpage*float64(countPages-23)
-	totalPageprice = altPagePrice + extraPrice
-	log.Println(countPages)
-	log.Println(extraPrice)
-	log.Println(totalPageprice)
-
-	if cover == "HARD" {
-		err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND surface = ($3) AND cover = ($4);", size, variant, surface, "LEATHERETTE").Scan(&altCoverPrice, &extraPriceperpage)
-	} else if cover == "LEATHERETTE" {
-		err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND surface = ($3) AND cover = ($4);", size, variant, surface, "HARD").Scan(&altCoverPrice, &extraPriceperpage)
+		return models.PriceBreakdown{}, err
 	}
+	breakdown, err := catalog.Quote(book)
 	if err != nil {
-		log.Printf("Error happened when retrieving alternative price from pgx table. Err: %s", err)
-		return 0.0, 0.0, err
+		log.Printf("Failed to price the project %d. Err: %s", book.ProjectID, err)
 	}
-	
-	extraPrice = extraPriceperpage*float64(countPages-23)
-	totalCoverprice = altCoverPrice + extraPrice
-	log.Println(extraPrice)
-	log.Println(totalPageprice)
-	log.Println(totalCoverprice)
-
-
-	return totalPageprice, totalCoverprice, nil
+	return breakdown, nil
 	
 }
 
-func CalculateBasePriceByID(ctx context.Context, storeDB *pgxpool.Pool, pID uint) (float64, error) {
+// CalculateAlternativePrice returns the prices of the book on the other surface and in the other cover, see pricing.Catalog.Alternatives.
+func CalculateAlternativePrice(ctx context.Context, storeDB *pgxpool.Pool, book pricing.Book) (money.Money, money.Money, error) {
 
-	var totalBaseprice float64
-	var basePrice float64
-	var extraPriceperpage float64
-	var size, variant, cover, surface string
-	var countPages int
-
-	err := storeDB.QueryRow(ctx, "SELECT size, variant, cover, surface, count_pages FROM projects WHERE projects_id = ($1);", pID).Scan(&size, &variant, &cover, &surface, &countPages)
-	
+	catalog, err := pricing.LoadCatalog(ctx, storeDB, time.Now())
 	if err != nil {
-		log.Printf("Error happened when retrieving project data from pgx table. Err: %s", err)
-		return totalBaseprice, err
+		return money.Zero, money.Zero, err
 	}
-
-	err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND cover = ($3) AND surface = ($4);", size, variant, cover, surface).Scan(&basePrice, &extraPriceperpage)
-	
+	surfacePrice, coverPrice, err := catalog.Alternatives(book)
 	if err != nil {
-		log.Printf("Error happened when retrieving base price from pgx table. Err: %s", err)
-		return totalBaseprice, err
+		log.Printf("Failed to price the alternatives of the project %d. Err: %s", book.ProjectID, err)
 	}
-	
-	extraPrice := extraPriceperpage*float64((countPages-23))
-	totalBaseprice = basePrice + extraPrice
-	log.Println(extraPrice)
-	log.Println(totalBaseprice)
-
-
-	return totalBaseprice, nil
+	return surfacePrice, coverPrice, nil
 	
 }
 
@@ -207,16 +114,9 @@ func LoadCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (models.R
 
 	var responseCart models.ResponseCart
 	responseCart.Projects = []models.CartObj{}
-	var orderID uint
-	err := storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) and status = ($2);", userID, "AWAITING_PAYMENT").Scan(&orderID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-				log.Printf("Error happened when retrieving unpaid order info from pgx table. Err: %s", err)
-				return responseCart, err
-	}
-	log.Println(orderID)
-	rows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", orderID)
+	rows, err := storeDB.Query(ctx, "SELECT ci.projects_id, ci.quantity FROM cart_items ci JOIN carts c ON c.carts_id = ci.carts_id WHERE c.users_id = ($1) ORDER BY ci.cart_items_id;", userID)
 	if err != nil {
-		log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
+		log.Printf("Error happened when retrieving cart items from pgx table. Err: %s", err)
 		return responseCart, err
 	}
 	defer rows.Close()
@@ -227,7 +127,7 @@ func LoadCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (models.R
 		var pID uint
 		var leatherID uint
 		var category string
-		if err = rows.Scan(&pID); err != nil {
+		if err = rows.Scan(&pID, &photobook.Quantity); err != nil {
 			log.Printf("Error happened when scanning projects. Err: %s", err)
 			return responseCart, err
 		}
@@ -239,12 +139,14 @@ func LoadCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (models.R
 			return responseCart, err
 		}
 
-		photobook.BasePrice, err = CalculateBasePrice(ctx, storeDB, photobook.Size, photobook.Variant, photobook.Cover, photobook.Surface, uint(photobook.CountPages))
+		book := pricing.Book{ProjectID: pID, Size: photobook.Size, Variant: photobook.Variant, Cover: photobook.Cover, Surface: photobook.Surface, CountPages: photobook.CountPages, LeatherID: leatherID, Quantity: photobook.Quantity}
+		photobook.Breakdown, err = CalculateBasePrice(ctx, storeDB, book, time.Now())
 		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("Error happened when counting baseprice. Err: %s", err)
 			return responseCart, err
 		}
-		photobook.UpdatedPagesPrice, photobook.UpdatedCoverPrice, err = CalculateAlternativePrice(ctx, storeDB, photobook.Size, photobook.Variant, photobook.Cover, photobook.Surface, uint(photobook.CountPages))
+		photobook.BasePrice = photobook.Breakdown.Total
+		photobook.UpdatedPagesPrice, photobook.UpdatedCoverPrice, err = CalculateAlternativePrice(ctx, storeDB, book)
 		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 			log.Printf("Error happened when counting alternative price. Err: %s", err)
 			return responseCart, err
@@ -271,66 +173,20 @@ func LoadCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (models.R
 
 }
 
-// CreateOrder function performs the operation of creating a new order for project print for user from pgx database with a query.
+// CreateOrder function performs the operation of publishing the project and putting a copy of it in the cart of the user
+// in pgx database with queries. It returns the id of the cart.
 func CreateOrder(ctx context.Context, storeDB *pgxpool.Pool, userID uint, order models.NewOrder) (uint, error) {
 
-	var orderID uint
-	t := time.Now()
-	
-	_, err := storeDB.Exec(ctx, "UPDATE projects SET status = ($1) WHERE projects_id = ($2);",
-			"PUBLISHED",
-			order.ProjectID,
-	)
-	if err != nil {
-			log.Printf("Error happened when updating project to published into pgx table. Err: %s", err)
-			return orderID, err
-	}
-	err = storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) and status = ($2) ORDER BY created_at;", userID, "AWAITING_PAYMENT").Scan(&orderID)
-	if err == nil {
-		_, err := storeDB.Exec(ctx, "UPDATE orders SET last_updated_at = ($1) WHERE orders_id = ($2);",
-			t,
-			orderID,
-		)
-		if err != nil {
-			log.Printf("Error happened when updating order last updated at into pgx table. Err: %s", err)
-			return orderID, err
-		}
-		_, err = storeDB.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id) VALUES ($1, $2);",
-			orderID,
-			order.ProjectID) 
-		if err != nil {
-				log.Printf("Error happened when adding new project to order into pgx table. Err: %s", err)
-				return orderID, err
-		}
-	} else if errors.Is(err, pgx.ErrNoRows) {
-		
-		err := storeDB.QueryRow(ctx, "INSERT INTO orders (status, created_at, last_updated_at, users_id) VALUES ($1, $2, $3, $4) RETURNING orders_id ;",
-		"AWAITING_PAYMENT",
-		t,
-		t,
-		userID).Scan(&orderID)
-		if err != nil {
-			log.Printf("Error happened when creating order entry into pgx table. Err: %s", err)
-			return orderID, err
-		}
-		_, err = storeDB.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id) VALUES ($1, $2);",
-		orderID,
-		order.ProjectID) 
-		if err != nil {
-			log.Printf("Error happened when adding new project to order into pgx table. Err: %s", err)
-			return orderID, err
-		}
-	} else if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("Error happened when creating order into pgx table. Err: %s", err)
-		return orderID, err
-	}
-	
-	return orderID, nil
+	return AddCartItem(ctx, storeDB, userID, models.CartItem{ProjectID: order.ProjectID, Quantity: 1})
 
 }
 
-// OrderPayment function performs the operation of creating payment for the order from pgx database with a query.
-func OrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderObj models.RequestOrderPayment, userID uint) (float64, uint, error) {
+// OrderPayment function performs the operation of creating payment for the order in pgx database in a transaction.
+// deliveryPrice is the carrier quote for the delivery of the order, warehouseID the warehouse it is shipped from.
+// The cart of the user is locked for the checkout, so a repeated checkout with the same idempotency key returns
+// ErrCheckoutRepeated with the order placed before, and the gift certificate and the promocode are locked while they are taken.
+// The promocode is applied by the rules of its promotion and its redemption is reserved for the order, see promotions.Apply.
+func OrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderObj models.RequestOrderPayment, userID uint, deliveryPrice money.Money, warehouseID uint) (money.Money, uint, error) {
 
 	t := time.Now()
 	var orderID uint
@@ -339,97 +195,98 @@ func OrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderObj models.Re
 	var contacts models.Contacts
 
 	deliveryObj = orderObj.DeliveryData
-	var ApiPaymentObj models.ApiResponseDeliveryCost
-	var rApiCost models.RequestDeliveryCost
-	var fromLoc models.Location
-	var toLoc models.Location
-	var p models.Package
-	var s models.Service
-	var depositPrice float64
-
-	if deliveryObj.Method == "DOOR" {
-		rApiCost.TariffCode = 139
-	} else if deliveryObj.Method == "POSTAMAT" {
-		rApiCost.TariffCode = 138
-	} else if deliveryObj.Method == "PVZ" {
-		rApiCost.TariffCode = 138
-	}
-
-	toLoc.Address = deliveryObj.Address
-	toLoc.PostalCode = deliveryObj.PostalCode
-	rApiCost.ToLocation = toLoc
-	p.Weight = (300 * len(orderObj.Projects))
-	p.Height = 3 * len(orderObj.Projects)
-	p.Width = 30 
-	p.Length = 30 
-	s.Code = "CARTON_BOX_500GR"
-	s.Parameter = strconv.Itoa(len(orderObj.Projects))
-	rApiCost.Packages = append(rApiCost.Packages, p)
-	rApiCost.Services = append(rApiCost.Services, s)
-	fromLoc.PostalCode = "129323"
-	fromLoc.City = "Москва"
-	fromLoc.Address = "проезд Серебрякова, 7"
-	rApiCost.FromLocation = fromLoc
-
-	
-
-	ApiPaymentObj, err = delivery.CalculateDelivery(rApiCost)
+	var depositPrice money.Money
 
+	contacts = orderObj.ContactData
+	// the books are priced with the package box and the volume discount whether a promocode is used or not
+	breakdown, err := pricing.QuoteCart(ctx, storeDB, orderObj.Cart, orderObj.PackageBox)
 	if err != nil {
-		log.Printf("Error happened when ccalculating delivery. Err: %s", err)
+		log.Printf("Error happened when pricing the order. Err: %s", err)
+		return depositPrice, orderID, err
+	}
+	var books []promotions.Book
+	if orderObj.Promocode != "" {
+		books, err = promotions.LoadBooks(ctx, storeDB, orderObj.Cart)
+		if err != nil {
 			return depositPrice, orderID, err
+		}
 	}
 
-	contacts = orderObj.ContactData
-	err = storeDB.QueryRow(ctx, "INSERT INTO delivery (status, created_at, method, address, amount, postal_code, code) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING delivery_id;",
-		"DRAFT",
-		t,
-		deliveryObj.Method,
-		deliveryObj.Address,
-		ApiPaymentObj.TotalSum,
-		deliveryObj.PostalCode,
-		deliveryObj.Code).Scan(&deliveryID)
+	tx, err := storeDB.Begin(ctx)
 	if err != nil {
-			log.Printf("Error happened when creating draft delivery entry into pgx table. Err: %s", err)
+		log.Printf("Error happened when starting checkout transaction. Err: %s", err)
+		return depositPrice, orderID, err
+	}
+	defer tx.Rollback(ctx)
+
+	var cartID uint
+	err = tx.QueryRow(ctx, "SELECT carts_id FROM carts WHERE users_id = ($1) FOR UPDATE;", userID).Scan(&cartID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return depositPrice, orderID, ErrNotInCart
+	}
+	if err != nil {
+		log.Printf("Error happened when locking cart into pgx table. Err: %s", err)
+		return depositPrice, orderID, err
+	}
+	if orderObj.IdempotencyKey != "" {
+		err = tx.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) AND idempotency_key = ($2);", userID, orderObj.IdempotencyKey).Scan(&orderID)
+		if err == nil {
+			return depositPrice, orderID, ErrCheckoutRepeated
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("Error happened when retrieving checkout from pgx table. Err: %s", err)
 			return depositPrice, orderID, err
+		}
 	}
-	var requestP models.RequestPromooffer
-	var responseP models.ResponsePromocodeUse
-	var deposit float64
-	requestP.Projects = orderObj.Projects
-	requestP.Code = orderObj.Promocode
+
 	var PromoffersID uint
-	if requestP.Code != "" {
-		responseP, err = userstorage.UsePromocode(ctx, storeDB, requestP)
-		err = storeDB.QueryRow(ctx, "SELECT promooffers_id FROM promooffers WHERE code = ($1);", orderObj.Promocode).Scan(&PromoffersID)
+	applied := promotions.Result{Breakdown: breakdown}
+	if orderObj.Promocode != "" {
+		p, usage, err := promotions.LockPromotion(ctx, tx, orderObj.Promocode, userID)
 		if err != nil {
-			log.Printf("Failed to retrieve promooffers id. Err: %s", err)
 			return depositPrice, orderID, err
 		}
-	}
-	if orderObj.Giftcertificate != "" {
-		deposit, _, err = userstorage.UseCertificate(ctx, storeDB, orderObj.Giftcertificate, userID)
+		// the limits are checked again under the lock, another checkout may have redeemed the promocode meanwhile
+		err = promotions.Check(p, usage, userID, t)
+		if errors.Is(err, promotions.ErrRedeemed) || errors.Is(err, promotions.ErrUserLimit) {
+			return depositPrice, orderID, ErrPromocodeUnavailable
+		}
 		if err != nil {
-			log.Printf("Error happened when calculating discounted price. Err: %s", err)
 			return depositPrice, orderID, err
 		}
+		applied, err = promotions.Apply(p, promotions.Order{Books: books, Breakdown: breakdown, DeliveryPrice: deliveryPrice, Certificate: orderObj.Giftcertificate != ""})
+		if err != nil {
+			return depositPrice, orderID, err
+		}
+		PromoffersID = p.ID
 	}
+	// the delivery is recorded at the price the customer pays, nothing for a free shipping promocode
+	deliveryPrice -= applied.DeliveryDiscount
 
-	var usedDeposit float64
+	var deposit money.Money
 	var GiftcertificatesID uint
-	priceWithDelivery := responseP.DiscountedPrice + ApiPaymentObj.TotalSum
-	if deposit != 0.0 {
-		depositPrice = math.Max(1, priceWithDelivery - deposit)
-		usedDeposit = priceWithDelivery - depositPrice
-		log.Println(usedDeposit)
-		log.Println(depositPrice)
-		
-		err = storeDB.QueryRow(ctx, "SELECT giftcertificates_id FROM giftcertificates WHERE code = ($1);", orderObj.Giftcertificate).Scan(&GiftcertificatesID)
+	if orderObj.Giftcertificate != "" {
+		var status string
+		err = tx.QueryRow(ctx, "SELECT giftcertificates_id, status, currentdeposit FROM giftcertificates WHERE code = ($1) FOR UPDATE;", orderObj.Giftcertificate).Scan(&GiftcertificatesID, &status, &deposit)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return depositPrice, orderID, ErrCertificateUnavailable
+		}
 		if err != nil {
 			log.Printf("Failed to retrieve giftcertificates id. Err: %s", err)
 			return depositPrice, orderID, err
 		}
-		_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2);",
+		if status != "PAID" || deposit == money.Zero {
+			return depositPrice, orderID, ErrCertificateUnavailable
+		}
+	}
+
+	var usedDeposit money.Money
+	priceWithDelivery := breakdown.Total - applied.Discount + deliveryPrice
+	if deposit != money.Zero {
+		// the bank does not register payments below one rouble
+		depositPrice = money.Max(money.FromRoubles(1), priceWithDelivery - deposit)
+		usedDeposit = priceWithDelivery - depositPrice
+		_, err = tx.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2);",
 		"RESERVED",
 		GiftcertificatesID,
 		)
@@ -440,10 +297,21 @@ func OrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderObj models.Re
 	} else {
 		depositPrice = priceWithDelivery
 	}
-	
-	
-	
-	err := storeDB.QueryRow(ctx, "INSERT INTO orders (status, created_at, last_updated_at, users_id, firstname, lastname, email, phone, baseprice, finalprice, promooffers_id, giftcertificates_id, package_box, giftcertificates_deposit, delivery_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15) RETURNING orders_id;",
+
+	err = tx.QueryRow(ctx, "INSERT INTO delivery (status, created_at, method, address, amount, postal_code, code, warehouses_id) VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, 0)) RETURNING delivery_id;",
+		"DRAFT",
+		t,
+		deliveryObj.Method,
+		deliveryObj.Address,
+		deliveryPrice,
+		deliveryObj.PostalCode,
+		deliveryObj.Code,
+		warehouseID).Scan(&deliveryID)
+	if err != nil {
+			log.Printf("Error happened when creating draft delivery entry into pgx table. Err: %s", err)
+			return depositPrice, orderID, err
+	}
+	err = tx.QueryRow(ctx, "INSERT INTO orders (status, created_at, last_updated_at, users_id, firstname, lastname, email, phone, baseprice, finalprice, promooffers_id, giftcertificates_id, package_box, giftcertificates_deposit, delivery_id, price_lists_id, idempotency_key) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NULLIF($16, 0), NULLIF($17, '')) RETURNING orders_id;",
 		"PAYMENT_IN_PROGRESS",
 		t,
 		t,
@@ -452,47 +320,79 @@ func OrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderObj models.Re
 		contacts.LastName,
 		contacts.Email,
 		contacts.Phone,
-		responseP.BasePrice,
+		breakdown.Total,
 		depositPrice,
 		PromoffersID,
 		GiftcertificatesID, 
 		orderObj.PackageBox, 
 		usedDeposit,
-		deliveryID).Scan(&orderID)
+		deliveryID,
+		breakdown.PriceListID,
+		orderObj.IdempotencyKey).Scan(&orderID)
 	if err != nil {
 			log.Printf("Error happened when creating order entry into pgx table. Err: %s", err)
 			return depositPrice, orderID, err
 	}
-	
+	if PromoffersID != 0 {
+		err = promotions.Reserve(ctx, tx, PromoffersID, userID, orderID, applied.Discount + applied.DeliveryDiscount)
+		if err != nil {
+			return depositPrice, orderID, err
+		}
+	}
+	_, err = tx.Exec(ctx, "INSERT INTO order_status_history (orders_id, from_status, to_status, actor, users_id, reason, created_at) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, 0), $6, $7);",
+		orderID,
+		orderstatus.AwaitingPayment,
+		orderstatus.PaymentInProgress,
+		orderstatus.ActorCustomer,
+		userID,
+		"",
+		t,
+	)
+	if err != nil {
+		log.Printf("Error happened when inserting order status history into pgx table. Err: %s", err)
+		return depositPrice, orderID, err
+	}
 
-	for _, project := range orderObj.Projects {
-		_, err = storeDB.Exec(ctx, "DELETE FROM orders_has_projects WHERE projects_id=($1);",
-		project,
+	for _, item := range orderObj.Cart {
+		tag, err := tx.Exec(ctx, "DELETE FROM cart_items WHERE projects_id = ($1) AND carts_id = ($2);",
+		item.ProjectID,
+		cartID,
 		)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-			log.Printf("Error happened when deleting project from orders_has_projects pgx table. Err: %s", err)
+		if err != nil {
+			log.Printf("Error happened when deleting project from cart_items pgx table. Err: %s", err)
 			return depositPrice, orderID, err
 		}
-        _, err = storeDB.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id) VALUES ($1, $2);",
+		if tag.RowsAffected() == 0 {
+			return depositPrice, orderID, ErrNotInCart
+		}
+        _, err = tx.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id, quantity) VALUES ($1, $2, $3);",
 		orderID,
-		project,
+		item.ProjectID,
+		item.Quantity,
 		)
 		if err != nil {
 			log.Printf("Error happened when inserting orders_has_projects into pgx table. Err: %s", err)
 			return depositPrice, orderID, err
 		}
 	}
-		
+	// the prices the order is placed at are kept with it, later price lists do not change them
+	err = SaveOrderItems(ctx, tx, orderID, applied.Breakdown)
+	if err != nil {
+		return depositPrice, orderID, err
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Printf("Error happened when committing checkout transaction. Err: %s", err)
+		return depositPrice, orderID, err
+	}
 	
-	return depositPrice, orderID, err
+	return depositPrice, orderID, nil
 
 }
 
 // CancelPayment function performs the operation of cancelling payment for the order from pgx database with a query.
 func CancelPayment(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, userID uint) (error) {
 
-	t := time.Now()
-	var awaitedOrderID uint
 	var deliveryID uint
 	var transactionID uint
 	
@@ -500,42 +400,28 @@ func CancelPayment(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, use
 	// set delivery status to cancelled
 	// set transaction status to refunded
 
-	_, err := storeDB.Exec(ctx, "UPDATE orders SET last_updated_at = ($1), status = ($2) WHERE orders_id = ($3);",
-			t,
-			"CANCELLED",
-			orderID,
-	)
+	status, err := LoadOrderStatus(ctx, storeDB, orderID)
 	if err != nil {
-		log.Printf("Error happened when cancelling order into pgx table. Err: %s", err)
 		return err
 	}
-	
-	err = storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) and status = ($2) ORDER BY created_at;", userID, "AWAITING_PAYMENT").Scan(&awaitedOrderID)
+	if !orderstatus.CanTransition(status, orderstatus.Cancelled) {
+		return orderstatus.ErrIllegalTransition
+	}
+	err = UpdateOrderStatus(ctx, storeDB, orderID, models.OrderStatusChange{FromStatus: status, ToStatus: orderstatus.Cancelled, Actor: orderstatus.ActorCustomer, UsersID: userID, Reason: "payment cancelled"})
 	if err != nil {
-		log.Printf("Error happened when searching for draft order into pgx table. Err: %s", err)
+		log.Printf("Error happened when cancelling order into pgx table. Err: %s", err)
 		return err
 	}
-
-	rows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", awaitedOrderID)
+	// the cancelled order gives up its idempotency key, so a retry of the checkout places the order again
+	_, err = storeDB.Exec(ctx, "UPDATE orders SET idempotency_key = NULL WHERE orders_id = ($1);", orderID)
 	if err != nil {
-		log.Printf("Error happened when retrieving projects for cancelled order from pgx table. Err: %s", err)
+		log.Printf("Error happened when releasing checkout idempotency key into pgx table. Err: %s", err)
 		return err
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var projectID uint
-		if err = rows.Scan(&projectID); err != nil {
-			log.Printf("Error happened when scanning project ID. Err: %s", err)
-			return err
-		}
-		_, err = storeDB.Exec(ctx, "INSERT INTO orders_has_projects (orders_id, projects_id) VALUES ($1, $2);",
-			awaitedOrderID,
-			projectID) 
-		if err != nil {
-				log.Printf("Error happened when rolling back project to draft order into pgx table. Err: %s", err)
-				return err
-		}
+	
+	err = restoreCart(ctx, storeDB, userID, orderID)
+	if err != nil {
+		return err
 	}
 	err = storeDB.QueryRow(ctx, "SELECT delivery_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&deliveryID)
 	if err != nil {
@@ -543,8 +429,8 @@ func CancelPayment(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, use
 		return err
 	}
 
-	err = storeDB.QueryRow(ctx, "SELECT LAST(transaction_id) FROM orders_has_transactions WHERE orders_id = ($1);", orderID).Scan(&transactionID)
-	if err = rows.Err(); err != nil {
+	err = storeDB.QueryRow(ctx, "SELECT transactions_id FROM orders_has_transactions WHERE orders_id = ($1) ORDER BY transactions_id DESC LIMIT 1;", orderID).Scan(&transactionID)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 		log.Printf("Error happened when retrieving transaction info from pgx table. Err: %s", err)
 		return err
 	}
@@ -566,35 +452,32 @@ func CancelPayment(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, use
 		log.Printf("Error happened when cancelling delivery into pgx table. Err: %s", err)
 		return err
 	}
-	var promocodeID uint
 	var giftcertificateID uint
-	var deposit float64
-	var currentdeposit float64
-	var promostatus bool
-	err = storeDB.QueryRow(ctx, "SELECT promooffers_id, giftcertificates_id, giftcertificates_deposit FROM orders WHERE orders_id = ($1);", orderID).Scan(&promocodeID, &giftcertificateID, &deposit)
+	var deposit money.Money
+	var currentdeposit money.Money
+	err = storeDB.QueryRow(ctx, "SELECT giftcertificates_id, giftcertificates_deposit FROM orders WHERE orders_id = ($1);", orderID).Scan(&giftcertificateID, &deposit)
+	if err != nil {
+		log.Printf("Error happened when searching for gift certificate for order into pgx table. Err: %s", err)
+		return err
+	}
+	err = promotions.Release(ctx, storeDB, orderID)
 	if err != nil {
-		log.Printf("Error happened when searching for promocode for order into pgx table. Err: %s", err)
 		return err
 	}
-	if promocodeID != 0 {
-		err = storeDB.QueryRow(ctx, "SELECT is_used FROM promooffers WHERE promooffers_id = ($1);", promocodeID).Scan(&promostatus)
+
+	// the deposit is only deducted on successful payment, an order cancelled before it only lifts the reservation
+	if giftcertificateID != 0 && status != orderstatus.Paid {
+		_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2) AND status = ($3);",
+			"PAID",
+			giftcertificateID,
+			"RESERVED",
+		)
 		if err != nil {
-			log.Printf("Error happened when searching for promocode for order into pgx table. Err: %s", err)
+			log.Printf("Error happened when releasing gift certificate into pgx table. Err: %s", err)
 			return err
 		}
-		if promostatus == true {
-			_, err = storeDB.Exec(ctx, "UPDATE promooffers SET is_used = ($1) WHERE promooffers_id = ($2);",
-			false,
-			promocodeID,
-			)
-			if err != nil {
-				log.Printf("Error happened when restoring onetime promocode into pgx table. Err: %s", err)
-				return err
-			}
-		}
 	}
-
-	if giftcertificateID != 0 && deposit != 0 {
+	if giftcertificateID != 0 && deposit != 0 && status == orderstatus.Paid {
 		err = storeDB.QueryRow(ctx, "SELECT currentdeposit FROM giftcertificates WHERE giftcertificates_id = ($1);", giftcertificateID).Scan(&currentdeposit)
 		if err != nil {
 			log.Printf("Error happened when searching for gift certificate for order into pgx table. Err: %s", err)
@@ -650,14 +533,14 @@ func RetrieveOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint, isA
 		var deliveryID *uint
 		var promooffersID *uint
 		var giftcertificateID *uint
-		var certificateDeposit *float64
+		var certificateDeposit *money.Money
 
 		if err = rows.Scan(&oID, &orderObj.Status, &createTimeStorage, &orderObj.BasePrice, &orderObj.FinalPrice, &deliveryID, &promooffersID, &giftcertificateID, &certificateDeposit); err != nil {
 			log.Printf("Error happened when scanning orders. Err: %s", err)
 			return orderset, err
 		}
 
-		var deliveryAmount float64
+		var deliveryAmount money.Money
 		if orderObj.Status == "IN_DELIVERY" {
 			err = storeDB.QueryRow(ctx, "SELECT trackingnumber, amount FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&orderObj.TrackingNumber, &deliveryAmount)
 			if err != nil && err != pgx.ErrNoRows {
@@ -669,20 +552,20 @@ func RetrieveOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint, isA
 		orderObj.OrderID = oID
 		orderObj.CreatedAt = createTimeStorage.Unix()
 		if certificateDeposit != nil {
-			if *certificateDeposit != float64(0.0) {
+			if *certificateDeposit != money.Zero {
 				orderObj.CertificateDeposit = certificateDeposit
 			} 
 			
 		}
-		var certValue float64
+		var certValue money.Money
 		if orderObj.CertificateDeposit != nil {
 			certValue = *orderObj.CertificateDeposit
 		}
-		var finalValue float64
+		var finalValue money.Money
 		if orderObj.FinalPrice != nil {
 			finalValue = *orderObj.FinalPrice
 		}
-		var baseValue float64
+		var baseValue money.Money
 		if orderObj.BasePrice != nil {
 			baseValue = *orderObj.BasePrice
 		}
@@ -700,7 +583,11 @@ func RetrieveOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint, isA
 			orderObj.PromocodeDiscount = &pDiscount
 		}
 
-		prows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", oID)
+		items, err := LoadOrderItems(ctx, storeDB, oID)
+		if err != nil {
+			return orderset, err
+		}
+		prows, err := storeDB.Query(ctx, "SELECT projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1);", oID)
 		if err != nil {
 			log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
 			return orderset, err
@@ -711,7 +598,7 @@ func RetrieveOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint, isA
 			var photobook models.PaidCartObj
 			var pID uint
 			var leatherID *uint
-			if err = prows.Scan(&pID); err != nil {
+			if err = prows.Scan(&pID, &photobook.Quantity); err != nil {
 				log.Printf("Error happened when scanning projects. Err: %s", err)
 				return orderset, err
 			}
@@ -722,7 +609,11 @@ func RetrieveOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint, isA
 				return orderset, err
 			}
 			
-			photobook.BasePrice, err = CalculateBasePrice(ctx, storeDB, photobook.Size, photobook.Variant, photobook.Cover, photobook.Surface, uint(photobook.CountPages))
+			book := pricing.Book{ProjectID: pID, Size: photobook.Size, Variant: photobook.Variant, Cover: photobook.Cover, Surface: photobook.Surface, CountPages: photobook.CountPages, Quantity: photobook.Quantity}
+			if leatherID != nil {
+				book.LeatherID = *leatherID
+			}
+			photobook.BasePrice, err = orderBookPrice(ctx, storeDB, items, book, createTimeStorage)
 			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when counting baseprice. Err: %s", err)
 				return orderset, err
@@ -761,7 +652,8 @@ func RetrieveSingleOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uin
 	var orderObj models.ResponseOrder
 	var createTimeStorage time.Time
 	var deliveryID uint
-	err := storeDB.QueryRow(ctx, "SELECT orders_id, status, created_at, baseprice, finalprice, delivery_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.OrderID, &orderObj.Status, &createTimeStorage, &orderObj.BasePrice, &orderObj.FinalPrice, &deliveryID)
+	var certificateDeposit *money.Money
+	err := storeDB.QueryRow(ctx, "SELECT orders_id, status, created_at, baseprice, finalprice, delivery_id, giftcertificates_deposit FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.OrderID, &orderObj.Status, &createTimeStorage, &orderObj.BasePrice, &orderObj.FinalPrice, &deliveryID, &certificateDeposit)
 		
 	if err != nil {
 			log.Printf("Error happened when scanning orders. Err: %s", err)
@@ -770,7 +662,21 @@ func RetrieveSingleOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uin
 
 		
 	orderObj.CreatedAt = createTimeStorage.Unix()
-	prows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1) ORDER DESC;", orderID)
+	if certificateDeposit != nil && *certificateDeposit != money.Zero {
+		orderObj.CertificateDeposit = certificateDeposit
+	}
+	var deliveryAmount money.Money
+	err = storeDB.QueryRow(ctx, "SELECT amount FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&deliveryAmount)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving delivery data from db. Err: %s", err)
+		return orderObj, err
+	}
+	orderObj.DeliveryPrice = &deliveryAmount
+	orderObj.Items, err = LoadOrderItems(ctx, storeDB, orderID)
+	if err != nil {
+		return orderObj, err
+	}
+	prows, err := storeDB.Query(ctx, "SELECT projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1) ORDER BY projects_id DESC;", orderID)
 	if err != nil {
 			log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
 			return orderObj, err
@@ -779,7 +685,7 @@ func RetrieveSingleOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uin
 			var photobook models.PaidCartObj
 			var pID uint
 			var leatherID uint
-			if err = prows.Scan(&pID); err != nil {
+			if err = prows.Scan(&pID, &photobook.Quantity); err != nil {
 				log.Printf("Error happened when scanning projects. Err: %s", err)
 				return orderObj, err
 			}
@@ -790,7 +696,7 @@ func RetrieveSingleOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uin
 				return orderObj, err
 			}
 
-			photobook.BasePrice, err = CalculateBasePrice(ctx, storeDB, photobook.Size, photobook.Variant, photobook.Cover, photobook.Surface, uint(photobook.CountPages))
+			photobook.BasePrice, err = orderBookPrice(ctx, storeDB, orderObj.Items, pricing.Book{ProjectID: pID, Size: photobook.Size, Variant: photobook.Variant, Cover: photobook.Cover, Surface: photobook.Surface, CountPages: photobook.CountPages, LeatherID: leatherID, Quantity: photobook.Quantity}, createTimeStorage)
 			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when counting baseprice. Err: %s", err)
 				return orderObj, err
@@ -881,7 +787,7 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 		var deliveryID *uint
 		var promooffersID *uint
 		var giftcertificateID *uint
-		var certificateDeposit *float64
+		var certificateDeposit *money.Money
 
 		if err = rows.Scan(&oID, &orderObj.UserID, &orderObj.Commentary, &orderObj.Status, &createTimeStorage, &orderObj.BasePrice, &orderObj.FinalPrice, &orderObj.VideoLink, &deliveryID, &promooffersID, &giftcertificateID, &certificateDeposit); err != nil && err != pgx.ErrNoRows {
 			log.Printf("Error happened when scanning orders. Err: %s", err)
@@ -902,9 +808,9 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 		orderObj.Email = user.Email
 		orderObj.OrderID = oID
 		orderObj.CreatedAt = createTimeStorage.Unix()
-		var deliveryAmount float64
+		var deliveryAmount money.Money
 		if certificateDeposit != nil {
-			if *certificateDeposit != float64(0.0) {
+			if *certificateDeposit != money.Zero {
 				orderObj.CertificateDeposit = certificateDeposit
 			} 
 			
@@ -917,15 +823,15 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 			}
 		}
 		
-		var certValue float64
+		var certValue money.Money
 		if orderObj.CertificateDeposit != nil {
 			certValue = *orderObj.CertificateDeposit
 		}
-		var finalValue float64
+		var finalValue money.Money
 		if orderObj.FinalPrice != nil {
 			finalValue = *orderObj.FinalPrice
 		}
-		var baseValue float64
+		var baseValue money.Money
 		if orderObj.BasePrice != nil {
 			baseValue = *orderObj.BasePrice
 		}
@@ -944,7 +850,11 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 			orderObj.PromocodeDiscount = &pDiscount
 		}
 
-		prows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", oID)
+		items, err := LoadOrderItems(ctx, storeDB, oID)
+		if err != nil {
+			return orderset, err
+		}
+		prows, err := storeDB.Query(ctx, "SELECT projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1);", oID)
 		if err != nil {
 			log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
 			return orderset, err
@@ -955,7 +865,7 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 			var photobook models.PaidCartObj
 			var pID uint
 			var leatherID *uint
-			if err = prows.Scan(&pID); err != nil {
+			if err = prows.Scan(&pID, &photobook.Quantity); err != nil {
 				log.Printf("Error happened when scanning projects. Err: %s", err)
 				return orderset, err
 			}
@@ -966,7 +876,11 @@ func RetrieveAdminOrders(ctx context.Context, storeDB *pgxpool.Pool, userID uint
 				return orderset, err
 			}
 
-			photobook.BasePrice, err = CalculateBasePrice(ctx, storeDB, photobook.Size, photobook.Variant, photobook.Cover, photobook.Surface, uint(photobook.CountPages))
+			book := pricing.Book{ProjectID: pID, Size: photobook.Size, Variant: photobook.Variant, Cover: photobook.Cover, Surface: photobook.Surface, CountPages: photobook.CountPages, Quantity: photobook.Quantity}
+			if leatherID != nil {
+				book.LeatherID = *leatherID
+			}
+			photobook.BasePrice, err = orderBookPrice(ctx, storeDB, items, book, createTimeStorage)
 			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when counting baseprice. Err: %s", err)
 				return orderset, err
@@ -1007,7 +921,7 @@ func LoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models
 	var deliveryID *uint
 	var promocodeID *uint
 
-	err := storeDB.QueryRow(ctx, "SELECT status, users_id, delivery_id, firstname, lastname, email, phone, giftcertificates_deposit, promooffers_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.Status, &orderObj.UserID, &deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone, &orderObj.GiftcertificateDeposit, &promocodeID)
+	err := storeDB.QueryRow(ctx, "SELECT status, users_id, delivery_id, firstname, lastname, email, phone, giftcertificates_deposit, promooffers_id, original_orders_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.Status, &orderObj.UserID, &deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone, &orderObj.GiftcertificateDeposit, &promocodeID, &orderObj.OriginalOrderID)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when retrieving order info from pgx table. Err: %s", err)
 				return orderObj, err
@@ -1043,7 +957,7 @@ func LoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models
 
 	orderObj.ContactData = contactData
 	orderObj.DeliveryData = deliveryData
-	prows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", orderID)
+	prows, err := storeDB.Query(ctx, "SELECT projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1);", orderID)
 	if err != nil {
 		log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
 		return orderObj, err
@@ -1052,7 +966,7 @@ func LoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models
 
 	for prows.Next() {
 		var previewObj models.PreviewObject
-		if err = prows.Scan(&previewObj.ProjectID); err != nil {
+		if err = prows.Scan(&previewObj.ProjectID, &previewObj.Quantity); err != nil {
 			log.Printf("Error happened when scanning projects. Err: %s", err)
 			return orderObj, err
 		}
@@ -1077,7 +991,7 @@ func AdminLoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (m
 	var deliveryID *uint
 	var promoofferID *uint
 
-	err := storeDB.QueryRow(ctx, "SELECT users_id, delivery_id, firstname, lastname, email, phone, giftcertificates_deposit, promooffers_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.UserID, &deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone, &orderObj.GiftcertificateDeposit, &promoofferID)
+	err := storeDB.QueryRow(ctx, "SELECT users_id, delivery_id, firstname, lastname, email, phone, giftcertificates_deposit, promooffers_id, original_orders_id FROM orders WHERE orders_id = ($1);", orderID).Scan(&orderObj.UserID, &deliveryID, &contactData.FirstName, &contactData.LastName, &contactData.Email, &contactData.Phone, &orderObj.GiftcertificateDeposit, &promoofferID, &orderObj.OriginalOrderID)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when retrieving order info from pgx table. Err: %s", err)
 				return orderObj, err
@@ -1105,7 +1019,7 @@ func AdminLoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (m
 	}
 	orderObj.ContactData = contactData
 	orderObj.DeliveryData = deliveryData
-	prows, err := storeDB.Query(ctx, "SELECT projects_id FROM orders_has_projects WHERE orders_id = ($1);", orderID)
+	prows, err := storeDB.Query(ctx, "SELECT projects_id, quantity FROM orders_has_projects WHERE orders_id = ($1);", orderID)
 	if err != nil {
 		log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
 		return orderObj, err
@@ -1114,7 +1028,7 @@ func AdminLoadOrder(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (m
 
 	for prows.Next() {
 		var previewObj models.PreviewObject
-		if err = prows.Scan(&previewObj.ProjectID); err != nil {
+		if err = prows.Scan(&previewObj.ProjectID, &previewObj.Quantity); err != nil {
 			log.Printf("Error happened when scanning projects. Err: %s", err)
 			return orderObj, err
 		}
@@ -1148,7 +1062,7 @@ func LoadDelivery(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (mod
 				return orderObj, err
 	}
 	orderObj.ContactData = contactData
-	err = storeDB.QueryRow(ctx, "SELECT method, address, code, deliverystatus, deliveryid, trackingnumber, expected_delivery_from, expected_delivery_to FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&deliveryData.Method, &deliveryData.Address, &code, &orderObj.DeliveryStatus, &orderObj.DeliveryID, &trackingnumber, &deliveryTimeFrom, &deliveryTimeTo)
+	err = storeDB.QueryRow(ctx, "SELECT method, address, code, deliverystatus, deliveryid, trackingnumber, expected_delivery_from, expected_delivery_to, warehouses_id FROM delivery WHERE delivery_id = ($1);", deliveryID).Scan(&deliveryData.Method, &deliveryData.Address, &code, &orderObj.DeliveryStatus, &orderObj.DeliveryID, &trackingnumber, &deliveryTimeFrom, &deliveryTimeTo, &orderObj.WarehouseID)
 	if err != nil {
 		log.Printf("Error happened when retrieving delivery info from pgx table. Err: %s", err)
 		return orderObj, err
@@ -1172,23 +1086,176 @@ func LoadDelivery(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (mod
 
 
 
-// UpdateOrderStatus function performs the operation of updating the order status from pgx database with a query.
-func UpdateOrderStatus(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, statusObj models.RequestUpdateOrderStatus) (error) {
+// LoadOrderStatus function performs the operation of retrieving the order status from pgx database with a query.
+func LoadOrderStatus(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (string, error) {
+
+	var status string
+	err := storeDB.QueryRow(ctx, "SELECT status FROM orders WHERE orders_id = ($1);", orderID).Scan(&status)
+	if err != nil {
+		log.Printf("Error happened when retrieving order status from pgx table. Err: %s", err)
+		return status, err
+	}
+	return status, nil
+
+}
+
+// UpdateOrderStatus function performs the operation of moving the order from change.FromStatus to change.ToStatus in pgx database with a query.
+// The change is recorded in order_status_history, orderstatus.ErrStatusChanged is returned if the order is no longer in change.FromStatus.
+func UpdateOrderStatus(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, change models.OrderStatusChange) (error) {
 
 
-	_, err := storeDB.Exec(ctx, "UPDATE orders SET status = ($1) WHERE orders_id = ($2);",
-			statusObj.Status,
+	tag, err := storeDB.Exec(ctx, "UPDATE orders SET status = ($1), last_updated_at = ($2) WHERE orders_id = ($3) AND status = ($4);",
+			change.ToStatus,
+			time.Now(),
 			orderID,
+			change.FromStatus,
 	)
 	if err != nil {
 		log.Printf("Error happened when updating order status into pgx table. Err: %s", err)
 		return err
 	}
+	if tag.RowsAffected() == 0 {
+		return orderstatus.ErrStatusChanged
+	}
+
+	return addStatusHistory(ctx, storeDB, orderID, change)
+
+}
 
+// addStatusHistory function performs the operation of recording an order status change in pgx database with a query.
+func addStatusHistory(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, change models.OrderStatusChange) (error) {
+
+	_, err := storeDB.Exec(ctx, "INSERT INTO order_status_history (orders_id, from_status, to_status, actor, users_id, reason, created_at) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, 0), $6, $7);",
+		orderID,
+		change.FromStatus,
+		change.ToStatus,
+		change.Actor,
+		change.UsersID,
+		change.Reason,
+		time.Now(),
+	)
+	if err != nil {
+		log.Printf("Error happened when inserting order status history into pgx table. Err: %s", err)
+		return err
+	}
 	return nil
 
 }
 
+// LoadOrderTimeline function performs the operation of gathering the status changes, payments, refunds, delivery statuses
+// and complaints of the order from pgx database with queries. The events come unsorted, see orderstatus.Timeline.
+func LoadOrderTimeline(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) ([]models.TimelineEvent, error) {
+
+	var events []models.TimelineEvent
+
+	rows, err := storeDB.Query(ctx, "SELECT to_status, created_at FROM order_status_history WHERE orders_id = ($1) ORDER BY order_status_history_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving order status history from pgx table. Err: %s", err)
+		return events, err
+	}
+	for rows.Next() {
+		var status string
+		var createdAtStorage time.Time
+		if err = rows.Scan(&status, &createdAtStorage); err != nil {
+			rows.Close()
+			log.Printf("Error happened when scanning order status history. Err: %s", err)
+			return events, err
+		}
+		events = append(events, models.TimelineEvent{Category: orderstatus.StatusCategory(status), Code: status, HappenedAt: createdAtStorage.Unix()})
+	}
+	rows.Close()
+
+	rows, err = storeDB.Query(ctx, "SELECT t.amount, t.created_at, t.captured_at FROM transactions t JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id WHERE ot.orders_id = ($1) ORDER BY t.transactions_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving order transactions from pgx table. Err: %s", err)
+		return events, err
+	}
+	for rows.Next() {
+		var amount money.Money
+		var createdAtStorage time.Time
+		var capturedAtStorage *time.Time
+		if err = rows.Scan(&amount, &createdAtStorage, &capturedAtStorage); err != nil {
+			rows.Close()
+			log.Printf("Error happened when scanning order transactions. Err: %s", err)
+			return events, err
+		}
+		events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.PaymentRegistered, Amount: &amount, HappenedAt: createdAtStorage.Unix()})
+		if capturedAtStorage != nil {
+			events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.PaymentCaptured, Amount: &amount, HappenedAt: capturedAtStorage.Unix()})
+		}
+	}
+	rows.Close()
+
+	rows, err = storeDB.Query(ctx, "SELECT amount, created_at FROM refunds WHERE orders_id = ($1) AND status = ($2) ORDER BY refunds_id;", orderID, "SUCCESSFUL")
+	if err != nil {
+		log.Printf("Error happened when retrieving refunds from pgx table. Err: %s", err)
+		return events, err
+	}
+	for rows.Next() {
+		var amount money.Money
+		var createdAtStorage time.Time
+		if err = rows.Scan(&amount, &createdAtStorage); err != nil {
+			rows.Close()
+			log.Printf("Error happened when scanning refunds. Err: %s", err)
+			return events, err
+		}
+		events = append(events, models.TimelineEvent{Category: orderstatus.CategoryPayment, Code: orderstatus.RefundCompleted, Amount: &amount, HappenedAt: createdAtStorage.Unix()})
+	}
+	rows.Close()
+
+	rows, err = storeDB.Query(ctx, "SELECT ds.code, COALESCE(ds.name, ''), COALESCE(ds.city, ''), ds.happened_at FROM delivery_statuses ds JOIN orders o ON o.delivery_id = ds.delivery_id WHERE o.orders_id = ($1) ORDER BY ds.happened_at;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving delivery statuses from pgx table. Err: %s", err)
+		return events, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event models.TimelineEvent
+		var happenedAtStorage time.Time
+		if err = rows.Scan(&event.Code, &event.Description, &event.City, &happenedAtStorage); err != nil {
+			log.Printf("Error happened when scanning delivery statuses. Err: %s", err)
+			return events, err
+		}
+		event.Category = orderstatus.CategoryDelivery
+		event.HappenedAt = happenedAtStorage.Unix()
+		events = append(events, event)
+	}
+
+	complaintEvents, err := loadComplaintEvents(ctx, storeDB, orderID)
+	if err != nil {
+		return events, err
+	}
+	events = append(events, complaintEvents...)
+	return events, nil
+
+}
+
+// LoadOrderStatusHistory function performs the operation of retrieving the status changes of the order from pgx database with a query.
+func LoadOrderStatusHistory(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models.ResponseOrderStatusHistory, error) {
+
+	historyset := models.ResponseOrderStatusHistory{History: []models.OrderStatusChange{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT order_status_history_id, orders_id, COALESCE(from_status, ''), to_status, actor, COALESCE(users_id, 0), COALESCE(reason, ''), created_at FROM order_status_history WHERE orders_id = ($1) ORDER BY created_at, order_status_history_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving order status history from pgx table. Err: %s", err)
+		return historyset, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var change models.OrderStatusChange
+		var createdAtStorage time.Time
+		if err = rows.Scan(&change.HistoryID, &change.OrdersID, &change.FromStatus, &change.ToStatus, &change.Actor, &change.UsersID, &change.Reason, &createdAtStorage); err != nil {
+			log.Printf("Error happened when scanning order status history. Err: %s", err)
+			return historyset, err
+		}
+		change.CreatedAt = createdAtStorage.Unix()
+		historyset.History = append(historyset.History, change)
+	}
+	return historyset, nil
+
+}
+
 // UpdateOrderCommentary function performs the operation of updating the order commentary from pgx database with a query.
 func UpdateOrderCommentary(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, commentaryObj models.RequestUpdateOrderCommentary) (error) {
 
@@ -1244,16 +1311,17 @@ func DownloadOrderVideo(ctx context.Context, storeDB *pgxpool.Pool, orderID uint
 
 
 // UpdateTransaction function performs the operation of creatign the new transaction row for the  order in pgx database with a query.
-func UpdateTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, transaction models.ResponseTransaction, finalPrice float64, goodType string) (error) {
+func UpdateTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, transaction models.ResponseTransaction, finalPrice money.Money, goodType string) (error) {
 
 	t := time.Now()
 	var tID uint
-	err = storeDB.QueryRow(ctx, "INSERT INTO transactions (status, created_at, amount, bankorderid, paymentmethod) VALUES ($1, $2, $3, $4, $5) RETURNING transactions_id ;",
+	err = storeDB.QueryRow(ctx, "INSERT INTO transactions (status, created_at, amount, bankorderid, paymentmethod, payment_link) VALUES ($1, $2, $3, $4, $5, $6) RETURNING transactions_id ;",
 		"INPROGRESS",
 		t,
 		finalPrice,
 		transaction.OrderID,
-		"BANK CARD").Scan(&tID)
+		"BANK CARD",
+		transaction.FormURL).Scan(&tID)
 	if err != nil {
 			log.Printf("Error happened when creating transaction entry into pgx table. Err: %s", err)
 			return err
@@ -1280,84 +1348,114 @@ func UpdateTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint,
 
 }
 
-// UpdateSuccessfulTransaction function performs the operation of updating transaction and order in pgx database with a query.
+// ErrPaymentHeld is returned by UpdateSuccessfulTransaction when the bank reports the payment of an order
+// which no longer awaits it, the amount held by the bank is to be reversed.
+var ErrPaymentHeld = errors.New("payment of an order which no longer awaits it")
+
+// UpdateSuccessfulTransaction function performs the operation of updating transaction and order in pgx database with a transaction.
+// The order goes to PAID, its promocode is redeemed and the gift certificate deposit is spent together with the transaction,
+// so a payment reported again after a failure is applied in full. ErrPaymentHeld is returned for an order which no longer awaits the payment.
 func UpdateSuccessfulTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (error) {
 
 	t := time.Now()
+	tx, err := storeDB.Begin(ctx)
+	if err != nil {
+		log.Printf("Error happened when starting payment transaction. Err: %s", err)
+		return err
+	}
+	defer tx.Rollback(ctx)
+
 	var tID uint
-	err := storeDB.QueryRow(ctx, "SELECT LAST(transactions_id) FROM orders_has_transactions WHERE orders_id = ($1);", orderID).Scan(&tID)
+	var transactionStatus string
+	// the payment may be reported both by the bank callback and by the reconciliation worker
+	err = tx.QueryRow(ctx, "SELECT t.transactions_id, t.status FROM transactions t JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id WHERE ot.orders_id = ($1) ORDER BY t.transactions_id DESC LIMIT 1 FOR UPDATE OF t;", orderID).Scan(&tID, &transactionStatus)
 	if err != nil {
 		log.Printf("Error happened when retrieving transaction info from pgx table. Err: %s", err)
 		return err
 	}
-	_, err = storeDB.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE transactions_id = ($2);",
-			"SUCCESSFUL",
-			tID,
-	)
-	if err != nil {
+	if transactionStatus == "SUCCESSFUL" {
+		return nil
+	}
+	var status string
+	var giftcertificateID uint
+	var deposit money.Money
+	err = tx.QueryRow(ctx, "SELECT status, COALESCE(giftcertificates_id, 0), COALESCE(giftcertificates_deposit, 0) FROM orders WHERE orders_id = ($1) FOR UPDATE;", orderID).Scan(&status, &giftcertificateID, &deposit)
+	if err != nil {
+		log.Printf("Error happened when retrieving order info from pgx table. Err: %s", err)
+		return err
+	}
+
+	paymentStatus := "SUCCESSFUL"
+	if status != orderstatus.PaymentInProgress {
+		// e.g. the order expired before the bank reported the payment, the payment is not the one of the order
+		log.Printf("Order %d was paid after leaving PAYMENT_IN_PROGRESS", orderID)
+		paymentStatus = "UNSUCCESSFUL"
+	}
+	_, err = tx.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE transactions_id = ($2);",
+		paymentStatus,
+		tID,
+	)
+	if err != nil {
 		log.Printf("Error happened when updating transaction status into pgx table. Err: %s", err)
 		return err
 	}
-	_, err = storeDB.Exec(ctx, "UPDATE orders SET status = ($1), last_updated_at = ($2) WHERE orders_id = ($3);",
-			"PAID",
-			t,
-			orderID,
+	if status != orderstatus.PaymentInProgress {
+		if err = tx.Commit(ctx); err != nil {
+			log.Printf("Error happened when committing payment transaction. Err: %s", err)
+			return err
+		}
+		return ErrPaymentHeld
+	}
+
+	change := models.OrderStatusChange{FromStatus: orderstatus.PaymentInProgress, ToStatus: orderstatus.Paid, Actor: orderstatus.ActorSystem, Reason: "payment received"}
+	_, err = tx.Exec(ctx, "UPDATE orders SET status = ($1), last_updated_at = ($2) WHERE orders_id = ($3);",
+		change.ToStatus,
+		t,
+		orderID,
 	)
 	if err != nil {
 		log.Printf("Error happened when updating order status into pgx table. Err: %s", err)
 		return err
 	}
-	// promocodes
-	// giftcertificate
-	var promocodeID uint
-	var giftcertificateID uint
-	var deposit float64
-	var currentdeposit float64
-	var oneTime bool
-	err = storeDB.QueryRow(ctx, "SELECT promocodes_id, giftcertificates_id, giftcertificates_deposit FROM orders WHERE orders_id = ($1);", orderID).Scan(&promocodeID, &giftcertificateID, &deposit)
+	_, err = tx.Exec(ctx, "INSERT INTO order_status_history (orders_id, from_status, to_status, actor, users_id, reason, created_at) VALUES ($1, NULLIF($2, ''), $3, $4, NULLIF($5, 0), $6, $7);",
+		orderID,
+		change.FromStatus,
+		change.ToStatus,
+		change.Actor,
+		change.UsersID,
+		change.Reason,
+		t,
+	)
 	if err != nil {
-		log.Printf("Error happened when searching for promocode for order into pgx table. Err: %s", err)
+		log.Printf("Error happened when inserting order status history into pgx table. Err: %s", err)
 		return err
 	}
-	if promocodeID != 0 {
-		err = storeDB.QueryRow(ctx, "SELECT is_onetime FROM promocodes WHERE promocodes_id = ($1);", promocodeID).Scan(&oneTime)
-		if err != nil {
-			log.Printf("Error happened when searching for promocode for order into pgx table. Err: %s", err)
-			return err
-		}
-		
-		if oneTime == true {
-			_, err = storeDB.Exec(ctx, "UPDATE promocodes SET status = ($1), is_used = ($2) WHERE promocodes_id = ($3);",
-			"ONETIME_USED",
-			true,
-			promocodeID,
-			)
-			if err != nil {
-				log.Printf("Error happened when updating onetime promocode into pgx table. Err: %s", err)
-				return err
-			}
-		}
+
+	// promocodes
+	err = promotions.Redeem(ctx, tx, orderID)
+	if err != nil {
+		return err
 	}
 
+	// giftcertificate
 	if giftcertificateID != 0 && deposit != 0 {
-		err = storeDB.QueryRow(ctx, "SELECT currentdeposit FROM giftcertificates WHERE giftcertificates_id = ($1);", promocodeID).Scan(&currentdeposit)
+		// the deposit is spent, so the reservation made by OrderPayment is lifted
+		_, err = tx.Exec(ctx, "UPDATE giftcertificates SET currentdeposit = currentdeposit - ($1), status = ($2), used_at = ($3) WHERE giftcertificates_id = ($4);",
+			deposit,
+			"PAID",
+			t,
+			giftcertificateID,
+		)
 		if err != nil {
-			log.Printf("Error happened when searching for gift certificate for order into pgx table. Err: %s", err)
+			log.Printf("Error happened when using gift certificate deposit into pgx table. Err: %s", err)
 			return err
 		}
-		currentdeposit = currentdeposit - deposit
-		_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET currentdeposit = ($1) WHERE giftcertificates_id = ($2);",
-		    currentdeposit,
-			giftcertificateID,
-			)
-			if err != nil {
-				log.Printf("Error happened when using gift certificate deposit into pgx table. Err: %s", err)
-				return err
-			}
-		
 	}
 
-	
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Error happened when committing payment transaction. Err: %s", err)
+		return err
+	}
 	return nil
 
 }
@@ -1366,7 +1464,7 @@ func UpdateSuccessfulTransaction(ctx context.Context, storeDB *pgxpool.Pool, ord
 func UpdateUnSuccessfulTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (error) {
 
 	var tID uint
-	err := storeDB.QueryRow(ctx, "SELECT LAST(transactions_id) FROM orders_has_transactions WHERE orders_id = ($1);", orderID).Scan(&tID)
+	err := storeDB.QueryRow(ctx, "SELECT transactions_id FROM orders_has_transactions WHERE orders_id = ($1) ORDER BY transactions_id DESC LIMIT 1;", orderID).Scan(&tID)
 	if err != nil {
 		log.Printf("Error happened when retrieving transaction info from pgx table. Err: %s", err)
 		return err
@@ -1384,12 +1482,18 @@ func UpdateUnSuccessfulTransaction(ctx context.Context, storeDB *pgxpool.Pool, o
 
 }
 
+// ErrNoBankOrder is returned by GetBankTransactionID when no payment has been registered with the acquirer for the order.
+var ErrNoBankOrder = errors.New("no payment is registered for the order")
+
 // GetBankTransactionID function performs the operation of retrieving transaction id for order in pgx database with a query.
 func GetBankTransactionID(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (string, error) {
 
 	var tID uint
 	var bankID string 
 	err := storeDB.QueryRow(ctx, "SELECT transactions_id FROM orders_has_transactions WHERE orders_id = ($1) ORDER BY transactions_id DESC LIMIT 1;", orderID).Scan(&tID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return bankID, ErrNoBankOrder
+	}
 	if err != nil {
 		log.Printf("Error happened when retrieving transaction info from pgx table. Err: %s", err)
 		return bankID, err
@@ -1399,12 +1503,28 @@ func GetBankTransactionID(ctx context.Context, storeDB *pgxpool.Pool, orderID ui
 		log.Printf("Error happened when retrieving bank transaction info from pgx table. Err: %s", err)
 		return bankID, err
 	}
+	if bankID == "" {
+		return bankID, ErrNoBankOrder
+	}
 	
 	return bankID, nil
 
 }
 
 
+// LoadBankTransaction function performs the operation of retrieving transaction by the bank order id from pgx database with a query.
+func LoadBankTransaction(ctx context.Context, storeDB *pgxpool.Pool, bankOrderID string) (models.BankTransactionObj, error) {
+
+	var transaction models.BankTransactionObj
+	err := storeDB.QueryRow(ctx, "SELECT t.transactions_id, t.status, COALESCE(ot.orders_id, 0), COALESCE(gt.giftcertificates_id, 0) FROM transactions t LEFT JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id LEFT JOIN giftcertificates_has_transactions gt ON gt.transactions_id = t.transactions_id WHERE t.bankorderid = ($1);", bankOrderID).Scan(&transaction.TransactionsID, &transaction.Status, &transaction.OrdersID, &transaction.GiftcertificatesID)
+	if err != nil {
+		log.Printf("Error happened when retrieving bank transaction info from pgx table. Err: %s", err)
+		return transaction, err
+	}
+	return transaction, nil
+
+}
+
 // LoadPaidOrders function performs the operation of retrieving order in PAID status from pgx database with a query.
 func LoadPaidOrders(ctx context.Context, storeDB *pgxpool.Pool) ([]models.PaidOrderObj, error) {
 
@@ -1456,13 +1576,10 @@ func OrdersToPrint(ctx context.Context, storeDB *pgxpool.Pool, order models.Paid
 		mailReq := emailutils.NewMail(from, to, subject, mailType, mailData)
 		err = emailutils.SendMail(mailReq, ms)
 		if err != nil {
-			log.Printf("unable to send mail", "error", err)
+			log.Printf("Error happened when sending paid order mail. Err: %s", err)
 			return err
 		}
-		_, err = storeDB.Exec(ctx, "UPDATE orders SET status = ($1) WHERE orders_id = ($2);",
-			"IN_PRINT",
-			order.OrdersID,
-		)
+		err = UpdateOrderStatus(ctx, storeDB, order.OrdersID, models.OrderStatusChange{FromStatus: orderstatus.Paid, ToStatus: orderstatus.InPrint, Actor: orderstatus.ActorSystem})
 		if err != nil {
 				log.Printf("Error happened when updating paid order status into pgx table. Err: %s", err)
 				return err
@@ -1473,7 +1590,564 @@ func OrdersToPrint(ctx context.Context, storeDB *pgxpool.Pool, order models.Paid
 
 }
 
+// LoadPendingPayments function performs the operation of retrieving orders in PAYMENT_IN_PROGRESS status from pgx database with a query.
+func LoadPendingPayments(ctx context.Context, storeDB *pgxpool.Pool) ([]models.PendingPaymentObj, error) {
+
+	var orders []models.PendingPaymentObj
+
+	rows, err := storeDB.Query(ctx, "SELECT orders_id, last_updated_at FROM orders WHERE status = ($1);", "PAYMENT_IN_PROGRESS")
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		log.Printf("Error happened when retrieving pending payments info from pgx table. Err: %s", err)
+		return orders, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pendingOrder models.PendingPaymentObj
+		if err = rows.Scan(&pendingOrder.OrdersID, &pendingOrder.LastEditedAt); err != nil {
+			log.Printf("Error happened when scanning pending payments. Err: %s", err)
+			return orders, err
+		}
+		orders = append(orders, pendingOrder)
+	}
+	return orders, nil
+
+}
+
+// ExpireOrderPayment function performs the operation of cancelling an order left unpaid in pgx database with a query.
+// The projects go back to the cart of the user and the gift certificate reserved by OrderPayment is released.
+func ExpireOrderPayment(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (error) {
+
+	t := time.Now()
+	var userID uint
+	var deliveryID uint
+	var giftcertificateID uint
+
+	// the order could have been paid or cancelled meanwhile
+	err := storeDB.QueryRow(ctx, "UPDATE orders SET status = ($1), last_updated_at = ($2) WHERE orders_id = ($3) AND status = ($4) RETURNING users_id, COALESCE(delivery_id, 0), COALESCE(giftcertificates_id, 0);",
+		"CANCELLED",
+		t,
+		orderID,
+		"PAYMENT_IN_PROGRESS",
+	).Scan(&userID, &deliveryID, &giftcertificateID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error happened when expiring order into pgx table. Err: %s", err)
+		return err
+	}
+	err = addStatusHistory(ctx, storeDB, orderID, models.OrderStatusChange{FromStatus: orderstatus.PaymentInProgress, ToStatus: orderstatus.Cancelled, Actor: orderstatus.ActorSystem, Reason: "payment expired"})
+	if err != nil {
+		return err
+	}
+
+	_, err = storeDB.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE status = ($2) AND transactions_id IN (SELECT transactions_id FROM orders_has_transactions WHERE orders_id = ($3));",
+		"UNSUCCESSFUL",
+		"INPROGRESS",
+		orderID,
+	)
+	if err != nil {
+		log.Printf("Error happened when expiring transactions into pgx table. Err: %s", err)
+		return err
+	}
+
+	_, err = storeDB.Exec(ctx, "UPDATE delivery SET status = ($1) WHERE delivery_id = ($2);",
+		"CANCELLED",
+		deliveryID,
+	)
+	if err != nil {
+		log.Printf("Error happened when cancelling delivery into pgx table. Err: %s", err)
+		return err
+	}
+
+	if giftcertificateID != 0 {
+		// the deposit is only deducted on successful payment, so lifting the reservation is enough
+		_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2) AND status = ($3);",
+			"PAID",
+			giftcertificateID,
+			"RESERVED",
+		)
+		if err != nil {
+			log.Printf("Error happened when releasing gift certificate into pgx table. Err: %s", err)
+			return err
+		}
+	}
+	err = promotions.Release(ctx, storeDB, orderID)
+	if err != nil {
+		return err
+	}
+
+	err = restoreCart(ctx, storeDB, userID, orderID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// LoadRefundableTransaction function performs the operation of retrieving the paid transaction of the order with its refunded amount from pgx database with a query.
+func LoadRefundableTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models.RefundableTransactionObj, error) {
+
+	var transaction models.RefundableTransactionObj
+	// pending refunds are counted as well, the amount is checked again by CreateRefund under the lock of the transaction
+	err := storeDB.QueryRow(ctx, "SELECT t.transactions_id, t.bankorderid, t.amount, COALESCE((SELECT SUM(r.amount) FROM refunds r WHERE r.transactions_id = t.transactions_id AND r.status <> ($2)), 0) FROM transactions t JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id WHERE ot.orders_id = ($1) AND t.status = ($3) ORDER BY t.transactions_id DESC LIMIT 1;",
+		orderID,
+		"FAILED",
+		"SUCCESSFUL",
+	).Scan(&transaction.TransactionsID, &transaction.BankOrderID, &transaction.Amount, &transaction.RefundedAmount)
+	if err != nil {
+		log.Printf("Error happened when retrieving refundable transaction from pgx table. Err: %s", err)
+		return transaction, err
+	}
+	return transaction, nil
+
+}
+
+// ErrRefundExceedsPayment is returned by CreateRefund when the refund is larger than the part of the payment
+// not yet refunded or being refunded.
+var ErrRefundExceedsPayment = errors.New("refund exceeds the paid amount")
+
+// CreateRefund function performs the operation of recording a pending refund of the order in pgx database with a transaction.
+// The paid transaction is locked while its refunds are summed, so two refunds issued at once can not exceed the payment.
+func CreateRefund(ctx context.Context, storeDB *pgxpool.Pool, orderID uint, transactionID uint, refundObj models.RequestRefund) (uint, error) {
+
+	var refundID uint
+	tx, err := storeDB.Begin(ctx)
+	if err != nil {
+		log.Printf("Error happened when starting refund transaction. Err: %s", err)
+		return refundID, err
+	}
+	defer tx.Rollback(ctx)
+
+	var amount money.Money
+	err = tx.QueryRow(ctx, "SELECT amount FROM transactions WHERE transactions_id = ($1) AND status = ($2) FOR UPDATE;",
+		transactionID,
+		"SUCCESSFUL",
+	).Scan(&amount)
+	if err != nil {
+		log.Printf("Error happened when locking paid transaction in pgx table. Err: %s", err)
+		return refundID, err
+	}
+	var refunded money.Money
+	err = tx.QueryRow(ctx, "SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE transactions_id = ($1) AND status <> ($2);",
+		transactionID,
+		"FAILED",
+	).Scan(&refunded)
+	if err != nil {
+		log.Printf("Error happened when retrieving refunded amount from pgx table. Err: %s", err)
+		return refundID, err
+	}
+	if refunded+refundObj.Amount > amount {
+		return refundID, ErrRefundExceedsPayment
+	}
+
+	err = tx.QueryRow(ctx, "INSERT INTO refunds (orders_id, transactions_id, amount, reason, status, created_at) VALUES ($1, $2, $3, $4, $5, $6) RETURNING refunds_id;",
+		orderID,
+		transactionID,
+		refundObj.Amount,
+		refundObj.Reason,
+		"PENDING",
+		time.Now(),
+	).Scan(&refundID)
+	if err != nil {
+		log.Printf("Error happened when creating refund entry into pgx table. Err: %s", err)
+		return refundID, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		log.Printf("Error happened when committing refund transaction. Err: %s", err)
+		return refundID, err
+	}
+	return refundID, nil
+
+}
+
+// CompleteRefund function performs the operation of updating refund status in pgx database with a query.
+// Once the whole payment is refunded the order is marked as refunded, or cancelled when its payment was not captured yet,
+// and its promocode and gift certificate deposit are restored. An order in any other status is left as it is.
+func CompleteRefund(ctx context.Context, storeDB *pgxpool.Pool, refundID uint, succeeded bool) (error) {
+
+	t := time.Now()
+	var orderID uint
+	var transactionID uint
+	var reason string
+	status := "FAILED"
+	if succeeded {
+		status = "SUCCESSFUL"
+	}
+	err := storeDB.QueryRow(ctx, "UPDATE refunds SET status = ($1), completed_at = ($2) WHERE refunds_id = ($3) AND status = ($4) RETURNING orders_id, transactions_id, COALESCE(reason, '');",
+		status,
+		t,
+		refundID,
+		"PENDING",
+	).Scan(&orderID, &transactionID, &reason)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !succeeded) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error happened when updating refund status into pgx table. Err: %s", err)
+		return err
+	}
+
+	var amount money.Money
+	var refunded money.Money
+	err = storeDB.QueryRow(ctx, "SELECT t.amount, COALESCE((SELECT SUM(r.amount) FROM refunds r WHERE r.transactions_id = t.transactions_id AND r.status = ($2)), 0) FROM transactions t WHERE t.transactions_id = ($1);",
+		transactionID,
+		"SUCCESSFUL",
+	).Scan(&amount, &refunded)
+	if err != nil {
+		log.Printf("Error happened when retrieving refunded amount from pgx table. Err: %s", err)
+		return err
+	}
+	if refunded < amount {
+		return nil
+	}
+
+	_, err = storeDB.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE transactions_id = ($2);",
+		"REFUNDED",
+		transactionID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating refunded transaction status into pgx table. Err: %s", err)
+		return err
+	}
+	fromStatus, err := LoadOrderStatus(ctx, storeDB, orderID)
+	if err != nil {
+		return err
+	}
+	toStatus := orderstatus.Refunded
+	if !orderstatus.CanTransition(fromStatus, toStatus) {
+		toStatus = orderstatus.Cancelled
+	}
+	if !orderstatus.CanTransition(fromStatus, toStatus) {
+		log.Printf("Refunded order %d can not leave the status %s", orderID, fromStatus)
+		return orderstatus.ErrIllegalTransition
+	}
+	err = UpdateOrderStatus(ctx, storeDB, orderID, models.OrderStatusChange{
+		FromStatus: fromStatus,
+		ToStatus:   toStatus,
+		Actor:      orderstatus.ActorAdmin,
+		Reason:     reason,
+	})
+	if err != nil {
+		return err
+	}
+
+	var giftcertificateID uint
+	var deposit money.Money
+	err = storeDB.QueryRow(ctx, "SELECT COALESCE(giftcertificates_id, 0), COALESCE(giftcertificates_deposit, 0) FROM orders WHERE orders_id = ($1);", orderID).Scan(&giftcertificateID, &deposit)
+	if err != nil {
+		log.Printf("Error happened when searching for gift certificate for order into pgx table. Err: %s", err)
+		return err
+	}
+	err = promotions.Release(ctx, storeDB, orderID)
+	if err != nil {
+		return err
+	}
+	if giftcertificateID != 0 && deposit != 0 {
+		_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET currentdeposit = currentdeposit + ($1) WHERE giftcertificates_id = ($2);",
+			deposit,
+			giftcertificateID,
+		)
+		if err != nil {
+			log.Printf("Error happened when restoring gift certificate deposit into pgx table. Err: %s", err)
+			return err
+		}
+	}
+
+	return nil
+
+}
+
+// LoadRefunds function performs the operation of retrieving refunds of the order from pgx database with a query.
+func LoadRefunds(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models.ResponseRefunds, error) {
+
+	refundset := models.ResponseRefunds{Refunds: []models.Refund{}}
 
+	rows, err := storeDB.Query(ctx, "SELECT refunds_id, orders_id, transactions_id, amount, COALESCE(reason, ''), status, created_at FROM refunds WHERE orders_id = ($1) ORDER BY refunds_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving refunds from pgx table. Err: %s", err)
+		return refundset, err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
+		var refund models.Refund
+		var createdAtStorage time.Time
+		if err = rows.Scan(&refund.RefundsID, &refund.OrdersID, &refund.TransactionsID, &refund.Amount, &refund.Reason, &refund.Status, &createdAtStorage); err != nil {
+			log.Printf("Error happened when scanning refunds. Err: %s", err)
+			return refundset, err
+		}
+		refund.CreatedAt = createdAtStorage.Unix()
+		refundset.Refunds = append(refundset.Refunds, refund)
+	}
+	return refundset, nil
+
+}
+
+// ErrNoPaidTransaction is returned by LoadPaidTransaction when the order has no successful transaction, e.g. marked paid by an admin.
+var ErrNoPaidTransaction = errors.New("no paid transaction for the order")
+
+// LoadPaidTransaction function performs the operation of retrieving the successful transaction of the order from pgx database with a query.
+func LoadPaidTransaction(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models.PaidTransactionObj, error) {
+
+	var transaction models.PaidTransactionObj
+	err := storeDB.QueryRow(ctx, "SELECT t.transactions_id, t.bankorderid, t.amount, COALESCE(t.bankstatus, '') FROM transactions t JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id WHERE ot.orders_id = ($1) AND t.status = ($2) ORDER BY t.transactions_id DESC LIMIT 1;",
+		orderID,
+		"SUCCESSFUL",
+	).Scan(&transaction.TransactionsID, &transaction.BankOrderID, &transaction.Amount, &transaction.BankStatus)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return transaction, ErrNoPaidTransaction
+	}
+	if err != nil {
+		log.Printf("Error happened when retrieving paid transaction from pgx table. Err: %s", err)
+		return transaction, err
+	}
+	return transaction, nil
+
+}
+
+// UpdateCapturedTransaction function performs the operation of recording the capture result on the transaction in pgx database with a query.
+// An empty captureError means the held amount was charged.
+func UpdateCapturedTransaction(ctx context.Context, storeDB *pgxpool.Pool, transactionID uint, captureError string) (error) {
+
+	var err error
+	if captureError == "" {
+		_, err = storeDB.Exec(ctx, "UPDATE transactions SET bankstatus = ($1), captured_at = ($2), capture_error = NULL WHERE transactions_id = ($3);",
+			"CAPTURED",
+			time.Now(),
+			transactionID,
+		)
+	} else {
+		_, err = storeDB.Exec(ctx, "UPDATE transactions SET bankstatus = ($1), capture_error = ($2) WHERE transactions_id = ($3);",
+			"CAPTURE_FAILED",
+			captureError,
+			transactionID,
+		)
+	}
+	if err != nil {
+		log.Printf("Error happened when updating transaction capture status into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// LoadCaptureFailures function performs the operation of retrieving paid orders whose payment could not be captured from pgx database with a query.
+func LoadCaptureFailures(ctx context.Context, storeDB *pgxpool.Pool) (models.ResponseCaptureFailures, error) {
+
+	failures := models.ResponseCaptureFailures{Orders: []models.CaptureFailure{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT o.orders_id, t.transactions_id, t.amount, COALESCE(t.capture_error, ''), o.last_updated_at FROM orders o JOIN orders_has_transactions ot ON ot.orders_id = o.orders_id JOIN transactions t ON t.transactions_id = ot.transactions_id WHERE o.status = ($1) AND t.status = ($2) AND t.bankstatus = ($3) ORDER BY o.orders_id;",
+		"PAID",
+		"SUCCESSFUL",
+		"CAPTURE_FAILED",
+	)
+	if err != nil {
+		log.Printf("Error happened when retrieving capture failures from pgx table. Err: %s", err)
+		return failures, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var failure models.CaptureFailure
+		var updateTimeStorage time.Time
+		if err = rows.Scan(&failure.OrdersID, &failure.TransactionsID, &failure.Amount, &failure.CaptureError, &updateTimeStorage); err != nil {
+			log.Printf("Error happened when scanning capture failures. Err: %s", err)
+			return failures, err
+		}
+		failure.LastEditedAt = updateTimeStorage.Unix()
+		failures.Orders = append(failures.Orders, failure)
+	}
+	return failures, nil
+
+}
 
+// HoldTransaction function performs the operation of recording that the bank holds the amount of the transaction for an order
+// which does not take it in pgx database with a query. It reports false when the amount has been reversed already.
+func HoldTransaction(ctx context.Context, storeDB *pgxpool.Pool, transactionID uint) (bool, error) {
 
+	tag, err := storeDB.Exec(ctx, "UPDATE transactions SET bankstatus = ($1) WHERE transactions_id = ($2) AND bankstatus IS DISTINCT FROM ($3);",
+		"HELD",
+		transactionID,
+		"REVERSED",
+	)
+	if err != nil {
+		log.Printf("Error happened when holding transaction into pgx table. Err: %s", err)
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+
+}
+
+// UpdateReversedTransaction function performs the operation of recording the reverse result on the held transaction in pgx database with a query.
+// An empty reverseError means the held amount was released.
+func UpdateReversedTransaction(ctx context.Context, storeDB *pgxpool.Pool, transactionID uint, reverseError string) (error) {
+
+	var err error
+	if reverseError == "" {
+		_, err = storeDB.Exec(ctx, "UPDATE transactions SET bankstatus = ($1), reverse_error = NULL WHERE transactions_id = ($2);",
+			"REVERSED",
+			transactionID,
+		)
+	} else {
+		_, err = storeDB.Exec(ctx, "UPDATE transactions SET reverse_error = ($1) WHERE transactions_id = ($2);",
+			reverseError,
+			transactionID,
+		)
+	}
+	if err != nil {
+		log.Printf("Error happened when updating transaction reverse status into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// LoadHeldPayments function performs the operation of retrieving the payments the bank holds for orders which do not take them from pgx database with a query.
+func LoadHeldPayments(ctx context.Context, storeDB *pgxpool.Pool) (models.ResponseHeldPayments, error) {
+
+	payments := models.ResponseHeldPayments{Payments: []models.HeldPayment{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT o.orders_id, t.transactions_id, t.bankorderid, t.amount, o.status, COALESCE(t.reverse_error, ''), t.created_at FROM transactions t JOIN orders_has_transactions ot ON ot.transactions_id = t.transactions_id JOIN orders o ON o.orders_id = ot.orders_id WHERE t.bankstatus = ($1) ORDER BY t.transactions_id;",
+		"HELD",
+	)
+	if err != nil {
+		log.Printf("Error happened when retrieving held payments from pgx table. Err: %s", err)
+		return payments, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var payment models.HeldPayment
+		var createTimeStorage time.Time
+		if err = rows.Scan(&payment.OrdersID, &payment.TransactionsID, &payment.BankOrderID, &payment.Amount, &payment.OrderStatus, &payment.ReverseError, &createTimeStorage); err != nil {
+			log.Printf("Error happened when scanning held payments. Err: %s", err)
+			return payments, err
+		}
+		payment.CreatedAt = createTimeStorage.Unix()
+		payments.Payments = append(payments.Payments, payment)
+	}
+	return payments, nil
+
+}
+
+// CreateReceipt function performs the operation of storing the fiscal receipt of the payment registered under bankOrderID in pgx database with a query.
+// A receipt with a refundID is the receipt of that refund.
+func CreateReceipt(ctx context.Context, storeDB *pgxpool.Pool, bankOrderID string, refundID uint, receipt models.Receipt) (error) {
+
+	var transactionID uint
+	err := storeDB.QueryRow(ctx, "SELECT transactions_id FROM transactions WHERE bankorderid = ($1) ORDER BY transactions_id DESC LIMIT 1;", bankOrderID).Scan(&transactionID)
+	if err != nil {
+		log.Printf("Error happened when retrieving transaction for the receipt from pgx table. Err: %s", err)
+		return err
+	}
+	receiptType := "PAYMENT"
+	var refundsID *uint
+	if refundID != 0 {
+		receiptType = "REFUND"
+		refundsID = &refundID
+	}
+	var amount money.Money
+	for _, item := range receipt.Items {
+		amount += item.Amount
+	}
+	_, err = storeDB.Exec(ctx, "INSERT INTO receipts (transactions_id, refunds_id, type, email, amount, content, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+		transactionID,
+		refundsID,
+		receiptType,
+		receipt.Email,
+		amount,
+		receipt,
+		time.Now(),
+	)
+	if err != nil {
+		log.Printf("Error happened when creating receipt entry into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// LoadPaymentReceipt function performs the operation of retrieving the receipt of the payment registered under bankOrderID from pgx database with a query.
+func LoadPaymentReceipt(ctx context.Context, storeDB *pgxpool.Pool, bankOrderID string) (models.Receipt, error) {
+
+	var receipt models.Receipt
+	err := storeDB.QueryRow(ctx, "SELECT r.content FROM receipts r JOIN transactions t ON t.transactions_id = r.transactions_id WHERE t.bankorderid = ($1) AND r.type = ($2) ORDER BY r.receipts_id DESC LIMIT 1;",
+		bankOrderID,
+		"PAYMENT",
+	).Scan(&receipt)
+	if err != nil {
+		log.Printf("Error happened when retrieving payment receipt from pgx table. Err: %s", err)
+		return receipt, err
+	}
+	return receipt, nil
+
+}
+
+// LoadReceipts function performs the operation of retrieving the receipts of the order payments and refunds from pgx database with a query.
+func LoadReceipts(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) (models.ResponseReceipts, error) {
+
+	receiptset := models.ResponseReceipts{Receipts: []models.StoredReceipt{}}
+
+	rows, err := storeDB.Query(ctx, "SELECT r.receipts_id, r.transactions_id, COALESCE(r.refunds_id, 0), r.type, r.amount, r.content, r.created_at, r.sent_at FROM receipts r JOIN orders_has_transactions ot ON ot.transactions_id = r.transactions_id WHERE ot.orders_id = ($1) ORDER BY r.receipts_id;", orderID)
+	if err != nil {
+		log.Printf("Error happened when retrieving receipts from pgx table. Err: %s", err)
+		return receiptset, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var receipt models.StoredReceipt
+		var createdAtStorage time.Time
+		var sentAtStorage *time.Time
+		if err = rows.Scan(&receipt.ReceiptsID, &receipt.TransactionsID, &receipt.RefundsID, &receipt.Type, &receipt.Amount, &receipt.Receipt, &createdAtStorage, &sentAtStorage); err != nil {
+			log.Printf("Error happened when scanning receipts. Err: %s", err)
+			return receiptset, err
+		}
+		receipt.CreatedAt = createdAtStorage.Unix()
+		if sentAtStorage != nil {
+			sentAt := sentAtStorage.Unix()
+			receipt.SentAt = &sentAt
+		}
+		receiptset.Receipts = append(receiptset.Receipts, receipt)
+	}
+	return receiptset, nil
+
+}
+
+// LoadReceipt function performs the operation of retrieving a single receipt from pgx database with a query.
+func LoadReceipt(ctx context.Context, storeDB *pgxpool.Pool, receiptID uint) (models.StoredReceipt, error) {
+
+	var receipt models.StoredReceipt
+	var createdAtStorage time.Time
+	var sentAtStorage *time.Time
+	err := storeDB.QueryRow(ctx, "SELECT receipts_id, transactions_id, COALESCE(refunds_id, 0), type, amount, content, created_at, sent_at FROM receipts WHERE receipts_id = ($1);", receiptID).Scan(&receipt.ReceiptsID, &receipt.TransactionsID, &receipt.RefundsID, &receipt.Type, &receipt.Amount, &receipt.Receipt, &createdAtStorage, &sentAtStorage)
+	if err != nil {
+		log.Printf("Error happened when retrieving receipt from pgx table. Err: %s", err)
+		return receipt, err
+	}
+	receipt.CreatedAt = createdAtStorage.Unix()
+	if sentAtStorage != nil {
+		sentAt := sentAtStorage.Unix()
+		receipt.SentAt = &sentAt
+	}
+	return receipt, nil
+
+}
+
+// MarkReceiptSent function performs the operation of recording that the receipt was mailed to the customer in pgx database with a query.
+func MarkReceiptSent(ctx context.Context, storeDB *pgxpool.Pool, receiptID uint) (error) {
+
+	_, err := storeDB.Exec(ctx, "UPDATE receipts SET sent_at = ($1) WHERE receipts_id = ($2);",
+		time.Now(),
+		receiptID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating receipt sent time into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
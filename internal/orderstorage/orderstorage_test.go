@@ -0,0 +1,204 @@
+package orderstorage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/dbtest"
+	"github.com/SiberianMonster/memoryprint/internal/initstorage"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migratedDB returns a connection to a fresh schema with all migrations applied.
+func migratedDB(t *testing.T) *pgxpool.Pool {
+	db := dbtest.Connect(t)
+	if _, err := initstorage.MigrateUp(context.Background(), db); err != nil {
+		t.Fatalf("an error '%s' was not expected when migrating the test schema", err)
+	}
+	return db
+}
+
+// placeOrder checks out a photobook priced at 1500.00 from the cart of a new user, which leaves the order in PAYMENT_IN_PROGRESS.
+func placeOrder(t *testing.T, db *pgxpool.Pool) (uint, money.Money) {
+	ctx := context.Background()
+	var userID uint
+	err := db.QueryRow(ctx, "INSERT INTO users (username, password, email, category, isverified, subscription, status, last_edited_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8) RETURNING users_id;",
+		"customer", "hash", "customer@example.com", "CUSTOMER", "true", false, "ACTIVE", time.Now(),
+	).Scan(&userID)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when adding a user", err)
+	}
+	price := models.Price{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", BasePrice: money.FromRoubles(1500), IncludedPages: 20}
+	if _, err = pricing.CreatePriceList(ctx, db, models.PriceList{Name: "Test", Prices: []models.Price{price}}); err != nil {
+		t.Fatalf("an error '%s' was not expected when adding prices", err)
+	}
+	projectID, err := projectstorage.CreateProject(ctx, db, userID, models.NewBlankProjectObj{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", CountPages: 20})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a project", err)
+	}
+	item := models.CartItem{ProjectID: projectID, Quantity: 1}
+	if _, err = AddCartItem(ctx, db, userID, item); err != nil {
+		t.Fatalf("an error '%s' was not expected when adding to the cart", err)
+	}
+	finalPrice, orderID, err := OrderPayment(ctx, db, models.RequestOrderPayment{Cart: []models.CartItem{item}}, userID, money.Zero, 0)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when paying for the order", err)
+	}
+	return orderID, finalPrice
+}
+
+func TestOrderPayment(t *testing.T) {
+
+	db := migratedDB(t)
+	ctx := context.Background()
+	orderID, finalPrice := placeOrder(t, db)
+	if finalPrice != money.FromRoubles(1500) {
+		t.Errorf("expected the order to cost 1500.00, got %s", finalPrice)
+	}
+	order, err := RetrieveSingleOrder(ctx, db, orderID)
+	if err != nil || order.Status != orderstatus.PaymentInProgress {
+		t.Fatalf("expected the order to wait for the payment, got %s, %v", order.Status, err)
+	}
+	var total money.Money
+	for _, item := range order.Items {
+		total += item.Amount - item.Discount
+	}
+	if total != finalPrice {
+		t.Errorf("expected the line items to add up to the order price, got %v", order.Items)
+	}
+}
+
+// payOrder records the payment of the order and sends it to print, after which it can be refunded.
+func payOrder(t *testing.T, db *pgxpool.Pool, orderID uint, finalPrice money.Money) models.RefundableTransactionObj {
+	ctx := context.Background()
+	if err := UpdateTransaction(ctx, db, orderID, models.ResponseTransaction{OrderID: "bank-order", FormURL: "http://localhost/pay"}, finalPrice, "PHOTOBOOK"); err != nil {
+		t.Fatalf("an error '%s' was not expected when registering the payment", err)
+	}
+	if err := UpdateSuccessfulTransaction(ctx, db, orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when confirming the payment", err)
+	}
+	if err := UpdateOrderStatus(ctx, db, orderID, models.OrderStatusChange{FromStatus: orderstatus.Paid, ToStatus: orderstatus.InPrint, Actor: orderstatus.ActorSystem}); err != nil {
+		t.Fatalf("an error '%s' was not expected when sending the order to print", err)
+	}
+	paid, err := LoadRefundableTransaction(ctx, db, orderID)
+	if err != nil || paid.Amount != finalPrice {
+		t.Fatalf("expected the paid transaction to be refundable, got %s, %v", paid.Amount, err)
+	}
+	return paid
+}
+
+func TestUpdateSuccessfulTransactionRetried(t *testing.T) {
+
+	db := migratedDB(t)
+	ctx := context.Background()
+	orderID, finalPrice := placeOrder(t, db)
+	if err := UpdateTransaction(ctx, db, orderID, models.ResponseTransaction{OrderID: "bank-order", FormURL: "http://localhost/pay"}, finalPrice, "PHOTOBOOK"); err != nil {
+		t.Fatalf("an error '%s' was not expected when registering the payment", err)
+	}
+
+	tests := []struct {
+		name    string
+		failing bool
+		status  string
+	}{
+		// the promocodes can not be redeemed while their table is away, so the payment is not recorded either
+		{"redemption failed", true, orderstatus.PaymentInProgress},
+		{"payment reported again", false, orderstatus.Paid},
+		{"repeated report", false, orderstatus.Paid},
+	}
+	for _, tt := range tests {
+		if tt.failing {
+			db.Exec(ctx, "ALTER TABLE promotion_redemptions RENAME TO promotion_redemptions_away;")
+		}
+		err := UpdateSuccessfulTransaction(ctx, db, orderID)
+		if tt.failing {
+			db.Exec(ctx, "ALTER TABLE promotion_redemptions_away RENAME TO promotion_redemptions;")
+		}
+		if (err != nil) != tt.failing {
+			t.Fatalf("%s: expected an error %t, got %v", tt.name, tt.failing, err)
+		}
+		if status, _ := LoadOrderStatus(ctx, db, orderID); status != tt.status {
+			t.Fatalf("%s: expected the order to be %s, got %s", tt.name, tt.status, status)
+		}
+	}
+	history, _ := LoadOrderStatusHistory(ctx, db, orderID)
+	var paid int
+	for _, change := range history.History {
+		if change.ToStatus == orderstatus.Paid {
+			paid++
+		}
+	}
+	if paid != 1 {
+		t.Errorf("expected the payment to be recorded in the history once, got %v", history.History)
+	}
+}
+
+func TestCreateRefund(t *testing.T) {
+
+	db := migratedDB(t)
+	ctx := context.Background()
+	orderID, finalPrice := placeOrder(t, db)
+	paid := payOrder(t, db, orderID, finalPrice)
+
+	tests := []struct {
+		name   string
+		amount money.Money
+		err    error
+	}{
+		{"part of the payment", money.FromRoubles(500), nil},
+		{"more than the rest", money.FromRoubles(1001), ErrRefundExceedsPayment},
+		{"the rest", money.FromRoubles(1000), nil},
+		{"anything after a full refund", money.FromRoubles(1), ErrRefundExceedsPayment},
+	}
+	for _, tt := range tests {
+		if _, err := CreateRefund(ctx, db, orderID, paid.TransactionsID, models.RequestRefund{Amount: tt.amount, Reason: "misprint"}); !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestCompleteRefund(t *testing.T) {
+
+	db := migratedDB(t)
+	ctx := context.Background()
+	orderID, finalPrice := placeOrder(t, db)
+	paid := payOrder(t, db, orderID, finalPrice)
+
+	tests := []struct {
+		name      string
+		amount    money.Money
+		succeeded bool
+		status    string
+	}{
+		{"failed refund", money.FromRoubles(1500), false, orderstatus.InPrint},
+		{"partial refund", money.FromRoubles(500), true, orderstatus.InPrint},
+		{"refund of the rest", money.FromRoubles(1000), true, orderstatus.Refunded},
+	}
+	for _, tt := range tests {
+		refundID, err := CreateRefund(ctx, db, orderID, paid.TransactionsID, models.RequestRefund{Amount: tt.amount, Reason: "misprint"})
+		if err != nil {
+			t.Fatalf("%s: an error '%s' was not expected when recording the refund", tt.name, err)
+		}
+		if err = CompleteRefund(ctx, db, refundID, tt.succeeded); err != nil {
+			t.Fatalf("%s: an error '%s' was not expected when completing the refund", tt.name, err)
+		}
+		order, _ := RetrieveSingleOrder(ctx, db, orderID)
+		if order.Status != tt.status {
+			t.Errorf("%s: expected the order to be %s, got %s", tt.name, tt.status, order.Status)
+		}
+	}
+	history, _ := LoadOrderStatusHistory(ctx, db, orderID)
+	if len(history.History) == 0 {
+		t.Fatal("expected the status changes to be recorded in the history")
+	}
+	if last := history.History[len(history.History)-1]; last.FromStatus != orderstatus.InPrint || last.ToStatus != orderstatus.Refunded || last.Actor != orderstatus.ActorAdmin {
+		t.Errorf("expected the refund to be recorded in the status history, got %v", last)
+	}
+}
@@ -0,0 +1,298 @@
+package orderstorage
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OrderStore is the storage of orders and their transactions used by the handlers.
+type OrderStore interface {
+	CheckProjectPublished(ctx context.Context, projectID uint) bool
+	CheckCountProjects(ctx context.Context, userID uint, countPassed uint) bool
+	CheckProject(ctx context.Context, projectID uint) bool
+	CheckOrder(ctx context.Context, orderID uint) bool
+	LoadCart(ctx context.Context, userID uint) (models.ResponseCart, error)
+	CreateOrder(ctx context.Context, userID uint, order models.NewOrder) (uint, error)
+	AddCartItem(ctx context.Context, userID uint, item models.CartItem) (uint, error)
+	UpdateCartItem(ctx context.Context, userID uint, item models.CartItem) error
+	DeleteCartItem(ctx context.Context, userID uint, projectID uint) error
+	OrderPayment(ctx context.Context, orderObj models.RequestOrderPayment, userID uint, deliveryPrice money.Money, warehouseID uint) (money.Money, uint, error)
+	FindCheckout(ctx context.Context, userID uint, idempotencyKey string) (uint, string, error)
+	CancelPayment(ctx context.Context, orderID uint, userID uint) error
+	RetrieveOrders(ctx context.Context, userID uint, isActive bool, offset uint, limit uint) (models.ResponseOrders, error)
+	RetrieveSingleOrder(ctx context.Context, orderID uint) (models.ResponseOrder, error)
+	RetrieveAdminOrders(ctx context.Context, userID uint, orderID uint, isActive bool, createdAfter uint, createdBefore uint, email string, status string, offset uint, limit uint) (models.ResponseAdminOrders, error)
+	LoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error)
+	AdminLoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error)
+	LoadDelivery(ctx context.Context, orderID uint) (models.ResponseDeliveryInfo, error)
+	LoadOrderStatus(ctx context.Context, orderID uint) (string, error)
+	UpdateOrderStatus(ctx context.Context, orderID uint, change models.OrderStatusChange) error
+	LoadOrderStatusHistory(ctx context.Context, orderID uint) (models.ResponseOrderStatusHistory, error)
+	LoadOrderTimeline(ctx context.Context, orderID uint) ([]models.TimelineEvent, error)
+	UpdateOrderCommentary(ctx context.Context, orderID uint, commentaryObj models.RequestUpdateOrderCommentary) error
+	UploadOrderVideo(ctx context.Context, orderID uint, videoObj models.OrderVideo) error
+	DownloadOrderVideo(ctx context.Context, orderID uint) (models.OrderVideo, error)
+	UpdateTransaction(ctx context.Context, orderID uint, transaction models.ResponseTransaction, finalPrice money.Money, goodType string) error
+	UpdateSuccessfulTransaction(ctx context.Context, orderID uint) error
+	UpdateUnSuccessfulTransaction(ctx context.Context, orderID uint) error
+	GetBankTransactionID(ctx context.Context, orderID uint) (string, error)
+	LoadBankTransaction(ctx context.Context, bankOrderID string) (models.BankTransactionObj, error)
+	LoadPaidOrders(ctx context.Context) ([]models.PaidOrderObj, error)
+	OrdersToPrint(ctx context.Context, order models.PaidOrderObj) error
+	LoadPendingPayments(ctx context.Context) ([]models.PendingPaymentObj, error)
+	ExpireOrderPayment(ctx context.Context, orderID uint) error
+	LoadRefundableTransaction(ctx context.Context, orderID uint) (models.RefundableTransactionObj, error)
+	CreateRefund(ctx context.Context, orderID uint, transactionID uint, refundObj models.RequestRefund) (uint, error)
+	CompleteRefund(ctx context.Context, refundID uint, succeeded bool) error
+	LoadRefunds(ctx context.Context, orderID uint) (models.ResponseRefunds, error)
+	LoadPaidTransaction(ctx context.Context, orderID uint) (models.PaidTransactionObj, error)
+	UpdateCapturedTransaction(ctx context.Context, transactionID uint, captureError string) error
+	LoadCaptureFailures(ctx context.Context) (models.ResponseCaptureFailures, error)
+	HoldTransaction(ctx context.Context, transactionID uint) (bool, error)
+	UpdateReversedTransaction(ctx context.Context, transactionID uint, reverseError string) error
+	LoadHeldPayments(ctx context.Context) (models.ResponseHeldPayments, error)
+	CreateReceipt(ctx context.Context, bankOrderID string, refundID uint, receipt models.Receipt) error
+	LoadPaymentReceipt(ctx context.Context, bankOrderID string) (models.Receipt, error)
+	LoadReceipts(ctx context.Context, orderID uint) (models.ResponseReceipts, error)
+	LoadReceipt(ctx context.Context, receiptID uint) (models.StoredReceipt, error)
+	MarkReceiptSent(ctx context.Context, receiptID uint) error
+	CreateComplaint(ctx context.Context, orderID uint, userID uint, complaintObj models.RequestComplaint) (uint, error)
+	LoadComplaint(ctx context.Context, complaintID uint) (models.Complaint, error)
+	LoadComplaints(ctx context.Context, orderID uint, status string) (models.ResponseComplaints, error)
+	UpdateComplaintStatus(ctx context.Context, complaintID uint, fromStatus string, toStatus string) error
+	ResolveComplaint(ctx context.Context, complaint models.Complaint) error
+	CreateReprintOrder(ctx context.Context, orderID uint, change models.OrderStatusChange) (uint, error)
+}
+
+// PgOrderStore implements OrderStore on top of the postgres connection pool.
+type PgOrderStore struct {
+	DB *pgxpool.Pool
+}
+
+// NewPgOrderStore returns a OrderStore backed by the given pool.
+func NewPgOrderStore(storeDB *pgxpool.Pool) *PgOrderStore {
+	return &PgOrderStore{DB: storeDB}
+}
+
+func (s *PgOrderStore) CheckProjectPublished(ctx context.Context, projectID uint) bool {
+	return CheckProjectPublished(ctx, s.DB, projectID)
+}
+
+func (s *PgOrderStore) CheckCountProjects(ctx context.Context, userID uint, countPassed uint) bool {
+	return CheckCountProjects(ctx, s.DB, userID, countPassed)
+}
+
+func (s *PgOrderStore) CheckProject(ctx context.Context, projectID uint) bool {
+	return CheckProject(ctx, s.DB, projectID)
+}
+
+func (s *PgOrderStore) CheckOrder(ctx context.Context, orderID uint) bool {
+	return CheckOrder(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadCart(ctx context.Context, userID uint) (models.ResponseCart, error) {
+	return LoadCart(ctx, s.DB, userID)
+}
+
+func (s *PgOrderStore) CreateOrder(ctx context.Context, userID uint, order models.NewOrder) (uint, error) {
+	return CreateOrder(ctx, s.DB, userID, order)
+}
+
+func (s *PgOrderStore) AddCartItem(ctx context.Context, userID uint, item models.CartItem) (uint, error) {
+	return AddCartItem(ctx, s.DB, userID, item)
+}
+
+func (s *PgOrderStore) UpdateCartItem(ctx context.Context, userID uint, item models.CartItem) error {
+	return UpdateCartItem(ctx, s.DB, userID, item)
+}
+
+func (s *PgOrderStore) DeleteCartItem(ctx context.Context, userID uint, projectID uint) error {
+	return DeleteCartItem(ctx, s.DB, userID, projectID)
+}
+
+func (s *PgOrderStore) OrderPayment(ctx context.Context, orderObj models.RequestOrderPayment, userID uint, deliveryPrice money.Money, warehouseID uint) (money.Money, uint, error) {
+	return OrderPayment(ctx, s.DB, orderObj, userID, deliveryPrice, warehouseID)
+}
+
+func (s *PgOrderStore) FindCheckout(ctx context.Context, userID uint, idempotencyKey string) (uint, string, error) {
+	return FindCheckout(ctx, s.DB, userID, idempotencyKey)
+}
+
+func (s *PgOrderStore) CancelPayment(ctx context.Context, orderID uint, userID uint) error {
+	return CancelPayment(ctx, s.DB, orderID, userID)
+}
+
+func (s *PgOrderStore) RetrieveOrders(ctx context.Context, userID uint, isActive bool, offset uint, limit uint) (models.ResponseOrders, error) {
+	return RetrieveOrders(ctx, s.DB, userID, isActive, offset, limit)
+}
+
+func (s *PgOrderStore) RetrieveSingleOrder(ctx context.Context, orderID uint) (models.ResponseOrder, error) {
+	return RetrieveSingleOrder(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) RetrieveAdminOrders(ctx context.Context, userID uint, orderID uint, isActive bool, createdAfter uint, createdBefore uint, email string, status string, offset uint, limit uint) (models.ResponseAdminOrders, error) {
+	return RetrieveAdminOrders(ctx, s.DB, userID, orderID, isActive, createdAfter, createdBefore, email, status, offset, limit)
+}
+
+func (s *PgOrderStore) LoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error) {
+	return LoadOrder(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) AdminLoadOrder(ctx context.Context, orderID uint) (models.ResponseOrderInfo, error) {
+	return AdminLoadOrder(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadDelivery(ctx context.Context, orderID uint) (models.ResponseDeliveryInfo, error) {
+	return LoadDelivery(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadOrderStatus(ctx context.Context, orderID uint) (string, error) {
+	return LoadOrderStatus(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) UpdateOrderStatus(ctx context.Context, orderID uint, change models.OrderStatusChange) error {
+	return UpdateOrderStatus(ctx, s.DB, orderID, change)
+}
+
+func (s *PgOrderStore) LoadOrderStatusHistory(ctx context.Context, orderID uint) (models.ResponseOrderStatusHistory, error) {
+	return LoadOrderStatusHistory(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadOrderTimeline(ctx context.Context, orderID uint) ([]models.TimelineEvent, error) {
+	return LoadOrderTimeline(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) UpdateOrderCommentary(ctx context.Context, orderID uint, commentaryObj models.RequestUpdateOrderCommentary) error {
+	return UpdateOrderCommentary(ctx, s.DB, orderID, commentaryObj)
+}
+
+func (s *PgOrderStore) UploadOrderVideo(ctx context.Context, orderID uint, videoObj models.OrderVideo) error {
+	return UploadOrderVideo(ctx, s.DB, orderID, videoObj)
+}
+
+func (s *PgOrderStore) DownloadOrderVideo(ctx context.Context, orderID uint) (models.OrderVideo, error) {
+	return DownloadOrderVideo(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) UpdateTransaction(ctx context.Context, orderID uint, transaction models.ResponseTransaction, finalPrice money.Money, goodType string) error {
+	return UpdateTransaction(ctx, s.DB, orderID, transaction, finalPrice, goodType)
+}
+
+func (s *PgOrderStore) UpdateSuccessfulTransaction(ctx context.Context, orderID uint) error {
+	return UpdateSuccessfulTransaction(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) UpdateUnSuccessfulTransaction(ctx context.Context, orderID uint) error {
+	return UpdateUnSuccessfulTransaction(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) GetBankTransactionID(ctx context.Context, orderID uint) (string, error) {
+	return GetBankTransactionID(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadBankTransaction(ctx context.Context, bankOrderID string) (models.BankTransactionObj, error) {
+	return LoadBankTransaction(ctx, s.DB, bankOrderID)
+}
+
+func (s *PgOrderStore) LoadPaidOrders(ctx context.Context) ([]models.PaidOrderObj, error) {
+	return LoadPaidOrders(ctx, s.DB)
+}
+
+func (s *PgOrderStore) OrdersToPrint(ctx context.Context, order models.PaidOrderObj) error {
+	return OrdersToPrint(ctx, s.DB, order)
+}
+
+func (s *PgOrderStore) LoadPendingPayments(ctx context.Context) ([]models.PendingPaymentObj, error) {
+	return LoadPendingPayments(ctx, s.DB)
+}
+
+func (s *PgOrderStore) ExpireOrderPayment(ctx context.Context, orderID uint) error {
+	return ExpireOrderPayment(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadRefundableTransaction(ctx context.Context, orderID uint) (models.RefundableTransactionObj, error) {
+	return LoadRefundableTransaction(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) CreateRefund(ctx context.Context, orderID uint, transactionID uint, refundObj models.RequestRefund) (uint, error) {
+	return CreateRefund(ctx, s.DB, orderID, transactionID, refundObj)
+}
+
+func (s *PgOrderStore) CompleteRefund(ctx context.Context, refundID uint, succeeded bool) error {
+	return CompleteRefund(ctx, s.DB, refundID, succeeded)
+}
+
+func (s *PgOrderStore) LoadRefunds(ctx context.Context, orderID uint) (models.ResponseRefunds, error) {
+	return LoadRefunds(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadPaidTransaction(ctx context.Context, orderID uint) (models.PaidTransactionObj, error) {
+	return LoadPaidTransaction(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) UpdateCapturedTransaction(ctx context.Context, transactionID uint, captureError string) error {
+	return UpdateCapturedTransaction(ctx, s.DB, transactionID, captureError)
+}
+
+func (s *PgOrderStore) LoadCaptureFailures(ctx context.Context) (models.ResponseCaptureFailures, error) {
+	return LoadCaptureFailures(ctx, s.DB)
+}
+
+func (s *PgOrderStore) HoldTransaction(ctx context.Context, transactionID uint) (bool, error) {
+	return HoldTransaction(ctx, s.DB, transactionID)
+}
+
+func (s *PgOrderStore) UpdateReversedTransaction(ctx context.Context, transactionID uint, reverseError string) error {
+	return UpdateReversedTransaction(ctx, s.DB, transactionID, reverseError)
+}
+
+func (s *PgOrderStore) LoadHeldPayments(ctx context.Context) (models.ResponseHeldPayments, error) {
+	return LoadHeldPayments(ctx, s.DB)
+}
+
+func (s *PgOrderStore) CreateReceipt(ctx context.Context, bankOrderID string, refundID uint, receipt models.Receipt) error {
+	return CreateReceipt(ctx, s.DB, bankOrderID, refundID, receipt)
+}
+
+func (s *PgOrderStore) LoadPaymentReceipt(ctx context.Context, bankOrderID string) (models.Receipt, error) {
+	return LoadPaymentReceipt(ctx, s.DB, bankOrderID)
+}
+
+func (s *PgOrderStore) LoadReceipts(ctx context.Context, orderID uint) (models.ResponseReceipts, error) {
+	return LoadReceipts(ctx, s.DB, orderID)
+}
+
+func (s *PgOrderStore) LoadReceipt(ctx context.Context, receiptID uint) (models.StoredReceipt, error) {
+	return LoadReceipt(ctx, s.DB, receiptID)
+}
+
+func (s *PgOrderStore) MarkReceiptSent(ctx context.Context, receiptID uint) error {
+	return MarkReceiptSent(ctx, s.DB, receiptID)
+}
+
+func (s *PgOrderStore) CreateComplaint(ctx context.Context, orderID uint, userID uint, complaintObj models.RequestComplaint) (uint, error) {
+	return CreateComplaint(ctx, s.DB, orderID, userID, complaintObj)
+}
+
+func (s *PgOrderStore) LoadComplaint(ctx context.Context, complaintID uint) (models.Complaint, error) {
+	return LoadComplaint(ctx, s.DB, complaintID)
+}
+
+func (s *PgOrderStore) LoadComplaints(ctx context.Context, orderID uint, status string) (models.ResponseComplaints, error) {
+	return LoadComplaints(ctx, s.DB, orderID, status)
+}
+
+func (s *PgOrderStore) UpdateComplaintStatus(ctx context.Context, complaintID uint, fromStatus string, toStatus string) error {
+	return UpdateComplaintStatus(ctx, s.DB, complaintID, fromStatus, toStatus)
+}
+
+func (s *PgOrderStore) ResolveComplaint(ctx context.Context, complaint models.Complaint) error {
+	return ResolveComplaint(ctx, s.DB, complaint)
+}
+
+func (s *PgOrderStore) CreateReprintOrder(ctx context.Context, orderID uint, change models.OrderStatusChange) (uint, error) {
+	return CreateReprintOrder(ctx, s.DB, orderID, change)
+}
@@ -0,0 +1,230 @@
+// Pricing package contains the engine pricing the photobooks by the rules of the price catalog.
+//
+// A rule is set per size, variant, cover and surface of the book. The base price covers the included pages,
+// the pages above them are sold in steps of the page step, a leather colour and the package box cost extra,
+// and the orders of several books get the volume discount. The copies of a book are priced as so many books.
+// Every price is returned as an itemized breakdown.
+package pricing
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+// Codes of the lines of a price breakdown.
+const (
+	LineBase           = "BASE"
+	LineExtraPages     = "EXTRA_PAGES"
+	LineLeather        = "LEATHER"
+	LinePackageBox     = "PACKAGE_BOX"
+	LineVolumeDiscount = "VOLUME_DISCOUNT"
+)
+
+// bookLines are the lines making the price of the book itself, the discounts of the order are taken off them.
+var bookLines = map[string]bool{
+	LineBase:       true,
+	LineExtraPages: true,
+	LineLeather:    true,
+}
+
+// ErrNoRule is returned when the catalog has no rule for the size, variant, cover and surface of the book.
+var ErrNoRule = errors.New("no price for the book")
+
+// ErrPageCount is returned when the book has fewer or more pages than its rule allows.
+var ErrPageCount = errors.New("page count is not allowed for the book")
+
+// ErrPriceListInEffect is returned when a price list which has come into effect is to be deleted.
+var ErrPriceListInEffect = errors.New("price list is in effect")
+
+// Book is what the price of a photobook depends on. LeatherID is the leather colour of a leatherette cover,
+// Quantity the number of copies, a zero Quantity is one copy.
+type Book struct {
+	ProjectID  uint
+	Size       string
+	Variant    string
+	Cover      string
+	Surface    string
+	CountPages int
+	LeatherID  uint
+	Quantity   int
+}
+
+// copies returns the number of copies of the book.
+func (b Book) copies() int {
+	if b.Quantity < 1 {
+		return 1
+	}
+	return b.Quantity
+}
+
+// Catalog is the set of the pricing rules and the volume discounts of the price list PriceListID.
+type Catalog struct {
+	PriceListID     uint
+	Rules           []models.Price
+	VolumeDiscounts []models.VolumeDiscount
+}
+
+// NewCatalog returns the catalog of the price list.
+func NewCatalog(priceList models.PriceList) Catalog {
+	return Catalog{PriceListID: priceList.PriceListID, Rules: priceList.Prices, VolumeDiscounts: priceList.VolumeDiscounts}
+}
+
+// InEffect returns the price list in effect at the time, the last of the lists which had come into effect by then.
+func InEffect(priceLists []models.PriceList, at int64) (models.PriceList, bool) {
+	var current models.PriceList
+	found := false
+	for _, priceList := range priceLists {
+		if priceList.EffectiveFrom > at {
+			continue
+		}
+		if !found || priceList.EffectiveFrom > current.EffectiveFrom || (priceList.EffectiveFrom == current.EffectiveFrom && priceList.PriceListID > current.PriceListID) {
+			current = priceList
+			found = true
+		}
+	}
+	return current, found
+}
+
+// IsBookLine reports whether the line of the code makes the price of the book itself.
+func IsBookLine(code string) bool {
+	return bookLines[code]
+}
+
+// Rule returns the rule of the size, variant, cover and surface.
+func (c Catalog) Rule(size string, variant string, cover string, surface string) (models.Price, error) {
+	for _, rule := range c.Rules {
+		if rule.Size == size && rule.Variant == variant && rule.Cover == cover && rule.Surface == surface {
+			return rule, nil
+		}
+	}
+	return models.Price{}, ErrNoRule
+}
+
+// CheckPages returns ErrPageCount when the rule does not allow the page count. Zero limits are not checked.
+func CheckPages(rule models.Price, countPages int) error {
+	if countPages < rule.MinPages || (rule.MaxPages > 0 && countPages > rule.MaxPages) {
+		return ErrPageCount
+	}
+	return nil
+}
+
+// extraPages returns the pages charged above the included ones, rounded up to the page step.
+func extraPages(rule models.Price, countPages int) int {
+	extra := countPages - rule.IncludedPages
+	if extra <= 0 {
+		return 0
+	}
+	step := rule.PageStep
+	if step < 1 {
+		step = 1
+	}
+	return (extra + step - 1) / step * step
+}
+
+// bookLineset returns the lines of the price of all the copies of the book by the rule.
+func bookLineset(rule models.Price, book Book) []models.PriceLine {
+	copies := book.copies()
+	lines := []models.PriceLine{{Code: LineBase, ProjectID: book.ProjectID, Quantity: copies, UnitPrice: rule.BasePrice, Amount: rule.BasePrice.Mul(copies)}}
+	if extra := extraPages(rule, book.CountPages) * copies; extra > 0 {
+		lines = append(lines, models.PriceLine{Code: LineExtraPages, ProjectID: book.ProjectID, Quantity: extra, UnitPrice: rule.ExtraPage, Amount: rule.ExtraPage.Mul(extra)})
+	}
+	if book.Cover == "LEATHERETTE" && book.LeatherID != 0 && rule.LeatherSurcharge > 0 {
+		lines = append(lines, models.PriceLine{Code: LineLeather, ProjectID: book.ProjectID, Quantity: copies, UnitPrice: rule.LeatherSurcharge, Amount: rule.LeatherSurcharge.Mul(copies)})
+	}
+	return lines
+}
+
+// total sums the lines into the breakdown of the catalog.
+func (c Catalog) total(lines []models.PriceLine) models.PriceBreakdown {
+	breakdown := models.PriceBreakdown{PriceListID: c.PriceListID, Lines: lines}
+	for _, line := range lines {
+		breakdown.Total += line.Amount
+	}
+	return breakdown
+}
+
+// Quote returns the price of the book. A book whose page count the rule does not allow is priced all the same
+// and ErrPageCount is returned with it, the carts and the order lists keep showing it while the checkout refuses it.
+func (c Catalog) Quote(book Book) (models.PriceBreakdown, error) {
+	rule, err := c.Rule(book.Size, book.Variant, book.Cover, book.Surface)
+	if err != nil {
+		return models.PriceBreakdown{PriceListID: c.PriceListID, Lines: []models.PriceLine{}}, err
+	}
+	return c.total(bookLineset(rule, book)), CheckPages(rule, book.CountPages)
+}
+
+// Alternatives returns the prices of the book printed on the other surface and bound in the other cover,
+// which the cart offers to switch to.
+func (c Catalog) Alternatives(book Book) (money.Money, money.Money, error) {
+	surfaceBook, coverBook := book, book
+	surfaceBook.Surface = map[string]string{"GLOSS": "MATTE", "MATTE": "GLOSS"}[book.Surface]
+	coverBook.Cover = map[string]string{"HARD": "LEATHERETTE", "LEATHERETTE": "HARD"}[book.Cover]
+	surfacePrice, err := c.Quote(surfaceBook)
+	if err != nil && !errors.Is(err, ErrPageCount) {
+		return money.Zero, money.Zero, err
+	}
+	coverPrice, err := c.Quote(coverBook)
+	if err != nil && !errors.Is(err, ErrPageCount) {
+		return money.Zero, money.Zero, err
+	}
+	return surfacePrice.Total, coverPrice.Total, nil
+}
+
+// volumeDiscount returns the discount of the largest volume the order of count books reaches.
+func (c Catalog) volumeDiscount(count int) (models.VolumeDiscount, bool) {
+	discounts := append([]models.VolumeDiscount{}, c.VolumeDiscounts...)
+	sort.Slice(discounts, func(i, j int) bool { return discounts[i].MinBooks > discounts[j].MinBooks })
+	for _, discount := range discounts {
+		if count >= discount.MinBooks {
+			return discount, true
+		}
+	}
+	return models.VolumeDiscount{}, false
+}
+
+// QuoteOrder returns the price of the order of the books: the lines of every book, the package box of every copy
+// when the order is packed in boxes, and the volume discount of the number of copies taken off the books.
+// ErrPageCount is returned with the price when any of the books has a page count its rule does not allow.
+func (c Catalog) QuoteOrder(books []Book, packageBox bool) (models.PriceBreakdown, error) {
+	lines := []models.PriceLine{}
+	var pageErr error
+	var booksPrice money.Money
+	count := 0
+	for _, book := range books {
+		rule, err := c.Rule(book.Size, book.Variant, book.Cover, book.Surface)
+		if err != nil {
+			return models.PriceBreakdown{PriceListID: c.PriceListID, Lines: lines}, err
+		}
+		if err = CheckPages(rule, book.CountPages); err != nil {
+			pageErr = err
+		}
+		bookset := bookLineset(rule, book)
+		for _, line := range bookset {
+			booksPrice += line.Amount
+		}
+		lines = append(lines, bookset...)
+		count += book.copies()
+		if packageBox && rule.PackageBoxFee > 0 {
+			lines = append(lines, models.PriceLine{Code: LinePackageBox, ProjectID: book.ProjectID, Quantity: book.copies(), UnitPrice: rule.PackageBoxFee, Amount: rule.PackageBoxFee.Mul(book.copies())})
+		}
+	}
+	if discount, ok := c.volumeDiscount(count); ok {
+		amount := booksPrice.Rate(discount.Discount)
+		lines = append(lines, models.PriceLine{Code: LineVolumeDiscount, Quantity: 1, UnitPrice: -amount, Amount: -amount})
+	}
+	return c.total(lines), pageErr
+}
+
+// BookPrice returns the price of the copies of the book of the project in the breakdown, without the package box and the discounts.
+func BookPrice(breakdown models.PriceBreakdown, projectID uint) money.Money {
+	var price money.Money
+	for _, line := range breakdown.Lines {
+		if line.ProjectID == projectID && bookLines[line.Code] {
+			price += line.Amount
+		}
+	}
+	return price
+}
@@ -0,0 +1,67 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+func TestQuoteOrder(t *testing.T) {
+
+	catalog := Catalog{
+		Rules: []models.Price{
+			{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", BasePrice: money.FromRoubles(2000), ExtraPage: money.FromRoubles(50), IncludedPages: 23, PageStep: 2, MinPages: 10, MaxPages: 100, PackageBoxFee: money.FromRoubles(300)},
+			{Size: "SQUARE", Variant: "STANDARD", Cover: "LEATHERETTE", Surface: "MATTE", BasePrice: money.FromRoubles(3000), ExtraPage: money.FromRoubles(50), IncludedPages: 23, PageStep: 2, MinPages: 10, MaxPages: 100, LeatherSurcharge: money.FromRoubles(400), PackageBoxFee: money.FromRoubles(300)},
+		},
+		VolumeDiscounts: []models.VolumeDiscount{{MinBooks: 2, Discount: 0.05}, {MinBooks: 5, Discount: 0.1}},
+	}
+
+	// a short book costs the base price, the pages it lacks are not taken off
+	short, err := catalog.Quote(Book{ProjectID: 1, Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", CountPages: 12})
+	if err != nil || short.Total != money.FromRoubles(2000) || len(short.Lines) != 1 {
+		t.Fatalf("expected a short book to cost the base price, got %+v, %v", short, err)
+	}
+
+	// 26 pages are 3 over the included, sold as 4 in steps of 2
+	book := Book{ProjectID: 1, Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", CountPages: 26}
+	leather := Book{ProjectID: 2, Size: "SQUARE", Variant: "STANDARD", Cover: "LEATHERETTE", Surface: "MATTE", CountPages: 20, LeatherID: 3}
+	breakdown, err := catalog.QuoteOrder([]Book{book, leather}, true)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when quoting the order", err)
+	}
+	if extra := breakdown.Lines[1]; extra.Code != LineExtraPages || extra.Quantity != 4 || extra.Amount != money.FromRoubles(200) {
+		t.Errorf("expected 4 extra pages, got %+v", extra)
+	}
+	if BookPrice(breakdown, 1) != money.FromRoubles(2200) || BookPrice(breakdown, 2) != money.FromRoubles(3400) {
+		t.Errorf("expected the books to cost 2200 and 3400, got %s and %s", BookPrice(breakdown, 1), BookPrice(breakdown, 2))
+	}
+	// two boxes at 300 and 5% off the 5600 of the books
+	if last := breakdown.Lines[len(breakdown.Lines)-1]; last.Code != LineVolumeDiscount || last.Amount != -money.FromRoubles(280) {
+		t.Errorf("expected the volume discount of 280, got %+v", last)
+	}
+	if breakdown.Total != money.FromRoubles(5600+600-280) {
+		t.Errorf("expected the order to cost 5920, got %s", breakdown.Total)
+	}
+
+	// five copies of one book reach the 10% volume discount and are packed in five boxes
+	book.Quantity = 5
+	copies, err := catalog.QuoteOrder([]Book{book}, true)
+	if err != nil || BookPrice(copies, 1) != money.FromRoubles(5*2200) || copies.Lines[1].Quantity != 5*4 {
+		t.Fatalf("expected the five copies to cost 11000 with 20 extra pages, got %+v, %v", copies, err)
+	}
+	if copies.Total != money.FromRoubles(11000+5*300-1100) {
+		t.Errorf("expected the copies to cost 11400, got %s", copies.Total)
+	}
+
+	book.Quantity = 0
+	book.CountPages = 120
+	if _, err = catalog.QuoteOrder([]Book{book}, false); !errors.Is(err, ErrPageCount) {
+		t.Errorf("expected a book over the page limit to be refused, got %v", err)
+	}
+	book.Surface = "GLOSS"
+	if _, err = catalog.Quote(book); !errors.Is(err, ErrNoRule) {
+		t.Errorf("expected a book without a price to be refused, got %v", err)
+	}
+}
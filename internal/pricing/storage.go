@@ -0,0 +1,241 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoadCatalog function performs the operation of retrieving the pricing rules and the volume discounts of the price list
+// in effect at the time from pgx database with queries. The catalog is empty when no list is in effect yet.
+func LoadCatalog(ctx context.Context, storeDB *pgxpool.Pool, at time.Time) (Catalog, error) {
+
+	var catalog Catalog
+	err := storeDB.QueryRow(ctx, "SELECT price_lists_id FROM price_lists WHERE effective_from <= ($1) ORDER BY effective_from DESC, price_lists_id DESC LIMIT 1;", at).Scan(&catalog.PriceListID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return catalog, nil
+	}
+	if err != nil {
+		log.Printf("Error happened when retrieving price list in effect from pgx table. Err: %s", err)
+		return catalog, err
+	}
+	priceList, err := LoadPriceList(ctx, storeDB, catalog.PriceListID)
+	if err != nil {
+		return catalog, err
+	}
+	return NewCatalog(priceList), nil
+
+}
+
+// LoadPrices function performs the operation of retrieving the prices and the volume discounts of the price list in effect now
+// from pgx database with queries.
+func LoadPrices(ctx context.Context, storeDB *pgxpool.Pool) (models.ResponsePrice, error) {
+
+	catalog, err := LoadCatalog(ctx, storeDB, time.Now())
+	if err != nil {
+		return models.ResponsePrice{Prices: []models.Price{}, VolumeDiscounts: []models.VolumeDiscount{}}, err
+	}
+	return models.ResponsePrice{Prices: catalog.Rules, VolumeDiscounts: catalog.VolumeDiscounts}, nil
+
+}
+
+// LoadPriceList function performs the operation of retrieving the price list with its prices and volume discounts from pgx database with queries.
+func LoadPriceList(ctx context.Context, storeDB *pgxpool.Pool, priceListID uint) (models.PriceList, error) {
+
+	priceList := models.PriceList{Prices: []models.Price{}, VolumeDiscounts: []models.VolumeDiscount{}}
+	var effectiveFrom, createdAt time.Time
+	err := storeDB.QueryRow(ctx, "SELECT price_lists_id, name, effective_from, created_at FROM price_lists WHERE price_lists_id = ($1);", priceListID).Scan(&priceList.PriceListID, &priceList.Name, &effectiveFrom, &createdAt)
+	if err != nil {
+		log.Printf("Error happened when retrieving price list from pgx table. Err: %s", err)
+		return priceList, err
+	}
+	priceList.EffectiveFrom = effectiveFrom.Unix()
+	priceList.CreatedAt = createdAt.Unix()
+
+	rows, err := storeDB.Query(ctx, "SELECT cover, variant, surface, size, baseprice, extrapage, included_pages, page_step, min_pages, max_pages, leather_surcharge, package_box_fee FROM prices WHERE price_lists_id = ($1) ORDER BY prices_id;", priceListID)
+	if err != nil {
+		log.Printf("Error happened when retrieving prices from pgx table. Err: %s", err)
+		return priceList, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.Price
+		if err = rows.Scan(&rule.Cover, &rule.Variant, &rule.Surface, &rule.Size, &rule.BasePrice, &rule.ExtraPage, &rule.IncludedPages, &rule.PageStep, &rule.MinPages, &rule.MaxPages, &rule.LeatherSurcharge, &rule.PackageBoxFee); err != nil {
+			log.Printf("Error happened when scanning prices. Err: %s", err)
+			return priceList, err
+		}
+		priceList.Prices = append(priceList.Prices, rule)
+	}
+
+	drows, err := storeDB.Query(ctx, "SELECT min_books, discount FROM volume_discounts WHERE price_lists_id = ($1) ORDER BY min_books;", priceListID)
+	if err != nil {
+		log.Printf("Error happened when retrieving volume discounts from pgx table. Err: %s", err)
+		return priceList, err
+	}
+	defer drows.Close()
+
+	for drows.Next() {
+		var discount models.VolumeDiscount
+		if err = drows.Scan(&discount.MinBooks, &discount.Discount); err != nil {
+			log.Printf("Error happened when scanning volume discounts. Err: %s", err)
+			return priceList, err
+		}
+		priceList.VolumeDiscounts = append(priceList.VolumeDiscounts, discount)
+	}
+	return priceList, nil
+
+}
+
+// LoadPriceLists function performs the operation of retrieving all the price lists, the scheduled ones included, from pgx database with queries.
+func LoadPriceLists(ctx context.Context, storeDB *pgxpool.Pool) (models.ResponsePriceLists, error) {
+
+	listset := models.ResponsePriceLists{PriceLists: []models.PriceList{}}
+	rows, err := storeDB.Query(ctx, "SELECT price_lists_id FROM price_lists ORDER BY effective_from, price_lists_id;")
+	if err != nil {
+		log.Printf("Error happened when retrieving price lists from pgx table. Err: %s", err)
+		return listset, err
+	}
+	var listIDs []uint
+	for rows.Next() {
+		var priceListID uint
+		if err = rows.Scan(&priceListID); err != nil {
+			rows.Close()
+			log.Printf("Error happened when scanning price lists. Err: %s", err)
+			return listset, err
+		}
+		listIDs = append(listIDs, priceListID)
+	}
+	rows.Close()
+
+	for _, priceListID := range listIDs {
+		priceList, err := LoadPriceList(ctx, storeDB, priceListID)
+		if err != nil {
+			return listset, err
+		}
+		listset.PriceLists = append(listset.PriceLists, priceList)
+	}
+	return listset, nil
+
+}
+
+// CreatePriceList function performs the operation of adding the price list with its prices and volume discounts to pgx database
+// in a transaction. A list effective from the past comes into effect at once, the prices the orders were placed at are not rewritten.
+func CreatePriceList(ctx context.Context, storeDB *pgxpool.Pool, priceList models.PriceList) (uint, error) {
+
+	var priceListID uint
+	t := time.Now()
+	effectiveFrom := time.Unix(priceList.EffectiveFrom, 0)
+	if effectiveFrom.Before(t) {
+		effectiveFrom = t
+	}
+	tx, err := storeDB.Begin(ctx)
+	if err != nil {
+		log.Printf("Error happened when starting price list transaction. Err: %s", err)
+		return priceListID, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, "INSERT INTO price_lists (name, effective_from, created_at) VALUES ($1, $2, $3) RETURNING price_lists_id;", priceList.Name, effectiveFrom, t).Scan(&priceListID)
+	if err != nil {
+		log.Printf("Error happened when inserting price list into pgx table. Err: %s", err)
+		return priceListID, err
+	}
+	for _, price := range priceList.Prices {
+		_, err = tx.Exec(ctx, "INSERT INTO prices (price_lists_id, cover, variant, surface, size, baseprice, extrapage, included_pages, page_step, min_pages, max_pages, leather_surcharge, package_box_fee) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);",
+			priceListID,
+			price.Cover,
+			price.Variant,
+			price.Surface,
+			price.Size,
+			price.BasePrice,
+			price.ExtraPage,
+			price.IncludedPages,
+			price.PageStep,
+			price.MinPages,
+			price.MaxPages,
+			price.LeatherSurcharge,
+			price.PackageBoxFee,
+		)
+		if err != nil {
+			log.Printf("Error happened when inserting prices into pgx table. Err: %s", err)
+			return priceListID, err
+		}
+	}
+	for _, discount := range priceList.VolumeDiscounts {
+		_, err = tx.Exec(ctx, "INSERT INTO volume_discounts (price_lists_id, min_books, discount) VALUES ($1, $2, $3);", priceListID, discount.MinBooks, discount.Discount)
+		if err != nil {
+			log.Printf("Error happened when inserting volume discounts into pgx table. Err: %s", err)
+			return priceListID, err
+		}
+	}
+	err = tx.Commit(ctx)
+	if err != nil {
+		log.Printf("Error happened when committing price list transaction. Err: %s", err)
+		return priceListID, err
+	}
+	return priceListID, nil
+
+}
+
+// DeletePriceList function performs the operation of deleting a scheduled price list from pgx database with a query.
+// It returns ErrPriceListInEffect for a list which has come into effect, the orders may have been placed at its prices.
+func DeletePriceList(ctx context.Context, storeDB *pgxpool.Pool, priceListID uint) error {
+
+	tag, err := storeDB.Exec(ctx, "DELETE FROM price_lists WHERE price_lists_id = ($1) AND effective_from > ($2);", priceListID, time.Now())
+	if err != nil {
+		log.Printf("Error happened when deleting price list from pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPriceListInEffect
+	}
+	return nil
+
+}
+
+// LoadBook function performs the operation of retrieving what the price of the project depends on from pgx database with a query.
+func LoadBook(ctx context.Context, storeDB *pgxpool.Pool, projectID uint) (Book, error) {
+
+	book := Book{ProjectID: projectID}
+	var countPages, leatherID *int
+	err := storeDB.QueryRow(ctx, "SELECT size, variant, cover, paper, count_pages, leather_id FROM projects WHERE projects_id = ($1);", projectID).Scan(&book.Size, &book.Variant, &book.Cover, &book.Surface, &countPages, &leatherID)
+	if err != nil {
+		log.Printf("Error happened when retrieving project data from pgx table. Err: %s", err)
+		return book, err
+	}
+	if countPages != nil {
+		book.CountPages = *countPages
+	}
+	if leatherID != nil && *leatherID > 0 {
+		book.LeatherID = uint(*leatherID)
+	}
+	return book, nil
+
+}
+
+// QuoteCart returns the price of the order of the copies of the projects in the cart by the price list in effect now,
+// see Catalog.QuoteOrder.
+func QuoteCart(ctx context.Context, storeDB *pgxpool.Pool, cart []models.CartItem, packageBox bool) (models.PriceBreakdown, error) {
+
+	catalog, err := LoadCatalog(ctx, storeDB, time.Now())
+	if err != nil {
+		return models.PriceBreakdown{}, err
+	}
+	books := make([]Book, 0, len(cart))
+	for _, item := range cart {
+		book, err := LoadBook(ctx, storeDB, item.ProjectID)
+		if err != nil {
+			return models.PriceBreakdown{}, err
+		}
+		book.Quantity = item.Quantity
+		books = append(books, book)
+	}
+	return catalog.QuoteOrder(books, packageBox)
+
+}
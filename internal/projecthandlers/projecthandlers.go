@@ -6,6 +6,7 @@ package projecthandlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
@@ -14,23 +15,30 @@ import (
 
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"github.com/SiberianMonster/memoryprint/internal/models"
-	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
-	"github.com/SiberianMonster/memoryprint/internal/userstorage"
-	"github.com/SiberianMonster/memoryprint/internal/objectsstorage"
-	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
 	"github.com/SiberianMonster/memoryprint/internal/emailutils"
 	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
 	"github.com/go-playground/validator/v10"
 	"golang.org/x/exp/slices"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 )
 
+// Handler serves the project endpoints on top of the storages.
+type Handler struct {
+	handlersfunc.Stores
+}
+
+// New returns a Handler using the given storages.
+func New(stores handlersfunc.Stores) *Handler {
+	return &Handler{Stores: stores}
+}
+
 var err error
 var resp map[string]string
 
 
-func UserLoadPhotos(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UserLoadPhotos(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponsePhotos)
 	var rPhotos models.ResponsePhotos
@@ -64,7 +72,7 @@ func UserLoadPhotos(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Load photos of the user %d", userID)
-	rPhotos, err := objectsstorage.RetrieveUserPhotos(ctx, config.DB, userID, sorting, uint(rOffset), uint(rLimit))
+	rPhotos, err := h.Objects.RetrieveUserPhotos(ctx, userID, sorting, uint(rOffset), uint(rLimit))
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -83,7 +91,7 @@ func UserLoadPhotos(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func NewPhoto(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) NewPhoto(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseUploadedPhoto)
 	var photoParams models.Photo
@@ -112,7 +120,7 @@ func NewPhoto(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Add new photo of the user %d", userID)
-	pID, err = objectsstorage.AddPhoto(ctx, config.DB, photoParams.Link, *photoParams.SmallImage, userID)
+	pID, err = h.Objects.AddPhoto(ctx, photoParams.Link, *photoParams.SmallImage, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -130,7 +138,7 @@ func NewPhoto(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeletePhoto(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeletePhoto(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -140,13 +148,13 @@ func DeletePhoto(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	userID := handlersfunc.UserIDContextReader(r)
 
-	userCheck := objectsstorage.CheckUserOwnsPhoto(ctx, config.DB, userID, photoID)
+	userCheck := h.Objects.CheckUserOwnsPhoto(ctx, userID, photoID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
-	_, err = objectsstorage.DeletePhoto(ctx, config.DB, photoID)
+	_, err = h.Objects.DeletePhoto(ctx, photoID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -164,7 +172,7 @@ func DeletePhoto(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func CreateBlankProject(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateBlankProject(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedProject)
 	var ProjectObj models.NewBlankProjectObj
@@ -192,7 +200,7 @@ func CreateBlankProject(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Create project for user %d", userID)
-	pID, err = projectstorage.CreateProject(ctx, config.DB, userID, ProjectObj)
+	pID, err = h.Projects.CreateProject(ctx, userID, ProjectObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -210,7 +218,7 @@ func CreateBlankProject(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DuplicateProject(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DuplicateProject(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)	
 	var pID uint
@@ -221,20 +229,20 @@ func DuplicateProject(rw http.ResponseWriter, r *http.Request) {
 	projectID := uint(aByteToInt)
 	defer r.Body.Close()
 	userID := handlersfunc.UserIDContextReader(r)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
 	log.Printf("Duplicate project for user %d", userID)
-	pID, err = projectstorage.DuplicateProject(ctx, config.DB, projectID, userID)
+	pID, err = h.Projects.DuplicateProject(ctx, projectID, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -252,7 +260,7 @@ func DuplicateProject(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeleteProject(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteProject(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -263,20 +271,20 @@ func DeleteProject(rw http.ResponseWriter, r *http.Request) {
 	
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Delete project %d for user %d",projectID, userID)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
 
-	err = projectstorage.DeleteProject(ctx, config.DB, projectID)
+	err = h.Projects.DeleteProject(ctx, projectID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -293,7 +301,7 @@ func DeleteProject(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func PublishTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) PublishTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
@@ -304,7 +312,7 @@ func PublishTemplate(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	
-	err = projectstorage.PublishTemplate(ctx, config.DB, templateID)
+	err = h.Projects.PublishTemplate(ctx, templateID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -320,7 +328,7 @@ func PublishTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UnpublishTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UnpublishTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
@@ -329,14 +337,14 @@ func UnpublishTemplate(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := projectstorage.CheckTemplate(ctx, config.DB, templateID)
+	checkExists := h.Projects.CheckTemplate(ctx, templateID)
 	if !checkExists {
 		handlersfunc.HandleMissingTemplateError(rw)
 		return
 	}
 
 	
-	err = projectstorage.UnpublishTemplate(ctx, config.DB, templateID)
+	err = h.Projects.UnpublishTemplate(ctx, templateID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -352,7 +360,7 @@ func UnpublishTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UnpublishProject(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UnpublishProject(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
@@ -364,13 +372,13 @@ func UnpublishProject(rw http.ResponseWriter, r *http.Request) {
 
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Unpublish project %d for user %d",projectID, userID)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
@@ -378,7 +386,7 @@ func UnpublishProject(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	
-	err = projectstorage.UnpublishProject(ctx, config.DB, projectID)
+	err = h.Projects.UnpublishProject(ctx, projectID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -394,7 +402,7 @@ func UnpublishProject(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadProject(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadProject(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseProjectObj)
 	var retrievedProject models.ResponseProjectObj
@@ -406,28 +414,28 @@ func LoadProject(rw http.ResponseWriter, r *http.Request) {
 
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Load project %d for user %d",projectID, userID)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
 	
-	retrievedProject, err = projectstorage.LoadProject(ctx, config.DB, projectID)
+	retrievedProject, err = h.Projects.LoadProject(ctx, projectID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 	log.Println(retrievedProject)
 	var leatherID *uint
-	retrievedProject.Pages, err = projectstorage.RetrieveProjectPages(ctx, config.DB, projectID, false, leatherID)
+	retrievedProject.Pages, err = h.Projects.RetrieveProjectPages(ctx, projectID, false, leatherID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -444,7 +452,7 @@ func LoadProject(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.SavedTemplateObj)
 	var retrievedProject models.SavedTemplateObj
@@ -453,7 +461,7 @@ func LoadTemplate(rw http.ResponseWriter, r *http.Request) {
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
 	projectID := uint(aByteToInt)
 	defer r.Body.Close()
-	checkExists := projectstorage.CheckTemplatePublished(ctx, config.DB, projectID)
+	checkExists := h.Projects.CheckTemplatePublished(ctx, projectID)
 	if !checkExists {
 			rw.WriteHeader(http.StatusForbidden)
 			jsonResp, err := json.Marshal(resp)
@@ -465,7 +473,7 @@ func LoadTemplate(rw http.ResponseWriter, r *http.Request) {
 			return
 	}
 
-	retrievedProject, err = projectstorage.LoadTemplate(ctx, config.DB, projectID)
+	retrievedProject, err = h.Projects.LoadTemplate(ctx, projectID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -480,7 +488,7 @@ func LoadTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminLoadTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminLoadTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.SavedTemplateObj)
 	var retrievedProject models.SavedTemplateObj
@@ -489,13 +497,13 @@ func AdminLoadTemplate(rw http.ResponseWriter, r *http.Request) {
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
 	projectID := uint(aByteToInt)
 	defer r.Body.Close()
-	checkExists := projectstorage.CheckTemplate(ctx, config.DB, projectID)
+	checkExists := h.Projects.CheckTemplate(ctx, projectID)
 	if !checkExists {
 		handlersfunc.HandleMissingTemplateError(rw)
 		return
 	}
 
-	retrievedProject, err = projectstorage.AdminLoadTemplate(ctx, config.DB, projectID)
+	retrievedProject, err = h.Projects.AdminLoadTemplate(ctx, projectID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -513,7 +521,7 @@ func AdminLoadTemplate(rw http.ResponseWriter, r *http.Request) {
 
 
 
-func CreateDecor(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateDecor(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedDecoration)
 	var DecorObj models.PersonalisedObject
@@ -541,7 +549,7 @@ func CreateDecor(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Create decor for user %d", userID)
-	dID, err = objectsstorage.AddDecoration(ctx, config.DB, DecorObj, userID)
+	dID, err = h.Objects.AddDecoration(ctx, DecorObj, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -560,7 +568,7 @@ func CreateDecor(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeleteDecor(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteDecor(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -571,7 +579,7 @@ func DeleteDecor(rw http.ResponseWriter, r *http.Request) {
 	userID := handlersfunc.UserIDContextReader(r)
 	
 	
-	err = objectsstorage.DeleteDecoration(ctx, config.DB, userID, decorID)
+	err = h.Objects.DeleteDecoration(ctx, userID, decorID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -588,7 +596,7 @@ func DeleteDecor(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeleteTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -598,7 +606,7 @@ func DeleteTemplate(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	
 	
-	err = projectstorage.DeleteTemplate(ctx, config.DB, templateID)
+	err = h.Projects.DeleteTemplate(ctx, templateID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -615,7 +623,7 @@ func DeleteTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func CreateBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedBackground)
 	var BackgroundObj models.PersonalisedObject
@@ -643,7 +651,7 @@ func CreateBackground(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Create background for user %d", userID)
-	bID, err = objectsstorage.AddBackground(ctx, config.DB, BackgroundObj, userID)
+	bID, err = h.Objects.AddBackground(ctx, BackgroundObj, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -662,7 +670,7 @@ func CreateBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeleteBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -672,7 +680,7 @@ func DeleteBackground(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	userID := handlersfunc.UserIDContextReader(r)
 	
-	err = objectsstorage.DeleteBackground(ctx, config.DB, userID, backgroundID)
+	err = h.Objects.DeleteBackground(ctx, userID, backgroundID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -689,7 +697,7 @@ func DeleteBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseBackground)
 	var requestB models.RequestBackground
@@ -732,7 +740,7 @@ func LoadBackground(rw http.ResponseWriter, r *http.Request) {
 	
 	
 	log.Println(requestB)
-	backgroundSet, err := objectsstorage.LoadBackgrounds(ctx, config.DB, userID, requestB.Offset, requestB.Limit, requestB.Type, requestB.IsFavourite, requestB.IsPersonal)
+	backgroundSet, err := h.Objects.LoadBackgrounds(ctx, userID, requestB.Offset, requestB.Limit, requestB.Type, requestB.IsFavourite, requestB.IsPersonal)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -749,7 +757,7 @@ func LoadBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminCreateBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedBackground)
 	var BackgroundObj models.Background
@@ -776,7 +784,7 @@ func AdminCreateBackground(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Create admin background for user")
-	bID, err = objectsstorage.AddAdminBackground(ctx, config.DB, BackgroundObj)
+	bID, err = h.Objects.AddAdminBackground(ctx, BackgroundObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -795,7 +803,7 @@ func AdminCreateBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminUpdateBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminUpdateBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var BackgroundObj models.Background
@@ -812,7 +820,7 @@ func AdminUpdateBackground(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Update admin background for user")
-	err = objectsstorage.UpdateBackground(ctx, config.DB, backgroundID, BackgroundObj)
+	err = h.Objects.UpdateBackground(ctx, backgroundID, BackgroundObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -830,7 +838,7 @@ func AdminUpdateBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminDeleteBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -839,7 +847,7 @@ func AdminDeleteBackground(rw http.ResponseWriter, r *http.Request) {
 	backgroundID := uint(aByteToInt)
 	defer r.Body.Close()
 	
-	err = objectsstorage.AdminDeleteBackground(ctx, config.DB, backgroundID)
+	err = h.Objects.AdminDeleteBackground(ctx, backgroundID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -856,7 +864,7 @@ func AdminDeleteBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func FavourBackground(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) FavourBackground(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var BackgroundObj models.PersonalisedObject
@@ -873,7 +881,7 @@ func FavourBackground(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Favour background for user %d", userID)
-	err = objectsstorage.FavourBackground(ctx, config.DB, BackgroundObj, userID)
+	err = h.Objects.FavourBackground(ctx, BackgroundObj, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -891,7 +899,7 @@ func FavourBackground(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadDecoration(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadDecoration(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseDecoration)
 	var requestD models.RequestDecoration
@@ -942,7 +950,7 @@ func LoadDecoration(rw http.ResponseWriter, r *http.Request) {
 	
 	
 	
-	decorationSet, err := objectsstorage.LoadDecorations(ctx, config.DB, userID, requestD.Offset, requestD.Limit, requestD.Type, requestD.Category, requestD.IsFavourite, requestD.IsPersonal)
+	decorationSet, err := h.Objects.LoadDecorations(ctx, userID, requestD.Offset, requestD.Limit, requestD.Type, requestD.Category, requestD.IsFavourite, requestD.IsPersonal)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -958,7 +966,7 @@ func LoadDecoration(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminCreateDecoration(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateDecoration(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedDecoration)
 	var DecorationObj models.Decoration
@@ -985,7 +993,7 @@ func AdminCreateDecoration(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Create admin decoration for user")
-	dID, err = objectsstorage.AddAdminDecoration(ctx, config.DB, DecorationObj)
+	dID, err = h.Objects.AddAdminDecoration(ctx, DecorationObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1005,7 +1013,7 @@ func AdminCreateDecoration(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func AdminUpdateDecoration(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminUpdateDecoration(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var DecorationObj models.Decoration
@@ -1022,7 +1030,7 @@ func AdminUpdateDecoration(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Update admin decoration for user")
-	err = objectsstorage.UpdateDecoration(ctx, config.DB, decorationID, DecorationObj)
+	err = h.Objects.UpdateDecoration(ctx, decorationID, DecorationObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1040,7 +1048,7 @@ func AdminUpdateDecoration(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminDeleteDecoration(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteDecoration(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -1049,7 +1057,7 @@ func AdminDeleteDecoration(rw http.ResponseWriter, r *http.Request) {
 	decorationID := uint(aByteToInt)
 	defer r.Body.Close()
 	
-	err = objectsstorage.AdminDeleteDecoration(ctx, config.DB, decorationID)
+	err = h.Objects.AdminDeleteDecoration(ctx, decorationID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1066,7 +1074,7 @@ func AdminDeleteDecoration(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func FavourDecoration(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) FavourDecoration(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var DecorationObj models.PersonalisedObject
@@ -1083,7 +1091,7 @@ func FavourDecoration(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Favour decoration for user %d", userID)
-	err = objectsstorage.FavourDecoration(ctx, config.DB, DecorationObj, userID)
+	err = h.Objects.FavourDecoration(ctx, DecorationObj, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1101,7 +1109,7 @@ func FavourDecoration(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadLayouts(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadLayouts(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseLayout)
 	var requestL models.RequestLayout
@@ -1142,7 +1150,7 @@ func LoadLayouts(rw http.ResponseWriter, r *http.Request) {
 	
 	
 	
-	layoutSet, err := objectsstorage.LoadLayouts(ctx, config.DB, userID, requestL.Offset, requestL.Limit, requestL.Size, requestL.CountImages, requestL.IsFavourite)
+	layoutSet, err := h.Objects.LoadLayouts(ctx, userID, requestL.Offset, requestL.Limit, requestL.Size, requestL.CountImages, requestL.IsFavourite)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -1159,7 +1167,7 @@ func LoadLayouts(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminCreateLayout(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateLayout(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedLayout)
 	var LayoutObj models.Layout
@@ -1186,7 +1194,7 @@ func AdminCreateLayout(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Create admin layout for user")
-	lID, err = objectsstorage.AddAdminLayout(ctx, config.DB, LayoutObj)
+	lID, err = h.Objects.AddAdminLayout(ctx, LayoutObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1205,7 +1213,7 @@ func AdminCreateLayout(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminDeleteLayout(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteLayout(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -1214,7 +1222,7 @@ func AdminDeleteLayout(rw http.ResponseWriter, r *http.Request) {
 	layoutID := uint(aByteToInt)
 	defer r.Body.Close()
 	
-	err = objectsstorage.AdminDeleteLayout(ctx, config.DB, layoutID)
+	err = h.Objects.AdminDeleteLayout(ctx, layoutID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1231,7 +1239,7 @@ func AdminDeleteLayout(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func FavourLayout(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) FavourLayout(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var LayoutObj models.PersonalisedObject
@@ -1248,7 +1256,7 @@ func FavourLayout(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Favour layout for user %d", userID)
-	err = objectsstorage.FavourLayout(ctx, config.DB, LayoutObj, userID)
+	err = h.Objects.FavourLayout(ctx, LayoutObj, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1266,7 +1274,7 @@ func FavourLayout(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadProjects(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadProjects(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseProjects)
 	defer r.Body.Close()
@@ -1300,7 +1308,7 @@ func LoadProjects(rw http.ResponseWriter, r *http.Request) {
         return
     }
 
-	projects, err := projectstorage.RetrieveUserProjects(ctx, config.DB, userID, requestT.Offset, requestT.Limit)
+	projects, err := h.Projects.RetrieveUserProjects(ctx, userID, requestT.Offset, requestT.Limit)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1317,7 +1325,7 @@ func LoadProjects(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminLoadProjects(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminLoadProjects(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseProjects)
 	defer r.Body.Close()
@@ -1351,7 +1359,7 @@ func AdminLoadProjects(rw http.ResponseWriter, r *http.Request) {
 		handlersfunc.HandleValidationError(rw, err)
         return
     }
-	projects, err := projectstorage.RetrieveAdminProjects(ctx, config.DB, userID, requestT.Offset, requestT.Limit)
+	projects, err := h.Projects.RetrieveAdminProjects(ctx, userID, requestT.Offset, requestT.Limit)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1368,7 +1376,7 @@ func AdminLoadProjects(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func SavePage(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) SavePage(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var savedPages models.RequestSavePages
@@ -1385,18 +1393,18 @@ func SavePage(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	for _, page := range savedPages.Pages {
 		// add check for missing page
-		if !projectstorage.CheckPage(ctx, config.DB, page.PageID, projectID) {
+		if !h.Projects.CheckPage(ctx, page.PageID, projectID) {
 				handlersfunc.HandleMissingPageError(rw)
 				return
 		}
 
-		err = projectstorage.SavePage(ctx, config.DB, page)
+		err = h.Projects.SavePage(ctx, page)
 		if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
 		}
 		
-		err = projectstorage.SavePagePhotos(ctx, config.DB, page.PageID, page.UsedPhotoIDs)
+		err = h.Projects.SavePagePhotos(ctx, page.PageID, page.UsedPhotoIDs)
 		if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
@@ -1414,7 +1422,7 @@ func SavePage(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateProjectSpine(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateProjectSpine(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var savedSpine models.SavedSpine
@@ -1430,20 +1438,20 @@ func UpdateProjectSpine(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	userID := handlersfunc.UserIDContextReader(r)
 	log.Printf("Load project %d for user %d",projectID, userID)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if !userCheck {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
-	err = projectstorage.SaveSpine(ctx, config.DB, savedSpine, projectID)
+	err = h.Projects.SaveSpine(ctx, savedSpine, projectID)
 	if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
@@ -1459,7 +1467,7 @@ func UpdateProjectSpine(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateTemplateSpine(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateTemplateSpine(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var savedSpine models.SavedSpine
@@ -1473,12 +1481,12 @@ func UpdateTemplateSpine(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := projectstorage.CheckTemplate(ctx, config.DB, projectID)
+	checkExists := h.Projects.CheckTemplate(ctx, projectID)
 	if !checkExists {
 		handlersfunc.HandleMissingTemplateError(rw)
 		return
 	}
-	err = projectstorage.SaveTemplateSpine(ctx, config.DB, savedSpine, projectID)
+	err = h.Projects.SaveTemplateSpine(ctx, savedSpine, projectID)
 	if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
@@ -1494,7 +1502,7 @@ func UpdateTemplateSpine(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AddProjectPages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AddProjectPages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string][]models.OrderPage)
 	var newPages models.RequestAddPage
@@ -1514,22 +1522,22 @@ func AddProjectPages(rw http.ResponseWriter, r *http.Request) {
 	for _, page := range newPages.Pages {
 
 		var addedPage models.OrderPage
-		if !projectstorage.CheckPagesRange(ctx, config.DB, page.Sort, projectID, false) {
+		if !h.Projects.CheckPagesRange(ctx, page.Sort, projectID, false) {
 			handlersfunc.HandleMissingPageError(rw)
 			return
 		}
-		addedPage, err = projectstorage.AddProjectPage(ctx, config.DB, projectID, page.Sort, false)
+		addedPage, err = h.Projects.AddProjectPage(ctx, projectID, page.Sort, false)
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
 			return
 		}
 		if page.CloneID != 0 {
 			// add check for missing page
-			if !projectstorage.CheckPage(ctx, config.DB, page.CloneID, projectID) {
+			if !h.Projects.CheckPage(ctx, page.CloneID, projectID) {
 					handlersfunc.HandleMissingPageError(rw)
 					return
 			}
-			err = projectstorage.DuplicatePage(ctx, config.DB, page.CloneID, addedPage.PageID)
+			err = h.Projects.DuplicatePage(ctx, page.CloneID, addedPage.PageID)
 			if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
@@ -1547,7 +1555,7 @@ func AddProjectPages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AddTemplatePages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AddTemplatePages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string][]models.OrderPage)
 	var newPages models.RequestAddPage
@@ -1567,22 +1575,22 @@ func AddTemplatePages(rw http.ResponseWriter, r *http.Request) {
 	for _, page := range newPages.Pages {
 
 		var addedPage models.OrderPage
-		if !projectstorage.CheckPagesRange(ctx, config.DB, page.Sort, projectID, true) {
+		if !h.Projects.CheckPagesRange(ctx, page.Sort, projectID, true) {
 			handlersfunc.HandleMissingPageError(rw)
 			return
 		}
-		addedPage, err = projectstorage.AddProjectPage(ctx, config.DB, projectID, page.Sort, true)
+		addedPage, err = h.Projects.AddProjectPage(ctx, projectID, page.Sort, true)
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
 			return
 		}
 		if page.CloneID != 0 {
 			// add check for missing page
-			if !projectstorage.CheckPage(ctx, config.DB, page.CloneID, projectID) {
+			if !h.Projects.CheckPage(ctx, page.CloneID, projectID) {
 				handlersfunc.HandleMissingPageError(rw)
 				return
 			}
-			err = projectstorage.DuplicatePage(ctx, config.DB, page.CloneID, addedPage.PageID)
+			err = h.Projects.DuplicatePage(ctx, page.CloneID, addedPage.PageID)
 			if err != nil {
 				handlersfunc.HandleDatabaseServerError(rw)
 				return
@@ -1601,7 +1609,7 @@ func AddTemplatePages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeletePages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeletePages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var deletePages models.RequestDeletePage
@@ -1617,7 +1625,7 @@ func DeletePages(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	for _, pageID := range deletePages.PageIDs {
-		err = projectstorage.DeletePage(ctx, config.DB, pageID, projectID, false)
+		err = h.Projects.DeletePage(ctx, pageID, projectID, false)
 
 		if err != nil {
 			handlersfunc.HandleMissingPageError(rw)
@@ -1634,7 +1642,7 @@ func DeletePages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DeleteTemplatePages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DeleteTemplatePages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var deletePages models.RequestDeletePage
@@ -1650,7 +1658,7 @@ func DeleteTemplatePages(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	for _, pageID := range deletePages.PageIDs {
-		err = projectstorage.DeletePage(ctx, config.DB, pageID, projectID, true)
+		err = h.Projects.DeletePage(ctx, pageID, projectID, true)
 
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -1667,7 +1675,7 @@ func DeleteTemplatePages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func ReorderPages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) ReorderPages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var reorderPages models.RequestReorderPage
@@ -1695,22 +1703,22 @@ func ReorderPages(rw http.ResponseWriter, r *http.Request) {
 		}
 		
 	}
-	if !projectstorage.CheckAllPagesPassed(ctx, config.DB, uint(len(sortNumbers)), projectID, false){
+	if !h.Projects.CheckAllPagesPassed(ctx, uint(len(sortNumbers)), projectID, false){
 		handlersfunc.HandleNotAllPagesPassedError(rw)
 		return
 	}
 
 	for _, page := range reorderPages.Pages {
 
-		if !projectstorage.CheckPage(ctx, config.DB, page.PageID, projectID){
+		if !h.Projects.CheckPage(ctx, page.PageID, projectID){
 			handlersfunc.HandleMissingPageError(rw)
 			return
 		}
-		if projectstorage.CheckCoverPage(ctx, config.DB, page.PageID){
+		if h.Projects.CheckCoverPage(ctx, page.PageID){
 			handlersfunc.HandleCoverPageError(rw)
 			return
 		}
-		err = projectstorage.ReorderPage(ctx, config.DB, page.PageID, projectID, page.Sort)
+		err = h.Projects.ReorderPage(ctx, page.PageID, projectID, page.Sort)
 
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -1727,7 +1735,7 @@ func ReorderPages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func ReorderTemplatePages(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) ReorderTemplatePages(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var reorderPages models.RequestReorderPage
@@ -1756,22 +1764,22 @@ func ReorderTemplatePages(rw http.ResponseWriter, r *http.Request) {
 		
 	}
 
-	if !projectstorage.CheckAllPagesPassed(ctx, config.DB, uint(len(sortNumbers)), projectID, true){
+	if !h.Projects.CheckAllPagesPassed(ctx, uint(len(sortNumbers)), projectID, true){
 		handlersfunc.HandleNotAllPagesPassedError(rw)
 		return
 	}
 
 	for _, page := range reorderPages.Pages {
 
-		if !projectstorage.CheckPage(ctx, config.DB, page.PageID, projectID){
+		if !h.Projects.CheckPage(ctx, page.PageID, projectID){
 			handlersfunc.HandleMissingPageError(rw)
 			return
 		}
-		if projectstorage.CheckCoverPage(ctx, config.DB, page.PageID){
+		if h.Projects.CheckCoverPage(ctx, page.PageID){
 			handlersfunc.HandleCoverPageError(rw)
 			return
 		}
-		err = projectstorage.ReorderPage(ctx, config.DB, page.PageID, projectID, page.Sort)
+		err = h.Projects.ReorderPage(ctx, page.PageID, projectID, page.Sort)
 
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -1788,7 +1796,7 @@ func ReorderTemplatePages(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadTemplates(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadTemplates(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseTemplates)
 	
@@ -1838,7 +1846,7 @@ func LoadTemplates(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	log.Printf("Retrieving templates")
 
-	templates, err := projectstorage.RetrieveTemplates(ctx, config.DB, requestT.Offset, requestT.Limit, requestT.Category, requestT.Size, "PUBLISHED")
+	templates, err := h.Projects.RetrieveTemplates(ctx, requestT.Offset, requestT.Limit, requestT.Category, requestT.Size, "PUBLISHED")
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1855,7 +1863,7 @@ func LoadTemplates(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminLoadTemplates(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminLoadTemplates(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseTemplates)
 	
@@ -1908,7 +1916,7 @@ func AdminLoadTemplates(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	log.Printf("Retrieving templates")
 
-	templates, err := projectstorage.RetrieveAdminTemplates(ctx, config.DB, requestT.Offset, requestT.Limit, requestT.Category, requestT.Size, requestT.Status)
+	templates, err := h.Projects.RetrieveAdminTemplates(ctx, requestT.Offset, requestT.Limit, requestT.Category, requestT.Size, requestT.Status)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1925,7 +1933,7 @@ func AdminLoadTemplates(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func CreateTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseCreatedTemplate)
 	var TemplateObj models.NewTemplateObj
@@ -1952,7 +1960,7 @@ func CreateTemplate(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	
-	tID, err = projectstorage.CreateTemplate(ctx, config.DB, TemplateObj.Name, TemplateObj.Size, TemplateObj.Category)
+	tID, err = h.Projects.CreateTemplate(ctx, TemplateObj.Name, TemplateObj.Size, TemplateObj.Category)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -1970,7 +1978,7 @@ func CreateTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func DuplicateTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) DuplicateTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -1978,13 +1986,13 @@ func DuplicateTemplate(rw http.ResponseWriter, r *http.Request) {
 	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
 	templateID := uint(aByteToInt)
 	defer r.Body.Close()
-	checkExists := projectstorage.CheckTemplate(ctx, config.DB, templateID)
+	checkExists := h.Projects.CheckTemplate(ctx, templateID)
 	if !checkExists {
 		handlersfunc.HandleMissingTemplateError(rw)
 		return
 	}
 	
-	_, err = projectstorage.DuplicateTemplate(ctx, config.DB, templateID)
+	_, err = h.Projects.DuplicateTemplate(ctx, templateID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2001,7 +2009,7 @@ func DuplicateTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateTemplate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateTemplate(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var TemplateObj models.NewTemplateObj
@@ -2027,13 +2035,13 @@ func UpdateTemplate(rw http.ResponseWriter, r *http.Request) {
     }
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := projectstorage.CheckTemplate(ctx, config.DB, templateID)
+	checkExists := h.Projects.CheckTemplate(ctx, templateID)
 	if !checkExists {
 		handlersfunc.HandleMissingTemplateError(rw)
 		return
 	}
 	
-	_, err = projectstorage.UpdateTemplate(ctx, config.DB, templateID, TemplateObj.Name, TemplateObj.Category)
+	_, err = h.Projects.UpdateTemplate(ctx, templateID, TemplateObj.Name, TemplateObj.Category)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2050,7 +2058,7 @@ func UpdateTemplate(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func ShareLink(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) ShareLink(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var ViewerObj models.Viewer
@@ -2076,7 +2084,7 @@ func ShareLink(rw http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := orderstorage.CheckProject(ctx, config.DB, pID)
+	checkExists := h.Orders.CheckProject(ctx, pID)
 	log.Println(checkExists)
 	if checkExists == false {
 			handlersfunc.HandleMissingProjectError(rw)
@@ -2084,13 +2092,13 @@ func ShareLink(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	userID := handlersfunc.UserIDContextReader(r)
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, pID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, pID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
-	OwnerObj, err = userstorage.GetUserData(ctx, config.DB, userID)
+	OwnerObj, err = h.Users.GetUserData(ctx, userID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -2111,12 +2119,12 @@ func ShareLink(rw http.ResponseWriter, r *http.Request) {
 	mailReq := emailutils.NewMail(from, to, subject, mailType, mailData)
 	err = emailutils.SendMail(mailReq, ms)
 	if err != nil {
-		log.Printf("unable to send mail", "error", err)
+		log.Printf("Error happened when sending share link mail. Err: %s", err)
 		handlersfunc.HandleMailSendError(rw)
 		return
 	}
 
-	err = projectstorage.AddViewer(ctx, config.DB, pID, ViewerObj.Email)
+	err = h.Projects.AddViewer(ctx, pID, ViewerObj.Email)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2133,34 +2141,38 @@ func ShareLink(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminCreatePrices(rw http.ResponseWriter, r *http.Request) {
+// AdminCreatePriceList adds a price list coming into effect at its effective_from, or at once when that is in the past.
+// The orders keep the prices they were placed at.
+func (h *Handler) AdminCreatePriceList(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
-	var PricesObj []models.Price
-	
-
+	var PriceListObj models.PriceList
 
-	err := json.NewDecoder(r.Body).Decode(&PricesObj)
+	err := json.NewDecoder(r.Body).Decode(&PriceListObj)
 	if err != nil {
 		handlersfunc.HandleDecodeError(rw, err)
 		return
 	}
-
 	defer r.Body.Close()
-	
+	validate := validator.New()
+	err = validate.Struct(PriceListObj)
+	if err != nil {
+		handlersfunc.HandleValidationError(rw, err)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	log.Printf("Create new prices")
-	err = objectsstorage.AddPrices(ctx, config.DB, PricesObj)
+	log.Printf("Create new price list")
+	priceListID, err := h.Objects.CreatePriceList(ctx, PriceListObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 
-
 	rw.WriteHeader(http.StatusOK)
-	resp["response"] = 1
+	resp["response"] = priceListID
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
 		log.Printf("Error happened in JSON marshal. Err: %s", err)
@@ -2169,23 +2181,29 @@ func AdminCreatePrices(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminDeletePrices(rw http.ResponseWriter, r *http.Request) {
+// AdminDeletePriceList deletes a scheduled price list. The lists which have come into effect are kept.
+func (h *Handler) AdminDeletePriceList(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
+	aByteToInt, _ := strconv.Atoi(mux.Vars(r)["id"])
+	priceListID := uint(aByteToInt)
 
 	defer r.Body.Close()
-	
+
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	log.Printf("Delete prices")
-	err = objectsstorage.DeletePrices(ctx, config.DB)
+	log.Printf("Delete price list %d", priceListID)
+	err := h.Objects.DeletePriceList(ctx, priceListID)
 
+	if errors.Is(err, pricing.ErrPriceListInEffect) {
+		handlersfunc.HandlePriceListInEffectError(rw)
+		return
+	}
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 
-
 	rw.WriteHeader(http.StatusOK)
 	resp["response"] = 1
 	jsonResp, err := json.Marshal(resp)
@@ -2196,17 +2214,43 @@ func AdminDeletePrices(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadPrices(rw http.ResponseWriter, r *http.Request) {
+// AdminLoadPriceLists lists all the price lists, the scheduled ones included.
+func (h *Handler) AdminLoadPriceLists(rw http.ResponseWriter, r *http.Request) {
+
+	resp := make(map[string]models.ResponsePriceLists)
+
+	defer r.Body.Close()
+	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
+	defer cancel()
+
+	priceLists, err := h.Objects.RetrievePriceLists(ctx)
+
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+	resp["response"] = priceLists
+	jsonResp, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("Error happened in JSON marshal. Err: %s", err)
+		return
+	}
+	rw.Write(jsonResp)
+}
+
+// LoadPrices returns the prices and the volume discounts of the price list in effect now.
+func (h *Handler) LoadPrices(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponsePrice)
-	var priceObj models.ResponsePrice
 	
 	defer r.Body.Close()
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Retrieving prices")
 
-	prices, err := objectsstorage.RetrievePrices(ctx, config.DB)
+	priceObj, err := h.Objects.RetrievePrices(ctx)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2214,7 +2258,6 @@ func LoadPrices(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	rw.WriteHeader(http.StatusOK)
-	priceObj.Prices = prices
 	resp["response"] = priceObj
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
@@ -2224,7 +2267,7 @@ func LoadPrices(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminCreateCover(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminCreateCover(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var CoverObj models.Colour
@@ -2241,7 +2284,7 @@ func AdminCreateCover(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
 	log.Printf("Create new cover")
-	err = objectsstorage.AddCover(ctx, config.DB, CoverObj)
+	err = h.Objects.AddCover(ctx, CoverObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2259,7 +2302,7 @@ func AdminCreateCover(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func AdminDeleteCover(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDeleteCover(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
@@ -2268,7 +2311,7 @@ func AdminDeleteCover(rw http.ResponseWriter, r *http.Request) {
 	coverID := uint(aByteToInt)
 	defer r.Body.Close()
 	
-	err = objectsstorage.AdminDeleteCover(ctx, config.DB, coverID)
+	err = h.Objects.AdminDeleteCover(ctx, coverID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2285,7 +2328,7 @@ func AdminDeleteCover(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadColours(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadColours(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.ResponseColour)
 	var coverObj models.ResponseColour
@@ -2295,7 +2338,7 @@ func LoadColours(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 	log.Printf("Retrieving covers")
 
-	covers, err := objectsstorage.RetrieveCovers(ctx, config.DB)
+	covers, err := h.Objects.RetrieveCovers(ctx)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2313,7 +2356,7 @@ func LoadColours(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateCover(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateCover(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var CoverObj models.UpdateCover
@@ -2339,37 +2382,37 @@ func UpdateCover(rw http.ResponseWriter, r *http.Request) {
 	userID := handlersfunc.UserIDContextReader(r)
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
 
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
 	
-	projectBool := projectstorage.CheckProjectPublished(ctx, config.DB, projectID)
+	projectBool := h.Projects.CheckProjectPublished(ctx, projectID)
 	if projectBool == false {
 		handlersfunc.HandleProjectNotPublished(rw)
 		return
 	}
-	projectBool = projectstorage.CheckProjectNotCompleted(ctx, config.DB, projectID)
+	projectBool = h.Projects.CheckProjectNotCompleted(ctx, projectID)
 	if projectBool == false {
 		handlersfunc.HandleOrderCompleted(rw)
 		return
 	}
     if CoverObj.Cover == "LEATHERETTE" {
-		leatherBool := projectstorage.CheckLeatherID(ctx, config.DB, CoverObj.LeatherID)
+		leatherBool := h.Projects.CheckLeatherID(ctx, CoverObj.LeatherID)
 		if leatherBool == false {
 				handlersfunc.HandleMissingLeatherID(rw)
 				return
 		}
 	} else {
-		coverBool := projectstorage.CheckHardCover(ctx, config.DB, projectID)
+		coverBool := h.Projects.CheckHardCover(ctx, projectID)
 		if coverBool == false {
 				handlersfunc.HandleCoverBoolError(rw)
 				return
@@ -2377,7 +2420,7 @@ func UpdateCover(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("Update project cover for user")
-	err = projectstorage.UpdateCover(ctx, config.DB, projectID, CoverObj)
+	err = h.Projects.UpdateCover(ctx, projectID, CoverObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -2395,7 +2438,7 @@ func UpdateCover(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func UpdateSurface(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateSurface(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	var SurfaceObj models.UpdateSurface
@@ -2423,29 +2466,29 @@ func UpdateSurface(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	userID := handlersfunc.UserIDContextReader(r)
-	checkExists := orderstorage.CheckProject(ctx, config.DB, projectID)
+	checkExists := h.Orders.CheckProject(ctx, projectID)
 	if !checkExists {
 			handlersfunc.HandleMissingProjectError(rw)
 			return
 	}
-	userCheck := userstorage.CheckUserHasProject(ctx, config.DB, userID, projectID)
+	userCheck := h.Users.CheckUserHasProject(ctx, userID, projectID)
 
 	if userCheck == false {
 		handlersfunc.HandlePermissionError(rw)
 		return
 	}
-	projectBool := projectstorage.CheckProjectPublished(ctx, config.DB, projectID)
+	projectBool := h.Projects.CheckProjectPublished(ctx, projectID)
 	if projectBool == false {
 		handlersfunc.HandleProjectNotPublished(rw)
 		return
 	}
-	projectBool = projectstorage.CheckProjectNotCompleted(ctx, config.DB, projectID)
+	projectBool = h.Projects.CheckProjectNotCompleted(ctx, projectID)
 	if projectBool == false {
 		handlersfunc.HandleOrderCompleted(rw)
 		return
 	}
 	log.Printf("Update project surface for user")
-	err = projectstorage.UpdateSurface(ctx, config.DB, projectID, SurfaceObj)
+	err = h.Projects.UpdateSurface(ctx, projectID, SurfaceObj)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
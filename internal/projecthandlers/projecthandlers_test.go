@@ -0,0 +1,51 @@
+package projecthandlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/memstore"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+)
+
+func TestCreateBlankProject(t *testing.T) {
+
+	stores := memstore.NewStores()
+	h := New(stores)
+	ctx := context.Background()
+	userID, err := stores.Users.CreateUser(ctx, models.SignUpUser{Name: "Name", Password: "MyPass123", Email: "user@example.com"})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a user", err)
+	}
+
+	body := `{"name": "Summer", "size": "SQUARE", "variant": "STANDARD", "cover": "HARD", "surface": "GLOSS", "count_pages": 23}`
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/create-project", strings.NewReader(body))
+	r = r.WithContext(context.WithValue(r.Context(), config.UserIDKey, userID))
+	rw := httptest.NewRecorder()
+
+	h.CreateBlankProject(rw, r)
+
+	var resp map[string]models.ResponseCreatedProject
+	if err := json.NewDecoder(rw.Body).Decode(&resp); err != nil {
+		t.Fatalf("an error '%s' was not expected when decoding the response", err)
+	}
+	projectID := resp["response"].ProjectID
+	if projectID == 0 {
+		t.Fatalf("expected a project id in the response, got %v", resp)
+	}
+	if !stores.Users.CheckUserHasProject(ctx, userID, projectID) {
+		t.Errorf("expected user %d to own project %d", userID, projectID)
+	}
+	pages, err := stores.Projects.RetrieveProjectPages(ctx, projectID, false, nil)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when loading the project pages", err)
+	}
+	if len(pages) != 23 {
+		t.Errorf("expected 23 blank pages, got %d", len(pages))
+	}
+}
@@ -125,16 +125,9 @@ func CheckLeatherID(ctx context.Context, storeDB *pgxpool.Pool, leatherID uint)
 
 func CheckProjectNotCompleted(ctx context.Context, storeDB *pgxpool.Pool, projectID uint) bool {
 	var statusActive bool
-	var orderID uint
-	err = storeDB.QueryRow(ctx, "SELECT orders_id FROM orders_has_projects WHERE projects_id = ($1);", projectID).Scan(&orderID)
-	if err != nil {
-			log.Printf("Error happened when retrieving order id data from db. Err: %s", err)
-			return false
-	}
-
-	err = storeDB.QueryRow(ctx, "SELECT CASE WHEN EXISTS (SELECT * FROM orders WHERE status = ($1) AND orders_id = ($2)) THEN TRUE ELSE FALSE END;", "AWAITING_PAYMENT", orderID).Scan(&statusActive)
+	err = storeDB.QueryRow(ctx, "SELECT CASE WHEN EXISTS (SELECT * FROM cart_items WHERE projects_id = ($1)) THEN TRUE ELSE FALSE END;", projectID).Scan(&statusActive)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("Error happened when checking if order is awaiting payment. Err: %s", err)
+		log.Printf("Error happened when checking if project is in the cart. Err: %s", err)
 		return false
 	}
 	log.Println("Status completed")
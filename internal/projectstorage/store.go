@@ -0,0 +1,232 @@
+package projectstorage
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ProjectStore is the storage of projects, templates and their pages used by the handlers.
+type ProjectStore interface {
+	CheckPage(ctx context.Context, pageID uint, projectID uint) bool
+	CheckCoverPage(ctx context.Context, pageID uint) bool
+	CheckHardCover(ctx context.Context, projectID uint) bool
+	CheckProjectPublished(ctx context.Context, projectID uint) bool
+	CheckLeatherID(ctx context.Context, leatherID uint) bool
+	CheckProjectNotCompleted(ctx context.Context, projectID uint) bool
+	CheckTemplate(ctx context.Context, projectID uint) bool
+	CheckTemplatePublished(ctx context.Context, projectID uint) bool
+	CheckAllPagesPassed(ctx context.Context, slicePassed uint, projectID uint, isTemplate bool) bool
+	CheckPagesRange(ctx context.Context, sort uint, projectID uint, isTemplate bool) bool
+	CreateProject(ctx context.Context, userID uint, projectObj models.NewBlankProjectObj) (uint, error)
+	DuplicateProject(ctx context.Context, projectID uint, userID uint) (uint, error)
+	CreateTemplate(ctx context.Context, name string, size string, category string) (uint, error)
+	DuplicateTemplate(ctx context.Context, templateID uint) (uint, error)
+	UpdateTemplate(ctx context.Context, templateID uint, name string, category string) (uint, error)
+	PublishTemplate(ctx context.Context, templateID uint) error
+	UnpublishTemplate(ctx context.Context, templateID uint) error
+	UnpublishProject(ctx context.Context, projectID uint) error
+	DeleteTemplate(ctx context.Context, tID uint) error
+	RetrieveUserProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error)
+	RetrieveAdminProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error)
+	UpdateNewUserProjects(ctx context.Context, email string, userID uint) error
+	LoadProject(ctx context.Context, pID uint) (models.ResponseProjectObj, error)
+	DeleteProject(ctx context.Context, pID uint) error
+	LoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error)
+	AdminLoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error)
+	RetrieveProjectPages(ctx context.Context, projectID uint, isTemplate bool, leatherID *uint) ([]models.Page, error)
+	RetrieveFrontPage(ctx context.Context, projectID uint, isTemplate bool) (models.FrontPage, error)
+	SavePage(ctx context.Context, page models.SavePage) error
+	AddProjectPage(ctx context.Context, projectID uint, sort uint, isTemplate bool) (models.OrderPage, error)
+	DuplicatePage(ctx context.Context, duplicateID uint, pageID uint) error
+	DeletePage(ctx context.Context, pageID uint, projectID uint, isTemplate bool) error
+	ReorderPage(ctx context.Context, pageID uint, projectID uint, sort uint) error
+	RetrieveTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error)
+	RetrieveAdminTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error)
+	SavePagePhotos(ctx context.Context, pageID uint, photoIDS []uint) error
+	AddViewer(ctx context.Context, projectID uint, email string) error
+	UpdateCover(ctx context.Context, pID uint, newC models.UpdateCover) error
+	UpdateSurface(ctx context.Context, pID uint, newS models.UpdateSurface) error
+	SaveSpine(ctx context.Context, newS models.SavedSpine, pID uint) error
+	SaveTemplateSpine(ctx context.Context, newS models.SavedSpine, pID uint) error
+	LoadPromocodeTemplates(ctx context.Context, tcategory string) (models.ResponseTemplates, error)
+}
+
+// PgProjectStore implements ProjectStore on top of the postgres connection pool.
+type PgProjectStore struct {
+	DB *pgxpool.Pool
+}
+
+// NewPgProjectStore returns a ProjectStore backed by the given pool.
+func NewPgProjectStore(storeDB *pgxpool.Pool) *PgProjectStore {
+	return &PgProjectStore{DB: storeDB}
+}
+
+func (s *PgProjectStore) CheckPage(ctx context.Context, pageID uint, projectID uint) bool {
+	return CheckPage(ctx, s.DB, pageID, projectID)
+}
+
+func (s *PgProjectStore) CheckCoverPage(ctx context.Context, pageID uint) bool {
+	return CheckCoverPage(ctx, s.DB, pageID)
+}
+
+func (s *PgProjectStore) CheckHardCover(ctx context.Context, projectID uint) bool {
+	return CheckHardCover(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) CheckProjectPublished(ctx context.Context, projectID uint) bool {
+	return CheckProjectPublished(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) CheckLeatherID(ctx context.Context, leatherID uint) bool {
+	return CheckLeatherID(ctx, s.DB, leatherID)
+}
+
+func (s *PgProjectStore) CheckProjectNotCompleted(ctx context.Context, projectID uint) bool {
+	return CheckProjectNotCompleted(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) CheckTemplate(ctx context.Context, projectID uint) bool {
+	return CheckTemplate(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) CheckTemplatePublished(ctx context.Context, projectID uint) bool {
+	return CheckTemplatePublished(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) CheckAllPagesPassed(ctx context.Context, slicePassed uint, projectID uint, isTemplate bool) bool {
+	return CheckAllPagesPassed(ctx, s.DB, slicePassed, projectID, isTemplate)
+}
+
+func (s *PgProjectStore) CheckPagesRange(ctx context.Context, sort uint, projectID uint, isTemplate bool) bool {
+	return CheckPagesRange(ctx, s.DB, sort, projectID, isTemplate)
+}
+
+func (s *PgProjectStore) CreateProject(ctx context.Context, userID uint, projectObj models.NewBlankProjectObj) (uint, error) {
+	return CreateProject(ctx, s.DB, userID, projectObj)
+}
+
+func (s *PgProjectStore) DuplicateProject(ctx context.Context, projectID uint, userID uint) (uint, error) {
+	return DuplicateProject(ctx, s.DB, projectID, userID)
+}
+
+func (s *PgProjectStore) CreateTemplate(ctx context.Context, name string, size string, category string) (uint, error) {
+	return CreateTemplate(ctx, s.DB, name, size, category)
+}
+
+func (s *PgProjectStore) DuplicateTemplate(ctx context.Context, templateID uint) (uint, error) {
+	return DuplicateTemplate(ctx, s.DB, templateID)
+}
+
+func (s *PgProjectStore) UpdateTemplate(ctx context.Context, templateID uint, name string, category string) (uint, error) {
+	return UpdateTemplate(ctx, s.DB, templateID, name, category)
+}
+
+func (s *PgProjectStore) PublishTemplate(ctx context.Context, templateID uint) error {
+	return PublishTemplate(ctx, s.DB, templateID)
+}
+
+func (s *PgProjectStore) UnpublishTemplate(ctx context.Context, templateID uint) error {
+	return UnpublishTemplate(ctx, s.DB, templateID)
+}
+
+func (s *PgProjectStore) UnpublishProject(ctx context.Context, projectID uint) error {
+	return UnpublishProject(ctx, s.DB, projectID)
+}
+
+func (s *PgProjectStore) DeleteTemplate(ctx context.Context, tID uint) error {
+	return DeleteTemplate(ctx, s.DB, tID)
+}
+
+func (s *PgProjectStore) RetrieveUserProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error) {
+	return RetrieveUserProjects(ctx, s.DB, userID, offset, limit)
+}
+
+func (s *PgProjectStore) RetrieveAdminProjects(ctx context.Context, userID uint, offset uint, limit uint) (models.ResponseProjects, error) {
+	return RetrieveAdminProjects(ctx, s.DB, userID, offset, limit)
+}
+
+func (s *PgProjectStore) UpdateNewUserProjects(ctx context.Context, email string, userID uint) error {
+	return UpdateNewUserProjects(ctx, s.DB, email, userID)
+}
+
+func (s *PgProjectStore) LoadProject(ctx context.Context, pID uint) (models.ResponseProjectObj, error) {
+	return LoadProject(ctx, s.DB, pID)
+}
+
+func (s *PgProjectStore) DeleteProject(ctx context.Context, pID uint) error {
+	return DeleteProject(ctx, s.DB, pID)
+}
+
+func (s *PgProjectStore) LoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error) {
+	return LoadTemplate(ctx, s.DB, pID)
+}
+
+func (s *PgProjectStore) AdminLoadTemplate(ctx context.Context, pID uint) (models.SavedTemplateObj, error) {
+	return AdminLoadTemplate(ctx, s.DB, pID)
+}
+
+func (s *PgProjectStore) RetrieveProjectPages(ctx context.Context, projectID uint, isTemplate bool, leatherID *uint) ([]models.Page, error) {
+	return RetrieveProjectPages(ctx, s.DB, projectID, isTemplate, leatherID)
+}
+
+func (s *PgProjectStore) RetrieveFrontPage(ctx context.Context, projectID uint, isTemplate bool) (models.FrontPage, error) {
+	return RetrieveFrontPage(ctx, s.DB, projectID, isTemplate)
+}
+
+func (s *PgProjectStore) SavePage(ctx context.Context, page models.SavePage) error {
+	return SavePage(ctx, s.DB, page)
+}
+
+func (s *PgProjectStore) AddProjectPage(ctx context.Context, projectID uint, sort uint, isTemplate bool) (models.OrderPage, error) {
+	return AddProjectPage(ctx, s.DB, projectID, sort, isTemplate)
+}
+
+func (s *PgProjectStore) DuplicatePage(ctx context.Context, duplicateID uint, pageID uint) error {
+	return DuplicatePage(ctx, s.DB, duplicateID, pageID)
+}
+
+func (s *PgProjectStore) DeletePage(ctx context.Context, pageID uint, projectID uint, isTemplate bool) error {
+	return DeletePage(ctx, s.DB, pageID, projectID, isTemplate)
+}
+
+func (s *PgProjectStore) ReorderPage(ctx context.Context, pageID uint, projectID uint, sort uint) error {
+	return ReorderPage(ctx, s.DB, pageID, projectID, sort)
+}
+
+func (s *PgProjectStore) RetrieveTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error) {
+	return RetrieveTemplates(ctx, s.DB, offset, limit, tcategory, tsize, tstatus)
+}
+
+func (s *PgProjectStore) RetrieveAdminTemplates(ctx context.Context, offset uint, limit uint, tcategory string, tsize string, tstatus string) (models.ResponseTemplates, error) {
+	return RetrieveAdminTemplates(ctx, s.DB, offset, limit, tcategory, tsize, tstatus)
+}
+
+func (s *PgProjectStore) SavePagePhotos(ctx context.Context, pageID uint, photoIDS []uint) error {
+	return SavePagePhotos(ctx, s.DB, pageID, photoIDS)
+}
+
+func (s *PgProjectStore) AddViewer(ctx context.Context, projectID uint, email string) error {
+	return AddViewer(ctx, s.DB, projectID, email)
+}
+
+func (s *PgProjectStore) UpdateCover(ctx context.Context, pID uint, newC models.UpdateCover) error {
+	return UpdateCover(ctx, s.DB, pID, newC)
+}
+
+func (s *PgProjectStore) UpdateSurface(ctx context.Context, pID uint, newS models.UpdateSurface) error {
+	return UpdateSurface(ctx, s.DB, pID, newS)
+}
+
+func (s *PgProjectStore) SaveSpine(ctx context.Context, newS models.SavedSpine, pID uint) error {
+	return SaveSpine(ctx, s.DB, newS, pID)
+}
+
+func (s *PgProjectStore) SaveTemplateSpine(ctx context.Context, newS models.SavedSpine, pID uint) error {
+	return SaveTemplateSpine(ctx, s.DB, newS, pID)
+}
+
+func (s *PgProjectStore) LoadPromocodeTemplates(ctx context.Context, tcategory string) (models.ResponseTemplates, error) {
+	return LoadPromocodeTemplates(ctx, s.DB, tcategory)
+}
@@ -0,0 +1,236 @@
+// Promotions package contains the evaluator of the promocodes by the rules of their promotions.
+//
+// A promotion takes a percent or a fixed amount off the books it targets, or makes the delivery free.
+// It may be personal, start and expire at given times, require a minimum order value, limit its redemptions
+// in total and per customer, target books by category, size, variant and cover, and exclude gift certificates.
+// The redemptions of the promocodes are recorded, a redemption reserved at the checkout is redeemed by the payment
+// and released when the order is cancelled, expired or refunded.
+package promotions
+
+import (
+	"errors"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+)
+
+// Discount types of the promotions.
+const (
+	TypePercent      = "PERCENT"
+	TypeFixed        = "FIXED"
+	TypeFreeShipping = "FREE_SHIPPING"
+)
+
+// Statuses of the redemptions.
+const (
+	RedemptionReserved = "RESERVED"
+	RedemptionRedeemed = "REDEEMED"
+	RedemptionReleased = "RELEASED"
+)
+
+// ErrUnknownCode is returned when there is no promocode of the code.
+var ErrUnknownCode = errors.New("promocode does not exist")
+
+// ErrForbidden is returned when the personal promocode belongs to another customer.
+var ErrForbidden = errors.New("promocode belongs to another customer")
+
+// ErrNotStarted is returned when the promotion has not started yet.
+var ErrNotStarted = errors.New("promotion has not started")
+
+// ErrExpired is returned when the promotion has expired.
+var ErrExpired = errors.New("promotion has expired")
+
+// ErrRedeemed is returned when the promocode has been redeemed as many times as the promotion allows.
+var ErrRedeemed = errors.New("promocode has been redeemed")
+
+// ErrUserLimit is returned when the customer has redeemed the promocode as many times as the promotion allows.
+var ErrUserLimit = errors.New("promocode has been redeemed by the customer")
+
+// ErrMinOrderValue is returned when the order is below the minimum order value of the promotion.
+var ErrMinOrderValue = errors.New("order is below the minimum order value")
+
+// ErrNotApplicable is returned when the promotion targets none of the books of the order.
+var ErrNotApplicable = errors.New("promotion applies to none of the books")
+
+// ErrCertificateExcluded is returned when the promotion does not stack with the gift certificate paying for the order.
+var ErrCertificateExcluded = errors.New("promotion does not stack with a gift certificate")
+
+// Promotion is the set of the rules of a promocode. Discount is the rate of a percent promotion, Amount the sum
+// of a fixed one. Zero limits, an empty category and empty sizes, variants and covers are not checked.
+type Promotion struct {
+	ID                  uint
+	Code                string
+	Type                string
+	Discount            float64
+	Amount              money.Money
+	Category            string
+	MinOrderValue       money.Money
+	MaxRedemptions      int
+	PerUserLimit        int
+	StartsAt            int64
+	ExpiresAt           int64
+	UsersID             uint
+	Sizes               []string
+	Variants            []string
+	Covers              []string
+	ExcludesCertificate bool
+}
+
+// Usage is the number of the redemptions of the promocode which are reserved or redeemed, in total and by the customer.
+type Usage struct {
+	Redemptions     int
+	UserRedemptions int
+}
+
+// Book is what the targeting of a promotion depends on.
+type Book struct {
+	ProjectID uint
+	Category  string
+	Size      string
+	Variant   string
+	Cover     string
+}
+
+// Order is the order the promocode is applied to: the books and their price without the delivery, the delivery price,
+// and whether a gift certificate pays for it.
+type Order struct {
+	Books         []Book
+	Breakdown     models.PriceBreakdown
+	DeliveryPrice money.Money
+	Certificate   bool
+}
+
+// Result is the order with the promocode applied. The lines of the breakdown carry the discount of the books,
+// Discount sums them and DeliveryDiscount is taken off the delivery price.
+type Result struct {
+	Breakdown        models.PriceBreakdown
+	Discount         money.Money
+	DeliveryDiscount money.Money
+}
+
+// Check returns the reason the customer cannot use the promocode at the time, or nil when they can.
+func Check(p Promotion, usage Usage, userID uint, at time.Time) error {
+	if p.UsersID != 0 && p.UsersID != userID {
+		return ErrForbidden
+	}
+	if p.StartsAt > 0 && at.Before(time.Unix(p.StartsAt, 0)) {
+		return ErrNotStarted
+	}
+	if !at.Before(time.Unix(p.ExpiresAt, 0)) {
+		return ErrExpired
+	}
+	if p.MaxRedemptions > 0 && usage.Redemptions >= p.MaxRedemptions {
+		return ErrRedeemed
+	}
+	if p.PerUserLimit > 0 && usage.UserRedemptions >= p.PerUserLimit {
+		return ErrUserLimit
+	}
+	return nil
+}
+
+// Status returns the status of the promocode check reported by the api for the error of Check.
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return "VALID"
+	case errors.Is(err, ErrForbidden):
+		return "FORBIDDEN"
+	case errors.Is(err, ErrNotStarted):
+		return "NOT STARTED"
+	case errors.Is(err, ErrExpired):
+		return "EXPIRED"
+	case errors.Is(err, ErrRedeemed), errors.Is(err, ErrUserLimit):
+		return "ALREADY USED"
+	}
+	return "INVALID"
+}
+
+// Targets reports whether the promotion applies to the book.
+func (p Promotion) Targets(book Book) bool {
+	if p.Category != "" && p.Category != book.Category {
+		return false
+	}
+	return matches(p.Sizes, book.Size) && matches(p.Variants, book.Variant) && matches(p.Covers, book.Cover)
+}
+
+// matches reports whether the value is one of the values, any value matches none.
+func matches(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the order with the promotion applied. A percent promotion is taken off every line of the targeted books,
+// a fixed one is spread over them in proportion to their price and never exceeds it, a free shipping one takes off the delivery.
+// The discounts are taken on top of the volume discount of the order.
+func Apply(p Promotion, order Order) (Result, error) {
+
+	result := Result{Breakdown: order.Breakdown}
+	result.Breakdown.Lines = append([]models.PriceLine{}, order.Breakdown.Lines...)
+	if order.Certificate && p.ExcludesCertificate {
+		return result, ErrCertificateExcluded
+	}
+	if order.Breakdown.Total < p.MinOrderValue {
+		return result, ErrMinOrderValue
+	}
+	targeted := make(map[uint]bool, len(order.Books))
+	for _, book := range order.Books {
+		targeted[book.ProjectID] = p.Targets(book)
+	}
+	var targets []int
+	var targetedPrice money.Money
+	for i, line := range result.Breakdown.Lines {
+		if pricing.IsBookLine(line.Code) && targeted[line.ProjectID] {
+			targets = append(targets, i)
+			targetedPrice += line.Amount
+		}
+	}
+	if len(targets) == 0 {
+		return result, ErrNotApplicable
+	}
+
+	switch p.Type {
+	case TypeFreeShipping:
+		result.DeliveryDiscount = order.DeliveryPrice
+	case TypeFixed:
+		amount := p.Amount
+		if amount > targetedPrice {
+			amount = targetedPrice
+		}
+		if amount > order.Breakdown.Total {
+			amount = money.Max(money.Zero, order.Breakdown.Total)
+		}
+		var spread money.Money
+		for n, i := range targets {
+			line := &result.Breakdown.Lines[i]
+			if n == len(targets)-1 {
+				line.Discount = amount - spread
+			} else {
+				line.Discount = amount.Split(line.Amount, targetedPrice)
+			}
+			spread += line.Discount
+		}
+	default:
+		for _, i := range targets {
+			line := &result.Breakdown.Lines[i]
+			line.Discount = line.Amount.Rate(p.Discount)
+		}
+	}
+	for _, i := range targets {
+		result.Discount += result.Breakdown.Lines[i].Discount
+	}
+	return result, nil
+}
+
+// Describe returns the promotion as the promocode check reports it.
+func Describe(p Promotion) models.ResponsePromocode {
+	return models.ResponsePromocode{DiscountType: p.Type, Discount: p.Discount, Amount: p.Amount, Category: p.Category, MinOrderValue: p.MinOrderValue, StartsAt: p.StartsAt, ExpiresAt: p.ExpiresAt}
+}
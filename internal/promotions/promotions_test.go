@@ -0,0 +1,98 @@
+package promotions
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+)
+
+func TestCheck(t *testing.T) {
+
+	now := time.Now()
+	p := Promotion{StartsAt: now.Add(-time.Hour).Unix(), ExpiresAt: now.Add(time.Hour).Unix(), MaxRedemptions: 3, PerUserLimit: 1}
+	if err := Check(p, Usage{Redemptions: 2}, 1, now); err != nil {
+		t.Fatalf("an error '%s' was not expected when checking an active promotion", err)
+	}
+	cases := []struct {
+		name  string
+		p     Promotion
+		usage Usage
+		err   error
+	}{
+		{"personal", Promotion{UsersID: 2, ExpiresAt: p.ExpiresAt}, Usage{}, ErrForbidden},
+		{"not started", Promotion{StartsAt: now.Add(time.Minute).Unix(), ExpiresAt: p.ExpiresAt}, Usage{}, ErrNotStarted},
+		{"expired", Promotion{ExpiresAt: now.Unix()}, Usage{}, ErrExpired},
+		{"redeemed", p, Usage{Redemptions: 3}, ErrRedeemed},
+		{"user limit", p, Usage{Redemptions: 1, UserRedemptions: 1}, ErrUserLimit},
+	}
+	for _, c := range cases {
+		if err := Check(c.p, c.usage, 1, now); !errors.Is(err, c.err) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+	if Status(ErrUserLimit) != "ALREADY USED" || Status(ErrNotStarted) != "NOT STARTED" || Status(nil) != "VALID" {
+		t.Errorf("expected the statuses of the api for the errors of the check")
+	}
+}
+
+func TestApply(t *testing.T) {
+
+	// a hard cover book of 2000 with 200 of extra pages and a leatherette one of 3000, 5% volume discount
+	breakdown := models.PriceBreakdown{Lines: []models.PriceLine{
+		{Code: pricing.LineBase, ProjectID: 1, Amount: money.FromRoubles(2000)},
+		{Code: pricing.LineExtraPages, ProjectID: 1, Amount: money.FromRoubles(200)},
+		{Code: pricing.LineBase, ProjectID: 2, Amount: money.FromRoubles(3000)},
+		{Code: pricing.LinePackageBox, ProjectID: 2, Amount: money.FromRoubles(300)},
+		{Code: pricing.LineVolumeDiscount, Amount: -money.FromRoubles(260)},
+	}, Total: money.FromRoubles(5240)}
+	order := Order{
+		Books:         []Book{{ProjectID: 1, Category: "WEDDING", Size: "SQUARE", Cover: "HARD"}, {ProjectID: 2, Category: "TRAVEL", Size: "SQUARE", Cover: "LEATHERETTE"}},
+		Breakdown:     breakdown,
+		DeliveryPrice: money.FromRoubles(350),
+	}
+
+	percent, err := Apply(Promotion{Type: TypePercent, Discount: 0.1, Category: "WEDDING"}, order)
+	if err != nil || percent.Discount != money.FromRoubles(220) || percent.Breakdown.Lines[2].Discount != 0 {
+		t.Fatalf("expected 10%% off the wedding book only, got %+v, %v", percent, err)
+	}
+	if order.Breakdown.Lines[0].Discount != 0 {
+		t.Errorf("expected the breakdown of the order to be left as it is")
+	}
+
+	// 1000 spread over the 2200 and the 3000 of the books, the package box is not discounted
+	fixed, err := Apply(Promotion{Type: TypeFixed, Amount: money.FromRoubles(1000)}, order)
+	if err != nil || fixed.Discount != money.FromRoubles(1000) || fixed.Breakdown.Lines[3].Discount != 0 {
+		t.Fatalf("expected 1000 off the books, got %+v, %v", fixed, err)
+	}
+	if fixed.Breakdown.Lines[0].Discount != money.FromKopecks(38462) {
+		t.Errorf("expected the share of the base price of the first book, got %s", fixed.Breakdown.Lines[0].Discount)
+	}
+	// a fixed amount never exceeds the books it targets
+	capped, _ := Apply(Promotion{Type: TypeFixed, Amount: money.FromRoubles(5000), Covers: []string{"HARD"}}, order)
+	if capped.Discount != money.FromRoubles(2200) {
+		t.Errorf("expected the fixed amount capped at the hard cover book, got %s", capped.Discount)
+	}
+
+	shipping, err := Apply(Promotion{Type: TypeFreeShipping}, order)
+	if err != nil || shipping.DeliveryDiscount != money.FromRoubles(350) || shipping.Discount != 0 {
+		t.Errorf("expected the delivery to be free, got %+v, %v", shipping, err)
+	}
+
+	if _, err = Apply(Promotion{Type: TypePercent, Discount: 0.1, MinOrderValue: money.FromRoubles(6000)}, order); !errors.Is(err, ErrMinOrderValue) {
+		t.Errorf("expected the order below the minimum value to be refused, got %v", err)
+	}
+	if _, err = Apply(Promotion{Type: TypePercent, Discount: 0.1, Sizes: []string{"HORIZONTAL"}}, order); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("expected the promotion of another size to be refused, got %v", err)
+	}
+	order.Certificate = true
+	if _, err = Apply(Promotion{Type: TypeFixed, Amount: money.FromRoubles(500), ExcludesCertificate: true}, order); !errors.Is(err, ErrCertificateExcluded) {
+		t.Errorf("expected the promotion not to stack with the gift certificate, got %v", err)
+	}
+	if _, err = Apply(Promotion{Type: TypeFixed, Amount: money.FromRoubles(500)}, order); err != nil {
+		t.Errorf("expected the promotion to stack with the gift certificate, got %v", err)
+	}
+}
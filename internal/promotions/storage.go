@@ -0,0 +1,157 @@
+package promotions
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// querier is what the promotions are read with, the pool or the checkout transaction.
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+const promotionColumns = "promooffers_id, code, discount_type, discount, amount, category, min_order_value, max_redemptions, per_user_limit, starts_at, expires_at, COALESCE(users_id, 0), sizes, variants, covers, excludes_certificate"
+
+// loadPromotion function performs the operation of retrieving the promotion of the code from pgx database with a query,
+// locking it for the transaction when the query does. It returns ErrUnknownCode when there is no such promocode.
+func loadPromotion(ctx context.Context, q querier, query string, code string) (Promotion, error) {
+
+	var p Promotion
+	err := q.QueryRow(ctx, query, code).Scan(&p.ID, &p.Code, &p.Type, &p.Discount, &p.Amount, &p.Category, &p.MinOrderValue, &p.MaxRedemptions, &p.PerUserLimit, &p.StartsAt, &p.ExpiresAt, &p.UsersID, &p.Sizes, &p.Variants, &p.Covers, &p.ExcludesCertificate)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return p, ErrUnknownCode
+	}
+	if err != nil {
+		log.Printf("Error happened when retrieving promotion from pgx table. Err: %s", err)
+		return p, err
+	}
+	return p, nil
+
+}
+
+// loadUsage counts the redemptions of the promotion, see LoadUsage.
+func loadUsage(ctx context.Context, q querier, promotionID uint, userID uint) (Usage, error) {
+
+	var usage Usage
+	err := q.QueryRow(ctx, "SELECT COUNT(*), COUNT(*) FILTER (WHERE users_id = ($2)) FROM promotion_redemptions WHERE promooffers_id = ($1) AND status IN ($3, $4);",
+		promotionID,
+		userID,
+		RedemptionReserved,
+		RedemptionRedeemed,
+	).Scan(&usage.Redemptions, &usage.UserRedemptions)
+	if err != nil {
+		log.Printf("Error happened when counting promotion redemptions from pgx table. Err: %s", err)
+		return usage, err
+	}
+	return usage, nil
+
+}
+
+// LoadPromotion function performs the operation of retrieving the promotion of the code from pgx database with a query.
+// It returns ErrUnknownCode when there is no such promocode.
+func LoadPromotion(ctx context.Context, storeDB *pgxpool.Pool, code string) (Promotion, error) {
+
+	return loadPromotion(ctx, storeDB, "SELECT "+promotionColumns+" FROM promooffers WHERE code = ($1);", code)
+
+}
+
+// LoadUsage function performs the operation of counting the redemptions of the promotion which are reserved or redeemed,
+// in total and by the customer, in pgx database with a query.
+func LoadUsage(ctx context.Context, storeDB *pgxpool.Pool, promotionID uint, userID uint) (Usage, error) {
+
+	return loadUsage(ctx, storeDB, promotionID, userID)
+
+}
+
+// LockPromotion function performs the operation of retrieving the promotion of the code and its usage by the customer
+// in the transaction. The promotion is locked until the transaction ends, so no other checkout redeems it meanwhile.
+func LockPromotion(ctx context.Context, tx pgx.Tx, code string, userID uint) (Promotion, Usage, error) {
+
+	p, err := loadPromotion(ctx, tx, "SELECT "+promotionColumns+" FROM promooffers WHERE code = ($1) FOR UPDATE;", code)
+	if err != nil {
+		return p, Usage{}, err
+	}
+	usage, err := loadUsage(ctx, tx, p.ID, userID)
+	return p, usage, err
+
+}
+
+// LoadBooks function performs the operation of retrieving what the targeting of the promotions depends on
+// for the projects of the cart from pgx database with queries.
+func LoadBooks(ctx context.Context, storeDB *pgxpool.Pool, cart []models.CartItem) ([]Book, error) {
+
+	books := make([]Book, 0, len(cart))
+	for _, item := range cart {
+		book := Book{ProjectID: item.ProjectID}
+		err := storeDB.QueryRow(ctx, "SELECT COALESCE(category, ''), COALESCE(size, ''), COALESCE(variant, ''), COALESCE(cover, '') FROM projects WHERE projects_id = ($1);", item.ProjectID).Scan(&book.Category, &book.Size, &book.Variant, &book.Cover)
+		if err != nil {
+			log.Printf("Error happened when retrieving project data from pgx table. Err: %s", err)
+			return books, err
+		}
+		books = append(books, book)
+	}
+	return books, nil
+
+}
+
+// Reserve function performs the operation of recording the redemption of the promotion by the order at the checkout
+// in the transaction. The redemption counts towards the limits of the promotion until it is released.
+func Reserve(ctx context.Context, tx pgx.Tx, promotionID uint, userID uint, orderID uint, discount money.Money) error {
+
+	_, err := tx.Exec(ctx, "INSERT INTO promotion_redemptions (promooffers_id, users_id, orders_id, status, discount, created_at) VALUES ($1, $2, $3, $4, $5, $6);",
+		promotionID,
+		userID,
+		orderID,
+		RedemptionReserved,
+		discount,
+		time.Now(),
+	)
+	if err != nil {
+		log.Printf("Error happened when inserting promotion redemption into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// Redeem function performs the operation of marking the redemption of the paid order redeemed in the transaction
+// recording the payment.
+func Redeem(ctx context.Context, tx pgx.Tx, orderID uint) error {
+
+	_, err := tx.Exec(ctx, "UPDATE promotion_redemptions SET status = ($1), redeemed_at = ($2) WHERE orders_id = ($3) AND status = ($4);",
+		RedemptionRedeemed,
+		time.Now(),
+		orderID,
+		RedemptionReserved,
+	)
+	if err != nil {
+		log.Printf("Error happened when redeeming promotion redemption into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
+
+// Release function performs the operation of releasing the redemption of the cancelled, expired or refunded order
+// in pgx database with a query, the promocode may be redeemed again.
+func Release(ctx context.Context, storeDB *pgxpool.Pool, orderID uint) error {
+
+	_, err := storeDB.Exec(ctx, "UPDATE promotion_redemptions SET status = ($1), released_at = ($2) WHERE orders_id = ($3) AND status <> ($1);",
+		RedemptionReleased,
+		time.Now(),
+		orderID,
+	)
+	if err != nil {
+		log.Printf("Error happened when releasing promotion redemption into pgx table. Err: %s", err)
+		return err
+	}
+	return nil
+
+}
@@ -0,0 +1,150 @@
+package transactions
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/userstorage"
+)
+
+// Operations reported by the acquirer in the callback notifications.
+const (
+	CallbackOperationApproved          = "approved"
+	CallbackOperationDeposited         = "deposited"
+	CallbackOperationDeclinedByTimeout = "declinedByTimeout"
+)
+
+// CallbackChecksum returns the checksum the acquirer signs a callback notification with:
+// the HMAC-SHA256 of the "name;value;" pairs sorted by name, excluding checksum and sign_alias.
+func CallbackChecksum(params url.Values, secret string) string {
+
+	var names []string
+	for name := range params {
+		if name == "checksum" || name == "sign_alias" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var payload strings.Builder
+	for _, name := range names {
+		payload.WriteString(name + ";" + params.Get(name) + ";")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload.String()))
+	return strings.ToUpper(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// VerifyCallback reports whether the callback notification is signed with secret.
+func VerifyCallback(params url.Values, secret string) bool {
+
+	if secret == "" {
+		return false
+	}
+	checksum := strings.ToUpper(params.Get("checksum"))
+	return hmac.Equal([]byte(checksum), []byte(CallbackChecksum(params, secret)))
+}
+
+// ProcessCallback applies the outcome of the payment reported by the acquirer to the order or the gift certificate
+// and returns the resulting transaction status. Repeated notifications leave them as they are. A payment made for an order
+// which no longer awaits it is reversed through gateway.
+func ProcessCallback(gateway PaymentGateway, orders orderstorage.OrderStore, users userstorage.UserStore, bankOrderID string, operation string, succeeded bool) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
+	// не забываем освободить ресурс
+	defer cancel()
+
+	transaction, err := orders.LoadBankTransaction(ctx, bankOrderID)
+	if err != nil {
+		log.Printf("Error in finding transaction for the bank order %s. Err: %s", bankOrderID, err)
+		return "", err
+	}
+	paid := succeeded && (operation == CallbackOperationApproved || operation == CallbackOperationDeposited)
+	failed := !succeeded || operation == CallbackOperationDeclinedByTimeout
+	if transaction.Status != "INPROGRESS" {
+		// e.g. the order expired before the customer paid it
+		if paid && transaction.Status == "UNSUCCESSFUL" && transaction.OrdersID != 0 {
+			return transaction.Status, ReleaseHeldPayment(gateway, orders, bankOrderID)
+		}
+		return transaction.Status, nil
+	}
+	if transaction.GiftcertificatesID != 0 {
+		return processCertificateCallback(ctx, users, transaction, bankOrderID, paid, failed)
+	}
+	if transaction.OrdersID == 0 {
+		return transaction.Status, nil
+	}
+	// only the latest payment attempt of the order decides its status
+	latestID, err := orders.GetBankTransactionID(ctx, transaction.OrdersID)
+	if err != nil {
+		return transaction.Status, err
+	}
+	if latestID != bankOrderID {
+		if paid {
+			return transaction.Status, ReleaseHeldPayment(gateway, orders, bankOrderID)
+		}
+		return transaction.Status, nil
+	}
+
+	switch {
+	case paid:
+		err = orders.UpdateSuccessfulTransaction(ctx, transaction.OrdersID)
+		if errors.Is(err, orderstorage.ErrPaymentHeld) {
+			return "UNSUCCESSFUL", ReleaseHeldPayment(gateway, orders, bankOrderID)
+		}
+		if err != nil {
+			log.Printf("Unable to update transaction entry for the order %d", transaction.OrdersID)
+			return transaction.Status, err
+		}
+		return "SUCCESSFUL", nil
+	case failed:
+		err = orders.UpdateUnSuccessfulTransaction(ctx, transaction.OrdersID)
+		if err != nil {
+			log.Printf("Unable to update transaction entry for the order %d", transaction.OrdersID)
+			return transaction.Status, err
+		}
+		err = orders.ExpireOrderPayment(ctx, transaction.OrdersID)
+		if err != nil {
+			log.Printf("Unable to cancel the unpaid order %d", transaction.OrdersID)
+			return "UNSUCCESSFUL", err
+		}
+		return "UNSUCCESSFUL", nil
+	}
+	return transaction.Status, nil
+}
+
+func processCertificateCallback(ctx context.Context, users userstorage.UserStore, transaction models.BankTransactionObj, bankOrderID string, paid bool, failed bool) (string, error) {
+
+	latestID, err := users.GetCertificateBankTransactionID(ctx, transaction.GiftcertificatesID)
+	if err != nil || latestID != bankOrderID {
+		return transaction.Status, err
+	}
+	switch {
+	case paid:
+		err = users.PurchaseCertificate(ctx, transaction.GiftcertificatesID)
+		if err != nil {
+			log.Printf("Unable to activate the gift certificate %d", transaction.GiftcertificatesID)
+			return transaction.Status, err
+		}
+		return "SUCCESSFUL", nil
+	case failed:
+		err = users.CancelCertificatePayment(ctx, transaction.GiftcertificatesID)
+		if err != nil {
+			log.Printf("Unable to cancel the unpaid gift certificate %d", transaction.GiftcertificatesID)
+			return transaction.Status, err
+		}
+		return "UNSUCCESSFUL", nil
+	}
+	return transaction.Status, nil
+}
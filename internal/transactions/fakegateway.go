@@ -0,0 +1,261 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+// FakeGatewayPath is the path the fake acquirer serves its payment forms on.
+const FakeGatewayPath = "/fakepay/"
+
+// ActionCodeDeclined is the action code the fake acquirer reports for a declined payment.
+const ActionCodeDeclined = 2001
+
+var errUnknownPayment = errors.New("unknown payment")
+var errRefundDeclined = errors.New("refund declined")
+var errCaptureDeclined = errors.New("capture declined")
+var errReverseDeclined = errors.New("reverse declined")
+var errOrderNotDeclined = errors.New("payment is not pending")
+var errReceiptMismatch = errors.New("receipt does not add up to the amount")
+
+type fakePayment struct {
+	orderNumber string
+	amount      money.Money
+	returnURL   string
+	actionCode  int64
+	reversed    bool
+	captured    bool
+	refunded    money.Money
+	receipt     models.Receipt
+	refunds     []models.Receipt
+}
+
+// FakeGateway is a local PaymentGateway serving its own payment form, where the payment can be approved or declined.
+type FakeGateway struct {
+	BaseURL  string
+	mu       sync.Mutex
+	next     uint
+	payments map[string]*fakePayment
+}
+
+// NewFakeGateway returns a fake acquirer whose payment forms are served under baseURL.
+func NewFakeGateway(baseURL string) *FakeGateway {
+	return &FakeGateway{
+		BaseURL:  strings.TrimSuffix(baseURL, "/"),
+		payments: make(map[string]*fakePayment),
+	}
+}
+
+func (g *FakeGateway) Register(ctx context.Context, orderNumber string, amount money.Money, returnURL string, receipt models.Receipt) (models.ResponseTransaction, error) {
+	if !receiptMatches(receipt, amount) {
+		return models.ResponseTransaction{}, errReceiptMismatch
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.next++
+	bankOrderID := fmt.Sprintf("fake-%d-%d", time.Now().Unix(), g.next)
+	g.payments[bankOrderID] = &fakePayment{
+		orderNumber: orderNumber,
+		amount:      amount,
+		returnURL:   returnURL,
+		actionCode:  ActionCodePending,
+		receipt:     receipt,
+	}
+	return models.ResponseTransaction{
+		OrderID: bankOrderID,
+		FormURL: g.BaseURL + FakeGatewayPath + bankOrderID,
+	}, nil
+}
+
+func (g *FakeGateway) Status(ctx context.Context, bankOrderID string) (models.ResponseTransactionStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var status models.ResponseTransactionStatus
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return status, errUnknownPayment
+	}
+	status.ActionCode = p.actionCode
+	status.Amount = float64(p.amount.Kopecks())
+	status.Date = time.Now().Unix()
+	return status, nil
+}
+
+func (g *FakeGateway) Reverse(ctx context.Context, bankOrderID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return errUnknownPayment
+	}
+	// only an approved hold is reversed, a payment not made yet is declined
+	if p.captured || p.actionCode != ActionCodeApproved {
+		return errReverseDeclined
+	}
+	p.reversed = true
+	return nil
+}
+
+func (g *FakeGateway) DeclineOrder(ctx context.Context, bankOrderID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return errUnknownPayment
+	}
+	if p.actionCode == ActionCodeApproved {
+		return errOrderNotDeclined
+	}
+	p.actionCode = ActionCodeDeclined
+	return nil
+}
+
+func (g *FakeGateway) Capture(ctx context.Context, bankOrderID string, amount money.Money) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return errUnknownPayment
+	}
+	if p.actionCode != ActionCodeApproved || p.reversed || p.captured || amount > p.amount {
+		return errCaptureDeclined
+	}
+	p.captured = true
+	return nil
+}
+
+func (g *FakeGateway) Refund(ctx context.Context, bankOrderID string, amount money.Money, receipt models.Receipt) error {
+	if !receiptMatches(receipt, amount) {
+		return errReceiptMismatch
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return errUnknownPayment
+	}
+	// only a captured payment can be refunded, a hold is reversed
+	if p.actionCode != ActionCodeApproved || p.reversed || !p.captured || p.refunded+amount > p.amount {
+		return errRefundDeclined
+	}
+	p.refunded += amount
+	p.refunds = append(p.refunds, receipt)
+	return nil
+}
+
+// Receipt returns the receipt the payment was registered with and the receipts of its refunds.
+func (g *FakeGateway) Receipt(bankOrderID string) (models.Receipt, []models.Receipt, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return models.Receipt{}, nil, false
+	}
+	return p.receipt, p.refunds, true
+}
+
+// Reversed reports whether the amount held by the payment has been reversed.
+func (g *FakeGateway) Reversed(bankOrderID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	return ok && p.reversed
+}
+
+// receiptMatches reports whether the receipt, when there is one, adds up to amount and every item to its units.
+func receiptMatches(receipt models.Receipt, amount money.Money) bool {
+	for _, item := range receipt.Items {
+		if item.Quantity < 1 || item.Price.Mul(int(item.Quantity)) != item.Amount {
+			return false
+		}
+	}
+	return len(receipt.Items) == 0 || ReceiptTotal(receipt) == amount
+}
+
+// Approve marks the payment as paid, as if the customer submitted the form.
+func (g *FakeGateway) Approve(bankOrderID string) error {
+	return g.decide(bankOrderID, ActionCodeApproved)
+}
+
+// Decline marks the payment as declined by the issuer.
+func (g *FakeGateway) Decline(bankOrderID string) error {
+	return g.decide(bankOrderID, ActionCodeDeclined)
+}
+
+func (g *FakeGateway) decide(bankOrderID string, actionCode int64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.payments[bankOrderID]
+	if !ok {
+		return errUnknownPayment
+	}
+	if p.actionCode == ActionCodePending {
+		p.actionCode = actionCode
+	}
+	return nil
+}
+
+var fakeFormTemplate = template.Must(template.New("fakepay").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Test payment {{.OrderNumber}}</title></head>
+<body>
+<h1>Test payment</h1>
+<p>Order {{.OrderNumber}}, amount {{.Amount}} RUB</p>
+<form method="post">
+<button type="submit" name="decision" value="approve">Approve</button>
+<button type="submit" name="decision" value="decline">Decline</button>
+</form>
+</body>
+</html>
+`))
+
+// ServeHTTP serves the payment form on GET and applies the customer's decision on POST,
+// redirecting back to the return url of the payment.
+func (g *FakeGateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	bankOrderID := strings.TrimPrefix(r.URL.Path, FakeGatewayPath)
+	g.mu.Lock()
+	p, ok := g.payments[bankOrderID]
+	var orderNumber, returnURL string
+	var amount money.Money
+	if ok {
+		orderNumber, returnURL, amount = p.orderNumber, p.returnURL, p.amount
+	}
+	g.mu.Unlock()
+	if !ok {
+		http.NotFound(rw, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fakeFormTemplate.Execute(rw, struct {
+			OrderNumber string
+			Amount      money.Money
+		}{orderNumber, amount})
+	case http.MethodPost:
+		var err error
+		if r.FormValue("decision") == "approve" {
+			err = g.Approve(bankOrderID)
+		} else {
+			err = g.Decline(bankOrderID)
+		}
+		if err != nil {
+			http.NotFound(rw, r)
+			return
+		}
+		http.Redirect(rw, r, returnURL, http.StatusSeeOther)
+	default:
+		rw.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,93 @@
+package transactions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/memstore"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+func TestFakeGatewayApprove(t *testing.T) {
+
+	gateway := NewFakeGateway("http://localhost:8080")
+	stores := memstore.NewStores()
+	ctx := context.Background()
+	orderID := placeOrder(t, stores)
+
+	link, err := CreateTransaction(gateway, stores.Orders, orderID, money.FromRoubles(1500), "PHOTOBOOK", models.Receipt{})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a transaction", err)
+	}
+	status, err := FindTransactionStatus(gateway, stores.Orders, orderID)
+	if err != nil || status != "PENDING" {
+		t.Fatalf("expected a pending payment before the form is submitted, got %s, %v", status, err)
+	}
+
+	formURL, _ := url.Parse(link)
+	r := httptest.NewRequest(http.MethodPost, formURL.Path, strings.NewReader("decision=approve"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rw := httptest.NewRecorder()
+	gateway.ServeHTTP(rw, r)
+	if rw.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to the return url, got %d", rw.Code)
+	}
+
+	status, err = FindTransactionStatus(gateway, stores.Orders, orderID)
+	if err != nil || status != "SUCCESSFUL" {
+		t.Fatalf("expected a successful payment, got %s, %v", status, err)
+	}
+	order, err := stores.Orders.RetrieveSingleOrder(ctx, orderID)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when loading the order", err)
+	}
+	if order.Status != "PAID" {
+		t.Errorf("expected order status PAID, got %s", order.Status)
+	}
+}
+
+func TestFakeGatewayCertificate(t *testing.T) {
+
+	gateway := NewFakeGateway("http://localhost:8080")
+	stores := memstore.NewStores()
+	ctx := context.Background()
+	userID, err := stores.Users.CreateUser(ctx, models.SignUpUser{Name: "Name", Password: "MyPass123", Email: "friend@example.com"})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a user", err)
+	}
+	certificate := &models.GiftCertificate{Deposit: money.FromRoubles(3000), Recipientemail: "friend@example.com", Recipientname: "Friend"}
+	cID, err := stores.Users.CreateCertificate(ctx, certificate)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a gift certificate", err)
+	}
+	if _, err = CreateTransaction(gateway, stores.Orders, cID, certificate.Deposit, "CERTIFICATE", BuildCertificateReceipt(*certificate)); err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a transaction", err)
+	}
+
+	unsent, _ := stores.Users.LoadUnSentCertificate(ctx)
+	if len(unsent) != 0 {
+		t.Fatalf("expected an unpaid gift certificate not to be mailed")
+	}
+	bankOrderID, _ := stores.Users.GetCertificateBankTransactionID(ctx, cID)
+	if err = gateway.Approve(bankOrderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when approving the payment", err)
+	}
+	status, err := FindCertificateTransactionStatus(gateway, stores.Users, cID)
+	if err != nil || status != "SUCCESSFUL" {
+		t.Fatalf("expected a successful payment, got %s, %v", status, err)
+	}
+
+	unsent, _ = stores.Users.LoadUnSentCertificate(ctx)
+	if len(unsent) != 1 {
+		t.Fatalf("expected the paid gift certificate to be mailed, got %d", len(unsent))
+	}
+	deposit, status, err := stores.Users.UseCertificate(ctx, unsent[0].Code, userID)
+	if err != nil || status != "ACTIVE" || deposit != certificate.Deposit {
+		t.Errorf("expected the paid gift certificate to be redeemable, got %s %v, %v", status, deposit, err)
+	}
+}
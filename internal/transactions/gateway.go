@@ -0,0 +1,255 @@
+package transactions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+// Action codes reported by the acquirer for a registered payment.
+const (
+	ActionCodeApproved = 0
+	ActionCodePending  = -100
+)
+
+// PaymentGateway is the acquirer the orders and gift certificates are paid through.
+type PaymentGateway interface {
+	// Register registers a payment of amount under orderNumber, fiscalized with receipt,
+	// and returns the bank order id and the payment form url.
+	Register(ctx context.Context, orderNumber string, amount money.Money, returnURL string, receipt models.Receipt) (models.ResponseTransaction, error)
+	// Status returns the state of the payment registered under bankOrderID.
+	Status(ctx context.Context, bankOrderID string) (models.ResponseTransactionStatus, error)
+	// Reverse releases the amount held by the payment registered under bankOrderID.
+	Reverse(ctx context.Context, bankOrderID string) error
+	// DeclineOrder closes the payment registered under bankOrderID which has not been made yet, so that it can not be made any more.
+	DeclineOrder(ctx context.Context, bankOrderID string) error
+	// Capture charges amount of the payment pre-authorized under bankOrderID.
+	Capture(ctx context.Context, bankOrderID string, amount money.Money) error
+	// Refund returns amount of the captured payment registered under bankOrderID to the customer, fiscalized with receipt.
+	Refund(ctx context.Context, bankOrderID string, amount money.Money, receipt models.Receipt) error
+}
+
+// BankGateway implements PaymentGateway on top of the acquiring bank REST api.
+type BankGateway struct {
+	Domain   string
+	Username string
+	Password string
+}
+
+// NewBankGateway returns a PaymentGateway talking to the bank api on domain.
+func NewBankGateway(domain string, username string, password string) *BankGateway {
+	return &BankGateway{Domain: domain, Username: username, Password: password}
+}
+
+func (g *BankGateway) post(ctx context.Context, path string, queryValues url.Values, target interface{}) error {
+
+	requestURL := &url.URL{
+		Scheme: "https",
+		Host:   g.Domain,
+		Path:   path,
+	}
+	queryValues.Add("userName", g.Username)
+	queryValues.Add("password", g.Password)
+	requestURL.RawQuery = queryValues.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, requestURL.String(), nil)
+	if err != nil {
+		return errors.New("failed request to bank")
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return errors.New("failed response from bank")
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return errors.New("failed response from bank")
+	}
+	if err = json.NewDecoder(response.Body).Decode(target); err != nil {
+		return errors.New("failed reading response from bank")
+	}
+	return nil
+}
+
+func (g *BankGateway) Register(ctx context.Context, orderNumber string, amount money.Money, returnURL string, receipt models.Receipt) (models.ResponseTransaction, error) {
+
+	var transaction models.ResponseTransaction
+	queryValues := url.Values{}
+	queryValues.Add("returnUrl", returnURL)
+	queryValues.Add("orderNumber", orderNumber)
+	queryValues.Add("amount", strconv.FormatInt(amount.Kopecks(), 10))
+	if len(receipt.Items) > 0 {
+		orderBundle, err := json.Marshal(bankOrderBundle{
+			CustomerDetails: bankCustomerDetails{Email: receipt.Email, Phone: receipt.Phone},
+			CartItems:       bankCartItems{Items: bankReceiptItems(receipt)},
+		})
+		if err != nil {
+			return transaction, errors.New("failed request to bank")
+		}
+		queryValues.Add("orderBundle", string(orderBundle))
+	}
+
+	err := g.post(ctx, "/payment/rest/registerPreAuth.do", queryValues, &transaction)
+	return transaction, err
+}
+
+func (g *BankGateway) Status(ctx context.Context, bankOrderID string) (models.ResponseTransactionStatus, error) {
+
+	var transaction models.ResponseTransactionStatus
+	queryValues := url.Values{}
+	queryValues.Add("orderId", bankOrderID)
+
+	err := g.post(ctx, "/payment/rest/getOrderStatusExtended.do", queryValues, &transaction)
+	return transaction, err
+}
+
+func (g *BankGateway) Reverse(ctx context.Context, bankOrderID string) error {
+
+	var transaction models.ResponseTransactionCancel
+	queryValues := url.Values{}
+	queryValues.Add("orderId", bankOrderID)
+
+	err := g.post(ctx, "/payment/rest/reverse.do", queryValues, &transaction)
+	if err != nil {
+		return err
+	}
+	if transaction.ErrorCode != "0" {
+		return errors.New("reverse declined by bank: " + transaction.ErrorMessage)
+	}
+	return nil
+}
+
+func (g *BankGateway) DeclineOrder(ctx context.Context, bankOrderID string) error {
+
+	var transaction models.ResponseTransactionCancel
+	queryValues := url.Values{}
+	queryValues.Add("orderId", bankOrderID)
+
+	err := g.post(ctx, "/payment/rest/decline.do", queryValues, &transaction)
+	if err != nil {
+		return err
+	}
+	if transaction.ErrorCode != "0" {
+		return errors.New("decline refused by bank: " + transaction.ErrorMessage)
+	}
+	return nil
+}
+
+func (g *BankGateway) Refund(ctx context.Context, bankOrderID string, amount money.Money, receipt models.Receipt) error {
+
+	var transaction models.ResponseTransactionCancel
+	queryValues := url.Values{}
+	queryValues.Add("orderId", bankOrderID)
+	queryValues.Add("amount", strconv.FormatInt(amount.Kopecks(), 10))
+	if len(receipt.Items) > 0 {
+		refundItems, err := json.Marshal(bankCartItems{Items: bankReceiptItems(receipt)})
+		if err != nil {
+			return errors.New("failed request to bank")
+		}
+		queryValues.Add("refundItems", string(refundItems))
+	}
+
+	err := g.post(ctx, "/payment/rest/refund.do", queryValues, &transaction)
+	if err != nil {
+		return err
+	}
+	if transaction.ErrorCode != "0" {
+		return errors.New("refund declined by bank: " + transaction.ErrorMessage)
+	}
+	return nil
+}
+
+func (g *BankGateway) Capture(ctx context.Context, bankOrderID string, amount money.Money) error {
+
+	var transaction models.ResponseTransactionCancel
+	queryValues := url.Values{}
+	queryValues.Add("orderId", bankOrderID)
+	queryValues.Add("amount", strconv.FormatInt(amount.Kopecks(), 10))
+
+	err := g.post(ctx, "/payment/rest/deposit.do", queryValues, &transaction)
+	if err != nil {
+		return err
+	}
+	if transaction.ErrorCode != "0" {
+		return errors.New("capture declined by bank: " + transaction.ErrorMessage)
+	}
+	return nil
+}
+
+// Tax types and item attributes of the bank order bundle matching the receipt tags.
+var bankTaxTypes = map[string]int{"none": 0, "vat0": 1, "vat10": 2, "vat20": 6}
+var bankPaymentMethods = map[string]string{"full_prepayment": "1", "prepayment": "2", "advance": "3", "full_payment": "4"}
+var bankPaymentObjects = map[string]string{"commodity": "1", "service": "4", "payment": "10"}
+
+type bankOrderBundle struct {
+	CustomerDetails bankCustomerDetails `json:"customerDetails"`
+	CartItems       bankCartItems       `json:"cartItems"`
+}
+
+type bankCustomerDetails struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+type bankCartItems struct {
+	Items []bankCartItem `json:"items"`
+}
+
+type bankCartItem struct {
+	PositionID     string             `json:"positionId"`
+	Name           string             `json:"name"`
+	Quantity       bankQuantity       `json:"quantity"`
+	ItemAmount     int64              `json:"itemAmount"`
+	ItemCode       string             `json:"itemCode"`
+	ItemPrice      int64              `json:"itemPrice"`
+	Tax            bankTax            `json:"tax"`
+	ItemAttributes bankItemAttributes `json:"itemAttributes"`
+}
+
+type bankQuantity struct {
+	Value   uint   `json:"value"`
+	Measure string `json:"measure"`
+}
+
+type bankTax struct {
+	TaxType int `json:"taxType"`
+}
+
+type bankItemAttributes struct {
+	Attributes []bankItemAttribute `json:"attributes"`
+}
+
+type bankItemAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+func bankReceiptItems(receipt models.Receipt) []bankCartItem {
+
+	var items []bankCartItem
+	for _, item := range receipt.Items {
+		positionID := strconv.Itoa(int(item.PositionID))
+		items = append(items, bankCartItem{
+			PositionID: positionID,
+			Name:       item.Name,
+			Quantity:   bankQuantity{Value: item.Quantity, Measure: "шт"},
+			ItemAmount: item.Amount.Kopecks(),
+			ItemCode:   positionID,
+			ItemPrice:  item.Price.Kopecks(),
+			Tax:        bankTax{TaxType: bankTaxTypes[item.VAT]},
+			ItemAttributes: bankItemAttributes{Attributes: []bankItemAttribute{
+				{Name: "paymentMethod", Value: bankPaymentMethods[item.PaymentMethod]},
+				{Name: "paymentObject", Value: bankPaymentObjects[item.PaymentObject]},
+			}},
+		})
+	}
+	return items
+}
@@ -0,0 +1,78 @@
+package transactions
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// bankServer answers every request to path with body, as the acquiring bank does, and returns the gateway talking to it.
+func bankServer(t *testing.T, path string, check func(r *http.Request), body string) *BankGateway {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(rw, r)
+			return
+		}
+		check(r)
+		rw.Header().Set("Content-Type", "application/json;charset=UTF-8")
+		rw.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	client := http.DefaultClient
+	http.DefaultClient = server.Client()
+	t.Cleanup(func() { http.DefaultClient = client })
+	return NewBankGateway(strings.TrimPrefix(server.URL, "https://"), "shop-api", "secret")
+}
+
+func TestBankGatewayReverse(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		body     string
+		reversed bool
+	}{
+		{"reversed", `{"errorCode":"0","errorMessage":"Успешно"}`, true},
+		{"already deposited", `{"errorCode":"7","errorMessage":"Реверсирование невозможно. Неверное состояние заказа"}`, false},
+		{"unknown order", `{"errorCode":"6","errorMessage":"Незарегистрированный orderId"}`, false},
+	}
+	for _, tt := range tests {
+		gateway := bankServer(t, "/payment/rest/reverse.do", func(r *http.Request) {
+			query := r.URL.Query()
+			if query.Get("orderId") != "70906e55-7114-41d6-8332-4609dc6590f4" || query.Has("orderNumber") {
+				t.Errorf("%s: expected the bank order id to be sent as orderId, got %s", tt.name, r.URL.RawQuery)
+			}
+			if query.Get("userName") != "shop-api" || query.Get("password") != "secret" {
+				t.Errorf("%s: expected the credentials of the shop, got %s", tt.name, r.URL.RawQuery)
+			}
+		}, tt.body)
+		err := gateway.Reverse(context.Background(), "70906e55-7114-41d6-8332-4609dc6590f4")
+		if (err == nil) != tt.reversed {
+			t.Errorf("%s: expected the payment reversed %t, got %v", tt.name, tt.reversed, err)
+		}
+	}
+}
+
+func TestBankGatewayDeclineOrder(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		body     string
+		declined bool
+	}{
+		{"declined", `{"errorCode":"0","errorMessage":"Успешно"}`, true},
+		{"already paid", `{"errorCode":"7","errorMessage":"Неверный статус заказа"}`, false},
+	}
+	for _, tt := range tests {
+		gateway := bankServer(t, "/payment/rest/decline.do", func(r *http.Request) {
+			if r.URL.Query().Get("orderId") != "70906e55-7114-41d6-8332-4609dc6590f4" {
+				t.Errorf("%s: expected the bank order id to be sent as orderId, got %s", tt.name, r.URL.RawQuery)
+			}
+		}, tt.body)
+		err := gateway.DeclineOrder(context.Background(), "70906e55-7114-41d6-8332-4609dc6590f4")
+		if (err == nil) != tt.declined {
+			t.Errorf("%s: expected the payment declined %t, got %v", tt.name, tt.declined, err)
+		}
+	}
+}
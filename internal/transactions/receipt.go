@@ -0,0 +1,190 @@
+package transactions
+
+import (
+	"github.com/SiberianMonster/memoryprint/internal/config"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+)
+
+// Payment method and payment object attributes of the fiscal receipt items (54-FZ).
+const (
+	PaymentMethodFullPrepayment = "full_prepayment"
+	PaymentMethodAdvance        = "advance"
+	PaymentObjectCommodity      = "commodity"
+	PaymentObjectService        = "service"
+	PaymentObjectPayment        = "payment"
+)
+
+// ReceiptTotal returns the sum of the receipt items.
+func ReceiptTotal(receipt models.Receipt) money.Money {
+
+	var total money.Money
+	for _, item := range receipt.Items {
+		total += item.Amount
+	}
+	return total
+}
+
+// receiptLineNames are the receipt item names of the line items of the order price.
+var receiptLineNames = map[string]string{
+	pricing.LineBase:       "Фотокнига",
+	pricing.LineExtraPages: "Дополнительные страницы",
+	pricing.LineLeather:    "Обложка из экокожи",
+	pricing.LinePackageBox: "Подарочная коробка",
+}
+
+// BuildOrderReceipt turns the paid order into fiscal receipt items: one per line item stored at the checkout, with its quantity,
+// and one for the delivery. The discounts are spread over the line items and the gift certificate deposit over all items,
+// so that the receipt adds up to the final price the customer pays. Orders placed before the line items were stored
+// get one item per photobook.
+func BuildOrderReceipt(order models.ResponseOrder, contacts models.Contacts) models.Receipt {
+
+	receipt := models.Receipt{Email: contacts.Email, Phone: contacts.Phone}
+	var finalPrice, deliveryPrice, deposit money.Money
+	if order.FinalPrice != nil {
+		finalPrice = *order.FinalPrice
+	}
+	if order.DeliveryPrice != nil {
+		deliveryPrice = *order.DeliveryPrice
+	}
+	if order.CertificateDeposit != nil {
+		deposit = *order.CertificateDeposit
+	}
+
+	projectNames := make(map[uint]string)
+	for _, photobook := range order.Projects {
+		projectNames[photobook.ProjectID] = photobook.Name
+	}
+	var items []models.ReceiptItem
+	var lineWeights []money.Money
+	for _, line := range order.Items {
+		// the volume discount line is taken off the other lines
+		if line.Amount <= 0 {
+			continue
+		}
+		name, ok := receiptLineNames[line.Code]
+		if !ok {
+			name = receiptLineNames[pricing.LineBase]
+		}
+		if projectNames[line.ProjectID] != "" {
+			name = name + " " + projectNames[line.ProjectID]
+		}
+		items = append(items, models.ReceiptItem{Name: name, Quantity: uint(line.Quantity), PaymentObject: PaymentObjectCommodity})
+		lineWeights = append(lineWeights, line.Amount-line.Discount)
+	}
+	if len(order.Items) == 0 {
+		for _, photobook := range order.Projects {
+			name := "Фотокнига"
+			if photobook.Name != "" {
+				name = name + " " + photobook.Name
+			}
+			items = append(items, models.ReceiptItem{Name: name, PaymentObject: PaymentObjectCommodity})
+			lineWeights = append(lineWeights, photobook.BasePrice)
+		}
+	}
+
+	// what the photobooks cost after the discounts
+	discountedPrice := money.Max(money.Zero, finalPrice+deposit-deliveryPrice)
+	var linesPrice money.Money
+	for _, weight := range lineWeights {
+		linesPrice += weight
+	}
+	var weights []money.Money
+	for _, weight := range lineWeights {
+		weights = append(weights, discountedPrice.Split(weight, linesPrice))
+	}
+	if deliveryPrice > 0 {
+		items = append(items, models.ReceiptItem{Name: "Доставка", PaymentObject: PaymentObjectService})
+		weights = append(weights, deliveryPrice)
+	}
+
+	receipt.Items = fitReceiptItems(items, weights, finalPrice, PaymentMethodFullPrepayment)
+	return receipt
+}
+
+// BuildCertificateReceipt returns the receipt of the gift certificate purchase, which is an advance
+// for the photobooks the recipient orders later.
+func BuildCertificateReceipt(certificate models.GiftCertificate) models.Receipt {
+
+	receipt := models.Receipt{Email: certificate.Buyeremail, Phone: certificate.Buyerphone}
+	items := []models.ReceiptItem{{Name: "Подарочный сертификат", PaymentObject: PaymentObjectPayment}}
+	receipt.Items = fitReceiptItems(items, []money.Money{certificate.Deposit}, certificate.Deposit, PaymentMethodAdvance)
+	return receipt
+}
+
+// BuildRefundReceipt returns the receipt of refunding amount of the payment, spread over the items of its receipt.
+// A part of an item is refunded as one unit of it.
+func BuildRefundReceipt(payment models.Receipt, amount money.Money) models.Receipt {
+
+	receipt := models.Receipt{Email: payment.Email, Phone: payment.Phone}
+	var items []models.ReceiptItem
+	var weights []money.Money
+	for _, item := range payment.Items {
+		item.Quantity = 1
+		items = append(items, item)
+		weights = append(weights, item.Amount)
+	}
+	receipt.Items = fitReceiptItems(items, weights, amount, "")
+	return receipt
+}
+
+// fitReceiptItems prices the items in proportion to weights so that they add up to total,
+// the rounding remainder going to the largest item. Items left with nothing to pay are dropped.
+// An item of several units whose amount does not divide into them is split in two, priced a kopeck apart.
+func fitReceiptItems(items []models.ReceiptItem, weights []money.Money, total money.Money, paymentMethod string) []models.ReceiptItem {
+
+	var weightSum money.Money
+	for _, weight := range weights {
+		weightSum += weight
+	}
+	if weightSum <= 0 || total <= 0 {
+		return nil
+	}
+
+	amounts := make([]money.Money, len(items))
+	var distributed money.Money
+	largest := 0
+	for i := range items {
+		amounts[i] = total.Split(weights[i], weightSum)
+		distributed += amounts[i]
+		if amounts[i] > amounts[largest] {
+			largest = i
+		}
+	}
+	amounts[largest] += total - distributed
+
+	var fitted []models.ReceiptItem
+	for i, item := range items {
+		if amounts[i] <= 0 {
+			continue
+		}
+		if item.VAT == "" {
+			item.VAT = config.ReceiptVAT
+		}
+		if paymentMethod != "" {
+			item.PaymentMethod = paymentMethod
+		}
+		quantity := int64(item.Quantity)
+		if quantity < 1 {
+			quantity = 1
+		}
+		price := amounts[i].Kopecks() / quantity
+		// the units left over are priced a kopeck more
+		rest := amounts[i].Kopecks() % quantity
+		for _, part := range []struct {
+			quantity int64
+			price    int64
+		}{{quantity - rest, price}, {rest, price + 1}} {
+			if part.quantity == 0 || part.price == 0 {
+				continue
+			}
+			item.PositionID = uint(len(fitted) + 1)
+			item.Quantity = uint(part.quantity)
+			item.Price = money.FromKopecks(part.price)
+			item.Amount = item.Price.Mul(int(part.quantity))
+			fitted = append(fitted, item)
+		}
+	}
+	return fitted
+}
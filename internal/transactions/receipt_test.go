@@ -0,0 +1,97 @@
+package transactions
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/memstore"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+)
+
+func TestOrderReceipt(t *testing.T) {
+
+	// two copies of a photobook with 4 extra pages and another photobook, 3240 with a 10% promocode,
+	// 300 for the delivery and 1000 paid by a gift certificate
+	finalPrice, deliveryPrice, deposit := money.FromRoubles(2216), money.FromRoubles(300), money.FromRoubles(1000)
+	projects := []models.PaidCartObj{{ProjectID: 1, Name: "Wedding", Quantity: 2, BasePrice: money.FromRoubles(2240)}, {ProjectID: 2, Name: "Vacation", Quantity: 1, BasePrice: money.FromRoubles(1000)}}
+	items := []models.OrderItem{
+		{Code: "BASE", ProjectID: 1, Quantity: 2, UnitPrice: money.FromRoubles(1000), Amount: money.FromRoubles(2000), Discount: money.FromRoubles(200)},
+		{Code: "EXTRA_PAGES", ProjectID: 1, Quantity: 4, UnitPrice: money.FromRoubles(60), Amount: money.FromRoubles(240), Discount: money.FromRoubles(24)},
+		{Code: "BASE", ProjectID: 2, Quantity: 1, UnitPrice: money.FromRoubles(1000), Amount: money.FromRoubles(1000), Discount: money.FromRoubles(100)},
+	}
+
+	tests := []struct {
+		name       string
+		items      []models.OrderItem
+		quantities map[string]uint
+	}{
+		{"line items of the checkout", items, map[string]uint{"Фотокнига Wedding": 2, "Дополнительные страницы Wedding": 4, "Фотокнига Vacation": 1, "Доставка": 1}},
+		// orders placed before the line items were stored
+		{"order without line items", nil, map[string]uint{"Фотокнига Wedding": 1, "Фотокнига Vacation": 1, "Доставка": 1}},
+	}
+	for _, tt := range tests {
+		order := models.ResponseOrder{Projects: projects, FinalPrice: &finalPrice, DeliveryPrice: &deliveryPrice, CertificateDeposit: &deposit, Items: tt.items}
+		receipt := BuildOrderReceipt(order, models.Contacts{Email: "user@example.com", Phone: "+79990000000"})
+		if !receiptMatches(receipt, finalPrice) {
+			t.Fatalf("%s: expected the items priced per unit adding up to %v, got %v", tt.name, finalPrice, receipt.Items)
+		}
+		quantities := make(map[string]uint)
+		for _, item := range receipt.Items {
+			quantities[item.Name] += item.Quantity
+		}
+		if len(quantities) != len(tt.quantities) {
+			t.Fatalf("%s: expected the items %v, got %v", tt.name, tt.quantities, receipt.Items)
+		}
+		for name, quantity := range tt.quantities {
+			if quantities[name] != quantity {
+				t.Errorf("%s: expected %d of %s, got %d", tt.name, quantity, name, quantities[name])
+			}
+		}
+		last := receipt.Items[len(receipt.Items)-1]
+		if last.PaymentObject != PaymentObjectService || receipt.Items[0].PaymentMethod != PaymentMethodFullPrepayment {
+			t.Errorf("%s: expected photobooks paid in advance and the delivery as a service, got %v", tt.name, receipt.Items)
+		}
+	}
+}
+
+func TestOrderReceiptPayment(t *testing.T) {
+
+	gateway := NewFakeGateway("http://localhost:8080")
+	stores := memstore.NewStores()
+	ctx := context.Background()
+	orderID := placeOrder(t, stores)
+	order, _ := stores.Orders.RetrieveSingleOrder(ctx, orderID)
+	finalPrice := *order.FinalPrice
+	receipt := BuildOrderReceipt(order, models.Contacts{Email: "user@example.com", Phone: "+79990000000"})
+
+	_, err := CreateTransaction(gateway, stores.Orders, orderID, finalPrice+money.FromKopecks(1), "PHOTOBOOK", receipt)
+	if err == nil {
+		t.Fatalf("expected a receipt not matching the amount to be rejected")
+	}
+	if _, err = CreateTransaction(gateway, stores.Orders, orderID, finalPrice, "PHOTOBOOK", receipt); err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a transaction", err)
+	}
+	bankOrderID, _ := stores.Orders.GetBankTransactionID(ctx, orderID)
+	gateway.Approve(bankOrderID)
+	if _, err = FindTransactionStatus(gateway, stores.Orders, orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when confirming the payment", err)
+	}
+	if err = CaptureTransaction(gateway, stores.Orders, orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when capturing the payment", err)
+	}
+	stores.Orders.UpdateOrderStatus(ctx, orderID, models.OrderStatusChange{FromStatus: "PAID", ToStatus: "IN_PRINT", Actor: "SYSTEM"})
+	refundAmount := money.FromKopecks(33333)
+	if _, err = RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: refundAmount, Reason: "misprint"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when refunding", err)
+	}
+
+	registered, refunds, _ := gateway.Receipt(bankOrderID)
+	if ReceiptTotal(registered) != finalPrice || len(refunds) != 1 || ReceiptTotal(refunds[0]) != refundAmount {
+		t.Errorf("expected the gateway to get the payment and the refund receipts, got %v, %v", registered, refunds)
+	}
+	stored, _ := stores.Orders.LoadReceipts(ctx, orderID)
+	if len(stored.Receipts) != 2 || stored.Receipts[1].Type != "REFUND" || stored.Receipts[1].Amount != refundAmount {
+		t.Errorf("expected the payment and the refund receipts to be stored, got %v", stored.Receipts)
+	}
+}
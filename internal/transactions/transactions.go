@@ -2,203 +2,307 @@ package transactions
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/orderstatus"
 	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+	"github.com/SiberianMonster/memoryprint/internal/userstorage"
 	"log"
-	"net/http"
-	"net/url"
 	"strconv"
 	"errors"
 )
 
-func CreateTransaction(orderID uint, finalPrice float64, goodType string) (string, error) {
+// CreateTransaction registers the payment of the order or the gift certificate with the acquirer, fiscalized with receipt,
+// and returns the payment form url. The receipt is stored so that admins can re-send it.
+func CreateTransaction(gateway PaymentGateway, store orderstorage.OrderStore, orderID uint, finalPrice money.Money, goodType string, receipt models.Receipt) (string, error) {
 	var paymentLink string
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
-	
-	registrationURL := &url.URL{
-        Scheme: "https",
-        Host:   config.BankDomain,
-		Path:   "/payment/rest/registerPreAuth.do",
-    }
+
 	uniqueNumber := goodType + strconv.Itoa(int(orderID))
 	returnURL := "https://memoriprint.ru/paymentresults/" + uniqueNumber
-    queryValues := url.Values{}
-    queryValues.Add("userName", config.BankUsername)
-    queryValues.Add("password", config.BankPassword)
-	queryValues.Add("returnUrl", returnURL)
-	queryValues.Add("orderNumber", uniqueNumber)
-	priceInCents := finalPrice * 100.0
-	queryValues.Add("amount", strconv.Itoa(int(priceInCents)))
-    registrationURL.RawQuery = queryValues.Encode()
-	log.Println(registrationURL.String())
-    
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, registrationURL.String(), nil)
+
+	transaction, err := gateway.Register(ctx, uniqueNumber, finalPrice, returnURL, receipt)
 	if err != nil {
-		log.Println(err)
-		log.Printf("Error in creating request for the order %s", strconv.Itoa(int(orderID)) )
-		return paymentLink, errors.New("failed request to bank")
+		log.Printf("Error in getting payment url for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return paymentLink, err
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := http.DefaultClient
-	response, err := client.Do(request)
+	log.Printf("Registered payment %s for the order %s", transaction.OrderID, strconv.Itoa(int(orderID)))
 
+	// the link of a payment which is not stored can not be confirmed later, the caller gives up the order instead
+	err = store.UpdateTransaction(ctx, orderID, transaction, finalPrice, goodType)
 	if err != nil {
-		log.Printf("Error in getting payment url for the order %s", strconv.Itoa(int(orderID)) )
-		return paymentLink, errors.New("failed response from bank")
+		log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
+		return paymentLink, err
+	}
+	if len(receipt.Items) > 0 {
+		err = store.CreateReceipt(ctx, transaction.OrderID, 0, receipt)
+		if err != nil {
+			log.Printf("Unable to store receipt for the order %s", strconv.Itoa(int(orderID)))
+		}
 	}
+	return transaction.FormURL, nil
+}
+
+func FindTransactionStatus(gateway PaymentGateway, store orderstorage.OrderStore, orderID uint) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
+	// не забываем освободить ресурс
+	defer cancel()
+	statusTransaction := "PENDING"
 
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Internal server error happened when getting payment url %s order ", strconv.Itoa(int(orderID)))
-		return paymentLink, errors.New("failed response from bank")
+	banktransactionID, err := store.GetBankTransactionID(ctx, orderID)
+	if err != nil {
+		log.Printf("Error in finding bank transaction for the order %s", strconv.Itoa(int(orderID)))
+		return statusTransaction, err
 	}
 
-	if response.StatusCode == http.StatusOK {
-		var transaction models.ResponseTransaction
-		err := json.NewDecoder(response.Body).Decode(&transaction)
-		log.Println(transaction)
-		defer response.Body.Close()
-		if err != nil {
-			log.Printf("Error in getting payment url for the order %s", strconv.Itoa(int(orderID)) )
-			return paymentLink, errors.New("failed response from bank")
-		}
-		err = orderstorage.UpdateTransaction(ctx, config.DB, orderID, transaction, finalPrice, goodType)
+	transaction, err := gateway.Status(ctx, banktransactionID)
+	if err != nil {
+		log.Printf("Error in getting payment data for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return statusTransaction, err
+	}
+	if transaction.ActionCode == ActionCodePending {
+		return statusTransaction, nil
+	}
+	if transaction.ActionCode != ActionCodeApproved {
+		err = store.UpdateUnSuccessfulTransaction(ctx, orderID)
 		if err != nil {
 			log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
 		}
-		return transaction.FormURL, nil
-
+		log.Printf("Unsuccessful transaction for the order %s",  strconv.Itoa(int(orderID)))
+		return "UNSUCCESSFUL", errors.New("failed reading response from bank")
+	}
+	err = store.UpdateSuccessfulTransaction(ctx, orderID)
+	if errors.Is(err, orderstorage.ErrPaymentHeld) {
+		return "UNSUCCESSFUL", ReleaseHeldPayment(gateway, store, banktransactionID)
 	}
-	return paymentLink, errors.New("failed request to bank")
+	if err != nil {
+		log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
+	}
+	return "SUCCESSFUL", nil
 }
 
-func FindTransactionStatus(orderID uint) (string, error) {
-
-	statusURL := &url.URL{
-        Scheme: "https",
-        Host:   config.BankDomain,
-		Path:   "/payment/rest/getOrderStatusExtended.do",
-    }
-    queryValues := url.Values{}
-    queryValues.Add("userName", config.BankUsername)
-    queryValues.Add("password", config.BankPassword)
-	queryValues.Add("orderNumber", strconv.Itoa(int(orderID)))
-    statusURL.RawQuery = queryValues.Encode()
+// ReleaseHeldPayment reverses the amount the bank holds under bankOrderID for an order which does not take it,
+// e.g. paid after the order expired. The payment is listed in LoadHeldPayments until the bank has reversed it.
+func ReleaseHeldPayment(gateway PaymentGateway, store orderstorage.OrderStore, bankOrderID string) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
-	statusTransaction := "PENDING"
 
+	transaction, err := store.LoadBankTransaction(ctx, bankOrderID)
+	if err != nil {
+		log.Printf("Error in finding transaction for the bank order %s. Err: %s", bankOrderID, err)
+		return err
+	}
+	held, err := store.HoldTransaction(ctx, transaction.TransactionsID)
+	if err != nil || !held {
+		return err
+	}
+	log.Printf("Bank holds the payment %s of the order %d which does not take it", bankOrderID, transaction.OrdersID)
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, statusURL.String(), nil)
+	reverseErr := gateway.Reverse(ctx, bankOrderID)
+	reverseError := ""
+	if reverseErr != nil {
+		log.Printf("Error in reversing held payment for the order %d. Err: %s", transaction.OrdersID, reverseErr)
+		reverseError = reverseErr.Error()
+	}
+	err = store.UpdateReversedTransaction(ctx, transaction.TransactionsID, reverseError)
 	if err != nil {
-		log.Printf("Error in checking transaction status for the order %s", strconv.Itoa(int(orderID)))
-		return statusTransaction, errors.New("failed response from bank")
+		log.Printf("Unable to update transaction entry for the order %d", transaction.OrdersID)
+		if reverseErr == nil {
+			return err
+		}
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return reverseErr
+}
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
+// FindCertificateTransactionStatus asks the acquirer about the payment of the gift certificate
+// and activates the certificate once it is paid.
+func FindCertificateTransactionStatus(gateway PaymentGateway, store userstorage.UserStore, cID uint) (string, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
+	// не забываем освободить ресурс
+	defer cancel()
+	statusTransaction := "PENDING"
 
+	banktransactionID, err := store.GetCertificateBankTransactionID(ctx, cID)
 	if err != nil {
-		log.Printf("Error in getting payment data for the order %s", strconv.Itoa(int(orderID)))
-		return statusTransaction, errors.New("failed response from bank")
+		log.Printf("Error in finding bank transaction for the gift certificate %s", strconv.Itoa(int(cID)))
+		return statusTransaction, err
 	}
 
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Internal server error happened when getting payment data %s order ", strconv.Itoa(int(orderID)))
-		return statusTransaction, errors.New("failed response from bank")
+	transaction, err := gateway.Status(ctx, banktransactionID)
+	if err != nil {
+		log.Printf("Error in getting payment data for the gift certificate %s. Err: %s", strconv.Itoa(int(cID)), err)
+		return statusTransaction, err
 	}
-
-	if response.StatusCode == http.StatusOK {
-		var transaction models.ResponseTransactionStatus
-		err := json.NewDecoder(response.Body).Decode(&transaction)
-		defer response.Body.Close()
-		if err != nil {
-			log.Printf("Unable to decode bank response for the order %s",  strconv.Itoa(int(orderID)))
-			return statusTransaction, errors.New("failed reading response from bank")
-		}
-		if transaction.ActionCode != 0 {
-			err = orderstorage.UpdateUnSuccessfulTransaction(ctx, config.DB, orderID)
-			if err != nil {
-				log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
-			}
-			log.Printf("Unsuccessful transaction for the order %s",  strconv.Itoa(int(orderID)))
-			return "UNSUCCESSFUL", errors.New("failed reading response from bank")
-		}
-		err = orderstorage.UpdateSuccessfulTransaction(ctx, config.DB, orderID)
+	if transaction.ActionCode == ActionCodePending {
+		return statusTransaction, nil
+	}
+	if transaction.ActionCode != ActionCodeApproved {
+		err = store.CancelCertificatePayment(ctx, cID)
 		if err != nil {
-			log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
+			log.Printf("Unable to update transaction entry for the gift certificate %s", strconv.Itoa(int(cID)))
 		}
-		return "SUCCESSFUL", nil
-
+		log.Printf("Unsuccessful transaction for the gift certificate %s", strconv.Itoa(int(cID)))
+		return "UNSUCCESSFUL", errors.New("failed reading response from bank")
+	}
+	err = store.PurchaseCertificate(ctx, cID)
+	if err != nil {
+		log.Printf("Unable to update transaction entry for the gift certificate %s", strconv.Itoa(int(cID)))
 	}
-	return statusTransaction, errors.New("failed response from bank")
+	return "SUCCESSFUL", nil
 }
-func CancelTransaction(orderID uint) error {
+
+// CancelTransaction closes the payment of the order with the acquirer before the order is given up: the amount held
+// by the bank is reversed and a payment not made yet is declined, so that the customer can not pay for the cancelled order.
+func CancelTransaction(gateway PaymentGateway, store orderstorage.OrderStore, orderID uint) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
-	log.Println(orderID)
-	banktransactionID, _ := orderstorage.GetBankTransactionID(ctx, config.DB, orderID)
-	cancellationURL := &url.URL{
-        Scheme: "https",
-        Host:   config.BankDomain,
-        Path:   "/payment/rest/reverse.do",
-    }
-	queryValues := url.Values{}
-    queryValues.Add("userName", config.BankUsername)
-    queryValues.Add("password", config.BankPassword)
-	queryValues.Add("orderNumber", banktransactionID)
-    cancellationURL.RawQuery = queryValues.Encode()
-
-	
-
+	banktransactionID, err := store.GetBankTransactionID(ctx, orderID)
+	if errors.Is(err, orderstorage.ErrNoBankOrder) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error in finding bank transaction for the order %s", strconv.Itoa(int(orderID)))
+		return err
+	}
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, cancellationURL.String(), nil)
+	transaction, err := gateway.Status(ctx, banktransactionID)
+	if err != nil {
+		log.Printf("Error in getting payment data for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return err
+	}
+	switch transaction.ActionCode {
+	case ActionCodeApproved:
+		err = gateway.Reverse(ctx, banktransactionID)
+	case ActionCodePending:
+		err = gateway.DeclineOrder(ctx, banktransactionID)
+	}
 	if err != nil {
-		log.Printf("Error in creating request for the order %s", strconv.Itoa(int(orderID)))
+		log.Printf("Error in getting cancellatiom data for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
 		return err
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return nil
+}
+
+// ErrNothingToRefund is returned when the order has no captured payment left to refund.
+var ErrNothingToRefund = errors.New("no paid transaction to refund")
+
+// ErrRefundExceedsPayment is returned when the refund is larger than the part of the payment not yet refunded.
+var ErrRefundExceedsPayment = orderstorage.ErrRefundExceedsPayment
 
-	client := http.DefaultClient
-	response, err := client.Do(request)
+// ErrNotCaptured is returned when the payment of the order is only held by the bank, the hold is reversed
+// by cancelling the order rather than refunded.
+var ErrNotCaptured = errors.New("payment is not captured")
+
+// RefundTransaction returns part or all of the order payment to the customer, recording the refund
+// whether or not the bank accepts it.
+func RefundTransaction(gateway PaymentGateway, store orderstorage.OrderStore, orderID uint, refundObj models.RequestRefund) (models.Refund, error) {
+
+	var refund models.Refund
+	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
+	// не забываем освободить ресурс
+	defer cancel()
 
+	transaction, err := store.LoadRefundableTransaction(ctx, orderID)
+	if err != nil {
+		log.Printf("Error in finding paid transaction for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return refund, ErrNothingToRefund
+	}
+	// the payment is captured on the way to print
+	status, err := store.LoadOrderStatus(ctx, orderID)
 	if err != nil {
-		log.Printf("Error in getting cancellatiom data for the order %s", strconv.Itoa(int(orderID)))
-		return errors.New("failed response from bank")
+		log.Printf("Error in finding status of the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return refund, err
+	}
+	if status == orderstatus.Paid {
+		return refund, ErrNotCaptured
+	}
+	if transaction.RefundedAmount+refundObj.Amount > transaction.Amount {
+		return refund, ErrRefundExceedsPayment
 	}
 
-	if response.StatusCode == http.StatusInternalServerError {
-		log.Printf("Internal server error happened when getting cancellatiom data %s order ", strconv.Itoa(int(orderID)))
-		return errors.New("failed response from bank")
+	refundID, err := store.CreateRefund(ctx, orderID, transaction.TransactionsID, refundObj)
+	if errors.Is(err, ErrRefundExceedsPayment) {
+		return refund, err
+	}
+	if err != nil {
+		log.Printf("Unable to create refund entry for the order %s", strconv.Itoa(int(orderID)))
+		return refund, err
+	}
+	refund = models.Refund{
+		RefundsID:      refundID,
+		OrdersID:       orderID,
+		TransactionsID: transaction.TransactionsID,
+		Amount:         refundObj.Amount,
+		Reason:         refundObj.Reason,
+		Status:         "SUCCESSFUL",
 	}
 
-	if response.StatusCode == http.StatusOK {
-		var transaction models.ResponseTransactionCancel
-		log.Println(response.Body)
-		err := json.NewDecoder(response.Body).Decode(&transaction)
-		defer response.Body.Close()
-		log.Println(transaction)
+	// orders paid before receipts were issued are refunded without one
+	var receipt models.Receipt
+	paymentReceipt, err := store.LoadPaymentReceipt(ctx, transaction.BankOrderID)
+	if err == nil {
+		receipt = BuildRefundReceipt(paymentReceipt, refundObj.Amount)
+	}
+	refundErr := gateway.Refund(ctx, transaction.BankOrderID, refundObj.Amount, receipt)
+	if refundErr != nil {
+		log.Printf("Error in refunding payment for the order %s. Err: %s", strconv.Itoa(int(orderID)), refundErr)
+		refund.Status = "FAILED"
+	} else if len(receipt.Items) > 0 {
+		err = store.CreateReceipt(ctx, transaction.BankOrderID, refundID, receipt)
 		if err != nil {
-			log.Printf("Unable to decode bank response for the order %s",  strconv.Itoa(int(orderID)))
-			return errors.New("failed reading response from bank")
+			log.Printf("Unable to store refund receipt for the order %s", strconv.Itoa(int(orderID)))
 		}
-		// need to be fixed
-		if transaction.ErrorCode != "7" && transaction.ErrorCode != "6"{
+	}
+	err = store.CompleteRefund(ctx, refundID, refundErr == nil)
+	if err != nil {
+		log.Printf("Unable to update refund entry for the order %s", strconv.Itoa(int(orderID)))
+		return refund, err
+	}
+	return refund, refundErr
+}
 
-			return errors.New("failed reading response from bank")
-		}
+// CaptureTransaction charges the amount held by the pre-authorized payment of the order and records
+// the result on the transaction. Orders with no bank payment to capture, e.g. marked paid by an admin, are left as they are.
+func CaptureTransaction(gateway PaymentGateway, store orderstorage.OrderStore, orderID uint) error {
 
+	ctx, cancel := context.WithTimeout(context.Background(), config.ContextDBTimeout)
+	// не забываем освободить ресурс
+	defer cancel()
+
+	transaction, err := store.LoadPaidTransaction(ctx, orderID)
+	if errors.Is(err, orderstorage.ErrNoPaidTransaction) {
+		log.Printf("No paid transaction to capture for the order %s", strconv.Itoa(int(orderID)))
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error in finding paid transaction for the order %s. Err: %s", strconv.Itoa(int(orderID)), err)
+		return err
+	}
+	if transaction.BankStatus == "CAPTURED" {
 		return nil
+	}
 
+	captureErr := gateway.Capture(ctx, transaction.BankOrderID, transaction.Amount)
+	captureError := ""
+	if captureErr != nil {
+		log.Printf("Error in capturing payment for the order %s. Err: %s", strconv.Itoa(int(orderID)), captureErr)
+		captureError = captureErr.Error()
 	}
-	return errors.New("failed response from bank")
-}
\ No newline at end of file
+	err = store.UpdateCapturedTransaction(ctx, transaction.TransactionsID, captureError)
+	if err != nil {
+		log.Printf("Unable to update transaction entry for the order %s", strconv.Itoa(int(orderID)))
+		if captureErr == nil {
+			return err
+		}
+	}
+	return captureErr
+}
@@ -0,0 +1,130 @@
+package transactions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
+	"github.com/SiberianMonster/memoryprint/internal/memstore"
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/SiberianMonster/memoryprint/internal/orderstorage"
+)
+
+// placeOrder checks out a photobook from the cart of the user 1, which leaves the order in PAYMENT_IN_PROGRESS.
+func placeOrder(t *testing.T, stores handlersfunc.Stores) uint {
+	ctx := context.Background()
+	price := models.Price{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", BasePrice: money.FromRoubles(1500), IncludedPages: 20}
+	if _, err := stores.Objects.CreatePriceList(ctx, models.PriceList{Name: "Test", Prices: []models.Price{price}}); err != nil {
+		t.Fatalf("an error '%s' was not expected when adding prices", err)
+	}
+	projectID, _ := stores.Projects.CreateProject(ctx, 1, models.NewBlankProjectObj{Size: "SQUARE", Variant: "STANDARD", Cover: "HARD", Surface: "MATTE", CountPages: 20})
+	item := models.CartItem{ProjectID: projectID, Quantity: 1}
+	if _, err := stores.Orders.AddCartItem(ctx, 1, item); err != nil {
+		t.Fatalf("an error '%s' was not expected when adding to the cart", err)
+	}
+	_, orderID, err := stores.Orders.OrderPayment(ctx, models.RequestOrderPayment{Cart: []models.CartItem{item}}, 1, money.Zero, 0)
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when paying for the order", err)
+	}
+	return orderID
+}
+
+func TestRefundTransaction(t *testing.T) {
+
+	gateway := NewFakeGateway("http://localhost:8080")
+	stores := memstore.NewStores()
+	ctx := context.Background()
+	orderID := placeOrder(t, stores)
+	if _, err := RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: money.FromRoubles(100), Reason: "misprint"}); !errors.Is(err, ErrNothingToRefund) {
+		t.Fatalf("expected an unpaid order not to be refunded, got %v", err)
+	}
+
+	_, err := CreateTransaction(gateway, stores.Orders, orderID, money.FromRoubles(1500), "PHOTOBOOK", models.Receipt{})
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when creating a transaction", err)
+	}
+	bankOrderID, _ := stores.Orders.GetBankTransactionID(ctx, orderID)
+	gateway.Approve(bankOrderID)
+	if _, err = FindTransactionStatus(gateway, stores.Orders, orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when confirming the payment", err)
+	}
+
+	// the held payment of a paid order is reversed rather than refunded
+	if _, err = RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: money.FromRoubles(500), Reason: "misprint"}); !errors.Is(err, ErrNotCaptured) {
+		t.Fatalf("expected the uncaptured payment not to be refunded, got %v", err)
+	}
+	if err = CaptureTransaction(gateway, stores.Orders, orderID); err != nil {
+		t.Fatalf("an error '%s' was not expected when capturing the payment", err)
+	}
+	if err = stores.Orders.UpdateOrderStatus(ctx, orderID, models.OrderStatusChange{FromStatus: "PAID", ToStatus: "IN_PRINT", Actor: "SYSTEM"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when sending the order to print", err)
+	}
+
+	refund, err := RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: money.FromRoubles(500), Reason: "misprint"})
+	if err != nil || refund.Status != "SUCCESSFUL" {
+		t.Fatalf("expected a successful partial refund, got %s, %v", refund.Status, err)
+	}
+	if _, err = RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: money.FromRoubles(1001), Reason: "misprint"}); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Fatalf("expected a refund over the paid amount to be rejected, got %v", err)
+	}
+	// the amount is checked again when the refund is recorded, so refunds issued at once can not exceed the payment
+	paid, _ := stores.Orders.LoadRefundableTransaction(ctx, orderID)
+	if _, err = stores.Orders.CreateRefund(ctx, orderID, paid.TransactionsID, models.RequestRefund{Amount: money.FromRoubles(1001), Reason: "misprint"}); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Fatalf("expected the refund over the paid amount not to be recorded, got %v", err)
+	}
+	order, _ := stores.Orders.RetrieveSingleOrder(ctx, orderID)
+	if order.Status != "IN_PRINT" {
+		t.Fatalf("expected a partially refunded order to stay IN_PRINT, got %s", order.Status)
+	}
+
+	if _, err = RefundTransaction(gateway, stores.Orders, orderID, models.RequestRefund{Amount: money.FromRoubles(1000), Reason: "misprint"}); err != nil {
+		t.Fatalf("an error '%s' was not expected when refunding the rest", err)
+	}
+	order, _ = stores.Orders.RetrieveSingleOrder(ctx, orderID)
+	if order.Status != "REFUNDED" {
+		t.Errorf("expected a fully refunded order to be REFUNDED, got %s", order.Status)
+	}
+	history, _ := stores.Orders.LoadOrderStatusHistory(ctx, orderID)
+	if last := history.History[len(history.History)-1]; last.FromStatus != "IN_PRINT" || last.ToStatus != "REFUNDED" || last.Actor != "ADMIN" {
+		t.Errorf("expected the refund to be recorded in the status history, got %v", last)
+	}
+	refunds, _ := stores.Orders.LoadRefunds(ctx, orderID)
+	if len(refunds.Refunds) != 2 {
+		t.Errorf("expected two refunds in the ledger, got %d", len(refunds.Refunds))
+	}
+}
+
+// unreachableStore is an order storage which can not read the paid transactions.
+type unreachableStore struct {
+	orderstorage.OrderStore
+}
+
+func (s unreachableStore) LoadPaidTransaction(ctx context.Context, orderID uint) (models.PaidTransactionObj, error) {
+	return models.PaidTransactionObj{}, errors.New("connection refused")
+}
+
+func TestCaptureTransaction(t *testing.T) {
+
+	gateway := NewFakeGateway("http://localhost:8080")
+	stores := memstore.NewStores()
+	ctx := context.Background()
+	orderID := placeOrder(t, stores)
+	// the order is marked paid by an admin, there is no bank payment to capture
+	stores.Orders.UpdateOrderStatus(ctx, orderID, models.OrderStatusChange{FromStatus: "PAYMENT_IN_PROGRESS", ToStatus: "PAID", Actor: "ADMIN"})
+
+	tests := []struct {
+		name    string
+		store   orderstorage.OrderStore
+		wantErr bool
+	}{
+		{"order without a paid transaction", stores.Orders, false},
+		{"storage not answering", unreachableStore{stores.Orders}, true},
+	}
+	for _, tt := range tests {
+		if err := CaptureTransaction(gateway, tt.store, orderID); (err != nil) != tt.wantErr {
+			t.Errorf("%s: expected an error %t, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
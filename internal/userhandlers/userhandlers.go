@@ -3,6 +3,7 @@ package userhandlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"strconv"
 	"regexp"
 	"github.com/gorilla/mux"
@@ -11,19 +12,29 @@ import (
 	"github.com/SiberianMonster/memoryprint/internal/emailutils"
 	"github.com/SiberianMonster/memoryprint/internal/fixturestorage"
 	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
 	"github.com/SiberianMonster/memoryprint/internal/userstorage"
-	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
 	"github.com/SiberianMonster/memoryprint/internal/handlersfunc"
 	"github.com/SiberianMonster/memoryprint/internal/authservice"
 	"github.com/SiberianMonster/memoryprint/internal/transactions"
 	"github.com/go-playground/validator/v10"
 	"log"
 	"net/http"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"time"
 
 )
 
+// Handler serves the user endpoints on top of the storages.
+type Handler struct {
+	handlersfunc.Stores
+	Payments transactions.PaymentGateway
+}
+
+// New returns a Handler using the given storages and payment gateway.
+func New(stores handlersfunc.Stores, payments transactions.PaymentGateway) *Handler {
+	return &Handler{Stores: stores, Payments: payments}
+}
+
 var (
     phoneRegex = `^((8|\+7)[\- ]?)?(\(?\d{3}\)?[\- ]?)?[\d\- ]{7,10}$` // regex that compiles
 )
@@ -51,7 +62,7 @@ type AdminBool struct {
 	CountPublished *uint `json:"count_published"`
 }
 
-func Register(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) Register(rw http.ResponseWriter, r *http.Request) {
 
 	var user models.SignUpUser
 	var signedUser models.User
@@ -90,7 +101,7 @@ func Register(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	if userstorage.CheckUser(ctx, config.DB, user.Email) {
+	if h.Users.CheckUser(ctx, user.Email) {
 		handlersfunc.HandleUsernameAlreadyTaken(rw)
 		return
 	}
@@ -125,13 +136,13 @@ func Register(rw http.ResponseWriter, r *http.Request) {
 	}
 
 	// Customer
-	userID, err = userstorage.CreateUser(ctx, config.DB, user)
+	userID, err = h.Users.CreateUser(ctx, user)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 
-	err = projectstorage.UpdateNewUserProjects(ctx, config.DB, user.Email, userID)
+	err = h.Projects.UpdateNewUserProjects(ctx, user.Email, userID)
 	if err != nil {
 		log.Printf("Error happened when updating photobooks for the new user. Err: %s", err)
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -159,7 +170,7 @@ func Register(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func Login(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) Login(rw http.ResponseWriter, r *http.Request) {
 
 	var user models.LoginUser
 	var loggedUser models.User
@@ -194,7 +205,7 @@ func Login(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	if !userstorage.CheckUser(ctx, config.DB, user.Email) {
+	if !h.Users.CheckUser(ctx, user.Email) {
 		handlersfunc.HandleUnregisteredUserError(rw)
 		return
 	}
@@ -202,7 +213,7 @@ func Login(rw http.ResponseWriter, r *http.Request) {
 	loggedUser.Email = user.Email
 	loggedUser.Password = user.Password
 	log.Println(loggedUser)
-	dbUser, err := userstorage.CheckCredentials(ctx, config.DB, loggedUser)
+	dbUser, err := h.Users.CheckCredentials(ctx, loggedUser)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -237,7 +248,7 @@ func Login(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func GetUserInfo(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetUserInfo(rw http.ResponseWriter, r *http.Request) {
 
 	
 	rw.Header().Set("Content-Type", "application/json")
@@ -251,7 +262,7 @@ func GetUserInfo(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	dbUser, err := userstorage.GetUserData(ctx, config.DB, userID)
+	dbUser, err := h.Users.GetUserData(ctx, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -269,7 +280,7 @@ func GetUserInfo(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func UpdateUsername(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUsername(rw http.ResponseWriter, r *http.Request) {
 
 	var updatedUser models.UpdatedUsername
 	rw.Header().Set("Content-Type", "application/json")
@@ -298,7 +309,7 @@ func UpdateUsername(rw http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	// не забываем освободить ресурс
 	defer cancel()
-	err = userstorage.UpdateUsername(ctx, config.DB, updatedUser.Name, userID)
+	err = h.Users.UpdateUsername(ctx, updatedUser.Name, userID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -315,7 +326,7 @@ func UpdateUsername(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func UpdateUserInfo(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UpdateUserInfo(rw http.ResponseWriter, r *http.Request) {
 
 	var updatedUser models.UpdatedUser
 	var dbUser models.User
@@ -353,7 +364,7 @@ func UpdateUserInfo(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	dbUser, err = userstorage.CheckCredentialsByID(ctx, config.DB, userID)
+	dbUser, err = h.Users.CheckCredentialsByID(ctx, userID)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -367,7 +378,7 @@ func UpdateUserInfo(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = userstorage.UpdateUser(ctx, config.DB, updatedUser.NewPassword, userID)
+	err = h.Users.UpdateUser(ctx, updatedUser.NewPassword, userID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -384,7 +395,7 @@ func UpdateUserInfo(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func CheckUserCategory(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CheckUserCategory(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]UserRespBody)
 	var uBody UserRespBody
@@ -394,13 +405,13 @@ func CheckUserCategory(rw http.ResponseWriter, r *http.Request) {
 
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	userCategory, name, email, err := userstorage.CheckUserCategory(ctx, config.DB, userID)
+	userCategory, name, email, err := h.Users.CheckUserCategory(ctx, userID)
 		
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
-	projects, err = userstorage.GetCart(ctx, config.DB, userID)
+	projects, err = h.Users.GetCart(ctx, userID)
 		
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -429,14 +440,14 @@ func CheckUserCategory(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func CancelSubscription(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CancelSubscription(rw http.ResponseWriter, r *http.Request) {
 
 		resp := make(map[string]uint)
 		code := mux.Vars(r)["code"]
 	
 		ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 		defer cancel()
-		err := userstorage.CancelSubscription(ctx, config.DB, code, config.EncryptionString)
+		err := h.Users.CancelSubscription(ctx, code, config.EncryptionString)
 			
 		if err != nil {
 			handlersfunc.HandleDatabaseServerError(rw)
@@ -453,14 +464,14 @@ func CancelSubscription(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func RenewSubscription(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) RenewSubscription(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	code := mux.Vars(r)["code"]
 
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	err := userstorage.RenewSubscription(ctx, config.DB, code, config.EncryptionString)
+	err := h.Users.RenewSubscription(ctx, code, config.EncryptionString)
 		
 	if err != nil {
 		handlersfunc.HandleFailedRenewSubscription(rw)
@@ -477,7 +488,7 @@ func RenewSubscription(rw http.ResponseWriter, r *http.Request) {
 
 }
 
-func MakeUserAdmin(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) MakeUserAdmin(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 
@@ -491,7 +502,7 @@ func MakeUserAdmin(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	userstorage.MakeUserAdmin(ctx, config.DB, userID) 
+	h.Users.MakeUserAdmin(ctx, userID) 
 	resp["response"] = 1
 	jsonResp, err := json.Marshal(resp)
 	if err != nil {
@@ -503,7 +514,7 @@ func MakeUserAdmin(rw http.ResponseWriter, r *http.Request) {
 }
 
 // CreateCertificate creates a new gift certificate entry.
-func CreateCertificate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreateCertificate(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]models.TransactionLink)
@@ -515,6 +526,7 @@ func CreateCertificate(rw http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&certificate)
 	if err != nil {
 		handlersfunc.HandleDecodeError(rw, err)
+		return
 	}
 
 	defer r.Body.Close()
@@ -536,12 +548,12 @@ func CreateCertificate(rw http.ResponseWriter, r *http.Request) {
 	// не забываем освободить ресурс
 	defer cancel()
 
-	cID, err = userstorage.CreateCertificate(ctx, config.DB, certificate)
+	cID, err = h.Users.CreateCertificate(ctx, certificate)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
-	transaction.PaymentLink, err = transactions.CreateTransaction(cID, certificate.Deposit, "CERTIFICATE")
+	transaction.PaymentLink, err = transactions.CreateTransaction(h.Payments, h.Orders, cID, certificate.Deposit, "CERTIFICATE", transactions.BuildCertificateReceipt(*certificate))
 	// Impossible to create payment link
 	if err != nil {
 		handlersfunc.HandleFailedPaymentURL(rw)
@@ -563,7 +575,7 @@ func CreateCertificate(rw http.ResponseWriter, r *http.Request) {
 
 
 // CreatePromocode creates a new promocode.
-func CreatePromocode(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CreatePromocode(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]uint)
@@ -593,7 +605,7 @@ func CreatePromocode(rw http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	
-	err = userstorage.CreatePromooffer(ctx, config.DB, promooffer)
+	err = h.Users.CreatePromooffer(ctx, promooffer)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -610,7 +622,7 @@ func CreatePromocode(rw http.ResponseWriter, r *http.Request) {
 }
 
 // CheckPromocode checks the validity of the code.
-func CheckPromocode(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) CheckPromocode(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]models.CheckPromocode)
@@ -643,7 +655,7 @@ func CheckPromocode(rw http.ResponseWriter, r *http.Request) {
 
 	userID := handlersfunc.UserIDContextReader(r)
 	
-	checkP, status, err = userstorage.CheckPromocode(ctx, config.DB, promooffer.Code, userID)
+	checkP, status, err = h.Users.CheckPromocode(ctx, promooffer.Code, userID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -658,6 +670,11 @@ func CheckPromocode(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status == "NOT STARTED" {
+		handlersfunc.HandlePromocodeNotStartedError(rw)
+		return
+	}
+
 	if status == "EXPIRED" {
 		handlersfunc.HandleExpiredError(rw)
 		return
@@ -678,7 +695,7 @@ func CheckPromocode(rw http.ResponseWriter, r *http.Request) {
 	rw.Write(jsonResp)
 }
 
-func LoadPromocodes(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) LoadPromocodes(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]models.Promooffers)
 	var rPromooffers []models.Promooffer
@@ -688,7 +705,7 @@ func LoadPromocodes(rw http.ResponseWriter, r *http.Request) {
 	
 	ctx, cancel := context.WithTimeout(r.Context(), config.ContextDBTimeout)
 	defer cancel()
-	rPromooffers, err := userstorage.LoadPromocodes(ctx, config.DB)
+	rPromooffers, err := h.Users.LoadPromocodes(ctx)
 
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
@@ -708,7 +725,7 @@ func LoadPromocodes(rw http.ResponseWriter, r *http.Request) {
 }
 
 // UsePromocode applies promocode to the published projects.
-func UsePromocode(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UsePromocode(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	resp := make(map[string]models.ResponsePromocodeUse)
@@ -740,13 +757,7 @@ func UsePromocode(rw http.ResponseWriter, r *http.Request) {
 
 	userID := handlersfunc.UserIDContextReader(r)
 	
-	_, status, err = userstorage.CheckPromocode(ctx, config.DB, requestP.Code, userID)
-	if err != nil {
-		handlersfunc.HandleDatabaseServerError(rw)
-		return
-	}
-	
-	responseP, err = userstorage.UsePromocode(ctx, config.DB, requestP)
+	_, status, err = h.Users.CheckPromocode(ctx, requestP.Code, userID)
 	if err != nil {
 		handlersfunc.HandleDatabaseServerError(rw)
 		return
@@ -761,6 +772,11 @@ func UsePromocode(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if status == "NOT STARTED" {
+		handlersfunc.HandlePromocodeNotStartedError(rw)
+		return
+	}
+
 	if status == "EXPIRED" {
 		handlersfunc.HandleExpiredError(rw)
 		return
@@ -770,8 +786,18 @@ func UsePromocode(rw http.ResponseWriter, r *http.Request) {
 		handlersfunc.HandleAlreadyUsedError(rw)
 		return
 	}
-	if status == "VALID" && responseP.BasePrice == responseP.DiscountedPrice {
-		handlersfunc.HandleWrongPromocodeCategoryError(rw)
+	
+	// the rules of the promotion on the cart itself: the minimum order value, the targeted books, the gift certificate
+	responseP, err = h.Users.UsePromocode(ctx, requestP)
+	if errors.Is(err, pricing.ErrPageCount) {
+		handlersfunc.HandlePageCountError(rw)
+		return
+	}
+	if handlersfunc.HandlePromotionError(rw, err) {
+		return
+	}
+	if err != nil {
+		handlersfunc.HandleDatabaseServerError(rw)
 		return
 	}
 	
@@ -786,7 +812,7 @@ func UsePromocode(rw http.ResponseWriter, r *http.Request) {
 }
 
 // UseCertificate applies gift certificate to the published projects.
-func UseCertificate(rw http.ResponseWriter, r *http.Request) {
+func (h *Handler) UseCertificate(rw http.ResponseWriter, r *http.Request) {
 
 	rw.Header().Set("Content-Type", "application/json")
 	code := mux.Vars(r)["code"]
@@ -802,7 +828,7 @@ func UseCertificate(rw http.ResponseWriter, r *http.Request) {
 
 	userID := handlersfunc.UserIDContextReader(r)
 	
-	deposit, status, err := userstorage.UseCertificate(ctx, config.DB, code, userID)
+	deposit, status, err := h.Users.UseCertificate(ctx, code, userID)
 	if status == "INVALID" {
 		handlersfunc.HandleWrongGiftCodeError(rw)
 		return
@@ -824,7 +850,7 @@ func UseCertificate(rw http.ResponseWriter, r *http.Request) {
 }
 
 
-func SentGiftCertificateMail(ctx context.Context, storeDB *pgxpool.Pool) {
+func (h *Handler) SentGiftCertificateMail(ctx context.Context) {
 
 	ticker := time.NewTicker(config.UpdateInterval)
 	var err error
@@ -835,7 +861,7 @@ func SentGiftCertificateMail(ctx context.Context, storeDB *pgxpool.Pool) {
 		go func() {
 			for job := range jobCh {
 	
-				err = userstorage.MailCertificate(ctx, storeDB, job)
+				err = h.Users.MailCertificate(ctx, job)
 				if err != nil {
 					log.Printf("Error happened when updating pending gift certificates. Err: %s", err)
 					continue
@@ -846,7 +872,7 @@ func SentGiftCertificateMail(ctx context.Context, storeDB *pgxpool.Pool) {
 
 	for range ticker.C {
 
-		certificateList, err = userstorage.LoadUnSentCertificate(ctx, storeDB)
+		certificateList, err = h.Users.LoadUnSentCertificate(ctx)
 		if err != nil {
 			log.Printf("Error happened when retrieving pending gift certificates. Err: %s", err)
 			continue
@@ -860,7 +886,61 @@ func SentGiftCertificateMail(ctx context.Context, storeDB *pgxpool.Pool) {
 	}
 }
 
-func RenewFixtures(rw http.ResponseWriter, r *http.Request) {
+// reconcileCertificatePayment asks the acquirer about the payment of the gift certificate and cancels the certificate
+// once it has stayed unpaid for longer than config.PaymentExpiryWindow. The certificate is only cancelled
+// when the acquirer has answered that the payment is pending, or when no payment was registered.
+func (h *Handler) reconcileCertificatePayment(ctx context.Context, certificate models.PendingCertificateObj) error {
+
+	status, err := transactions.FindCertificateTransactionStatus(h.Payments, h.Users, certificate.GiftcertificatesID)
+	if status == "SUCCESSFUL" || status == "UNSUCCESSFUL" {
+		return nil
+	}
+	if err != nil && !errors.Is(err, userstorage.ErrNoBankOrder) {
+		log.Printf("Error happened when checking payment status for the gift certificate %d. Err: %s", certificate.GiftcertificatesID, err)
+		return err
+	}
+	if time.Since(certificate.CreatedAt) < config.PaymentExpiryWindow {
+		return nil
+	}
+	return h.Users.CancelCertificatePayment(ctx, certificate.GiftcertificatesID)
+}
+
+func (h *Handler) ReconcileCertificatePayments(ctx context.Context) {
+
+	ticker := time.NewTicker(config.UpdateInterval)
+	var err error
+	var certificateList []models.PendingCertificateObj
+
+	jobCh := make(chan models.PendingCertificateObj)
+	for i := 0; i < config.WorkersCount; i++ {
+		go func() {
+			for job := range jobCh {
+
+				err := h.reconcileCertificatePayment(ctx, job)
+				if err != nil {
+					log.Printf("Error happened when cancelling unpaid gift certificate. Err: %s", err)
+					continue
+				}
+			}
+		}()
+	}
+
+	for range ticker.C {
+
+		certificateList, err = h.Users.LoadPendingCertificates(ctx)
+		if err != nil {
+			log.Printf("Error happened when retrieving unpaid gift certificates. Err: %s", err)
+			continue
+		}
+
+		for _, certificate := range certificateList {
+			jobCh <- certificate
+		}
+
+	}
+}
+
+func (h *Handler) RenewFixtures(rw http.ResponseWriter, r *http.Request) {
 
 	resp := make(map[string]uint)
 	
@@ -0,0 +1,158 @@
+package userstorage
+
+import (
+	"context"
+
+	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// UserStore is the storage of users, promocodes and gift certificates used by the handlers.
+type UserStore interface {
+	CheckUser(ctx context.Context, email string) bool
+	CheckUserHasProject(ctx context.Context, userID uint, projectID uint) bool
+	CheckUserHasOrder(ctx context.Context, userID uint, orderID uint) bool
+	GetUserData(ctx context.Context, userID uint) (models.UserInfo, error)
+	GetUserID(ctx context.Context, userEmail string) (uint, error)
+	CreateUser(ctx context.Context, u models.SignUpUser) (uint, error)
+	UpdateUser(ctx context.Context, password string, userID uint) error
+	CheckCredentials(ctx context.Context, u models.User) (models.User, error)
+	CheckCredentialsByID(ctx context.Context, userID uint) (models.User, error)
+	CheckUserCategory(ctx context.Context, userID uint) (string, string, string, error)
+	MakeUserAdmin(ctx context.Context, userID uint)
+	UpdateUsername(ctx context.Context, userName string, userID uint) error
+	CreateCertificate(ctx context.Context, c *models.GiftCertificate) (uint, error)
+	CreatePromooffer(ctx context.Context, p *models.NewPromooffer) error
+	CheckPromocode(ctx context.Context, code string, usersID uint) (models.CheckPromocode, string, error)
+	UsePromocode(ctx context.Context, requestP models.RequestPromooffer) (models.ResponsePromocodeUse, error)
+	UseCertificate(ctx context.Context, code string, userID uint) (money.Money, string, error)
+	LoadPromocodes(ctx context.Context) ([]models.Promooffer, error)
+	LoadUnSentCertificate(ctx context.Context) ([]models.GiftCertificate, error)
+	MailCertificate(ctx context.Context, certificate models.GiftCertificate) error
+	GetCertificateBankTransactionID(ctx context.Context, cID uint) (string, error)
+	PurchaseCertificate(ctx context.Context, cID uint) error
+	CancelCertificatePayment(ctx context.Context, cID uint) error
+	LoadPendingCertificates(ctx context.Context) ([]models.PendingCertificateObj, error)
+	CancelSubscription(ctx context.Context, code string, iv string) error
+	RenewSubscription(ctx context.Context, code string, iv string) error
+	GetCart(ctx context.Context, userID uint) (uint, error)
+}
+
+// PgUserStore implements UserStore on top of the postgres connection pool.
+type PgUserStore struct {
+	DB *pgxpool.Pool
+}
+
+// NewPgUserStore returns a UserStore backed by the given pool.
+func NewPgUserStore(storeDB *pgxpool.Pool) *PgUserStore {
+	return &PgUserStore{DB: storeDB}
+}
+
+func (s *PgUserStore) CheckUser(ctx context.Context, email string) bool {
+	return CheckUser(ctx, s.DB, email)
+}
+
+func (s *PgUserStore) CheckUserHasProject(ctx context.Context, userID uint, projectID uint) bool {
+	return CheckUserHasProject(ctx, s.DB, userID, projectID)
+}
+
+func (s *PgUserStore) CheckUserHasOrder(ctx context.Context, userID uint, orderID uint) bool {
+	return CheckUserHasOrder(ctx, s.DB, userID, orderID)
+}
+
+func (s *PgUserStore) GetUserData(ctx context.Context, userID uint) (models.UserInfo, error) {
+	return GetUserData(ctx, s.DB, userID)
+}
+
+func (s *PgUserStore) GetUserID(ctx context.Context, userEmail string) (uint, error) {
+	return GetUserID(ctx, s.DB, userEmail)
+}
+
+func (s *PgUserStore) CreateUser(ctx context.Context, u models.SignUpUser) (uint, error) {
+	return CreateUser(ctx, s.DB, u)
+}
+
+func (s *PgUserStore) UpdateUser(ctx context.Context, password string, userID uint) error {
+	return UpdateUser(ctx, s.DB, password, userID)
+}
+
+func (s *PgUserStore) CheckCredentials(ctx context.Context, u models.User) (models.User, error) {
+	return CheckCredentials(ctx, s.DB, u)
+}
+
+func (s *PgUserStore) CheckCredentialsByID(ctx context.Context, userID uint) (models.User, error) {
+	return CheckCredentialsByID(ctx, s.DB, userID)
+}
+
+func (s *PgUserStore) CheckUserCategory(ctx context.Context, userID uint) (string, string, string, error) {
+	return CheckUserCategory(ctx, s.DB, userID)
+}
+
+func (s *PgUserStore) MakeUserAdmin(ctx context.Context, userID uint) {
+	MakeUserAdmin(ctx, s.DB, userID)
+}
+
+func (s *PgUserStore) UpdateUsername(ctx context.Context, userName string, userID uint) error {
+	return UpdateUsername(ctx, s.DB, userName, userID)
+}
+
+func (s *PgUserStore) CreateCertificate(ctx context.Context, c *models.GiftCertificate) (uint, error) {
+	return CreateCertificate(ctx, s.DB, c)
+}
+
+func (s *PgUserStore) CreatePromooffer(ctx context.Context, p *models.NewPromooffer) error {
+	return CreatePromooffer(ctx, s.DB, p)
+}
+
+func (s *PgUserStore) CheckPromocode(ctx context.Context, code string, usersID uint) (models.CheckPromocode, string, error) {
+	return CheckPromocode(ctx, s.DB, code, usersID)
+}
+
+func (s *PgUserStore) UsePromocode(ctx context.Context, requestP models.RequestPromooffer) (models.ResponsePromocodeUse, error) {
+	return UsePromocode(ctx, s.DB, requestP)
+}
+
+func (s *PgUserStore) UseCertificate(ctx context.Context, code string, userID uint) (money.Money, string, error) {
+	return UseCertificate(ctx, s.DB, code, userID)
+}
+
+func (s *PgUserStore) LoadPromocodes(ctx context.Context) ([]models.Promooffer, error) {
+	return LoadPromocodes(ctx, s.DB)
+}
+
+func (s *PgUserStore) LoadUnSentCertificate(ctx context.Context) ([]models.GiftCertificate, error) {
+	return LoadUnSentCertificate(ctx, s.DB)
+}
+
+func (s *PgUserStore) MailCertificate(ctx context.Context, certificate models.GiftCertificate) error {
+	return MailCertificate(ctx, s.DB, certificate)
+}
+
+func (s *PgUserStore) GetCertificateBankTransactionID(ctx context.Context, cID uint) (string, error) {
+	return GetCertificateBankTransactionID(ctx, s.DB, cID)
+}
+
+func (s *PgUserStore) PurchaseCertificate(ctx context.Context, cID uint) error {
+	return PurchaseCertificate(ctx, s.DB, cID)
+}
+
+func (s *PgUserStore) CancelCertificatePayment(ctx context.Context, cID uint) error {
+	return CancelCertificatePayment(ctx, s.DB, cID)
+}
+
+func (s *PgUserStore) LoadPendingCertificates(ctx context.Context) ([]models.PendingCertificateObj, error) {
+	return LoadPendingCertificates(ctx, s.DB)
+}
+
+func (s *PgUserStore) CancelSubscription(ctx context.Context, code string, iv string) error {
+	return CancelSubscription(ctx, s.DB, code, iv)
+}
+
+func (s *PgUserStore) RenewSubscription(ctx context.Context, code string, iv string) error {
+	return RenewSubscription(ctx, s.DB, code, iv)
+}
+
+func (s *PgUserStore) GetCart(ctx context.Context, userID uint) (uint, error) {
+	return GetCart(ctx, s.DB, userID)
+}
@@ -10,7 +10,10 @@ import (
 	"github.com/SiberianMonster/memoryprint/internal/config"
 	"github.com/SiberianMonster/memoryprint/internal/emailutils"
 	"github.com/SiberianMonster/memoryprint/internal/models"
+	"github.com/SiberianMonster/memoryprint/internal/money"
 	"github.com/SiberianMonster/memoryprint/internal/projectstorage"
+	"github.com/SiberianMonster/memoryprint/internal/pricing"
+	"github.com/SiberianMonster/memoryprint/internal/promotions"
 	"log"
 	"bytes"
 	"crypto/aes"
@@ -111,36 +114,6 @@ func GetAESEncrypted(plaintext string) (string, error) {
 	return str, nil
 }
 
-func CalculateBasePriceByID(ctx context.Context, storeDB *pgxpool.Pool, pID uint) (float64, error) {
-
-	var totalBaseprice float64
-	var basePrice float64
-	var extraPriceperpage float64
-	var size, variant, cover string
-	var countPages int
-
-	err := storeDB.QueryRow(ctx, "SELECT size, variant, cover, count_pages FROM projects WHERE projects_id = ($1);", pID).Scan(&size, &variant, &cover, &countPages)
-	
-	if err != nil {
-		log.Printf("Error happened when retrieving project data from pgx table. Err: %s", err)
-		return totalBaseprice, err
-	}
-
-	err = storeDB.QueryRow(ctx, "SELECT baseprice, extrapage FROM prices WHERE size = ($1) AND variant = ($2) AND cover = ($3);", size, variant, cover).Scan(&basePrice, &extraPriceperpage)
-	
-	if err != nil {
-		log.Printf("Error happened when retrieving base price from pgx table. Err: %s", err)
-		return totalBaseprice, err
-	}
-	
-	extraPrice := extraPriceperpage*float64((countPages-23))
-	totalBaseprice = basePrice + extraPrice
-
-
-	return totalBaseprice, nil
-	
-}
-
 func CheckUser(ctx context.Context, storeDB *pgxpool.Pool, email string) bool {
 
 	var userBool bool
@@ -201,16 +174,9 @@ func GetUserData(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (model
 		log.Printf("Error happened when checking if user is in db. Err: %s", err)
 		return dbUser, err
 	}
-	var orderID uint
-	err = storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) and status = ($2) ORDER BY created_at;", userID, "AWAITING PAYMENT").Scan(&orderID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-				log.Printf("Error happened when retrieving unpaid order info from pgx table. Err: %s", err)
-				return dbUser, err
-	}
-
-	err = storeDB.QueryRow(ctx, "SELECT COUNT(projects_id) FROM orders_has_projects WHERE orders_id = ($1);", orderID).Scan(&dbUser.CartObjects)
+	err = storeDB.QueryRow(ctx, "SELECT COALESCE(SUM(ci.quantity), 0) FROM cart_items ci JOIN carts c ON c.carts_id = ci.carts_id WHERE c.users_id = ($1);", userID).Scan(&dbUser.CartObjects)
 	if err != nil && err != pgx.ErrNoRows{
-				log.Printf("Error happened when counting projects for order in pgx table. Err: %s", err)
+				log.Printf("Error happened when counting copies in the cart in pgx table. Err: %s", err)
 				return dbUser, err
 	}
 	return dbUser, nil
@@ -513,7 +479,7 @@ func CreateCertificate(ctx context.Context, storeDB *pgxpool.Pool, c *models.Gif
 	t := time.Now()
 	code := GenerateRandomString(12)
 
-	err = storeDB.QueryRow(ctx, "INSERT INTO giftcertificates (code, initialdeposit, currentdeposit, status, created_at, receipientemail, reciepientname, buyerfirstname, buyerlastname, buyeremail, buyerphone, mail_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING giftcertificates_id;",
+	err = storeDB.QueryRow(ctx, "INSERT INTO giftcertificates (code, initialdeposit, currentdeposit, status, created_at, receipientemail, reciepientname, buyerfirstname, buyerlastname, buyeremail, buyerphone, mail_at, mail_sent) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, false) RETURNING giftcertificates_id;",
 		code,
 		c.Deposit,
 		c.Deposit,
@@ -535,36 +501,135 @@ func CreateCertificate(ctx context.Context, storeDB *pgxpool.Pool, c *models.Gif
 	return cID, nil
 }
 
-func PurchaseCertificate(ctx context.Context, storeDB *pgxpool.Pool, cID uint, tID uint) (uint, error) {
+// ErrNoBankOrder is returned by GetCertificateBankTransactionID when no payment has been registered with the acquirer for the gift certificate.
+var ErrNoBankOrder = errors.New("no payment is registered for the gift certificate")
+
+// GetCertificateBankTransactionID function performs the operation of retrieving the latest bank transaction id for gift certificate from pgx database with a query.
+func GetCertificateBankTransactionID(ctx context.Context, storeDB *pgxpool.Pool, cID uint) (string, error) {
 
-	_, err = storeDB.Exec(ctx, "INSERT INTO giftcertificates_has_transactions (giftcertificates_id, transactions_id) VALUES ($1, $2);",
+	var bankID string
+	err := storeDB.QueryRow(ctx, "SELECT t.bankorderid FROM transactions t JOIN giftcertificates_has_transactions gt ON gt.transactions_id = t.transactions_id WHERE gt.giftcertificates_id = ($1) ORDER BY t.transactions_id DESC LIMIT 1;", cID).Scan(&bankID)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && bankID == "" {
+		return bankID, ErrNoBankOrder
+	}
+	if err != nil {
+		log.Printf("Error happened when retrieving gift certificate transaction info from pgx table. Err: %s", err)
+		return bankID, err
+	}
+	return bankID, nil
+}
+
+// PurchaseCertificate function performs the operation of activating a paid gift certificate in pgx database with a query.
+func PurchaseCertificate(ctx context.Context, storeDB *pgxpool.Pool, cID uint) (error) {
+
+	// only a certificate waiting for payment can be activated, so repeated confirmations are ignored
+	tag, err := storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2) AND status = ($3);",
+		"PAID",
 		cID,
-		tID,
+		"CREATED",
 	)
+	if err != nil {
+		log.Printf("Error happened when activating gift certificate into pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
 
-	_, err = storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2);",
-		"PAID",
+	_, err = storeDB.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE transactions_id = (SELECT MAX(transactions_id) FROM giftcertificates_has_transactions WHERE giftcertificates_id = ($2));",
+		"SUCCESSFUL",
 		cID,
-		
 	)
 	if err != nil {
-		log.Printf("Error happened when inserting a new gift certificate entry into pgx table. Err: %s", err)
-		return cID, err
+		log.Printf("Error happened when updating gift certificate transaction status into pgx table. Err: %s", err)
+		return err
 	}
 
-	return cID, nil
+	return nil
 }
 
+// CancelCertificatePayment function performs the operation of cancelling an unpaid gift certificate in pgx database with a query.
+func CancelCertificatePayment(ctx context.Context, storeDB *pgxpool.Pool, cID uint) (error) {
+
+	tag, err := storeDB.Exec(ctx, "UPDATE giftcertificates SET status = ($1) WHERE giftcertificates_id = ($2) AND status = ($3);",
+		"CANCELLED",
+		cID,
+		"CREATED",
+	)
+	if err != nil {
+		log.Printf("Error happened when cancelling gift certificate into pgx table. Err: %s", err)
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	_, err = storeDB.Exec(ctx, "UPDATE transactions SET status = ($1) WHERE status = ($2) AND transactions_id IN (SELECT transactions_id FROM giftcertificates_has_transactions WHERE giftcertificates_id = ($3));",
+		"UNSUCCESSFUL",
+		"INPROGRESS",
+		cID,
+	)
+	if err != nil {
+		log.Printf("Error happened when updating gift certificate transaction status into pgx table. Err: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadPendingCertificates function performs the operation of retrieving gift certificates waiting for payment from pgx database with a query.
+func LoadPendingCertificates(ctx context.Context, storeDB *pgxpool.Pool) ([]models.PendingCertificateObj, error) {
+
+	var certificates []models.PendingCertificateObj
+
+	rows, err := storeDB.Query(ctx, "SELECT giftcertificates_id, created_at FROM giftcertificates WHERE status = ($1);", "CREATED")
+	if err != nil {
+		log.Printf("Error happened when retrieving pending gift certificates from pgx table. Err: %s", err)
+		return certificates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var certificate models.PendingCertificateObj
+		if err = rows.Scan(&certificate.GiftcertificatesID, &certificate.CreatedAt); err != nil {
+			log.Printf("Error happened when scanning pending gift certificates. Err: %s", err)
+			return certificates, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	return certificates, nil
+}
+
+// CreatePromooffer function performs the operation of inserting the promocode with the rules of its promotion into pgx database
+// with a query. A one-time promocode is a promocode of a single redemption.
 func CreatePromooffer(ctx context.Context, storeDB *pgxpool.Pool, p *models.NewPromooffer) (error) {
 
-	_, err = storeDB.Exec(ctx, "INSERT INTO promooffers (code, discount, category, is_onetime, expires_at, users_id, is_used) VALUES ($1, $2, $3, $4, $5, $6, $7);",
+	discountType := p.DiscountType
+	if discountType == "" {
+		discountType = promotions.TypePercent
+	}
+	maxRedemptions := p.MaxRedemptions
+	if p.IsOnetime {
+		maxRedemptions = 1
+	}
+	_, err = storeDB.Exec(ctx, "INSERT INTO promooffers (code, discount_type, discount, amount, category, min_order_value, max_redemptions, per_user_limit, starts_at, is_onetime, expires_at, users_id, is_used, sizes, variants, covers, excludes_certificate) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17);",
 		p.Code,
+		discountType,
 		p.Discount,
+		p.Amount,
 		p.Category,
+		p.MinOrderValue,
+		maxRedemptions,
+		p.PerUserLimit,
+		p.StartsAt,
 		p.IsOnetime,
 		p.ExpiresAt,
 		p.UsersID,
 		false,
+		append([]string{}, p.Sizes...),
+		append([]string{}, p.Variants...),
+		append([]string{}, p.Covers...),
+		p.ExcludesCertificate,
 	)
 	if err != nil {
 		log.Printf("Error happened when inserting a new promocode entry into pgx table. Err: %s", err)
@@ -574,99 +639,81 @@ func CreatePromooffer(ctx context.Context, storeDB *pgxpool.Pool, p *models.NewP
 	return nil
 }
 
+// CheckPromocode function performs the operation of checking whether the user can redeem the promocode now
+// by the rules of its promotion, see promotions.Check. It returns the promotion with the status of the check.
 func CheckPromocode(ctx context.Context, storeDB *pgxpool.Pool, code string, usersID uint) (models.CheckPromocode, string, error) {
 
 	var promooffer models.CheckPromocode
-	var responseP models.ResponsePromocode
-	var userID uint
-	var isUsed bool
-	var isOnetime bool
-	var status string
-	now:=time.Now()
-		
-	err = storeDB.QueryRow(ctx, "SELECT discount, category, is_onetime, is_used, expires_at, users_id FROM promooffers WHERE code=($1);", code).Scan(&responseP.Discount, &responseP.Category, &isOnetime, &isUsed, &responseP.ExpiresAt, &userID)
-	tm := time.Unix(responseP.ExpiresAt, 0)
-	log.Println(tm)
 
-	if err != nil && err != pgx.ErrNoRows { 
+	p, err := promotions.LoadPromotion(ctx, storeDB, code)
+	if errors.Is(err, promotions.ErrUnknownCode) {
+		return promooffer, "INVALID", nil
+	}
+	if err != nil {
 		log.Printf("Error happened when retrieving promooffer data from the db. Err: %s", err)
-		return promooffer, status, err
+		return promooffer, "", err
 	}
-	if err == pgx.ErrNoRows {
-		status = "INVALID"
-		return promooffer, status, nil
+	usage, err := promotions.LoadUsage(ctx, storeDB, p.ID, usersID)
+	if err != nil {
+		return promooffer, "", err
 	}
-	if userID != 0 {
-		if userID != usersID {
-			status = "FORBIDDEN"
-			return promooffer, status, nil
-		}
-
-	} 
-	if isOnetime == true && isUsed == true {
-		status = "ALREADY USED"
-		return promooffer, status, nil
-
-	} 
-	if now.After(tm) || now.Equal(tm) {
-		status = "EXPIRED"
-		return promooffer, status, nil
+	status := promotions.Status(promotions.Check(p, usage, usersID, time.Now()))
+	if status == "VALID" {
+		promooffer.Promocode = promotions.Describe(p)
 	}
-	status = "VALID"
-	promooffer.Promocode = responseP
 	return promooffer, status, nil
 }
 
 
+// UsePromocode function performs the operation of pricing the cart with the promocode applied, see promotions.Apply.
+// The redemption limits of the promocode are checked by CheckPromocode, the errors of the promotion rules are returned.
+// The cart is priced without a discount when no code is given.
 func UsePromocode(ctx context.Context, storeDB *pgxpool.Pool, requestP models.RequestPromooffer) (models.ResponsePromocodeUse, error) {
 
 	var responseP models.ResponsePromocodeUse
-	var err error
-	var categoryPC string
-	var discount float64
-	var totalPrice float64
-	var totalBasePrice float64
-	err = storeDB.QueryRow(ctx, "SELECT promooffers_id, category, discount FROM promooffers WHERE code=($1);", requestP.Code).Scan(&responseP.PromocodeID, &categoryPC, &discount)
-	if err != nil && err != pgx.ErrNoRows { 
-		log.Printf("Error happened when retrieving promooffer category from the db. Err: %s", err)
+
+	// the promocode is taken off the books it targets, on top of the volume discount of the order
+	breakdown, err := pricing.QuoteCart(ctx, storeDB, requestP.Cart, requestP.PackageBox)
+	if err != nil {
+		log.Printf("Error happened when pricing the projects. Err: %s", err)
 		return responseP, err
 	}
-	
-	for _, projectID := range requestP.Projects {
-		var projectP float64
-		var categoryP string
-		projectP, err = CalculateBasePriceByID(ctx, storeDB, projectID)
-        err = storeDB.QueryRow(ctx, "SELECT category FROM projects WHERE projects_id=($1);", projectID).Scan(&categoryP)
-		if err != nil && err != pgx.ErrNoRows { 
-			log.Printf("Error happened when retrieving promooffer category from the db. Err: %s", err)
-			return responseP, err
-		}
-		totalBasePrice = totalBasePrice + projectP
-		if categoryPC != "" {
-			responseP.Category = categoryPC
-			if categoryPC == categoryP {
-				responseP.Discount = discount
-				projectP = projectP*(1-discount)
-			}
-		} else {
-			responseP.Discount = discount
-			projectP = projectP*(1-discount)
-		}
-		totalPrice = totalPrice + projectP
+	responseP.BasePrice = breakdown.Total
+	responseP.DiscountedPrice = breakdown.Total
+	responseP.Breakdown = breakdown
+	if requestP.Code == "" {
+		return responseP, nil
+	}
+
+	p, err := promotions.LoadPromotion(ctx, storeDB, requestP.Code)
+	if err != nil {
+		return responseP, err
 	}
-	responseP.BasePrice = totalBasePrice
-	responseP.DiscountedPrice = totalPrice
-	log.Println(totalBasePrice)
-	log.Println(totalPrice)
+	books, err := promotions.LoadBooks(ctx, storeDB, requestP.Cart)
+	if err != nil {
+		return responseP, err
+	}
+	result, err := promotions.Apply(p, promotions.Order{Books: books, Breakdown: breakdown, Certificate: requestP.Giftcertificate != ""})
+	if err != nil {
+		return responseP, err
+	}
+	responseP.PromocodeID = p.ID
+	responseP.DiscountType = p.Type
+	responseP.Discount = p.Discount
+	responseP.Amount = p.Amount
+	responseP.FreeShipping = p.Type == promotions.TypeFreeShipping
+	responseP.Category = p.Category
+	responseP.DiscountedPrice = breakdown.Total - result.Discount
+	responseP.Breakdown = result.Breakdown
 	
 	return responseP, nil
 
 }
 
-func CheckCertificate(ctx context.Context, storeDB *pgxpool.Pool, code string, users_id uint) (string, float64, error) {
+func CheckCertificate(ctx context.Context, storeDB *pgxpool.Pool, code string, users_id uint) (string, money.Money, error) {
 
 	var status string
-	var deposit float64
+	var deposit money.Money
 	var email string
 	var recipientEmail string
 
@@ -696,7 +743,7 @@ func CheckCertificate(ctx context.Context, storeDB *pgxpool.Pool, code string, u
 	return status, deposit, err
 }
 
-func UseCertificate(ctx context.Context, storeDB *pgxpool.Pool, code string, userID uint) (float64, string, error) {
+func UseCertificate(ctx context.Context, storeDB *pgxpool.Pool, code string, userID uint) (money.Money, string, error) {
 
 	status, deposit, err := CheckCertificate(ctx, storeDB, code, userID)
 	if err != nil && err != pgx.ErrNoRows { 
@@ -725,7 +772,7 @@ func LoadPromocodes(ctx context.Context, storeDB *pgxpool.Pool) ([]models.Promoo
 	promocodes := []models.Promooffer{}
 	now:=time.Now()
 
-	rows, err := storeDB.Query(ctx, "SELECT code, discount, category, expires_at FROM promooffers WHERE users_id = ($1);", 0)
+	rows, err := storeDB.Query(ctx, "SELECT code, discount_type, discount, amount, category, expires_at FROM promooffers WHERE users_id = ($1) AND starts_at <= ($2);", 0, now.Unix())
 	if err != nil {
 			log.Printf("Error happened when retrieving promocodes from pgx table. Err: %s", err)
 			return promocodes, err
@@ -735,7 +782,7 @@ func LoadPromocodes(ctx context.Context, storeDB *pgxpool.Pool) ([]models.Promoo
 	for rows.Next() {
 
 			var pObj models.Promooffer
-			if err = rows.Scan(&pObj.Code, &pObj.Discount, &pObj.Category, &pObj.ExpiresAt); err != nil {
+			if err = rows.Scan(&pObj.Code, &pObj.DiscountType, &pObj.Discount, &pObj.Amount, &pObj.Category, &pObj.ExpiresAt); err != nil {
 				log.Printf("Error happened when scanning promooffers. Err: %s", err)
 				return promocodes, err
 			}
@@ -762,21 +809,20 @@ func LoadUnSentCertificate(ctx context.Context, storeDB *pgxpool.Pool) ([]models
 
 	var certificates []models.GiftCertificate
 
-	rows, err := storeDB.Query(ctx, "SELECT giftcertificates_id, mail_at FROM giftcertificates WHERE mail_sent = ($1);", false)
+	// unpaid certificates are never mailed, so their code can not reach the recipient
+	rows, err := storeDB.Query(ctx, "SELECT giftcertificates_id, code, currentdeposit, receipientemail, reciepientname, mail_at FROM giftcertificates WHERE COALESCE(mail_sent, false) = ($1) AND status IN ($2, $3);", false, "PAID", "RESERVED")
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 				log.Printf("Error happened when retrieving unmailed certificates from pgx table. Err: %s", err)
 				return certificates, err
 	}
+	defer rows.Close()
 
-	
 	for rows.Next() {
 		var certificate models.GiftCertificate
-		var mailATStorage time.Time
-		if err = rows.Scan(&certificate.ID, &certificate.Code, &certificate.Deposit, &certificate.Recipientemail, &certificate.Recipientname, &mailATStorage); err != nil {
+		if err = rows.Scan(&certificate.ID, &certificate.Code, &certificate.Deposit, &certificate.Recipientemail, &certificate.Recipientname, &certificate.MailAt); err != nil {
 			log.Printf("Error happened when scanning certificates. Err: %s", err)
 			return certificates, err
 		}
-		certificate.MailAt = mailATStorage.Unix()
 
 		certificates = append(certificates, certificate)
 	}
@@ -859,22 +905,13 @@ func RenewSubscription(ctx context.Context, storeDB *pgxpool.Pool, code string,
 	return nil
 }
 
-// GetCart function performs the operation of loading awaiting payment projects for user from pgx database with a query.
+// GetCart function performs the operation of counting the copies of the projects in the cart of the user from pgx database with a query.
 func GetCart(ctx context.Context, storeDB *pgxpool.Pool, userID uint) (uint, error) {
 
-	var responseCart models.ResponseCart
-	responseCart.Projects = []models.CartObj{}
 	var countProjects uint
-	var orderID uint
-	err := storeDB.QueryRow(ctx, "SELECT orders_id FROM orders WHERE users_id = ($1) and status = ($2);", userID, "AWAITING_PAYMENT").Scan(&orderID)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-				log.Printf("Error happened when retrieving unpaid order info from pgx table. Err: %s", err)
-				return countProjects, err
-	}
-	log.Println(orderID)
-	err = storeDB.QueryRow(ctx, "SELECT COUNT(projects_id) FROM orders_has_projects WHERE orders_id = ($1);", orderID).Scan(&countProjects)
+	err := storeDB.QueryRow(ctx, "SELECT COALESCE(SUM(ci.quantity), 0) FROM cart_items ci JOIN carts c ON c.carts_id = ci.carts_id WHERE c.users_id = ($1);", userID).Scan(&countProjects)
 	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		log.Printf("Error happened when retrieving order projects from pgx table. Err: %s", err)
+		log.Printf("Error happened when counting copies in the cart in pgx table. Err: %s", err)
 		return countProjects, err
 	}
 	return countProjects, nil